@@ -80,6 +80,171 @@ func (UpdateStatus) EnumDescriptor() ([]byte, []int) {
 	return file_device_proto_rawDescGZIP(), []int{0}
 }
 
+type CommandStream int32
+
+const (
+	CommandStream_COMMAND_STREAM_UNSPECIFIED CommandStream = 0
+	CommandStream_COMMAND_STREAM_STDOUT      CommandStream = 1
+	CommandStream_COMMAND_STREAM_STDERR      CommandStream = 2
+)
+
+// Enum value maps for CommandStream.
+var (
+	CommandStream_name = map[int32]string{
+		0: "COMMAND_STREAM_UNSPECIFIED",
+		1: "COMMAND_STREAM_STDOUT",
+		2: "COMMAND_STREAM_STDERR",
+	}
+	CommandStream_value = map[string]int32{
+		"COMMAND_STREAM_UNSPECIFIED": 0,
+		"COMMAND_STREAM_STDOUT":      1,
+		"COMMAND_STREAM_STDERR":      2,
+	}
+)
+
+func (x CommandStream) Enum() *CommandStream {
+	p := new(CommandStream)
+	*p = x
+	return p
+}
+
+func (x CommandStream) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (CommandStream) Descriptor() protoreflect.EnumDescriptor {
+	return file_device_proto_enumTypes[1].Descriptor()
+}
+
+func (CommandStream) Type() protoreflect.EnumType {
+	return &file_device_proto_enumTypes[1]
+}
+
+func (x CommandStream) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use CommandStream.Descriptor instead.
+func (CommandStream) EnumDescriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{1}
+}
+
+type PolicyRule int32
+
+const (
+	PolicyRule_POLICY_RULE_UNSPECIFIED         PolicyRule = 0
+	PolicyRule_POLICY_RULE_COMMAND             PolicyRule = 1
+	PolicyRule_POLICY_RULE_FILE_PATH           PolicyRule = 2
+	PolicyRule_POLICY_RULE_FORWARD_DESTINATION PolicyRule = 3
+)
+
+// Enum value maps for PolicyRule.
+var (
+	PolicyRule_name = map[int32]string{
+		0: "POLICY_RULE_UNSPECIFIED",
+		1: "POLICY_RULE_COMMAND",
+		2: "POLICY_RULE_FILE_PATH",
+		3: "POLICY_RULE_FORWARD_DESTINATION",
+	}
+	PolicyRule_value = map[string]int32{
+		"POLICY_RULE_UNSPECIFIED":         0,
+		"POLICY_RULE_COMMAND":             1,
+		"POLICY_RULE_FILE_PATH":           2,
+		"POLICY_RULE_FORWARD_DESTINATION": 3,
+	}
+)
+
+func (x PolicyRule) Enum() *PolicyRule {
+	p := new(PolicyRule)
+	*p = x
+	return p
+}
+
+func (x PolicyRule) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PolicyRule) Descriptor() protoreflect.EnumDescriptor {
+	return file_device_proto_enumTypes[2].Descriptor()
+}
+
+func (PolicyRule) Type() protoreflect.EnumType {
+	return &file_device_proto_enumTypes[2]
+}
+
+func (x PolicyRule) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PolicyRule.Descriptor instead.
+func (PolicyRule) EnumDescriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{2}
+}
+
+type FileOperation int32
+
+const (
+	FileOperation_FILE_OPERATION_UNSPECIFIED FileOperation = 0
+	// Report a file's size, mode and BLAKE3 hash before it is downloaded
+	FileOperation_FILE_OPERATION_STAT FileOperation = 1
+	// Read length bytes at offset
+	FileOperation_FILE_OPERATION_READ FileOperation = 2
+	// Write data at offset to the transfer's partial file
+	FileOperation_FILE_OPERATION_WRITE FileOperation = 3
+	// Check the partial file against size and file_hash and move it into
+	// place at path
+	FileOperation_FILE_OPERATION_COMMIT FileOperation = 4
+	// Remove the transfer's partial file
+	FileOperation_FILE_OPERATION_ABORT FileOperation = 5
+)
+
+// Enum value maps for FileOperation.
+var (
+	FileOperation_name = map[int32]string{
+		0: "FILE_OPERATION_UNSPECIFIED",
+		1: "FILE_OPERATION_STAT",
+		2: "FILE_OPERATION_READ",
+		3: "FILE_OPERATION_WRITE",
+		4: "FILE_OPERATION_COMMIT",
+		5: "FILE_OPERATION_ABORT",
+	}
+	FileOperation_value = map[string]int32{
+		"FILE_OPERATION_UNSPECIFIED": 0,
+		"FILE_OPERATION_STAT":        1,
+		"FILE_OPERATION_READ":        2,
+		"FILE_OPERATION_WRITE":       3,
+		"FILE_OPERATION_COMMIT":      4,
+		"FILE_OPERATION_ABORT":       5,
+	}
+)
+
+func (x FileOperation) Enum() *FileOperation {
+	p := new(FileOperation)
+	*p = x
+	return p
+}
+
+func (x FileOperation) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FileOperation) Descriptor() protoreflect.EnumDescriptor {
+	return file_device_proto_enumTypes[3].Descriptor()
+}
+
+func (FileOperation) Type() protoreflect.EnumType {
+	return &file_device_proto_enumTypes[3]
+}
+
+func (x FileOperation) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FileOperation.Descriptor instead.
+func (FileOperation) EnumDescriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{3}
+}
+
 // DeviceMessage represents messages sent from device to control plane
 type DeviceMessage struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -88,6 +253,13 @@ type DeviceMessage struct {
 	//	*DeviceMessage_Heartbeat
 	//	*DeviceMessage_Health
 	//	*DeviceMessage_UpdateAck
+	//	*DeviceMessage_KeyRotation
+	//	*DeviceMessage_CommandOutput
+	//	*DeviceMessage_CommandResult
+	//	*DeviceMessage_PolicyDenial
+	//	*DeviceMessage_LogBatch
+	//	*DeviceMessage_FileResponse
+	//	*DeviceMessage_ConfigReport
 	Payload       isDeviceMessage_Payload `protobuf_oneof:"payload"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -157,6 +329,69 @@ func (x *DeviceMessage) GetUpdateAck() *UpdateAck {
 	return nil
 }
 
+func (x *DeviceMessage) GetKeyRotation() *KeyRotationRequest {
+	if x != nil {
+		if x, ok := x.Payload.(*DeviceMessage_KeyRotation); ok {
+			return x.KeyRotation
+		}
+	}
+	return nil
+}
+
+func (x *DeviceMessage) GetCommandOutput() *CommandOutput {
+	if x != nil {
+		if x, ok := x.Payload.(*DeviceMessage_CommandOutput); ok {
+			return x.CommandOutput
+		}
+	}
+	return nil
+}
+
+func (x *DeviceMessage) GetCommandResult() *CommandResult {
+	if x != nil {
+		if x, ok := x.Payload.(*DeviceMessage_CommandResult); ok {
+			return x.CommandResult
+		}
+	}
+	return nil
+}
+
+func (x *DeviceMessage) GetPolicyDenial() *PolicyDenial {
+	if x != nil {
+		if x, ok := x.Payload.(*DeviceMessage_PolicyDenial); ok {
+			return x.PolicyDenial
+		}
+	}
+	return nil
+}
+
+func (x *DeviceMessage) GetLogBatch() *LogBatch {
+	if x != nil {
+		if x, ok := x.Payload.(*DeviceMessage_LogBatch); ok {
+			return x.LogBatch
+		}
+	}
+	return nil
+}
+
+func (x *DeviceMessage) GetFileResponse() *FileResponse {
+	if x != nil {
+		if x, ok := x.Payload.(*DeviceMessage_FileResponse); ok {
+			return x.FileResponse
+		}
+	}
+	return nil
+}
+
+func (x *DeviceMessage) GetConfigReport() *ConfigReport {
+	if x != nil {
+		if x, ok := x.Payload.(*DeviceMessage_ConfigReport); ok {
+			return x.ConfigReport
+		}
+	}
+	return nil
+}
+
 type isDeviceMessage_Payload interface {
 	isDeviceMessage_Payload()
 }
@@ -173,12 +408,54 @@ type DeviceMessage_UpdateAck struct {
 	UpdateAck *UpdateAck `protobuf:"bytes,3,opt,name=update_ack,json=updateAck,proto3,oneof"`
 }
 
+type DeviceMessage_KeyRotation struct {
+	KeyRotation *KeyRotationRequest `protobuf:"bytes,4,opt,name=key_rotation,json=keyRotation,proto3,oneof"`
+}
+
+type DeviceMessage_CommandOutput struct {
+	CommandOutput *CommandOutput `protobuf:"bytes,5,opt,name=command_output,json=commandOutput,proto3,oneof"`
+}
+
+type DeviceMessage_CommandResult struct {
+	CommandResult *CommandResult `protobuf:"bytes,6,opt,name=command_result,json=commandResult,proto3,oneof"`
+}
+
+type DeviceMessage_PolicyDenial struct {
+	PolicyDenial *PolicyDenial `protobuf:"bytes,7,opt,name=policy_denial,json=policyDenial,proto3,oneof"`
+}
+
+type DeviceMessage_LogBatch struct {
+	LogBatch *LogBatch `protobuf:"bytes,8,opt,name=log_batch,json=logBatch,proto3,oneof"`
+}
+
+type DeviceMessage_FileResponse struct {
+	FileResponse *FileResponse `protobuf:"bytes,9,opt,name=file_response,json=fileResponse,proto3,oneof"`
+}
+
+type DeviceMessage_ConfigReport struct {
+	ConfigReport *ConfigReport `protobuf:"bytes,10,opt,name=config_report,json=configReport,proto3,oneof"`
+}
+
 func (*DeviceMessage_Heartbeat) isDeviceMessage_Payload() {}
 
 func (*DeviceMessage_Health) isDeviceMessage_Payload() {}
 
 func (*DeviceMessage_UpdateAck) isDeviceMessage_Payload() {}
 
+func (*DeviceMessage_KeyRotation) isDeviceMessage_Payload() {}
+
+func (*DeviceMessage_CommandOutput) isDeviceMessage_Payload() {}
+
+func (*DeviceMessage_CommandResult) isDeviceMessage_Payload() {}
+
+func (*DeviceMessage_PolicyDenial) isDeviceMessage_Payload() {}
+
+func (*DeviceMessage_LogBatch) isDeviceMessage_Payload() {}
+
+func (*DeviceMessage_FileResponse) isDeviceMessage_Payload() {}
+
+func (*DeviceMessage_ConfigReport) isDeviceMessage_Payload() {}
+
 // ControlMessage represents messages sent from control plane to device
 type ControlMessage struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
@@ -187,6 +464,15 @@ type ControlMessage struct {
 	//	*ControlMessage_HeartbeatAck
 	//	*ControlMessage_Update
 	//	*ControlMessage_Rollback
+	//	*ControlMessage_KeyRotationResult
+	//	*ControlMessage_AccessGrant
+	//	*ControlMessage_AccessRevoke
+	//	*ControlMessage_TunnelOpen
+	//	*ControlMessage_Command
+	//	*ControlMessage_LogRequest
+	//	*ControlMessage_LogCancel
+	//	*ControlMessage_FileRequest
+	//	*ControlMessage_ConfigUpdate
 	Payload       isControlMessage_Payload `protobuf_oneof:"payload"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -256,6 +542,87 @@ func (x *ControlMessage) GetRollback() *RollbackRequest {
 	return nil
 }
 
+func (x *ControlMessage) GetKeyRotationResult() *KeyRotationResult {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_KeyRotationResult); ok {
+			return x.KeyRotationResult
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetAccessGrant() *AccessGrant {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_AccessGrant); ok {
+			return x.AccessGrant
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetAccessRevoke() *AccessRevoke {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_AccessRevoke); ok {
+			return x.AccessRevoke
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetTunnelOpen() *TunnelOpen {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_TunnelOpen); ok {
+			return x.TunnelOpen
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetCommand() *CommandRequest {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_Command); ok {
+			return x.Command
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetLogRequest() *LogRequest {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_LogRequest); ok {
+			return x.LogRequest
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetLogCancel() *LogCancel {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_LogCancel); ok {
+			return x.LogCancel
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetFileRequest() *FileRequest {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_FileRequest); ok {
+			return x.FileRequest
+		}
+	}
+	return nil
+}
+
+func (x *ControlMessage) GetConfigUpdate() *ConfigUpdate {
+	if x != nil {
+		if x, ok := x.Payload.(*ControlMessage_ConfigUpdate); ok {
+			return x.ConfigUpdate
+		}
+	}
+	return nil
+}
+
 type isControlMessage_Payload interface {
 	isControlMessage_Payload()
 }
@@ -272,19 +639,75 @@ type ControlMessage_Rollback struct {
 	Rollback *RollbackRequest `protobuf:"bytes,3,opt,name=rollback,proto3,oneof"`
 }
 
+type ControlMessage_KeyRotationResult struct {
+	KeyRotationResult *KeyRotationResult `protobuf:"bytes,4,opt,name=key_rotation_result,json=keyRotationResult,proto3,oneof"`
+}
+
+type ControlMessage_AccessGrant struct {
+	AccessGrant *AccessGrant `protobuf:"bytes,5,opt,name=access_grant,json=accessGrant,proto3,oneof"`
+}
+
+type ControlMessage_AccessRevoke struct {
+	AccessRevoke *AccessRevoke `protobuf:"bytes,6,opt,name=access_revoke,json=accessRevoke,proto3,oneof"`
+}
+
+type ControlMessage_TunnelOpen struct {
+	TunnelOpen *TunnelOpen `protobuf:"bytes,7,opt,name=tunnel_open,json=tunnelOpen,proto3,oneof"`
+}
+
+type ControlMessage_Command struct {
+	Command *CommandRequest `protobuf:"bytes,8,opt,name=command,proto3,oneof"`
+}
+
+type ControlMessage_LogRequest struct {
+	LogRequest *LogRequest `protobuf:"bytes,9,opt,name=log_request,json=logRequest,proto3,oneof"`
+}
+
+type ControlMessage_LogCancel struct {
+	LogCancel *LogCancel `protobuf:"bytes,10,opt,name=log_cancel,json=logCancel,proto3,oneof"`
+}
+
+type ControlMessage_FileRequest struct {
+	FileRequest *FileRequest `protobuf:"bytes,11,opt,name=file_request,json=fileRequest,proto3,oneof"`
+}
+
+type ControlMessage_ConfigUpdate struct {
+	ConfigUpdate *ConfigUpdate `protobuf:"bytes,12,opt,name=config_update,json=configUpdate,proto3,oneof"`
+}
+
 func (*ControlMessage_HeartbeatAck) isControlMessage_Payload() {}
 
 func (*ControlMessage_Update) isControlMessage_Payload() {}
 
 func (*ControlMessage_Rollback) isControlMessage_Payload() {}
 
+func (*ControlMessage_KeyRotationResult) isControlMessage_Payload() {}
+
+func (*ControlMessage_AccessGrant) isControlMessage_Payload() {}
+
+func (*ControlMessage_AccessRevoke) isControlMessage_Payload() {}
+
+func (*ControlMessage_TunnelOpen) isControlMessage_Payload() {}
+
+func (*ControlMessage_Command) isControlMessage_Payload() {}
+
+func (*ControlMessage_LogRequest) isControlMessage_Payload() {}
+
+func (*ControlMessage_LogCancel) isControlMessage_Payload() {}
+
+func (*ControlMessage_FileRequest) isControlMessage_Payload() {}
+
+func (*ControlMessage_ConfigUpdate) isControlMessage_Payload() {}
+
 // HeartbeatRequest sent periodically by device to indicate it's online
 type HeartbeatRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	DeviceId      string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
-	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
-	AgentVersion  string                 `protobuf:"bytes,3,opt,name=agent_version,json=agentVersion,proto3" json:"agent_version,omitempty"`
-	Metrics       *DeviceMetrics         `protobuf:"bytes,4,opt,name=metrics,proto3" json:"metrics,omitempty"`
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId     string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	Timestamp    *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	AgentVersion string                 `protobuf:"bytes,3,opt,name=agent_version,json=agentVersion,proto3" json:"agent_version,omitempty"`
+	Metrics      *DeviceMetrics         `protobuf:"bytes,4,opt,name=metrics,proto3" json:"metrics,omitempty"`
+	// Labels reported by the agent, e.g. from its --labels flag
+	Labels        map[string]string `protobuf:"bytes,5,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -347,6 +770,13 @@ func (x *HeartbeatRequest) GetMetrics() *DeviceMetrics {
 	return nil
 }
 
+func (x *HeartbeatRequest) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
 // HeartbeatAck acknowledges receipt of heartbeat
 type HeartbeatAck struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -394,14 +824,21 @@ func (x *HeartbeatAck) GetTimestamp() *timestamppb.Timestamp {
 
 // DeviceMetrics contains device health and performance metrics
 type DeviceMetrics struct {
-	state          protoimpl.MessageState `protogen:"open.v1"`
-	CpuPercent     float64                `protobuf:"fixed64,1,opt,name=cpu_percent,json=cpuPercent,proto3" json:"cpu_percent,omitempty"`
-	MemoryPercent  float64                `protobuf:"fixed64,2,opt,name=memory_percent,json=memoryPercent,proto3" json:"memory_percent,omitempty"`
-	DiskUsedBytes  uint64                 `protobuf:"varint,3,opt,name=disk_used_bytes,json=diskUsedBytes,proto3" json:"disk_used_bytes,omitempty"`
-	DiskTotalBytes uint64                 `protobuf:"varint,4,opt,name=disk_total_bytes,json=diskTotalBytes,proto3" json:"disk_total_bytes,omitempty"`
-	UptimeSeconds  float64                `protobuf:"fixed64,5,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"`
-	unknownFields  protoimpl.UnknownFields
-	sizeCache      protoimpl.SizeCache
+	state                protoimpl.MessageState     `protogen:"open.v1"`
+	CpuPercent           float64                    `protobuf:"fixed64,1,opt,name=cpu_percent,json=cpuPercent,proto3" json:"cpu_percent,omitempty"`
+	MemoryPercent        float64                    `protobuf:"fixed64,2,opt,name=memory_percent,json=memoryPercent,proto3" json:"memory_percent,omitempty"`
+	DiskUsedBytes        uint64                     `protobuf:"varint,3,opt,name=disk_used_bytes,json=diskUsedBytes,proto3" json:"disk_used_bytes,omitempty"`
+	DiskTotalBytes       uint64                     `protobuf:"varint,4,opt,name=disk_total_bytes,json=diskTotalBytes,proto3" json:"disk_total_bytes,omitempty"`
+	UptimeSeconds        float64                    `protobuf:"fixed64,5,opt,name=uptime_seconds,json=uptimeSeconds,proto3" json:"uptime_seconds,omitempty"`
+	MemoryTotalBytes     uint64                     `protobuf:"varint,6,opt,name=memory_total_bytes,json=memoryTotalBytes,proto3" json:"memory_total_bytes,omitempty"`
+	MemoryAvailableBytes uint64                     `protobuf:"varint,7,opt,name=memory_available_bytes,json=memoryAvailableBytes,proto3" json:"memory_available_bytes,omitempty"`
+	Load1                float64                    `protobuf:"fixed64,8,opt,name=load1,proto3" json:"load1,omitempty"`
+	Load5                float64                    `protobuf:"fixed64,9,opt,name=load5,proto3" json:"load5,omitempty"`
+	Load15               float64                    `protobuf:"fixed64,10,opt,name=load15,proto3" json:"load15,omitempty"`
+	NetworkInterfaces    []*NetworkInterfaceMetrics `protobuf:"bytes,11,rep,name=network_interfaces,json=networkInterfaces,proto3" json:"network_interfaces,omitempty"`
+	Temperatures         []*TemperatureReading      `protobuf:"bytes,12,rep,name=temperatures,proto3" json:"temperatures,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
 }
 
 func (x *DeviceMetrics) Reset() {
@@ -469,25 +906,220 @@ func (x *DeviceMetrics) GetUptimeSeconds() float64 {
 	return 0
 }
 
-// HealthReport contains health check results after an update
-type HealthReport struct {
-	state          protoimpl.MessageState `protogen:"open.v1"`
-	DeviceId       string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
-	RolloutId      string                 `protobuf:"bytes,2,opt,name=rollout_id,json=rolloutId,proto3" json:"rollout_id,omitempty"`
-	Healthy        bool                   `protobuf:"varint,3,opt,name=healthy,proto3" json:"healthy,omitempty"`
-	HealthCheckUrl string                 `protobuf:"bytes,4,opt,name=health_check_url,json=healthCheckUrl,proto3" json:"health_check_url,omitempty"`
-	HttpStatusCode int32                  `protobuf:"varint,5,opt,name=http_status_code,json=httpStatusCode,proto3" json:"http_status_code,omitempty"`
-	ErrorMessage   string                 `protobuf:"bytes,6,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
-	Timestamp      *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
-	unknownFields  protoimpl.UnknownFields
-	sizeCache      protoimpl.SizeCache
+func (x *DeviceMetrics) GetMemoryTotalBytes() uint64 {
+	if x != nil {
+		return x.MemoryTotalBytes
+	}
+	return 0
 }
 
-func (x *HealthReport) Reset() {
-	*x = HealthReport{}
-	mi := &file_device_proto_msgTypes[5]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
+func (x *DeviceMetrics) GetMemoryAvailableBytes() uint64 {
+	if x != nil {
+		return x.MemoryAvailableBytes
+	}
+	return 0
+}
+
+func (x *DeviceMetrics) GetLoad1() float64 {
+	if x != nil {
+		return x.Load1
+	}
+	return 0
+}
+
+func (x *DeviceMetrics) GetLoad5() float64 {
+	if x != nil {
+		return x.Load5
+	}
+	return 0
+}
+
+func (x *DeviceMetrics) GetLoad15() float64 {
+	if x != nil {
+		return x.Load15
+	}
+	return 0
+}
+
+func (x *DeviceMetrics) GetNetworkInterfaces() []*NetworkInterfaceMetrics {
+	if x != nil {
+		return x.NetworkInterfaces
+	}
+	return nil
+}
+
+func (x *DeviceMetrics) GetTemperatures() []*TemperatureReading {
+	if x != nil {
+		return x.Temperatures
+	}
+	return nil
+}
+
+// NetworkInterfaceMetrics contains cumulative counters for a network interface
+type NetworkInterfaceMetrics struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	RxBytes       uint64                 `protobuf:"varint,2,opt,name=rx_bytes,json=rxBytes,proto3" json:"rx_bytes,omitempty"`
+	TxBytes       uint64                 `protobuf:"varint,3,opt,name=tx_bytes,json=txBytes,proto3" json:"tx_bytes,omitempty"`
+	RxPackets     uint64                 `protobuf:"varint,4,opt,name=rx_packets,json=rxPackets,proto3" json:"rx_packets,omitempty"`
+	TxPackets     uint64                 `protobuf:"varint,5,opt,name=tx_packets,json=txPackets,proto3" json:"tx_packets,omitempty"`
+	RxErrors      uint64                 `protobuf:"varint,6,opt,name=rx_errors,json=rxErrors,proto3" json:"rx_errors,omitempty"`
+	TxErrors      uint64                 `protobuf:"varint,7,opt,name=tx_errors,json=txErrors,proto3" json:"tx_errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NetworkInterfaceMetrics) Reset() {
+	*x = NetworkInterfaceMetrics{}
+	mi := &file_device_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NetworkInterfaceMetrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NetworkInterfaceMetrics) ProtoMessage() {}
+
+func (x *NetworkInterfaceMetrics) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NetworkInterfaceMetrics.ProtoReflect.Descriptor instead.
+func (*NetworkInterfaceMetrics) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *NetworkInterfaceMetrics) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *NetworkInterfaceMetrics) GetRxBytes() uint64 {
+	if x != nil {
+		return x.RxBytes
+	}
+	return 0
+}
+
+func (x *NetworkInterfaceMetrics) GetTxBytes() uint64 {
+	if x != nil {
+		return x.TxBytes
+	}
+	return 0
+}
+
+func (x *NetworkInterfaceMetrics) GetRxPackets() uint64 {
+	if x != nil {
+		return x.RxPackets
+	}
+	return 0
+}
+
+func (x *NetworkInterfaceMetrics) GetTxPackets() uint64 {
+	if x != nil {
+		return x.TxPackets
+	}
+	return 0
+}
+
+func (x *NetworkInterfaceMetrics) GetRxErrors() uint64 {
+	if x != nil {
+		return x.RxErrors
+	}
+	return 0
+}
+
+func (x *NetworkInterfaceMetrics) GetTxErrors() uint64 {
+	if x != nil {
+		return x.TxErrors
+	}
+	return 0
+}
+
+// TemperatureReading contains a single thermal zone reading
+type TemperatureReading struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Zone          string                 `protobuf:"bytes,1,opt,name=zone,proto3" json:"zone,omitempty"`
+	Celsius       float64                `protobuf:"fixed64,2,opt,name=celsius,proto3" json:"celsius,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TemperatureReading) Reset() {
+	*x = TemperatureReading{}
+	mi := &file_device_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TemperatureReading) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TemperatureReading) ProtoMessage() {}
+
+func (x *TemperatureReading) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TemperatureReading.ProtoReflect.Descriptor instead.
+func (*TemperatureReading) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TemperatureReading) GetZone() string {
+	if x != nil {
+		return x.Zone
+	}
+	return ""
+}
+
+func (x *TemperatureReading) GetCelsius() float64 {
+	if x != nil {
+		return x.Celsius
+	}
+	return 0
+}
+
+// HealthReport contains health check results after an update
+type HealthReport struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	DeviceId       string                 `protobuf:"bytes,1,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"`
+	RolloutId      string                 `protobuf:"bytes,2,opt,name=rollout_id,json=rolloutId,proto3" json:"rollout_id,omitempty"`
+	Healthy        bool                   `protobuf:"varint,3,opt,name=healthy,proto3" json:"healthy,omitempty"`
+	HealthCheckUrl string                 `protobuf:"bytes,4,opt,name=health_check_url,json=healthCheckUrl,proto3" json:"health_check_url,omitempty"`
+	HttpStatusCode int32                  `protobuf:"varint,5,opt,name=http_status_code,json=httpStatusCode,proto3" json:"http_status_code,omitempty"`
+	ErrorMessage   string                 `protobuf:"bytes,6,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	Timestamp      *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *HealthReport) Reset() {
+	*x = HealthReport{}
+	mi := &file_device_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
 
 func (x *HealthReport) String() string {
@@ -497,7 +1129,7 @@ func (x *HealthReport) String() string {
 func (*HealthReport) ProtoMessage() {}
 
 func (x *HealthReport) ProtoReflect() protoreflect.Message {
-	mi := &file_device_proto_msgTypes[5]
+	mi := &file_device_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -510,7 +1142,7 @@ func (x *HealthReport) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use HealthReport.ProtoReflect.Descriptor instead.
 func (*HealthReport) Descriptor() ([]byte, []int) {
-	return file_device_proto_rawDescGZIP(), []int{5}
+	return file_device_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *HealthReport) GetDeviceId() string {
@@ -562,7 +1194,11 @@ func (x *HealthReport) GetTimestamp() *timestamppb.Timestamp {
 	return nil
 }
 
-// UpdateNotification instructs device to download and apply an update
+// UpdateNotification instructs device to download and apply an update.
+// AGENT artifacts replace the agent binary itself; others are installed by
+// the installer the agent has for their type, into the slot their name
+// gives. The signature is made with the organization's artifact signing key
+// over the BLAKE3 hash in hex.
 type UpdateNotification struct {
 	state           protoimpl.MessageState `protogen:"open.v1"`
 	RolloutId       string                 `protobuf:"bytes,1,opt,name=rollout_id,json=rolloutId,proto3" json:"rollout_id,omitempty"`
@@ -574,13 +1210,15 @@ type UpdateNotification struct {
 	SizeBytes       int64                  `protobuf:"varint,7,opt,name=size_bytes,json=sizeBytes,proto3" json:"size_bytes,omitempty"`
 	HealthCheckUrl  string                 `protobuf:"bytes,8,opt,name=health_check_url,json=healthCheckUrl,proto3" json:"health_check_url,omitempty"`
 	SoakTimeSeconds int32                  `protobuf:"varint,9,opt,name=soak_time_seconds,json=soakTimeSeconds,proto3" json:"soak_time_seconds,omitempty"`
+	ArtifactType    string                 `protobuf:"bytes,10,opt,name=artifact_type,json=artifactType,proto3" json:"artifact_type,omitempty"` // AGENT, or the type an installer is registered for
+	ArtifactName    string                 `protobuf:"bytes,11,opt,name=artifact_name,json=artifactName,proto3" json:"artifact_name,omitempty"`
 	unknownFields   protoimpl.UnknownFields
 	sizeCache       protoimpl.SizeCache
 }
 
 func (x *UpdateNotification) Reset() {
 	*x = UpdateNotification{}
-	mi := &file_device_proto_msgTypes[6]
+	mi := &file_device_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -592,7 +1230,7 @@ func (x *UpdateNotification) String() string {
 func (*UpdateNotification) ProtoMessage() {}
 
 func (x *UpdateNotification) ProtoReflect() protoreflect.Message {
-	mi := &file_device_proto_msgTypes[6]
+	mi := &file_device_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -605,7 +1243,7 @@ func (x *UpdateNotification) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateNotification.ProtoReflect.Descriptor instead.
 func (*UpdateNotification) Descriptor() ([]byte, []int) {
-	return file_device_proto_rawDescGZIP(), []int{6}
+	return file_device_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *UpdateNotification) GetRolloutId() string {
@@ -671,6 +1309,20 @@ func (x *UpdateNotification) GetSoakTimeSeconds() int32 {
 	return 0
 }
 
+func (x *UpdateNotification) GetArtifactType() string {
+	if x != nil {
+		return x.ArtifactType
+	}
+	return ""
+}
+
+func (x *UpdateNotification) GetArtifactName() string {
+	if x != nil {
+		return x.ArtifactName
+	}
+	return ""
+}
+
 // UpdateAck acknowledges receipt and status of update
 type UpdateAck struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
@@ -685,7 +1337,7 @@ type UpdateAck struct {
 
 func (x *UpdateAck) Reset() {
 	*x = UpdateAck{}
-	mi := &file_device_proto_msgTypes[7]
+	mi := &file_device_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -697,7 +1349,7 @@ func (x *UpdateAck) String() string {
 func (*UpdateAck) ProtoMessage() {}
 
 func (x *UpdateAck) ProtoReflect() protoreflect.Message {
-	mi := &file_device_proto_msgTypes[7]
+	mi := &file_device_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -710,7 +1362,7 @@ func (x *UpdateAck) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use UpdateAck.ProtoReflect.Descriptor instead.
 func (*UpdateAck) Descriptor() ([]byte, []int) {
-	return file_device_proto_rawDescGZIP(), []int{7}
+	return file_device_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *UpdateAck) GetDeviceId() string {
@@ -759,7 +1411,7 @@ type RollbackRequest struct {
 
 func (x *RollbackRequest) Reset() {
 	*x = RollbackRequest{}
-	mi := &file_device_proto_msgTypes[8]
+	mi := &file_device_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -771,7 +1423,7 @@ func (x *RollbackRequest) String() string {
 func (*RollbackRequest) ProtoMessage() {}
 
 func (x *RollbackRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_device_proto_msgTypes[8]
+	mi := &file_device_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -784,7 +1436,7 @@ func (x *RollbackRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RollbackRequest.ProtoReflect.Descriptor instead.
 func (*RollbackRequest) Descriptor() ([]byte, []int) {
-	return file_device_proto_rawDescGZIP(), []int{8}
+	return file_device_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *RollbackRequest) GetRolloutId() string {
@@ -801,79 +1453,1614 @@ func (x *RollbackRequest) GetReason() string {
 	return ""
 }
 
-var File_device_proto protoreflect.FileDescriptor
+// KeyRotationRequest replaces the device's Ed25519 and WireGuard keys. The
+// signature is made with the new Ed25519 key over
+// "safeedge-rotate:<device_id>:<old_public_key>:<public_key>:<wireguard_public_key>".
+type KeyRotationRequest struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	PublicKey          string                 `protobuf:"bytes,1,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	WireguardPublicKey string                 `protobuf:"bytes,2,opt,name=wireguard_public_key,json=wireguardPublicKey,proto3" json:"wireguard_public_key,omitempty"`
+	Signature          []byte                 `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
 
-const file_device_proto_rawDesc = "" +
-	"\n" +
-	"\fdevice.proto\x12\vsafeedge.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xc7\x01\n" +
-	"\rDeviceMessage\x12=\n" +
-	"\theartbeat\x18\x01 \x01(\v2\x1d.safeedge.v1.HeartbeatRequestH\x00R\theartbeat\x123\n" +
-	"\x06health\x18\x02 \x01(\v2\x19.safeedge.v1.HealthReportH\x00R\x06health\x127\n" +
-	"\n" +
-	"update_ack\x18\x03 \x01(\v2\x16.safeedge.v1.UpdateAckH\x00R\tupdateAckB\t\n" +
-	"\apayload\"\xd4\x01\n" +
-	"\x0eControlMessage\x12@\n" +
-	"\rheartbeat_ack\x18\x01 \x01(\v2\x19.safeedge.v1.HeartbeatAckH\x00R\fheartbeatAck\x129\n" +
-	"\x06update\x18\x02 \x01(\v2\x1f.safeedge.v1.UpdateNotificationH\x00R\x06update\x12:\n" +
-	"\brollback\x18\x03 \x01(\v2\x1c.safeedge.v1.RollbackRequestH\x00R\brollbackB\t\n" +
-	"\apayload\"\xc4\x01\n" +
-	"\x10HeartbeatRequest\x12\x1b\n" +
-	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x128\n" +
-	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12#\n" +
-	"\ragent_version\x18\x03 \x01(\tR\fagentVersion\x124\n" +
-	"\ametrics\x18\x04 \x01(\v2\x1a.safeedge.v1.DeviceMetricsR\ametrics\"H\n" +
-	"\fHeartbeatAck\x128\n" +
-	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\"\xd0\x01\n" +
-	"\rDeviceMetrics\x12\x1f\n" +
-	"\vcpu_percent\x18\x01 \x01(\x01R\n" +
-	"cpuPercent\x12%\n" +
-	"\x0ememory_percent\x18\x02 \x01(\x01R\rmemoryPercent\x12&\n" +
-	"\x0fdisk_used_bytes\x18\x03 \x01(\x04R\rdiskUsedBytes\x12(\n" +
-	"\x10disk_total_bytes\x18\x04 \x01(\x04R\x0ediskTotalBytes\x12%\n" +
-	"\x0euptime_seconds\x18\x05 \x01(\x01R\ruptimeSeconds\"\x97\x02\n" +
-	"\fHealthReport\x12\x1b\n" +
-	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12\x1d\n" +
-	"\n" +
-	"rollout_id\x18\x02 \x01(\tR\trolloutId\x12\x18\n" +
-	"\ahealthy\x18\x03 \x01(\bR\ahealthy\x12(\n" +
-	"\x10health_check_url\x18\x04 \x01(\tR\x0ehealthCheckUrl\x12(\n" +
-	"\x10http_status_code\x18\x05 \x01(\x05R\x0ehttpStatusCode\x12#\n" +
-	"\rerror_message\x18\x06 \x01(\tR\ferrorMessage\x128\n" +
-	"\ttimestamp\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\"\xd1\x02\n" +
-	"\x12UpdateNotification\x12\x1d\n" +
-	"\n" +
-	"rollout_id\x18\x01 \x01(\tR\trolloutId\x12\x1f\n" +
-	"\vartifact_id\x18\x02 \x01(\tR\n" +
-	"artifactId\x12!\n" +
-	"\fartifact_url\x18\x03 \x01(\tR\vartifactUrl\x12\x1f\n" +
-	"\vblake3_hash\x18\x04 \x01(\tR\n" +
-	"blake3Hash\x12\x1c\n" +
-	"\tsignature\x18\x05 \x01(\fR\tsignature\x12$\n" +
-	"\x0esigning_key_id\x18\x06 \x01(\tR\fsigningKeyId\x12\x1d\n" +
-	"\n" +
-	"size_bytes\x18\a \x01(\x03R\tsizeBytes\x12(\n" +
-	"\x10health_check_url\x18\b \x01(\tR\x0ehealthCheckUrl\x12*\n" +
-	"\x11soak_time_seconds\x18\t \x01(\x05R\x0fsoakTimeSeconds\"\xd9\x01\n" +
-	"\tUpdateAck\x12\x1b\n" +
-	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12\x1d\n" +
-	"\n" +
-	"rollout_id\x18\x02 \x01(\tR\trolloutId\x121\n" +
-	"\x06status\x18\x03 \x01(\x0e2\x19.safeedge.v1.UpdateStatusR\x06status\x12#\n" +
-	"\rerror_message\x18\x04 \x01(\tR\ferrorMessage\x128\n" +
-	"\ttimestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\"H\n" +
-	"\x0fRollbackRequest\x12\x1d\n" +
-	"\n" +
-	"rollout_id\x18\x01 \x01(\tR\trolloutId\x12\x16\n" +
-	"\x06reason\x18\x02 \x01(\tR\x06reason*\xba\x01\n" +
-	"\fUpdateStatus\x12\x1d\n" +
-	"\x19UPDATE_STATUS_UNSPECIFIED\x10\x00\x12\x1d\n" +
-	"\x19UPDATE_STATUS_DOWNLOADING\x10\x01\x12\x1b\n" +
-	"\x17UPDATE_STATUS_VERIFYING\x10\x02\x12\x1a\n" +
-	"\x16UPDATE_STATUS_APPLYING\x10\x03\x12\x19\n" +
-	"\x15UPDATE_STATUS_SUCCESS\x10\x04\x12\x18\n" +
-	"\x14UPDATE_STATUS_FAILED\x10\x052\\\n" +
+func (x *KeyRotationRequest) Reset() {
+	*x = KeyRotationRequest{}
+	mi := &file_device_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyRotationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyRotationRequest) ProtoMessage() {}
+
+func (x *KeyRotationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyRotationRequest.ProtoReflect.Descriptor instead.
+func (*KeyRotationRequest) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *KeyRotationRequest) GetPublicKey() string {
+	if x != nil {
+		return x.PublicKey
+	}
+	return ""
+}
+
+func (x *KeyRotationRequest) GetWireguardPublicKey() string {
+	if x != nil {
+		return x.WireguardPublicKey
+	}
+	return ""
+}
+
+func (x *KeyRotationRequest) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+// KeyRotationResult tells the device whether its new keys are in effect
+type KeyRotationResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Accepted      bool                   `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	ErrorMessage  string                 `protobuf:"bytes,2,opt,name=error_message,json=errorMessage,proto3" json:"error_message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyRotationResult) Reset() {
+	*x = KeyRotationResult{}
+	mi := &file_device_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyRotationResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyRotationResult) ProtoMessage() {}
+
+func (x *KeyRotationResult) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyRotationResult.ProtoReflect.Descriptor instead.
+func (*KeyRotationResult) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *KeyRotationResult) GetAccepted() bool {
+	if x != nil {
+		return x.Accepted
+	}
+	return false
+}
+
+func (x *KeyRotationResult) GetErrorMessage() string {
+	if x != nil {
+		return x.ErrorMessage
+	}
+	return ""
+}
+
+// AccessGrant lets an access session's client open forwarded connections
+// through the agent until the session expires or is revoked. The control
+// plane sends the device's active grants again whenever it reconnects.
+type AccessGrant struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	SessionId string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	// Overlay address the client connects from
+	ClientIp string `protobuf:"bytes,2,opt,name=client_ip,json=clientIp,proto3" json:"client_ip,omitempty"`
+	// host:port destinations, as seen from the device, the client may reach
+	AllowedDestinations []string               `protobuf:"bytes,3,rep,name=allowed_destinations,json=allowedDestinations,proto3" json:"allowed_destinations,omitempty"`
+	ExpiresAt           *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *AccessGrant) Reset() {
+	*x = AccessGrant{}
+	mi := &file_device_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccessGrant) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccessGrant) ProtoMessage() {}
+
+func (x *AccessGrant) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccessGrant.ProtoReflect.Descriptor instead.
+func (*AccessGrant) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *AccessGrant) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *AccessGrant) GetClientIp() string {
+	if x != nil {
+		return x.ClientIp
+	}
+	return ""
+}
+
+func (x *AccessGrant) GetAllowedDestinations() []string {
+	if x != nil {
+		return x.AllowedDestinations
+	}
+	return nil
+}
+
+func (x *AccessGrant) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+// AccessRevoke ends an access session's forwarding
+type AccessRevoke struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AccessRevoke) Reset() {
+	*x = AccessRevoke{}
+	mi := &file_device_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AccessRevoke) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AccessRevoke) ProtoMessage() {}
+
+func (x *AccessRevoke) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AccessRevoke.ProtoReflect.Descriptor instead.
+func (*AccessRevoke) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *AccessRevoke) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+// TunnelOpen asks the agent to connect to destination for an access session
+// and relay the connection over a new Tunnel stream
+type TunnelOpen struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	StreamId  string                 `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	SessionId string                 `protobuf:"bytes,2,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	// host:port, as seen from the device
+	Destination   string `protobuf:"bytes,3,opt,name=destination,proto3" json:"destination,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TunnelOpen) Reset() {
+	*x = TunnelOpen{}
+	mi := &file_device_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TunnelOpen) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TunnelOpen) ProtoMessage() {}
+
+func (x *TunnelOpen) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TunnelOpen.ProtoReflect.Descriptor instead.
+func (*TunnelOpen) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *TunnelOpen) GetStreamId() string {
+	if x != nil {
+		return x.StreamId
+	}
+	return ""
+}
+
+func (x *TunnelOpen) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *TunnelOpen) GetDestination() string {
+	if x != nil {
+		return x.Destination
+	}
+	return ""
+}
+
+// TunnelFrame carries data of a relayed connection. The agent's first frame
+// names the stream it answers and, if it could not connect, the error. The
+// agent ends its direction by closing its send side; the control plane ends
+// both by finishing the call.
+type TunnelFrame struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StreamId      string                 `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TunnelFrame) Reset() {
+	*x = TunnelFrame{}
+	mi := &file_device_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TunnelFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TunnelFrame) ProtoMessage() {}
+
+func (x *TunnelFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TunnelFrame.ProtoReflect.Descriptor instead.
+func (*TunnelFrame) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *TunnelFrame) GetStreamId() string {
+	if x != nil {
+		return x.StreamId
+	}
+	return ""
+}
+
+func (x *TunnelFrame) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *TunnelFrame) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// CommandRequest asks the agent to run an allowlisted command or script,
+// without a shell, streaming its output back as CommandOutput and ending
+// with a CommandResult
+type CommandRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	CommandId string                 `protobuf:"bytes,1,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"`
+	// Name of a command on the agent's allowlist or of a script in its script
+	// directory
+	Command string   `protobuf:"bytes,2,opt,name=command,proto3" json:"command,omitempty"`
+	Args    []string `protobuf:"bytes,3,rep,name=args,proto3" json:"args,omitempty"`
+	// The agent kills the command once it has run this long
+	TimeoutSeconds int32 `protobuf:"varint,4,opt,name=timeout_seconds,json=timeoutSeconds,proto3" json:"timeout_seconds,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *CommandRequest) Reset() {
+	*x = CommandRequest{}
+	mi := &file_device_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandRequest) ProtoMessage() {}
+
+func (x *CommandRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandRequest.ProtoReflect.Descriptor instead.
+func (*CommandRequest) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *CommandRequest) GetCommandId() string {
+	if x != nil {
+		return x.CommandId
+	}
+	return ""
+}
+
+func (x *CommandRequest) GetCommand() string {
+	if x != nil {
+		return x.Command
+	}
+	return ""
+}
+
+func (x *CommandRequest) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *CommandRequest) GetTimeoutSeconds() int32 {
+	if x != nil {
+		return x.TimeoutSeconds
+	}
+	return 0
+}
+
+// CommandOutput carries a chunk of a running command's output
+type CommandOutput struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CommandId     string                 `protobuf:"bytes,1,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"`
+	Stream        CommandStream          `protobuf:"varint,2,opt,name=stream,proto3,enum=safeedge.v1.CommandStream" json:"stream,omitempty"`
+	Data          []byte                 `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandOutput) Reset() {
+	*x = CommandOutput{}
+	mi := &file_device_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandOutput) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandOutput) ProtoMessage() {}
+
+func (x *CommandOutput) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandOutput.ProtoReflect.Descriptor instead.
+func (*CommandOutput) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *CommandOutput) GetCommandId() string {
+	if x != nil {
+		return x.CommandId
+	}
+	return ""
+}
+
+func (x *CommandOutput) GetStream() CommandStream {
+	if x != nil {
+		return x.Stream
+	}
+	return CommandStream_COMMAND_STREAM_UNSPECIFIED
+}
+
+func (x *CommandOutput) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// CommandResult ends a command. exit_code is -1 if the command could not be
+// started, in which case error says why, or was killed.
+type CommandResult struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	CommandId string                 `protobuf:"bytes,1,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"`
+	ExitCode  int32                  `protobuf:"varint,2,opt,name=exit_code,json=exitCode,proto3" json:"exit_code,omitempty"`
+	TimedOut  bool                   `protobuf:"varint,3,opt,name=timed_out,json=timedOut,proto3" json:"timed_out,omitempty"`
+	Error     string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	// Output past the agent's limit was not sent
+	OutputTruncated bool `protobuf:"varint,5,opt,name=output_truncated,json=outputTruncated,proto3" json:"output_truncated,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *CommandResult) Reset() {
+	*x = CommandResult{}
+	mi := &file_device_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandResult) ProtoMessage() {}
+
+func (x *CommandResult) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandResult.ProtoReflect.Descriptor instead.
+func (*CommandResult) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *CommandResult) GetCommandId() string {
+	if x != nil {
+		return x.CommandId
+	}
+	return ""
+}
+
+func (x *CommandResult) GetExitCode() int32 {
+	if x != nil {
+		return x.ExitCode
+	}
+	return 0
+}
+
+func (x *CommandResult) GetTimedOut() bool {
+	if x != nil {
+		return x.TimedOut
+	}
+	return false
+}
+
+func (x *CommandResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *CommandResult) GetOutputTruncated() bool {
+	if x != nil {
+		return x.OutputTruncated
+	}
+	return false
+}
+
+// PolicyDenial reports a request the device's local policy refused,
+// whatever the control plane asked for
+type PolicyDenial struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Rule  PolicyRule             `protobuf:"varint,1,opt,name=rule,proto3,enum=safeedge.v1.PolicyRule" json:"rule,omitempty"`
+	// The command name, file path or forward destination refused
+	Target string `protobuf:"bytes,2,opt,name=target,proto3" json:"target,omitempty"`
+	Reason string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	// The command or access session the request belonged to
+	ReferenceId string `protobuf:"bytes,4,opt,name=reference_id,json=referenceId,proto3" json:"reference_id,omitempty"`
+	// BLAKE3 hash of the policy file in force, empty if none could be loaded
+	PolicyHash    string `protobuf:"bytes,5,opt,name=policy_hash,json=policyHash,proto3" json:"policy_hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PolicyDenial) Reset() {
+	*x = PolicyDenial{}
+	mi := &file_device_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PolicyDenial) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PolicyDenial) ProtoMessage() {}
+
+func (x *PolicyDenial) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PolicyDenial.ProtoReflect.Descriptor instead.
+func (*PolicyDenial) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *PolicyDenial) GetRule() PolicyRule {
+	if x != nil {
+		return x.Rule
+	}
+	return PolicyRule_POLICY_RULE_UNSPECIFIED
+}
+
+func (x *PolicyDenial) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *PolicyDenial) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *PolicyDenial) GetReferenceId() string {
+	if x != nil {
+		return x.ReferenceId
+	}
+	return ""
+}
+
+func (x *PolicyDenial) GetPolicyHash() string {
+	if x != nil {
+		return x.PolicyHash
+	}
+	return ""
+}
+
+// LogRequest asks the agent for entries from its configured log sources,
+// answered with LogBatch messages carrying the same request_id. Without
+// follow the last batch has done set; with follow the agent keeps sending
+// new entries until a LogCancel.
+type LogRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	RequestId string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	// Source names to read, all of the agent's sources if empty
+	Sources []string               `protobuf:"bytes,2,rep,name=sources,proto3" json:"sources,omitempty"`
+	Since   *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=since,proto3" json:"since,omitempty"`
+	Until   *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=until,proto3" json:"until,omitempty"`
+	// The most recent max_entries entries are sent
+	MaxEntries    int32 `protobuf:"varint,5,opt,name=max_entries,json=maxEntries,proto3" json:"max_entries,omitempty"`
+	Follow        bool  `protobuf:"varint,6,opt,name=follow,proto3" json:"follow,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogRequest) Reset() {
+	*x = LogRequest{}
+	mi := &file_device_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogRequest) ProtoMessage() {}
+
+func (x *LogRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogRequest.ProtoReflect.Descriptor instead.
+func (*LogRequest) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *LogRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *LogRequest) GetSources() []string {
+	if x != nil {
+		return x.Sources
+	}
+	return nil
+}
+
+func (x *LogRequest) GetSince() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Since
+	}
+	return nil
+}
+
+func (x *LogRequest) GetUntil() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Until
+	}
+	return nil
+}
+
+func (x *LogRequest) GetMaxEntries() int32 {
+	if x != nil {
+		return x.MaxEntries
+	}
+	return 0
+}
+
+func (x *LogRequest) GetFollow() bool {
+	if x != nil {
+		return x.Follow
+	}
+	return false
+}
+
+// LogCancel stops a followed LogRequest
+type LogCancel struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestId     string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogCancel) Reset() {
+	*x = LogCancel{}
+	mi := &file_device_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogCancel) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogCancel) ProtoMessage() {}
+
+func (x *LogCancel) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogCancel.ProtoReflect.Descriptor instead.
+func (*LogCancel) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *LogCancel) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+// LogEntry is a line, or journal entry, from one of the agent's log sources
+type LogEntry struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Source string                 `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	// Unset if the entry has no timestamp the agent understands
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogEntry) Reset() {
+	*x = LogEntry{}
+	mi := &file_device_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogEntry) ProtoMessage() {}
+
+func (x *LogEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogEntry.ProtoReflect.Descriptor instead.
+func (*LogEntry) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *LogEntry) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *LogEntry) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *LogEntry) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// LogBatch carries log entries, in answer to a LogRequest or, with an empty
+// request_id, shipped continuously by an agent configured to do so
+type LogBatch struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	RequestId string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Entries   []*LogEntry            `protobuf:"bytes,2,rep,name=entries,proto3" json:"entries,omitempty"`
+	// Ends a request that is not followed
+	Done bool `protobuf:"varint,3,opt,name=done,proto3" json:"done,omitempty"`
+	// Why a source could not be read; the others are still sent
+	Error string `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	// Older entries in range were left out to keep within max_entries or the
+	// agent's scan limit
+	Truncated     bool `protobuf:"varint,5,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogBatch) Reset() {
+	*x = LogBatch{}
+	mi := &file_device_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogBatch) ProtoMessage() {}
+
+func (x *LogBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogBatch.ProtoReflect.Descriptor instead.
+func (*LogBatch) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *LogBatch) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *LogBatch) GetEntries() []*LogEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *LogBatch) GetDone() bool {
+	if x != nil {
+		return x.Done
+	}
+	return false
+}
+
+func (x *LogBatch) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *LogBatch) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+// FileRequest asks the agent to act on a file for a transfer, answered with
+// a FileResponse carrying the same request_id. Paths are resolved and
+// checked against the agent's transfer directories and device policy.
+type FileRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	RequestId  string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	TransferId string                 `protobuf:"bytes,2,opt,name=transfer_id,json=transferId,proto3" json:"transfer_id,omitempty"`
+	Operation  FileOperation          `protobuf:"varint,3,opt,name=operation,proto3,enum=safeedge.v1.FileOperation" json:"operation,omitempty"`
+	Path       string                 `protobuf:"bytes,4,opt,name=path,proto3" json:"path,omitempty"`
+	Offset     int64                  `protobuf:"varint,5,opt,name=offset,proto3" json:"offset,omitempty"`
+	Length     int32                  `protobuf:"varint,6,opt,name=length,proto3" json:"length,omitempty"`
+	Data       []byte                 `protobuf:"bytes,7,opt,name=data,proto3" json:"data,omitempty"`
+	// BLAKE3 hash of data
+	ChunkHash string `protobuf:"bytes,8,opt,name=chunk_hash,json=chunkHash,proto3" json:"chunk_hash,omitempty"`
+	// Size, BLAKE3 hash and permission bits of the whole file, for COMMIT
+	Size          int64  `protobuf:"varint,9,opt,name=size,proto3" json:"size,omitempty"`
+	FileHash      string `protobuf:"bytes,10,opt,name=file_hash,json=fileHash,proto3" json:"file_hash,omitempty"`
+	Mode          uint32 `protobuf:"varint,11,opt,name=mode,proto3" json:"mode,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileRequest) Reset() {
+	*x = FileRequest{}
+	mi := &file_device_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileRequest) ProtoMessage() {}
+
+func (x *FileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileRequest.ProtoReflect.Descriptor instead.
+func (*FileRequest) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *FileRequest) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *FileRequest) GetTransferId() string {
+	if x != nil {
+		return x.TransferId
+	}
+	return ""
+}
+
+func (x *FileRequest) GetOperation() FileOperation {
+	if x != nil {
+		return x.Operation
+	}
+	return FileOperation_FILE_OPERATION_UNSPECIFIED
+}
+
+func (x *FileRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *FileRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *FileRequest) GetLength() int32 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *FileRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *FileRequest) GetChunkHash() string {
+	if x != nil {
+		return x.ChunkHash
+	}
+	return ""
+}
+
+func (x *FileRequest) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *FileRequest) GetFileHash() string {
+	if x != nil {
+		return x.FileHash
+	}
+	return ""
+}
+
+func (x *FileRequest) GetMode() uint32 {
+	if x != nil {
+		return x.Mode
+	}
+	return 0
+}
+
+// FileResponse answers a FileRequest. error is set if the request was
+// refused or failed.
+type FileResponse struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	RequestId string                 `protobuf:"bytes,1,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	Error     string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	// The file's size, BLAKE3 hash and permission bits, for STAT
+	Size     int64  `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	FileHash string `protobuf:"bytes,4,opt,name=file_hash,json=fileHash,proto3" json:"file_hash,omitempty"`
+	Mode     uint32 `protobuf:"varint,5,opt,name=mode,proto3" json:"mode,omitempty"`
+	// Data read and its BLAKE3 hash, for READ
+	Data      []byte `protobuf:"bytes,6,opt,name=data,proto3" json:"data,omitempty"`
+	ChunkHash string `protobuf:"bytes,7,opt,name=chunk_hash,json=chunkHash,proto3" json:"chunk_hash,omitempty"`
+	// Bytes of the partial file written so far, for WRITE, including when
+	// the write is refused for not following on from them
+	Received      int64 `protobuf:"varint,8,opt,name=received,proto3" json:"received,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileResponse) Reset() {
+	*x = FileResponse{}
+	mi := &file_device_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileResponse) ProtoMessage() {}
+
+func (x *FileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileResponse.ProtoReflect.Descriptor instead.
+func (*FileResponse) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *FileResponse) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *FileResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *FileResponse) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *FileResponse) GetFileHash() string {
+	if x != nil {
+		return x.FileHash
+	}
+	return ""
+}
+
+func (x *FileResponse) GetMode() uint32 {
+	if x != nil {
+		return x.Mode
+	}
+	return 0
+}
+
+func (x *FileResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *FileResponse) GetChunkHash() string {
+	if x != nil {
+		return x.ChunkHash
+	}
+	return ""
+}
+
+func (x *FileResponse) GetReceived() int64 {
+	if x != nil {
+		return x.Received
+	}
+	return 0
+}
+
+// ConfigUpdate carries the device's desired configuration: a JSON object of
+// sections, each applied by the agent plugin its key names. It is sent when
+// the device connects and whenever the configuration changes.
+type ConfigUpdate struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// BLAKE3 hash of document
+	Hash          string `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	Document      []byte `protobuf:"bytes,2,opt,name=document,proto3" json:"document,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfigUpdate) Reset() {
+	*x = ConfigUpdate{}
+	mi := &file_device_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigUpdate) ProtoMessage() {}
+
+func (x *ConfigUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigUpdate.ProtoReflect.Descriptor instead.
+func (*ConfigUpdate) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *ConfigUpdate) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+func (x *ConfigUpdate) GetDocument() []byte {
+	if x != nil {
+		return x.Document
+	}
+	return nil
+}
+
+// ConfigError is why a section of the desired configuration could not be
+// applied or observed
+type ConfigError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Section       string                 `protobuf:"bytes,1,opt,name=section,proto3" json:"section,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfigError) Reset() {
+	*x = ConfigError{}
+	mi := &file_device_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigError) ProtoMessage() {}
+
+func (x *ConfigError) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigError.ProtoReflect.Descriptor instead.
+func (*ConfigError) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *ConfigError) GetSection() string {
+	if x != nil {
+		return x.Section
+	}
+	return ""
+}
+
+func (x *ConfigError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// ConfigReport carries the device's effective configuration, after applying
+// a ConfigUpdate and periodically after that
+type ConfigReport struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Hash of the desired configuration the agent last received
+	DesiredHash string `protobuf:"bytes,1,opt,name=desired_hash,json=desiredHash,proto3" json:"desired_hash,omitempty"`
+	// JSON object of the effective state of each desired section
+	Reported []byte         `protobuf:"bytes,2,opt,name=reported,proto3" json:"reported,omitempty"`
+	Errors   []*ConfigError `protobuf:"bytes,3,rep,name=errors,proto3" json:"errors,omitempty"`
+	// The effective configuration differs from the desired one
+	Drifted       bool `protobuf:"varint,4,opt,name=drifted,proto3" json:"drifted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfigReport) Reset() {
+	*x = ConfigReport{}
+	mi := &file_device_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigReport) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigReport) ProtoMessage() {}
+
+func (x *ConfigReport) ProtoReflect() protoreflect.Message {
+	mi := &file_device_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigReport.ProtoReflect.Descriptor instead.
+func (*ConfigReport) Descriptor() ([]byte, []int) {
+	return file_device_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *ConfigReport) GetDesiredHash() string {
+	if x != nil {
+		return x.DesiredHash
+	}
+	return ""
+}
+
+func (x *ConfigReport) GetReported() []byte {
+	if x != nil {
+		return x.Reported
+	}
+	return nil
+}
+
+func (x *ConfigReport) GetErrors() []*ConfigError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+func (x *ConfigReport) GetDrifted() bool {
+	if x != nil {
+		return x.Drifted
+	}
+	return false
+}
+
+var File_device_proto protoreflect.FileDescriptor
+
+const file_device_proto_rawDesc = "" +
+	"\n" +
+	"\fdevice.proto\x12\vsafeedge.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x93\x05\n" +
+	"\rDeviceMessage\x12=\n" +
+	"\theartbeat\x18\x01 \x01(\v2\x1d.safeedge.v1.HeartbeatRequestH\x00R\theartbeat\x123\n" +
+	"\x06health\x18\x02 \x01(\v2\x19.safeedge.v1.HealthReportH\x00R\x06health\x127\n" +
+	"\n" +
+	"update_ack\x18\x03 \x01(\v2\x16.safeedge.v1.UpdateAckH\x00R\tupdateAck\x12D\n" +
+	"\fkey_rotation\x18\x04 \x01(\v2\x1f.safeedge.v1.KeyRotationRequestH\x00R\vkeyRotation\x12C\n" +
+	"\x0ecommand_output\x18\x05 \x01(\v2\x1a.safeedge.v1.CommandOutputH\x00R\rcommandOutput\x12C\n" +
+	"\x0ecommand_result\x18\x06 \x01(\v2\x1a.safeedge.v1.CommandResultH\x00R\rcommandResult\x12@\n" +
+	"\rpolicy_denial\x18\a \x01(\v2\x19.safeedge.v1.PolicyDenialH\x00R\fpolicyDenial\x124\n" +
+	"\tlog_batch\x18\b \x01(\v2\x15.safeedge.v1.LogBatchH\x00R\blogBatch\x12@\n" +
+	"\rfile_response\x18\t \x01(\v2\x19.safeedge.v1.FileResponseH\x00R\ffileResponse\x12@\n" +
+	"\rconfig_report\x18\n" +
+	" \x01(\v2\x19.safeedge.v1.ConfigReportH\x00R\fconfigReportB\t\n" +
+	"\apayload\"\x92\x06\n" +
+	"\x0eControlMessage\x12@\n" +
+	"\rheartbeat_ack\x18\x01 \x01(\v2\x19.safeedge.v1.HeartbeatAckH\x00R\fheartbeatAck\x129\n" +
+	"\x06update\x18\x02 \x01(\v2\x1f.safeedge.v1.UpdateNotificationH\x00R\x06update\x12:\n" +
+	"\brollback\x18\x03 \x01(\v2\x1c.safeedge.v1.RollbackRequestH\x00R\brollback\x12P\n" +
+	"\x13key_rotation_result\x18\x04 \x01(\v2\x1e.safeedge.v1.KeyRotationResultH\x00R\x11keyRotationResult\x12=\n" +
+	"\faccess_grant\x18\x05 \x01(\v2\x18.safeedge.v1.AccessGrantH\x00R\vaccessGrant\x12@\n" +
+	"\raccess_revoke\x18\x06 \x01(\v2\x19.safeedge.v1.AccessRevokeH\x00R\faccessRevoke\x12:\n" +
+	"\vtunnel_open\x18\a \x01(\v2\x17.safeedge.v1.TunnelOpenH\x00R\n" +
+	"tunnelOpen\x127\n" +
+	"\acommand\x18\b \x01(\v2\x1b.safeedge.v1.CommandRequestH\x00R\acommand\x12:\n" +
+	"\vlog_request\x18\t \x01(\v2\x17.safeedge.v1.LogRequestH\x00R\n" +
+	"logRequest\x127\n" +
+	"\n" +
+	"log_cancel\x18\n" +
+	" \x01(\v2\x16.safeedge.v1.LogCancelH\x00R\tlogCancel\x12=\n" +
+	"\ffile_request\x18\v \x01(\v2\x18.safeedge.v1.FileRequestH\x00R\vfileRequest\x12@\n" +
+	"\rconfig_update\x18\f \x01(\v2\x19.safeedge.v1.ConfigUpdateH\x00R\fconfigUpdateB\t\n" +
+	"\apayload\"\xc2\x02\n" +
+	"\x10HeartbeatRequest\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12#\n" +
+	"\ragent_version\x18\x03 \x01(\tR\fagentVersion\x124\n" +
+	"\ametrics\x18\x04 \x01(\v2\x1a.safeedge.v1.DeviceMetricsR\ametrics\x12A\n" +
+	"\x06labels\x18\x05 \x03(\v2).safeedge.v1.HeartbeatRequest.LabelsEntryR\x06labels\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"H\n" +
+	"\fHeartbeatAck\x128\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\"\x92\x04\n" +
+	"\rDeviceMetrics\x12\x1f\n" +
+	"\vcpu_percent\x18\x01 \x01(\x01R\n" +
+	"cpuPercent\x12%\n" +
+	"\x0ememory_percent\x18\x02 \x01(\x01R\rmemoryPercent\x12&\n" +
+	"\x0fdisk_used_bytes\x18\x03 \x01(\x04R\rdiskUsedBytes\x12(\n" +
+	"\x10disk_total_bytes\x18\x04 \x01(\x04R\x0ediskTotalBytes\x12%\n" +
+	"\x0euptime_seconds\x18\x05 \x01(\x01R\ruptimeSeconds\x12,\n" +
+	"\x12memory_total_bytes\x18\x06 \x01(\x04R\x10memoryTotalBytes\x124\n" +
+	"\x16memory_available_bytes\x18\a \x01(\x04R\x14memoryAvailableBytes\x12\x14\n" +
+	"\x05load1\x18\b \x01(\x01R\x05load1\x12\x14\n" +
+	"\x05load5\x18\t \x01(\x01R\x05load5\x12\x16\n" +
+	"\x06load15\x18\n" +
+	" \x01(\x01R\x06load15\x12S\n" +
+	"\x12network_interfaces\x18\v \x03(\v2$.safeedge.v1.NetworkInterfaceMetricsR\x11networkInterfaces\x12C\n" +
+	"\ftemperatures\x18\f \x03(\v2\x1f.safeedge.v1.TemperatureReadingR\ftemperatures\"\xdb\x01\n" +
+	"\x17NetworkInterfaceMetrics\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x19\n" +
+	"\brx_bytes\x18\x02 \x01(\x04R\arxBytes\x12\x19\n" +
+	"\btx_bytes\x18\x03 \x01(\x04R\atxBytes\x12\x1d\n" +
+	"\n" +
+	"rx_packets\x18\x04 \x01(\x04R\trxPackets\x12\x1d\n" +
+	"\n" +
+	"tx_packets\x18\x05 \x01(\x04R\ttxPackets\x12\x1b\n" +
+	"\trx_errors\x18\x06 \x01(\x04R\brxErrors\x12\x1b\n" +
+	"\ttx_errors\x18\a \x01(\x04R\btxErrors\"B\n" +
+	"\x12TemperatureReading\x12\x12\n" +
+	"\x04zone\x18\x01 \x01(\tR\x04zone\x12\x18\n" +
+	"\acelsius\x18\x02 \x01(\x01R\acelsius\"\x97\x02\n" +
+	"\fHealthReport\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12\x1d\n" +
+	"\n" +
+	"rollout_id\x18\x02 \x01(\tR\trolloutId\x12\x18\n" +
+	"\ahealthy\x18\x03 \x01(\bR\ahealthy\x12(\n" +
+	"\x10health_check_url\x18\x04 \x01(\tR\x0ehealthCheckUrl\x12(\n" +
+	"\x10http_status_code\x18\x05 \x01(\x05R\x0ehttpStatusCode\x12#\n" +
+	"\rerror_message\x18\x06 \x01(\tR\ferrorMessage\x128\n" +
+	"\ttimestamp\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\"\x9b\x03\n" +
+	"\x12UpdateNotification\x12\x1d\n" +
+	"\n" +
+	"rollout_id\x18\x01 \x01(\tR\trolloutId\x12\x1f\n" +
+	"\vartifact_id\x18\x02 \x01(\tR\n" +
+	"artifactId\x12!\n" +
+	"\fartifact_url\x18\x03 \x01(\tR\vartifactUrl\x12\x1f\n" +
+	"\vblake3_hash\x18\x04 \x01(\tR\n" +
+	"blake3Hash\x12\x1c\n" +
+	"\tsignature\x18\x05 \x01(\fR\tsignature\x12$\n" +
+	"\x0esigning_key_id\x18\x06 \x01(\tR\fsigningKeyId\x12\x1d\n" +
+	"\n" +
+	"size_bytes\x18\a \x01(\x03R\tsizeBytes\x12(\n" +
+	"\x10health_check_url\x18\b \x01(\tR\x0ehealthCheckUrl\x12*\n" +
+	"\x11soak_time_seconds\x18\t \x01(\x05R\x0fsoakTimeSeconds\x12#\n" +
+	"\rartifact_type\x18\n" +
+	" \x01(\tR\fartifactType\x12#\n" +
+	"\rartifact_name\x18\v \x01(\tR\fartifactName\"\xd9\x01\n" +
+	"\tUpdateAck\x12\x1b\n" +
+	"\tdevice_id\x18\x01 \x01(\tR\bdeviceId\x12\x1d\n" +
+	"\n" +
+	"rollout_id\x18\x02 \x01(\tR\trolloutId\x121\n" +
+	"\x06status\x18\x03 \x01(\x0e2\x19.safeedge.v1.UpdateStatusR\x06status\x12#\n" +
+	"\rerror_message\x18\x04 \x01(\tR\ferrorMessage\x128\n" +
+	"\ttimestamp\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\"H\n" +
+	"\x0fRollbackRequest\x12\x1d\n" +
+	"\n" +
+	"rollout_id\x18\x01 \x01(\tR\trolloutId\x12\x16\n" +
+	"\x06reason\x18\x02 \x01(\tR\x06reason\"\x83\x01\n" +
+	"\x12KeyRotationRequest\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\x01 \x01(\tR\tpublicKey\x120\n" +
+	"\x14wireguard_public_key\x18\x02 \x01(\tR\x12wireguardPublicKey\x12\x1c\n" +
+	"\tsignature\x18\x03 \x01(\fR\tsignature\"T\n" +
+	"\x11KeyRotationResult\x12\x1a\n" +
+	"\baccepted\x18\x01 \x01(\bR\baccepted\x12#\n" +
+	"\rerror_message\x18\x02 \x01(\tR\ferrorMessage\"\xb7\x01\n" +
+	"\vAccessGrant\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x12\x1b\n" +
+	"\tclient_ip\x18\x02 \x01(\tR\bclientIp\x121\n" +
+	"\x14allowed_destinations\x18\x03 \x03(\tR\x13allowedDestinations\x129\n" +
+	"\n" +
+	"expires_at\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt\"-\n" +
+	"\fAccessRevoke\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\"j\n" +
+	"\n" +
+	"TunnelOpen\x12\x1b\n" +
+	"\tstream_id\x18\x01 \x01(\tR\bstreamId\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x02 \x01(\tR\tsessionId\x12 \n" +
+	"\vdestination\x18\x03 \x01(\tR\vdestination\"T\n" +
+	"\vTunnelFrame\x12\x1b\n" +
+	"\tstream_id\x18\x01 \x01(\tR\bstreamId\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\x86\x01\n" +
+	"\x0eCommandRequest\x12\x1d\n" +
+	"\n" +
+	"command_id\x18\x01 \x01(\tR\tcommandId\x12\x18\n" +
+	"\acommand\x18\x02 \x01(\tR\acommand\x12\x12\n" +
+	"\x04args\x18\x03 \x03(\tR\x04args\x12'\n" +
+	"\x0ftimeout_seconds\x18\x04 \x01(\x05R\x0etimeoutSeconds\"v\n" +
+	"\rCommandOutput\x12\x1d\n" +
+	"\n" +
+	"command_id\x18\x01 \x01(\tR\tcommandId\x122\n" +
+	"\x06stream\x18\x02 \x01(\x0e2\x1a.safeedge.v1.CommandStreamR\x06stream\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\"\xa9\x01\n" +
+	"\rCommandResult\x12\x1d\n" +
+	"\n" +
+	"command_id\x18\x01 \x01(\tR\tcommandId\x12\x1b\n" +
+	"\texit_code\x18\x02 \x01(\x05R\bexitCode\x12\x1b\n" +
+	"\ttimed_out\x18\x03 \x01(\bR\btimedOut\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12)\n" +
+	"\x10output_truncated\x18\x05 \x01(\bR\x0foutputTruncated\"\xaf\x01\n" +
+	"\fPolicyDenial\x12+\n" +
+	"\x04rule\x18\x01 \x01(\x0e2\x17.safeedge.v1.PolicyRuleR\x04rule\x12\x16\n" +
+	"\x06target\x18\x02 \x01(\tR\x06target\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x12!\n" +
+	"\freference_id\x18\x04 \x01(\tR\vreferenceId\x12\x1f\n" +
+	"\vpolicy_hash\x18\x05 \x01(\tR\n" +
+	"policyHash\"\xe2\x01\n" +
+	"\n" +
+	"LogRequest\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x18\n" +
+	"\asources\x18\x02 \x03(\tR\asources\x120\n" +
+	"\x05since\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x05since\x120\n" +
+	"\x05until\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x05until\x12\x1f\n" +
+	"\vmax_entries\x18\x05 \x01(\x05R\n" +
+	"maxEntries\x12\x16\n" +
+	"\x06follow\x18\x06 \x01(\bR\x06follow\"*\n" +
+	"\tLogCancel\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\"v\n" +
+	"\bLogEntry\x12\x16\n" +
+	"\x06source\x18\x01 \x01(\tR\x06source\x128\n" +
+	"\ttimestamp\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\"\xa2\x01\n" +
+	"\bLogBatch\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12/\n" +
+	"\aentries\x18\x02 \x03(\v2\x15.safeedge.v1.LogEntryR\aentries\x12\x12\n" +
+	"\x04done\x18\x03 \x01(\bR\x04done\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12\x1c\n" +
+	"\ttruncated\x18\x05 \x01(\bR\ttruncated\"\xc3\x02\n" +
+	"\vFileRequest\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x1f\n" +
+	"\vtransfer_id\x18\x02 \x01(\tR\n" +
+	"transferId\x128\n" +
+	"\toperation\x18\x03 \x01(\x0e2\x1a.safeedge.v1.FileOperationR\toperation\x12\x12\n" +
+	"\x04path\x18\x04 \x01(\tR\x04path\x12\x16\n" +
+	"\x06offset\x18\x05 \x01(\x03R\x06offset\x12\x16\n" +
+	"\x06length\x18\x06 \x01(\x05R\x06length\x12\x12\n" +
+	"\x04data\x18\a \x01(\fR\x04data\x12\x1d\n" +
+	"\n" +
+	"chunk_hash\x18\b \x01(\tR\tchunkHash\x12\x12\n" +
+	"\x04size\x18\t \x01(\x03R\x04size\x12\x1b\n" +
+	"\tfile_hash\x18\n" +
+	" \x01(\tR\bfileHash\x12\x12\n" +
+	"\x04mode\x18\v \x01(\rR\x04mode\"\xd7\x01\n" +
+	"\fFileResponse\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x01 \x01(\tR\trequestId\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x03R\x04size\x12\x1b\n" +
+	"\tfile_hash\x18\x04 \x01(\tR\bfileHash\x12\x12\n" +
+	"\x04mode\x18\x05 \x01(\rR\x04mode\x12\x12\n" +
+	"\x04data\x18\x06 \x01(\fR\x04data\x12\x1d\n" +
+	"\n" +
+	"chunk_hash\x18\a \x01(\tR\tchunkHash\x12\x1a\n" +
+	"\breceived\x18\b \x01(\x03R\breceived\">\n" +
+	"\fConfigUpdate\x12\x12\n" +
+	"\x04hash\x18\x01 \x01(\tR\x04hash\x12\x1a\n" +
+	"\bdocument\x18\x02 \x01(\fR\bdocument\"A\n" +
+	"\vConfigError\x12\x18\n" +
+	"\asection\x18\x01 \x01(\tR\asection\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\x99\x01\n" +
+	"\fConfigReport\x12!\n" +
+	"\fdesired_hash\x18\x01 \x01(\tR\vdesiredHash\x12\x1a\n" +
+	"\breported\x18\x02 \x01(\fR\breported\x120\n" +
+	"\x06errors\x18\x03 \x03(\v2\x18.safeedge.v1.ConfigErrorR\x06errors\x12\x18\n" +
+	"\adrifted\x18\x04 \x01(\bR\adrifted*\xba\x01\n" +
+	"\fUpdateStatus\x12\x1d\n" +
+	"\x19UPDATE_STATUS_UNSPECIFIED\x10\x00\x12\x1d\n" +
+	"\x19UPDATE_STATUS_DOWNLOADING\x10\x01\x12\x1b\n" +
+	"\x17UPDATE_STATUS_VERIFYING\x10\x02\x12\x1a\n" +
+	"\x16UPDATE_STATUS_APPLYING\x10\x03\x12\x19\n" +
+	"\x15UPDATE_STATUS_SUCCESS\x10\x04\x12\x18\n" +
+	"\x14UPDATE_STATUS_FAILED\x10\x05*e\n" +
+	"\rCommandStream\x12\x1e\n" +
+	"\x1aCOMMAND_STREAM_UNSPECIFIED\x10\x00\x12\x19\n" +
+	"\x15COMMAND_STREAM_STDOUT\x10\x01\x12\x19\n" +
+	"\x15COMMAND_STREAM_STDERR\x10\x02*\x82\x01\n" +
+	"\n" +
+	"PolicyRule\x12\x1b\n" +
+	"\x17POLICY_RULE_UNSPECIFIED\x10\x00\x12\x17\n" +
+	"\x13POLICY_RULE_COMMAND\x10\x01\x12\x19\n" +
+	"\x15POLICY_RULE_FILE_PATH\x10\x02\x12#\n" +
+	"\x1fPOLICY_RULE_FORWARD_DESTINATION\x10\x03*\xb0\x01\n" +
+	"\rFileOperation\x12\x1e\n" +
+	"\x1aFILE_OPERATION_UNSPECIFIED\x10\x00\x12\x17\n" +
+	"\x13FILE_OPERATION_STAT\x10\x01\x12\x17\n" +
+	"\x13FILE_OPERATION_READ\x10\x02\x12\x18\n" +
+	"\x14FILE_OPERATION_WRITE\x10\x03\x12\x19\n" +
+	"\x15FILE_OPERATION_COMMIT\x10\x04\x12\x18\n" +
+	"\x14FILE_OPERATION_ABORT\x10\x052\x9e\x01\n" +
 	"\rDeviceService\x12K\n" +
-	"\fDeviceStream\x12\x1a.safeedge.v1.DeviceMessage\x1a\x1b.safeedge.v1.ControlMessage(\x010\x01B3Z1github.com/netf/safeedge/api/proto/gen;safeedgev1b\x06proto3"
+	"\fDeviceStream\x12\x1a.safeedge.v1.DeviceMessage\x1a\x1b.safeedge.v1.ControlMessage(\x010\x01\x12@\n" +
+	"\x06Tunnel\x12\x18.safeedge.v1.TunnelFrame\x1a\x18.safeedge.v1.TunnelFrame(\x010\x01B3Z1github.com/netf/safeedge/api/proto/gen;safeedgev1b\x06proto3"
 
 var (
 	file_device_proto_rawDescOnce sync.Once
@@ -887,41 +3074,96 @@ func file_device_proto_rawDescGZIP() []byte {
 	return file_device_proto_rawDescData
 }
 
-var file_device_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_device_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_device_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_device_proto_msgTypes = make([]protoimpl.MessageInfo, 31)
 var file_device_proto_goTypes = []any{
-	(UpdateStatus)(0),             // 0: safeedge.v1.UpdateStatus
-	(*DeviceMessage)(nil),         // 1: safeedge.v1.DeviceMessage
-	(*ControlMessage)(nil),        // 2: safeedge.v1.ControlMessage
-	(*HeartbeatRequest)(nil),      // 3: safeedge.v1.HeartbeatRequest
-	(*HeartbeatAck)(nil),          // 4: safeedge.v1.HeartbeatAck
-	(*DeviceMetrics)(nil),         // 5: safeedge.v1.DeviceMetrics
-	(*HealthReport)(nil),          // 6: safeedge.v1.HealthReport
-	(*UpdateNotification)(nil),    // 7: safeedge.v1.UpdateNotification
-	(*UpdateAck)(nil),             // 8: safeedge.v1.UpdateAck
-	(*RollbackRequest)(nil),       // 9: safeedge.v1.RollbackRequest
-	(*timestamppb.Timestamp)(nil), // 10: google.protobuf.Timestamp
+	(UpdateStatus)(0),               // 0: safeedge.v1.UpdateStatus
+	(CommandStream)(0),              // 1: safeedge.v1.CommandStream
+	(PolicyRule)(0),                 // 2: safeedge.v1.PolicyRule
+	(FileOperation)(0),              // 3: safeedge.v1.FileOperation
+	(*DeviceMessage)(nil),           // 4: safeedge.v1.DeviceMessage
+	(*ControlMessage)(nil),          // 5: safeedge.v1.ControlMessage
+	(*HeartbeatRequest)(nil),        // 6: safeedge.v1.HeartbeatRequest
+	(*HeartbeatAck)(nil),            // 7: safeedge.v1.HeartbeatAck
+	(*DeviceMetrics)(nil),           // 8: safeedge.v1.DeviceMetrics
+	(*NetworkInterfaceMetrics)(nil), // 9: safeedge.v1.NetworkInterfaceMetrics
+	(*TemperatureReading)(nil),      // 10: safeedge.v1.TemperatureReading
+	(*HealthReport)(nil),            // 11: safeedge.v1.HealthReport
+	(*UpdateNotification)(nil),      // 12: safeedge.v1.UpdateNotification
+	(*UpdateAck)(nil),               // 13: safeedge.v1.UpdateAck
+	(*RollbackRequest)(nil),         // 14: safeedge.v1.RollbackRequest
+	(*KeyRotationRequest)(nil),      // 15: safeedge.v1.KeyRotationRequest
+	(*KeyRotationResult)(nil),       // 16: safeedge.v1.KeyRotationResult
+	(*AccessGrant)(nil),             // 17: safeedge.v1.AccessGrant
+	(*AccessRevoke)(nil),            // 18: safeedge.v1.AccessRevoke
+	(*TunnelOpen)(nil),              // 19: safeedge.v1.TunnelOpen
+	(*TunnelFrame)(nil),             // 20: safeedge.v1.TunnelFrame
+	(*CommandRequest)(nil),          // 21: safeedge.v1.CommandRequest
+	(*CommandOutput)(nil),           // 22: safeedge.v1.CommandOutput
+	(*CommandResult)(nil),           // 23: safeedge.v1.CommandResult
+	(*PolicyDenial)(nil),            // 24: safeedge.v1.PolicyDenial
+	(*LogRequest)(nil),              // 25: safeedge.v1.LogRequest
+	(*LogCancel)(nil),               // 26: safeedge.v1.LogCancel
+	(*LogEntry)(nil),                // 27: safeedge.v1.LogEntry
+	(*LogBatch)(nil),                // 28: safeedge.v1.LogBatch
+	(*FileRequest)(nil),             // 29: safeedge.v1.FileRequest
+	(*FileResponse)(nil),            // 30: safeedge.v1.FileResponse
+	(*ConfigUpdate)(nil),            // 31: safeedge.v1.ConfigUpdate
+	(*ConfigError)(nil),             // 32: safeedge.v1.ConfigError
+	(*ConfigReport)(nil),            // 33: safeedge.v1.ConfigReport
+	nil,                             // 34: safeedge.v1.HeartbeatRequest.LabelsEntry
+	(*timestamppb.Timestamp)(nil),   // 35: google.protobuf.Timestamp
 }
 var file_device_proto_depIdxs = []int32{
-	3,  // 0: safeedge.v1.DeviceMessage.heartbeat:type_name -> safeedge.v1.HeartbeatRequest
-	6,  // 1: safeedge.v1.DeviceMessage.health:type_name -> safeedge.v1.HealthReport
-	8,  // 2: safeedge.v1.DeviceMessage.update_ack:type_name -> safeedge.v1.UpdateAck
-	4,  // 3: safeedge.v1.ControlMessage.heartbeat_ack:type_name -> safeedge.v1.HeartbeatAck
-	7,  // 4: safeedge.v1.ControlMessage.update:type_name -> safeedge.v1.UpdateNotification
-	9,  // 5: safeedge.v1.ControlMessage.rollback:type_name -> safeedge.v1.RollbackRequest
-	10, // 6: safeedge.v1.HeartbeatRequest.timestamp:type_name -> google.protobuf.Timestamp
-	5,  // 7: safeedge.v1.HeartbeatRequest.metrics:type_name -> safeedge.v1.DeviceMetrics
-	10, // 8: safeedge.v1.HeartbeatAck.timestamp:type_name -> google.protobuf.Timestamp
-	10, // 9: safeedge.v1.HealthReport.timestamp:type_name -> google.protobuf.Timestamp
-	0,  // 10: safeedge.v1.UpdateAck.status:type_name -> safeedge.v1.UpdateStatus
-	10, // 11: safeedge.v1.UpdateAck.timestamp:type_name -> google.protobuf.Timestamp
-	1,  // 12: safeedge.v1.DeviceService.DeviceStream:input_type -> safeedge.v1.DeviceMessage
-	2,  // 13: safeedge.v1.DeviceService.DeviceStream:output_type -> safeedge.v1.ControlMessage
-	13, // [13:14] is the sub-list for method output_type
-	12, // [12:13] is the sub-list for method input_type
-	12, // [12:12] is the sub-list for extension type_name
-	12, // [12:12] is the sub-list for extension extendee
-	0,  // [0:12] is the sub-list for field type_name
+	6,  // 0: safeedge.v1.DeviceMessage.heartbeat:type_name -> safeedge.v1.HeartbeatRequest
+	11, // 1: safeedge.v1.DeviceMessage.health:type_name -> safeedge.v1.HealthReport
+	13, // 2: safeedge.v1.DeviceMessage.update_ack:type_name -> safeedge.v1.UpdateAck
+	15, // 3: safeedge.v1.DeviceMessage.key_rotation:type_name -> safeedge.v1.KeyRotationRequest
+	22, // 4: safeedge.v1.DeviceMessage.command_output:type_name -> safeedge.v1.CommandOutput
+	23, // 5: safeedge.v1.DeviceMessage.command_result:type_name -> safeedge.v1.CommandResult
+	24, // 6: safeedge.v1.DeviceMessage.policy_denial:type_name -> safeedge.v1.PolicyDenial
+	28, // 7: safeedge.v1.DeviceMessage.log_batch:type_name -> safeedge.v1.LogBatch
+	30, // 8: safeedge.v1.DeviceMessage.file_response:type_name -> safeedge.v1.FileResponse
+	33, // 9: safeedge.v1.DeviceMessage.config_report:type_name -> safeedge.v1.ConfigReport
+	7,  // 10: safeedge.v1.ControlMessage.heartbeat_ack:type_name -> safeedge.v1.HeartbeatAck
+	12, // 11: safeedge.v1.ControlMessage.update:type_name -> safeedge.v1.UpdateNotification
+	14, // 12: safeedge.v1.ControlMessage.rollback:type_name -> safeedge.v1.RollbackRequest
+	16, // 13: safeedge.v1.ControlMessage.key_rotation_result:type_name -> safeedge.v1.KeyRotationResult
+	17, // 14: safeedge.v1.ControlMessage.access_grant:type_name -> safeedge.v1.AccessGrant
+	18, // 15: safeedge.v1.ControlMessage.access_revoke:type_name -> safeedge.v1.AccessRevoke
+	19, // 16: safeedge.v1.ControlMessage.tunnel_open:type_name -> safeedge.v1.TunnelOpen
+	21, // 17: safeedge.v1.ControlMessage.command:type_name -> safeedge.v1.CommandRequest
+	25, // 18: safeedge.v1.ControlMessage.log_request:type_name -> safeedge.v1.LogRequest
+	26, // 19: safeedge.v1.ControlMessage.log_cancel:type_name -> safeedge.v1.LogCancel
+	29, // 20: safeedge.v1.ControlMessage.file_request:type_name -> safeedge.v1.FileRequest
+	31, // 21: safeedge.v1.ControlMessage.config_update:type_name -> safeedge.v1.ConfigUpdate
+	35, // 22: safeedge.v1.HeartbeatRequest.timestamp:type_name -> google.protobuf.Timestamp
+	8,  // 23: safeedge.v1.HeartbeatRequest.metrics:type_name -> safeedge.v1.DeviceMetrics
+	34, // 24: safeedge.v1.HeartbeatRequest.labels:type_name -> safeedge.v1.HeartbeatRequest.LabelsEntry
+	35, // 25: safeedge.v1.HeartbeatAck.timestamp:type_name -> google.protobuf.Timestamp
+	9,  // 26: safeedge.v1.DeviceMetrics.network_interfaces:type_name -> safeedge.v1.NetworkInterfaceMetrics
+	10, // 27: safeedge.v1.DeviceMetrics.temperatures:type_name -> safeedge.v1.TemperatureReading
+	35, // 28: safeedge.v1.HealthReport.timestamp:type_name -> google.protobuf.Timestamp
+	0,  // 29: safeedge.v1.UpdateAck.status:type_name -> safeedge.v1.UpdateStatus
+	35, // 30: safeedge.v1.UpdateAck.timestamp:type_name -> google.protobuf.Timestamp
+	35, // 31: safeedge.v1.AccessGrant.expires_at:type_name -> google.protobuf.Timestamp
+	1,  // 32: safeedge.v1.CommandOutput.stream:type_name -> safeedge.v1.CommandStream
+	2,  // 33: safeedge.v1.PolicyDenial.rule:type_name -> safeedge.v1.PolicyRule
+	35, // 34: safeedge.v1.LogRequest.since:type_name -> google.protobuf.Timestamp
+	35, // 35: safeedge.v1.LogRequest.until:type_name -> google.protobuf.Timestamp
+	35, // 36: safeedge.v1.LogEntry.timestamp:type_name -> google.protobuf.Timestamp
+	27, // 37: safeedge.v1.LogBatch.entries:type_name -> safeedge.v1.LogEntry
+	3,  // 38: safeedge.v1.FileRequest.operation:type_name -> safeedge.v1.FileOperation
+	32, // 39: safeedge.v1.ConfigReport.errors:type_name -> safeedge.v1.ConfigError
+	4,  // 40: safeedge.v1.DeviceService.DeviceStream:input_type -> safeedge.v1.DeviceMessage
+	20, // 41: safeedge.v1.DeviceService.Tunnel:input_type -> safeedge.v1.TunnelFrame
+	5,  // 42: safeedge.v1.DeviceService.DeviceStream:output_type -> safeedge.v1.ControlMessage
+	20, // 43: safeedge.v1.DeviceService.Tunnel:output_type -> safeedge.v1.TunnelFrame
+	42, // [42:44] is the sub-list for method output_type
+	40, // [40:42] is the sub-list for method input_type
+	40, // [40:40] is the sub-list for extension type_name
+	40, // [40:40] is the sub-list for extension extendee
+	0,  // [0:40] is the sub-list for field type_name
 }
 
 func init() { file_device_proto_init() }
@@ -933,19 +3175,35 @@ func file_device_proto_init() {
 		(*DeviceMessage_Heartbeat)(nil),
 		(*DeviceMessage_Health)(nil),
 		(*DeviceMessage_UpdateAck)(nil),
+		(*DeviceMessage_KeyRotation)(nil),
+		(*DeviceMessage_CommandOutput)(nil),
+		(*DeviceMessage_CommandResult)(nil),
+		(*DeviceMessage_PolicyDenial)(nil),
+		(*DeviceMessage_LogBatch)(nil),
+		(*DeviceMessage_FileResponse)(nil),
+		(*DeviceMessage_ConfigReport)(nil),
 	}
 	file_device_proto_msgTypes[1].OneofWrappers = []any{
 		(*ControlMessage_HeartbeatAck)(nil),
 		(*ControlMessage_Update)(nil),
 		(*ControlMessage_Rollback)(nil),
+		(*ControlMessage_KeyRotationResult)(nil),
+		(*ControlMessage_AccessGrant)(nil),
+		(*ControlMessage_AccessRevoke)(nil),
+		(*ControlMessage_TunnelOpen)(nil),
+		(*ControlMessage_Command)(nil),
+		(*ControlMessage_LogRequest)(nil),
+		(*ControlMessage_LogCancel)(nil),
+		(*ControlMessage_FileRequest)(nil),
+		(*ControlMessage_ConfigUpdate)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_device_proto_rawDesc), len(file_device_proto_rawDesc)),
-			NumEnums:      1,
-			NumMessages:   9,
+			NumEnums:      4,
+			NumMessages:   31,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
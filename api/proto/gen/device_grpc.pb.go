@@ -20,6 +20,7 @@ const _ = grpc.SupportPackageIsVersion9
 
 const (
 	DeviceService_DeviceStream_FullMethodName = "/safeedge.v1.DeviceService/DeviceStream"
+	DeviceService_Tunnel_FullMethodName       = "/safeedge.v1.DeviceService/Tunnel"
 )
 
 // DeviceServiceClient is the client API for DeviceService service.
@@ -28,8 +29,15 @@ const (
 //
 // DeviceService handles bidirectional streaming between devices and control plane
 type DeviceServiceClient interface {
-	// DeviceStream establishes a persistent bidirectional stream for device communication
+	// DeviceStream establishes a persistent bidirectional stream for device communication.
+	// The device authenticates by sending x-safeedge-device-id, x-safeedge-timestamp
+	// and x-safeedge-signature metadata, the signature being over
+	// "safeedge-stream:<device_id>:<timestamp>" with its Ed25519 key.
 	DeviceStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[DeviceMessage, ControlMessage], error)
+	// Tunnel carries one TCP connection the control plane relays for an access
+	// session client that cannot reach the device over WireGuard. The agent
+	// opens it in answer to a TunnelOpen, authenticated like DeviceStream.
+	Tunnel(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TunnelFrame, TunnelFrame], error)
 }
 
 type deviceServiceClient struct {
@@ -53,14 +61,34 @@ func (c *deviceServiceClient) DeviceStream(ctx context.Context, opts ...grpc.Cal
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type DeviceService_DeviceStreamClient = grpc.BidiStreamingClient[DeviceMessage, ControlMessage]
 
+func (c *deviceServiceClient) Tunnel(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[TunnelFrame, TunnelFrame], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &DeviceService_ServiceDesc.Streams[1], DeviceService_Tunnel_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TunnelFrame, TunnelFrame]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DeviceService_TunnelClient = grpc.BidiStreamingClient[TunnelFrame, TunnelFrame]
+
 // DeviceServiceServer is the server API for DeviceService service.
 // All implementations must embed UnimplementedDeviceServiceServer
 // for forward compatibility.
 //
 // DeviceService handles bidirectional streaming between devices and control plane
 type DeviceServiceServer interface {
-	// DeviceStream establishes a persistent bidirectional stream for device communication
+	// DeviceStream establishes a persistent bidirectional stream for device communication.
+	// The device authenticates by sending x-safeedge-device-id, x-safeedge-timestamp
+	// and x-safeedge-signature metadata, the signature being over
+	// "safeedge-stream:<device_id>:<timestamp>" with its Ed25519 key.
 	DeviceStream(grpc.BidiStreamingServer[DeviceMessage, ControlMessage]) error
+	// Tunnel carries one TCP connection the control plane relays for an access
+	// session client that cannot reach the device over WireGuard. The agent
+	// opens it in answer to a TunnelOpen, authenticated like DeviceStream.
+	Tunnel(grpc.BidiStreamingServer[TunnelFrame, TunnelFrame]) error
 	mustEmbedUnimplementedDeviceServiceServer()
 }
 
@@ -74,6 +102,9 @@ type UnimplementedDeviceServiceServer struct{}
 func (UnimplementedDeviceServiceServer) DeviceStream(grpc.BidiStreamingServer[DeviceMessage, ControlMessage]) error {
 	return status.Errorf(codes.Unimplemented, "method DeviceStream not implemented")
 }
+func (UnimplementedDeviceServiceServer) Tunnel(grpc.BidiStreamingServer[TunnelFrame, TunnelFrame]) error {
+	return status.Errorf(codes.Unimplemented, "method Tunnel not implemented")
+}
 func (UnimplementedDeviceServiceServer) mustEmbedUnimplementedDeviceServiceServer() {}
 func (UnimplementedDeviceServiceServer) testEmbeddedByValue()                       {}
 
@@ -102,6 +133,13 @@ func _DeviceService_DeviceStream_Handler(srv interface{}, stream grpc.ServerStre
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type DeviceService_DeviceStreamServer = grpc.BidiStreamingServer[DeviceMessage, ControlMessage]
 
+func _DeviceService_Tunnel_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DeviceServiceServer).Tunnel(&grpc.GenericServerStream[TunnelFrame, TunnelFrame]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type DeviceService_TunnelServer = grpc.BidiStreamingServer[TunnelFrame, TunnelFrame]
+
 // DeviceService_ServiceDesc is the grpc.ServiceDesc for DeviceService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -116,6 +154,12 @@ var DeviceService_ServiceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Tunnel",
+			Handler:       _DeviceService_Tunnel_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "device.proto",
 }
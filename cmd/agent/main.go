@@ -2,9 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/netip"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -12,9 +20,35 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/agent/access"
+	"github.com/netf/safeedge/internal/agent/command"
+	"github.com/netf/safeedge/internal/agent/config"
 	"github.com/netf/safeedge/internal/agent/enrollment"
+	"github.com/netf/safeedge/internal/agent/logs"
+	"github.com/netf/safeedge/internal/agent/metrics"
+	"github.com/netf/safeedge/internal/agent/policy"
+	"github.com/netf/safeedge/internal/agent/status"
+	"github.com/netf/safeedge/internal/agent/transfer"
+	"github.com/netf/safeedge/internal/agent/update"
+	"github.com/netf/safeedge/pkg/forward"
+	"github.com/netf/safeedge/pkg/installer"
+	"github.com/netf/safeedge/pkg/labels"
+	pkgtransfer "github.com/netf/safeedge/pkg/transfer"
+)
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+const (
+	// minReconnectDelay is how long the agent waits to reconnect after
+	// losing a stream the control plane answered on
+	minReconnectDelay = time.Second
+	// maxReconnectDelay bounds the wait while the control plane stays
+	// unreachable
+	maxReconnectDelay = time.Minute
 )
 
 var (
@@ -48,15 +82,65 @@ func main() {
 	runCmd.Flags().StringVar(&deviceID, "device-id", getEnv("DEVICE_ID", ""), "Device ID (from identity file)")
 	runCmd.Flags().StringVar(&identityPath, "identity", getEnv("IDENTITY_PATH", "/var/lib/safeedge/identity.json"), "Path to identity file")
 	runCmd.Flags().StringVar(&logLevel, "log-level", getEnv("LOG_LEVEL", "info"), "Log level (debug, info, warn, error)")
+	runCmd.Flags().String("labels", getEnv("LABELS", ""), "Labels reported to the control plane (e.g. region=eu,tier=gw)")
+	runCmd.Flags().Duration("key-rotation-interval", getDurationEnv("KEY_ROTATION_INTERVAL", 90*24*time.Hour), "Rotate device keys once they are this old (0 disables)")
+	runCmd.Flags().String("forward-listen", getEnv("FORWARD_LISTEN", ""), "Address to accept access session port forwards on (default: the WireGuard IP, port 7100)")
+	runCmd.Flags().StringSlice("allow-command", splitEnv("COMMAND_ALLOWLIST"), "Commands the control plane may run, by name or absolute path (repeatable or comma-separated)")
+	runCmd.Flags().String("script-dir", getEnv("SCRIPT_DIR", "/var/lib/safeedge/scripts"), "Directory of scripts the control plane may run")
+	runCmd.Flags().String("policy", getEnv("POLICY_PATH", policy.DefaultPath), "Device policy file, signed in <file>.sig (reloaded on SIGHUP)")
+	runCmd.Flags().String("policy-public-key", getEnv("POLICY_PUBLIC_KEY", ""), "Organization Ed25519 public key (base64) the device policy must be signed with")
+	runCmd.Flags().StringSlice("log-source", splitEnv("LOG_SOURCES"), "Log files the control plane may read, as [name=][journal:]path, journal: marking journal export format (repeatable or comma-separated)")
+	runCmd.Flags().StringSlice("transfer-dir", splitEnvDefault("TRANSFER_DIRS", transfer.DefaultDir), "Directories operators may copy files to and from (repeatable or comma-separated)")
+	runCmd.Flags().Int64("transfer-max-size", getInt64Env("TRANSFER_MAX_SIZE", pkgtransfer.DefaultMaxSize), "Largest file operators may copy to or from the device, in bytes")
+	runCmd.Flags().StringSlice("config-env-dir", splitEnvDefault("CONFIG_ENV_DIRS", config.DefaultEnvDir), "Directories desired configuration may write environment files in (repeatable or comma-separated)")
+	runCmd.Flags().StringSlice("config-service", splitEnv("CONFIG_SERVICES"), "Systemd units desired configuration may enable, disable, start and stop (repeatable or comma-separated)")
+	runCmd.Flags().Duration("config-interval", getDurationEnv("CONFIG_INTERVAL", config.DefaultInterval), "How often to report the effective configuration")
+	runCmd.Flags().String("update-dir", getEnv("UPDATE_DIR", update.DefaultDir), "Directory for agent update state and the previous agent binary")
+	runCmd.Flags().Duration("update-deadline", getDurationEnv("UPDATE_DEADLINE", update.DefaultDeadline), "How long an updated agent has to connect before the previous one is restored")
+	runCmd.Flags().String("artifact-public-key", getEnv("ARTIFACT_PUBLIC_KEY", ""), "Organization Ed25519 public key (base64) agent updates must be signed with")
+	runCmd.Flags().String("artifact-dir", getEnv("ARTIFACT_DIR", update.DefaultArtifactDir), "Directory for installed artifacts, kept to roll back to")
+	runCmd.Flags().StringSlice("installer", splitEnv("INSTALLERS"), "Installer plugins, as TYPE=executable (repeatable or comma-separated)")
+	runCmd.Flags().String("status-socket", getEnv("STATUS_SOCKET", status.DefaultSocket), "Unix socket to serve the agent's status on, for the status command")
+	runCmd.Flags().Bool("log-ship", getEnv("LOG_SHIP", "") == "true", "Continuously ship new log entries to the control plane")
 
 	enrollCmd.Flags().StringVar(&controlPlaneURL, "control-plane", getEnv("CONTROL_PLANE_URL", "http://localhost:8080"), "Control plane HTTP address")
 	enrollCmd.Flags().StringVar(&enrollmentToken, "token", getEnv("ENROLLMENT_TOKEN", ""), "Enrollment token (required)")
 	enrollCmd.Flags().StringVar(&siteTag, "site-tag", getEnv("SITE_TAG", ""), "Site tag for device grouping")
 	enrollCmd.Flags().StringVar(&identityPath, "identity", getEnv("IDENTITY_PATH", "/var/lib/safeedge/identity.json"), "Path to save identity file")
+	enrollCmd.Flags().String("device-id", "", "Re-enroll this existing device with new keys (requires operator approval)")
 
 	enrollCmd.MarkFlagRequired("token")
 
-	rootCmd.AddCommand(runCmd, enrollCmd)
+	versionCmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print the agent version",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println(version)
+		},
+	}
+
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show what the running agent is doing",
+		Args:  cobra.NoArgs,
+		RunE:  showStatus,
+	}
+	statusCmd.Flags().String("socket", getEnv("STATUS_SOCKET", status.DefaultSocket), "Unix socket the agent serves its status on")
+	statusCmd.Flags().Bool("json", false, "Print the status as JSON")
+
+	// Started from the previous agent's binary by an agent update
+	watchdogCmd := &cobra.Command{
+		Use:    "update-watchdog",
+		Short:  "Restore the previous agent if an updated one does not connect",
+		Args:   cobra.NoArgs,
+		Hidden: true,
+		RunE:   runUpdateWatchdog,
+	}
+	watchdogCmd.Flags().String("update-dir", update.DefaultDir, "Directory of the agent update state")
+	watchdogCmd.Flags().Bool("supervised", false, "Leave starting the restored agent to the service manager")
+
+	rootCmd.AddCommand(runCmd, enrollCmd, versionCmd, statusCmd, watchdogCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
@@ -72,6 +156,47 @@ func runAgent(cmd *cobra.Command, args []string) error {
 	defer logger.Sync()
 
 	identityPath, _ := cmd.Flags().GetString("identity")
+	labelsFlag, _ := cmd.Flags().GetString("labels")
+	rotationInterval, _ := cmd.Flags().GetDuration("key-rotation-interval")
+	forwardListen, _ := cmd.Flags().GetString("forward-listen")
+	allowCommands, _ := cmd.Flags().GetStringSlice("allow-command")
+	scriptDir, _ := cmd.Flags().GetString("script-dir")
+	policyPath, _ := cmd.Flags().GetString("policy")
+	policyPublicKey, _ := cmd.Flags().GetString("policy-public-key")
+	logSourceSpecs, _ := cmd.Flags().GetStringSlice("log-source")
+	logShip, _ := cmd.Flags().GetBool("log-ship")
+	transferDirs, _ := cmd.Flags().GetStringSlice("transfer-dir")
+	transferMaxSize, _ := cmd.Flags().GetInt64("transfer-max-size")
+	configEnvDirs, _ := cmd.Flags().GetStringSlice("config-env-dir")
+	configServices, _ := cmd.Flags().GetStringSlice("config-service")
+	configInterval, _ := cmd.Flags().GetDuration("config-interval")
+	updateDir, _ := cmd.Flags().GetString("update-dir")
+	updateDeadline, _ := cmd.Flags().GetDuration("update-deadline")
+	artifactPublicKey, _ := cmd.Flags().GetString("artifact-public-key")
+	artifactDir, _ := cmd.Flags().GetString("artifact-dir")
+	installerSpecs, _ := cmd.Flags().GetStringSlice("installer")
+	statusSocket, _ := cmd.Flags().GetString("status-socket")
+
+	deviceLabels, err := labels.ParseSet(labelsFlag)
+	if err != nil {
+		return fmt.Errorf("invalid --labels: %w", err)
+	}
+
+	var logSources []logs.Source
+	for _, spec := range logSourceSpecs {
+		source, err := logs.ParseSource(spec)
+		if err != nil {
+			return fmt.Errorf("invalid --log-source: %w", err)
+		}
+		logSources = append(logSources, source)
+	}
+
+	// An updated agent is on probation until it connects; one that does not
+	// in time hands back to the previous agent
+	resumedUpdate, err := update.Resume(updateDir, logger)
+	if err != nil {
+		logger.Error("failed to resume agent update", zap.Error(err))
+	}
 
 	// Load device identity
 	identity, err := enrollment.LoadIdentity(identityPath)
@@ -90,10 +215,26 @@ func runAgent(cmd *cobra.Command, args []string) error {
 
 	logger.Info("starting SafeEdge agent",
 		zap.String("device_id", deviceID),
+		zap.String("version", version),
 		zap.String("control_plane", grpcURL),
 		zap.String("wireguard_ip", identity.WireguardIP),
 	)
 
+	// Serve the agent's status locally, for someone at the device, for as
+	// long as the agent runs
+	tracker := status.NewTracker(deviceID, version, identity.WireguardIP, grpcURL)
+	if listener, err := status.Listen(statusSocket); err != nil {
+		logger.Error("status socket disabled", zap.String("socket", statusSocket), zap.Error(err))
+	} else {
+		statusCtx, stopStatus := context.WithCancel(context.Background())
+		defer stopStatus()
+		go func() {
+			if err := tracker.Serve(statusCtx, listener, logger); err != nil {
+				logger.Error("status socket stopped", zap.Error(err))
+			}
+		}()
+	}
+
 	// Connect to control plane gRPC
 	conn, err := grpc.NewClient(grpcURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
@@ -103,57 +244,197 @@ func runAgent(cmd *cobra.Command, args []string) error {
 
 	client := pb.NewDeviceServiceClient(conn)
 
-	// Establish bidirectional stream
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	stream, err := client.DeviceStream(ctx)
+	// Messages fail to send until the stream below is connected
+	stream := &streamSender{}
+
+	collector := metrics.NewCollector(metrics.DefaultProcRoot, metrics.DefaultSysRoot, metrics.DefaultDiskPath)
+	rotator := &keyRotator{
+		identity:     identity,
+		identityPath: identityPath,
+		interval:     rotationInterval,
+		logger:       logger,
+	}
+
+	// The device owner's policy constrains whatever the control plane asks
+	enforcer := policy.NewEnforcer(policyPath, policyPublicKey, stream, logger)
+
+	// Forward access session connections arriving over the tunnel
+	forwarder := access.NewForwarder(enforcer, logger)
+	if forwardListen == "" {
+		forwardListen = net.JoinHostPort(identity.WireguardIP, strconv.Itoa(forward.DefaultPort))
+	}
+	if listener, err := net.Listen("tcp", forwardListen); err != nil {
+		logger.Error("port forwarding disabled", zap.String("address", forwardListen), zap.Error(err))
+	} else {
+		logger.Info("accepting port forwards", zap.String("address", listener.Addr().String()))
+		go func() {
+			if err := forwarder.Serve(ctx, listener); err != nil {
+				logger.Error("port forwarding stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	// Run diagnostic commands the control plane requests
+	executor := command.NewExecutor(stream, enforcer, allowCommands, scriptDir, logger)
+
+	// Read log sources for the control plane, shipping new entries as they
+	// are written if configured to
+	logCollector := logs.NewCollector(logSources, stream, enforcer, logger)
+	if logShip {
+		go logCollector.Ship(ctx)
+	}
+
+	// Serve file transfers operators make through the control plane
+	transfers := transfer.NewHandler(stream, enforcer, transferDirs, transferMaxSize, logger)
+
+	// Apply the desired configuration the control plane sends, reporting
+	// the effective configuration back
+	reconciler := config.NewReconciler(stream, map[string]config.Plugin{
+		"env":      config.NewEnvFiles(enforcer, configEnvDirs),
+		"services": config.NewServices(configServices),
+	}, logger)
+	go reconciler.Run(ctx, configInterval)
+
+	// Replace the agent with new versions of itself, and install other
+	// artifacts with the installer for their type, one update at a time
+	updates := &update.Lock{}
+	updater := update.NewUpdater(stream, updates, deviceID, version, updateDir, artifactPublicKey, updateDeadline, resumedUpdate, logger)
+	installers, err := update.NewManager(stream, updates, deviceID, artifactDir, artifactPublicKey, logger)
 	if err != nil {
-		return fmt.Errorf("failed to establish stream: %w", err)
+		return err
+	}
+	installers.Register(installer.TypeDeb, update.NewDeb())
+	for _, spec := range installerSpecs {
+		artifactType, path, ok := strings.Cut(spec, "=")
+		if !ok || installer.ValidateType(artifactType) != nil || artifactType == installer.TypeAgent || !filepath.IsAbs(path) {
+			return fmt.Errorf("invalid --installer %q: must be TYPE=/absolute/path, TYPE not AGENT", spec)
+		}
+		plugin, err := update.NewPlugin(ctx, artifactType, path, logger)
+		if err != nil {
+			logger.Error("installer plugin disabled", zap.String("artifact_type", artifactType), zap.Error(err))
+			continue
+		}
+		installers.Register(artifactType, plugin)
 	}
 
-	logger.Info("connected to control plane")
+	tracker.SetSources(status.Sources{
+		Installers: installers,
+		Updater:    updater,
+		Forwarder:  forwarder,
+		Outbox:     stream,
+	})
+
+	// Connections the control plane relays for clients that cannot reach the
+	// device over WireGuard each arrive on a stream of their own
+	dialTunnel := func(ctx context.Context) (pb.DeviceService_TunnelClient, error) {
+		tunnelCtx, err := identity.StreamContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return client.Tunnel(tunnelCtx)
+	}
 
-	// Start heartbeat goroutine
-	go func() {
-		ticker := time.NewTicker(60 * time.Second)
-		defer ticker.Stop()
+	// connect streams with the control plane until the stream fails,
+	// reporting whether the control plane answered. Requests it makes are
+	// served until then.
+	connect := func() (bool, error) {
+		connCtx, disconnect := context.WithCancel(ctx)
+		defer disconnect()
 
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				if err := sendHeartbeat(stream, deviceID, logger); err != nil {
-					logger.Error("failed to send heartbeat", zap.Error(err))
+		streamCtx, err := identity.StreamContext(connCtx)
+		if err != nil {
+			return false, err
+		}
+
+		deviceStream, err := client.DeviceStream(streamCtx)
+		if err != nil {
+			return false, fmt.Errorf("failed to establish stream: %w", err)
+		}
+		stream.connect(deviceStream)
+		defer stream.disconnect()
+
+		logger.Info("connected to control plane")
+		tracker.Connected()
+
+		go func() {
+			ticker := time.NewTicker(60 * time.Second)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-connCtx.Done():
+					return
+				case <-ticker.C:
+					if err := sendHeartbeat(stream, deviceID, collector, deviceLabels, tracker, logger); err != nil {
+						logger.Error("failed to send heartbeat", zap.Error(err))
+					}
+					if err := rotator.maybeRotate(stream); err != nil {
+						logger.Error("failed to start key rotation", zap.Error(err))
+					}
 				}
 			}
+		}()
+
+		// The first heartbeat registers the stream, and the control plane
+		// answers with the device's access grants and configuration
+		if err := sendHeartbeat(stream, deviceID, collector, deviceLabels, tracker, logger); err != nil {
+			logger.Error("failed to send initial heartbeat", zap.Error(err))
 		}
-	}()
 
-	// Send initial heartbeat
-	if err := sendHeartbeat(stream, deviceID, logger); err != nil {
-		logger.Error("failed to send initial heartbeat", zap.Error(err))
+		answered := false
+		for {
+			msg, err := deviceStream.Recv()
+			if err != nil {
+				return answered, err
+			}
+			answered = true
+
+			handleControlMessage(connCtx, msg, rotator, forwarder, dialTunnel, executor, logCollector, transfers, reconciler, updater, installers, tracker, logger)
+		}
 	}
 
-	// Start message receiver goroutine
+	// Stop on SIGINT or SIGTERM, reloading the device policy on SIGHUP
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
-		for {
-			msg, err := stream.Recv()
-			if err != nil {
-				logger.Error("stream receive error", zap.Error(err))
+		for sig := range quit {
+			if sig != syscall.SIGHUP {
 				cancel()
 				return
 			}
-
-			handleControlMessage(msg, logger)
+			enforcer.Load()
 		}
 	}()
 
-	// Wait for interrupt signal
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	// Stay connected, backing off while the control plane cannot be reached
+	delay := minReconnectDelay
+	for {
+		answered, err := connect()
+		if ctx.Err() != nil {
+			break
+		}
+
+		tracker.Disconnected(err)
+		// Revocations can no longer arrive
+		forwarder.RevokeAll()
+
+		if answered {
+			delay = minReconnectDelay
+		}
+		logger.Error("lost connection to control plane", zap.Duration("retry_in", delay), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
 
 	logger.Info("shutting down agent...")
 	return nil
@@ -163,10 +444,13 @@ func enrollDevice(cmd *cobra.Command, args []string) error {
 	enrollmentToken, _ := cmd.Flags().GetString("token")
 	siteTag, _ := cmd.Flags().GetString("site-tag")
 	identityPath, _ := cmd.Flags().GetString("identity")
+	existingDeviceID, _ := cmd.Flags().GetString("device-id")
 
 	fmt.Printf("Enrolling device with control plane at %s...\n", controlPlaneURL)
 
-	identity, err := enrollment.Enroll(controlPlaneURL, enrollmentToken, siteTag, identityPath)
+	identity, err := enrollment.Enroll(controlPlaneURL, enrollmentToken, siteTag, existingDeviceID, identityPath, func(reenrollmentID string) {
+		fmt.Printf("Waiting for an operator to approve re-enrollment %s...\n", reenrollmentID)
+	})
 	if err != nil {
 		return fmt.Errorf("enrollment failed: %w", err)
 	}
@@ -182,16 +466,34 @@ func enrollDevice(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func sendHeartbeat(stream pb.DeviceService_DeviceStreamClient, deviceID string, logger *zap.Logger) error {
+func runUpdateWatchdog(cmd *cobra.Command, args []string) error {
+	dir, _ := cmd.Flags().GetString("update-dir")
+	supervised, _ := cmd.Flags().GetBool("supervised")
+
+	logger, err := initLogger(getEnv("LOG_LEVEL", "info"))
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer logger.Sync()
+
+	return update.Watchdog(dir, supervised, logger)
+}
+
+func sendHeartbeat(stream *streamSender, deviceID string, collector *metrics.Collector, deviceLabels labels.Set, tracker *status.Tracker, logger *zap.Logger) error {
+	// A partial snapshot is still worth sending; log what could not be read
+	m, err := collector.Collect()
+	if err != nil {
+		logger.Warn("failed to collect some metrics", zap.Error(err))
+	}
+
 	msg := &pb.DeviceMessage{
 		Payload: &pb.DeviceMessage_Heartbeat{
 			Heartbeat: &pb.HeartbeatRequest{
 				DeviceId:     deviceID,
-				AgentVersion: "0.1.0",
-				Metrics: &pb.DeviceMetrics{
-					CpuPercent:    10.5,
-					MemoryPercent: 45.2,
-				},
+				Timestamp:    timestamppb.Now(),
+				AgentVersion: version,
+				Metrics:      metricsToProto(m),
+				Labels:       deviceLabels,
 			},
 		},
 	}
@@ -199,29 +501,229 @@ func sendHeartbeat(stream pb.DeviceService_DeviceStreamClient, deviceID string,
 	if err := stream.Send(msg); err != nil {
 		return fmt.Errorf("send error: %w", err)
 	}
+	tracker.HeartbeatSent()
 
 	logger.Debug("heartbeat sent", zap.String("device_id", deviceID))
 	return nil
 }
 
-func handleControlMessage(msg *pb.ControlMessage, logger *zap.Logger) {
+// errNotConnected is returned for messages sent while the stream is down
+var errNotConnected = errors.New("not connected to the control plane")
+
+// streamSender serializes sends on the device stream, which heartbeats, key
+// rotation and commands share across goroutines. The stream is replaced
+// each time the agent reconnects.
+type streamSender struct {
+	mu     sync.Mutex
+	stream pb.DeviceService_DeviceStreamClient
+	// pending counts the messages waiting for, or being sent on, the stream
+	pending atomic.Int64
+}
+
+func (s *streamSender) Send(msg *pb.DeviceMessage) error {
+	s.pending.Add(1)
+	defer s.pending.Add(-1)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stream == nil {
+		return errNotConnected
+	}
+	return s.stream.Send(msg)
+}
+
+// connect sends further messages on stream
+func (s *streamSender) connect(stream pb.DeviceService_DeviceStreamClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stream = stream
+}
+
+// disconnect fails further messages until the next connect
+func (s *streamSender) disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stream = nil
+}
+
+// Pending returns the number of messages waiting to be sent
+func (s *streamSender) Pending() int64 {
+	return s.pending.Load()
+}
+
+// metricsToProto converts a collector snapshot to the wire representation
+func metricsToProto(m *metrics.Metrics) *pb.DeviceMetrics {
+	out := &pb.DeviceMetrics{
+		CpuPercent:           m.CPUPercent,
+		MemoryPercent:        m.MemoryPercent,
+		DiskUsedBytes:        m.DiskUsedBytes,
+		DiskTotalBytes:       m.DiskTotalBytes,
+		UptimeSeconds:        m.UptimeSeconds,
+		MemoryTotalBytes:     m.MemoryTotalBytes,
+		MemoryAvailableBytes: m.MemoryAvailableBytes,
+		Load1:                m.LoadAverage1m,
+		Load5:                m.LoadAverage5m,
+		Load15:               m.LoadAverage15m,
+	}
+
+	for _, iface := range m.NetworkInterfaces {
+		out.NetworkInterfaces = append(out.NetworkInterfaces, &pb.NetworkInterfaceMetrics{
+			Name:      iface.Name,
+			RxBytes:   iface.RxBytes,
+			TxBytes:   iface.TxBytes,
+			RxPackets: iface.RxPackets,
+			TxPackets: iface.TxPackets,
+			RxErrors:  iface.RxErrors,
+			TxErrors:  iface.TxErrors,
+		})
+	}
+
+	for _, t := range m.Temperatures {
+		out.Temperatures = append(out.Temperatures, &pb.TemperatureReading{
+			Zone:    t.Zone,
+			Celsius: t.Celsius,
+		})
+	}
+
+	return out
+}
+
+// keyRotator rotates the device's keys over the stream once they reach the
+// rotation interval. The new keys are saved only after the control plane
+// accepts them.
+type keyRotator struct {
+	identity     *enrollment.DeviceIdentity
+	identityPath string
+	interval     time.Duration
+	logger       *zap.Logger
+
+	mu      sync.Mutex
+	pending *enrollment.PendingRotation
+}
+
+// maybeRotate sends a key rotation request if the keys are due and no
+// rotation is in flight
+func (r *keyRotator) maybeRotate(stream *streamSender) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pending != nil || !r.identity.KeysDue(r.interval) {
+		return nil
+	}
+
+	pending, err := enrollment.BeginRotation(r.identity, r.identityPath)
+	if err != nil {
+		return err
+	}
+
+	msg := &pb.DeviceMessage{
+		Payload: &pb.DeviceMessage_KeyRotation{
+			KeyRotation: &pb.KeyRotationRequest{
+				PublicKey:          pending.PublicKey(),
+				WireguardPublicKey: pending.WireguardPublicKey(),
+				Signature:          pending.Signature(),
+			},
+		},
+	}
+
+	if err := stream.Send(msg); err != nil {
+		return fmt.Errorf("send error: %w", err)
+	}
+
+	r.pending = pending
+	r.logger.Info("key rotation requested")
+	return nil
+}
+
+// handleResult commits or discards the rotation in flight
+func (r *keyRotator) handleResult(result *pb.KeyRotationResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending := r.pending
+	r.pending = nil
+
+	if pending == nil {
+		r.logger.Warn("unexpected key rotation result")
+		return
+	}
+
+	if !result.Accepted {
+		r.logger.Error("key rotation rejected", zap.String("error", result.ErrorMessage))
+		return
+	}
+
+	if err := pending.Commit(); err != nil {
+		r.logger.Error("failed to save rotated keys", zap.Error(err))
+		return
+	}
+
+	r.logger.Info("device keys rotated")
+}
+
+func handleControlMessage(ctx context.Context, msg *pb.ControlMessage, rotator *keyRotator, forwarder *access.Forwarder, dialTunnel access.TunnelDialer, executor *command.Executor, logCollector *logs.Collector, transfers *transfer.Handler, reconciler *config.Reconciler, updater *update.Updater, installers *update.Manager, tracker *status.Tracker, logger *zap.Logger) {
 	switch payload := msg.Payload.(type) {
 	case *pb.ControlMessage_HeartbeatAck:
 		logger.Debug("heartbeat acknowledged")
+		tracker.HeartbeatAcked()
+		updater.Confirm()
 
 	case *pb.ControlMessage_Update:
 		logger.Info("update notification received",
 			zap.String("rollout_id", payload.Update.RolloutId),
 			zap.String("artifact_id", payload.Update.ArtifactId),
+			zap.String("artifact_type", payload.Update.ArtifactType),
 		)
-		// TODO: Download, verify, and apply update
+		if payload.Update.ArtifactType == installer.TypeAgent {
+			go updater.Apply(ctx, payload.Update)
+		} else {
+			go installers.Apply(ctx, payload.Update)
+		}
 
 	case *pb.ControlMessage_Rollback:
 		logger.Info("rollback request received",
 			zap.String("rollout_id", payload.Rollback.RolloutId),
 			zap.String("reason", payload.Rollback.Reason),
 		)
-		// TODO: Rollback to previous version
+		go installers.Rollback(ctx, payload.Rollback)
+
+	case *pb.ControlMessage_KeyRotationResult:
+		rotator.handleResult(payload.KeyRotationResult)
+
+	case *pb.ControlMessage_AccessGrant:
+		grant := payload.AccessGrant
+		clientIP, err := netip.ParseAddr(grant.ClientIp)
+		if err != nil {
+			logger.Warn("invalid access grant client IP", zap.String("session_id", grant.SessionId))
+			return
+		}
+		forwarder.Grant(access.Grant{
+			SessionID:           grant.SessionId,
+			ClientIP:            clientIP,
+			AllowedDestinations: grant.AllowedDestinations,
+			ExpiresAt:           grant.ExpiresAt.AsTime(),
+		})
+
+	case *pb.ControlMessage_AccessRevoke:
+		forwarder.Revoke(payload.AccessRevoke.SessionId)
+
+	case *pb.ControlMessage_TunnelOpen:
+		go forwarder.ServeTunnel(ctx, payload.TunnelOpen, dialTunnel)
+
+	case *pb.ControlMessage_Command:
+		go executor.Run(ctx, payload.Command)
+
+	case *pb.ControlMessage_LogRequest:
+		go logCollector.Handle(ctx, payload.LogRequest)
+
+	case *pb.ControlMessage_LogCancel:
+		logCollector.Cancel(payload.LogCancel.RequestId)
+
+	case *pb.ControlMessage_FileRequest:
+		go transfers.Handle(payload.FileRequest)
+
+	case *pb.ControlMessage_ConfigUpdate:
+		go reconciler.Handle(ctx, payload.ConfigUpdate)
 
 	default:
 		logger.Warn("unknown control message type")
@@ -235,6 +737,43 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// splitEnv returns the comma-separated values of an environment variable
+func splitEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// splitEnvDefault is splitEnv with defaults for an unset variable
+func splitEnvDefault(key string, defaultValues ...string) []string {
+	if values := splitEnv(key); len(values) > 0 {
+		return values
+	}
+	return defaultValues
+}
+
+func getInt64Env(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
 func initLogger(level string) (*zap.Logger, error) {
 	var zapLevel zap.AtomicLevel
 	switch level {
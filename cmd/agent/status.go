@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netf/safeedge/internal/agent/status"
+	"github.com/netf/safeedge/internal/agent/update"
+	"github.com/netf/safeedge/pkg/installer"
+)
+
+func showStatus(cmd *cobra.Command, args []string) error {
+	socket, _ := cmd.Flags().GetString("socket")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	s, err := status.Fetch(cmd.Context(), socket)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(s)
+	}
+	return printStatus(os.Stdout, s, time.Now())
+}
+
+// printStatus writes an agent's status for someone standing at the device
+func printStatus(out io.Writer, s *status.Status, now time.Time) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	conn := s.Connection
+	fmt.Fprintf(w, "Device:\t%s\n", s.DeviceID)
+	fmt.Fprintf(w, "Agent version:\t%s (running for %s)\n", s.Version, since(s.StartedAt, now))
+	fmt.Fprintf(w, "WireGuard IP:\t%s\n", orDash(s.WireguardIP))
+	fmt.Fprintf(w, "Control plane:\t%s\n", s.ControlPlane)
+	fmt.Fprintf(w, "Connection:\t%s for %s\n", conn.State, since(conn.Since, now))
+	if conn.Error != "" {
+		fmt.Fprintf(w, "Last error:\t%s\n", conn.Error)
+	}
+	fmt.Fprintf(w, "Heartbeat:\tsent %s, acknowledged %s\n", ago(conn.LastHeartbeatSent, now), ago(conn.LastHeartbeatAck, now))
+	fmt.Fprintf(w, "Outbox:\t%d messages waiting\n", s.Outbox.Depth)
+	fmt.Fprintf(w, "Tunnels:\t%d access sessions, %d forwarded and %d tunnelled connections, %s in, %s out\n",
+		s.Tunnels.Sessions, s.Tunnels.Forwards, s.Tunnels.Tunnels, formatBytes(s.Tunnels.BytesIn), formatBytes(s.Tunnels.BytesOut))
+	if len(s.Updates) == 0 {
+		fmt.Fprintf(w, "Update:\tnone in progress\n")
+	}
+	for _, p := range s.Updates {
+		fmt.Fprintf(w, "Update:\t%s %s %s, rollout %s, started %s ago\n",
+			p.Stage, p.ArtifactType, artifactLabel(p.ArtifactName, p.ArtifactID), p.RolloutID, since(p.StartedAt, now))
+		if p.Deadline != nil {
+			fmt.Fprintf(w, "\trolled back in %s unless the control plane acknowledges it\n", p.Deadline.Sub(now).Truncate(time.Second))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(s.Slots) == 0 {
+		_, err := fmt.Fprintln(out, "\nNo artifacts installed")
+		return err
+	}
+
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SLOT\tTYPE\tCURRENT\tROLLOUT\tPREVIOUS")
+	names := make([]string, 0, len(s.Slots))
+	for name := range s.Slots {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		slot := s.Slots[name]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, artifactType(slot), artifactID(slot.Current), rolloutID(slot.Current), artifactID(slot.Previous))
+	}
+	return w.Flush()
+}
+
+func artifactLabel(name, id string) string {
+	if name == "" {
+		return id
+	}
+	return name + " (" + id + ")"
+}
+
+func artifactType(slot update.Slot) string {
+	if slot.Current == nil {
+		return "-"
+	}
+	return slot.Current.Type
+}
+
+func artifactID(a *installer.Artifact) string {
+	if a == nil {
+		return "-"
+	}
+	return a.ID
+}
+
+func rolloutID(a *installer.Artifact) string {
+	if a == nil || a.RolloutID == "" {
+		return "-"
+	}
+	return a.RolloutID
+}
+
+// ago describes how long before now t was, or "never"
+func ago(t *time.Time, now time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return since(*t, now) + " ago"
+}
+
+// since is how long before now t was, to the second
+func since(t, now time.Time) string {
+	if t.IsZero() {
+		return "an unknown time"
+	}
+	return now.Sub(t).Truncate(time.Second).String()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatBytes renders a byte count in binary units
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
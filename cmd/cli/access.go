@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netf/safeedge/pkg/crypto"
+	"github.com/netf/safeedge/pkg/forward"
+)
+
+func newAccessCmd() *cobra.Command {
+	accessCmd := &cobra.Command{
+		Use:   "access",
+		Short: "Reach devices over the overlay network",
+	}
+
+	sshCmd := &cobra.Command{
+		Use:   "ssh <device-id> [-- ssh arguments]",
+		Short: "Open an SSH session to a device",
+		Long: "Run ssh to a device through an ephemeral userspace WireGuard interface. The access session " +
+			"is opened, if an access policy allows it, when ssh connects and terminated when it exits.\n\n" +
+			"With --stdio the connection to the device's SSH port is relayed over stdin and stdout, " +
+			"for use as an ssh ProxyCommand:\n\n" +
+			"  ssh -o ProxyCommand='safeedge access ssh --stdio %n' root@<device-id>\n\n" +
+			relayHelp,
+		Args: cobra.MinimumNArgs(1),
+		RunE: accessSSH,
+	}
+	sshCmd.Flags().StringP("login", "l", "root", "User to log in as on the device")
+	sshCmd.Flags().IntP("port", "p", 22, "SSH port on the device")
+	sshCmd.Flags().Bool("stdio", false, "Relay the device's SSH port over stdin and stdout instead of running ssh")
+	addAccessSessionFlags(sshCmd)
+
+	forwardCmd := &cobra.Command{
+		Use:   "forward <device-id> [local-port:]host:port...",
+		Short: "Forward local ports to services on or near a device",
+		Long: "Open an access session to a device, if an access policy allows it, and forward connections " +
+			"to each local port to host:port as seen from the device, e.g. 8080:localhost:80 for a web UI on " +
+			"the device or 5020:10.0.0.7:502 for a PLC on its LAN, until interrupted. The local port defaults " +
+			"to the remote one. The device's agent only forwards to the destinations given here.\n\n" +
+			relayHelp,
+		Args: cobra.MinimumNArgs(2),
+		RunE: accessForward,
+	}
+	forwardCmd.Flags().String("address", "127.0.0.1", "Local address to listen on")
+	forwardCmd.Flags().Int("agent-port", forward.DefaultPort, "Port the device's agent accepts forwards on")
+	addAccessSessionFlags(forwardCmd)
+
+	accessCmd.AddCommand(sshCmd, forwardCmd)
+	return accessCmd
+}
+
+// relayHelp explains the fallback for networks that block WireGuard
+const relayHelp = "If a connection over WireGuard times out, as it does where UDP is blocked, it and later " +
+	"connections are relayed through the control plane and the device agent's connection to it instead. " +
+	"--relay does so from the start."
+
+// wireGuardDialTimeout is how long a connection over WireGuard may take
+// before the session falls back to relaying through the control plane
+const wireGuardDialTimeout = 10 * time.Second
+
+func addAccessSessionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("email", "", "Your email, checked against access policies (default: the profile's)")
+	cmd.Flags().Duration("duration", 0, "Session length (default: the longest the policies allow)")
+	cmd.Flags().Bool("relay", false, "Relay connections through the control plane instead of WireGuard")
+}
+
+// accessSession is an open access session, the device's overlay address and
+// the userspace interface that reaches it
+type accessSession struct {
+	client   *apiClient
+	id       string
+	deviceIP string
+	tunnel   *overlayTunnel
+
+	// relay is set once connections go through the control plane
+	relay       atomic.Bool
+	relayNotice sync.Once
+}
+
+// openAccessSession requests an access session to a device for a fresh
+// WireGuard key and brings up a userspace interface with the configuration
+// the control plane returns
+func openAccessSession(cmd *cobra.Command, deviceID string, destinations []string) (*accessSession, error) {
+	email, _ := cmd.Flags().GetString("email")
+	duration, _ := cmd.Flags().GetDuration("duration")
+	relay, _ := cmd.Flags().GetBool("relay")
+
+	client, p, err := newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if email == "" {
+		email = p.UserEmail
+	}
+	if email == "" {
+		return nil, fmt.Errorf("--email is required when the profile has no email")
+	}
+
+	var device map[string]any
+	if err := client.getJSON("/v1/devices/"+url.PathEscape(deviceID), nil, &device); err != nil {
+		return nil, err
+	}
+	deviceIP, _ := device["wireguard_ip"].(string)
+	if deviceIP == "" {
+		return nil, fmt.Errorf("device %s has no overlay address", deviceID)
+	}
+
+	keys, err := crypto.GenerateWireGuardKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	req := map[string]any{
+		"device_id":            deviceID,
+		"user_email":           email,
+		"wireguard_public_key": keys.PublicKeyString(),
+	}
+	if len(destinations) > 0 {
+		req["allowed_destinations"] = destinations
+	}
+	if duration > 0 {
+		req["duration_seconds"] = int(duration.Seconds())
+	}
+
+	var session map[string]any
+	if err := client.postJSON("/v1/access-sessions", req, &session); err != nil {
+		return nil, err
+	}
+	sessionID, _ := session["id"].(string)
+	s := &accessSession{client: client, id: sessionID, deviceIP: deviceIP}
+	s.relay.Store(relay)
+
+	peerConfig, _ := session["wireguard_peer_config"].(string)
+	cfg, err := parseWireGuardConfig(peerConfig)
+	if err == nil {
+		s.tunnel, err = startTunnel(keys, cfg)
+	}
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Opened access session %s to %s, expires %s\n", sessionID, deviceID, formatCell(session["expires_at"]))
+
+	return s, nil
+}
+
+// dial connects to a port on the device through the tunnel
+func (s *accessSession) dial(ctx context.Context, port int) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, wireGuardDialTimeout)
+	defer cancel()
+
+	conn, err := s.tunnel.dial(ctx, net.JoinHostPort(s.deviceIP, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to port %d on the device: %w", port, err)
+	}
+	return conn, nil
+}
+
+// connect opens a connection to dest, as seen from the device, with
+// dialWireGuard. Once a connection over WireGuard times out, it and later
+// ones are relayed through the control plane instead.
+func (s *accessSession) connect(ctx context.Context, dest string, dialWireGuard func(context.Context) (io.ReadWriteCloser, error)) (io.ReadWriteCloser, error) {
+	if !s.relay.Load() {
+		conn, err := dialWireGuard(ctx)
+		if !isTimeout(err) {
+			return conn, err
+		}
+		s.relay.Store(true)
+	}
+
+	s.relayNotice.Do(func() {
+		fmt.Fprintln(os.Stderr, "Relaying connections through the control plane")
+	})
+
+	conn, err := s.client.tunnel(ctx, "/v1/access-sessions/"+url.PathEscape(s.id)+"/tunnel", url.Values{"destination": {dest}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to relay to %s: %w", dest, err)
+	}
+	return conn, nil
+}
+
+// isTimeout reports whether err is a dial that got no answer
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// close tears down the tunnel and terminates the session
+func (s *accessSession) close() {
+	if s.tunnel != nil {
+		s.tunnel.close()
+	}
+
+	if err := s.client.delete("/v1/access-sessions/"+url.PathEscape(s.id), nil); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to terminate access session %s: %v\n", s.id, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Terminated access session %s\n", s.id)
+}
+
+func accessSSH(cmd *cobra.Command, args []string) error {
+	stdio, _ := cmd.Flags().GetBool("stdio")
+	if stdio {
+		return accessSSHStdio(cmd, args)
+	}
+
+	login, _ := cmd.Flags().GetString("login")
+
+	proxyCommand, err := sshProxyCommand(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	// ssh handles Ctrl-C itself
+	signal.Ignore(os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+
+	// Key the device's host key to its ID rather than its overlay address,
+	// which changes if it is re-enrolled
+	sshArgs := []string{
+		"-o", "ProxyCommand=" + proxyCommand,
+		"-o", "HostKeyAlias=safeedge-" + args[0],
+		"-l", login,
+	}
+	sshArgs = append(sshArgs, args[1:]...)
+	sshArgs = append(sshArgs, args[0])
+
+	ssh := exec.Command("ssh", sshArgs...)
+	ssh.Stdin = os.Stdin
+	ssh.Stdout = os.Stdout
+	ssh.Stderr = os.Stderr
+
+	err = ssh.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run ssh: %w", err)
+	}
+
+	return nil
+}
+
+// accessSSHStdio relays the device's SSH port over stdin and stdout until
+// either side closes, or ssh hangs up on its proxy command
+func accessSSHStdio(cmd *cobra.Command, args []string) error {
+	port, _ := cmd.Flags().GetInt("port")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGHUP, syscall.SIGTERM)
+	defer stop()
+
+	// The agent is allowed to relay to the SSH port in case WireGuard is
+	// blocked
+	dest := net.JoinHostPort("localhost", strconv.Itoa(port))
+	session, err := openAccessSession(cmd, args[0], []string{dest})
+	if err != nil {
+		return err
+	}
+	defer session.close()
+
+	conn, err := session.connect(ctx, dest, func(ctx context.Context) (io.ReadWriteCloser, error) {
+		return session.dial(ctx, port)
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(conn, os.Stdin)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(os.Stdout, conn)
+		done <- struct{}{}
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	return nil
+}
+
+// sshProxyCommand is this CLI in --stdio mode with the flags that select
+// the control plane and session, quoted for the shell ssh runs it with
+func sshProxyCommand(cmd *cobra.Command, deviceID string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the safeedge executable: %w", err)
+	}
+
+	parts := []string{exe}
+	if profileName != "" {
+		parts = append(parts, "--profile", profileName)
+	}
+	if apiURL != "" {
+		parts = append(parts, "--api-url", apiURL)
+	}
+	parts = append(parts, "access", "ssh", "--stdio")
+	for _, name := range []string{"port", "email", "duration", "relay"} {
+		if flag := cmd.Flags().Lookup(name); flag.Changed {
+			parts = append(parts, "--"+name+"="+flag.Value.String())
+		}
+	}
+	parts = append(parts, deviceID)
+
+	for i, part := range parts {
+		parts[i] = shellQuote(part)
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// shellQuote quotes s as a single POSIX shell word
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func accessForward(cmd *cobra.Command, args []string) error {
+	address, _ := cmd.Flags().GetString("address")
+	agentPort, _ := cmd.Flags().GetInt("agent-port")
+
+	type forwarding struct {
+		listener net.Listener
+		dest     string
+	}
+
+	var forwards []forwarding
+	var destinations []string
+	defer func() {
+		for _, f := range forwards {
+			f.listener.Close()
+		}
+	}()
+	for _, spec := range args[1:] {
+		localPort, dest, err := parseForwardSpec(spec)
+		if err != nil {
+			return err
+		}
+
+		listener, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(localPort)))
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		forwards = append(forwards, forwarding{listener, dest})
+		destinations = append(destinations, dest)
+	}
+
+	session, err := openAccessSession(cmd, args[0], destinations)
+	if err != nil {
+		return err
+	}
+	defer session.close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	errs := make(chan error, len(forwards))
+	for _, f := range forwards {
+		fmt.Fprintf(os.Stderr, "Forwarding %s to %s on %s\n", f.listener.Addr(), f.dest, args[0])
+
+		go func() {
+			for {
+				conn, err := f.listener.Accept()
+				if err != nil {
+					errs <- fmt.Errorf("failed to accept connection: %w", err)
+					return
+				}
+				go forwardConn(ctx, conn, session, agentPort, f.dest)
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errs:
+		return err
+	}
+}
+
+// forwardConn relays a local connection to dest through the device's agent
+func forwardConn(ctx context.Context, local net.Conn, session *accessSession, agentPort int, dest string) {
+	defer local.Close()
+
+	remote, err := session.connect(ctx, dest, func(ctx context.Context) (io.ReadWriteCloser, error) {
+		conn, err := session.dial(ctx, agentPort)
+		if err != nil {
+			return nil, err
+		}
+
+		reader := bufio.NewReader(conn)
+		if err := forward.WriteRequest(conn, session.id, dest); err == nil {
+			err = forward.ReadResponse(reader)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		// The agent may have sent data behind its response
+		return struct {
+			io.Reader
+			io.WriteCloser
+		}{reader, conn}, nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to forward to %s: %v\n", dest, err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// parseForwardSpec parses [local-port:]host:port. A bare port is a port on
+// the device itself, and without a local port the remote one is used.
+func parseForwardSpec(spec string) (local int, dest string, err error) {
+	rest := spec
+	if first, after, found := strings.Cut(spec, ":"); found && strings.Contains(after, ":") && !strings.HasPrefix(first, "[") {
+		local, err = strconv.Atoi(first)
+		if err != nil || local < 0 || local > 65535 {
+			return 0, "", fmt.Errorf("invalid local port %q", first)
+		}
+		rest = after
+	}
+
+	host, port, err := net.SplitHostPort(rest)
+	if err != nil {
+		host, port = "localhost", rest
+	}
+	dest = net.JoinHostPort(host, port)
+	if err := forward.ValidateDestination(dest); err != nil {
+		return 0, "", err
+	}
+
+	if local == 0 && rest == spec {
+		local, _ = strconv.Atoi(port)
+	}
+	return local, dest, nil
+}
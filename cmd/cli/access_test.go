@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/netf/safeedge/pkg/crypto"
+	"github.com/netf/safeedge/pkg/forward"
+)
+
+// blockedEndpoint is a UDP address that swallows every packet, as a network
+// that blocks WireGuard does
+func blockedEndpoint(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			if _, _, err := conn.ReadFrom(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// relayServer answers tunnel requests like the control plane, echoing what
+// the client sends over the upgraded connection, and records the
+// destinations asked for
+type relayServer struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	destinations []string
+}
+
+func newRelayServer(t *testing.T, sessionID string) *relayServer {
+	t.Helper()
+
+	rs := &relayServer{}
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/access-sessions/"+sessionID+"/tunnel" || !strings.EqualFold(r.Header.Get("Upgrade"), forward.TunnelProtocol) {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		rs.mu.Lock()
+		rs.destinations = append(rs.destinations, r.URL.Query().Get("destination"))
+		rs.mu.Unlock()
+
+		conn, buffered, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(buffered, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", forward.TunnelProtocol)
+		if err := buffered.Flush(); err != nil {
+			return
+		}
+		io.Copy(conn, buffered)
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+// newBlockedSession opens a userspace WireGuard interface whose peer cannot
+// be reached, relaying through server
+func newBlockedSession(t *testing.T, serverURL string) *accessSession {
+	t.Helper()
+
+	keys, err := crypto.GenerateWireGuardKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := crypto.GenerateWireGuardKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tunnel, err := startTunnel(keys, &wireGuardConfig{
+		Address:       netip.MustParsePrefix("10.99.0.2/32"),
+		PeerPublicKey: peer.PublicKeyString(),
+		Endpoint:      blockedEndpoint(t),
+		AllowedIPs:    []netip.Prefix{netip.MustParsePrefix("10.99.0.0/24")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tunnel.close)
+
+	return &accessSession{
+		client:   newAPIClient(serverURL, "token"),
+		id:       "session-1",
+		deviceIP: "10.99.0.1",
+		tunnel:   tunnel,
+	}
+}
+
+func TestConnectFallsBackToRelayWhenUDPIsBlocked(t *testing.T) {
+	server := newRelayServer(t, "session-1")
+	session := newBlockedSession(t, server.URL)
+
+	var wireGuardDials int
+	dialWireGuard := func(ctx context.Context) (io.ReadWriteCloser, error) {
+		wireGuardDials++
+		// Shorter than wireGuardDialTimeout, to keep the test quick
+		ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		defer cancel()
+		return session.dial(ctx, 22)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for i := range 2 {
+		conn, err := session.connect(ctx, "10.99.0.1:22", dialWireGuard)
+		if err != nil {
+			t.Fatalf("connect %d: %v", i, err)
+		}
+
+		// The connection is the relay's
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatalf("connect %d: write: %v", i, err)
+		}
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+			t.Fatalf("connect %d: read %q, %v", i, buf, err)
+		}
+		conn.Close()
+	}
+
+	if !session.relay.Load() {
+		t.Error("session did not switch to relaying")
+	}
+	// Once relaying, WireGuard is not tried again
+	if wireGuardDials != 1 {
+		t.Errorf("dialled over WireGuard %d times, want 1", wireGuardDials)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.destinations) != 2 || server.destinations[0] != "10.99.0.1:22" {
+		t.Errorf("relayed destinations = %v", server.destinations)
+	}
+}
+
+func TestConnectDoesNotRelayOtherErrors(t *testing.T) {
+	server := newRelayServer(t, "session-1")
+	session := newBlockedSession(t, server.URL)
+
+	refused := errors.New("connection refused")
+	_, err := session.connect(context.Background(), "10.99.0.1:22", func(context.Context) (io.ReadWriteCloser, error) {
+		return nil, refused
+	})
+	if !errors.Is(err, refused) {
+		t.Fatalf("connect returned %v, want the WireGuard error", err)
+	}
+	if session.relay.Load() {
+		t.Error("session switched to relaying on an error that is not a timeout")
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.destinations) != 0 {
+		t.Errorf("relayed despite WireGuard answering: %v", server.destinations)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netf/safeedge/pkg/crypto"
+	"github.com/netf/safeedge/pkg/installer"
+)
+
+var artifactColumns = []column{
+	{"ID", "id"},
+	{"NAME", "name"},
+	{"TYPE", "type"},
+	{"SIZE", "size_bytes"},
+	{"BLAKE3", "blake3_hash"},
+	{"CREATED", "created_at"},
+}
+
+func newArtifactCmd() *cobra.Command {
+	artifactCmd := &cobra.Command{
+		Use:   "artifact",
+		Short: "Manage update artifacts",
+	}
+
+	uploadCmd := &cobra.Command{
+		Use:   "upload <file>",
+		Short: "Sign and upload an artifact",
+		Long: "Hash a file with BLAKE3, sign the hash with your Ed25519 key and upload both with the file. " +
+			"Devices refuse artifacts whose hash or signature does not verify.",
+		Args: cobra.ExactArgs(1),
+		RunE: uploadArtifact,
+	}
+	uploadCmd.Flags().String("name", "", "Artifact name (default: the file name)")
+	uploadCmd.Flags().String("type", "BINARY", "Artifact type: BINARY, CONTAINER, DEB, AGENT (a new agent binary) or one devices have an installer plugin for")
+	uploadCmd.Flags().String("signing-key", getEnv("SAFEEDGE_SIGNING_KEY", ""), "File holding the base64 Ed25519 private key to sign with")
+
+	artifactCmd.AddCommand(
+		uploadCmd,
+		&cobra.Command{
+			Use:   "get <artifact-id>",
+			Short: "Show an artifact",
+			Args:  cobra.ExactArgs(1),
+			RunE:  getArtifact,
+		},
+	)
+	return artifactCmd
+}
+
+func uploadArtifact(cmd *cobra.Command, args []string) error {
+	name, _ := cmd.Flags().GetString("name")
+	artifactType, _ := cmd.Flags().GetString("type")
+	signingKey, _ := cmd.Flags().GetString("signing-key")
+
+	if signingKey == "" {
+		return fmt.Errorf("--signing-key is required")
+	}
+	if err := installer.ValidateType(artifactType); err != nil {
+		return err
+	}
+	if name == "" {
+		name = filepath.Base(args[0])
+	}
+
+	keys, err := crypto.LoadEd25519KeyPair(signingKey)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open artifact: %w", err)
+	}
+	defer file.Close()
+
+	hash, err := crypto.BLAKE3HashReader(file)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind artifact: %w", err)
+	}
+
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	// Stream the multipart body rather than buffering the whole artifact
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		fields := [][2]string{
+			{"name", name},
+			{"type", artifactType},
+			{"blake3_hash", hash},
+			{"signature", base64.StdEncoding.EncodeToString(keys.Sign([]byte(hash)))},
+			{"signing_key_id", keys.PublicKeyString()},
+		}
+		for _, f := range fields {
+			if err := form.WriteField(f[0], f[1]); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+
+		part, err := form.CreateFormFile("file", filepath.Base(args[0]))
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	req, err := client.newRequest(context.Background(), http.MethodPost, "/v1/artifacts", nil, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	// Uploads can take longer than the client's request timeout
+	var artifact map[string]any
+	if err := client.send(&http.Client{}, req, &artifact); err != nil {
+		return err
+	}
+
+	return printOutput(artifact, artifactColumns)
+}
+
+func getArtifact(cmd *cobra.Command, args []string) error {
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var artifact map[string]any
+	if err := client.getJSON("/v1/artifacts/"+url.PathEscape(args[0]), nil, &artifact); err != nil {
+		return err
+	}
+
+	return printOutput(artifact, artifactColumns)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netf/safeedge/pkg/audit"
+)
+
+func newAuditCmd() *cobra.Command {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the audit log",
+	}
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the audit log hash chain",
+		Long: "Verify that audit log entries hash to their stored hashes, link to the entry before them " +
+			"and match the control plane's signed checkpoints. Reports the first break in the chain.",
+		RunE: verifyAudit,
+	}
+	verifyCmd.Flags().Int64("from", 1, "First sequence number to verify")
+	verifyCmd.Flags().Int64("to", 0, "Last sequence number to verify (default: the head of the chain)")
+	verifyCmd.Flags().String("public-key", getEnv("SAFEEDGE_AUDIT_PUBLIC_KEY", ""), "Control plane public key checkpoints must be signed with")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List audit log entries, newest first",
+		Args:  cobra.NoArgs,
+		RunE:  listAudit,
+	}
+	listCmd.Flags().Duration("since", 0, "Only entries from this long ago, such as 24h")
+	listCmd.Flags().String("start-time", "", "Only entries at or after this time (RFC3339)")
+	listCmd.Flags().String("end-time", "", "Only entries at or before this time (RFC3339)")
+	listCmd.Flags().String("event-type", "", "Only entries of this event type, such as device.suspended")
+	listCmd.Flags().String("resource-type", "", "Only entries about this resource type")
+	listCmd.Flags().String("resource-id", "", "Only entries about this resource")
+	listCmd.Flags().String("actor-type", "", "Only entries by this actor type (USER, DEVICE, SYSTEM)")
+	listCmd.Flags().String("actor", "", "Only entries by this actor")
+	listCmd.Flags().Int("page-size", 100, "Entries per page")
+	listCmd.Flags().Bool("all", false, "List every page")
+
+	auditCmd.AddCommand(listCmd, verifyCmd)
+	return auditCmd
+}
+
+type auditLogPage struct {
+	AuditLogs  []any  `json:"audit_logs"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func listAudit(cmd *cobra.Command, args []string) error {
+	since, _ := cmd.Flags().GetDuration("since")
+	pageSize, _ := cmd.Flags().GetInt("page-size")
+	all, _ := cmd.Flags().GetBool("all")
+
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"page_size": {strconv.Itoa(pageSize)}}
+	for flag, param := range map[string]string{
+		"start-time":    "start_time",
+		"end-time":      "end_time",
+		"event-type":    "event_type",
+		"resource-type": "resource_type",
+		"resource-id":   "resource_id",
+		"actor-type":    "actor_type",
+		"actor":         "actor",
+	} {
+		if v, _ := cmd.Flags().GetString(flag); v != "" {
+			query.Set(param, v)
+		}
+	}
+	if since > 0 {
+		if query.Has("start_time") {
+			return fmt.Errorf("--since and --start-time cannot be combined")
+		}
+		query.Set("start_time", time.Now().Add(-since).UTC().Format(time.RFC3339))
+	}
+
+	logs := []any{}
+	for {
+		var page auditLogPage
+		if err := client.getJSON("/v1/audit-logs", query, &page); err != nil {
+			return err
+		}
+		logs = append(logs, page.AuditLogs...)
+
+		if !all || page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+
+	return printOutput(logs, []column{
+		{"TIME", "timestamp"},
+		{"SEQ", "sequence"},
+		{"EVENT", "event_type"},
+		{"ACTOR TYPE", "actor_type"},
+		{"ACTOR", "actor"},
+		{"RESOURCE", "resource_type"},
+		{"RESOURCE ID", "resource_id"},
+		{"RESULT", "result"},
+	})
+}
+
+type auditChainPage struct {
+	AuditLogs    []audit.Entry `json:"audit_logs"`
+	NextSequence int64         `json:"next_sequence"`
+}
+
+func verifyAudit(cmd *cobra.Command, args []string) error {
+	from, _ := cmd.Flags().GetInt64("from")
+	to, _ := cmd.Flags().GetInt64("to")
+	publicKey, _ := cmd.Flags().GetString("public-key")
+
+	if from < 1 {
+		return fmt.Errorf("--from must be at least 1")
+	}
+	if to != 0 && to < from {
+		return fmt.Errorf("--to must not be before --from")
+	}
+
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"from_sequence": {strconv.FormatInt(from, 10)}}
+	if to != 0 {
+		query.Set("to_sequence", strconv.FormatInt(to, 10))
+	}
+
+	var checkpoints []audit.Checkpoint
+	if err := client.getJSON("/v1/audit-logs/checkpoints", query, &checkpoints); err != nil {
+		return fmt.Errorf("failed to get checkpoints: %w", err)
+	}
+
+	verifier, err := audit.NewVerifier(checkpoints, publicKey)
+	if err != nil {
+		return reportBreak(err)
+	}
+
+	query.Set("page_size", "1000")
+	first, last := int64(0), int64(0)
+	for {
+		var page auditChainPage
+		if err := client.getJSON("/v1/audit-logs/chain", query, &page); err != nil {
+			return fmt.Errorf("failed to get audit log: %w", err)
+		}
+
+		for _, entry := range page.AuditLogs {
+			if err := verifier.Add(entry); err != nil {
+				return reportBreak(err)
+			}
+			if first == 0 {
+				first = entry.Sequence
+			}
+			last = entry.Sequence
+		}
+
+		if page.NextSequence == 0 {
+			break
+		}
+		query.Set("from_sequence", strconv.FormatInt(page.NextSequence, 10))
+	}
+
+	if err := verifier.Finish(); err != nil {
+		return reportBreak(err)
+	}
+
+	if verifier.Checked() == 0 {
+		fmt.Println("no audit log entries in range")
+		return nil
+	}
+
+	fmt.Printf("verified %d entries (sequence %d to %d) against %d checkpoints\n",
+		verifier.Checked(), first, last, verifier.Checkpoints())
+	if publicKey == "" && verifier.Checkpoints() > 0 {
+		fmt.Fprintln(os.Stderr, "warning: checkpoint signer was not checked; pass --public-key to pin the control plane's key")
+	}
+
+	return nil
+}
+
+// chainBreakError reports a broken audit chain, which main exits with
+// status 2 for so scripts can tell it from failing to verify at all
+type chainBreakError struct {
+	brk *audit.Break
+}
+
+func (e *chainBreakError) Error() string {
+	return e.brk.Error()
+}
+
+func (e *chainBreakError) Unwrap() error {
+	return e.brk
+}
+
+// reportBreak turns a chain break into a chainBreakError
+func reportBreak(err error) error {
+	var brk *audit.Break
+	if !errors.As(err, &brk) {
+		return err
+	}
+	return &chainBreakError{brk: brk}
+}
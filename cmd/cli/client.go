@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/netf/safeedge/pkg/forward"
+)
+
+// apiClient calls the control plane REST API
+type apiClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newAPIClient(baseURL, token string) *apiClient {
+	return &apiClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// getJSON fetches path with query and decodes the JSON response into out
+func (c *apiClient) getJSON(path string, query url.Values, out any) error {
+	return c.do(http.MethodGet, path, query, nil, out)
+}
+
+// postJSON sends body as JSON and decodes the JSON response into out. A nil
+// body sends no request body; a nil out discards the response.
+func (c *apiClient) postJSON(path string, body, out any) error {
+	return c.do(http.MethodPost, path, nil, body, out)
+}
+
+// delete sends a DELETE request, decoding any JSON response into out
+func (c *apiClient) delete(path string, out any) error {
+	return c.do(http.MethodDelete, path, nil, nil, out)
+}
+
+func (c *apiClient) do(method, path string, query url.Values, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := c.newRequest(context.Background(), method, path, query, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.send(c.http, req, out)
+}
+
+// putBytes sends data as the request body with header, decoding the JSON
+// response into out
+func (c *apiClient) putBytes(path string, data []byte, header http.Header, out any) error {
+	req, err := c.newRequest(context.Background(), http.MethodPut, path, nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	return c.send(c.http, req, out)
+}
+
+// getBytes fetches path's body, refusing one longer than limit bytes, and
+// returns it with the response's headers
+func (c *apiClient) getBytes(path string, limit int64) ([]byte, http.Header, error) {
+	req, err := c.newRequest(context.Background(), http.MethodGet, path, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return nil, nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, nil, fmt.Errorf("%s %s: response is longer than %d bytes", req.Method, req.URL.Path, limit)
+	}
+	return data, resp.Header, nil
+}
+
+// newRequest builds a request to path, authenticated with the profile's token
+func (c *apiClient) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	return req, nil
+}
+
+// send performs req and decodes a JSON response into out. Responses outside
+// 2xx are returned as errors carrying the server's message.
+func (c *apiClient) send(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// checkResponse turns a non-2xx response into an error
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("%s %s: %s: %s", resp.Request.Method, resp.Request.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// stream opens a long-lived GET request, such as the event stream. The
+// caller closes the response body.
+func (c *apiClient) stream(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	// No timeout: the stream runs until ctx is cancelled
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if err := checkResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// tunnel upgrades a request to path to a connection the control plane
+// relays through a device. The caller closes the connection.
+func (c *apiClient) tunnel(ctx context.Context, path string, query url.Values) (io.ReadWriteCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", forward.TunnelProtocol)
+
+	// No timeout: the connection runs until closed
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		if err := checkResponse(resp); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s %s: control plane did not upgrade the connection", req.Method, req.URL.Path)
+	}
+
+	// A 101 response's body is the upgraded connection
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, fmt.Errorf("upgraded connection is not writable")
+	}
+	return conn, nil
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var commandColumns = []column{
+	{"ID", "id"},
+	{"DEVICE", "device_id"},
+	{"COMMAND", "command"},
+	{"STATE", "state"},
+	{"EXIT", "exit_code"},
+	{"ERROR", "error"},
+	{"COMPLETED", "completed_at"},
+}
+
+var commandBatchColumns = []column{
+	{"ID", "id"},
+	{"COMMAND", "command"},
+	{"SELECTOR", "target_selector"},
+	{"MAX CONCURRENCY", "max_concurrency"},
+	{"CREATED", "created_at"},
+	{"COMPLETED", "completed_at"},
+}
+
+// commandEventTypes are the events that report a command's progress
+const commandEventTypes = "command.output,command.completed,command_batch.completed"
+
+func newDeviceExecCmd() *cobra.Command {
+	execCmd := &cobra.Command{
+		Use:   "exec <device-id> -- <command> [args...]",
+		Short: "Run an allowlisted command on a device and stream its output",
+		Long: `Run an allowlisted command, or a script from the agent's script directory,
+on a device. Its output is streamed as it runs and safeedge exits with the
+command's exit code.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: execDeviceCommand,
+	}
+	execCmd.Flags().Duration("timeout", time.Minute, "Kill the command after this long")
+	return execCmd
+}
+
+func newCommandCmd() *cobra.Command {
+	commandCmd := &cobra.Command{
+		Use:   "command",
+		Short: "Run commands across the fleet",
+	}
+
+	runCmd := &cobra.Command{
+		Use:   "run -- <command> [args...]",
+		Short: "Run an allowlisted command on every device matching a selector",
+		Long: `Run an allowlisted command on every active device matching a selector, and
+belonging to a group if given, with at most --max-concurrency running at
+once. Each device's output is streamed prefixed with its ID.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runCommandBatch,
+	}
+	runCmd.Flags().StringP("selector", "l", "", `Label selector of the target devices, such as "region=eu,!canary"`)
+	runCmd.Flags().String("group", "", "Only target members of this device group")
+	runCmd.Flags().Int("max-concurrency", 10, "Devices running the command at once")
+	runCmd.Flags().Duration("timeout", time.Minute, "Kill the command after this long on each device")
+
+	commandCmd.AddCommand(
+		runCmd,
+		&cobra.Command{
+			Use:   "get <command-id>",
+			Short: "Show a command and its output",
+			Args:  cobra.ExactArgs(1),
+			RunE:  getCommand,
+		},
+		&cobra.Command{
+			Use:   "batch <batch-id>",
+			Short: "Show a command batch and the state of each device's command",
+			Args:  cobra.ExactArgs(1),
+			RunE:  getCommandBatch,
+		},
+	)
+	return commandCmd
+}
+
+type runCommandRequest struct {
+	Command        string   `json:"command"`
+	Args           []string `json:"args"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+func newRunCommandRequest(cmd *cobra.Command, args []string) runCommandRequest {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	return runCommandRequest{
+		Command:        args[0],
+		Args:           args[1:],
+		TimeoutSeconds: int(timeout.Seconds()),
+	}
+}
+
+type commandResponse struct {
+	ID       string `json:"id"`
+	DeviceID string `json:"device_id"`
+	State    string `json:"state"`
+}
+
+func execDeviceCommand(cmd *cobra.Command, args []string) error {
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Subscribe before starting the command so no output is missed
+	resp, err := client.stream(ctx, "/v1/events", url.Values{"types": {commandEventTypes}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var command commandResponse
+	if err := client.postJSON("/v1/devices/"+url.PathEscape(args[0])+"/commands", newRunCommandRequest(cmd, args[1:]), &command); err != nil {
+		return err
+	}
+
+	var result fleetEvent
+	err = readEvents(ctx, resp.Body, func(event fleetEvent, raw []byte) bool {
+		if event.ResourceID != command.ID {
+			return false
+		}
+		if outputFormat != "table" {
+			fmt.Println(string(raw))
+		} else if event.Type == "command.output" {
+			data, _ := event.Data["data"].(string)
+			commandStream(event).WriteString(data)
+		}
+
+		result = event
+		return event.Type == "command.completed"
+	})
+	if err != nil || result.Type != "command.completed" {
+		// Interrupted; the command keeps running until its timeout
+		return err
+	}
+
+	return commandExit(result)
+}
+
+// commandStream returns where a command.output event's data is written
+func commandStream(event fleetEvent) io.StringWriter {
+	if event.Data["stream"] == "stderr" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// commandExit exits with a completed command's exit code, or returns why it
+// did not run to completion
+func commandExit(event fleetEvent) error {
+	state, _ := event.Data["state"].(string)
+	if state == "TIMED_OUT" {
+		return fmt.Errorf("command timed out")
+	}
+	if msg, ok := event.Data["error"].(string); ok {
+		return fmt.Errorf("command failed: %s", msg)
+	}
+	if code, ok := event.Data["exit_code"].(float64); ok && code != 0 {
+		os.Exit(int(code))
+	}
+	return nil
+}
+
+type commandBatchRequest struct {
+	runCommandRequest
+	TargetSelector string `json:"target_selector"`
+	TargetGroupID  string `json:"target_group_id,omitempty"`
+	MaxConcurrency int    `json:"max_concurrency"`
+}
+
+type commandBatchResponse struct {
+	ID       string            `json:"id"`
+	Commands []commandResponse `json:"commands"`
+}
+
+func runCommandBatch(cmd *cobra.Command, args []string) error {
+	selector, _ := cmd.Flags().GetString("selector")
+	group, _ := cmd.Flags().GetString("group")
+	maxConcurrency, _ := cmd.Flags().GetInt("max-concurrency")
+
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Subscribe before starting the batch so no output is missed
+	resp, err := client.stream(ctx, "/v1/events", url.Values{"types": {commandEventTypes}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var batch commandBatchResponse
+	if err := client.postJSON("/v1/command-batches", commandBatchRequest{
+		runCommandRequest: newRunCommandRequest(cmd, args),
+		TargetSelector:    selector,
+		TargetGroupID:     group,
+		MaxConcurrency:    maxConcurrency,
+	}, &batch); err != nil {
+		return err
+	}
+
+	if outputFormat == "table" {
+		fmt.Fprintf(os.Stderr, "Running on %d devices (batch %s)\n", len(batch.Commands), batch.ID)
+	}
+	if len(batch.Commands) == 0 {
+		return nil
+	}
+
+	lines := newPrefixedLines()
+	failed := 0
+	err = readEvents(ctx, resp.Body, func(event fleetEvent, raw []byte) bool {
+		if event.Type == "command_batch.completed" {
+			return event.ResourceID == batch.ID
+		}
+		if event.Data["batch_id"] != batch.ID {
+			return false
+		}
+		if event.Type == "command.completed" && event.Data["state"] != "SUCCEEDED" {
+			failed++
+		}
+		if outputFormat != "table" {
+			fmt.Println(string(raw))
+			return false
+		}
+
+		deviceID, _ := event.Data["device_id"].(string)
+		switch event.Type {
+		case "command.output":
+			data, _ := event.Data["data"].(string)
+			lines.write(event, deviceID, data)
+		case "command.completed":
+			lines.flush(event.ResourceID, deviceID)
+			line := fmt.Sprintf("%s | %v", deviceID, event.Data["state"])
+			if code, ok := event.Data["exit_code"]; ok {
+				line += fmt.Sprintf(" (exit %v)", code)
+			}
+			if msg, ok := event.Data["error"]; ok {
+				line += fmt.Sprintf(": %v", msg)
+			}
+			fmt.Fprintln(os.Stderr, line)
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		// Interrupted; the batch keeps running
+		return nil
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("command failed on %d of %d devices", failed, len(batch.Commands))
+	}
+	return nil
+}
+
+// prefixedLines prints the output of many commands interleaved, a whole
+// line at a time, each prefixed with its device's ID
+type prefixedLines struct {
+	partial map[string]*bytes.Buffer
+	streams map[string]io.StringWriter
+}
+
+func newPrefixedLines() *prefixedLines {
+	return &prefixedLines{
+		partial: make(map[string]*bytes.Buffer),
+		streams: make(map[string]io.StringWriter),
+	}
+}
+
+func (p *prefixedLines) write(event fleetEvent, deviceID, data string) {
+	key := event.ResourceID + "/" + fmt.Sprint(event.Data["stream"])
+	buf, ok := p.partial[key]
+	if !ok {
+		buf = &bytes.Buffer{}
+		p.partial[key] = buf
+		p.streams[key] = commandStream(event)
+	}
+	buf.WriteString(data)
+
+	for {
+		line, err := buf.ReadString('\n')
+		if err != nil {
+			// Keep the incomplete line for the next chunk
+			buf.Reset()
+			buf.WriteString(line)
+			return
+		}
+		p.streams[key].WriteString(deviceID + " | " + line)
+	}
+}
+
+// flush prints what is left of a completed command's output
+func (p *prefixedLines) flush(commandID, deviceID string) {
+	for _, stream := range []string{"stdout", "stderr"} {
+		key := commandID + "/" + stream
+		if buf, ok := p.partial[key]; ok && buf.Len() > 0 {
+			p.streams[key].WriteString(deviceID + " | " + buf.String() + "\n")
+		}
+		delete(p.partial, key)
+		delete(p.streams, key)
+	}
+}
+
+func getCommand(cmd *cobra.Command, args []string) error {
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var command map[string]any
+	if err := client.getJSON("/v1/commands/"+url.PathEscape(args[0]), nil, &command); err != nil {
+		return err
+	}
+
+	if err := printOutput(command, commandColumns); err != nil {
+		return err
+	}
+	if outputFormat == "table" {
+		stdout, _ := command["stdout"].(string)
+		stderr, _ := command["stderr"].(string)
+		os.Stdout.WriteString(stdout)
+		os.Stderr.WriteString(stderr)
+	}
+	return nil
+}
+
+func getCommandBatch(cmd *cobra.Command, args []string) error {
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var batch map[string]any
+	if err := client.getJSON("/v1/command-batches/"+url.PathEscape(args[0]), nil, &batch); err != nil {
+		return err
+	}
+
+	if outputFormat != "table" {
+		return printOutput(batch, nil)
+	}
+	if err := printOutput(batch, commandBatchColumns); err != nil {
+		return err
+	}
+	fmt.Println()
+	commands, _ := batch["commands"].([]any)
+	return printOutput(commands, commandColumns)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultProfileName = "default"
+
+// cliConfig is the CLI configuration file: named profiles and the one in use
+type cliConfig struct {
+	CurrentProfile string              `yaml:"current_profile"`
+	Profiles       map[string]*profile `yaml:"profiles"`
+}
+
+// profile is a control plane and the credentials used with it
+type profile struct {
+	APIURL         string `yaml:"api_url"`
+	Token          string `yaml:"token,omitempty"`
+	OrganizationID string `yaml:"organization_id,omitempty"`
+	UserEmail      string `yaml:"user_email,omitempty"`
+}
+
+// configPath is $SAFEEDGE_CONFIG, or safeedge/config.yaml in the user's
+// configuration directory
+func configPath() (string, error) {
+	if path := os.Getenv("SAFEEDGE_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config directory: %w", err)
+	}
+
+	return filepath.Join(dir, "safeedge", "config.yaml"), nil
+}
+
+// loadConfig reads the configuration file, returning an empty configuration
+// if it does not exist yet
+func loadConfig() (*cliConfig, error) {
+	cfg := &cliConfig{Profiles: map[string]*profile{}}
+
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]*profile{}
+	}
+
+	return cfg, nil
+}
+
+// save writes the configuration file, readable only by the user since it
+// holds API tokens
+func (c *cliConfig) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	data := buf.Bytes()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	return nil
+}
+
+// activeProfile returns the profile selected by --profile, or the current
+// one. Without any profile the CLI talks to a local control plane.
+func activeProfile() (*profile, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	name := profileName
+	if name == "" {
+		name = cfg.CurrentProfile
+	}
+	if name == "" {
+		return &profile{APIURL: defaultAPIURL}, nil
+	}
+
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q does not exist; run safeedge login --profile %s", name, name)
+	}
+
+	return p, nil
+}
+
+// newClient builds an API client for the active profile, with --api-url
+// taking precedence over the profile's address
+func newClient() (*apiClient, *profile, error) {
+	p, err := activeProfile()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	baseURL := p.APIURL
+	if apiURL != "" {
+		baseURL = apiURL
+	}
+	if baseURL == "" {
+		baseURL = defaultAPIURL
+	}
+
+	return newAPIClient(baseURL, p.Token), p, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var configDiffColumns = []column{
+	{"SETTING", "setting"},
+	{"DESIRED", "desired"},
+	{"REPORTED", "reported"},
+}
+
+func newDeviceConfigCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Manage a device's desired configuration",
+		Long: `A device's desired configuration is its groups' configuration documents,
+merged in group name order, with its own document merged over them. Each
+section of a document is applied by the agent plugin its key names, such as
+"env" or "services"; null removes a setting a group makes.`,
+	}
+
+	setCmd := &cobra.Command{
+		Use:   "set <device-id>",
+		Short: "Replace a device's own configuration document",
+		Args:  cobra.ExactArgs(1),
+		RunE:  setDeviceConfig,
+	}
+	setCmd.Flags().StringP("file", "f", "", `JSON document to set, or "-" for standard input (required)`)
+	setCmd.MarkFlagRequired("file")
+
+	configCmd.AddCommand(
+		&cobra.Command{
+			Use:   "get <device-id>",
+			Short: "Show a device's desired and reported configuration and how they differ",
+			Args:  cobra.ExactArgs(1),
+			RunE:  getDeviceConfig,
+		},
+		setCmd,
+		&cobra.Command{
+			Use:   "delete <device-id>",
+			Short: "Remove a device's own configuration document, leaving its groups'",
+			Args:  cobra.ExactArgs(1),
+			RunE:  deleteDeviceConfig,
+		},
+	)
+	return configCmd
+}
+
+func getDeviceConfig(cmd *cobra.Command, args []string) error {
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var state map[string]any
+	if err := client.getJSON("/v1/devices/"+url.PathEscape(args[0])+"/config", nil, &state); err != nil {
+		return err
+	}
+
+	return printConfigState(state)
+}
+
+func setDeviceConfig(cmd *cobra.Command, args []string) error {
+	file, _ := cmd.Flags().GetString("file")
+
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read document: %w", err)
+	}
+
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var state map[string]any
+	if err := client.putBytes("/v1/devices/"+url.PathEscape(args[0])+"/config", data, nil, &state); err != nil {
+		return err
+	}
+
+	return printConfigState(state)
+}
+
+func deleteDeviceConfig(cmd *cobra.Command, args []string) error {
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	if err := client.delete("/v1/devices/"+url.PathEscape(args[0])+"/config", nil); err != nil {
+		return err
+	}
+
+	return printMessage(map[string]any{"id": args[0]}, "Deleted configuration of device %s", args[0])
+}
+
+// printConfigState writes a device's configuration state. Tables show
+// whether the device is in sync, its errors and the settings that differ.
+func printConfigState(state map[string]any) error {
+	if outputFormat != "table" {
+		return printOutput(state, nil)
+	}
+
+	switch {
+	case state["reported_at"] == nil:
+		fmt.Println("The device has not reported its configuration yet")
+	case state["in_sync"] == true:
+		fmt.Println("In sync")
+	default:
+		fmt.Println("Out of sync")
+	}
+
+	if errs, _ := state["errors"].(map[string]any); len(errs) > 0 {
+		sections := make([]string, 0, len(errs))
+		for section := range errs {
+			sections = append(sections, section)
+		}
+		sort.Strings(sections)
+		for _, section := range sections {
+			fmt.Printf("error in %s: %v\n", section, errs[section])
+		}
+	}
+
+	diff, _ := state["diff"].([]any)
+	if len(diff) == 0 {
+		return nil
+	}
+
+	rows := make([]any, 0, len(diff))
+	for _, d := range diff {
+		difference, _ := d.(map[string]any)
+		path, _ := difference["path"].([]any)
+		keys := make([]string, len(path))
+		for i, key := range path {
+			keys[i] = fmt.Sprint(key)
+		}
+		rows = append(rows, map[string]any{
+			"setting":  strings.Join(keys, "."),
+			"desired":  difference["desired"],
+			"reported": difference["reported"],
+		})
+	}
+
+	fmt.Println()
+	return printOutput(rows, configDiffColumns)
+}
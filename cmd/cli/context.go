@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+func newLoginCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Save a control plane and its credentials as a profile",
+		Long: "Save a control plane address and API token as a profile and make it the current profile. " +
+			"The token is checked against the control plane before it is saved.",
+		Args: cobra.NoArgs,
+		RunE: login,
+	}
+	cmd.Flags().String("token", getEnv("SAFEEDGE_TOKEN", ""), "API token")
+	cmd.Flags().String("organization", "", "Organization ID used when creating enrollment tokens")
+	cmd.Flags().String("email", "", "Your email, used to request access sessions")
+	return cmd
+}
+
+func login(cmd *cobra.Command, args []string) error {
+	token, _ := cmd.Flags().GetString("token")
+	organizationID, _ := cmd.Flags().GetString("organization")
+	email, _ := cmd.Flags().GetString("email")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	name := profileName
+	if name == "" {
+		name = defaultProfileName
+	}
+
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		p = &profile{APIURL: defaultAPIURL}
+		cfg.Profiles[name] = p
+	}
+	if apiURL != "" {
+		p.APIURL = apiURL
+	}
+	if cmd.Flags().Changed("token") || token != "" {
+		p.Token = token
+	}
+	if organizationID != "" {
+		p.OrganizationID = organizationID
+	}
+	if email != "" {
+		p.UserEmail = email
+	}
+
+	client := newAPIClient(p.APIURL, p.Token)
+	var devices any
+	if err := client.getJSON("/v1/devices", url.Values{"page_size": {"1"}}, &devices); err != nil {
+		return fmt.Errorf("failed to reach %s: %w", p.APIURL, err)
+	}
+
+	cfg.CurrentProfile = name
+	if err := cfg.save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged in to %s as profile %q\n", p.APIURL, name)
+	return nil
+}
+
+func newContextCmd() *cobra.Command {
+	contextCmd := &cobra.Command{
+		Use:   "context",
+		Short: "Manage profiles",
+	}
+
+	contextCmd.AddCommand(
+		&cobra.Command{
+			Use:   "list",
+			Short: "List profiles",
+			Args:  cobra.NoArgs,
+			RunE:  listContexts,
+		},
+		&cobra.Command{
+			Use:   "current",
+			Short: "Print the current profile",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cfg, err := loadConfig()
+				if err != nil {
+					return err
+				}
+				if cfg.CurrentProfile == "" {
+					return fmt.Errorf("no current profile; run safeedge login")
+				}
+				fmt.Println(cfg.CurrentProfile)
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "use <profile>",
+			Short: "Switch the current profile",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cfg, err := loadConfig()
+				if err != nil {
+					return err
+				}
+				if _, ok := cfg.Profiles[args[0]]; !ok {
+					return fmt.Errorf("profile %q does not exist", args[0])
+				}
+				cfg.CurrentProfile = args[0]
+				if err := cfg.save(); err != nil {
+					return err
+				}
+				fmt.Printf("Switched to profile %q\n", args[0])
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "delete <profile>",
+			Short: "Delete a profile and its credentials",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cfg, err := loadConfig()
+				if err != nil {
+					return err
+				}
+				if _, ok := cfg.Profiles[args[0]]; !ok {
+					return fmt.Errorf("profile %q does not exist", args[0])
+				}
+				delete(cfg.Profiles, args[0])
+				if cfg.CurrentProfile == args[0] {
+					cfg.CurrentProfile = ""
+				}
+				if err := cfg.save(); err != nil {
+					return err
+				}
+				fmt.Printf("Deleted profile %q\n", args[0])
+				return nil
+			},
+		},
+	)
+
+	return contextCmd
+}
+
+func listContexts(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Tokens are never printed
+	rows := make([]any, len(names))
+	for i, name := range names {
+		p := cfg.Profiles[name]
+		rows[i] = map[string]any{
+			"name":            name,
+			"current":         name == cfg.CurrentProfile,
+			"api_url":         p.APIURL,
+			"organization_id": p.OrganizationID,
+			"user_email":      p.UserEmail,
+		}
+	}
+
+	return printOutput(rows, []column{
+		{"NAME", "name"},
+		{"CURRENT", "current"},
+		{"API URL", "api_url"},
+		{"ORGANIZATION", "organization_id"},
+		{"EMAIL", "user_email"},
+	})
+}
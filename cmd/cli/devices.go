@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var deviceColumns = []column{
+	{"ID", "id"},
+	{"STATUS", "status"},
+	{"CONNECTIVITY", "connectivity.state"},
+	{"PLATFORM", "platform"},
+	{"AGENT", "agent_version"},
+	{"SITE", "site_tag"},
+	{"WIREGUARD IP", "wireguard_ip"},
+	{"LABELS", "labels"},
+	{"LAST SEEN", "connectivity.last_seen_at"},
+}
+
+func newDeviceCmd() *cobra.Command {
+	deviceCmd := &cobra.Command{
+		Use:   "device",
+		Short: "Manage devices",
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List devices",
+		Args:  cobra.NoArgs,
+		RunE:  listDevices,
+	}
+	listCmd.Flags().String("status", "", "Only devices with this status (ACTIVE, SUSPENDED, DECOMMISSIONED)")
+	listCmd.Flags().StringP("selector", "l", "", `Label selector, such as "region=eu,!canary"`)
+	listCmd.Flags().String("group", "", "Only members of this device group")
+	listCmd.Flags().String("site-tag", "", "Only devices with this site tag")
+	listCmd.Flags().String("platform", "", "Only devices on this platform")
+	listCmd.Flags().String("online", "", "Only online (true) or offline (false) devices")
+	listCmd.Flags().String("sort", "", "Sort field, prefixed with - for descending (default -created_at)")
+	listCmd.Flags().Int("page-size", 100, "Devices per page")
+	listCmd.Flags().Bool("all", false, "List every page")
+
+	suspendCmd := &cobra.Command{
+		Use:   "suspend <device-id>",
+		Short: "Suspend a device, cutting it off until it is reactivated",
+		Args:  cobra.ExactArgs(1),
+		RunE:  deviceAction("suspend", "Suspended"),
+	}
+	reactivateCmd := &cobra.Command{
+		Use:   "reactivate <device-id>",
+		Short: "Reactivate a suspended device",
+		Args:  cobra.ExactArgs(1),
+		RunE:  deviceAction("reactivate", "Reactivated"),
+	}
+	decommissionCmd := &cobra.Command{
+		Use:   "decommission <device-id>",
+		Short: "Permanently decommission a device and revoke its keys",
+		Args:  cobra.ExactArgs(1),
+		RunE:  deviceAction("decommission", "Decommissioned"),
+	}
+
+	deviceCmd.AddCommand(
+		listCmd,
+		&cobra.Command{
+			Use:   "get <device-id>",
+			Short: "Show a device",
+			Args:  cobra.ExactArgs(1),
+			RunE:  getDevice,
+		},
+		suspendCmd,
+		reactivateCmd,
+		decommissionCmd,
+		newDeviceExecCmd(),
+		newDeviceLogsCmd(),
+		newDeviceCpCmd(),
+		newDeviceConfigCmd(),
+	)
+	return deviceCmd
+}
+
+type deviceListPage struct {
+	Devices    []any  `json:"devices"`
+	NextCursor string `json:"next_cursor"`
+}
+
+func listDevices(cmd *cobra.Command, args []string) error {
+	pageSize, _ := cmd.Flags().GetInt("page-size")
+	all, _ := cmd.Flags().GetBool("all")
+
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"page_size": {strconv.Itoa(pageSize)}}
+	for flag, param := range map[string]string{
+		"status":   "status",
+		"selector": "selector",
+		"group":    "group",
+		"site-tag": "site_tag",
+		"platform": "platform",
+		"online":   "online",
+		"sort":     "sort",
+	} {
+		if v, _ := cmd.Flags().GetString(flag); v != "" {
+			query.Set(param, v)
+		}
+	}
+
+	devices := []any{}
+	for {
+		var page deviceListPage
+		if err := client.getJSON("/v1/devices", query, &page); err != nil {
+			return err
+		}
+		devices = append(devices, page.Devices...)
+
+		if !all || page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+
+	return printOutput(devices, deviceColumns)
+}
+
+func getDevice(cmd *cobra.Command, args []string) error {
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var device map[string]any
+	if err := client.getJSON("/v1/devices/"+url.PathEscape(args[0]), nil, &device); err != nil {
+		return err
+	}
+
+	return printOutput(device, deviceColumns)
+}
+
+// deviceAction runs a lifecycle transition on the device given as argument
+func deviceAction(action, done string) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		client, _, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		var device map[string]any
+		if err := client.postJSON("/v1/devices/"+url.PathEscape(args[0])+"/"+action, nil, &device); err != nil {
+			return err
+		}
+
+		return printMessage(device, "%s device %s", done, args[0])
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newDeviceLogsCmd() *cobra.Command {
+	logsCmd := &cobra.Command{
+		Use:   "logs <device-id>",
+		Short: "Show a device's logs",
+		Long: `Show entries from the log sources a device's agent is configured with. A
+connected device is asked directly; otherwise, or with --stored, the entries
+it shipped to the control plane are shown. --since and --until take an RFC
+3339 time or a duration ago, such as 1h.`,
+		Args: cobra.ExactArgs(1),
+		RunE: deviceLogs,
+	}
+	logsCmd.Flags().String("since", "", "Only entries logged at or after this time")
+	logsCmd.Flags().String("until", "", "Only entries logged at or before this time")
+	logsCmd.Flags().StringSlice("source", nil, "Only entries from these sources (repeatable or comma-separated)")
+	logsCmd.Flags().Int("limit", 1000, "Most recent entries to show")
+	logsCmd.Flags().BoolP("follow", "f", false, "Keep streaming new entries as the device writes them")
+	logsCmd.Flags().Bool("stored", false, "Show the entries the device shipped rather than asking it")
+	return logsCmd
+}
+
+type logEntry struct {
+	Source    string     `json:"source"`
+	Timestamp *time.Time `json:"timestamp"`
+	Message   string     `json:"message"`
+	Error     string     `json:"error"`
+}
+
+type deviceLogsResponse struct {
+	From      string     `json:"from"`
+	Entries   []logEntry `json:"entries"`
+	Truncated bool       `json:"truncated"`
+	Errors    []string   `json:"errors"`
+}
+
+func deviceLogs(cmd *cobra.Command, args []string) error {
+	limit, _ := cmd.Flags().GetInt("limit")
+	sources, _ := cmd.Flags().GetStringSlice("source")
+	follow, _ := cmd.Flags().GetBool("follow")
+	stored, _ := cmd.Flags().GetBool("stored")
+
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	for _, flag := range []string{"since", "until"} {
+		if v, _ := cmd.Flags().GetString(flag); v != "" {
+			query.Set(flag, v)
+		}
+	}
+	if len(sources) > 0 {
+		query.Set("source", strings.Join(sources, ","))
+	}
+	if stored {
+		query.Set("stored", "true")
+	}
+	path := "/v1/devices/" + url.PathEscape(args[0]) + "/logs"
+
+	if follow {
+		query.Set("follow", "true")
+		return followDeviceLogs(client, path, query)
+	}
+
+	if outputFormat != "table" {
+		var raw map[string]any
+		if err := client.getJSON(path, query, &raw); err != nil {
+			return err
+		}
+		return printOutput(raw, nil)
+	}
+
+	var resp deviceLogsResponse
+	if err := client.getJSON(path, query, &resp); err != nil {
+		return err
+	}
+
+	for _, entry := range resp.Entries {
+		printLogEntry(entry)
+	}
+	for _, msg := range resp.Errors {
+		fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+	}
+	if resp.Truncated {
+		fmt.Fprintf(os.Stderr, "older entries omitted; narrow --since or raise --limit\n")
+	}
+	if resp.From == "stored" && !stored {
+		fmt.Fprintf(os.Stderr, "device is not connected; showing shipped entries\n")
+	}
+	return nil
+}
+
+// followDeviceLogs prints a device's log stream until interrupted or the
+// device disconnects
+func followDeviceLogs(client *apiClient, path string, query url.Values) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	resp, err := client.stream(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if outputFormat != "table" {
+			fmt.Println(scanner.Text())
+			continue
+		}
+
+		var entry logEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("failed to decode log entry: %w", err)
+		}
+		if entry.Error != "" {
+			fmt.Fprintf(os.Stderr, "error: %s\n", entry.Error)
+			continue
+		}
+		printLogEntry(entry)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+func printLogEntry(entry logEntry) {
+	timestamp := "-"
+	if entry.Timestamp != nil {
+		timestamp = entry.Timestamp.Local().Format(time.RFC3339)
+	}
+	fmt.Printf("%s %s %s\n", timestamp, entry.Source, entry.Message)
+}
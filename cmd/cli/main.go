@@ -1,20 +1,43 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
 )
 
+const defaultAPIURL = "http://localhost:8080"
+
+var (
+	// apiURL overrides the control plane REST API address of the profile
+	apiURL string
+	// profileName selects a profile other than the current one
+	profileName string
+	// outputFormat is table, json or yaml
+	outputFormat string
+)
+
 func main() {
 	rootCmd := &cobra.Command{
 		Use:   "safeedge",
 		Short: "SafeEdge CLI",
 		Long:  "Command-line interface for SafeEdge fleet management platform",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if !validOutputFormats[outputFormat] {
+				return fmt.Errorf("--output must be table, json or yaml")
+			}
+			return nil
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
 	}
 
-	// Placeholder commands - to be implemented
+	rootCmd.PersistentFlags().StringVar(&apiURL, "api-url", os.Getenv("SAFEEDGE_API_URL"), "Control plane HTTP address (default: the profile's)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", os.Getenv("SAFEEDGE_PROFILE"), "Profile to use (default: the current profile)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", getEnv("SAFEEDGE_OUTPUT", "table"), "Output format: table, json or yaml")
+
 	rootCmd.AddCommand(
 		&cobra.Command{
 			Use:   "version",
@@ -23,10 +46,32 @@ func main() {
 				fmt.Println("safeedge version 0.1.0")
 			},
 		},
+		newLoginCmd(),
+		newContextCmd(),
+		newTokenCmd(),
+		newDeviceCmd(),
+		newArtifactCmd(),
+		newRolloutCmd(),
+		newAccessCmd(),
+		newCommandCmd(),
+		newPolicyCmd(),
+		newAuditCmd(),
 	)
 
 	if err := rootCmd.Execute(); err != nil {
+		var chainErr *chainBreakError
+		if errors.As(err, &chainErr) {
+			fmt.Fprintf(os.Stderr, "FAILED: %v\n", chainErr)
+			os.Exit(2)
+		}
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var validOutputFormats = map[string]bool{
+	"table": true,
+	"json":  true,
+	"yaml":  true,
+}
+
+// column is a table column showing the value at a dotted field path
+type column struct {
+	header string
+	field  string
+}
+
+// printOutput writes a decoded API response in the selected output format.
+// Tables show one row per element of a list, or a single row for an object.
+func printOutput(v any, columns []column) error {
+	switch outputFormat {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(yamlValue(v)); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+
+	rows, ok := v.([]any)
+	if !ok {
+		rows = []any{v}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	headers := make([]string, len(columns))
+	for i, c := range columns {
+		headers[i] = c.header
+	}
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, c := range columns {
+			cells[i] = formatCell(lookup(row, c.field))
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+
+	return w.Flush()
+}
+
+// printMessage writes a short confirmation, or the response itself when a
+// machine-readable format is selected
+func printMessage(v any, format string, args ...any) error {
+	if outputFormat != "table" {
+		return printOutput(v, nil)
+	}
+	fmt.Printf(format+"\n", args...)
+	return nil
+}
+
+// lookup returns the value at a dotted field path of a decoded JSON object
+func lookup(v any, field string) any {
+	for _, key := range strings.Split(field, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	return v
+}
+
+// formatCell renders a value for a table cell. Timestamps are shown in
+// local time, objects as comma-separated key=value pairs.
+func formatCell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case string:
+		if v == "" {
+			return "-"
+		}
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t.Local().Format("2006-01-02 15:04:05")
+		}
+		return v
+	case map[string]any:
+		if len(v) == 0 {
+			return "-"
+		}
+		pairs := make([]string, 0, len(v))
+		for k, val := range v {
+			pairs = append(pairs, k+"="+formatCell(val))
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ",")
+	case []any:
+		if len(v) == 0 {
+			return "-"
+		}
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatCell(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// yamlValue converts json.Number values so they are written as YAML numbers
+// rather than quoted strings
+func yamlValue(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, val := range v {
+			out[k] = yamlValue(val)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, val := range v {
+			out[i] = yamlValue(val)
+		}
+		return out
+	default:
+		return v
+	}
+}
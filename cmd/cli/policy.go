@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/netf/safeedge/pkg/crypto"
+	"github.com/netf/safeedge/pkg/policy"
+)
+
+func newPolicyCmd() *cobra.Command {
+	policyCmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Sign and verify device policy files",
+		Long: `A device policy file lists the commands, file paths and forward destinations
+a device permits. Install it with its signature as
+/var/lib/safeedge/policy.json and policy.json.sig, and start the agent with
+--policy-public-key; the agent denies anything else, whatever the control
+plane asks.`,
+	}
+
+	signCmd := &cobra.Command{
+		Use:   "sign <file>",
+		Short: "Validate a policy file and sign it with your organization key into <file>.sig",
+		Args:  cobra.ExactArgs(1),
+		RunE:  signPolicy,
+	}
+	signCmd.Flags().String("signing-key", getEnv("SAFEEDGE_POLICY_SIGNING_KEY", ""), "File holding the base64 Ed25519 organization private key")
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify <file>",
+		Short: "Check a policy file and its signature as the agent does",
+		Args:  cobra.ExactArgs(1),
+		RunE:  verifyPolicy,
+	}
+	verifyCmd.Flags().String("public-key", getEnv("SAFEEDGE_POLICY_PUBLIC_KEY", ""), "Organization public key the policy must be signed with")
+
+	policyCmd.AddCommand(signCmd, verifyCmd)
+	return policyCmd
+}
+
+func signPolicy(cmd *cobra.Command, args []string) error {
+	signingKey, _ := cmd.Flags().GetString("signing-key")
+	if signingKey == "" {
+		return fmt.Errorf("--signing-key is required")
+	}
+
+	keys, err := crypto.LoadEd25519KeyPair(signingKey)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read policy: %w", err)
+	}
+	p, err := policy.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	signaturePath := policy.SignaturePath(args[0])
+	if err := os.WriteFile(signaturePath, policy.Sign(data, keys), 0644); err != nil {
+		return fmt.Errorf("failed to write signature: %w", err)
+	}
+
+	return printMessage(map[string]any{
+		"policy":      p,
+		"signature":   signaturePath,
+		"public_key":  keys.PublicKeyString(),
+		"policy_hash": crypto.BLAKE3Hash(data),
+	}, "Signed %s into %s with public key %s", args[0], signaturePath, keys.PublicKeyString())
+}
+
+func verifyPolicy(cmd *cobra.Command, args []string) error {
+	publicKey, _ := cmd.Flags().GetString("public-key")
+	if publicKey == "" {
+		return fmt.Errorf("--public-key is required")
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read policy: %w", err)
+	}
+	signature, err := os.ReadFile(policy.SignaturePath(args[0]))
+	if err != nil {
+		return fmt.Errorf("failed to read policy signature: %w", err)
+	}
+	if err := policy.Verify(data, signature, publicKey); err != nil {
+		return err
+	}
+	p, err := policy.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	return printMessage(map[string]any{
+		"policy":      p,
+		"policy_hash": crypto.BLAKE3Hash(data),
+	}, "Policy %s is valid (hash %s)", args[0], crypto.BLAKE3Hash(data))
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var rolloutColumns = []column{
+	{"ID", "id"},
+	{"STATE", "state"},
+	{"ARTIFACT", "artifact_id"},
+	{"SELECTOR", "target_selector"},
+	{"GROUP", "target_group_id"},
+	{"TARGETS", "target_device_count"},
+	{"CANARY %", "canary_percent"},
+	{"CREATED", "created_at"},
+	{"STARTED", "started_at"},
+	{"COMPLETED", "completed_at"},
+}
+
+// rolloutFinalStates are the states a rollout does not leave
+var rolloutFinalStates = map[string]bool{
+	"COMPLETE": true,
+	"FAILED":   true,
+}
+
+func newRolloutCmd() *cobra.Command {
+	rolloutCmd := &cobra.Command{
+		Use:   "rollout",
+		Short: "Manage rollouts",
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a draft rollout of an artifact",
+		Args:  cobra.NoArgs,
+		RunE:  createRollout,
+	}
+	createCmd.Flags().String("artifact", "", "Artifact ID to roll out")
+	createCmd.Flags().StringP("selector", "l", "", "Label selector of the target devices (default: every active device)")
+	createCmd.Flags().String("group", "", "Only target members of this device group")
+	createCmd.Flags().Int32("canary-percent", 10, "Percentage of targets updated first")
+	createCmd.Flags().Duration("soak-time", 5*time.Minute, "How long canaries must stay healthy before the rest are updated")
+	createCmd.Flags().String("health-check-url", "", "URL devices check after updating")
+	createCmd.MarkFlagRequired("artifact")
+	createCmd.MarkFlagRequired("health-check-url")
+
+	watchCmd := &cobra.Command{
+		Use:   "watch <rollout-id>",
+		Short: "Follow a rollout's progress live",
+		Long: "Print a rollout's state changes and the update status each device reports as they happen, " +
+			"until the rollout completes or fails, or you interrupt it.",
+		Args: cobra.ExactArgs(1),
+		RunE: watchRollout,
+	}
+
+	rolloutCmd.AddCommand(
+		createCmd,
+		&cobra.Command{
+			Use:   "start <rollout-id>",
+			Short: "Start a draft rollout",
+			Args:  cobra.ExactArgs(1),
+			RunE:  rolloutAction("start", "Started"),
+		},
+		&cobra.Command{
+			Use:   "abort <rollout-id>",
+			Short: "Abort a rollout",
+			Args:  cobra.ExactArgs(1),
+			RunE:  rolloutAction("abort", "Aborted"),
+		},
+		&cobra.Command{
+			Use:   "status <rollout-id>",
+			Short: "Show a rollout",
+			Args:  cobra.ExactArgs(1),
+			RunE:  rolloutStatus,
+		},
+		watchCmd,
+	)
+	return rolloutCmd
+}
+
+func createRollout(cmd *cobra.Command, args []string) error {
+	artifactID, _ := cmd.Flags().GetString("artifact")
+	selector, _ := cmd.Flags().GetString("selector")
+	groupID, _ := cmd.Flags().GetString("group")
+	canaryPercent, _ := cmd.Flags().GetInt32("canary-percent")
+	soakTime, _ := cmd.Flags().GetDuration("soak-time")
+	healthCheckURL, _ := cmd.Flags().GetString("health-check-url")
+
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	soakSeconds := int32(soakTime.Seconds())
+	var rollout map[string]any
+	if err := client.postJSON("/v1/rollouts", map[string]any{
+		"artifact_id":       artifactID,
+		"target_selector":   selector,
+		"target_group_id":   groupID,
+		"canary_percent":    canaryPercent,
+		"soak_time_seconds": soakSeconds,
+		"health_check_url":  healthCheckURL,
+	}, &rollout); err != nil {
+		return err
+	}
+
+	return printOutput(rollout, rolloutColumns)
+}
+
+func rolloutStatus(cmd *cobra.Command, args []string) error {
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var rollout map[string]any
+	if err := client.getJSON("/v1/rollouts/"+url.PathEscape(args[0]), nil, &rollout); err != nil {
+		return err
+	}
+
+	return printOutput(rollout, rolloutColumns)
+}
+
+// rolloutAction runs a state transition on the rollout given as argument
+func rolloutAction(action, done string) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		client, _, err := newClient()
+		if err != nil {
+			return err
+		}
+
+		var rollout map[string]any
+		if err := client.postJSON("/v1/rollouts/"+url.PathEscape(args[0])+"/"+action, nil, &rollout); err != nil {
+			return err
+		}
+
+		// Starting sends canaries their update at once, and aborting rolls
+		// back what was sent, so the rollout may have moved on already
+		return printMessage(rollout, "%s rollout %s, now %v", done, args[0], rollout["state"])
+	}
+}
+
+// fleetEvent is an event from the control plane's event stream
+type fleetEvent struct {
+	ID         string         `json:"id"`
+	Type       string         `json:"type"`
+	ResourceID string         `json:"resource_id"`
+	Timestamp  time.Time      `json:"timestamp"`
+	Data       map[string]any `json:"data"`
+}
+
+func watchRollout(cmd *cobra.Command, args []string) error {
+	rolloutID := args[0]
+
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Subscribe before reading the current state so no change is missed
+	resp, err := client.stream(ctx, "/v1/events", url.Values{
+		"resource_type": {"rollout"},
+		"resource_id":   {rolloutID},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var rollout map[string]any
+	if err := client.getJSON("/v1/rollouts/"+url.PathEscape(rolloutID), nil, &rollout); err != nil {
+		return err
+	}
+	state, _ := rollout["state"].(string)
+	if outputFormat == "table" {
+		fmt.Printf("Rollout %s is %s, targeting %v devices\n", rolloutID, state, rollout["target_device_count"])
+	}
+	if rolloutFinalStates[state] {
+		return nil
+	}
+
+	return readEvents(ctx, resp.Body, func(event fleetEvent, raw []byte) bool {
+		if outputFormat != "table" {
+			fmt.Println(string(raw))
+		} else {
+			printRolloutEvent(event)
+		}
+
+		state, _ := event.Data["state"].(string)
+		return event.Type == "rollout.state_changed" && rolloutFinalStates[state]
+	})
+}
+
+// printRolloutEvent prints a rollout event as a line of text
+func printRolloutEvent(event fleetEvent) {
+	ts := event.Timestamp.Local().Format("15:04:05")
+
+	switch event.Type {
+	case "rollout.state_changed":
+		line := fmt.Sprintf("%s  rollout is %v", ts, event.Data["state"])
+		if from, ok := event.Data["previous_state"]; ok {
+			line = fmt.Sprintf("%s  rollout %v -> %v", ts, from, event.Data["state"])
+		}
+		if reason, ok := event.Data["reason"]; ok {
+			line += fmt.Sprintf(": %v", reason)
+		}
+		fmt.Println(line)
+	case "rollout.device_updated":
+		line := fmt.Sprintf("%s  device %v  %v", ts, event.Data["device_id"], event.Data["status"])
+		if msg, ok := event.Data["error"]; ok {
+			line += fmt.Sprintf(": %v", msg)
+		}
+		fmt.Println(line)
+	case "rollout.device_failed":
+		line := fmt.Sprintf("%s  device %v  FAILED", ts, event.Data["device_id"])
+		if canary, _ := event.Data["canary"].(bool); canary {
+			line = fmt.Sprintf("%s  canary %v  FAILED", ts, event.Data["device_id"])
+		}
+		line += fmt.Sprintf(": %v", event.Data["reason"])
+		if msg, _ := event.Data["error"].(string); msg != "" {
+			line += ": " + msg
+		}
+		fmt.Println(line)
+	default:
+		fmt.Printf("%s  %s\n", ts, event.Type)
+	}
+}
+
+// readEvents reads a server-sent event stream, calling handle with each
+// event until handle returns true or the stream ends
+func readEvents(ctx context.Context, body io.Reader, handle func(event fleetEvent, raw []byte) bool) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var event fleetEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+		if handle(event, []byte(data)) {
+			return nil
+		}
+	}
+
+	// Interrupted by the user
+	if ctx.Err() != nil {
+		return nil
+	}
+	if scanner.Err() != nil {
+		return fmt.Errorf("event stream failed: %w", scanner.Err())
+	}
+	return fmt.Errorf("event stream closed by the control plane")
+}
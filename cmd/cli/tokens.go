@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var tokenColumns = []column{
+	{"ID", "id"},
+	{"SITE TAG", "site_tag"},
+	{"USED", "used_count"},
+	{"MAX USES", "max_uses"},
+	{"EXPIRES", "expires_at"},
+	{"REVOKED", "revoked_at"},
+	{"CREATED", "created_at"},
+}
+
+func newTokenCmd() *cobra.Command {
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage enrollment tokens",
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an enrollment token",
+		Long:  "Create an enrollment token. The token itself is only shown once.",
+		Args:  cobra.NoArgs,
+		RunE:  createToken,
+	}
+	createCmd.Flags().String("organization", "", "Organization to enroll devices into (default: the profile's)")
+	createCmd.Flags().String("site-tag", "", "Site tag given to devices enrolled with the token")
+	createCmd.Flags().Duration("expires-in", 24*time.Hour, "How long the token is valid")
+	createCmd.Flags().Int("max-uses", 1, "How many devices the token can enroll")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List enrollment tokens",
+		Args:  cobra.NoArgs,
+		RunE:  listTokens,
+	}
+	listCmd.Flags().Int("page-size", 100, "Number of tokens to list")
+	listCmd.Flags().Int("offset", 0, "Number of tokens to skip")
+
+	revokeCmd := &cobra.Command{
+		Use:   "revoke <token-id>",
+		Short: "Revoke an enrollment token",
+		Args:  cobra.ExactArgs(1),
+		RunE:  revokeToken,
+	}
+
+	tokenCmd.AddCommand(createCmd, listCmd, revokeCmd)
+	return tokenCmd
+}
+
+func createToken(cmd *cobra.Command, args []string) error {
+	organizationID, _ := cmd.Flags().GetString("organization")
+	siteTag, _ := cmd.Flags().GetString("site-tag")
+	expiresIn, _ := cmd.Flags().GetDuration("expires-in")
+	maxUses, _ := cmd.Flags().GetInt("max-uses")
+
+	client, p, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	if organizationID == "" {
+		organizationID = p.OrganizationID
+	}
+	if organizationID == "" {
+		return fmt.Errorf("--organization is required when the profile has no organization")
+	}
+	if expiresIn < time.Second {
+		return fmt.Errorf("--expires-in must be at least 1s")
+	}
+	if maxUses < 1 {
+		return fmt.Errorf("--max-uses must be at least 1")
+	}
+
+	var token map[string]any
+	if err := client.postJSON("/v1/enrollment-tokens", map[string]any{
+		"organization_id":    organizationID,
+		"site_tag":           siteTag,
+		"expires_in_seconds": int(expiresIn.Seconds()),
+		"max_uses":           maxUses,
+	}, &token); err != nil {
+		return err
+	}
+
+	return printOutput(token, []column{
+		{"ID", "id"},
+		{"TOKEN", "token"},
+		{"MAX USES", "max_uses"},
+		{"EXPIRES", "expires_at"},
+	})
+}
+
+func listTokens(cmd *cobra.Command, args []string) error {
+	pageSize, _ := cmd.Flags().GetInt("page-size")
+	offset, _ := cmd.Flags().GetInt("offset")
+
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var tokens []any
+	if err := client.getJSON("/v1/enrollment-tokens", url.Values{
+		"page_size": {strconv.Itoa(pageSize)},
+		"offset":    {strconv.Itoa(offset)},
+	}, &tokens); err != nil {
+		return err
+	}
+
+	return printOutput(tokens, tokenColumns)
+}
+
+func revokeToken(cmd *cobra.Command, args []string) error {
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var token map[string]any
+	if err := client.delete("/v1/enrollment-tokens/"+url.PathEscape(args[0]), &token); err != nil {
+		return err
+	}
+
+	return printMessage(token, "Revoked enrollment token %s", args[0])
+}
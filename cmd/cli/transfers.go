@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+
+	"github.com/netf/safeedge/pkg/crypto"
+	"github.com/netf/safeedge/pkg/transfer"
+)
+
+func newDeviceCpCmd() *cobra.Command {
+	cpCmd := &cobra.Command{
+		Use:   "cp <src> <dst>",
+		Short: "Copy a file to or from a device",
+		Long: `Copy a file to or from a device through the control plane, with no access
+session needed. One of src and dst is a local path and the other
+<device-id>:<absolute path>, as with scp; the device path names the file,
+not its directory. The agent only reads and writes files below its transfer
+directories that its policy allows.
+
+Files move in chunks, each checked against its BLAKE3 hash, and the whole
+file is checked before it is put in place. An interrupted copy prints the
+command that resumes it from the last chunk confirmed.`,
+		Example: `  safeedge device cp ./app.conf 3f2b...:/var/lib/safeedge/files/app.conf
+  safeedge device cp 3f2b...:/var/lib/safeedge/files/core.1234 ./core.1234`,
+		Args: cobra.ExactArgs(2),
+		RunE: copyDeviceFile,
+	}
+	cpCmd.Flags().String("mode", "", "Permission bits of an uploaded file, in octal (default: the local file's)")
+	cpCmd.Flags().String("resume", "", "Resume the transfer with this ID")
+	return cpCmd
+}
+
+type fileTransfer struct {
+	ID          string `json:"id"`
+	DeviceID    string `json:"device_id"`
+	Direction   string `json:"direction"`
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	Blake3Hash  string `json:"blake3_hash"`
+	Mode        int32  `json:"mode"`
+	Transferred int64  `json:"transferred"`
+	State       string `json:"state"`
+}
+
+// parseRemote splits a <device-id>:<path> argument, reporting whether arg
+// is one
+func parseRemote(arg string) (string, string, bool) {
+	deviceID, name, ok := strings.Cut(arg, ":")
+	if !ok {
+		return "", "", false
+	}
+	if _, err := uuid.Parse(deviceID); err != nil {
+		return "", "", false
+	}
+	return deviceID, name, true
+}
+
+func copyDeviceFile(cmd *cobra.Command, args []string) error {
+	resumeID, _ := cmd.Flags().GetString("resume")
+	modeFlag, _ := cmd.Flags().GetString("mode")
+
+	srcDevice, srcPath, srcRemote := parseRemote(args[0])
+	dstDevice, dstPath, dstRemote := parseRemote(args[1])
+	if srcRemote == dstRemote {
+		return fmt.Errorf("exactly one of src and dst must be <device-id>:<path>")
+	}
+
+	client, _, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var t fileTransfer
+	if resumeID != "" {
+		if err := client.getJSON("/v1/transfers/"+url.PathEscape(resumeID), nil, &t); err != nil {
+			return err
+		}
+		if t.State != "IN_PROGRESS" {
+			return fmt.Errorf("transfer %s is %s", t.ID, t.State)
+		}
+	}
+
+	if dstRemote {
+		mode, err := uploadMode(modeFlag, args[0])
+		if err != nil {
+			return err
+		}
+		err = uploadFile(client, &t, args[0], dstDevice, dstPath, mode)
+		return transferError(err, t, args)
+	}
+
+	if info, err := os.Stat(dstPath); err == nil && info.IsDir() {
+		dstPath = filepath.Join(dstPath, path.Base(srcPath))
+	}
+	err = downloadFile(client, &t, srcDevice, srcPath, dstPath)
+	return transferError(err, t, args)
+}
+
+// uploadMode returns the permission bits an upload is created with
+func uploadMode(flag, local string) (int32, error) {
+	if flag != "" {
+		mode, err := strconv.ParseUint(flag, 8, 32)
+		if err != nil || mode&^0o777 != 0 {
+			return 0, fmt.Errorf("invalid --mode %q", flag)
+		}
+		return int32(mode), nil
+	}
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return int32(info.Mode().Perm()), nil
+}
+
+// transferError adds how to resume a transfer that failed after starting
+func transferError(err error, t fileTransfer, args []string) error {
+	if err == nil || t.ID == "" {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "resume with: safeedge device cp --resume %s %s %s\n", t.ID, args[0], args[1])
+	return err
+}
+
+func uploadFile(client *apiClient, t *fileTransfer, local, deviceID, remote string, mode int32) error {
+	file, err := os.Open(local)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", local)
+	}
+	hash, err := crypto.BLAKE3HashReader(file)
+	if err != nil {
+		return err
+	}
+
+	if t.ID == "" {
+		if err := client.postJSON("/v1/devices/"+url.PathEscape(deviceID)+"/transfers", map[string]any{
+			"direction":   "UPLOAD",
+			"path":        remote,
+			"size":        info.Size(),
+			"blake3_hash": hash,
+			"mode":        mode,
+		}, t); err != nil {
+			return err
+		}
+	} else if t.Direction != "UPLOAD" || t.DeviceID != deviceID || t.Path != remote {
+		return fmt.Errorf("transfer %s is not an upload to %s:%s", t.ID, deviceID, remote)
+	} else if t.Size != info.Size() || t.Blake3Hash != hash {
+		return fmt.Errorf("%s has changed since transfer %s started", local, t.ID)
+	}
+
+	transferPath := "/v1/transfers/" + url.PathEscape(t.ID)
+	data := make([]byte, transfer.ChunkSize)
+	for index := t.Transferred / transfer.ChunkSize; index < transfer.Chunks(t.Size); index++ {
+		offset, length, err := transfer.ChunkRange(t.Size, index)
+		if err != nil {
+			return err
+		}
+		chunk := data[:length]
+		if _, err := file.ReadAt(chunk, offset); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+
+		header := http.Header{}
+		header.Set(transfer.ChunkHashHeader, crypto.BLAKE3Hash(chunk))
+		if err := client.putBytes(transferPath+"/chunks/"+strconv.FormatInt(index, 10), chunk, header, t); err != nil {
+			return err
+		}
+		printProgress(t.Transferred, t.Size)
+	}
+
+	if err := client.postJSON(transferPath+"/complete", nil, t); err != nil {
+		return err
+	}
+	return printMessage(t, "copied %s to %s:%s (%d bytes)", local, deviceID, remote, t.Size)
+}
+
+func downloadFile(client *apiClient, t *fileTransfer, deviceID, remote, local string) error {
+	if t.ID == "" {
+		if err := client.postJSON("/v1/devices/"+url.PathEscape(deviceID)+"/transfers", map[string]any{
+			"direction": "DOWNLOAD",
+			"path":      remote,
+		}, t); err != nil {
+			return err
+		}
+	} else if t.Direction != "DOWNLOAD" || t.DeviceID != deviceID || t.Path != remote {
+		return fmt.Errorf("transfer %s is not a download from %s:%s", t.ID, deviceID, remote)
+	}
+
+	// Chunks are kept beside the destination until the whole file checks
+	// out; a resumed transfer carries on from the last whole chunk
+	partial := local + ".part"
+	flags := os.O_CREATE | os.O_RDWR
+	if t.Transferred == 0 {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(partial, flags, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open partial file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat partial file: %w", err)
+	}
+	start := min(info.Size(), t.Size) / transfer.ChunkSize
+	if err := file.Truncate(start * transfer.ChunkSize); err != nil {
+		return fmt.Errorf("failed to truncate partial file: %w", err)
+	}
+
+	transferPath := "/v1/transfers/" + url.PathEscape(t.ID)
+	for index := start; index < transfer.Chunks(t.Size); index++ {
+		offset, length, err := transfer.ChunkRange(t.Size, index)
+		if err != nil {
+			return err
+		}
+		data, header, err := client.getBytes(transferPath+"/chunks/"+strconv.FormatInt(index, 10), transfer.ChunkSize)
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) != length || !crypto.VerifyBLAKE3(data, header.Get(transfer.ChunkHashHeader)) {
+			return fmt.Errorf("chunk %d does not match its hash", index)
+		}
+		if _, err := file.WriteAt(data, offset); err != nil {
+			return fmt.Errorf("failed to write partial file: %w", err)
+		}
+		printProgress(offset+length, t.Size)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind partial file: %w", err)
+	}
+	hash, err := crypto.BLAKE3HashReader(file)
+	if err != nil {
+		return err
+	}
+	if hash != t.Blake3Hash {
+		os.Remove(partial)
+		return fmt.Errorf("file does not match its hash; it may have changed on the device")
+	}
+	if t.Mode != 0 {
+		if err := file.Chmod(os.FileMode(t.Mode).Perm()); err != nil {
+			return fmt.Errorf("failed to set file mode: %w", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close partial file: %w", err)
+	}
+	if err := os.Rename(partial, local); err != nil {
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	if err := client.postJSON("/v1/transfers/"+url.PathEscape(t.ID)+"/complete", nil, t); err != nil {
+		return err
+	}
+	return printMessage(t, "copied %s:%s to %s (%d bytes)", deviceID, remote, local, t.Size)
+}
+
+// printProgress reports a transfer's progress on a terminal's stderr
+func printProgress(done, size int64) {
+	if outputFormat != "table" || size == 0 {
+		return
+	}
+	if info, err := os.Stderr.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r%d/%d bytes (%d%%)", done, size, done*100/size)
+	if done == size {
+		fmt.Fprintln(os.Stderr)
+	}
+}
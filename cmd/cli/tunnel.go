@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/netstack"
+
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+// tunnelMTU leaves room for WireGuard's overhead on a 1500 byte path
+const tunnelMTU = 1420
+
+// wireGuardConfig is the part of a wg-quick style configuration the CLI
+// needs to join the overlay as a single-peer client
+type wireGuardConfig struct {
+	Address             netip.Prefix
+	PeerPublicKey       string
+	Endpoint            string
+	AllowedIPs          []netip.Prefix
+	PersistentKeepalive int
+}
+
+// parseWireGuardConfig parses the configuration the control plane returns for
+// an access session
+func parseWireGuardConfig(text string) (*wireGuardConfig, error) {
+	cfg := &wireGuardConfig{}
+	section := ""
+
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[]"))
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid WireGuard config line %q", line)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		var err error
+		switch section + "." + key {
+		case "interface.address":
+			cfg.Address, err = netip.ParsePrefix(value)
+		case "peer.publickey":
+			cfg.PeerPublicKey = value
+		case "peer.endpoint":
+			cfg.Endpoint = value
+		case "peer.allowedips":
+			for _, s := range strings.Split(value, ",") {
+				var prefix netip.Prefix
+				if prefix, err = netip.ParsePrefix(strings.TrimSpace(s)); err != nil {
+					break
+				}
+				cfg.AllowedIPs = append(cfg.AllowedIPs, prefix)
+			}
+		case "peer.persistentkeepalive":
+			cfg.PersistentKeepalive, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid WireGuard config %s: %w", key, err)
+		}
+	}
+
+	if !cfg.Address.IsValid() || cfg.PeerPublicKey == "" || cfg.Endpoint == "" || len(cfg.AllowedIPs) == 0 {
+		return nil, fmt.Errorf("WireGuard config needs an interface address and a peer with a public key, endpoint and allowed IPs")
+	}
+
+	return cfg, nil
+}
+
+// overlayTunnel is an ephemeral WireGuard interface running entirely in the
+// CLI process, with its own TCP/IP stack, so joining the overlay needs
+// neither root nor a kernel interface
+type overlayTunnel struct {
+	dev *device.Device
+	net *netstack.Net
+}
+
+// startTunnel brings up a userspace interface with keys and cfg
+func startTunnel(keys *crypto.WireGuardKeyPair, cfg *wireGuardConfig) (*overlayTunnel, error) {
+	peerKey, err := crypto.ParseWireGuardPublicKey(cfg.PeerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := net.ResolveUDPAddr("udp", cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve WireGuard endpoint %s: %w", cfg.Endpoint, err)
+	}
+	// Send IPv4 endpoints from the IPv4 socket rather than as mapped addresses
+	endpoint := netip.AddrPortFrom(resolved.AddrPort().Addr().Unmap(), resolved.AddrPort().Port())
+
+	tunDev, tnet, err := netstack.CreateNetTUN([]netip.Addr{cfg.Address.Addr()}, nil, tunnelMTU)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create userspace interface: %w", err)
+	}
+
+	// device.NewLogger writes to stdout, which carries the SSH stream in
+	// --stdio mode
+	logger := &device.Logger{
+		Verbosef: device.DiscardLogf,
+		Errorf: func(format string, args ...any) {
+			fmt.Fprintf(os.Stderr, "wireguard: "+format+"\n", args...)
+		},
+	}
+	dev := device.NewDevice(tunDev, conn.NewDefaultBind(), logger)
+
+	var ipc strings.Builder
+	fmt.Fprintf(&ipc, "private_key=%s\n", hex.EncodeToString(keys.PrivateKey[:]))
+	fmt.Fprintf(&ipc, "public_key=%s\n", hex.EncodeToString(peerKey[:]))
+	fmt.Fprintf(&ipc, "endpoint=%s\n", endpoint)
+	fmt.Fprintf(&ipc, "persistent_keepalive_interval=%d\n", cfg.PersistentKeepalive)
+	for _, prefix := range cfg.AllowedIPs {
+		fmt.Fprintf(&ipc, "allowed_ip=%s\n", prefix)
+	}
+
+	if err := dev.IpcSet(ipc.String()); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("failed to configure userspace interface: %w", err)
+	}
+	if err := dev.Up(); err != nil {
+		dev.Close()
+		return nil, fmt.Errorf("failed to bring up userspace interface: %w", err)
+	}
+
+	return &overlayTunnel{dev: dev, net: tnet}, nil
+}
+
+// dial opens a TCP connection to an overlay address through the tunnel
+func (t *overlayTunnel) dial(ctx context.Context, address string) (net.Conn, error) {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return nil, err
+	}
+	return t.net.DialContextTCPAddrPort(ctx, addrPort)
+}
+
+// close tears the interface down
+func (t *overlayTunnel) close() {
+	t.dev.Close()
+}
@@ -0,0 +1,337 @@
+package access
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/agent/policy"
+	"github.com/netf/safeedge/pkg/forward"
+)
+
+const (
+	dialTimeout      = 10 * time.Second
+	handshakeTimeout = 10 * time.Second
+)
+
+var (
+	errNoGrant            = errors.New("no active access session")
+	errWrongClient        = errors.New("access session belongs to another client")
+	errDestinationBlocked = errors.New("destination not allowed by the access session")
+)
+
+// Grant is an access session the control plane allows to forward
+// connections through this device
+type Grant struct {
+	SessionID           string
+	ClientIP            netip.Addr
+	AllowedDestinations []string
+	ExpiresAt           time.Time
+}
+
+// Forwarder accepts connections from access session clients on the overlay
+// network and relays them to destinations on, or reachable from, the device.
+// A connection is only relayed if its session has an unexpired grant, it
+// comes from the session's client address and the destination is on the
+// session's allowlist and permitted by the device policy.
+type Forwarder struct {
+	policy *policy.Enforcer
+	logger *zap.Logger
+
+	mu     sync.Mutex
+	grants map[string]grant
+	// conns are the relayed connections of each session, closed on revocation
+	conns map[string]map[io.Closer]struct{}
+
+	// forwards and tunnels count the connections being relayed, bytesIn and
+	// bytesOut what they carried to and from destinations
+	forwards atomic.Int64
+	tunnels  atomic.Int64
+	bytesIn  atomic.Uint64
+	bytesOut atomic.Uint64
+}
+
+type grant struct {
+	clientIP     netip.Addr
+	destinations map[string]bool
+	expiresAt    time.Time
+}
+
+// NewForwarder creates a forwarder with no grants
+func NewForwarder(policy *policy.Enforcer, logger *zap.Logger) *Forwarder {
+	return &Forwarder{
+		policy: policy,
+		logger: logger,
+		grants: make(map[string]grant),
+		conns:  make(map[string]map[io.Closer]struct{}),
+	}
+}
+
+// Grant allows, or updates, an access session
+func (f *Forwarder) Grant(g Grant) {
+	destinations := make(map[string]bool, len(g.AllowedDestinations))
+	for _, dest := range g.AllowedDestinations {
+		destinations[forward.NormalizeDestination(dest)] = true
+	}
+
+	f.mu.Lock()
+	f.grants[g.SessionID] = grant{
+		clientIP:     g.ClientIP.Unmap(),
+		destinations: destinations,
+		expiresAt:    g.ExpiresAt,
+	}
+	f.mu.Unlock()
+
+	f.logger.Info("access session granted",
+		zap.String("session_id", g.SessionID),
+		zap.String("client_ip", g.ClientIP.String()),
+		zap.Strings("destinations", g.AllowedDestinations),
+		zap.Time("expires_at", g.ExpiresAt),
+	)
+}
+
+// Revoke removes an access session's grant and closes its connections
+func (f *Forwarder) Revoke(sessionID string) {
+	f.mu.Lock()
+	_, granted := f.grants[sessionID]
+	delete(f.grants, sessionID)
+	conns := f.conns[sessionID]
+	delete(f.conns, sessionID)
+	f.mu.Unlock()
+
+	for conn := range conns {
+		conn.Close()
+	}
+
+	if granted {
+		f.logger.Info("access session revoked", zap.String("session_id", sessionID))
+	}
+}
+
+// RevokeAll removes every grant, for when the stream to the control plane
+// fails and revocations can no longer arrive. The agent reconnects, and the
+// control plane then sends the grants of sessions still active again.
+func (f *Forwarder) RevokeAll() {
+	f.mu.Lock()
+	ids := make([]string, 0, len(f.grants))
+	for id := range f.grants {
+		ids = append(ids, id)
+	}
+	f.mu.Unlock()
+
+	for _, id := range ids {
+		f.Revoke(id)
+	}
+}
+
+// Serve accepts forwarded connections on listener until ctx is cancelled
+func (f *Forwarder) Serve(ctx context.Context, listener net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+		go f.handle(ctx, conn)
+	}
+}
+
+// handle authorizes a forwarded connection and relays it
+func (f *Forwarder) handle(ctx context.Context, client net.Conn) {
+	defer client.Close()
+
+	client.SetDeadline(time.Now().Add(handshakeTimeout))
+	reader := bufio.NewReader(client)
+
+	sessionID, dest, err := forward.ReadRequest(reader)
+	if err != nil {
+		f.logger.Warn("invalid forward request",
+			zap.String("remote_addr", client.RemoteAddr().String()),
+			zap.Error(err),
+		)
+		return
+	}
+
+	logger := f.logger.With(
+		zap.String("session_id", sessionID),
+		zap.String("destination", dest),
+		zap.String("remote_addr", client.RemoteAddr().String()),
+	)
+
+	if err := f.authorize(sessionID, remoteIP(client), dest); err != nil {
+		logger.Warn("forward refused", zap.Error(err))
+		forward.WriteResponse(client, err)
+		return
+	}
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	target, err := dialer.DialContext(ctx, "tcp", dest)
+	if err != nil {
+		logger.Warn("failed to connect to forward destination", zap.Error(err))
+		forward.WriteResponse(client, fmt.Errorf("failed to connect to %s", dest))
+		return
+	}
+	defer target.Close()
+
+	if err := forward.WriteResponse(client, nil); err != nil {
+		return
+	}
+	client.SetDeadline(time.Time{})
+
+	// Revoking the session closes both ends
+	if !f.track(sessionID, client, target) {
+		return
+	}
+	defer f.untrack(sessionID, client, target)
+
+	logger.Info("forwarding connection")
+	f.forwards.Add(1)
+	defer f.forwards.Add(-1)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// The client may have sent data behind its request
+		io.Copy(&countingWriter{w: target, n: &f.bytesIn}, reader)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(&countingWriter{w: client, n: &f.bytesOut}, target)
+		done <- struct{}{}
+	}()
+	<-done
+
+	logger.Info("forwarded connection closed")
+}
+
+// Stats counts the forwarder's access sessions and the connections relayed
+// for them
+type Stats struct {
+	// Sessions are the unexpired access sessions granted
+	Sessions int `json:"sessions"`
+	// Forwards are the connections being forwarded from the overlay network
+	Forwards int64 `json:"forwards"`
+	// Tunnels are the connections being relayed over Tunnel streams
+	Tunnels int64 `json:"tunnels"`
+	// BytesIn and BytesOut are what relayed connections carried to and from
+	// their destinations since the agent started
+	BytesIn  uint64 `json:"bytes_in"`
+	BytesOut uint64 `json:"bytes_out"`
+}
+
+// Stats returns the forwarder's current counts
+func (f *Forwarder) Stats() Stats {
+	now := time.Now()
+	f.mu.Lock()
+	sessions := 0
+	for _, g := range f.grants {
+		if now.Before(g.expiresAt) {
+			sessions++
+		}
+	}
+	f.mu.Unlock()
+
+	return Stats{
+		Sessions: sessions,
+		Forwards: f.forwards.Load(),
+		Tunnels:  f.tunnels.Load(),
+		BytesIn:  f.bytesIn.Load(),
+		BytesOut: f.bytesOut.Load(),
+	}
+}
+
+// authorize checks a forward request against the session's grant
+func (f *Forwarder) authorize(sessionID string, clientIP netip.Addr, dest string) error {
+	g, err := f.lookup(sessionID, dest)
+	if err != nil {
+		return err
+	}
+	if g.clientIP != clientIP {
+		return errWrongClient
+	}
+	return nil
+}
+
+// lookup returns a session's grant if it is unexpired and allows dest, and
+// the device policy allows dest too
+func (f *Forwarder) lookup(sessionID, dest string) (grant, error) {
+	f.mu.Lock()
+	g, ok := f.grants[sessionID]
+	f.mu.Unlock()
+
+	if !ok || time.Now().After(g.expiresAt) {
+		return grant{}, errNoGrant
+	}
+	if !g.destinations[forward.NormalizeDestination(dest)] {
+		return grant{}, errDestinationBlocked
+	}
+	if err := f.policy.CheckDestination(sessionID, dest); err != nil {
+		return grant{}, err
+	}
+	return g, nil
+}
+
+// track records a session's relayed connection, unless it has been revoked
+func (f *Forwarder) track(sessionID string, conns ...io.Closer) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.grants[sessionID]; !ok {
+		return false
+	}
+	if f.conns[sessionID] == nil {
+		f.conns[sessionID] = make(map[io.Closer]struct{})
+	}
+	for _, conn := range conns {
+		f.conns[sessionID][conn] = struct{}{}
+	}
+	return true
+}
+
+func (f *Forwarder) untrack(sessionID string, conns ...io.Closer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, conn := range conns {
+		delete(f.conns[sessionID], conn)
+	}
+	if len(f.conns[sessionID]) == 0 {
+		delete(f.conns, sessionID)
+	}
+}
+
+// countingWriter adds the bytes written through it to n
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Uint64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(uint64(n))
+	return n, err
+}
+
+// remoteIP is the address a connection comes from
+func remoteIP(conn net.Conn) netip.Addr {
+	addr, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Addr().Unmap()
+}
@@ -0,0 +1,148 @@
+package access
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+)
+
+const (
+	// tunnelFrameSize is the most data sent in one frame
+	tunnelFrameSize = 32 * 1024
+	// tunnelDrainTimeout bounds how long a tunnel waits, after its side is
+	// done, for the control plane to end the call
+	tunnelDrainTimeout = 10 * time.Second
+)
+
+// TunnelDialer opens a Tunnel stream to the control plane
+type TunnelDialer func(ctx context.Context) (pb.DeviceService_TunnelClient, error)
+
+// tunnelCloser ends a tunnel when its session is revoked
+type tunnelCloser struct {
+	cancel context.CancelFunc
+}
+
+func (c *tunnelCloser) Close() error {
+	c.cancel()
+	return nil
+}
+
+// ServeTunnel connects to the destination of a TunnelOpen and relays the
+// connection over a new Tunnel stream. It is checked against the session's
+// grant like a forwarded connection, except for the client address: the
+// client reached the control plane rather than the overlay network.
+func (f *Forwarder) ServeTunnel(ctx context.Context, open *pb.TunnelOpen, dial TunnelDialer) {
+	logger := f.logger.With(
+		zap.String("session_id", open.SessionId),
+		zap.String("destination", open.Destination),
+		zap.String("stream_id", open.StreamId),
+	)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := dial(ctx)
+	if err != nil {
+		logger.Error("failed to open tunnel stream", zap.Error(err))
+		return
+	}
+
+	var target net.Conn
+	if _, err = f.lookup(open.SessionId, open.Destination); err != nil {
+		logger.Warn("tunnel refused", zap.Error(err))
+	} else {
+		dialer := net.Dialer{Timeout: dialTimeout}
+		target, err = dialer.DialContext(ctx, "tcp", open.Destination)
+		if err != nil {
+			logger.Warn("failed to connect to tunnel destination", zap.Error(err))
+			err = fmt.Errorf("failed to connect to %s", open.Destination)
+		}
+	}
+
+	first := &pb.TunnelFrame{StreamId: open.StreamId}
+	if err != nil {
+		first.Error = err.Error()
+	}
+	if sendErr := stream.Send(first); sendErr != nil || err != nil {
+		if target != nil {
+			target.Close()
+		}
+		drainTunnel(stream, cancel)
+		return
+	}
+	defer target.Close()
+
+	// Revoking the session ends the tunnel
+	closer := &tunnelCloser{cancel: cancel}
+	if !f.track(open.SessionId, target, closer) {
+		return
+	}
+	defer f.untrack(open.SessionId, target, closer)
+
+	logger.Info("relaying tunnel")
+	f.tunnels.Add(1)
+	defer f.tunnels.Add(-1)
+
+	// Control plane to destination, until the control plane ends the call
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		defer target.Close()
+		for {
+			frame, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			n, err := target.Write(frame.Data)
+			f.bytesIn.Add(uint64(n))
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// Destination to control plane, until the destination closes
+	buf := make([]byte, tunnelFrameSize)
+	for {
+		n, err := target.Read(buf)
+		if n > 0 {
+			if sendErr := stream.Send(&pb.TunnelFrame{Data: bytes.Clone(buf[:n])}); sendErr != nil {
+				break
+			}
+			f.bytesOut.Add(uint64(n))
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	// Closing our side tells the control plane everything has been sent
+	stream.CloseSend()
+	select {
+	case <-received:
+	case <-time.After(tunnelDrainTimeout):
+	}
+
+	logger.Info("tunnel closed")
+}
+
+// drainTunnel closes the agent's side of a tunnel stream that carries no
+// data and waits for the control plane to end the call, so it receives what
+// was sent before
+func drainTunnel(stream pb.DeviceService_TunnelClient, cancel context.CancelFunc) {
+	stream.CloseSend()
+	timer := time.AfterFunc(tunnelDrainTimeout, cancel)
+	defer timer.Stop()
+
+	for {
+		if _, err := stream.Recv(); err != nil {
+			return
+		}
+	}
+}
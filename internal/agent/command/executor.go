@@ -0,0 +1,219 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/agent/policy"
+	"github.com/netf/safeedge/pkg/command"
+)
+
+const (
+	// waitDelay bounds how long a killed command's output may keep flowing,
+	// e.g. from children that inherited its stdout
+	waitDelay = 5 * time.Second
+
+	commandPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+// Sender sends messages to the control plane
+type Sender interface {
+	Send(msg *pb.DeviceMessage) error
+}
+
+// Executor runs commands the control plane requests. Only commands on the
+// allowlist and executables directly in the script directory are run, and
+// only if the device policy permits them. They run with their arguments
+// passed as-is rather than through a shell, a clean environment and a
+// timeout. Their output is streamed back in chunks, followed by a result.
+type Executor struct {
+	sender    Sender
+	policy    *policy.Enforcer
+	allowed   map[string]string
+	scriptDir string
+	logger    *zap.Logger
+}
+
+// NewExecutor creates an executor for the allowlisted commands, given by
+// name or absolute path, and the scripts in scriptDir. Allowlist entries
+// that cannot be found are skipped.
+func NewExecutor(sender Sender, policy *policy.Enforcer, allowlist []string, scriptDir string, logger *zap.Logger) *Executor {
+	allowed := make(map[string]string, len(allowlist))
+	for _, entry := range allowlist {
+		path, err := exec.LookPath(entry)
+		if err != nil {
+			logger.Warn("allowlisted command not found", zap.String("command", entry), zap.Error(err))
+			continue
+		}
+		allowed[filepath.Base(entry)] = path
+	}
+
+	return &Executor{
+		sender:    sender,
+		policy:    policy,
+		allowed:   allowed,
+		scriptDir: scriptDir,
+		logger:    logger,
+	}
+}
+
+// resolve returns the executable to run for a command name
+func (e *Executor) resolve(name string) (string, error) {
+	if err := command.ValidateName(name); err != nil {
+		return "", err
+	}
+	if path, ok := e.allowed[name]; ok {
+		return path, nil
+	}
+
+	if e.scriptDir != "" {
+		path := filepath.Join(e.scriptDir, name)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0o111 != 0 {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("command %q is not allowed", name)
+}
+
+// Run runs a command and reports its output and result
+func (e *Executor) Run(ctx context.Context, req *pb.CommandRequest) {
+	logger := e.logger.With(zap.String("command_id", req.CommandId), zap.String("command", req.Command))
+
+	result := e.run(ctx, req, logger)
+	if result.Error != "" {
+		logger.Warn("command failed", zap.String("error", result.Error))
+	} else {
+		logger.Info("command completed", zap.Int32("exit_code", result.ExitCode), zap.Bool("timed_out", result.TimedOut))
+	}
+
+	if err := e.sender.Send(&pb.DeviceMessage{
+		Payload: &pb.DeviceMessage_CommandResult{CommandResult: result},
+	}); err != nil {
+		logger.Error("failed to send command result", zap.Error(err))
+	}
+}
+
+func (e *Executor) run(ctx context.Context, req *pb.CommandRequest, logger *zap.Logger) *pb.CommandResult {
+	result := &pb.CommandResult{CommandId: req.CommandId, ExitCode: -1}
+
+	if err := command.Validate(req.Command, req.Args); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := e.policy.CheckCommand(req.CommandId, req.Command); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	path, err := e.resolve(req.Command)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = command.DefaultTimeout
+	}
+	if timeout > command.MaxTimeout {
+		timeout = command.MaxTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	logger.Info("running command", zap.String("path", path), zap.Strings("args", req.Args), zap.Duration("timeout", timeout))
+
+	out := &output{sender: e.sender, commandID: req.CommandId, logger: logger}
+	cmd := exec.CommandContext(ctx, path, req.Args...)
+	cmd.Env = []string{"PATH=" + commandPath, "LANG=C"}
+	cmd.Dir = "/"
+	cmd.Stdout = out.stream(pb.CommandStream_COMMAND_STREAM_STDOUT)
+	cmd.Stderr = out.stream(pb.CommandStream_COMMAND_STREAM_STDERR)
+	cmd.WaitDelay = waitDelay
+
+	err = cmd.Run()
+	result.OutputTruncated = out.truncated()
+	if cmd.ProcessState != nil {
+		result.ExitCode = int32(cmd.ProcessState.ExitCode())
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.TimedOut = true
+		return result
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// output sends a command's stdout and stderr to the control plane, up to
+// command.MaxOutput bytes over both
+type output struct {
+	sender    Sender
+	commandID string
+	logger    *zap.Logger
+
+	mu      sync.Mutex
+	sent    int
+	dropped bool
+}
+
+func (o *output) stream(stream pb.CommandStream) *streamWriter {
+	return &streamWriter{output: o, stream: stream}
+}
+
+func (o *output) truncated() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.dropped
+}
+
+func (o *output) write(stream pb.CommandStream, p []byte) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if remaining := command.MaxOutput - o.sent; len(p) > remaining {
+		p = p[:remaining]
+		o.dropped = true
+	}
+	if len(p) == 0 {
+		return
+	}
+	o.sent += len(p)
+
+	data := make([]byte, len(p))
+	copy(data, p)
+	if err := o.sender.Send(&pb.DeviceMessage{
+		Payload: &pb.DeviceMessage_CommandOutput{CommandOutput: &pb.CommandOutput{
+			CommandId: o.commandID,
+			Stream:    stream,
+			Data:      data,
+		}},
+	}); err != nil {
+		o.logger.Error("failed to send command output", zap.Error(err))
+	}
+}
+
+// streamWriter writes one of a command's output streams. Output past the
+// limit is discarded rather than failing the command.
+type streamWriter struct {
+	output *output
+	stream pb.CommandStream
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.output.write(w.stream, p)
+	return len(p), nil
+}
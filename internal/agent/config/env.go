@@ -0,0 +1,257 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/netf/safeedge/internal/agent/policy"
+	"github.com/netf/safeedge/pkg/transfer"
+)
+
+// DefaultEnvDir is where environment files may be written unless configured
+// otherwise
+const DefaultEnvDir = "/etc/safeedge/env"
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// EnvFiles is the "env" plugin. Its section maps the paths of environment
+// files, as read by systemd's EnvironmentFile or a shell, to their
+// variables; each file is written to hold exactly those, one NAME=value per
+// line. Files must lie below one of its directories, with symlinks
+// resolved, and be allowed by the device policy.
+type EnvFiles struct {
+	policy *policy.Enforcer
+	dirs   []string
+}
+
+// NewEnvFiles creates the env plugin for files below dirs
+func NewEnvFiles(policy *policy.Enforcer, dirs []string) *EnvFiles {
+	cleaned := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if filepath.IsAbs(dir) {
+			cleaned = append(cleaned, filepath.Clean(dir))
+		}
+	}
+	return &EnvFiles{policy: policy, dirs: cleaned}
+}
+
+func (e *EnvFiles) Apply(ctx context.Context, section map[string]any) error {
+	var errs []error
+	for _, name := range sortedKeys(section) {
+		if err := e.write(name, section[name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (e *EnvFiles) Observe(ctx context.Context, section map[string]any) (map[string]any, error) {
+	state := make(map[string]any, len(section))
+	var errs []error
+	for _, name := range sortedKeys(section) {
+		resolved, err := e.resolve(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		data, err := os.ReadFile(resolved)
+		if errors.Is(err, fs.ErrNotExist) {
+			state[name] = nil
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		state[name] = parseEnv(data)
+	}
+	return state, errors.Join(errs...)
+}
+
+// write replaces an environment file with vars, unless it already holds them
+func (e *EnvFiles) write(name string, vars any) error {
+	values, ok := vars.(map[string]any)
+	if !ok {
+		return fmt.Errorf("must be an object of variables")
+	}
+	content, err := formatEnv(values)
+	if err != nil {
+		return err
+	}
+
+	resolved, err := e.resolve(name)
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(resolved); err == nil {
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("not a regular file")
+		}
+		mode = info.Mode().Perm()
+		if existing, err := os.ReadFile(resolved); err == nil && bytes.Equal(existing, content) {
+			return nil
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(resolved), "."+filepath.Base(resolved)+".safeedge-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), resolved); err != nil {
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+	return nil
+}
+
+// resolve returns an environment file's path with symlinks resolved,
+// checking it lies below one of the plugin's directories and the device
+// policy permits it
+func (e *EnvFiles) resolve(name string) (string, error) {
+	if err := transfer.ValidatePath(name); err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		dir, dirErr := filepath.EvalSymlinks(filepath.Dir(name))
+		if dirErr != nil {
+			return "", fmt.Errorf("failed to resolve path: %w", dirErr)
+		}
+		resolved, err = filepath.Join(dir, filepath.Base(name)), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	within := false
+	for _, dir := range e.dirs {
+		if d, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = d
+		}
+		if strings.HasPrefix(resolved, strings.TrimSuffix(dir, "/")+"/") {
+			within = true
+			break
+		}
+	}
+	if !within {
+		return "", fmt.Errorf("%s is not in an env directory", resolved)
+	}
+	if err := e.policy.CheckPath("config", resolved); err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+// formatEnv renders variables as sorted NAME=value lines. Values that need
+// it are single-quoted as POSIX shell words, which systemd reads the same
+// way, so a shell sourcing the file expands and runs nothing in them.
+func formatEnv(vars map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, name := range sortedKeys(vars) {
+		if !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid variable name %q", name)
+		}
+		value, ok := vars[name].(string)
+		if !ok {
+			return nil, fmt.Errorf("variable %s must be a string", name)
+		}
+		if strings.ContainsAny(value, "\n\r\x00") {
+			return nil, fmt.Errorf("variable %s must not contain line breaks or NUL", name)
+		}
+		fmt.Fprintf(&buf, "%s=%s\n", name, shellQuote(value))
+	}
+	return buf.Bytes(), nil
+}
+
+// parseEnv reads the variables of an environment file, skipping comments
+// and lines it does not understand
+func parseEnv(data []byte) map[string]any {
+	vars := map[string]any{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok || !envNamePattern.MatchString(name) {
+			continue
+		}
+		vars[name] = shellUnquote(value)
+	}
+	return vars
+}
+
+// shellQuote quotes s as a single POSIX shell word
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@,+%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellUnquote reads a value written as a POSIX shell word: single-quoted
+// text is literal, a backslash escapes the next character outside quotes
+// and, before one of $`"\, inside double quotes
+func shellUnquote(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				end = len(s) - i - 1
+			}
+			b.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case '"':
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\", s[i+1]) >= 0 {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
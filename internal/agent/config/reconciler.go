@@ -0,0 +1,162 @@
+// Package config applies the desired configuration the control plane sends
+// the agent and reports the device's effective configuration back. Each
+// section of the configuration is handled by the plugin its key names.
+package config
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/pkg/devconfig"
+)
+
+// DefaultInterval is how often the effective configuration is reported
+// unless configured otherwise
+const DefaultInterval = 5 * time.Minute
+
+// Sender sends messages to the control plane
+type Sender interface {
+	Send(msg *pb.DeviceMessage) error
+}
+
+// Plugin applies a section of the desired configuration
+type Plugin interface {
+	// Apply brings what the section describes to its desired state
+	Apply(ctx context.Context, section map[string]any) error
+	// Observe returns the effective state of what the section describes, in
+	// the section's shape, without changing it
+	Observe(ctx context.Context, section map[string]any) (map[string]any, error)
+}
+
+// Reconciler applies desired configurations and reports the effective
+// configuration after each, and periodically so that drift shows. Settings
+// that drift are applied again with the next desired configuration, when
+// the agent reconnects or an operator changes it.
+type Reconciler struct {
+	sender  Sender
+	plugins map[string]Plugin
+	logger  *zap.Logger
+
+	// mu serializes applying and observing
+	mu       sync.Mutex
+	received bool
+	desired  devconfig.Document
+	hash     string
+}
+
+// NewReconciler creates a reconciler applying sections with plugins, by
+// section name
+func NewReconciler(sender Sender, plugins map[string]Plugin, logger *zap.Logger) *Reconciler {
+	return &Reconciler{
+		sender:  sender,
+		plugins: plugins,
+		logger:  logger,
+	}
+}
+
+// Handle applies a desired configuration the agent does not have yet and
+// reports the result
+func (r *Reconciler) Handle(ctx context.Context, update *pb.ConfigUpdate) {
+	desired, err := devconfig.Parse(update.Document)
+	if err != nil {
+		r.logger.Error("invalid desired config", zap.Error(err))
+		return
+	}
+	if devconfig.Hash(desired) != update.Hash {
+		r.logger.Error("desired config does not match its hash")
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.received && r.hash == update.Hash {
+		return
+	}
+	r.received, r.desired, r.hash = true, desired, update.Hash
+
+	r.logger.Info("applying desired config", zap.String("hash", update.Hash))
+	r.report(ctx, true)
+}
+
+// Run reports the effective configuration every interval until ctx is
+// cancelled
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.mu.Lock()
+			if r.received {
+				r.report(ctx, false)
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// report observes each desired section, first applying it if apply is set,
+// and sends the result. r.mu must be held.
+func (r *Reconciler) report(ctx context.Context, apply bool) {
+	names := make([]string, 0, len(r.desired))
+	for name := range r.desired {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	reported := devconfig.Document{}
+	var errs []*pb.ConfigError
+	for _, name := range names {
+		section, _ := r.desired[name].(map[string]any)
+		plugin, ok := r.plugins[name]
+		if !ok {
+			errs = append(errs, &pb.ConfigError{Section: name, Message: "no plugin handles this section"})
+			continue
+		}
+
+		var applyErr error
+		if apply {
+			applyErr = plugin.Apply(ctx, section)
+			if applyErr != nil {
+				r.logger.Warn("failed to apply config section", zap.String("section", name), zap.Error(applyErr))
+				errs = append(errs, &pb.ConfigError{Section: name, Message: applyErr.Error()})
+			}
+		}
+
+		state, err := plugin.Observe(ctx, section)
+		if err != nil {
+			if applyErr == nil {
+				errs = append(errs, &pb.ConfigError{Section: name, Message: err.Error()})
+			}
+			continue
+		}
+		reported[name] = state
+	}
+
+	drift := devconfig.Diff(r.desired, reported)
+	if len(drift) > 0 && !apply {
+		r.logger.Warn("effective config differs from desired config", zap.Int("settings", len(drift)))
+	}
+
+	if err := r.sender.Send(&pb.DeviceMessage{
+		Payload: &pb.DeviceMessage_ConfigReport{
+			ConfigReport: &pb.ConfigReport{
+				DesiredHash: r.hash,
+				Reported:    devconfig.Encode(reported),
+				Errors:      errs,
+				Drifted:     len(drift) > 0,
+			},
+		},
+	}); err != nil {
+		r.logger.Error("failed to send config report", zap.Error(err))
+	}
+}
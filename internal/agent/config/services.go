@@ -0,0 +1,143 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// systemctlTimeout bounds each systemctl invocation
+const systemctlTimeout = 30 * time.Second
+
+var unitPattern = regexp.MustCompile(`^[A-Za-z0-9:_.@\\-]+$`)
+
+// Services is the "services" plugin. Its section maps systemd units to
+// whether each should be "enabled" at boot and "active" now; either may be
+// left out. Only units on its allowlist are managed.
+type Services struct {
+	allowed []string
+}
+
+// NewServices creates the services plugin for the allowlisted units
+func NewServices(allowed []string) *Services {
+	return &Services{allowed: allowed}
+}
+
+func (s *Services) Apply(ctx context.Context, section map[string]any) error {
+	var errs []error
+	for _, unit := range sortedKeys(section) {
+		if err := s.apply(ctx, unit, section[unit]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", unit, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Services) Observe(ctx context.Context, section map[string]any) (map[string]any, error) {
+	state := make(map[string]any, len(section))
+	var errs []error
+	for _, unit := range sortedKeys(section) {
+		if err := s.check(unit); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", unit, err))
+			continue
+		}
+		enabled, active, err := observeUnit(ctx, unit)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", unit, err))
+			continue
+		}
+		state[unit] = map[string]any{"enabled": enabled, "active": active}
+	}
+	return state, errors.Join(errs...)
+}
+
+func (s *Services) apply(ctx context.Context, unit string, settings any) error {
+	if err := s.check(unit); err != nil {
+		return err
+	}
+	desired, ok := settings.(map[string]any)
+	if !ok {
+		return fmt.Errorf("must be an object of settings")
+	}
+	for key, value := range desired {
+		if key != "enabled" && key != "active" {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be true or false", key)
+		}
+	}
+
+	enabled, active, err := observeUnit(ctx, unit)
+	if err != nil {
+		return err
+	}
+	if want, ok := desired["enabled"].(bool); ok && want != enabled {
+		verb := "disable"
+		if want {
+			verb = "enable"
+		}
+		if err := systemctl(ctx, verb, unit); err != nil {
+			return err
+		}
+	}
+	if want, ok := desired["active"].(bool); ok && want != active {
+		verb := "stop"
+		if want {
+			verb = "start"
+		}
+		if err := systemctl(ctx, verb, unit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Services) check(unit string) error {
+	if !unitPattern.MatchString(unit) || strings.HasPrefix(unit, "-") {
+		return fmt.Errorf("invalid unit name")
+	}
+	if !slices.Contains(s.allowed, unit) {
+		return fmt.Errorf("unit is not on the agent's service allowlist")
+	}
+	return nil
+}
+
+// observeUnit reports whether a unit is enabled and active
+func observeUnit(ctx context.Context, unit string) (bool, bool, error) {
+	// is-enabled and is-active exit non-zero for a negative answer, which
+	// they print all the same
+	enabled, err := systemctlOutput(ctx, "is-enabled", unit)
+	if enabled == "" {
+		return false, false, fmt.Errorf("failed to check whether unit is enabled: %w", err)
+	}
+	active, err := systemctlOutput(ctx, "is-active", unit)
+	if active == "" {
+		return false, false, fmt.Errorf("failed to check whether unit is active: %w", err)
+	}
+	return enabled == "enabled", active == "active", nil
+}
+
+func systemctl(ctx context.Context, verb, unit string) error {
+	ctx, cancel := context.WithTimeout(ctx, systemctlTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "systemctl", verb, "--", unit).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s failed: %w: %s", verb, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func systemctlOutput(ctx context.Context, verb, unit string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, systemctlTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "systemctl", verb, "--", unit).Output()
+	return strings.TrimSpace(string(out)), err
+}
@@ -8,19 +8,21 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/netf/safeedge/pkg/crypto"
 )
 
 // DeviceIdentity stores the device's cryptographic identity
 type DeviceIdentity struct {
-	DeviceID           string `json:"device_id"`
-	PublicKey          string `json:"public_key"`
-	PrivateKey         string `json:"private_key"`
-	WireguardPublicKey string `json:"wireguard_public_key"`
-	WireguardPrivateKey string `json:"wireguard_private_key"`
-	WireguardIP        string `json:"wireguard_ip"`
-	ControlPlaneURL    string `json:"control_plane_url"`
+	DeviceID            string    `json:"device_id"`
+	PublicKey           string    `json:"public_key"`
+	PrivateKey          string    `json:"private_key"`
+	WireguardPublicKey  string    `json:"wireguard_public_key"`
+	WireguardPrivateKey string    `json:"wireguard_private_key"`
+	WireguardIP         string    `json:"wireguard_ip"`
+	ControlPlaneURL     string    `json:"control_plane_url"`
+	KeysCreatedAt       time.Time `json:"keys_created_at"`
 }
 
 // EnrollRequest is the request payload for device enrollment
@@ -31,17 +33,31 @@ type EnrollRequest struct {
 	Platform           string `json:"platform"`
 	AgentVersion       string `json:"agent_version"`
 	SiteTag            string `json:"site_tag,omitempty"`
+	DeviceID           string `json:"device_id,omitempty"`
 }
 
 // EnrollResponse is the response from the enrollment endpoint
 type EnrollResponse struct {
-	DeviceID    string `json:"device_id"`
-	WireguardIP string `json:"wireguard_ip"`
+	DeviceID       string `json:"device_id"`
+	WireguardIP    string `json:"wireguard_ip"`
+	Status         string `json:"status"`
+	ReenrollmentID string `json:"reenrollment_id"`
+}
+
+// reenrollmentResponse is the part of a re-enrollment the agent polls for
+type reenrollmentResponse struct {
 	Status      string `json:"status"`
+	WireguardIP string `json:"wireguard_ip"`
 }
 
-// Enroll enrolls the device with the control plane
-func Enroll(controlPlaneURL, token, siteTag, identityPath string) (*DeviceIdentity, error) {
+// ReenrollmentPollInterval is how often a re-enrolling device checks for the operator's decision
+const ReenrollmentPollInterval = 10 * time.Second
+
+// Enroll enrolls the device with the control plane. With deviceID set it
+// re-enrolls that existing device with new keys, waiting until an operator
+// approves or rejects the request. onPending, if set, is called with the
+// re-enrollment ID before waiting so the caller can tell the operator.
+func Enroll(controlPlaneURL, token, siteTag, deviceID, identityPath string, onPending func(reenrollmentID string)) (*DeviceIdentity, error) {
 	// Generate Ed25519 key pair for device identity
 	ed25519Keys, err := crypto.GenerateEd25519KeyPair()
 	if err != nil {
@@ -65,6 +81,7 @@ func Enroll(controlPlaneURL, token, siteTag, identityPath string) (*DeviceIdenti
 		Platform:           platform,
 		AgentVersion:       "0.1.0",
 		SiteTag:            siteTag,
+		DeviceID:           deviceID,
 	}
 
 	// Make HTTP request to enrollment endpoint
@@ -83,7 +100,7 @@ func Enroll(controlPlaneURL, token, siteTag, identityPath string) (*DeviceIdenti
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusAccepted {
 		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("enrollment failed with status %d: %s", resp.StatusCode, string(body))
 	}
@@ -94,6 +111,17 @@ func Enroll(controlPlaneURL, token, siteTag, identityPath string) (*DeviceIdenti
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
+	if resp.StatusCode == http.StatusAccepted {
+		if onPending != nil {
+			onPending(enrollResp.ReenrollmentID)
+		}
+
+		enrollResp.WireguardIP, err = waitForApproval(controlPlaneURL, enrollResp.ReenrollmentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Create device identity
 	identity := &DeviceIdentity{
 		DeviceID:            enrollResp.DeviceID,
@@ -103,6 +131,7 @@ func Enroll(controlPlaneURL, token, siteTag, identityPath string) (*DeviceIdenti
 		WireguardPrivateKey: wgKeys.PrivateKeyString(),
 		WireguardIP:         enrollResp.WireguardIP,
 		ControlPlaneURL:     controlPlaneURL,
+		KeysCreatedAt:       time.Now().UTC(),
 	}
 
 	// Save identity to file
@@ -113,6 +142,36 @@ func Enroll(controlPlaneURL, token, siteTag, identityPath string) (*DeviceIdenti
 	return identity, nil
 }
 
+// waitForApproval polls a re-enrollment until it is decided and returns the
+// WireGuard IP of the approved device
+func waitForApproval(controlPlaneURL, reenrollmentID string) (string, error) {
+	for {
+		resp, err := http.Get(controlPlaneURL + "/v1/reenrollments/" + reenrollmentID)
+		if err != nil {
+			return "", fmt.Errorf("failed to check re-enrollment: %w", err)
+		}
+
+		var r reenrollmentResponse
+		err = json.NewDecoder(resp.Body).Decode(&r)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("checking re-enrollment failed with status %d", resp.StatusCode)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to decode re-enrollment: %w", err)
+		}
+
+		switch r.Status {
+		case "APPROVED":
+			return r.WireguardIP, nil
+		case "REJECTED":
+			return "", fmt.Errorf("re-enrollment %s was rejected", reenrollmentID)
+		}
+
+		time.Sleep(ReenrollmentPollInterval)
+	}
+}
+
 // LoadIdentity loads the device identity from file
 func LoadIdentity(path string) (*DeviceIdentity, error) {
 	data, err := os.ReadFile(path)
@@ -0,0 +1,101 @@
+package enrollment
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+// StreamContext returns ctx carrying the signed metadata that authenticates
+// the device's stream to the control plane
+func (i *DeviceIdentity) StreamContext(ctx context.Context) (context.Context, error) {
+	privateKey, err := crypto.ParseEd25519PrivateKey(i.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity private key: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	keys := crypto.Ed25519KeyPair{PrivateKey: privateKey}
+	signature := keys.Sign(crypto.StreamAuthMessage(i.DeviceID, timestamp))
+
+	return metadata.AppendToOutgoingContext(ctx,
+		crypto.MetadataDeviceID, i.DeviceID,
+		crypto.MetadataTimestamp, strconv.FormatInt(timestamp, 10),
+		crypto.MetadataSignature, base64.StdEncoding.EncodeToString(signature),
+	), nil
+}
+
+// KeysDue reports whether the identity's keys are older than interval
+func (i *DeviceIdentity) KeysDue(interval time.Duration) bool {
+	return interval > 0 && time.Since(i.KeysCreatedAt) >= interval
+}
+
+// PendingRotation holds freshly generated keys that replace the identity's
+// keys once the control plane accepts them
+type PendingRotation struct {
+	identity     *DeviceIdentity
+	identityPath string
+	ed25519Keys  *crypto.Ed25519KeyPair
+	wgKeys       *crypto.WireGuardKeyPair
+}
+
+// BeginRotation generates a new Ed25519 and WireGuard key pair for identity
+func BeginRotation(identity *DeviceIdentity, identityPath string) (*PendingRotation, error) {
+	ed25519Keys, err := crypto.GenerateEd25519KeyPair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate Ed25519 keys: %w", err)
+	}
+
+	wgKeys, err := crypto.GenerateWireGuardKeyPair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate WireGuard keys: %w", err)
+	}
+
+	return &PendingRotation{
+		identity:     identity,
+		identityPath: identityPath,
+		ed25519Keys:  ed25519Keys,
+		wgKeys:       wgKeys,
+	}, nil
+}
+
+// PublicKey returns the new Ed25519 public key
+func (p *PendingRotation) PublicKey() string {
+	return p.ed25519Keys.PublicKeyString()
+}
+
+// WireguardPublicKey returns the new WireGuard public key
+func (p *PendingRotation) WireguardPublicKey() string {
+	return p.wgKeys.PublicKeyString()
+}
+
+// Signature proves possession of the new Ed25519 key
+func (p *PendingRotation) Signature() []byte {
+	return p.ed25519Keys.Sign(crypto.KeyRotationMessage(
+		p.identity.DeviceID,
+		p.identity.PublicKey,
+		p.PublicKey(),
+		p.WireguardPublicKey(),
+	))
+}
+
+// Commit replaces the identity's keys with the new ones and saves it
+func (p *PendingRotation) Commit() error {
+	p.identity.PublicKey = p.ed25519Keys.PublicKeyString()
+	p.identity.PrivateKey = p.ed25519Keys.PrivateKeyString()
+	p.identity.WireguardPublicKey = p.wgKeys.PublicKeyString()
+	p.identity.WireguardPrivateKey = p.wgKeys.PrivateKeyString()
+	p.identity.KeysCreatedAt = time.Now().UTC()
+
+	if err := saveIdentity(p.identity, p.identityPath); err != nil {
+		return fmt.Errorf("failed to save identity: %w", err)
+	}
+
+	return nil
+}
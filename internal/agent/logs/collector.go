@@ -0,0 +1,292 @@
+// Package logs reads the device's configured log sources, plain text files
+// or files in journal export format, and sends their entries to the control
+// plane on request or continuously.
+package logs
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/agent/policy"
+)
+
+const (
+	// DefaultMaxEntries is how many entries a request returns if it does not
+	// say
+	DefaultMaxEntries = 1000
+	// MaxEntries bounds how many entries a request returns
+	MaxEntries = 10000
+
+	// batchSize is how many entries are sent per LogBatch
+	batchSize = 256
+	// pollInterval is how often followed sources are checked for new entries
+	pollInterval = time.Second
+
+	// shipReference identifies continuous shipping in policy denials
+	shipReference = "log-shipping"
+)
+
+// Sender sends messages to the control plane
+type Sender interface {
+	Send(msg *pb.DeviceMessage) error
+}
+
+// Collector answers the control plane's log requests from the configured
+// sources. Each source must be a file path the device policy permits.
+type Collector struct {
+	sources []Source
+	sender  Sender
+	policy  *policy.Enforcer
+	logger  *zap.Logger
+
+	mu      sync.Mutex
+	follows map[string]context.CancelFunc
+}
+
+// NewCollector creates a collector for the given sources
+func NewCollector(sources []Source, sender Sender, policy *policy.Enforcer, logger *zap.Logger) *Collector {
+	return &Collector{
+		sources: sources,
+		sender:  sender,
+		policy:  policy,
+		logger:  logger,
+		follows: make(map[string]context.CancelFunc),
+	}
+}
+
+// Handle answers a log request, following the sources until the request is
+// cancelled or ctx is done if asked to
+func (c *Collector) Handle(ctx context.Context, req *pb.LogRequest) {
+	logger := c.logger.With(zap.String("request_id", req.RequestId))
+
+	if req.Follow {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+
+		c.mu.Lock()
+		c.follows[req.RequestId] = cancel
+		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			delete(c.follows, req.RequestId)
+			c.mu.Unlock()
+		}()
+	}
+
+	maxEntries := int(req.MaxEntries)
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	if maxEntries > MaxEntries {
+		maxEntries = MaxEntries
+	}
+	var since, until time.Time
+	if req.Since != nil {
+		since = req.Since.AsTime()
+	}
+	if req.Until != nil {
+		until = req.Until.AsTime()
+	}
+
+	sources, errs := c.selectSources(req.Sources)
+	var (
+		tails     []*tail
+		entries   []*pb.LogEntry
+		truncated bool
+	)
+	for _, source := range sources {
+		t, skipped, err := c.open(source, req.RequestId, false)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", source.Name, err))
+			continue
+		}
+		defer t.close()
+		tails = append(tails, t)
+
+		read, err := t.read()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", source.Name, err))
+		}
+
+		// Entries without a timestamp cannot be placed in a time range
+		var matched []*pb.LogEntry
+		for _, entry := range read {
+			if entry.Timestamp.IsZero() && !since.IsZero() {
+				continue
+			}
+			if !since.IsZero() && entry.Timestamp.Before(since) {
+				// The part of the file that was not scanned is older still
+				skipped = false
+				continue
+			}
+			if !until.IsZero() && entry.Timestamp.After(until) {
+				continue
+			}
+			matched = append(matched, toProto(source.Name, entry))
+		}
+		if len(matched) > maxEntries {
+			matched = matched[len(matched)-maxEntries:]
+			truncated = true
+		}
+		truncated = truncated || skipped
+		entries = append(entries, matched...)
+	}
+
+	slices.SortStableFunc(entries, func(a, b *pb.LogEntry) int {
+		return a.Timestamp.AsTime().Compare(b.Timestamp.AsTime())
+	})
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+		truncated = true
+	}
+
+	logger.Info("sending logs",
+		zap.Int("entries", len(entries)),
+		zap.Bool("truncated", truncated),
+		zap.Bool("follow", req.Follow),
+		zap.Strings("errors", errs),
+	)
+
+	final := &pb.LogBatch{
+		RequestId: req.RequestId,
+		Done:      !req.Follow,
+		Error:     strings.Join(errs, "; "),
+		Truncated: truncated,
+	}
+	for len(entries) > batchSize {
+		c.send(&pb.LogBatch{RequestId: req.RequestId, Entries: entries[:batchSize]}, logger)
+		entries = entries[batchSize:]
+	}
+	final.Entries = entries
+	c.send(final, logger)
+
+	if req.Follow && len(tails) > 0 {
+		c.follow(ctx, req.RequestId, tails, logger)
+	}
+}
+
+// Cancel stops a followed request
+func (c *Collector) Cancel(requestID string) {
+	c.mu.Lock()
+	cancel, ok := c.follows[requestID]
+	c.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+// Ship sends entries written to every source from now on until ctx is done
+func (c *Collector) Ship(ctx context.Context) {
+	var tails []*tail
+	for _, source := range c.sources {
+		t, _, err := c.open(source, shipReference, true)
+		if err != nil {
+			c.logger.Warn("not shipping log source", zap.String("source", source.Name), zap.Error(err))
+			continue
+		}
+		defer t.close()
+		tails = append(tails, t)
+	}
+	if len(tails) == 0 {
+		return
+	}
+
+	c.logger.Info("shipping logs", zap.Int("sources", len(tails)))
+	c.follow(ctx, "", tails, c.logger)
+}
+
+func (c *Collector) selectSources(names []string) ([]Source, []string) {
+	if len(names) == 0 {
+		return c.sources, nil
+	}
+
+	var (
+		sources []Source
+		errs    []string
+	)
+	for _, name := range names {
+		i := slices.IndexFunc(c.sources, func(s Source) bool { return s.Name == name })
+		if i < 0 {
+			errs = append(errs, fmt.Sprintf("%s: unknown log source", name))
+			continue
+		}
+		sources = append(sources, c.sources[i])
+	}
+	return sources, errs
+}
+
+// open checks a source against the device policy, with symlinks resolved so
+// a link cannot lead outside the permitted paths, and opens it
+func (c *Collector) open(source Source, referenceID string, fromEnd bool) (*tail, bool, error) {
+	path, err := filepath.EvalSymlinks(source.Path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to resolve log source: %w", err)
+	}
+	if err := c.policy.CheckPath(referenceID, path); err != nil {
+		return nil, false, err
+	}
+	return openTail(source, path, fromEnd)
+}
+
+// follow sends new entries from the tails until ctx is done
+func (c *Collector) follow(ctx context.Context, requestID string, tails []*tail, logger *zap.Logger) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Debug("stopped following logs")
+			return
+		case <-ticker.C:
+		}
+
+		var entries []*pb.LogEntry
+		for _, t := range tails {
+			read, err := t.read()
+			if err != nil {
+				logger.Warn("failed to read log source", zap.String("source", t.source.Name), zap.Error(err))
+			}
+			for _, entry := range read {
+				// Just written, so now is close enough
+				if entry.Timestamp.IsZero() {
+					entry.Timestamp = time.Now()
+				}
+				entries = append(entries, toProto(t.source.Name, entry))
+			}
+		}
+
+		for len(entries) > 0 {
+			n := min(len(entries), batchSize)
+			c.send(&pb.LogBatch{RequestId: requestID, Entries: entries[:n]}, logger)
+			entries = entries[n:]
+		}
+	}
+}
+
+func (c *Collector) send(batch *pb.LogBatch, logger *zap.Logger) {
+	if err := c.sender.Send(&pb.DeviceMessage{
+		Payload: &pb.DeviceMessage_LogBatch{LogBatch: batch},
+	}); err != nil {
+		logger.Error("failed to send logs", zap.Error(err))
+	}
+}
+
+func toProto(source string, entry Entry) *pb.LogEntry {
+	e := &pb.LogEntry{Source: source, Message: entry.Message}
+	if !entry.Timestamp.IsZero() {
+		e.Timestamp = timestamppb.New(entry.Timestamp)
+	}
+	return e
+}
@@ -0,0 +1,170 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMessageLength bounds each entry's message, in bytes
+const maxMessageLength = 8 * 1024
+
+// Entry is a log line, or a journal entry, read from a source. Timestamp is
+// zero when it could not be determined.
+type Entry struct {
+	Timestamp time.Time
+	Message   string
+}
+
+// parser splits data read from a source into entries. It returns the
+// entries and how many bytes of data they took; the rest is an incomplete
+// record to parse again once more data is read.
+type parser func(data []byte) ([]Entry, int)
+
+// textParser parses a plain text log, one entry per line. Timestamps are
+// taken from the start of the line in RFC 3339, "2006-01-02 15:04:05" or
+// syslog ("Jan _2 15:04:05") form; lines without one, such as the
+// continuation lines of a stack trace, take the previous line's.
+func textParser() parser {
+	var last time.Time
+	return func(data []byte) ([]Entry, int) {
+		var entries []Entry
+		consumed := 0
+		for {
+			i := bytes.IndexByte(data[consumed:], '\n')
+			if i < 0 {
+				return entries, consumed
+			}
+			line := strings.TrimRight(string(data[consumed:consumed+i]), "\r")
+			consumed += i + 1
+
+			if ts, ok := parseLineTimestamp(line, time.Now()); ok {
+				last = ts
+			}
+			entries = append(entries, Entry{Timestamp: last, Message: truncateMessage(line)})
+		}
+	}
+}
+
+func parseLineTimestamp(line string, now time.Time) (time.Time, bool) {
+	if field, _, _ := strings.Cut(line, " "); len(field) >= len("2006-01-02T15:04:05Z") {
+		if ts, err := time.Parse(time.RFC3339Nano, field); err == nil {
+			return ts, true
+		}
+	}
+	if len(line) >= len(time.DateTime) {
+		if ts, err := time.ParseInLocation(time.DateTime, line[:len(time.DateTime)], time.Local); err == nil {
+			return ts, true
+		}
+	}
+	if len(line) >= len(time.Stamp) {
+		if ts, err := time.ParseInLocation(time.Stamp, line[:len(time.Stamp)], time.Local); err == nil {
+			// Syslog timestamps have no year; assume the latest that is not
+			// in the future
+			ts = ts.AddDate(now.Year(), 0, 0)
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// journalParser parses the journal export format written by
+// journalctl -o export: entries of KEY=value fields, or of binary fields as
+// KEY, a little-endian 64-bit length and the data, ending with an empty
+// line. Each entry becomes "identifier[pid]: message" at its realtime
+// timestamp.
+func journalParser() parser {
+	return func(data []byte) ([]Entry, int) {
+		var entries []Entry
+		consumed := 0
+		for {
+			fields, n, ok := parseJournalEntry(data[consumed:])
+			if !ok {
+				return entries, consumed
+			}
+			consumed += n
+			if len(fields) > 0 {
+				entries = append(entries, journalEntry(fields))
+			}
+		}
+	}
+}
+
+// parseJournalEntry parses one export format entry, reporting false if data
+// does not hold a complete one
+func parseJournalEntry(data []byte) (map[string]string, int, bool) {
+	fields := make(map[string]string)
+	pos := 0
+	for {
+		if pos >= len(data) {
+			return nil, 0, false
+		}
+		if data[pos] == '\n' {
+			return fields, pos + 1, true
+		}
+
+		i := bytes.IndexByte(data[pos:], '\n')
+		if i < 0 {
+			return nil, 0, false
+		}
+		line := data[pos : pos+i]
+
+		if key, value, ok := bytes.Cut(line, []byte("=")); ok {
+			fields[string(key)] = string(value)
+			pos += i + 1
+			continue
+		}
+
+		// Binary field: KEY\n<uint64 length><data>\n
+		start := pos + i + 1
+		if len(data) < start+8 {
+			return nil, 0, false
+		}
+		size := binary.LittleEndian.Uint64(data[start : start+8])
+		if size > uint64(len(data)) {
+			return nil, 0, false
+		}
+		end := start + 8 + int(size)
+		if len(data) < end+1 {
+			return nil, 0, false
+		}
+		fields[string(line)] = string(data[start+8 : end])
+		pos = end + 1
+	}
+}
+
+func journalEntry(fields map[string]string) Entry {
+	var entry Entry
+	if usec, err := strconv.ParseInt(fields["__REALTIME_TIMESTAMP"], 10, 64); err == nil {
+		entry.Timestamp = time.UnixMicro(usec)
+	}
+
+	identifier := fields["SYSLOG_IDENTIFIER"]
+	if identifier == "" {
+		identifier = fields["_SYSTEMD_UNIT"]
+	}
+	if identifier == "" {
+		identifier = fields["_COMM"]
+	}
+	message := fields["MESSAGE"]
+	if identifier != "" {
+		if pid := fields["_PID"]; pid != "" {
+			identifier += "[" + pid + "]"
+		}
+		message = identifier + ": " + message
+	}
+	entry.Message = truncateMessage(message)
+	return entry
+}
+
+func truncateMessage(message string) string {
+	if len(message) > maxMessageLength {
+		return strings.ToValidUTF8(message[:maxMessageLength], "")
+	}
+	return message
+}
@@ -0,0 +1,207 @@
+package logs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// maxScanBytes is how much of the end of a source is read to answer a
+// request; older entries of a larger file are not searched
+const maxScanBytes = 64 * 1024 * 1024
+
+// Format is how a source's entries are stored
+type Format string
+
+// Source formats
+const (
+	FormatText    Format = "text"
+	FormatJournal Format = "journal"
+)
+
+// Source is a log file the agent reads, by name
+type Source struct {
+	Name   string
+	Path   string
+	Format Format
+}
+
+// ParseSource parses a source as given to --log-source:
+// [name=][journal:]path, the name defaulting to the file name. journal:
+// marks a file in journal export format, e.g. one kept up to date by
+// journalctl -f -o export.
+func ParseSource(spec string) (Source, error) {
+	source := Source{Format: FormatText}
+
+	name, rest, ok := strings.Cut(spec, "=")
+	if !ok {
+		name, rest = "", spec
+	}
+	if after, ok := strings.CutPrefix(rest, "journal:"); ok {
+		source.Format = FormatJournal
+		rest = after
+	}
+	if !filepath.IsAbs(rest) {
+		return Source{}, fmt.Errorf("invalid log source %q: path must be absolute", spec)
+	}
+	source.Path = filepath.Clean(rest)
+
+	if name == "" {
+		name = filepath.Base(source.Path)
+	}
+	source.Name = name
+	return source, nil
+}
+
+func (s Source) parser() parser {
+	if s.Format == FormatJournal {
+		return journalParser()
+	}
+	return textParser()
+}
+
+// tail reads a source's entries as it grows, starting over when the file is
+// rotated or truncated
+type tail struct {
+	source Source
+	// path is the source's path with symlinks resolved
+	path  string
+	parse parser
+
+	file    *os.File
+	offset  int64
+	partial []byte
+}
+
+// openTail opens a source at its resolved path. With fromEnd it reads only
+// what is written from now on; otherwise it starts up to maxScanBytes from
+// the end, reporting whether earlier entries were skipped.
+func openTail(source Source, path string, fromEnd bool) (*tail, bool, error) {
+	t := &tail{source: source, path: path, parse: source.parser()}
+	if err := t.open(); err != nil {
+		return nil, false, err
+	}
+
+	info, err := t.file.Stat()
+	if err != nil {
+		t.close()
+		return nil, false, fmt.Errorf("failed to stat log source: %w", err)
+	}
+
+	skipped := false
+	switch {
+	case fromEnd:
+		t.offset = info.Size()
+	case info.Size() > maxScanBytes:
+		t.offset = info.Size() - maxScanBytes
+		skipped = true
+	}
+	if _, err := t.file.Seek(t.offset, io.SeekStart); err != nil {
+		t.close()
+		return nil, false, fmt.Errorf("failed to seek log source: %w", err)
+	}
+
+	// Start at a record boundary
+	if skipped {
+		t.skipPartialRecord()
+	}
+	return t, skipped, nil
+}
+
+func (t *tail) open() error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("failed to open log source: %w", err)
+	}
+	t.file = file
+	t.offset = 0
+	t.partial = nil
+	return nil
+}
+
+func (t *tail) close() {
+	if t.file != nil {
+		t.file.Close()
+	}
+}
+
+// skipPartialRecord drops the record the offset falls in, up to the next
+// line, or for journals the next empty line
+func (t *tail) skipPartialRecord() {
+	separator := []byte("\n")
+	if t.source.Format == FormatJournal {
+		separator = []byte("\n\n")
+	}
+
+	data, _ := t.readAvailable()
+	if i := strings.Index(string(data), string(separator)); i >= 0 {
+		t.partial = data[i+len(separator):]
+	} else {
+		t.partial = nil
+	}
+}
+
+// read returns the entries written since the last read
+func (t *tail) read() ([]Entry, error) {
+	if err := t.reopenIfRotated(); err != nil {
+		return nil, err
+	}
+
+	data, err := t.readAvailable()
+	if err != nil {
+		return nil, err
+	}
+	data = append(t.partial, data...)
+
+	entries, consumed := t.parse(data)
+	t.partial = append([]byte(nil), data[consumed:]...)
+	return entries, nil
+}
+
+func (t *tail) readAvailable() ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(t.file, maxScanBytes))
+	t.offset += int64(len(data))
+	if err != nil {
+		return data, fmt.Errorf("failed to read log source: %w", err)
+	}
+	return data, nil
+}
+
+// reopenIfRotated starts over on a new file at the path, or on the same file
+// if it was truncated
+func (t *tail) reopenIfRotated() error {
+	info, err := os.Stat(t.path)
+	if err != nil {
+		// Rotated away and not yet recreated; keep reading the old file
+		return nil
+	}
+	current, err := t.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat log source: %w", err)
+	}
+
+	if !sameFile(info, current) {
+		t.close()
+		return t.open()
+	}
+	if info.Size() < t.offset {
+		t.offset = 0
+		t.partial = nil
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek log source: %w", err)
+		}
+	}
+	return nil
+}
+
+func sameFile(a, b os.FileInfo) bool {
+	sa, ok := a.Sys().(*syscall.Stat_t)
+	sb, ok2 := b.Sys().(*syscall.Stat_t)
+	if !ok || !ok2 {
+		return os.SameFile(a, b)
+	}
+	return sa.Dev == sb.Dev && sa.Ino == sb.Ino
+}
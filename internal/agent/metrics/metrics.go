@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	// DefaultProcRoot is the procfs mount point on Linux devices
+	DefaultProcRoot = "/proc"
+	// DefaultSysRoot is the sysfs mount point on Linux devices
+	DefaultSysRoot = "/sys"
+	// DefaultDiskPath is the filesystem reported in disk usage
+	DefaultDiskPath = "/"
+)
+
+// Metrics is a point-in-time snapshot of device resource usage
+type Metrics struct {
+	CPUPercent           float64
+	MemoryPercent        float64
+	MemoryTotalBytes     uint64
+	MemoryAvailableBytes uint64
+	DiskUsedBytes        uint64
+	DiskTotalBytes       uint64
+	UptimeSeconds        float64
+	LoadAverage1m        float64
+	LoadAverage5m        float64
+	LoadAverage15m       float64
+	NetworkInterfaces    []NetworkInterface
+	Temperatures         []Temperature
+}
+
+// NetworkInterface holds cumulative counters for a single interface
+type NetworkInterface struct {
+	Name      string
+	RxBytes   uint64
+	TxBytes   uint64
+	RxPackets uint64
+	TxPackets uint64
+	RxErrors  uint64
+	TxErrors  uint64
+}
+
+// Temperature holds a thermal zone reading in degrees Celsius
+type Temperature struct {
+	Zone    string
+	Celsius float64
+}
+
+// Collector reads device metrics from procfs, sysfs and statfs.
+// CPU usage is computed from the delta between consecutive calls to Collect.
+type Collector struct {
+	procRoot string
+	sysRoot  string
+	diskPath string
+
+	mu      sync.Mutex
+	prevCPU *cpuTimes
+}
+
+// NewCollector creates a collector reading from the given procfs and sysfs
+// roots. Tests can point the roots at fake directory trees.
+func NewCollector(procRoot, sysRoot, diskPath string) *Collector {
+	return &Collector{
+		procRoot: procRoot,
+		sysRoot:  sysRoot,
+		diskPath: diskPath,
+	}
+}
+
+// Collect gathers a metrics snapshot. Sources that fail are skipped and
+// reported in the returned error; the partial snapshot is always returned.
+func (c *Collector) Collect() (*Metrics, error) {
+	m := &Metrics{}
+	var errs []error
+
+	if err := c.collectCPU(m); err != nil {
+		errs = append(errs, err)
+	}
+
+	mem, err := readMemInfo(c.procRoot)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		m.MemoryTotalBytes = mem.totalBytes
+		m.MemoryAvailableBytes = mem.availableBytes
+		if mem.totalBytes > 0 {
+			used := mem.totalBytes - mem.availableBytes
+			m.MemoryPercent = float64(used) / float64(mem.totalBytes) * 100
+		}
+	}
+
+	if c.diskPath != "" {
+		used, total, err := diskUsage(c.diskPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to stat filesystem %s: %w", c.diskPath, err))
+		} else {
+			m.DiskUsedBytes = used
+			m.DiskTotalBytes = total
+		}
+	}
+
+	if uptime, err := readUptime(c.procRoot); err != nil {
+		errs = append(errs, err)
+	} else {
+		m.UptimeSeconds = uptime
+	}
+
+	if load, err := readLoadAverage(c.procRoot); err != nil {
+		errs = append(errs, err)
+	} else {
+		m.LoadAverage1m, m.LoadAverage5m, m.LoadAverage15m = load[0], load[1], load[2]
+	}
+
+	if ifaces, err := readNetDev(c.procRoot); err != nil {
+		errs = append(errs, err)
+	} else {
+		m.NetworkInterfaces = ifaces
+	}
+
+	// Thermal zones are optional; many devices and containers have none
+	m.Temperatures = readThermalZones(c.sysRoot)
+
+	return m, errors.Join(errs...)
+}
+
+// collectCPU computes CPU usage since the previous call, or since boot on the first call
+func (c *Collector) collectCPU(m *Metrics) error {
+	cur, err := readCPUTimes(c.procRoot)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	prev := c.prevCPU
+	if prev == nil {
+		prev = &cpuTimes{}
+	}
+	c.prevCPU = cur
+
+	total := cur.total - prev.total
+	idle := cur.idle - prev.idle
+	if cur.total < prev.total || cur.idle < prev.idle || total == 0 {
+		return nil
+	}
+
+	m.CPUPercent = float64(total-idle) / float64(total) * 100
+	return nil
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	c := NewCollector(testProcRoot, testSysRoot, "")
+
+	m, err := c.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first CPU reading is measured since boot
+	if m.CPUPercent != 15 {
+		t.Errorf("CPUPercent = %v, want 15", m.CPUPercent)
+	}
+	if m.MemoryPercent != 50 {
+		t.Errorf("MemoryPercent = %v, want 50", m.MemoryPercent)
+	}
+	if m.MemoryTotalBytes != 2048000*1024 || m.MemoryAvailableBytes != 1024000*1024 {
+		t.Errorf("memory = %d available of %d", m.MemoryAvailableBytes, m.MemoryTotalBytes)
+	}
+	if m.UptimeSeconds != 3600.5 || m.LoadAverage1m != 0.5 || m.LoadAverage15m != 0.1 {
+		t.Errorf("uptime %v, load %v/%v/%v", m.UptimeSeconds, m.LoadAverage1m, m.LoadAverage5m, m.LoadAverage15m)
+	}
+	if len(m.NetworkInterfaces) != 2 || len(m.Temperatures) != 2 {
+		t.Errorf("got %d interfaces and %d thermal zones, want 2 and 2", len(m.NetworkInterfaces), len(m.Temperatures))
+	}
+}
+
+func TestCollectCPUDelta(t *testing.T) {
+	root := writeProcFile(t, "stat", "cpu  100 0 0 900 0 0 0 0\n")
+	c := NewCollector(root, t.TempDir(), "")
+
+	m := &Metrics{}
+	if err := c.collectCPU(m); err != nil {
+		t.Fatal(err)
+	}
+	if m.CPUPercent != 10 {
+		t.Errorf("first reading = %v, want 10", m.CPUPercent)
+	}
+
+	// 300 of the next 400 jiffies were busy
+	stat := filepath.Join(root, "stat")
+	if err := os.WriteFile(stat, []byte("cpu  400 0 0 1000 0 0 0 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m = &Metrics{}
+	if err := c.collectCPU(m); err != nil {
+		t.Fatal(err)
+	}
+	if m.CPUPercent != 75 {
+		t.Errorf("second reading = %v, want 75", m.CPUPercent)
+	}
+
+	// Counters that go backwards report nothing rather than a bogus value
+	if err := os.WriteFile(stat, []byte("cpu  10 0 0 10 0 0 0 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m = &Metrics{}
+	if err := c.collectCPU(m); err != nil {
+		t.Fatal(err)
+	}
+	if m.CPUPercent != 0 {
+		t.Errorf("reading after counters went backwards = %v, want 0", m.CPUPercent)
+	}
+}
+
+func TestCollectReportsMissingSources(t *testing.T) {
+	c := NewCollector(t.TempDir(), t.TempDir(), "")
+
+	m, err := c.Collect()
+	if err == nil {
+		t.Fatal("want an error for an empty procfs")
+	}
+	if m == nil {
+		t.Fatal("want a partial snapshot alongside the error")
+	}
+}
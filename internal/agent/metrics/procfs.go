@@ -0,0 +1,227 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// cpuTimes holds aggregate jiffies from the "cpu" line of /proc/stat
+type cpuTimes struct {
+	total uint64
+	idle  uint64
+}
+
+// readCPUTimes parses the aggregate CPU line from /proc/stat
+func readCPUTimes(procRoot string) (*cpuTimes, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stat: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		var times cpuTimes
+		for i, field := range fields[1:] {
+			// guest and guest_nice are already included in user and nice
+			if i >= 8 {
+				break
+			}
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse cpu field %q: %w", field, err)
+			}
+			times.total += v
+			// idle and iowait
+			if i == 3 || i == 4 {
+				times.idle += v
+			}
+		}
+		return &times, nil
+	}
+
+	return nil, fmt.Errorf("cpu line not found in stat")
+}
+
+// memInfo holds the subset of /proc/meminfo used for memory usage
+type memInfo struct {
+	totalBytes     uint64
+	availableBytes uint64
+}
+
+// readMemInfo parses /proc/meminfo
+func readMemInfo(procRoot string) (*memInfo, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read meminfo: %w", err)
+	}
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			v *= 1024
+		}
+		values[key] = v
+	}
+
+	total, ok := values["MemTotal"]
+	if !ok {
+		return nil, fmt.Errorf("MemTotal not found in meminfo")
+	}
+
+	// MemAvailable is missing on kernels older than 3.14
+	available, ok := values["MemAvailable"]
+	if !ok {
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	if available > total {
+		available = total
+	}
+
+	return &memInfo{totalBytes: total, availableBytes: available}, nil
+}
+
+// readUptime parses the first field of /proc/uptime
+func readUptime(procRoot string) (float64, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "uptime"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read uptime: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty uptime")
+	}
+
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse uptime: %w", err)
+	}
+
+	return uptime, nil
+}
+
+// readLoadAverage parses the 1, 5 and 15 minute load averages from /proc/loadavg
+func readLoadAverage(procRoot string) ([3]float64, error) {
+	var load [3]float64
+
+	data, err := os.ReadFile(filepath.Join(procRoot, "loadavg"))
+	if err != nil {
+		return load, fmt.Errorf("failed to read loadavg: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return load, fmt.Errorf("malformed loadavg: %q", string(data))
+	}
+
+	for i := range load {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return load, fmt.Errorf("failed to parse loadavg: %w", err)
+		}
+		load[i] = v
+	}
+
+	return load, nil
+}
+
+// readNetDev parses interface counters from /proc/net/dev, skipping loopback
+func readNetDev(procRoot string) ([]NetworkInterface, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, "net", "dev"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read net/dev: %w", err)
+	}
+
+	var ifaces []NetworkInterface
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		name, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if name == "lo" {
+			continue
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) < 16 {
+			continue
+		}
+
+		var counters [16]uint64
+		for i := range counters {
+			counters[i], _ = strconv.ParseUint(fields[i], 10, 64)
+		}
+
+		ifaces = append(ifaces, NetworkInterface{
+			Name:      name,
+			RxBytes:   counters[0],
+			RxPackets: counters[1],
+			RxErrors:  counters[2],
+			TxBytes:   counters[8],
+			TxPackets: counters[9],
+			TxErrors:  counters[10],
+		})
+	}
+
+	return ifaces, nil
+}
+
+// readThermalZones reads temperatures from /sys/class/thermal. Zones that
+// cannot be read are skipped.
+func readThermalZones(sysRoot string) []Temperature {
+	zones, err := filepath.Glob(filepath.Join(sysRoot, "class", "thermal", "thermal_zone*"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(zones)
+
+	var temps []Temperature
+	for _, zone := range zones {
+		data, err := os.ReadFile(filepath.Join(zone, "temp"))
+		if err != nil {
+			continue
+		}
+		milli, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		name := filepath.Base(zone)
+		if zoneType, err := os.ReadFile(filepath.Join(zone, "type")); err == nil {
+			name = strings.TrimSpace(string(zoneType))
+		}
+
+		temps = append(temps, Temperature{
+			Zone:    name,
+			Celsius: float64(milli) / 1000,
+		})
+	}
+
+	return temps
+}
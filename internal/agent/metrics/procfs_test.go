@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	testProcRoot = "testdata/proc"
+	testSysRoot  = "testdata/sys"
+)
+
+// writeProcFile writes a single procfs file into a fresh root and returns the root
+func writeProcFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestReadCPUTimes(t *testing.T) {
+	times, err := readCPUTimes(testProcRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// guest and guest_nice are left out of the total
+	if times.total != 1000 || times.idle != 850 {
+		t.Errorf("got total %d idle %d, want total 1000 idle 850", times.total, times.idle)
+	}
+}
+
+func TestReadCPUTimesRejects(t *testing.T) {
+	tests := map[string]string{
+		"no cpu line":   "cpu0 1 2 3 4 5\nctxt 1\n",
+		"short line":    "cpu  1 2 3\n",
+		"bad field":     "cpu  1 2 x 4 5\n",
+		"empty file":    "",
+		"per-cpu lines": "cpu0 1 2 3 4 5\ncpu1 1 2 3 4 5\n",
+	}
+	for name, content := range tests {
+		root := writeProcFile(t, "stat", content)
+		if times, err := readCPUTimes(root); err == nil {
+			t.Errorf("%s: got %+v, want an error", name, times)
+		}
+	}
+
+	if _, err := readCPUTimes(t.TempDir()); err == nil {
+		t.Error("missing stat: want an error")
+	}
+}
+
+func TestReadMemInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    memInfo
+	}{
+		{
+			name:    "MemAvailable",
+			content: "MemTotal: 2048 kB\nMemFree: 512 kB\nMemAvailable: 1024 kB\nBuffers: 64 kB\nCached: 256 kB\n",
+			want:    memInfo{totalBytes: 2048 * 1024, availableBytes: 1024 * 1024},
+		},
+		{
+			name:    "estimated from free, buffers and cached",
+			content: "MemTotal: 2048 kB\nMemFree: 512 kB\nBuffers: 64 kB\nCached: 256 kB\n",
+			want:    memInfo{totalBytes: 2048 * 1024, availableBytes: (512 + 64 + 256) * 1024},
+		},
+		{
+			name:    "available capped at total",
+			content: "MemTotal: 1024 kB\nMemAvailable: 4096 kB\n",
+			want:    memInfo{totalBytes: 1024 * 1024, availableBytes: 1024 * 1024},
+		},
+		{
+			name:    "values without a unit are not scaled",
+			content: "MemTotal: 1000\nMemAvailable: 400\nHugePages_Total: x\n",
+			want:    memInfo{totalBytes: 1000, availableBytes: 400},
+		},
+	}
+	for _, tc := range tests {
+		root := writeProcFile(t, "meminfo", tc.content)
+		got, err := readMemInfo(root)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if *got != tc.want {
+			t.Errorf("%s: got %+v, want %+v", tc.name, *got, tc.want)
+		}
+	}
+
+	root := writeProcFile(t, "meminfo", "MemFree: 512 kB\n")
+	if _, err := readMemInfo(root); err == nil {
+		t.Error("meminfo without MemTotal: want an error")
+	}
+}
+
+func TestReadUptimeAndLoadAverage(t *testing.T) {
+	uptime, err := readUptime(testProcRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uptime != 3600.5 {
+		t.Errorf("uptime = %v, want 3600.5", uptime)
+	}
+
+	load, err := readLoadAverage(testProcRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if load != [3]float64{0.5, 0.25, 0.1} {
+		t.Errorf("load average = %v, want [0.5 0.25 0.1]", load)
+	}
+
+	if _, err := readUptime(writeProcFile(t, "uptime", "\n")); err == nil {
+		t.Error("empty uptime: want an error")
+	}
+	if _, err := readLoadAverage(writeProcFile(t, "loadavg", "0.5 0.25\n")); err == nil {
+		t.Error("short loadavg: want an error")
+	}
+}
+
+func TestReadNetDev(t *testing.T) {
+	ifaces, err := readNetDev(testProcRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []NetworkInterface{
+		{Name: "eth0", RxBytes: 1000000, RxPackets: 2000, RxErrors: 3, TxBytes: 500000, TxPackets: 1500, TxErrors: 6},
+		{Name: "wlan0", RxBytes: 300, RxPackets: 10, TxBytes: 200, TxPackets: 8, TxErrors: 1},
+	}
+	if !reflect.DeepEqual(ifaces, want) {
+		t.Errorf("got %+v, want %+v", ifaces, want)
+	}
+
+	root := writeProcFile(t, "net/dev", "eth0: 1 2 3\n")
+	if ifaces, err := readNetDev(root); err != nil || len(ifaces) != 0 {
+		t.Errorf("truncated line: got %+v, %v, want no interfaces", ifaces, err)
+	}
+}
+
+func TestReadThermalZones(t *testing.T) {
+	// thermal_zone2 holds an unreadable temperature and is skipped
+	want := []Temperature{
+		{Zone: "cpu-thermal", Celsius: 45},
+		{Zone: "thermal_zone1", Celsius: -5.5},
+	}
+	if got := readThermalZones(testSysRoot); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if got := readThermalZones(t.TempDir()); got != nil {
+		t.Errorf("no thermal zones: got %+v, want none", got)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build linux
+
+package metrics
+
+import "syscall"
+
+// diskUsage returns used and total bytes of the filesystem containing path
+func diskUsage(path string) (uint64, uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+
+	total := st.Blocks * uint64(st.Bsize)
+	free := st.Bfree * uint64(st.Bsize)
+	return total - free, total, nil
+}
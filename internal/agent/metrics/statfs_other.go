@@ -0,0 +1,10 @@
+//go:build !linux
+
+package metrics
+
+import "errors"
+
+// diskUsage is only implemented on Linux
+func diskUsage(path string) (uint64, uint64, error) {
+	return 0, 0, errors.New("disk usage not supported on this platform")
+}
@@ -0,0 +1,165 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/pkg/crypto"
+	"github.com/netf/safeedge/pkg/policy"
+)
+
+// DefaultPath is where the device's owner installs its policy file, with its
+// signature alongside
+const DefaultPath = "/var/lib/safeedge/policy.json"
+
+// ErrDenied is returned for requests the device policy refuses
+var ErrDenied = errors.New("denied by device policy")
+
+// Sender sends messages to the control plane
+type Sender interface {
+	Send(msg *pb.DeviceMessage) error
+}
+
+// Enforcer checks commands, file paths and forward destinations against the
+// device policy and reports what it denies to the control plane.
+//
+// Without a public key and policy file nothing is restricted. Once either is
+// installed the policy must load and verify against the key, otherwise
+// everything is denied: a policy that cannot be verified is never ignored.
+type Enforcer struct {
+	path      string
+	publicKey string
+	sender    Sender
+	logger    *zap.Logger
+
+	mu       sync.RWMutex
+	enforced bool
+	policy   *policy.Policy
+	hash     string
+}
+
+// NewEnforcer creates an enforcer for the policy file at path, signed by the
+// organization's base64 Ed25519 public key, and loads it
+func NewEnforcer(path, publicKey string, sender Sender, logger *zap.Logger) *Enforcer {
+	e := &Enforcer{
+		path:      path,
+		publicKey: publicKey,
+		sender:    sender,
+		logger:    logger,
+	}
+	e.Load()
+	return e
+}
+
+// Load reads and verifies the policy file again, denying everything if it
+// cannot be
+func (e *Enforcer) Load() {
+	p, hash, err := e.read()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case errors.Is(err, os.ErrNotExist) && e.publicKey == "":
+		e.enforced, e.policy, e.hash = false, nil, ""
+		e.logger.Info("no device policy installed")
+	case err != nil:
+		e.enforced, e.policy, e.hash = true, nil, ""
+		e.logger.Error("failed to load device policy, denying all commands, file access and forwarding",
+			zap.String("path", e.path),
+			zap.Error(err),
+		)
+	default:
+		e.enforced, e.policy, e.hash = true, p, hash
+		e.logger.Info("device policy loaded",
+			zap.String("path", e.path),
+			zap.String("hash", hash),
+			zap.Strings("commands", p.Commands),
+			zap.Strings("file_paths", p.FilePaths),
+			zap.Strings("forward_destinations", p.ForwardDestinations),
+		)
+	}
+}
+
+func (e *Enforcer) read() (*policy.Policy, string, error) {
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read policy: %w", err)
+	}
+	if e.publicKey == "" {
+		return nil, "", fmt.Errorf("policy installed without an organization public key to verify it")
+	}
+
+	signature, err := os.ReadFile(policy.SignaturePath(e.path))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read policy signature: %w", err)
+	}
+	if err := policy.Verify(data, signature, e.publicKey); err != nil {
+		return nil, "", err
+	}
+
+	p, err := policy.Parse(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return p, crypto.BLAKE3Hash(data), nil
+}
+
+// CheckCommand checks that a command or script may run
+func (e *Enforcer) CheckCommand(commandID, name string) error {
+	return e.check(pb.PolicyRule_POLICY_RULE_COMMAND, name, commandID, (*policy.Policy).AllowsCommand)
+}
+
+// CheckPath checks that a file may be read or written. The path must have
+// its symlinks resolved.
+func (e *Enforcer) CheckPath(referenceID, path string) error {
+	return e.check(pb.PolicyRule_POLICY_RULE_FILE_PATH, path, referenceID, (*policy.Policy).AllowsPath)
+}
+
+// CheckDestination checks that an access session may reach a destination
+func (e *Enforcer) CheckDestination(sessionID, dest string) error {
+	return e.check(pb.PolicyRule_POLICY_RULE_FORWARD_DESTINATION, dest, sessionID, (*policy.Policy).AllowsDestination)
+}
+
+func (e *Enforcer) check(rule pb.PolicyRule, target, referenceID string, allows func(*policy.Policy, string) bool) error {
+	e.mu.RLock()
+	enforced, p, hash := e.enforced, e.policy, e.hash
+	e.mu.RUnlock()
+
+	if !enforced {
+		return nil
+	}
+
+	reason := "not allowed by the device policy"
+	if p == nil {
+		reason = "no valid device policy is installed"
+	} else if allows(p, target) {
+		return nil
+	}
+
+	e.logger.Warn("request denied by device policy",
+		zap.String("rule", rule.String()),
+		zap.String("target", target),
+		zap.String("reference_id", referenceID),
+		zap.String("reason", reason),
+	)
+
+	if err := e.sender.Send(&pb.DeviceMessage{
+		Payload: &pb.DeviceMessage_PolicyDenial{PolicyDenial: &pb.PolicyDenial{
+			Rule:        rule,
+			Target:      target,
+			Reason:      reason,
+			ReferenceId: referenceID,
+			PolicyHash:  hash,
+		}},
+	}); err != nil {
+		e.logger.Error("failed to report policy denial", zap.Error(err))
+	}
+
+	return fmt.Errorf("%s %w", target, ErrDenied)
+}
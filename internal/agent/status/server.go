@@ -0,0 +1,114 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultSocket is where the agent serves its status unless configured
+// otherwise
+const DefaultSocket = "/run/safeedge/agent.sock"
+
+// statusPath is the status endpoint on the socket
+const statusPath = "/v1/status"
+
+const requestTimeout = 5 * time.Second
+
+// Listen creates the status socket at path, replacing one left behind by an
+// agent that is no longer running. Only the agent's user and group may
+// connect.
+func Listen(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another agent is serving status on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket mode: %w", err)
+	}
+	return listener, nil
+}
+
+// Serve answers status requests on listener until ctx is cancelled
+func (t *Tracker) Serve(ctx context.Context, listener net.Listener, logger *zap.Logger) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+statusPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(t.Status()); err != nil {
+			logger.Warn("failed to write status", zap.Error(err))
+		}
+	})
+
+	server := &http.Server{
+		Handler:      mux,
+		ReadTimeout:  requestTimeout,
+		WriteTimeout: requestTimeout,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve status: %w", err)
+	}
+	return nil
+}
+
+// Fetch asks the agent serving status on the socket at path for its status
+func Fetch(ctx context.Context, path string) (*Status, error) {
+	client := &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://agent"+statusPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the agent (is it running?): %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent returned %s", resp.Status)
+	}
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to parse status: %w", err)
+	}
+	return &status, nil
+}
@@ -0,0 +1,173 @@
+// Package status tracks what the agent is doing and serves it on a local
+// Unix socket, for "safeedge-agent status" to show someone at the device
+// whether the agent is connected, what it has installed and what it is
+// busy with.
+package status
+
+import (
+	"sync"
+	"time"
+
+	"github.com/netf/safeedge/internal/agent/access"
+	"github.com/netf/safeedge/internal/agent/update"
+)
+
+// Connection states
+const (
+	StateConnecting   = "CONNECTING"
+	StateConnected    = "CONNECTED"
+	StateDisconnected = "DISCONNECTED"
+)
+
+// Status is what the agent is doing
+type Status struct {
+	DeviceID     string    `json:"device_id"`
+	Version      string    `json:"version"`
+	WireguardIP  string    `json:"wireguard_ip"`
+	ControlPlane string    `json:"control_plane"`
+	StartedAt    time.Time `json:"started_at"`
+
+	Connection Connection `json:"connection"`
+	// Slots are the artifacts installed under each name
+	Slots map[string]update.Slot `json:"slots"`
+	// Updates are the updates and rollbacks in progress
+	Updates []update.Progress `json:"updates"`
+	Tunnels access.Stats      `json:"tunnels"`
+	Outbox  Outbox            `json:"outbox"`
+}
+
+// Connection is the state of the agent's stream to the control plane
+type Connection struct {
+	State string    `json:"state"`
+	Since time.Time `json:"since"`
+	// Error is why the agent disconnected
+	Error             string     `json:"error,omitempty"`
+	LastHeartbeatSent *time.Time `json:"last_heartbeat_sent,omitempty"`
+	LastHeartbeatAck  *time.Time `json:"last_heartbeat_ack,omitempty"`
+}
+
+// Outbox is what is waiting to go to the control plane
+type Outbox struct {
+	// Depth is the number of messages waiting to be sent on the stream
+	Depth int64 `json:"depth"`
+}
+
+// Queue is a sender whose pending messages can be counted
+type Queue interface {
+	Pending() int64
+}
+
+// Sources are the parts of the agent the status is gathered from. They are
+// set once the agent has connected; any may be nil.
+type Sources struct {
+	Installers *update.Manager
+	Updater    *update.Updater
+	Forwarder  *access.Forwarder
+	Outbox     Queue
+}
+
+// Tracker records the agent's connection and gathers its status
+type Tracker struct {
+	deviceID     string
+	version      string
+	wireguardIP  string
+	controlPlane string
+	startedAt    time.Time
+
+	mu         sync.Mutex
+	connection Connection
+	sources    Sources
+}
+
+// NewTracker creates a tracker for an agent about to connect
+func NewTracker(deviceID, version, wireguardIP, controlPlane string) *Tracker {
+	now := time.Now()
+	return &Tracker{
+		deviceID:     deviceID,
+		version:      version,
+		wireguardIP:  wireguardIP,
+		controlPlane: controlPlane,
+		startedAt:    now,
+		connection:   Connection{State: StateConnecting, Since: now},
+	}
+}
+
+// SetSources sets the parts of the agent the status is gathered from
+func (t *Tracker) SetSources(sources Sources) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sources = sources
+}
+
+// Connected records that the stream to the control plane is established
+func (t *Tracker) Connected() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connection.State = StateConnected
+	t.connection.Since = time.Now()
+	t.connection.Error = ""
+}
+
+// Disconnected records that the stream to the control plane failed
+func (t *Tracker) Disconnected(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connection.State = StateDisconnected
+	t.connection.Since = time.Now()
+	if err != nil {
+		t.connection.Error = err.Error()
+	}
+}
+
+// HeartbeatSent records that a heartbeat was sent
+func (t *Tracker) HeartbeatSent() {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connection.LastHeartbeatSent = &now
+}
+
+// HeartbeatAcked records that the control plane acknowledged a heartbeat
+func (t *Tracker) HeartbeatAcked() {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connection.LastHeartbeatAck = &now
+}
+
+// Status gathers the agent's current status
+func (t *Tracker) Status() *Status {
+	t.mu.Lock()
+	connection := t.connection
+	sources := t.sources
+	t.mu.Unlock()
+
+	status := &Status{
+		DeviceID:     t.deviceID,
+		Version:      t.version,
+		WireguardIP:  t.wireguardIP,
+		ControlPlane: t.controlPlane,
+		StartedAt:    t.startedAt,
+		Connection:   connection,
+		Slots:        map[string]update.Slot{},
+		Updates:      []update.Progress{},
+	}
+	if sources.Installers != nil {
+		status.Slots = sources.Installers.Slots()
+		if p := sources.Installers.Progress(); p != nil {
+			status.Updates = append(status.Updates, *p)
+		}
+	}
+	if sources.Updater != nil {
+		if p := sources.Updater.Progress(); p != nil {
+			status.Updates = append(status.Updates, *p)
+		}
+	}
+	if sources.Forwarder != nil {
+		status.Tunnels = sources.Forwarder.Stats()
+	}
+	if sources.Outbox != nil {
+		status.Outbox.Depth = sources.Outbox.Pending()
+	}
+	return status
+}
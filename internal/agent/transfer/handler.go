@@ -0,0 +1,357 @@
+// Package transfer serves the control plane's file transfer requests:
+// reading files operators download and assembling the files they upload,
+// chunk by chunk, in place of an access session.
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/agent/policy"
+	"github.com/netf/safeedge/pkg/crypto"
+	"github.com/netf/safeedge/pkg/transfer"
+)
+
+// DefaultDir is where files may be transferred unless configured otherwise
+const DefaultDir = "/var/lib/safeedge/files"
+
+// defaultMode is the permission bits of uploaded files that do not say
+const defaultMode = 0o644
+
+// Sender sends messages to the control plane
+type Sender interface {
+	Send(msg *pb.DeviceMessage) error
+}
+
+// Handler serves file requests for paths below its transfer directories
+// that the device policy permits, with symlinks resolved. Uploads are
+// written to a partial file beside their destination, which survives
+// interruptions so the transfer can resume, and are moved into place only
+// once their size and BLAKE3 hash check out.
+type Handler struct {
+	sender  Sender
+	policy  *policy.Enforcer
+	dirs    []string
+	maxSize int64
+	logger  *zap.Logger
+
+	// writeMu serializes changes to partial files
+	writeMu sync.Mutex
+}
+
+// NewHandler creates a handler for files below dirs of at most maxSize bytes
+func NewHandler(sender Sender, policy *policy.Enforcer, dirs []string, maxSize int64, logger *zap.Logger) *Handler {
+	cleaned := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			logger.Warn("ignoring relative transfer directory", zap.String("dir", dir))
+			continue
+		}
+		cleaned = append(cleaned, filepath.Clean(dir))
+	}
+
+	return &Handler{
+		sender:  sender,
+		policy:  policy,
+		dirs:    cleaned,
+		maxSize: maxSize,
+		logger:  logger,
+	}
+}
+
+// Handle serves a file request and sends the response
+func (h *Handler) Handle(req *pb.FileRequest) {
+	logger := h.logger.With(
+		zap.String("transfer_id", req.TransferId),
+		zap.String("operation", req.Operation.String()),
+		zap.String("path", req.Path),
+	)
+
+	resp, err := h.handle(req)
+	if err != nil {
+		logger.Warn("file request failed", zap.Error(err))
+		resp.Error = err.Error()
+	} else {
+		logger.Debug("file request served", zap.Int64("offset", req.Offset))
+	}
+	resp.RequestId = req.RequestId
+
+	if err := h.sender.Send(&pb.DeviceMessage{
+		Payload: &pb.DeviceMessage_FileResponse{FileResponse: resp},
+	}); err != nil {
+		logger.Error("failed to send file response", zap.Error(err))
+	}
+}
+
+func (h *Handler) handle(req *pb.FileRequest) (*pb.FileResponse, error) {
+	resp := &pb.FileResponse{}
+	if _, err := uuid.Parse(req.TransferId); err != nil {
+		return resp, fmt.Errorf("invalid transfer ID")
+	}
+
+	switch req.Operation {
+	case pb.FileOperation_FILE_OPERATION_STAT:
+		return resp, h.stat(req, resp)
+	case pb.FileOperation_FILE_OPERATION_READ:
+		return resp, h.read(req, resp)
+	case pb.FileOperation_FILE_OPERATION_WRITE:
+		return resp, h.write(req, resp)
+	case pb.FileOperation_FILE_OPERATION_COMMIT:
+		return resp, h.commit(req)
+	case pb.FileOperation_FILE_OPERATION_ABORT:
+		return resp, h.abort(req)
+	default:
+		return resp, fmt.Errorf("unknown file operation")
+	}
+}
+
+// resolve returns the path a request refers to with symlinks resolved,
+// checking it lies below a transfer directory and the device policy permits
+// it. A path that does not exist yet resolves through its directory.
+func (h *Handler) resolve(req *pb.FileRequest) (string, error) {
+	if err := transfer.ValidatePath(req.Path); err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(req.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		dir, dirErr := filepath.EvalSymlinks(filepath.Dir(req.Path))
+		if dirErr != nil {
+			return "", fmt.Errorf("failed to resolve path: %w", dirErr)
+		}
+		resolved, err = filepath.Join(dir, filepath.Base(req.Path)), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	if !h.withinDirs(resolved) {
+		return "", fmt.Errorf("%s is not in a transfer directory", resolved)
+	}
+	if err := h.policy.CheckPath(req.TransferId, resolved); err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+func (h *Handler) withinDirs(name string) bool {
+	for _, dir := range h.dirs {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		if strings.HasPrefix(name, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// openRegular opens a regular file for reading, refusing anything else
+func openRegular(name string) (*os.File, os.FileInfo, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s is not a regular file", name)
+	}
+	return file, info, nil
+}
+
+func (h *Handler) stat(req *pb.FileRequest, resp *pb.FileResponse) error {
+	name, err := h.resolve(req)
+	if err != nil {
+		return err
+	}
+	file, info, err := openRegular(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if info.Size() > h.maxSize {
+		return fmt.Errorf("file is larger than %d bytes", h.maxSize)
+	}
+	hash, err := crypto.BLAKE3HashReader(file)
+	if err != nil {
+		return err
+	}
+
+	resp.Size = info.Size()
+	resp.FileHash = hash
+	resp.Mode = uint32(info.Mode().Perm())
+	return nil
+}
+
+func (h *Handler) read(req *pb.FileRequest, resp *pb.FileResponse) error {
+	if req.Length <= 0 || req.Length > transfer.ChunkSize || req.Offset < 0 {
+		return fmt.Errorf("invalid chunk range")
+	}
+	name, err := h.resolve(req)
+	if err != nil {
+		return err
+	}
+	file, _, err := openRegular(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data := make([]byte, req.Length)
+	n, err := file.ReadAt(data, req.Offset)
+	if err != nil && !(errors.Is(err, io.EOF) && n > 0) {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	resp.Data = data[:n]
+	resp.ChunkHash = crypto.BLAKE3Hash(resp.Data)
+	return nil
+}
+
+// partialPath is where an upload is assembled, beside its destination so
+// it can be renamed into place
+func partialPath(name, transferID string) string {
+	return filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".safeedge-"+transferID)
+}
+
+func (h *Handler) write(req *pb.FileRequest, resp *pb.FileResponse) error {
+	if len(req.Data) > transfer.ChunkSize || req.Offset < 0 {
+		return fmt.Errorf("invalid chunk")
+	}
+	if req.Offset+int64(len(req.Data)) > h.maxSize {
+		return fmt.Errorf("file is larger than %d bytes", h.maxSize)
+	}
+	if !crypto.VerifyBLAKE3(req.Data, req.ChunkHash) {
+		return fmt.Errorf("chunk does not match its hash")
+	}
+	name, err := h.resolve(req)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(name); err == nil && !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", name)
+	}
+
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	file, err := os.OpenFile(partialPath(name, req.TransferId), os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open partial file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat partial file: %w", err)
+	}
+	resp.Received = info.Size()
+
+	// A chunk sent again after its response was lost is already written
+	end := req.Offset + int64(len(req.Data))
+	if end <= resp.Received {
+		return nil
+	}
+	if req.Offset != resp.Received {
+		return fmt.Errorf("chunk at offset %d does not follow the %d bytes received", req.Offset, resp.Received)
+	}
+
+	if _, err := file.WriteAt(req.Data, req.Offset); err != nil {
+		return fmt.Errorf("failed to write partial file: %w", err)
+	}
+	resp.Received = end
+	return nil
+}
+
+func (h *Handler) commit(req *pb.FileRequest) error {
+	if req.Size < 0 || req.Size > h.maxSize {
+		return fmt.Errorf("file is larger than %d bytes", h.maxSize)
+	}
+	name, err := h.resolve(req)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(name); err == nil && !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", name)
+	}
+
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	partial := partialPath(name, req.TransferId)
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open partial file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat partial file: %w", err)
+	}
+	if info.Size() != req.Size {
+		return fmt.Errorf("received %d of %d bytes", info.Size(), req.Size)
+	}
+
+	hash, err := crypto.BLAKE3HashReader(file)
+	if err != nil {
+		return err
+	}
+	if hash != req.FileHash {
+		// Every chunk checked out, so the file is not worth resuming
+		os.Remove(partial)
+		return fmt.Errorf("file does not match its hash")
+	}
+
+	mode := os.FileMode(req.Mode).Perm()
+	if mode == 0 {
+		mode = defaultMode
+	}
+	if err := file.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := os.Rename(partial, name); err != nil {
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	h.logger.Info("file uploaded",
+		zap.String("transfer_id", req.TransferId),
+		zap.String("path", name),
+		zap.Int64("size", req.Size),
+	)
+	return nil
+}
+
+func (h *Handler) abort(req *pb.FileRequest) error {
+	name, err := h.resolve(req)
+	if err != nil {
+		return err
+	}
+
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	if err := os.Remove(partialPath(name, req.TransferId)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove partial file: %w", err)
+	}
+	return nil
+}
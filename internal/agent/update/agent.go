@@ -0,0 +1,269 @@
+// Package update applies the updates the control plane rolls out. Every
+// artifact is downloaded and verified against the BLAKE3 hash and signature
+// the control plane sends. Most are installed by the Installer registered
+// for their type, built in or a plugin, and rolled back if they fail.
+//
+// AGENT artifacts replace the agent itself: the new binary is run in place
+// of the old one, which is kept. Until the new agent has connected to the
+// control plane it is on probation: if it has not by a deadline, the
+// previous agent is restored, by the new agent itself or by a watchdog run
+// from the previous binary.
+package update
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/pkg/installer"
+)
+
+// DefaultDir is where update state and the previous agent binary are kept
+// unless configured otherwise
+const DefaultDir = "/var/lib/safeedge/agent"
+
+// DefaultDeadline is how long a new agent has to connect unless configured
+// otherwise
+const DefaultDeadline = 5 * time.Minute
+
+// versionTimeout bounds running the new binary's version command
+const versionTimeout = 10 * time.Second
+
+// Sender sends messages to the control plane
+type Sender interface {
+	Send(msg *pb.DeviceMessage) error
+}
+
+// Updater applies agent updates and reports how they went
+type Updater struct {
+	sender    Sender
+	lock      *Lock
+	deviceID  string
+	version   string
+	dir       string
+	publicKey string
+	deadline  time.Duration
+	client    *http.Client
+	logger    *zap.Logger
+	progress  progress
+
+	mu sync.Mutex
+	// resumed is the update this agent started up on, until the control
+	// plane has been told how it went
+	resumed *State
+}
+
+// NewUpdater creates an updater for an agent of the given version, keeping
+// its state in dir. Artifacts must be signed with publicKey, the
+// organization's base64 Ed25519 artifact signing key; resumed is what Resume
+// returned. lock is shared with the Manager.
+func NewUpdater(sender Sender, lock *Lock, deviceID, version, dir, publicKey string, deadline time.Duration, resumed *State, logger *zap.Logger) *Updater {
+	return &Updater{
+		sender:    sender,
+		lock:      lock,
+		deviceID:  deviceID,
+		version:   version,
+		dir:       dir,
+		publicKey: publicKey,
+		deadline:  deadline,
+		client:    &http.Client{},
+		logger:    logger,
+		resumed:   resumed,
+	}
+}
+
+// Confirm ends the probation of a new agent, once the control plane has
+// acknowledged a heartbeat, and reports how the update it started up on
+// went
+func (u *Updater) Confirm() {
+	u.mu.Lock()
+	state := u.resumed
+	u.resumed = nil
+	u.mu.Unlock()
+
+	if state == nil {
+		return
+	}
+
+	switch {
+	case state.Status == StatusPending && state.Version != u.version:
+		// The agent restarted before the new binary was put in place
+		u.ack(state.RolloutID, pb.UpdateStatus_UPDATE_STATUS_FAILED,
+			fmt.Sprintf("agent is still at version %s", u.version))
+	case state.Status == StatusPending:
+		u.logger.Info("agent update confirmed",
+			zap.String("version", u.version),
+			zap.String("previous_version", state.PreviousVersion),
+		)
+		u.ack(state.RolloutID, pb.UpdateStatus_UPDATE_STATUS_SUCCESS, "")
+	default:
+		u.ack(state.RolloutID, pb.UpdateStatus_UPDATE_STATUS_FAILED,
+			fmt.Sprintf("rolled back to %s: %s", state.PreviousVersion, state.Error))
+	}
+
+	if err := removeState(u.dir); err != nil {
+		u.logger.Error("failed to clear agent update", zap.Error(err))
+	}
+}
+
+// Apply downloads and verifies a new agent binary, then restarts the agent
+// as it. It only returns if the update fails.
+func (u *Updater) Apply(ctx context.Context, update *pb.UpdateNotification) {
+	logger := u.logger.With(
+		zap.String("rollout_id", update.RolloutId),
+		zap.String("artifact_id", update.ArtifactId),
+	)
+
+	u.mu.Lock()
+	confirming := u.resumed != nil && u.resumed.Status == StatusPending
+	u.mu.Unlock()
+
+	if confirming {
+		u.ack(update.RolloutId, pb.UpdateStatus_UPDATE_STATUS_FAILED, "another agent update is in progress")
+		return
+	}
+	if !u.lock.TryAcquire() {
+		u.ack(update.RolloutId, pb.UpdateStatus_UPDATE_STATUS_FAILED, "another update is in progress")
+		return
+	}
+
+	u.progress.start(update)
+	err := u.apply(ctx, update, logger)
+	u.progress.finish()
+	u.lock.Release()
+
+	logger.Error("agent update failed", zap.Error(err))
+	u.ack(update.RolloutId, pb.UpdateStatus_UPDATE_STATUS_FAILED, err.Error())
+}
+
+func (u *Updater) apply(ctx context.Context, update *pb.UpdateNotification, logger *zap.Logger) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find agent binary: %w", err)
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return fmt.Errorf("failed to find agent binary: %w", err)
+	}
+	if err := os.MkdirAll(u.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create update directory: %w", err)
+	}
+
+	// Downloaded beside the agent binary, so it can be renamed over it
+	tmp, err := os.CreateTemp(filepath.Dir(executable), "."+filepath.Base(executable)+".safeedge-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := fetch(ctx, u.client, update, u.publicKey, tmp, u.ack); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return fmt.Errorf("failed to make binary executable: %w", err)
+	}
+	version, err := binaryVersion(ctx, tmp.Name())
+	if err != nil {
+		return err
+	}
+
+	u.ack(update.RolloutId, pb.UpdateStatus_UPDATE_STATUS_APPLYING, "")
+	previous := filepath.Join(u.dir, previousFile)
+	if err := copyFile(executable, previous); err != nil {
+		return fmt.Errorf("failed to keep previous agent: %w", err)
+	}
+
+	state := &State{
+		RolloutID:       update.RolloutId,
+		ArtifactID:      update.ArtifactId,
+		Status:          StatusPending,
+		Version:         version,
+		PreviousVersion: u.version,
+		Executable:      executable,
+		Previous:        previous,
+		Args:            os.Args,
+		StartedAt:       time.Now(),
+		Deadline:        time.Now().Add(u.deadline),
+	}
+	if err := saveState(u.dir, state); err != nil {
+		return fmt.Errorf("failed to save update state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), executable); err != nil {
+		removeState(u.dir)
+		return fmt.Errorf("failed to replace agent binary: %w", err)
+	}
+
+	if err := startWatchdog(previous, u.dir); err != nil {
+		// The new agent still rolls itself back if it can
+		logger.Error("failed to start update watchdog", zap.Error(err))
+	}
+
+	logger.Info("restarting as the new agent",
+		zap.String("version", version),
+		zap.String("previous_version", u.version),
+	)
+	err = syscall.Exec(executable, os.Args, os.Environ())
+
+	// Still the old agent, but its binary has been replaced
+	if restoreErr := restore(state); restoreErr != nil {
+		logger.Error("failed to restore previous agent", zap.Error(restoreErr))
+	}
+	removeState(u.dir)
+	return fmt.Errorf("failed to start new agent: %w", err)
+}
+
+// Progress returns the agent update in progress, including a new agent's
+// probation, or nil if there is none
+func (u *Updater) Progress() *Progress {
+	if p := u.progress.get(); p != nil {
+		return p
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.resumed == nil || u.resumed.Status != StatusPending {
+		return nil
+	}
+	deadline := u.resumed.Deadline
+	return &Progress{
+		RolloutID:    u.resumed.RolloutID,
+		ArtifactID:   u.resumed.ArtifactID,
+		ArtifactType: installer.TypeAgent,
+		Stage:        ProgressConfirming,
+		StartedAt:    u.resumed.StartedAt,
+		Deadline:     &deadline,
+	}
+}
+
+// ack reports an update's progress to the control plane
+func (u *Updater) ack(rolloutID string, status pb.UpdateStatus, message string) {
+	u.progress.acked(rolloutID, status)
+	sendAck(u.sender, u.deviceID, rolloutID, status, message, u.logger)
+}
+
+// binaryVersion runs a binary's version command, which also checks that it
+// runs on this device
+func binaryVersion(ctx context.Context, path string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, versionTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "version").Output()
+	if err != nil {
+		return "", fmt.Errorf("new agent does not run: %w", err)
+	}
+	version, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if version == "" {
+		return "", errors.New("new agent reported no version")
+	}
+	return version, nil
+}
@@ -0,0 +1,67 @@
+package update
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/netf/safeedge/pkg/installer"
+)
+
+// Deb installs Debian packages with dpkg. Rolling back reinstalls the
+// previous version of the package, or removes it if there was none.
+type Deb struct{}
+
+// NewDeb creates the Debian package installer
+func NewDeb() *Deb {
+	return &Deb{}
+}
+
+func (d *Deb) PreInstall(ctx context.Context, artifact, previous *installer.Artifact) error {
+	if _, err := debPackage(ctx, artifact.Path); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (d *Deb) Install(ctx context.Context, artifact, previous *installer.Artifact) error {
+	return dpkg(ctx, "--install", artifact.Path)
+}
+
+func (d *Deb) Rollback(ctx context.Context, artifact, previous *installer.Artifact) error {
+	if previous != nil {
+		return dpkg(ctx, "--install", previous.Path)
+	}
+
+	name, err := debPackage(ctx, artifact.Path)
+	if err != nil {
+		return err
+	}
+	return dpkg(ctx, "--remove", name)
+}
+
+// debPackage returns the name of the package in a .deb file
+func debPackage(ctx context.Context, path string) (string, error) {
+	out, err := exec.CommandContext(ctx, "dpkg-deb", "--field", path, "Package").Output()
+	if err != nil {
+		return "", fmt.Errorf("not a Debian package: %w", err)
+	}
+	name := strings.TrimSpace(string(out))
+	if name == "" || strings.HasPrefix(name, "-") {
+		return "", fmt.Errorf("not a Debian package: no package name")
+	}
+	return name, nil
+}
+
+func dpkg(ctx context.Context, action, arg string) error {
+	ctx, cancel := context.WithTimeout(ctx, pluginTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "dpkg", action, arg)
+	cmd.Env = append(cmd.Environ(), "DEBIAN_FRONTEND=noninteractive")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("dpkg %s failed: %w%s", action, err, tail(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package update
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+// fetch downloads an artifact into file, which it closes, and checks it
+// against the size, BLAKE3 hash and signature the update gives, reporting
+// progress through ack
+func fetch(ctx context.Context, client *http.Client, update *pb.UpdateNotification, publicKey string, file *os.File, ack func(rolloutID string, status pb.UpdateStatus, message string)) error {
+	if publicKey == "" {
+		file.Close()
+		return errors.New("no artifact public key is configured to verify updates with")
+	}
+
+	ack(update.RolloutId, pb.UpdateStatus_UPDATE_STATUS_DOWNLOADING, "")
+	hash, size, err := download(ctx, client, update.ArtifactUrl, update.SizeBytes, file)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write file: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	ack(update.RolloutId, pb.UpdateStatus_UPDATE_STATUS_VERIFYING, "")
+	if size != update.SizeBytes {
+		return fmt.Errorf("downloaded %d bytes, expected %d", size, update.SizeBytes)
+	}
+	if hash != update.Blake3Hash {
+		return fmt.Errorf("BLAKE3 hash mismatch: got %s", hash)
+	}
+	if !crypto.VerifyEd25519(publicKey, []byte(hash), update.Signature) {
+		return errors.New("artifact signature does not verify")
+	}
+	return nil
+}
+
+// download writes an artifact of at most size bytes to w, returning its
+// BLAKE3 hash and length
+func download(ctx context.Context, client *http.Client, url string, size int64, w io.Writer) (string, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid artifact URL: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to download artifact: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("failed to download artifact: %s", resp.Status)
+	}
+
+	counter := &countingWriter{w: w}
+	hash, err := crypto.BLAKE3HashReader(io.TeeReader(io.LimitReader(resp.Body, size+1), counter))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to download artifact: %w", err)
+	}
+	if counter.err != nil {
+		return "", 0, fmt.Errorf("failed to write file: %w", counter.err)
+	}
+	return hash, counter.n, nil
+}
+
+// sendAck reports an update's progress to the control plane
+func sendAck(sender Sender, deviceID, rolloutID string, status pb.UpdateStatus, message string, logger *zap.Logger) {
+	if err := sender.Send(&pb.DeviceMessage{
+		Payload: &pb.DeviceMessage_UpdateAck{
+			UpdateAck: &pb.UpdateAck{
+				DeviceId:     deviceID,
+				RolloutId:    rolloutID,
+				Status:       status,
+				ErrorMessage: message,
+				Timestamp:    timestamppb.Now(),
+			},
+		},
+	}); err != nil {
+		logger.Error("failed to send update ack", zap.Error(err))
+	}
+}
+
+// countingWriter counts the bytes written through it. A write error is kept
+// rather than returned, so the hash of the whole download is still taken.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	if c.err == nil {
+		_, c.err = c.w.Write(p)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,38 @@
+package update
+
+import (
+	"context"
+
+	"github.com/netf/safeedge/pkg/installer"
+)
+
+// Installer installs artifacts of one type. Previous is the artifact
+// installed in the same slot before, or nil if there was none.
+type Installer interface {
+	// Install installs the artifact in place of previous
+	Install(ctx context.Context, artifact, previous *installer.Artifact) error
+	// Rollback undoes installing the artifact, reinstating previous or
+	// removing the artifact if previous is nil
+	Rollback(ctx context.Context, artifact, previous *installer.Artifact) error
+}
+
+// PreInstaller is an Installer with a hook run before anything changes,
+// such as to check that the artifact suits the device. An error aborts the
+// update with nothing to roll back.
+type PreInstaller interface {
+	PreInstall(ctx context.Context, artifact, previous *installer.Artifact) error
+}
+
+// PostInstaller is an Installer with a hook run once the artifact is
+// installed, such as to restart what uses it. An error rolls the update
+// back.
+type PostInstaller interface {
+	PostInstall(ctx context.Context, artifact, previous *installer.Artifact) error
+}
+
+// HealthChecker is an Installer that probes whether an installed artifact
+// works, on top of the rollout's health check URL. An unhealthy artifact is
+// rolled back.
+type HealthChecker interface {
+	Health(ctx context.Context, artifact *installer.Artifact) error
+}
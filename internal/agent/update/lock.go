@@ -0,0 +1,29 @@
+package update
+
+import "sync"
+
+// Lock lets one update or rollback run on the device at a time, whether the
+// Updater or the Manager applies it. The agent replacing itself part way
+// through installing an artifact would leave the artifact half installed.
+type Lock struct {
+	mu   sync.Mutex
+	held bool
+}
+
+// TryAcquire takes the lock if it is free, reporting whether it did
+func (l *Lock) TryAcquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.held {
+		return false
+	}
+	l.held = true
+	return true
+}
+
+// Release frees the lock
+func (l *Lock) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = false
+}
@@ -0,0 +1,428 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/pkg/installer"
+)
+
+// DefaultArtifactDir is where installed artifacts and their slots are kept
+// unless configured otherwise
+const DefaultArtifactDir = "/var/lib/safeedge/artifacts"
+
+// slotsFile records the slots in the artifact directory
+const slotsFile = "slots.json"
+
+// A newly installed artifact is probed every healthInterval until it is
+// healthy or healthTimeout passes, each probe taking up to probeTimeout
+const (
+	healthInterval = 5 * time.Second
+	healthTimeout  = time.Minute
+	probeTimeout   = 30 * time.Second
+)
+
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Slot is what is installed under an artifact name: the current artifact
+// and the one before it, kept to roll back to
+type Slot struct {
+	Current  *installer.Artifact `json:"current"`
+	Previous *installer.Artifact `json:"previous,omitempty"`
+}
+
+// Manager installs artifacts with the installer registered for their type,
+// one update at a time, agent updates included. Each artifact name is a
+// slot whose current and previous artifacts are kept in the artifact
+// directory. An artifact that fails to install, fails its post-install hook
+// or is not healthy is rolled back to the previous one.
+type Manager struct {
+	sender    Sender
+	lock      *Lock
+	deviceID  string
+	dir       string
+	publicKey string
+	client    *http.Client
+	logger    *zap.Logger
+
+	installers map[string]Installer
+	progress   progress
+
+	mu    sync.Mutex
+	slots map[string]*Slot
+}
+
+// NewManager creates a manager keeping artifacts in dir. Artifacts must be
+// signed with publicKey, the organization's base64 Ed25519 artifact signing
+// key. lock is shared with the Updater.
+func NewManager(sender Sender, lock *Lock, deviceID, dir, publicKey string, logger *zap.Logger) (*Manager, error) {
+	m := &Manager{
+		sender:     sender,
+		lock:       lock,
+		deviceID:   deviceID,
+		dir:        dir,
+		publicKey:  publicKey,
+		client:     &http.Client{},
+		logger:     logger,
+		installers: map[string]Installer{},
+		slots:      map[string]*Slot{},
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, slotsFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read slots: %w", err)
+	}
+	if err := json.Unmarshal(data, &m.slots); err != nil {
+		return nil, fmt.Errorf("failed to parse slots: %w", err)
+	}
+	return m, nil
+}
+
+// Register installs artifacts of a type with inst, in place of any
+// installer registered for it before
+func (m *Manager) Register(artifactType string, inst Installer) {
+	m.installers[artifactType] = inst
+}
+
+// Apply downloads, verifies and installs an artifact, reporting progress and
+// the result to the control plane
+func (m *Manager) Apply(ctx context.Context, update *pb.UpdateNotification) {
+	logger := m.logger.With(
+		zap.String("rollout_id", update.RolloutId),
+		zap.String("artifact_id", update.ArtifactId),
+		zap.String("artifact_type", update.ArtifactType),
+	)
+
+	inst, ok := m.installers[update.ArtifactType]
+	if !ok {
+		logger.Warn("no installer for artifact type")
+		m.ack(update.RolloutId, pb.UpdateStatus_UPDATE_STATUS_FAILED,
+			fmt.Sprintf("no installer for %s artifacts", update.ArtifactType))
+		return
+	}
+
+	if !m.lock.TryAcquire() {
+		m.ack(update.RolloutId, pb.UpdateStatus_UPDATE_STATUS_FAILED, "another update is in progress")
+		return
+	}
+
+	m.progress.start(update)
+	err := m.apply(ctx, update, inst, logger)
+	m.progress.finish()
+	m.lock.Release()
+
+	if err != nil {
+		logger.Error("update failed", zap.Error(err))
+		m.ack(update.RolloutId, pb.UpdateStatus_UPDATE_STATUS_FAILED, err.Error())
+		return
+	}
+	m.ack(update.RolloutId, pb.UpdateStatus_UPDATE_STATUS_SUCCESS, "")
+}
+
+func (m *Manager) apply(ctx context.Context, update *pb.UpdateNotification, inst Installer, logger *zap.Logger) error {
+	if !hashPattern.MatchString(update.Blake3Hash) {
+		return fmt.Errorf("invalid BLAKE3 hash %q", update.Blake3Hash)
+	}
+	if err := os.MkdirAll(m.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(m.dir, ".download-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := fetch(ctx, m.client, update, m.publicKey, tmp, m.ack); err != nil {
+		return err
+	}
+	path := filepath.Join(m.dir, update.Blake3Hash)
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	artifact := &installer.Artifact{
+		ID:             update.ArtifactId,
+		Name:           update.ArtifactName,
+		Type:           update.ArtifactType,
+		RolloutID:      update.RolloutId,
+		BLAKE3Hash:     update.Blake3Hash,
+		SizeBytes:      update.SizeBytes,
+		Path:           path,
+		HealthCheckURL: update.HealthCheckUrl,
+	}
+	slot := slotName(artifact)
+
+	m.mu.Lock()
+	var previous *installer.Artifact
+	if s, ok := m.slots[slot]; ok {
+		previous = s.Current
+	}
+	m.mu.Unlock()
+
+	m.ack(update.RolloutId, pb.UpdateStatus_UPDATE_STATUS_APPLYING, "")
+
+	if pre, ok := inst.(PreInstaller); ok {
+		if err := pre.PreInstall(ctx, artifact, previous); err != nil {
+			m.prune()
+			return fmt.Errorf("pre-install hook failed: %w", err)
+		}
+	}
+
+	if err := inst.Install(ctx, artifact, previous); err != nil {
+		return m.rollback(ctx, inst, artifact, previous, fmt.Errorf("install failed: %w", err), logger)
+	}
+	if post, ok := inst.(PostInstaller); ok {
+		if err := post.PostInstall(ctx, artifact, previous); err != nil {
+			return m.rollback(ctx, inst, artifact, previous, fmt.Errorf("post-install hook failed: %w", err), logger)
+		}
+	}
+	if err := m.checkHealth(ctx, inst, artifact); err != nil {
+		return m.rollback(ctx, inst, artifact, previous, fmt.Errorf("health check failed: %w", err), logger)
+	}
+
+	m.mu.Lock()
+	m.slots[slot] = &Slot{Current: artifact, Previous: previous}
+	err = m.saveSlots()
+	m.mu.Unlock()
+	if err != nil {
+		logger.Error("failed to save slots", zap.Error(err))
+	}
+	m.prune()
+
+	logger.Info("artifact installed", zap.String("slot", slot))
+	return nil
+}
+
+// rollback undoes an install that failed with cause
+func (m *Manager) rollback(ctx context.Context, inst Installer, artifact, previous *installer.Artifact, cause error, logger *zap.Logger) error {
+	logger.Warn("rolling back update", zap.Error(cause))
+	m.progress.setStage(artifact.RolloutID, ProgressRollingBack)
+	defer m.prune()
+
+	if err := inst.Rollback(ctx, artifact, previous); err != nil {
+		logger.Error("rollback failed", zap.Error(err))
+		return fmt.Errorf("%w; rollback failed: %v", cause, err)
+	}
+	return fmt.Errorf("%w; rolled back", cause)
+}
+
+// Rollback reinstates the artifact installed before the one a rollout
+// installed, at the control plane's request
+func (m *Manager) Rollback(ctx context.Context, req *pb.RollbackRequest) {
+	logger := m.logger.With(
+		zap.String("rollout_id", req.RolloutId),
+		zap.String("reason", req.Reason),
+	)
+
+	if !m.lock.TryAcquire() {
+		logger.Warn("cannot roll back while an update is in progress")
+		return
+	}
+	defer m.lock.Release()
+
+	m.mu.Lock()
+	var name string
+	var slot *Slot
+	for n, s := range m.slots {
+		if s.Current != nil && s.Current.RolloutID == req.RolloutId {
+			name, slot = n, s
+			break
+		}
+	}
+	if slot == nil {
+		m.mu.Unlock()
+		logger.Warn("no artifact installed by rollout to roll back")
+		return
+	}
+	m.mu.Unlock()
+
+	m.progress.startRollback(slot.Current)
+	defer m.progress.finish()
+
+	inst, ok := m.installers[slot.Current.Type]
+	if !ok {
+		logger.Error("no installer to roll back with", zap.String("artifact_type", slot.Current.Type))
+		return
+	}
+	if err := inst.Rollback(ctx, slot.Current, slot.Previous); err != nil {
+		logger.Error("rollback failed", zap.Error(err))
+		return
+	}
+
+	m.mu.Lock()
+	if slot.Previous != nil {
+		m.slots[name] = &Slot{Current: slot.Previous}
+	} else {
+		delete(m.slots, name)
+	}
+	err := m.saveSlots()
+	m.mu.Unlock()
+	if err != nil {
+		logger.Error("failed to save slots", zap.Error(err))
+	}
+	m.prune()
+
+	logger.Info("rolled back", zap.String("slot", name))
+}
+
+// Slots returns a copy of what is installed in each slot
+func (m *Manager) Slots() map[string]Slot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	slots := make(map[string]Slot, len(m.slots))
+	for name, s := range m.slots {
+		slots[name] = *s
+	}
+	return slots
+}
+
+// Progress returns the update or rollback in progress, or nil if there is
+// none
+func (m *Manager) Progress() *Progress {
+	return m.progress.get()
+}
+
+// checkHealth probes a newly installed artifact until it is healthy or
+// healthTimeout passes, and reports the result to the control plane
+func (m *Manager) checkHealth(ctx context.Context, inst Installer, artifact *installer.Artifact) error {
+	checker, _ := inst.(HealthChecker)
+	if checker == nil && artifact.HealthCheckURL == "" {
+		return nil
+	}
+
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+	deadline := time.After(healthTimeout)
+
+	statusCode, err := m.probe(ctx, checker, artifact)
+probing:
+	for err != nil {
+		select {
+		case <-ctx.Done():
+			break probing
+		case <-deadline:
+			break probing
+		case <-ticker.C:
+			statusCode, err = m.probe(ctx, checker, artifact)
+		}
+	}
+
+	report := &pb.HealthReport{
+		DeviceId:       m.deviceID,
+		RolloutId:      artifact.RolloutID,
+		Healthy:        err == nil,
+		HealthCheckUrl: artifact.HealthCheckURL,
+		HttpStatusCode: int32(statusCode),
+		Timestamp:      timestamppb.Now(),
+	}
+	if err != nil {
+		report.ErrorMessage = err.Error()
+	}
+	if sendErr := m.sender.Send(&pb.DeviceMessage{
+		Payload: &pb.DeviceMessage_Health{Health: report},
+	}); sendErr != nil {
+		m.logger.Error("failed to send health report", zap.Error(sendErr))
+	}
+	return err
+}
+
+// probe checks an artifact's health once: the rollout's health check URL
+// must answer 2xx and the installer's own check pass
+func (m *Manager) probe(ctx context.Context, checker HealthChecker, artifact *installer.Artifact) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	var statusCode int
+	if artifact.HealthCheckURL != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, artifact.HealthCheckURL, nil)
+		if err != nil {
+			return 0, fmt.Errorf("invalid health check URL: %w", err)
+		}
+		resp, err := m.client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		statusCode = resp.StatusCode
+		if statusCode < 200 || statusCode > 299 {
+			return statusCode, fmt.Errorf("health check returned %s", resp.Status)
+		}
+	}
+	if checker != nil {
+		if err := checker.Health(ctx, artifact); err != nil {
+			return statusCode, err
+		}
+	}
+	return statusCode, nil
+}
+
+// saveSlots records the slots. m.mu must be held.
+func (m *Manager) saveSlots() error {
+	data, err := json.MarshalIndent(m.slots, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(m.dir, slotsFile), data, 0o600)
+}
+
+// prune removes artifact files no slot refers to
+func (m *Manager) prune() {
+	m.mu.Lock()
+	keep := map[string]bool{}
+	for _, s := range m.slots {
+		for _, a := range []*installer.Artifact{s.Current, s.Previous} {
+			if a != nil {
+				keep[a.BLAKE3Hash] = true
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if hashPattern.MatchString(entry.Name()) && !keep[entry.Name()] {
+			if err := os.Remove(filepath.Join(m.dir, entry.Name())); err != nil {
+				m.logger.Warn("failed to remove artifact", zap.String("file", entry.Name()), zap.Error(err))
+			}
+		}
+	}
+}
+
+// ack reports an update's progress to the control plane
+func (m *Manager) ack(rolloutID string, status pb.UpdateStatus, message string) {
+	m.progress.acked(rolloutID, status)
+	sendAck(m.sender, m.deviceID, rolloutID, status, message, m.logger)
+}
+
+// slotName is the slot an artifact is installed in: its name, or its type
+// for artifacts without one
+func slotName(artifact *installer.Artifact) string {
+	if artifact.Name != "" {
+		return artifact.Name
+	}
+	return artifact.Type
+}
@@ -0,0 +1,165 @@
+package update
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/pkg/installer"
+)
+
+// Time limits of plugin operations. Installing firmware can take a while.
+const (
+	describeTimeout = 30 * time.Second
+	pluginTimeout   = 30 * time.Minute
+)
+
+// maxPluginOutput bounds what is kept of a plugin's standard output and
+// error
+const maxPluginOutput = 64 * 1024
+
+// Plugin is an Installer run as an external process, speaking the
+// protocol of package installer. Hooks the plugin does not implement
+// succeed without running it.
+type Plugin struct {
+	artifactType string
+	path         string
+	operations   []string
+	logger       *zap.Logger
+}
+
+// NewPlugin asks the plugin executable at path which operations it
+// implements
+func NewPlugin(ctx context.Context, artifactType, path string, logger *zap.Logger) (*Plugin, error) {
+	p := &Plugin{
+		artifactType: artifactType,
+		path:         path,
+		logger:       logger.With(zap.String("artifact_type", artifactType), zap.String("plugin", path)),
+	}
+
+	resp, err := p.run(ctx, installer.OpDescribe, nil, nil, describeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(resp.Operations, installer.OpInstall) {
+		return nil, fmt.Errorf("plugin %s does not implement %s", path, installer.OpInstall)
+	}
+	p.operations = resp.Operations
+	return p, nil
+}
+
+func (p *Plugin) PreInstall(ctx context.Context, artifact, previous *installer.Artifact) error {
+	return p.call(ctx, installer.OpPreInstall, artifact, previous, pluginTimeout)
+}
+
+func (p *Plugin) Install(ctx context.Context, artifact, previous *installer.Artifact) error {
+	return p.call(ctx, installer.OpInstall, artifact, previous, pluginTimeout)
+}
+
+func (p *Plugin) PostInstall(ctx context.Context, artifact, previous *installer.Artifact) error {
+	return p.call(ctx, installer.OpPostInstall, artifact, previous, pluginTimeout)
+}
+
+func (p *Plugin) Health(ctx context.Context, artifact *installer.Artifact) error {
+	return p.call(ctx, installer.OpHealth, artifact, nil, probeTimeout)
+}
+
+func (p *Plugin) Rollback(ctx context.Context, artifact, previous *installer.Artifact) error {
+	if !slices.Contains(p.operations, installer.OpRollback) {
+		return fmt.Errorf("plugin %s cannot roll back", p.path)
+	}
+	return p.call(ctx, installer.OpRollback, artifact, previous, pluginTimeout)
+}
+
+// call performs an operation, if the plugin implements it
+func (p *Plugin) call(ctx context.Context, operation string, artifact, previous *installer.Artifact, timeout time.Duration) error {
+	if !slices.Contains(p.operations, operation) {
+		return nil
+	}
+	_, err := p.run(ctx, operation, artifact, previous, timeout)
+	return err
+}
+
+// run sends the plugin a request and returns its successful response
+func (p *Plugin) run(ctx context.Context, operation string, artifact, previous *installer.Artifact, timeout time.Duration) (*installer.Response, error) {
+	req, err := json.Marshal(installer.Request{
+		Protocol:  installer.ProtocolVersion,
+		Operation: operation,
+		Artifact:  artifact,
+		Previous:  previous,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout := &limitedBuffer{limit: maxPluginOutput}
+	stderr := &limitedBuffer{limit: maxPluginOutput}
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Stdin = bytes.NewReader(append(req, '\n'))
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	runErr := cmd.Run()
+	if stderr.Len() > 0 {
+		p.logger.Info("plugin output",
+			zap.String("operation", operation),
+			zap.String("stderr", strings.TrimSpace(stderr.String())),
+		)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("plugin %s timed out after %s", operation, timeout)
+	}
+
+	var resp installer.Response
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("plugin %s failed: %w%s", operation, runErr, tail(stderr.String()))
+		}
+		return nil, fmt.Errorf("plugin %s gave an invalid response: %w", operation, err)
+	}
+	if !resp.OK {
+		if resp.Error == "" {
+			resp.Error = "no reason given"
+		}
+		return nil, fmt.Errorf("plugin %s failed: %s", operation, resp.Error)
+	}
+	if runErr != nil {
+		return nil, fmt.Errorf("plugin %s failed: %w%s", operation, runErr, tail(stderr.String()))
+	}
+	return &resp, nil
+}
+
+// tail returns the last line of a plugin's standard error, to explain a
+// failure
+func tail(stderr string) string {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if last := lines[len(lines)-1]; last != "" {
+		return ": " + last
+	}
+	return ""
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the
+// rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,101 @@
+package update
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/pkg/installer"
+)
+
+// Stages of an update in progress besides those reported to the control
+// plane
+const (
+	// ProgressRollingBack is an artifact being rolled back
+	ProgressRollingBack = "ROLLING_BACK"
+	// ProgressConfirming is a new agent on probation, waiting for the
+	// control plane to acknowledge it
+	ProgressConfirming = "CONFIRMING"
+)
+
+// Progress is an update being applied
+type Progress struct {
+	RolloutID    string `json:"rollout_id"`
+	ArtifactID   string `json:"artifact_id"`
+	ArtifactName string `json:"artifact_name,omitempty"`
+	ArtifactType string `json:"artifact_type"`
+	// Stage is DOWNLOADING, VERIFYING, APPLYING, ROLLING_BACK or CONFIRMING
+	Stage     string    `json:"stage"`
+	StartedAt time.Time `json:"started_at"`
+	// Deadline is when a new agent on probation is rolled back
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+// progress tracks the update in progress, if any
+type progress struct {
+	mu      sync.Mutex
+	current *Progress
+}
+
+func (p *progress) start(update *pb.UpdateNotification) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = &Progress{
+		RolloutID:    update.RolloutId,
+		ArtifactID:   update.ArtifactId,
+		ArtifactName: update.ArtifactName,
+		ArtifactType: update.ArtifactType,
+		StartedAt:    time.Now(),
+	}
+}
+
+// startRollback tracks rolling back an installed artifact
+func (p *progress) startRollback(artifact *installer.Artifact) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = &Progress{
+		RolloutID:    artifact.RolloutID,
+		ArtifactID:   artifact.ID,
+		ArtifactName: artifact.Name,
+		ArtifactType: artifact.Type,
+		Stage:        ProgressRollingBack,
+		StartedAt:    time.Now(),
+	}
+}
+
+// acked records the stage of a rollout's update from what is reported to
+// the control plane
+func (p *progress) acked(rolloutID string, status pb.UpdateStatus) {
+	switch status {
+	case pb.UpdateStatus_UPDATE_STATUS_DOWNLOADING,
+		pb.UpdateStatus_UPDATE_STATUS_VERIFYING,
+		pb.UpdateStatus_UPDATE_STATUS_APPLYING:
+		p.setStage(rolloutID, strings.TrimPrefix(status.String(), "UPDATE_STATUS_"))
+	}
+}
+
+func (p *progress) setStage(rolloutID, stage string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current != nil && p.current.RolloutID == rolloutID {
+		p.current.Stage = stage
+	}
+}
+
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = nil
+}
+
+// get returns a copy of the update in progress, or nil if there is none
+func (p *progress) get() *Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current == nil {
+		return nil
+	}
+	current := *p.current
+	return &current
+}
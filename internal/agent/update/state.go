@@ -0,0 +1,156 @@
+package update
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Statuses of an agent update once the new binary is in place
+const (
+	// StatusPending is an update whose new agent has yet to connect
+	StatusPending = "PENDING"
+	// StatusRolledBack is an update undone by restoring the previous agent
+	StatusRolledBack = "ROLLED_BACK"
+)
+
+// stateFile and previousFile are kept in the update directory
+const (
+	stateFile    = "update.json"
+	previousFile = "agent.previous"
+)
+
+// State is an agent update in progress, kept in the update directory from
+// the moment the new binary replaces the running one until the control
+// plane has heard how it went
+type State struct {
+	RolloutID  string `json:"rollout_id"`
+	ArtifactID string `json:"artifact_id"`
+	Status     string `json:"status"`
+	// Version is what the new binary's version command printed
+	Version         string `json:"version"`
+	PreviousVersion string `json:"previous_version"`
+	// Executable is the agent binary's path, Previous the copy of the
+	// binary it replaced
+	Executable string `json:"executable"`
+	Previous   string `json:"previous"`
+	// Args are the agent's command line, to start it again with
+	Args []string `json:"args"`
+	// PID is the process the new agent runs as
+	PID       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Deadline  time.Time `json:"deadline"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// LoadState returns the agent update in progress, or nil if there is none
+func LoadState(dir string) (*State, error) {
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read update state: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse update state: %w", err)
+	}
+	return &state, nil
+}
+
+// saveState replaces the update state atomically
+func saveState(dir string, state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, stateFile), data, 0o600)
+}
+
+// removeState forgets the agent update in progress
+func removeState(dir string) error {
+	if err := os.Remove(filepath.Join(dir, stateFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove update state: %w", err)
+	}
+	return nil
+}
+
+// restore puts the previous agent binary back in place
+func restore(state *State) error {
+	if err := copyFile(state.Previous, state.Executable); err != nil {
+		return fmt.Errorf("failed to restore previous agent: %w", err)
+	}
+	return nil
+}
+
+// copyFile replaces dst with a copy of src, keeping src's permission bits.
+// The copy is written beside dst and renamed over it, so a running binary
+// at dst is never modified in place.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".safeedge-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// writeFile replaces path with data atomically
+func writeFile(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".safeedge-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,189 @@
+package update
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// watchdogGrace is how long past the deadline the watchdog process waits,
+// leaving the new agent to roll itself back first
+const watchdogGrace = 30 * time.Second
+
+// stopTimeout is how long the watchdog gives the new agent to exit before
+// killing it
+const stopTimeout = 10 * time.Second
+
+// Resume picks up an agent update when the agent starts. An agent on
+// probation that is past its deadline restores the previous agent and
+// becomes it; otherwise it does so at the deadline unless Confirm is called
+// first. The update is returned so the control plane can be told how it
+// went once the agent connects.
+func Resume(dir string, logger *zap.Logger) (*State, error) {
+	state, err := LoadState(dir)
+	if err != nil || state == nil || state.Status != StatusPending {
+		return state, err
+	}
+
+	if time.Now().After(state.Deadline) {
+		return nil, rollback(dir, state, "the new agent did not connect before its deadline", logger)
+	}
+
+	state.PID = os.Getpid()
+	if err := saveState(dir, state); err != nil {
+		return nil, fmt.Errorf("failed to save update state: %w", err)
+	}
+
+	logger.Info("agent update on probation",
+		zap.String("version", state.Version),
+		zap.Time("deadline", state.Deadline),
+	)
+
+	go func() {
+		time.Sleep(time.Until(state.Deadline))
+
+		// Confirm removes the state once the new agent has connected
+		current, err := LoadState(dir)
+		if err != nil {
+			logger.Error("failed to check agent update", zap.Error(err))
+			return
+		}
+		if current == nil || current.Status != StatusPending {
+			return
+		}
+		if err := rollback(dir, current, "the new agent did not connect before its deadline", logger); err != nil {
+			logger.Error("failed to roll back agent update", zap.Error(err))
+		}
+	}()
+
+	return state, nil
+}
+
+// rollback restores the previous agent and replaces this process with it.
+// It only returns if that fails.
+func rollback(dir string, state *State, reason string, logger *zap.Logger) error {
+	logger.Warn("rolling back agent update",
+		zap.String("version", state.Version),
+		zap.String("previous_version", state.PreviousVersion),
+		zap.String("reason", reason),
+	)
+
+	if err := markRolledBack(dir, state, reason); err != nil {
+		return err
+	}
+	return syscall.Exec(state.Executable, state.Args, os.Environ())
+}
+
+// markRolledBack restores the previous agent binary and records why
+func markRolledBack(dir string, state *State, reason string) error {
+	if err := restore(state); err != nil {
+		return err
+	}
+	state.Status = StatusRolledBack
+	state.Error = reason
+	if err := saveState(dir, state); err != nil {
+		return fmt.Errorf("failed to save update state: %w", err)
+	}
+	return nil
+}
+
+// Watchdog runs in the previous agent's binary, apart from the new agent,
+// and restores the previous agent if the new one has not connected shortly
+// after its deadline, even if it hangs or keeps crashing before it can roll
+// itself back. The new agent is stopped; when supervised, the service
+// manager starts the restored agent, otherwise the watchdog becomes it.
+func Watchdog(dir string, supervised bool, logger *zap.Logger) error {
+	state, err := LoadState(dir)
+	if err != nil || state == nil || state.Status != StatusPending {
+		return err
+	}
+
+	time.Sleep(time.Until(state.Deadline.Add(watchdogGrace)))
+
+	state, err = LoadState(dir)
+	if err != nil || state == nil || state.Status != StatusPending {
+		return err
+	}
+
+	logger.Warn("new agent did not connect, restoring the previous agent",
+		zap.String("version", state.Version),
+		zap.String("previous_version", state.PreviousVersion),
+	)
+	if err := markRolledBack(dir, state, "the new agent did not connect before its deadline"); err != nil {
+		return err
+	}
+
+	if state.PID != 0 && runs(state.PID, state.Executable) {
+		stop(state.PID)
+	}
+	if supervised {
+		return nil
+	}
+	return syscall.Exec(state.Executable, state.Args, os.Environ())
+}
+
+// runs reports whether pid is still a process of the agent binary at
+// executable, rather than one that has since been given its ID
+func runs(pid int, executable string) bool {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return false
+	}
+	// The binary was replaced since the process started
+	exe = filepath.Clean(trimDeleted(exe))
+	return exe == executable
+}
+
+func trimDeleted(path string) string {
+	const suffix = " (deleted)"
+	if len(path) > len(suffix) && path[len(path)-len(suffix):] == suffix {
+		return path[:len(path)-len(suffix)]
+	}
+	return path
+}
+
+// stop asks a process to exit, killing it if it has not within stopTimeout
+func stop(pid int) {
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return
+	}
+	deadline := time.Now().Add(stopTimeout)
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	syscall.Kill(pid, syscall.SIGKILL)
+}
+
+// startWatchdog starts the watchdog from the previous agent's binary. Under
+// systemd it runs as a transient unit of its own, so that it outlives the
+// agent's unit stopping or restarting.
+func startWatchdog(previous, dir string) error {
+	supervised := os.Getenv("INVOCATION_ID") != ""
+	args := []string{"update-watchdog", "--update-dir", dir}
+	if supervised {
+		args = append(args, "--supervised")
+		if systemdRun, err := exec.LookPath("systemd-run"); err == nil {
+			cmd := exec.Command(systemdRun, append([]string{"--quiet", "--collect", "--", previous}, args...)...)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("systemd-run failed: %w: %s", err, out)
+			}
+			return nil
+		}
+	}
+
+	cmd := exec.Command(previous, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
@@ -7,9 +7,11 @@ package generated
 
 import (
 	"context"
+	"net"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const createAccessSession = `-- name: CreateAccessSession :one
@@ -17,18 +19,24 @@ INSERT INTO access_sessions (
   device_id,
   user_email,
   wireguard_peer_config,
-  expires_at
+  expires_at,
+  client_wireguard_public_key,
+  client_wireguard_ip,
+  allowed_destinations
 ) VALUES (
-  $1, $2, $3, $4
+  $1, $2, $3, $4, $5, $6, $7
 )
-RETURNING id, device_id, user_email, wireguard_peer_config, expires_at, terminated_at, created_at
+RETURNING id, device_id, user_email, wireguard_peer_config, expires_at, terminated_at, created_at, client_wireguard_public_key, client_wireguard_ip, allowed_destinations
 `
 
 type CreateAccessSessionParams struct {
-	DeviceID            uuid.UUID `json:"device_id"`
-	UserEmail           string    `json:"user_email"`
-	WireguardPeerConfig string    `json:"wireguard_peer_config"`
-	ExpiresAt           time.Time `json:"expires_at"`
+	DeviceID                 uuid.UUID   `json:"device_id"`
+	UserEmail                string      `json:"user_email"`
+	WireguardPeerConfig      string      `json:"wireguard_peer_config"`
+	ExpiresAt                time.Time   `json:"expires_at"`
+	ClientWireguardPublicKey pgtype.Text `json:"client_wireguard_public_key"`
+	ClientWireguardIp        net.IP      `json:"client_wireguard_ip"`
+	AllowedDestinations      []string    `json:"allowed_destinations"`
 }
 
 func (q *Queries) CreateAccessSession(ctx context.Context, arg CreateAccessSessionParams) (AccessSession, error) {
@@ -37,6 +45,9 @@ func (q *Queries) CreateAccessSession(ctx context.Context, arg CreateAccessSessi
 		arg.UserEmail,
 		arg.WireguardPeerConfig,
 		arg.ExpiresAt,
+		arg.ClientWireguardPublicKey,
+		arg.ClientWireguardIp,
+		arg.AllowedDestinations,
 	)
 	var i AccessSession
 	err := row.Scan(
@@ -47,24 +58,54 @@ func (q *Queries) CreateAccessSession(ctx context.Context, arg CreateAccessSessi
 		&i.ExpiresAt,
 		&i.TerminatedAt,
 		&i.CreatedAt,
+		&i.ClientWireguardPublicKey,
+		&i.ClientWireguardIp,
+		&i.AllowedDestinations,
 	)
 	return i, err
 }
 
-const expireOldSessions = `-- name: ExpireOldSessions :exec
+const expireOldSessions = `-- name: ExpireOldSessions :many
 UPDATE access_sessions
 SET terminated_at = NOW()
 WHERE expires_at < NOW()
   AND terminated_at IS NULL
+RETURNING id, device_id, user_email, wireguard_peer_config, expires_at, terminated_at, created_at, client_wireguard_public_key, client_wireguard_ip, allowed_destinations
 `
 
-func (q *Queries) ExpireOldSessions(ctx context.Context) error {
-	_, err := q.db.Exec(ctx, expireOldSessions)
-	return err
+func (q *Queries) ExpireOldSessions(ctx context.Context) ([]AccessSession, error) {
+	rows, err := q.db.Query(ctx, expireOldSessions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AccessSession{}
+	for rows.Next() {
+		var i AccessSession
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeviceID,
+			&i.UserEmail,
+			&i.WireguardPeerConfig,
+			&i.ExpiresAt,
+			&i.TerminatedAt,
+			&i.CreatedAt,
+			&i.ClientWireguardPublicKey,
+			&i.ClientWireguardIp,
+			&i.AllowedDestinations,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const getAccessSession = `-- name: GetAccessSession :one
-SELECT id, device_id, user_email, wireguard_peer_config, expires_at, terminated_at, created_at FROM access_sessions
+SELECT id, device_id, user_email, wireguard_peer_config, expires_at, terminated_at, created_at, client_wireguard_public_key, client_wireguard_ip, allowed_destinations FROM access_sessions
 WHERE id = $1 AND terminated_at IS NULL
 `
 
@@ -79,12 +120,15 @@ func (q *Queries) GetAccessSession(ctx context.Context, id uuid.UUID) (AccessSes
 		&i.ExpiresAt,
 		&i.TerminatedAt,
 		&i.CreatedAt,
+		&i.ClientWireguardPublicKey,
+		&i.ClientWireguardIp,
+		&i.AllowedDestinations,
 	)
 	return i, err
 }
 
 const listActiveAccessSessions = `-- name: ListActiveAccessSessions :many
-SELECT id, device_id, user_email, wireguard_peer_config, expires_at, terminated_at, created_at FROM access_sessions
+SELECT id, device_id, user_email, wireguard_peer_config, expires_at, terminated_at, created_at, client_wireguard_public_key, client_wireguard_ip, allowed_destinations FROM access_sessions
 WHERE device_id = $1
   AND terminated_at IS NULL
   AND expires_at > NOW()
@@ -108,6 +152,9 @@ func (q *Queries) ListActiveAccessSessions(ctx context.Context, deviceID uuid.UU
 			&i.ExpiresAt,
 			&i.TerminatedAt,
 			&i.CreatedAt,
+			&i.ClientWireguardPublicKey,
+			&i.ClientWireguardIp,
+			&i.AllowedDestinations,
 		); err != nil {
 			return nil, err
 		}
@@ -123,7 +170,7 @@ const terminateAccessSession = `-- name: TerminateAccessSession :one
 UPDATE access_sessions
 SET terminated_at = NOW()
 WHERE id = $1
-RETURNING id, device_id, user_email, wireguard_peer_config, expires_at, terminated_at, created_at
+RETURNING id, device_id, user_email, wireguard_peer_config, expires_at, terminated_at, created_at, client_wireguard_public_key, client_wireguard_ip, allowed_destinations
 `
 
 func (q *Queries) TerminateAccessSession(ctx context.Context, id uuid.UUID) (AccessSession, error) {
@@ -137,6 +184,47 @@ func (q *Queries) TerminateAccessSession(ctx context.Context, id uuid.UUID) (Acc
 		&i.ExpiresAt,
 		&i.TerminatedAt,
 		&i.CreatedAt,
+		&i.ClientWireguardPublicKey,
+		&i.ClientWireguardIp,
+		&i.AllowedDestinations,
 	)
 	return i, err
 }
+
+const terminateDeviceAccessSessions = `-- name: TerminateDeviceAccessSessions :many
+UPDATE access_sessions
+SET terminated_at = NOW()
+WHERE device_id = $1 AND terminated_at IS NULL
+RETURNING id, device_id, user_email, wireguard_peer_config, expires_at, terminated_at, created_at, client_wireguard_public_key, client_wireguard_ip, allowed_destinations
+`
+
+func (q *Queries) TerminateDeviceAccessSessions(ctx context.Context, deviceID uuid.UUID) ([]AccessSession, error) {
+	rows, err := q.db.Query(ctx, terminateDeviceAccessSessions, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AccessSession{}
+	for rows.Next() {
+		var i AccessSession
+		if err := rows.Scan(
+			&i.ID,
+			&i.DeviceID,
+			&i.UserEmail,
+			&i.WireguardPeerConfig,
+			&i.ExpiresAt,
+			&i.TerminatedAt,
+			&i.CreatedAt,
+			&i.ClientWireguardPublicKey,
+			&i.ClientWireguardIp,
+			&i.AllowedDestinations,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
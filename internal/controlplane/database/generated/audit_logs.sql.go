@@ -16,24 +16,34 @@ import (
 
 const createAuditLog = `-- name: CreateAuditLog :one
 INSERT INTO audit_logs (
+  id,
+  timestamp,
   organization_id,
-  user_email,
+  actor_type,
+  actor,
   event_type,
   resource_type,
   resource_id,
   action,
   result,
   metadata,
-  ip_address
+  ip_address,
+  request_id,
+  sequence,
+  prev_hash,
+  hash
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, $7, $8, $9
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16
 )
-RETURNING id, timestamp, organization_id, user_email, event_type, resource_type, resource_id, action, result, metadata, ip_address
+RETURNING id, timestamp, organization_id, actor_type, actor, event_type, resource_type, resource_id, action, result, metadata, ip_address, request_id, sequence, prev_hash, hash
 `
 
 type CreateAuditLogParams struct {
+	ID             uuid.UUID   `json:"id"`
+	Timestamp      time.Time   `json:"timestamp"`
 	OrganizationID uuid.UUID   `json:"organization_id"`
-	UserEmail      pgtype.Text `json:"user_email"`
+	ActorType      string      `json:"actor_type"`
+	Actor          pgtype.Text `json:"actor"`
 	EventType      string      `json:"event_type"`
 	ResourceType   string      `json:"resource_type"`
 	ResourceID     string      `json:"resource_id"`
@@ -41,12 +51,19 @@ type CreateAuditLogParams struct {
 	Result         string      `json:"result"`
 	Metadata       []byte      `json:"metadata"`
 	IpAddress      *netip.Addr `json:"ip_address"`
+	RequestID      pgtype.Text `json:"request_id"`
+	Sequence       int64       `json:"sequence"`
+	PrevHash       string      `json:"prev_hash"`
+	Hash           string      `json:"hash"`
 }
 
 func (q *Queries) CreateAuditLog(ctx context.Context, arg CreateAuditLogParams) (AuditLog, error) {
 	row := q.db.QueryRow(ctx, createAuditLog,
+		arg.ID,
+		arg.Timestamp,
 		arg.OrganizationID,
-		arg.UserEmail,
+		arg.ActorType,
+		arg.Actor,
 		arg.EventType,
 		arg.ResourceType,
 		arg.ResourceID,
@@ -54,13 +71,18 @@ func (q *Queries) CreateAuditLog(ctx context.Context, arg CreateAuditLogParams)
 		arg.Result,
 		arg.Metadata,
 		arg.IpAddress,
+		arg.RequestID,
+		arg.Sequence,
+		arg.PrevHash,
+		arg.Hash,
 	)
 	var i AuditLog
 	err := row.Scan(
 		&i.ID,
 		&i.Timestamp,
 		&i.OrganizationID,
-		&i.UserEmail,
+		&i.ActorType,
+		&i.Actor,
 		&i.EventType,
 		&i.ResourceType,
 		&i.ResourceID,
@@ -68,6 +90,10 @@ func (q *Queries) CreateAuditLog(ctx context.Context, arg CreateAuditLogParams)
 		&i.Result,
 		&i.Metadata,
 		&i.IpAddress,
+		&i.RequestID,
+		&i.Sequence,
+		&i.PrevHash,
+		&i.Hash,
 	)
 	return i, err
 }
@@ -82,8 +108,115 @@ func (q *Queries) DeleteOldAuditLogs(ctx context.Context) error {
 	return err
 }
 
+const exportAuditLogs = `-- name: ExportAuditLogs :many
+SELECT id, timestamp, organization_id, actor_type, actor, event_type, resource_type, resource_id, action, result, metadata, ip_address, request_id, sequence, prev_hash, hash FROM audit_logs
+WHERE organization_id = $1
+  AND sequence > $2::bigint
+  AND ($3::timestamptz IS NULL OR timestamp >= $3::timestamptz)
+  AND ($4::timestamptz IS NULL OR timestamp <= $4::timestamptz)
+  AND ($5::text IS NULL OR event_type = $5::text)
+  AND ($6::text IS NULL OR resource_type = $6::text)
+  AND ($7::text IS NULL OR resource_id = $7::text)
+  AND ($8::text IS NULL OR actor_type = $8::text)
+  AND ($9::text IS NULL OR actor = $9::text)
+ORDER BY sequence
+LIMIT $10::integer
+`
+
+type ExportAuditLogsParams struct {
+	OrganizationID uuid.UUID          `json:"organization_id"`
+	AfterSequence  int64              `json:"after_sequence"`
+	StartTime      pgtype.Timestamptz `json:"start_time"`
+	EndTime        pgtype.Timestamptz `json:"end_time"`
+	EventType      pgtype.Text        `json:"event_type"`
+	ResourceType   pgtype.Text        `json:"resource_type"`
+	ResourceID     pgtype.Text        `json:"resource_id"`
+	ActorType      pgtype.Text        `json:"actor_type"`
+	Actor          pgtype.Text        `json:"actor"`
+	PageSize       int32              `json:"page_size"`
+}
+
+func (q *Queries) ExportAuditLogs(ctx context.Context, arg ExportAuditLogsParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, exportAuditLogs,
+		arg.OrganizationID,
+		arg.AfterSequence,
+		arg.StartTime,
+		arg.EndTime,
+		arg.EventType,
+		arg.ResourceType,
+		arg.ResourceID,
+		arg.ActorType,
+		arg.Actor,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AuditLog{}
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.Timestamp,
+			&i.OrganizationID,
+			&i.ActorType,
+			&i.Actor,
+			&i.EventType,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.Action,
+			&i.Result,
+			&i.Metadata,
+			&i.IpAddress,
+			&i.RequestID,
+			&i.Sequence,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getAuditChainHead = `-- name: GetAuditChainHead :one
+SELECT id, timestamp, organization_id, actor_type, actor, event_type, resource_type, resource_id, action, result, metadata, ip_address, request_id, sequence, prev_hash, hash FROM audit_logs
+WHERE organization_id = $1
+ORDER BY sequence DESC
+LIMIT 1
+`
+
+func (q *Queries) GetAuditChainHead(ctx context.Context, organizationID uuid.UUID) (AuditLog, error) {
+	row := q.db.QueryRow(ctx, getAuditChainHead, organizationID)
+	var i AuditLog
+	err := row.Scan(
+		&i.ID,
+		&i.Timestamp,
+		&i.OrganizationID,
+		&i.ActorType,
+		&i.Actor,
+		&i.EventType,
+		&i.ResourceType,
+		&i.ResourceID,
+		&i.Action,
+		&i.Result,
+		&i.Metadata,
+		&i.IpAddress,
+		&i.RequestID,
+		&i.Sequence,
+		&i.PrevHash,
+		&i.Hash,
+	)
+	return i, err
+}
+
 const getAuditLogsByResource = `-- name: GetAuditLogsByResource :many
-SELECT id, timestamp, organization_id, user_email, event_type, resource_type, resource_id, action, result, metadata, ip_address FROM audit_logs
+SELECT id, timestamp, organization_id, actor_type, actor, event_type, resource_type, resource_id, action, result, metadata, ip_address, request_id, sequence, prev_hash, hash FROM audit_logs
 WHERE resource_type = $1 AND resource_id = $2
 ORDER BY timestamp DESC
 LIMIT $3
@@ -108,7 +241,66 @@ func (q *Queries) GetAuditLogsByResource(ctx context.Context, arg GetAuditLogsBy
 			&i.ID,
 			&i.Timestamp,
 			&i.OrganizationID,
-			&i.UserEmail,
+			&i.ActorType,
+			&i.Actor,
+			&i.EventType,
+			&i.ResourceType,
+			&i.ResourceID,
+			&i.Action,
+			&i.Result,
+			&i.Metadata,
+			&i.IpAddress,
+			&i.RequestID,
+			&i.Sequence,
+			&i.PrevHash,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAuditChain = `-- name: ListAuditChain :many
+SELECT id, timestamp, organization_id, actor_type, actor, event_type, resource_type, resource_id, action, result, metadata, ip_address, request_id, sequence, prev_hash, hash FROM audit_logs
+WHERE organization_id = $1
+  AND sequence >= $2::bigint
+  AND ($3::bigint IS NULL OR sequence <= $3::bigint)
+ORDER BY sequence
+LIMIT $4::integer
+`
+
+type ListAuditChainParams struct {
+	OrganizationID uuid.UUID   `json:"organization_id"`
+	FromSequence   int64       `json:"from_sequence"`
+	ToSequence     pgtype.Int8 `json:"to_sequence"`
+	PageSize       int32       `json:"page_size"`
+}
+
+func (q *Queries) ListAuditChain(ctx context.Context, arg ListAuditChainParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, listAuditChain,
+		arg.OrganizationID,
+		arg.FromSequence,
+		arg.ToSequence,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []AuditLog{}
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.Timestamp,
+			&i.OrganizationID,
+			&i.ActorType,
+			&i.Actor,
 			&i.EventType,
 			&i.ResourceType,
 			&i.ResourceID,
@@ -116,6 +308,10 @@ func (q *Queries) GetAuditLogsByResource(ctx context.Context, arg GetAuditLogsBy
 			&i.Result,
 			&i.Metadata,
 			&i.IpAddress,
+			&i.RequestID,
+			&i.Sequence,
+			&i.PrevHash,
+			&i.Hash,
 		); err != nil {
 			return nil, err
 		}
@@ -128,32 +324,48 @@ func (q *Queries) GetAuditLogsByResource(ctx context.Context, arg GetAuditLogsBy
 }
 
 const listAuditLogs = `-- name: ListAuditLogs :many
-SELECT id, timestamp, organization_id, user_email, event_type, resource_type, resource_id, action, result, metadata, ip_address FROM audit_logs
+SELECT id, timestamp, organization_id, actor_type, actor, event_type, resource_type, resource_id, action, result, metadata, ip_address, request_id, sequence, prev_hash, hash FROM audit_logs
 WHERE organization_id = $1
-  AND ($2::timestamptz IS NULL OR timestamp >= $2)
-  AND ($3::timestamptz IS NULL OR timestamp <= $3)
-  AND ($4::text IS NULL OR event_type = $4)
-ORDER BY timestamp DESC
-LIMIT $5 OFFSET $6
+  AND ($2::timestamptz IS NULL OR timestamp >= $2::timestamptz)
+  AND ($3::timestamptz IS NULL OR timestamp <= $3::timestamptz)
+  AND ($4::text IS NULL OR event_type = $4::text)
+  AND ($5::text IS NULL OR resource_type = $5::text)
+  AND ($6::text IS NULL OR resource_id = $6::text)
+  AND ($7::text IS NULL OR actor_type = $7::text)
+  AND ($8::text IS NULL OR actor = $8::text)
+  AND ($9::uuid IS NULL
+    OR (timestamp, id) < ($10::timestamptz, $9::uuid))
+ORDER BY timestamp DESC, id DESC
+LIMIT $11::integer
 `
 
 type ListAuditLogsParams struct {
-	OrganizationID uuid.UUID `json:"organization_id"`
-	Column2        time.Time `json:"column_2"`
-	Column3        time.Time `json:"column_3"`
-	Column4        string    `json:"column_4"`
-	Limit          int32     `json:"limit"`
-	Offset         int32     `json:"offset"`
+	OrganizationID uuid.UUID          `json:"organization_id"`
+	StartTime      pgtype.Timestamptz `json:"start_time"`
+	EndTime        pgtype.Timestamptz `json:"end_time"`
+	EventType      pgtype.Text        `json:"event_type"`
+	ResourceType   pgtype.Text        `json:"resource_type"`
+	ResourceID     pgtype.Text        `json:"resource_id"`
+	ActorType      pgtype.Text        `json:"actor_type"`
+	Actor          pgtype.Text        `json:"actor"`
+	CursorID       pgtype.UUID        `json:"cursor_id"`
+	CursorTime     pgtype.Timestamptz `json:"cursor_time"`
+	PageSize       int32              `json:"page_size"`
 }
 
 func (q *Queries) ListAuditLogs(ctx context.Context, arg ListAuditLogsParams) ([]AuditLog, error) {
 	rows, err := q.db.Query(ctx, listAuditLogs,
 		arg.OrganizationID,
-		arg.Column2,
-		arg.Column3,
-		arg.Column4,
-		arg.Limit,
-		arg.Offset,
+		arg.StartTime,
+		arg.EndTime,
+		arg.EventType,
+		arg.ResourceType,
+		arg.ResourceID,
+		arg.ActorType,
+		arg.Actor,
+		arg.CursorID,
+		arg.CursorTime,
+		arg.PageSize,
 	)
 	if err != nil {
 		return nil, err
@@ -166,7 +378,8 @@ func (q *Queries) ListAuditLogs(ctx context.Context, arg ListAuditLogsParams) ([
 			&i.ID,
 			&i.Timestamp,
 			&i.OrganizationID,
-			&i.UserEmail,
+			&i.ActorType,
+			&i.Actor,
 			&i.EventType,
 			&i.ResourceType,
 			&i.ResourceID,
@@ -174,6 +387,10 @@ func (q *Queries) ListAuditLogs(ctx context.Context, arg ListAuditLogsParams) ([
 			&i.Result,
 			&i.Metadata,
 			&i.IpAddress,
+			&i.RequestID,
+			&i.Sequence,
+			&i.PrevHash,
+			&i.Hash,
 		); err != nil {
 			return nil, err
 		}
@@ -184,3 +401,13 @@ func (q *Queries) ListAuditLogs(ctx context.Context, arg ListAuditLogsParams) ([
 	}
 	return items, nil
 }
+
+const lockAuditChain = `-- name: LockAuditChain :exec
+-- Serializes appends to an organization's chain until the transaction ends
+SELECT pg_advisory_xact_lock(hashtextextended($1::uuid::text, 0))
+`
+
+func (q *Queries) LockAuditChain(ctx context.Context, organizationID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, lockAuditChain, organizationID)
+	return err
+}
@@ -8,6 +8,7 @@ package generated
 import (
 	"context"
 	"net"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -30,6 +31,73 @@ func (q *Queries) CountDevicesByStatus(ctx context.Context, arg CountDevicesBySt
 	return count, err
 }
 
+const countDevicesPage = `-- name: CountDevicesPage :one
+SELECT COUNT(*) FROM devices
+WHERE organization_id = $1
+  AND ($2::text IS NULL OR status = $2::text)
+  AND ($3::text IS NULL OR site_tag = $3::text)
+  AND ($4::text IS NULL OR platform = $4::text)
+  AND ($5::text IS NULL OR agent_version = $5::text)
+  AND ($6::boolean IS NULL
+    OR (last_seen_at IS NOT NULL AND last_seen_at > NOW() - INTERVAL '5 minutes') = $6::boolean)
+  AND ($7::timestamptz IS NULL OR last_seen_at >= $7::timestamptz)
+  AND ($8::timestamptz IS NULL OR last_seen_at < $8::timestamptz)
+  AND ($9::jsonb IS NULL OR labels_match(reported_labels || labels, $9::jsonb))
+  AND ($10::uuid IS NULL OR in_device_group($10::uuid, id, reported_labels || labels))
+`
+
+type CountDevicesPageParams struct {
+	OrganizationID uuid.UUID          `json:"organization_id"`
+	Status         pgtype.Text        `json:"status"`
+	SiteTag        pgtype.Text        `json:"site_tag"`
+	Platform       pgtype.Text        `json:"platform"`
+	AgentVersion   pgtype.Text        `json:"agent_version"`
+	Online         pgtype.Bool        `json:"online"`
+	LastSeenAfter  pgtype.Timestamptz `json:"last_seen_after"`
+	LastSeenBefore pgtype.Timestamptz `json:"last_seen_before"`
+	LabelSelector  []byte             `json:"label_selector"`
+	GroupID        pgtype.UUID        `json:"group_id"`
+}
+
+func (q *Queries) CountDevicesPage(ctx context.Context, arg CountDevicesPageParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countDevicesPage,
+		arg.OrganizationID,
+		arg.Status,
+		arg.SiteTag,
+		arg.Platform,
+		arg.AgentVersion,
+		arg.Online,
+		arg.LastSeenAfter,
+		arg.LastSeenBefore,
+		arg.LabelSelector,
+		arg.GroupID,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countRolloutTargets = `-- name: CountRolloutTargets :one
+SELECT COUNT(*) FROM devices
+WHERE organization_id = $1
+  AND status = 'ACTIVE'
+  AND labels_match(reported_labels || labels, $2::jsonb)
+  AND ($3::uuid IS NULL OR in_device_group($3::uuid, id, reported_labels || labels))
+`
+
+type CountRolloutTargetsParams struct {
+	OrganizationID uuid.UUID   `json:"organization_id"`
+	Selector       []byte      `json:"selector"`
+	GroupID        pgtype.UUID `json:"group_id"`
+}
+
+func (q *Queries) CountRolloutTargets(ctx context.Context, arg CountRolloutTargetsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countRolloutTargets, arg.OrganizationID, arg.Selector, arg.GroupID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createDevice = `-- name: CreateDevice :one
 INSERT INTO devices (
   organization_id,
@@ -43,7 +111,7 @@ INSERT INTO devices (
 ) VALUES (
   $1, $2, $3, $4, $5, $6, $7, 'ACTIVE'
 )
-RETURNING id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, status, last_seen_at, created_at
+RETURNING id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at
 `
 
 type CreateDeviceParams struct {
@@ -76,6 +144,8 @@ func (q *Queries) CreateDevice(ctx context.Context, arg CreateDeviceParams) (Dev
 		&i.AgentVersion,
 		&i.Platform,
 		&i.SiteTag,
+		&i.Labels,
+		&i.ReportedLabels,
 		&i.Status,
 		&i.LastSeenAt,
 		&i.CreatedAt,
@@ -84,7 +154,7 @@ func (q *Queries) CreateDevice(ctx context.Context, arg CreateDeviceParams) (Dev
 }
 
 const getDevice = `-- name: GetDevice :one
-SELECT id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, status, last_seen_at, created_at FROM devices
+SELECT id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at FROM devices
 WHERE id = $1
 `
 
@@ -100,6 +170,8 @@ func (q *Queries) GetDevice(ctx context.Context, id uuid.UUID) (Device, error) {
 		&i.AgentVersion,
 		&i.Platform,
 		&i.SiteTag,
+		&i.Labels,
+		&i.ReportedLabels,
 		&i.Status,
 		&i.LastSeenAt,
 		&i.CreatedAt,
@@ -108,7 +180,7 @@ func (q *Queries) GetDevice(ctx context.Context, id uuid.UUID) (Device, error) {
 }
 
 const getDeviceByPublicKey = `-- name: GetDeviceByPublicKey :one
-SELECT id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, status, last_seen_at, created_at FROM devices
+SELECT id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at FROM devices
 WHERE public_key = $1
 `
 
@@ -124,6 +196,8 @@ func (q *Queries) GetDeviceByPublicKey(ctx context.Context, publicKey string) (D
 		&i.AgentVersion,
 		&i.Platform,
 		&i.SiteTag,
+		&i.Labels,
+		&i.ReportedLabels,
 		&i.Status,
 		&i.LastSeenAt,
 		&i.CreatedAt,
@@ -132,7 +206,7 @@ func (q *Queries) GetDeviceByPublicKey(ctx context.Context, publicKey string) (D
 }
 
 const getStaleDevices = `-- name: GetStaleDevices :many
-SELECT id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, status, last_seen_at, created_at FROM devices
+SELECT id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at FROM devices
 WHERE status = 'ACTIVE'
   AND last_seen_at < NOW() - INTERVAL '5 minutes'
 ORDER BY last_seen_at ASC
@@ -156,6 +230,8 @@ func (q *Queries) GetStaleDevices(ctx context.Context) ([]Device, error) {
 			&i.AgentVersion,
 			&i.Platform,
 			&i.SiteTag,
+			&i.Labels,
+			&i.ReportedLabels,
 			&i.Status,
 			&i.LastSeenAt,
 			&i.CreatedAt,
@@ -171,7 +247,7 @@ func (q *Queries) GetStaleDevices(ctx context.Context) ([]Device, error) {
 }
 
 const listDevices = `-- name: ListDevices :many
-SELECT id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, status, last_seen_at, created_at FROM devices
+SELECT id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at FROM devices
 WHERE organization_id = $1
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3
@@ -201,6 +277,8 @@ func (q *Queries) ListDevices(ctx context.Context, arg ListDevicesParams) ([]Dev
 			&i.AgentVersion,
 			&i.Platform,
 			&i.SiteTag,
+			&i.Labels,
+			&i.ReportedLabels,
 			&i.Status,
 			&i.LastSeenAt,
 			&i.CreatedAt,
@@ -216,7 +294,7 @@ func (q *Queries) ListDevices(ctx context.Context, arg ListDevicesParams) ([]Dev
 }
 
 const listDevicesBySiteTag = `-- name: ListDevicesBySiteTag :many
-SELECT id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, status, last_seen_at, created_at FROM devices
+SELECT id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at FROM devices
 WHERE organization_id = $1 AND site_tag = $2
 ORDER BY created_at DESC
 `
@@ -244,9 +322,133 @@ func (q *Queries) ListDevicesBySiteTag(ctx context.Context, arg ListDevicesBySit
 			&i.AgentVersion,
 			&i.Platform,
 			&i.SiteTag,
+			&i.Labels,
+			&i.ReportedLabels,
+			&i.Status,
+			&i.LastSeenAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDevicesPage = `-- name: ListDevicesPage :many
+WITH filtered AS (
+  SELECT
+    devices.id, devices.organization_id, devices.public_key, devices.wireguard_public_key, devices.wireguard_ip, devices.agent_version, devices.platform, devices.site_tag, devices.labels, devices.reported_labels, devices.status, devices.last_seen_at, devices.created_at,
+    (CASE $1::text
+      WHEN 'last_seen_at' THEN COALESCE(to_char(last_seen_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US'), '')
+      WHEN 'agent_version' THEN agent_version
+      WHEN 'platform' THEN platform
+      WHEN 'status' THEN status
+      ELSE to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US')
+    END)::text AS sort_key
+  FROM devices
+  WHERE organization_id = $2
+    AND ($3::text IS NULL OR status = $3::text)
+    AND ($4::text IS NULL OR site_tag = $4::text)
+    AND ($5::text IS NULL OR platform = $5::text)
+    AND ($6::text IS NULL OR agent_version = $6::text)
+    AND ($7::boolean IS NULL
+      OR (last_seen_at IS NOT NULL AND last_seen_at > NOW() - INTERVAL '5 minutes') = $7::boolean)
+    AND ($8::timestamptz IS NULL OR last_seen_at >= $8::timestamptz)
+    AND ($9::timestamptz IS NULL OR last_seen_at < $9::timestamptz)
+    AND ($10::jsonb IS NULL OR labels_match(reported_labels || labels, $10::jsonb))
+    AND ($11::uuid IS NULL OR in_device_group($11::uuid, id, reported_labels || labels))
+)
+SELECT id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at, sort_key FROM filtered
+WHERE $12::uuid IS NULL
+  OR ($13::boolean AND (sort_key, id) < ($14::text, $12::uuid))
+  OR (NOT $13::boolean AND (sort_key, id) > ($14::text, $12::uuid))
+ORDER BY
+  CASE WHEN $13::boolean THEN sort_key END DESC,
+  CASE WHEN $13::boolean THEN id END DESC,
+  sort_key ASC,
+  id ASC
+LIMIT $15::integer
+`
+
+type ListDevicesPageParams struct {
+	SortBy         string             `json:"sort_by"`
+	OrganizationID uuid.UUID          `json:"organization_id"`
+	Status         pgtype.Text        `json:"status"`
+	SiteTag        pgtype.Text        `json:"site_tag"`
+	Platform       pgtype.Text        `json:"platform"`
+	AgentVersion   pgtype.Text        `json:"agent_version"`
+	Online         pgtype.Bool        `json:"online"`
+	LastSeenAfter  pgtype.Timestamptz `json:"last_seen_after"`
+	LastSeenBefore pgtype.Timestamptz `json:"last_seen_before"`
+	LabelSelector  []byte             `json:"label_selector"`
+	GroupID        pgtype.UUID        `json:"group_id"`
+	CursorID       pgtype.UUID        `json:"cursor_id"`
+	SortDesc       bool               `json:"sort_desc"`
+	CursorKey      string             `json:"cursor_key"`
+	PageSize       int32              `json:"page_size"`
+}
+
+type ListDevicesPageRow struct {
+	ID                 uuid.UUID          `json:"id"`
+	OrganizationID     uuid.UUID          `json:"organization_id"`
+	PublicKey          string             `json:"public_key"`
+	WireguardPublicKey string             `json:"wireguard_public_key"`
+	WireguardIp        net.IP             `json:"wireguard_ip"`
+	AgentVersion       string             `json:"agent_version"`
+	Platform           string             `json:"platform"`
+	SiteTag            pgtype.Text        `json:"site_tag"`
+	Labels             []byte             `json:"labels"`
+	ReportedLabels     []byte             `json:"reported_labels"`
+	Status             string             `json:"status"`
+	LastSeenAt         pgtype.Timestamptz `json:"last_seen_at"`
+	CreatedAt          time.Time          `json:"created_at"`
+	SortKey            string             `json:"sort_key"`
+}
+
+func (q *Queries) ListDevicesPage(ctx context.Context, arg ListDevicesPageParams) ([]ListDevicesPageRow, error) {
+	rows, err := q.db.Query(ctx, listDevicesPage,
+		arg.SortBy,
+		arg.OrganizationID,
+		arg.Status,
+		arg.SiteTag,
+		arg.Platform,
+		arg.AgentVersion,
+		arg.Online,
+		arg.LastSeenAfter,
+		arg.LastSeenBefore,
+		arg.LabelSelector,
+		arg.GroupID,
+		arg.CursorID,
+		arg.SortDesc,
+		arg.CursorKey,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListDevicesPageRow{}
+	for rows.Next() {
+		var i ListDevicesPageRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrganizationID,
+			&i.PublicKey,
+			&i.WireguardPublicKey,
+			&i.WireguardIp,
+			&i.AgentVersion,
+			&i.Platform,
+			&i.SiteTag,
+			&i.Labels,
+			&i.ReportedLabels,
 			&i.Status,
 			&i.LastSeenAt,
 			&i.CreatedAt,
+			&i.SortKey,
 		); err != nil {
 			return nil, err
 		}
@@ -258,11 +460,89 @@ func (q *Queries) ListDevicesBySiteTag(ctx context.Context, arg ListDevicesBySit
 	return items, nil
 }
 
+const listLeasedWireguardIPs = `-- name: ListLeasedWireguardIPs :many
+SELECT wireguard_ip FROM devices
+WHERE status <> 'DECOMMISSIONED'
+UNION
+SELECT client_wireguard_ip FROM access_sessions
+WHERE client_wireguard_ip IS NOT NULL AND terminated_at IS NULL
+ORDER BY wireguard_ip ASC
+`
+
+func (q *Queries) ListLeasedWireguardIPs(ctx context.Context) ([]net.IP, error) {
+	rows, err := q.db.Query(ctx, listLeasedWireguardIPs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []net.IP{}
+	for rows.Next() {
+		var wireguard_ip net.IP
+		if err := rows.Scan(&wireguard_ip); err != nil {
+			return nil, err
+		}
+		items = append(items, wireguard_ip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const reenrollDevice = `-- name: ReenrollDevice :one
+UPDATE devices
+SET public_key = $2,
+    wireguard_public_key = $3,
+    wireguard_ip = $4,
+    platform = $5,
+    agent_version = $6,
+    status = 'ACTIVE'
+WHERE id = $1
+RETURNING id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at
+`
+
+type ReenrollDeviceParams struct {
+	ID                 uuid.UUID `json:"id"`
+	PublicKey          string    `json:"public_key"`
+	WireguardPublicKey string    `json:"wireguard_public_key"`
+	WireguardIp        net.IP    `json:"wireguard_ip"`
+	Platform           string    `json:"platform"`
+	AgentVersion       string    `json:"agent_version"`
+}
+
+func (q *Queries) ReenrollDevice(ctx context.Context, arg ReenrollDeviceParams) (Device, error) {
+	row := q.db.QueryRow(ctx, reenrollDevice,
+		arg.ID,
+		arg.PublicKey,
+		arg.WireguardPublicKey,
+		arg.WireguardIp,
+		arg.Platform,
+		arg.AgentVersion,
+	)
+	var i Device
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.PublicKey,
+		&i.WireguardPublicKey,
+		&i.WireguardIp,
+		&i.AgentVersion,
+		&i.Platform,
+		&i.SiteTag,
+		&i.Labels,
+		&i.ReportedLabels,
+		&i.Status,
+		&i.LastSeenAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
 const updateDeviceHeartbeat = `-- name: UpdateDeviceHeartbeat :one
 UPDATE devices
 SET last_seen_at = NOW()
 WHERE id = $1
-RETURNING id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, status, last_seen_at, created_at
+RETURNING id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at
 `
 
 func (q *Queries) UpdateDeviceHeartbeat(ctx context.Context, id uuid.UUID) (Device, error) {
@@ -277,6 +557,8 @@ func (q *Queries) UpdateDeviceHeartbeat(ctx context.Context, id uuid.UUID) (Devi
 		&i.AgentVersion,
 		&i.Platform,
 		&i.SiteTag,
+		&i.Labels,
+		&i.ReportedLabels,
 		&i.Status,
 		&i.LastSeenAt,
 		&i.CreatedAt,
@@ -284,11 +566,94 @@ func (q *Queries) UpdateDeviceHeartbeat(ctx context.Context, id uuid.UUID) (Devi
 	return i, err
 }
 
+const updateDeviceKeys = `-- name: UpdateDeviceKeys :one
+UPDATE devices
+SET public_key = $2, wireguard_public_key = $3
+WHERE id = $1
+RETURNING id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at
+`
+
+type UpdateDeviceKeysParams struct {
+	ID                 uuid.UUID `json:"id"`
+	PublicKey          string    `json:"public_key"`
+	WireguardPublicKey string    `json:"wireguard_public_key"`
+}
+
+func (q *Queries) UpdateDeviceKeys(ctx context.Context, arg UpdateDeviceKeysParams) (Device, error) {
+	row := q.db.QueryRow(ctx, updateDeviceKeys, arg.ID, arg.PublicKey, arg.WireguardPublicKey)
+	var i Device
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.PublicKey,
+		&i.WireguardPublicKey,
+		&i.WireguardIp,
+		&i.AgentVersion,
+		&i.Platform,
+		&i.SiteTag,
+		&i.Labels,
+		&i.ReportedLabels,
+		&i.Status,
+		&i.LastSeenAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const updateDeviceLabels = `-- name: UpdateDeviceLabels :one
+UPDATE devices
+SET labels = $2
+WHERE id = $1
+RETURNING id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at
+`
+
+type UpdateDeviceLabelsParams struct {
+	ID     uuid.UUID `json:"id"`
+	Labels []byte    `json:"labels"`
+}
+
+func (q *Queries) UpdateDeviceLabels(ctx context.Context, arg UpdateDeviceLabelsParams) (Device, error) {
+	row := q.db.QueryRow(ctx, updateDeviceLabels, arg.ID, arg.Labels)
+	var i Device
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.PublicKey,
+		&i.WireguardPublicKey,
+		&i.WireguardIp,
+		&i.AgentVersion,
+		&i.Platform,
+		&i.SiteTag,
+		&i.Labels,
+		&i.ReportedLabels,
+		&i.Status,
+		&i.LastSeenAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const updateDeviceReportedLabels = `-- name: UpdateDeviceReportedLabels :exec
+UPDATE devices
+SET reported_labels = $2
+WHERE id = $1 AND reported_labels <> $2
+`
+
+type UpdateDeviceReportedLabelsParams struct {
+	ID             uuid.UUID `json:"id"`
+	ReportedLabels []byte    `json:"reported_labels"`
+}
+
+func (q *Queries) UpdateDeviceReportedLabels(ctx context.Context, arg UpdateDeviceReportedLabelsParams) error {
+	_, err := q.db.Exec(ctx, updateDeviceReportedLabels, arg.ID, arg.ReportedLabels)
+	return err
+}
+
 const updateDeviceStatus = `-- name: UpdateDeviceStatus :one
 UPDATE devices
 SET status = $2
 WHERE id = $1
-RETURNING id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, status, last_seen_at, created_at
+RETURNING id, organization_id, public_key, wireguard_public_key, wireguard_ip, agent_version, platform, site_tag, labels, reported_labels, status, last_seen_at, created_at
 `
 
 type UpdateDeviceStatusParams struct {
@@ -308,6 +673,8 @@ func (q *Queries) UpdateDeviceStatus(ctx context.Context, arg UpdateDeviceStatus
 		&i.AgentVersion,
 		&i.Platform,
 		&i.SiteTag,
+		&i.Labels,
+		&i.ReportedLabels,
 		&i.Status,
 		&i.LastSeenAt,
 		&i.CreatedAt,
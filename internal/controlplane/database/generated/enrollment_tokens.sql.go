@@ -23,7 +23,7 @@ INSERT INTO enrollment_tokens (
 ) VALUES (
   $1, $2, $3, $4, $5
 )
-RETURNING id, organization_id, token_hash, site_tag, expires_at, max_uses, used_count, created_at
+RETURNING id, organization_id, token_hash, site_tag, expires_at, max_uses, used_count, created_at, revoked_at
 `
 
 type CreateEnrollmentTokenParams struct {
@@ -52,6 +52,7 @@ func (q *Queries) CreateEnrollmentToken(ctx context.Context, arg CreateEnrollmen
 		&i.MaxUses,
 		&i.UsedCount,
 		&i.CreatedAt,
+		&i.RevokedAt,
 	)
 	return i, err
 }
@@ -67,10 +68,11 @@ func (q *Queries) DeleteExpiredTokens(ctx context.Context) error {
 }
 
 const getEnrollmentTokenByHash = `-- name: GetEnrollmentTokenByHash :one
-SELECT id, organization_id, token_hash, site_tag, expires_at, max_uses, used_count, created_at FROM enrollment_tokens
+SELECT id, organization_id, token_hash, site_tag, expires_at, max_uses, used_count, created_at, revoked_at FROM enrollment_tokens
 WHERE token_hash = $1
   AND expires_at > NOW()
   AND used_count < max_uses
+  AND revoked_at IS NULL
 `
 
 func (q *Queries) GetEnrollmentTokenByHash(ctx context.Context, tokenHash string) (EnrollmentToken, error) {
@@ -85,6 +87,7 @@ func (q *Queries) GetEnrollmentTokenByHash(ctx context.Context, tokenHash string
 		&i.MaxUses,
 		&i.UsedCount,
 		&i.CreatedAt,
+		&i.RevokedAt,
 	)
 	return i, err
 }
@@ -93,7 +96,7 @@ const incrementTokenUsage = `-- name: IncrementTokenUsage :one
 UPDATE enrollment_tokens
 SET used_count = used_count + 1
 WHERE id = $1
-RETURNING id, organization_id, token_hash, site_tag, expires_at, max_uses, used_count, created_at
+RETURNING id, organization_id, token_hash, site_tag, expires_at, max_uses, used_count, created_at, revoked_at
 `
 
 func (q *Queries) IncrementTokenUsage(ctx context.Context, id uuid.UUID) (EnrollmentToken, error) {
@@ -108,12 +111,13 @@ func (q *Queries) IncrementTokenUsage(ctx context.Context, id uuid.UUID) (Enroll
 		&i.MaxUses,
 		&i.UsedCount,
 		&i.CreatedAt,
+		&i.RevokedAt,
 	)
 	return i, err
 }
 
 const listEnrollmentTokens = `-- name: ListEnrollmentTokens :many
-SELECT id, organization_id, token_hash, site_tag, expires_at, max_uses, used_count, created_at FROM enrollment_tokens
+SELECT id, organization_id, token_hash, site_tag, expires_at, max_uses, used_count, created_at, revoked_at FROM enrollment_tokens
 WHERE organization_id = $1
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3
@@ -143,6 +147,7 @@ func (q *Queries) ListEnrollmentTokens(ctx context.Context, arg ListEnrollmentTo
 			&i.MaxUses,
 			&i.UsedCount,
 			&i.CreatedAt,
+			&i.RevokedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -153,3 +158,32 @@ func (q *Queries) ListEnrollmentTokens(ctx context.Context, arg ListEnrollmentTo
 	}
 	return items, nil
 }
+
+const revokeEnrollmentToken = `-- name: RevokeEnrollmentToken :one
+UPDATE enrollment_tokens
+SET revoked_at = NOW()
+WHERE id = $1 AND organization_id = $2 AND revoked_at IS NULL
+RETURNING id, organization_id, token_hash, site_tag, expires_at, max_uses, used_count, created_at, revoked_at
+`
+
+type RevokeEnrollmentTokenParams struct {
+	ID             uuid.UUID `json:"id"`
+	OrganizationID uuid.UUID `json:"organization_id"`
+}
+
+func (q *Queries) RevokeEnrollmentToken(ctx context.Context, arg RevokeEnrollmentTokenParams) (EnrollmentToken, error) {
+	row := q.db.QueryRow(ctx, revokeEnrollmentToken, arg.ID, arg.OrganizationID)
+	var i EnrollmentToken
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.TokenHash,
+		&i.SiteTag,
+		&i.ExpiresAt,
+		&i.MaxUses,
+		&i.UsedCount,
+		&i.CreatedAt,
+		&i.RevokedAt,
+	)
+	return i, err
+}
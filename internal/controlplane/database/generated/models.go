@@ -13,14 +13,28 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AccessPolicy struct {
+	ID                 uuid.UUID   `json:"id"`
+	OrganizationID     uuid.UUID   `json:"organization_id"`
+	Name               string      `json:"name"`
+	DeviceSelector     []byte      `json:"device_selector"`
+	DeviceGroupID      pgtype.UUID `json:"device_group_id"`
+	UserEmails         []string    `json:"user_emails"`
+	MaxDurationSeconds int32       `json:"max_duration_seconds"`
+	CreatedAt          time.Time   `json:"created_at"`
+}
+
 type AccessSession struct {
-	ID                  uuid.UUID          `json:"id"`
-	DeviceID            uuid.UUID          `json:"device_id"`
-	UserEmail           string             `json:"user_email"`
-	WireguardPeerConfig string             `json:"wireguard_peer_config"`
-	ExpiresAt           time.Time          `json:"expires_at"`
-	TerminatedAt        pgtype.Timestamptz `json:"terminated_at"`
-	CreatedAt           time.Time          `json:"created_at"`
+	ID                       uuid.UUID          `json:"id"`
+	DeviceID                 uuid.UUID          `json:"device_id"`
+	UserEmail                string             `json:"user_email"`
+	WireguardPeerConfig      string             `json:"wireguard_peer_config"`
+	ExpiresAt                time.Time          `json:"expires_at"`
+	TerminatedAt             pgtype.Timestamptz `json:"terminated_at"`
+	CreatedAt                time.Time          `json:"created_at"`
+	ClientWireguardPublicKey pgtype.Text        `json:"client_wireguard_public_key"`
+	ClientWireguardIp        net.IP             `json:"client_wireguard_ip"`
+	AllowedDestinations      []string           `json:"allowed_destinations"`
 }
 
 type Artifact struct {
@@ -36,11 +50,22 @@ type Artifact struct {
 	CreatedAt      time.Time `json:"created_at"`
 }
 
+type AuditCheckpoint struct {
+	ID             uuid.UUID `json:"id"`
+	OrganizationID uuid.UUID `json:"organization_id"`
+	Sequence       int64     `json:"sequence"`
+	Hash           string    `json:"hash"`
+	PublicKey      string    `json:"public_key"`
+	Signature      []byte    `json:"signature"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
 type AuditLog struct {
 	ID             uuid.UUID   `json:"id"`
 	Timestamp      time.Time   `json:"timestamp"`
 	OrganizationID uuid.UUID   `json:"organization_id"`
-	UserEmail      pgtype.Text `json:"user_email"`
+	ActorType      string      `json:"actor_type"`
+	Actor          pgtype.Text `json:"actor"`
 	EventType      string      `json:"event_type"`
 	ResourceType   string      `json:"resource_type"`
 	ResourceID     string      `json:"resource_id"`
@@ -48,6 +73,39 @@ type AuditLog struct {
 	Result         string      `json:"result"`
 	Metadata       []byte      `json:"metadata"`
 	IpAddress      *netip.Addr `json:"ip_address"`
+	RequestID      pgtype.Text `json:"request_id"`
+	Sequence       int64       `json:"sequence"`
+	PrevHash       string      `json:"prev_hash"`
+	Hash           string      `json:"hash"`
+}
+
+type AuditSink struct {
+	ID                  uuid.UUID          `json:"id"`
+	OrganizationID      uuid.UUID          `json:"organization_id"`
+	Name                string             `json:"name"`
+	Type                string             `json:"type"`
+	Config              []byte             `json:"config"`
+	Enabled             bool               `json:"enabled"`
+	LastSequence        int64              `json:"last_sequence"`
+	LastDeliveredAt     pgtype.Timestamptz `json:"last_delivered_at"`
+	ConsecutiveFailures int32              `json:"consecutive_failures"`
+	LastError           pgtype.Text        `json:"last_error"`
+	NextAttemptAt       pgtype.Timestamptz `json:"next_attempt_at"`
+	LeasedUntil         pgtype.Timestamptz `json:"leased_until"`
+	CreatedAt           time.Time          `json:"created_at"`
+}
+
+type CommandBatch struct {
+	ID             uuid.UUID          `json:"id"`
+	OrganizationID uuid.UUID          `json:"organization_id"`
+	Command        string             `json:"command"`
+	Args           []string           `json:"args"`
+	TargetSelector []byte             `json:"target_selector"`
+	TargetGroupID  pgtype.UUID        `json:"target_group_id"`
+	TimeoutSeconds int32              `json:"timeout_seconds"`
+	MaxConcurrency int32              `json:"max_concurrency"`
+	CreatedAt      time.Time          `json:"created_at"`
+	CompletedAt    pgtype.Timestamptz `json:"completed_at"`
 }
 
 type Device struct {
@@ -59,20 +117,168 @@ type Device struct {
 	AgentVersion       string             `json:"agent_version"`
 	Platform           string             `json:"platform"`
 	SiteTag            pgtype.Text        `json:"site_tag"`
+	Labels             []byte             `json:"labels"`
+	ReportedLabels     []byte             `json:"reported_labels"`
 	Status             string             `json:"status"`
 	LastSeenAt         pgtype.Timestamptz `json:"last_seen_at"`
 	CreatedAt          time.Time          `json:"created_at"`
 }
 
+type DeviceCommand struct {
+	ID              uuid.UUID          `json:"id"`
+	OrganizationID  uuid.UUID          `json:"organization_id"`
+	DeviceID        uuid.UUID          `json:"device_id"`
+	BatchID         pgtype.UUID        `json:"batch_id"`
+	Command         string             `json:"command"`
+	Args            []string           `json:"args"`
+	TimeoutSeconds  int32              `json:"timeout_seconds"`
+	State           string             `json:"state"`
+	ExitCode        pgtype.Int4        `json:"exit_code"`
+	Error           pgtype.Text        `json:"error"`
+	Stdout          string             `json:"stdout"`
+	Stderr          string             `json:"stderr"`
+	OutputTruncated bool               `json:"output_truncated"`
+	CreatedAt       time.Time          `json:"created_at"`
+	StartedAt       pgtype.Timestamptz `json:"started_at"`
+	CompletedAt     pgtype.Timestamptz `json:"completed_at"`
+}
+
+type DeviceConfig struct {
+	DeviceID  uuid.UUID `json:"device_id"`
+	Document  []byte    `json:"document"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type DeviceConfigReport struct {
+	DeviceID    uuid.UUID `json:"device_id"`
+	DesiredHash string    `json:"desired_hash"`
+	Reported    []byte    `json:"reported"`
+	Errors      []byte    `json:"errors"`
+	Drifted     bool      `json:"drifted"`
+	ReportedAt  time.Time `json:"reported_at"`
+}
+
+type DeviceConnectionEvent struct {
+	ID         uuid.UUID `json:"id"`
+	DeviceID   uuid.UUID `json:"device_id"`
+	EventType  string    `json:"event_type"`
+	Reason     string    `json:"reason"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+type DeviceGroup struct {
+	ID             uuid.UUID `json:"id"`
+	OrganizationID uuid.UUID `json:"organization_id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Membership     string    `json:"membership"`
+	Selector       []byte    `json:"selector"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type DeviceGroupConfig struct {
+	GroupID   uuid.UUID `json:"group_id"`
+	Document  []byte    `json:"document"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type DeviceGroupMember struct {
+	GroupID  uuid.UUID `json:"group_id"`
+	DeviceID uuid.UUID `json:"device_id"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+type DeviceKeyRevocation struct {
+	PublicKey string    `json:"public_key"`
+	DeviceID  uuid.UUID `json:"device_id"`
+	KeyType   string    `json:"key_type"`
+	Reason    string    `json:"reason"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+type DeviceLog struct {
+	ID         int64     `json:"id"`
+	DeviceID   uuid.UUID `json:"device_id"`
+	Source     string    `json:"source"`
+	LoggedAt   time.Time `json:"logged_at"`
+	Message    string    `json:"message"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+type DeviceMetric struct {
+	DeviceID              uuid.UUID     `json:"device_id"`
+	RecordedAt            time.Time     `json:"recorded_at"`
+	CpuPercent            float64       `json:"cpu_percent"`
+	MemoryPercent         float64       `json:"memory_percent"`
+	MemoryTotalBytes      int64         `json:"memory_total_bytes"`
+	DiskUsedBytes         int64         `json:"disk_used_bytes"`
+	DiskTotalBytes        int64         `json:"disk_total_bytes"`
+	UptimeSeconds         float64       `json:"uptime_seconds"`
+	Load1                 float64       `json:"load1"`
+	Load5                 float64       `json:"load5"`
+	Load15                float64       `json:"load15"`
+	NetworkRxBytes        int64         `json:"network_rx_bytes"`
+	NetworkTxBytes        int64         `json:"network_tx_bytes"`
+	MaxTemperatureCelsius pgtype.Float8 `json:"max_temperature_celsius"`
+}
+
+type DeviceMetricsHourly struct {
+	DeviceID              uuid.UUID `json:"device_id"`
+	Bucket                time.Time `json:"bucket"`
+	Samples               int32     `json:"samples"`
+	CpuPercentAvg         float64   `json:"cpu_percent_avg"`
+	CpuPercentMax         float64   `json:"cpu_percent_max"`
+	MemoryPercentAvg      float64   `json:"memory_percent_avg"`
+	MemoryPercentMax      float64   `json:"memory_percent_max"`
+	DiskUsedBytesMax      int64     `json:"disk_used_bytes_max"`
+	DiskTotalBytes        int64     `json:"disk_total_bytes"`
+	Load1Avg              float64   `json:"load1_avg"`
+	NetworkRxBytesMax     int64     `json:"network_rx_bytes_max"`
+	NetworkTxBytesMax     int64     `json:"network_tx_bytes_max"`
+	TemperatureSamples    int32     `json:"temperature_samples"`
+	TemperatureMaxCelsius float64   `json:"temperature_max_celsius"`
+}
+
+type DeviceReenrollment struct {
+	ID                 uuid.UUID          `json:"id"`
+	OrganizationID     uuid.UUID          `json:"organization_id"`
+	DeviceID           uuid.UUID          `json:"device_id"`
+	PublicKey          string             `json:"public_key"`
+	WireguardPublicKey string             `json:"wireguard_public_key"`
+	Platform           string             `json:"platform"`
+	AgentVersion       string             `json:"agent_version"`
+	Status             string             `json:"status"`
+	RequestedAt        time.Time          `json:"requested_at"`
+	DecidedAt          pgtype.Timestamptz `json:"decided_at"`
+}
+
 type EnrollmentToken struct {
-	ID             uuid.UUID   `json:"id"`
-	OrganizationID uuid.UUID   `json:"organization_id"`
-	TokenHash      string      `json:"token_hash"`
-	SiteTag        pgtype.Text `json:"site_tag"`
-	ExpiresAt      time.Time   `json:"expires_at"`
-	MaxUses        int32       `json:"max_uses"`
-	UsedCount      int32       `json:"used_count"`
-	CreatedAt      time.Time   `json:"created_at"`
+	ID             uuid.UUID          `json:"id"`
+	OrganizationID uuid.UUID          `json:"organization_id"`
+	TokenHash      string             `json:"token_hash"`
+	SiteTag        pgtype.Text        `json:"site_tag"`
+	ExpiresAt      time.Time          `json:"expires_at"`
+	MaxUses        int32              `json:"max_uses"`
+	UsedCount      int32              `json:"used_count"`
+	CreatedAt      time.Time          `json:"created_at"`
+	RevokedAt      pgtype.Timestamptz `json:"revoked_at"`
+}
+
+type FileTransfer struct {
+	ID             uuid.UUID          `json:"id"`
+	OrganizationID uuid.UUID          `json:"organization_id"`
+	DeviceID       uuid.UUID          `json:"device_id"`
+	Direction      string             `json:"direction"`
+	Path           string             `json:"path"`
+	Size           int64              `json:"size"`
+	Blake3Hash     string             `json:"blake3_hash"`
+	Mode           int32              `json:"mode"`
+	Transferred    int64              `json:"transferred"`
+	State          string             `json:"state"`
+	Error          pgtype.Text        `json:"error"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+	CompletedAt    pgtype.Timestamptz `json:"completed_at"`
 }
 
 type Organization struct {
@@ -86,6 +292,7 @@ type Rollout struct {
 	OrganizationID  uuid.UUID          `json:"organization_id"`
 	ArtifactID      uuid.UUID          `json:"artifact_id"`
 	TargetSelector  []byte             `json:"target_selector"`
+	TargetGroupID   pgtype.UUID        `json:"target_group_id"`
 	CanaryPercent   int32              `json:"canary_percent"`
 	SoakTimeSeconds int32              `json:"soak_time_seconds"`
 	HealthCheckUrl  string             `json:"health_check_url"`
@@ -103,3 +310,31 @@ type RolloutDeviceStatus struct {
 	HealthCheckResult []byte    `json:"health_check_result"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
+
+type Webhook struct {
+	ID             uuid.UUID `json:"id"`
+	OrganizationID uuid.UUID `json:"organization_id"`
+	Name           string    `json:"name"`
+	Url            string    `json:"url"`
+	Secret         string    `json:"secret"`
+	EventTypes     []string  `json:"event_types"`
+	Enabled        bool      `json:"enabled"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID          `json:"id"`
+	WebhookID      uuid.UUID          `json:"webhook_id"`
+	EventID        uuid.UUID          `json:"event_id"`
+	EventType      string             `json:"event_type"`
+	Payload        []byte             `json:"payload"`
+	Status         string             `json:"status"`
+	Attempts       int32              `json:"attempts"`
+	NextAttemptAt  time.Time          `json:"next_attempt_at"`
+	LeasedUntil    pgtype.Timestamptz `json:"leased_until"`
+	ResponseStatus pgtype.Int4        `json:"response_status"`
+	LastError      pgtype.Text        `json:"last_error"`
+	RedeliveryOf   pgtype.UUID        `json:"redelivery_of"`
+	CreatedAt      time.Time          `json:"created_at"`
+	DeliveredAt    pgtype.Timestamptz `json:"delivered_at"`
+}
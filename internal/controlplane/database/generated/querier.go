@@ -6,53 +6,167 @@ package generated
 
 import (
 	"context"
+	"net"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Querier interface {
+	AddDeviceGroupMember(ctx context.Context, arg AddDeviceGroupMemberParams) error
+	AppendDeviceCommandOutput(ctx context.Context, arg AppendDeviceCommandOutputParams) (pgtype.UUID, error)
+	ClaimAuditSink(ctx context.Context, arg ClaimAuditSinkParams) (AuditSink, error)
+	ClaimBatchCommands(ctx context.Context, arg ClaimBatchCommandsParams) ([]DeviceCommand, error)
+	ClaimRolloutDevices(ctx context.Context, arg ClaimRolloutDevicesParams) ([]RolloutDeviceStatus, error)
+	ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	CompleteCommandBatch(ctx context.Context, id uuid.UUID) (CommandBatch, error)
+	CompleteDeviceCommand(ctx context.Context, arg CompleteDeviceCommandParams) (DeviceCommand, error)
+	CompleteFileTransfer(ctx context.Context, id uuid.UUID) (FileTransfer, error)
 	CompleteRollout(ctx context.Context, id uuid.UUID) (Rollout, error)
 	CountDevicesByStatus(ctx context.Context, arg CountDevicesByStatusParams) (int64, error)
+	CountDevicesPage(ctx context.Context, arg CountDevicesPageParams) (int64, error)
 	CountRolloutDevicesByStatus(ctx context.Context, arg CountRolloutDevicesByStatusParams) (int64, error)
+	CountRolloutTargets(ctx context.Context, arg CountRolloutTargetsParams) (int64, error)
+	CountRunningBatchCommands(ctx context.Context, batchID uuid.UUID) (int64, error)
+	CreateAccessPolicy(ctx context.Context, arg CreateAccessPolicyParams) (AccessPolicy, error)
 	CreateAccessSession(ctx context.Context, arg CreateAccessSessionParams) (AccessSession, error)
 	CreateArtifact(ctx context.Context, arg CreateArtifactParams) (Artifact, error)
+	CreateAuditCheckpoint(ctx context.Context, arg CreateAuditCheckpointParams) (AuditCheckpoint, error)
 	CreateAuditLog(ctx context.Context, arg CreateAuditLogParams) (AuditLog, error)
+	CreateAuditSink(ctx context.Context, arg CreateAuditSinkParams) (AuditSink, error)
+	CreateBatchCommands(ctx context.Context, id uuid.UUID) ([]DeviceCommand, error)
+	CreateCommandBatch(ctx context.Context, arg CreateCommandBatchParams) (CommandBatch, error)
 	CreateDevice(ctx context.Context, arg CreateDeviceParams) (Device, error)
+	CreateDeviceCommand(ctx context.Context, arg CreateDeviceCommandParams) (DeviceCommand, error)
+	CreateDeviceConnectionEvent(ctx context.Context, arg CreateDeviceConnectionEventParams) (DeviceConnectionEvent, error)
+	CreateDeviceGroup(ctx context.Context, arg CreateDeviceGroupParams) (DeviceGroup, error)
+	CreateDeviceMetricsPartitions(ctx context.Context, arg CreateDeviceMetricsPartitionsParams) error
+	CreateDeviceReenrollment(ctx context.Context, arg CreateDeviceReenrollmentParams) (DeviceReenrollment, error)
 	CreateEnrollmentToken(ctx context.Context, arg CreateEnrollmentTokenParams) (EnrollmentToken, error)
+	CreateFileTransfer(ctx context.Context, arg CreateFileTransferParams) (FileTransfer, error)
 	CreateOrganization(ctx context.Context, name string) (Organization, error)
 	CreateRollout(ctx context.Context, arg CreateRolloutParams) (Rollout, error)
+	CreateRolloutDevices(ctx context.Context, id uuid.UUID) ([]RolloutDeviceStatus, error)
 	CreateRolloutDeviceStatus(ctx context.Context, arg CreateRolloutDeviceStatusParams) (RolloutDeviceStatus, error)
+	CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error)
+	CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (WebhookDelivery, error)
+	DecideDeviceReenrollment(ctx context.Context, arg DecideDeviceReenrollmentParams) (DeviceReenrollment, error)
+	DeleteAccessPolicy(ctx context.Context, arg DeleteAccessPolicyParams) (AccessPolicy, error)
+	DeleteAuditSink(ctx context.Context, arg DeleteAuditSinkParams) (AuditSink, error)
+	DeleteDeviceConfig(ctx context.Context, deviceID uuid.UUID) (DeviceConfig, error)
+	DeleteDeviceGroup(ctx context.Context, arg DeleteDeviceGroupParams) (DeviceGroup, error)
+	DeleteDeviceGroupConfig(ctx context.Context, groupID uuid.UUID) (DeviceGroupConfig, error)
 	DeleteExpiredTokens(ctx context.Context) error
 	DeleteOldAuditLogs(ctx context.Context) error
-	ExpireOldSessions(ctx context.Context) error
+	DeleteOldDeviceLogs(ctx context.Context, olderThan time.Time) error
+	DeleteOldDeviceMetricsHourly(ctx context.Context, olderThan time.Time) error
+	DeleteWebhook(ctx context.Context, arg DeleteWebhookParams) (Webhook, error)
+	DropDeviceMetricsPartitions(ctx context.Context, olderThan time.Time) (int32, error)
+	EndFileTransfer(ctx context.Context, arg EndFileTransferParams) (FileTransfer, error)
+	ExpireFileTransfers(ctx context.Context, idleSince time.Time) ([]FileTransfer, error)
+	ExpireOldSessions(ctx context.Context) ([]AccessSession, error)
+	ExportAuditLogs(ctx context.Context, arg ExportAuditLogsParams) ([]AuditLog, error)
+	FailDeviceCommand(ctx context.Context, arg FailDeviceCommandParams) (DeviceCommand, error)
+	FailOverdueDeviceCommands(ctx context.Context, arg FailOverdueDeviceCommandsParams) ([]DeviceCommand, error)
 	FailRollout(ctx context.Context, id uuid.UUID) (Rollout, error)
+	FailStalledRolloutDevices(ctx context.Context, arg FailStalledRolloutDevicesParams) ([]RolloutDeviceStatus, error)
+	GetAccessPolicy(ctx context.Context, arg GetAccessPolicyParams) (AccessPolicy, error)
 	GetAccessSession(ctx context.Context, id uuid.UUID) (AccessSession, error)
 	GetArtifact(ctx context.Context, id uuid.UUID) (Artifact, error)
 	GetArtifactByHash(ctx context.Context, blake3Hash string) (Artifact, error)
+	GetAuditChainHead(ctx context.Context, organizationID uuid.UUID) (AuditLog, error)
 	GetAuditLogsByResource(ctx context.Context, arg GetAuditLogsByResourceParams) ([]AuditLog, error)
+	GetAuditSink(ctx context.Context, arg GetAuditSinkParams) (AuditSink, error)
 	GetCanaryDevices(ctx context.Context, rolloutID uuid.UUID) ([]RolloutDeviceStatus, error)
+	GetCommandBatch(ctx context.Context, id uuid.UUID) (CommandBatch, error)
 	GetDevice(ctx context.Context, id uuid.UUID) (Device, error)
 	GetDeviceByPublicKey(ctx context.Context, publicKey string) (Device, error)
+	GetDeviceCommand(ctx context.Context, id uuid.UUID) (DeviceCommand, error)
+	GetDeviceConfig(ctx context.Context, deviceID uuid.UUID) (DeviceConfig, error)
+	GetDeviceConfigReport(ctx context.Context, deviceID uuid.UUID) (DeviceConfigReport, error)
+	GetDeviceGroup(ctx context.Context, arg GetDeviceGroupParams) (DeviceGroup, error)
+	GetDeviceGroupConfig(ctx context.Context, groupID uuid.UUID) (DeviceGroupConfig, error)
+	GetDeviceMetricsHourlySeries(ctx context.Context, arg GetDeviceMetricsHourlySeriesParams) ([]GetDeviceMetricsHourlySeriesRow, error)
+	GetDeviceMetricsSeries(ctx context.Context, arg GetDeviceMetricsSeriesParams) ([]GetDeviceMetricsSeriesRow, error)
+	GetDeviceReenrollment(ctx context.Context, id uuid.UUID) (DeviceReenrollment, error)
 	GetEnrollmentTokenByHash(ctx context.Context, tokenHash string) (EnrollmentToken, error)
+	GetFileTransfer(ctx context.Context, id uuid.UUID) (FileTransfer, error)
+	GetLatestAuditCheckpoint(ctx context.Context, organizationID uuid.UUID) (AuditCheckpoint, error)
 	GetOrganization(ctx context.Context, id uuid.UUID) (Organization, error)
 	GetRollout(ctx context.Context, id uuid.UUID) (Rollout, error)
 	GetRolloutDeviceStatus(ctx context.Context, arg GetRolloutDeviceStatusParams) (RolloutDeviceStatus, error)
 	GetStaleDevices(ctx context.Context) ([]Device, error)
+	GetWebhook(ctx context.Context, arg GetWebhookParams) (Webhook, error)
+	GetWebhookByID(ctx context.Context, id uuid.UUID) (Webhook, error)
+	GetWebhookDelivery(ctx context.Context, arg GetWebhookDeliveryParams) (WebhookDelivery, error)
 	IncrementTokenUsage(ctx context.Context, id uuid.UUID) (EnrollmentToken, error)
+	InsertDeviceLogs(ctx context.Context, arg InsertDeviceLogsParams) error
+	InsertDeviceMetrics(ctx context.Context, arg InsertDeviceMetricsParams) error
+	IsDeviceKeyRevoked(ctx context.Context, publicKey string) (bool, error)
+	ListAccessPolicies(ctx context.Context, organizationID uuid.UUID) ([]AccessPolicy, error)
+	ListAccessPoliciesForUser(ctx context.Context, arg ListAccessPoliciesForUserParams) ([]AccessPolicy, error)
 	ListActiveAccessSessions(ctx context.Context, deviceID uuid.UUID) ([]AccessSession, error)
 	ListArtifacts(ctx context.Context, arg ListArtifactsParams) ([]Artifact, error)
+	ListAuditChain(ctx context.Context, arg ListAuditChainParams) ([]AuditLog, error)
+	ListAuditCheckpoints(ctx context.Context, arg ListAuditCheckpointsParams) ([]AuditCheckpoint, error)
 	ListAuditLogs(ctx context.Context, arg ListAuditLogsParams) ([]AuditLog, error)
+	ListAuditSinks(ctx context.Context, organizationID uuid.UUID) ([]AuditSink, error)
+	ListBatchCommands(ctx context.Context, batchID uuid.UUID) ([]DeviceCommand, error)
+	ListDeviceConnectionEvents(ctx context.Context, arg ListDeviceConnectionEventsParams) ([]DeviceConnectionEvent, error)
+	ListDeviceGroupConfigsForDevice(ctx context.Context, deviceID uuid.UUID) ([]DeviceGroupConfig, error)
+	ListDeviceGroups(ctx context.Context, organizationID uuid.UUID) ([]DeviceGroup, error)
+	ListDeviceGroupsForDevice(ctx context.Context, id uuid.UUID) ([]DeviceGroup, error)
+	ListDeviceLogs(ctx context.Context, arg ListDeviceLogsParams) ([]DeviceLog, error)
+	ListDeviceReenrollments(ctx context.Context, arg ListDeviceReenrollmentsParams) ([]DeviceReenrollment, error)
 	ListDevices(ctx context.Context, arg ListDevicesParams) ([]Device, error)
 	ListDevicesBySiteTag(ctx context.Context, arg ListDevicesBySiteTagParams) ([]Device, error)
+	ListDevicesPage(ctx context.Context, arg ListDevicesPageParams) ([]ListDevicesPageRow, error)
+	ListDueAuditSinks(ctx context.Context) ([]AuditSink, error)
 	ListEnrollmentTokens(ctx context.Context, arg ListEnrollmentTokensParams) ([]EnrollmentToken, error)
+	ListLeasedWireguardIPs(ctx context.Context) ([]net.IP, error)
+	ListOpenCommandBatches(ctx context.Context) ([]CommandBatch, error)
 	ListOrganizations(ctx context.Context) ([]Organization, error)
+	ListRollbackDevices(ctx context.Context, rolloutID uuid.UUID) ([]RolloutDeviceStatus, error)
 	ListRolloutDeviceStatuses(ctx context.Context, rolloutID uuid.UUID) ([]RolloutDeviceStatus, error)
 	ListRollouts(ctx context.Context, arg ListRolloutsParams) ([]Rollout, error)
+	ListRunningRollouts(ctx context.Context) ([]Rollout, error)
+	ListSubscribedWebhooks(ctx context.Context, arg ListSubscribedWebhooksParams) ([]Webhook, error)
+	ListUncheckpointedAuditChains(ctx context.Context) ([]ListUncheckpointedAuditChainsRow, error)
+	ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	ListWebhooks(ctx context.Context, organizationID uuid.UUID) ([]Webhook, error)
+	LockAuditChain(ctx context.Context, organizationID uuid.UUID) error
+	RecordAuditSinkDelivery(ctx context.Context, arg RecordAuditSinkDeliveryParams) error
+	RecordAuditSinkFailure(ctx context.Context, arg RecordAuditSinkFailureParams) error
+	RecordRolloutDeviceHealth(ctx context.Context, arg RecordRolloutDeviceHealthParams) error
+	RecordRolloutDeviceResult(ctx context.Context, arg RecordRolloutDeviceResultParams) (RolloutDeviceStatus, error)
+	RecordWebhookAttempt(ctx context.Context, arg RecordWebhookAttemptParams) (WebhookDelivery, error)
+	ReenrollDevice(ctx context.Context, arg ReenrollDeviceParams) (Device, error)
+	ReleaseAuditSink(ctx context.Context, id uuid.UUID) error
+	ReleaseRolloutDevice(ctx context.Context, arg ReleaseRolloutDeviceParams) error
+	RemoveDeviceGroupMember(ctx context.Context, arg RemoveDeviceGroupMemberParams) (uuid.UUID, error)
+	ResumeDeviceRollouts(ctx context.Context, deviceID uuid.UUID) error
+	RevokeDeviceKey(ctx context.Context, arg RevokeDeviceKeyParams) error
+	RevokeEnrollmentToken(ctx context.Context, arg RevokeEnrollmentTokenParams) (EnrollmentToken, error)
+	RollupDeviceMetricsHourly(ctx context.Context, arg RollupDeviceMetricsHourlyParams) error
+	SkipDeviceRollouts(ctx context.Context, deviceID uuid.UUID) error
+	SkipPendingRolloutDevices(ctx context.Context, rolloutID uuid.UUID) error
+	SupersedePendingReenrollments(ctx context.Context, deviceID uuid.UUID) error
 	TerminateAccessSession(ctx context.Context, id uuid.UUID) (AccessSession, error)
+	TerminateDeviceAccessSessions(ctx context.Context, deviceID uuid.UUID) ([]AccessSession, error)
+	TransitionRollout(ctx context.Context, arg TransitionRolloutParams) (Rollout, error)
+	UpdateDeviceGroup(ctx context.Context, arg UpdateDeviceGroupParams) (DeviceGroup, error)
 	UpdateDeviceHeartbeat(ctx context.Context, id uuid.UUID) (Device, error)
+	UpdateDeviceKeys(ctx context.Context, arg UpdateDeviceKeysParams) (Device, error)
+	UpdateDeviceLabels(ctx context.Context, arg UpdateDeviceLabelsParams) (Device, error)
+	UpdateDeviceReportedLabels(ctx context.Context, arg UpdateDeviceReportedLabelsParams) error
 	UpdateDeviceStatus(ctx context.Context, arg UpdateDeviceStatusParams) (Device, error)
+	UpdateFileTransferProgress(ctx context.Context, arg UpdateFileTransferProgressParams) (FileTransfer, error)
 	UpdateRolloutDeviceStatus(ctx context.Context, arg UpdateRolloutDeviceStatusParams) (RolloutDeviceStatus, error)
 	UpdateRolloutState(ctx context.Context, arg UpdateRolloutStateParams) (Rollout, error)
+	UpsertDeviceConfig(ctx context.Context, arg UpsertDeviceConfigParams) (DeviceConfig, error)
+	UpsertDeviceConfigReport(ctx context.Context, arg UpsertDeviceConfigReportParams) (DeviceConfigReport, error)
+	UpsertDeviceGroupConfig(ctx context.Context, arg UpsertDeviceGroupConfigParams) (DeviceGroupConfig, error)
 }
 
 var _ Querier = (*Queries)(nil)
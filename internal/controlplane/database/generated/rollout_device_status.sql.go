@@ -11,6 +11,49 @@ import (
 	"github.com/google/uuid"
 )
 
+const claimRolloutDevices = `-- name: ClaimRolloutDevices :many
+-- Marks a rollout's pending devices IN_PROGRESS, only its canaries if
+-- canaries_only
+UPDATE rollout_device_status
+SET status = 'IN_PROGRESS', updated_at = NOW()
+WHERE rollout_id = $1
+  AND status = 'PENDING'
+  AND (is_canary OR NOT $2::boolean)
+RETURNING rollout_id, device_id, is_canary, status, health_check_result, updated_at
+`
+
+type ClaimRolloutDevicesParams struct {
+	RolloutID    uuid.UUID `json:"rollout_id"`
+	CanariesOnly bool      `json:"canaries_only"`
+}
+
+func (q *Queries) ClaimRolloutDevices(ctx context.Context, arg ClaimRolloutDevicesParams) ([]RolloutDeviceStatus, error) {
+	rows, err := q.db.Query(ctx, claimRolloutDevices, arg.RolloutID, arg.CanariesOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []RolloutDeviceStatus{}
+	for rows.Next() {
+		var i RolloutDeviceStatus
+		if err := rows.Scan(
+			&i.RolloutID,
+			&i.DeviceID,
+			&i.IsCanary,
+			&i.Status,
+			&i.HealthCheckResult,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const countRolloutDevicesByStatus = `-- name: CountRolloutDevicesByStatus :one
 SELECT COUNT(*) FROM rollout_device_status
 WHERE rollout_id = $1 AND status = $2
@@ -28,6 +71,52 @@ func (q *Queries) CountRolloutDevicesByStatus(ctx context.Context, arg CountRoll
 	return count, err
 }
 
+const createRolloutDevices = `-- name: CreateRolloutDevices :many
+-- Targets a rollout at the active devices it matches, picking canary_percent
+-- of them, rounded up, at random as its canaries
+INSERT INTO rollout_device_status (rollout_id, device_id, is_canary, status)
+SELECT t.rollout_id, t.device_id, t.rank <= CEIL(t.total * t.canary_percent / 100.0), 'PENDING'
+FROM (
+  SELECT r.id AS rollout_id, d.id AS device_id, r.canary_percent,
+    ROW_NUMBER() OVER (ORDER BY random()) AS rank,
+    COUNT(*) OVER () AS total
+  FROM rollouts r
+  JOIN devices d ON d.organization_id = r.organization_id
+  WHERE r.id = $1
+    AND d.status = 'ACTIVE'
+    AND labels_match(d.reported_labels || d.labels, r.target_selector)
+    AND (r.target_group_id IS NULL OR in_device_group(r.target_group_id, d.id, d.reported_labels || d.labels))
+) t
+RETURNING rollout_id, device_id, is_canary, status, health_check_result, updated_at
+`
+
+func (q *Queries) CreateRolloutDevices(ctx context.Context, id uuid.UUID) ([]RolloutDeviceStatus, error) {
+	rows, err := q.db.Query(ctx, createRolloutDevices, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []RolloutDeviceStatus{}
+	for rows.Next() {
+		var i RolloutDeviceStatus
+		if err := rows.Scan(
+			&i.RolloutID,
+			&i.DeviceID,
+			&i.IsCanary,
+			&i.Status,
+			&i.HealthCheckResult,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createRolloutDeviceStatus = `-- name: CreateRolloutDeviceStatus :one
 INSERT INTO rollout_device_status (
   rollout_id,
@@ -60,6 +149,52 @@ func (q *Queries) CreateRolloutDeviceStatus(ctx context.Context, arg CreateRollo
 	return i, err
 }
 
+const failStalledRolloutDevices = `-- name: FailStalledRolloutDevices :many
+-- Fails a rollout's devices that have not reported the outcome of their
+-- update within timeout_seconds of being sent it
+UPDATE rollout_device_status
+SET status = 'UNHEALTHY',
+  health_check_result = jsonb_build_object('error', $1::text),
+  updated_at = NOW()
+WHERE rollout_id = $2
+  AND status = 'IN_PROGRESS'
+  AND updated_at < NOW() - make_interval(secs => $3::int)
+RETURNING rollout_id, device_id, is_canary, status, health_check_result, updated_at
+`
+
+type FailStalledRolloutDevicesParams struct {
+	Error          string    `json:"error"`
+	RolloutID      uuid.UUID `json:"rollout_id"`
+	TimeoutSeconds int32     `json:"timeout_seconds"`
+}
+
+func (q *Queries) FailStalledRolloutDevices(ctx context.Context, arg FailStalledRolloutDevicesParams) ([]RolloutDeviceStatus, error) {
+	rows, err := q.db.Query(ctx, failStalledRolloutDevices, arg.Error, arg.RolloutID, arg.TimeoutSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []RolloutDeviceStatus{}
+	for rows.Next() {
+		var i RolloutDeviceStatus
+		if err := rows.Scan(
+			&i.RolloutID,
+			&i.DeviceID,
+			&i.IsCanary,
+			&i.Status,
+			&i.HealthCheckResult,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getCanaryDevices = `-- name: GetCanaryDevices :many
 SELECT rollout_id, device_id, is_canary, status, health_check_result, updated_at FROM rollout_device_status
 WHERE rollout_id = $1 AND is_canary = true
@@ -117,6 +252,41 @@ func (q *Queries) GetRolloutDeviceStatus(ctx context.Context, arg GetRolloutDevi
 	return i, err
 }
 
+const listRollbackDevices = `-- name: ListRollbackDevices :many
+-- Lists the active devices a rollout updated successfully, which must be
+-- rolled back when it fails
+SELECT s.rollout_id, s.device_id, s.is_canary, s.status, s.health_check_result, s.updated_at FROM rollout_device_status s
+JOIN devices d ON d.id = s.device_id
+WHERE s.rollout_id = $1 AND s.status = 'HEALTHY' AND d.status = 'ACTIVE'
+`
+
+func (q *Queries) ListRollbackDevices(ctx context.Context, rolloutID uuid.UUID) ([]RolloutDeviceStatus, error) {
+	rows, err := q.db.Query(ctx, listRollbackDevices, rolloutID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []RolloutDeviceStatus{}
+	for rows.Next() {
+		var i RolloutDeviceStatus
+		if err := rows.Scan(
+			&i.RolloutID,
+			&i.DeviceID,
+			&i.IsCanary,
+			&i.Status,
+			&i.HealthCheckResult,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listRolloutDeviceStatuses = `-- name: ListRolloutDeviceStatuses :many
 SELECT rollout_id, device_id, is_canary, status, health_check_result, updated_at FROM rollout_device_status
 WHERE rollout_id = $1
@@ -150,6 +320,110 @@ func (q *Queries) ListRolloutDeviceStatuses(ctx context.Context, rolloutID uuid.
 	return items, nil
 }
 
+const recordRolloutDeviceHealth = `-- name: RecordRolloutDeviceHealth :exec
+UPDATE rollout_device_status
+SET health_check_result = $3
+WHERE rollout_id = $1 AND device_id = $2
+`
+
+type RecordRolloutDeviceHealthParams struct {
+	RolloutID         uuid.UUID `json:"rollout_id"`
+	DeviceID          uuid.UUID `json:"device_id"`
+	HealthCheckResult []byte    `json:"health_check_result"`
+}
+
+func (q *Queries) RecordRolloutDeviceHealth(ctx context.Context, arg RecordRolloutDeviceHealthParams) error {
+	_, err := q.db.Exec(ctx, recordRolloutDeviceHealth, arg.RolloutID, arg.DeviceID, arg.HealthCheckResult)
+	return err
+}
+
+const recordRolloutDeviceResult = `-- name: RecordRolloutDeviceResult :one
+-- Records the outcome a device reports for its update, once
+UPDATE rollout_device_status
+SET status = $1,
+  health_check_result = COALESCE($2, health_check_result),
+  updated_at = NOW()
+WHERE rollout_id = $3
+  AND device_id = $4
+  AND status IN ('PENDING', 'IN_PROGRESS')
+RETURNING rollout_id, device_id, is_canary, status, health_check_result, updated_at
+`
+
+type RecordRolloutDeviceResultParams struct {
+	Status            string    `json:"status"`
+	HealthCheckResult []byte    `json:"health_check_result"`
+	RolloutID         uuid.UUID `json:"rollout_id"`
+	DeviceID          uuid.UUID `json:"device_id"`
+}
+
+func (q *Queries) RecordRolloutDeviceResult(ctx context.Context, arg RecordRolloutDeviceResultParams) (RolloutDeviceStatus, error) {
+	row := q.db.QueryRow(ctx, recordRolloutDeviceResult, arg.Status, arg.HealthCheckResult, arg.RolloutID, arg.DeviceID)
+	var i RolloutDeviceStatus
+	err := row.Scan(
+		&i.RolloutID,
+		&i.DeviceID,
+		&i.IsCanary,
+		&i.Status,
+		&i.HealthCheckResult,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const releaseRolloutDevice = `-- name: ReleaseRolloutDevice :exec
+-- Returns a device that could not be sent its update to PENDING
+UPDATE rollout_device_status
+SET status = 'PENDING', updated_at = NOW()
+WHERE rollout_id = $1 AND device_id = $2 AND status = 'IN_PROGRESS'
+`
+
+type ReleaseRolloutDeviceParams struct {
+	RolloutID uuid.UUID `json:"rollout_id"`
+	DeviceID  uuid.UUID `json:"device_id"`
+}
+
+func (q *Queries) ReleaseRolloutDevice(ctx context.Context, arg ReleaseRolloutDeviceParams) error {
+	_, err := q.db.Exec(ctx, releaseRolloutDevice, arg.RolloutID, arg.DeviceID)
+	return err
+}
+
+const resumeDeviceRollouts = `-- name: ResumeDeviceRollouts :exec
+UPDATE rollout_device_status
+SET status = 'PENDING', updated_at = NOW()
+WHERE device_id = $1
+  AND status = 'SKIPPED'
+  AND rollout_id IN (SELECT id FROM rollouts WHERE state IN ('DRAFT', 'CANARY', 'FULL'))
+`
+
+func (q *Queries) ResumeDeviceRollouts(ctx context.Context, deviceID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, resumeDeviceRollouts, deviceID)
+	return err
+}
+
+const skipDeviceRollouts = `-- name: SkipDeviceRollouts :exec
+UPDATE rollout_device_status
+SET status = 'SKIPPED', updated_at = NOW()
+WHERE device_id = $1
+  AND status IN ('PENDING', 'IN_PROGRESS')
+  AND rollout_id IN (SELECT id FROM rollouts WHERE state IN ('DRAFT', 'CANARY', 'FULL'))
+`
+
+func (q *Queries) SkipDeviceRollouts(ctx context.Context, deviceID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, skipDeviceRollouts, deviceID)
+	return err
+}
+
+const skipPendingRolloutDevices = `-- name: SkipPendingRolloutDevices :exec
+UPDATE rollout_device_status
+SET status = 'SKIPPED', updated_at = NOW()
+WHERE rollout_id = $1 AND status = 'PENDING'
+`
+
+func (q *Queries) SkipPendingRolloutDevices(ctx context.Context, rolloutID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, skipPendingRolloutDevices, rolloutID)
+	return err
+}
+
 const updateRolloutDeviceStatus = `-- name: UpdateRolloutDeviceStatus :one
 UPDATE rollout_device_status
 SET status = $3, health_check_result = $4, updated_at = NOW()
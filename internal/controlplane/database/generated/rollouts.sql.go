@@ -9,13 +9,14 @@ import (
 	"context"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const completeRollout = `-- name: CompleteRollout :one
 UPDATE rollouts
 SET state = 'COMPLETE', completed_at = NOW()
 WHERE id = $1
-RETURNING id, organization_id, artifact_id, target_selector, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at
+RETURNING id, organization_id, artifact_id, target_selector, target_group_id, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at
 `
 
 func (q *Queries) CompleteRollout(ctx context.Context, id uuid.UUID) (Rollout, error) {
@@ -26,6 +27,7 @@ func (q *Queries) CompleteRollout(ctx context.Context, id uuid.UUID) (Rollout, e
 		&i.OrganizationID,
 		&i.ArtifactID,
 		&i.TargetSelector,
+		&i.TargetGroupID,
 		&i.CanaryPercent,
 		&i.SoakTimeSeconds,
 		&i.HealthCheckUrl,
@@ -42,23 +44,25 @@ INSERT INTO rollouts (
   organization_id,
   artifact_id,
   target_selector,
+  target_group_id,
   canary_percent,
   soak_time_seconds,
   health_check_url,
   state
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, 'DRAFT'
+  $1, $2, $3, $4, $5, $6, $7, 'DRAFT'
 )
-RETURNING id, organization_id, artifact_id, target_selector, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at
+RETURNING id, organization_id, artifact_id, target_selector, target_group_id, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at
 `
 
 type CreateRolloutParams struct {
-	OrganizationID  uuid.UUID `json:"organization_id"`
-	ArtifactID      uuid.UUID `json:"artifact_id"`
-	TargetSelector  []byte    `json:"target_selector"`
-	CanaryPercent   int32     `json:"canary_percent"`
-	SoakTimeSeconds int32     `json:"soak_time_seconds"`
-	HealthCheckUrl  string    `json:"health_check_url"`
+	OrganizationID  uuid.UUID   `json:"organization_id"`
+	ArtifactID      uuid.UUID   `json:"artifact_id"`
+	TargetSelector  []byte      `json:"target_selector"`
+	TargetGroupID   pgtype.UUID `json:"target_group_id"`
+	CanaryPercent   int32       `json:"canary_percent"`
+	SoakTimeSeconds int32       `json:"soak_time_seconds"`
+	HealthCheckUrl  string      `json:"health_check_url"`
 }
 
 func (q *Queries) CreateRollout(ctx context.Context, arg CreateRolloutParams) (Rollout, error) {
@@ -66,6 +70,7 @@ func (q *Queries) CreateRollout(ctx context.Context, arg CreateRolloutParams) (R
 		arg.OrganizationID,
 		arg.ArtifactID,
 		arg.TargetSelector,
+		arg.TargetGroupID,
 		arg.CanaryPercent,
 		arg.SoakTimeSeconds,
 		arg.HealthCheckUrl,
@@ -76,6 +81,7 @@ func (q *Queries) CreateRollout(ctx context.Context, arg CreateRolloutParams) (R
 		&i.OrganizationID,
 		&i.ArtifactID,
 		&i.TargetSelector,
+		&i.TargetGroupID,
 		&i.CanaryPercent,
 		&i.SoakTimeSeconds,
 		&i.HealthCheckUrl,
@@ -91,7 +97,7 @@ const failRollout = `-- name: FailRollout :one
 UPDATE rollouts
 SET state = 'FAILED', completed_at = NOW()
 WHERE id = $1
-RETURNING id, organization_id, artifact_id, target_selector, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at
+RETURNING id, organization_id, artifact_id, target_selector, target_group_id, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at
 `
 
 func (q *Queries) FailRollout(ctx context.Context, id uuid.UUID) (Rollout, error) {
@@ -102,6 +108,7 @@ func (q *Queries) FailRollout(ctx context.Context, id uuid.UUID) (Rollout, error
 		&i.OrganizationID,
 		&i.ArtifactID,
 		&i.TargetSelector,
+		&i.TargetGroupID,
 		&i.CanaryPercent,
 		&i.SoakTimeSeconds,
 		&i.HealthCheckUrl,
@@ -114,7 +121,7 @@ func (q *Queries) FailRollout(ctx context.Context, id uuid.UUID) (Rollout, error
 }
 
 const getRollout = `-- name: GetRollout :one
-SELECT id, organization_id, artifact_id, target_selector, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at FROM rollouts
+SELECT id, organization_id, artifact_id, target_selector, target_group_id, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at FROM rollouts
 WHERE id = $1
 `
 
@@ -126,6 +133,7 @@ func (q *Queries) GetRollout(ctx context.Context, id uuid.UUID) (Rollout, error)
 		&i.OrganizationID,
 		&i.ArtifactID,
 		&i.TargetSelector,
+		&i.TargetGroupID,
 		&i.CanaryPercent,
 		&i.SoakTimeSeconds,
 		&i.HealthCheckUrl,
@@ -138,7 +146,7 @@ func (q *Queries) GetRollout(ctx context.Context, id uuid.UUID) (Rollout, error)
 }
 
 const listRollouts = `-- name: ListRollouts :many
-SELECT id, organization_id, artifact_id, target_selector, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at FROM rollouts
+SELECT id, organization_id, artifact_id, target_selector, target_group_id, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at FROM rollouts
 WHERE organization_id = $1
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3
@@ -164,6 +172,7 @@ func (q *Queries) ListRollouts(ctx context.Context, arg ListRolloutsParams) ([]R
 			&i.OrganizationID,
 			&i.ArtifactID,
 			&i.TargetSelector,
+			&i.TargetGroupID,
 			&i.CanaryPercent,
 			&i.SoakTimeSeconds,
 			&i.HealthCheckUrl,
@@ -182,11 +191,87 @@ func (q *Queries) ListRollouts(ctx context.Context, arg ListRolloutsParams) ([]R
 	return items, nil
 }
 
+const listRunningRollouts = `-- name: ListRunningRollouts :many
+SELECT id, organization_id, artifact_id, target_selector, target_group_id, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at FROM rollouts
+WHERE state IN ('CANARY', 'FULL', 'ROLLBACK')
+ORDER BY started_at ASC
+`
+
+func (q *Queries) ListRunningRollouts(ctx context.Context) ([]Rollout, error) {
+	rows, err := q.db.Query(ctx, listRunningRollouts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Rollout{}
+	for rows.Next() {
+		var i Rollout
+		if err := rows.Scan(
+			&i.ID,
+			&i.OrganizationID,
+			&i.ArtifactID,
+			&i.TargetSelector,
+			&i.TargetGroupID,
+			&i.CanaryPercent,
+			&i.SoakTimeSeconds,
+			&i.HealthCheckUrl,
+			&i.State,
+			&i.CreatedAt,
+			&i.StartedAt,
+			&i.CompletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const transitionRollout = `-- name: TransitionRollout :one
+-- Moves a rollout to state if it is in one of from_states, stamping
+-- started_at when it starts and completed_at when it reaches a final state
+UPDATE rollouts
+SET state = $1::text,
+  started_at = CASE WHEN $1::text = 'CANARY' THEN NOW() ELSE started_at END,
+  completed_at = CASE WHEN $1::text IN ('COMPLETE', 'FAILED') THEN NOW() ELSE completed_at END
+WHERE id = $2 AND state = ANY($3::text[])
+RETURNING id, organization_id, artifact_id, target_selector, target_group_id, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at
+`
+
+type TransitionRolloutParams struct {
+	State      string    `json:"state"`
+	ID         uuid.UUID `json:"id"`
+	FromStates []string  `json:"from_states"`
+}
+
+func (q *Queries) TransitionRollout(ctx context.Context, arg TransitionRolloutParams) (Rollout, error) {
+	row := q.db.QueryRow(ctx, transitionRollout, arg.State, arg.ID, arg.FromStates)
+	var i Rollout
+	err := row.Scan(
+		&i.ID,
+		&i.OrganizationID,
+		&i.ArtifactID,
+		&i.TargetSelector,
+		&i.TargetGroupID,
+		&i.CanaryPercent,
+		&i.SoakTimeSeconds,
+		&i.HealthCheckUrl,
+		&i.State,
+		&i.CreatedAt,
+		&i.StartedAt,
+		&i.CompletedAt,
+	)
+	return i, err
+}
+
 const updateRolloutState = `-- name: UpdateRolloutState :one
 UPDATE rollouts
 SET state = $2, started_at = CASE WHEN started_at IS NULL THEN NOW() ELSE started_at END
 WHERE id = $1
-RETURNING id, organization_id, artifact_id, target_selector, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at
+RETURNING id, organization_id, artifact_id, target_selector, target_group_id, canary_percent, soak_time_seconds, health_check_url, state, created_at, started_at, completed_at
 `
 
 type UpdateRolloutStateParams struct {
@@ -202,6 +287,7 @@ func (q *Queries) UpdateRolloutState(ctx context.Context, arg UpdateRolloutState
 		&i.OrganizationID,
 		&i.ArtifactID,
 		&i.TargetSelector,
+		&i.TargetGroupID,
 		&i.CanaryPercent,
 		&i.SoakTimeSeconds,
 		&i.HealthCheckUrl,
@@ -0,0 +1,32 @@
+-- name: CreateAccessPolicy :one
+INSERT INTO access_policies (
+  organization_id,
+  name,
+  device_selector,
+  device_group_id,
+  user_emails,
+  max_duration_seconds
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetAccessPolicy :one
+SELECT * FROM access_policies
+WHERE id = $1 AND organization_id = $2;
+
+-- name: ListAccessPolicies :many
+SELECT * FROM access_policies
+WHERE organization_id = $1
+ORDER BY name ASC;
+
+-- name: ListAccessPoliciesForUser :many
+SELECT * FROM access_policies
+WHERE organization_id = sqlc.arg(organization_id)
+  AND (sqlc.arg(user_email)::text = ANY(user_emails) OR '*' = ANY(user_emails))
+ORDER BY name ASC;
+
+-- name: DeleteAccessPolicy :one
+DELETE FROM access_policies
+WHERE id = $1 AND organization_id = $2
+RETURNING *;
@@ -3,9 +3,12 @@ INSERT INTO access_sessions (
   device_id,
   user_email,
   wireguard_peer_config,
-  expires_at
+  expires_at,
+  client_wireguard_public_key,
+  client_wireguard_ip,
+  allowed_destinations
 ) VALUES (
-  $1, $2, $3, $4
+  $1, $2, $3, $4, $5, $6, $7
 )
 RETURNING *;
 
@@ -26,8 +29,15 @@ SET terminated_at = NOW()
 WHERE id = $1
 RETURNING *;
 
--- name: ExpireOldSessions :exec
+-- name: ExpireOldSessions :many
 UPDATE access_sessions
 SET terminated_at = NOW()
 WHERE expires_at < NOW()
-  AND terminated_at IS NULL;
+  AND terminated_at IS NULL
+RETURNING *;
+
+-- name: TerminateDeviceAccessSessions :many
+UPDATE access_sessions
+SET terminated_at = NOW()
+WHERE device_id = $1 AND terminated_at IS NULL
+RETURNING *;
@@ -0,0 +1,34 @@
+-- name: CreateAuditCheckpoint :one
+INSERT INTO audit_checkpoints (
+  organization_id,
+  sequence,
+  hash,
+  public_key,
+  signature
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+ON CONFLICT (organization_id, sequence) DO NOTHING
+RETURNING *;
+
+-- name: GetLatestAuditCheckpoint :one
+SELECT * FROM audit_checkpoints
+WHERE organization_id = $1
+ORDER BY sequence DESC
+LIMIT 1;
+
+-- name: ListAuditCheckpoints :many
+SELECT * FROM audit_checkpoints
+WHERE organization_id = sqlc.arg(organization_id)
+  AND (sqlc.narg(from_sequence)::bigint IS NULL OR sequence >= sqlc.narg(from_sequence)::bigint)
+  AND (sqlc.narg(to_sequence)::bigint IS NULL OR sequence <= sqlc.narg(to_sequence)::bigint)
+ORDER BY sequence;
+
+-- name: ListUncheckpointedAuditChains :many
+-- Organizations whose chain has grown since their latest checkpoint
+SELECT l.organization_id, MAX(l.sequence)::bigint AS sequence
+FROM audit_logs l
+GROUP BY l.organization_id
+HAVING MAX(l.sequence) > COALESCE(
+  (SELECT MAX(c.sequence) FROM audit_checkpoints c WHERE c.organization_id = l.organization_id), 0
+);
@@ -1,27 +1,58 @@
 -- name: CreateAuditLog :one
 INSERT INTO audit_logs (
+  id,
+  timestamp,
   organization_id,
-  user_email,
+  actor_type,
+  actor,
   event_type,
   resource_type,
   resource_id,
   action,
   result,
   metadata,
-  ip_address
+  ip_address,
+  request_id,
+  sequence,
+  prev_hash,
+  hash
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, $7, $8, $9
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16
 )
 RETURNING *;
 
--- name: ListAuditLogs :many
+-- name: LockAuditChain :exec
+-- Serializes appends to an organization's chain until the transaction ends
+SELECT pg_advisory_xact_lock(hashtextextended(sqlc.arg(organization_id)::uuid::text, 0));
+
+-- name: GetAuditChainHead :one
 SELECT * FROM audit_logs
 WHERE organization_id = $1
-  AND ($2::timestamptz IS NULL OR timestamp >= $2)
-  AND ($3::timestamptz IS NULL OR timestamp <= $3)
-  AND ($4::text IS NULL OR event_type = $4)
-ORDER BY timestamp DESC
-LIMIT $5 OFFSET $6;
+ORDER BY sequence DESC
+LIMIT 1;
+
+-- name: ListAuditChain :many
+SELECT * FROM audit_logs
+WHERE organization_id = sqlc.arg(organization_id)
+  AND sequence >= sqlc.arg(from_sequence)::bigint
+  AND (sqlc.narg(to_sequence)::bigint IS NULL OR sequence <= sqlc.narg(to_sequence)::bigint)
+ORDER BY sequence
+LIMIT sqlc.arg(page_size)::integer;
+
+-- name: ListAuditLogs :many
+SELECT * FROM audit_logs
+WHERE organization_id = sqlc.arg(organization_id)
+  AND (sqlc.narg(start_time)::timestamptz IS NULL OR timestamp >= sqlc.narg(start_time)::timestamptz)
+  AND (sqlc.narg(end_time)::timestamptz IS NULL OR timestamp <= sqlc.narg(end_time)::timestamptz)
+  AND (sqlc.narg(event_type)::text IS NULL OR event_type = sqlc.narg(event_type)::text)
+  AND (sqlc.narg(resource_type)::text IS NULL OR resource_type = sqlc.narg(resource_type)::text)
+  AND (sqlc.narg(resource_id)::text IS NULL OR resource_id = sqlc.narg(resource_id)::text)
+  AND (sqlc.narg(actor_type)::text IS NULL OR actor_type = sqlc.narg(actor_type)::text)
+  AND (sqlc.narg(actor)::text IS NULL OR actor = sqlc.narg(actor)::text)
+  AND (sqlc.narg(cursor_id)::uuid IS NULL
+    OR (timestamp, id) < (sqlc.narg(cursor_time)::timestamptz, sqlc.narg(cursor_id)::uuid))
+ORDER BY timestamp DESC, id DESC
+LIMIT sqlc.arg(page_size)::integer;
 
 -- name: GetAuditLogsByResource :many
 SELECT * FROM audit_logs
@@ -32,3 +63,17 @@ LIMIT $3;
 -- name: DeleteOldAuditLogs :exec
 DELETE FROM audit_logs
 WHERE timestamp < NOW() - INTERVAL '90 days';
+
+-- name: ExportAuditLogs :many
+SELECT * FROM audit_logs
+WHERE organization_id = sqlc.arg(organization_id)
+  AND sequence > sqlc.arg(after_sequence)::bigint
+  AND (sqlc.narg(start_time)::timestamptz IS NULL OR timestamp >= sqlc.narg(start_time)::timestamptz)
+  AND (sqlc.narg(end_time)::timestamptz IS NULL OR timestamp <= sqlc.narg(end_time)::timestamptz)
+  AND (sqlc.narg(event_type)::text IS NULL OR event_type = sqlc.narg(event_type)::text)
+  AND (sqlc.narg(resource_type)::text IS NULL OR resource_type = sqlc.narg(resource_type)::text)
+  AND (sqlc.narg(resource_id)::text IS NULL OR resource_id = sqlc.narg(resource_id)::text)
+  AND (sqlc.narg(actor_type)::text IS NULL OR actor_type = sqlc.narg(actor_type)::text)
+  AND (sqlc.narg(actor)::text IS NULL OR actor = sqlc.narg(actor)::text)
+ORDER BY sequence
+LIMIT sqlc.arg(page_size)::integer;
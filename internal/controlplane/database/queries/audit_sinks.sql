@@ -0,0 +1,64 @@
+-- name: CreateAuditSink :one
+INSERT INTO audit_sinks (
+  organization_id,
+  name,
+  type,
+  config,
+  last_sequence
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetAuditSink :one
+SELECT * FROM audit_sinks
+WHERE id = $1 AND organization_id = $2;
+
+-- name: ListAuditSinks :many
+SELECT * FROM audit_sinks
+WHERE organization_id = $1
+ORDER BY name;
+
+-- name: DeleteAuditSink :one
+DELETE FROM audit_sinks
+WHERE id = $1 AND organization_id = $2
+RETURNING *;
+
+-- name: ListDueAuditSinks :many
+-- Enabled sinks not backing off and not leased by another instance
+SELECT * FROM audit_sinks
+WHERE enabled
+  AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+  AND (leased_until IS NULL OR leased_until < NOW());
+
+-- name: ClaimAuditSink :one
+UPDATE audit_sinks
+SET leased_until = sqlc.arg(leased_until)
+WHERE id = sqlc.arg(id)
+  AND enabled
+  AND (leased_until IS NULL OR leased_until < NOW())
+RETURNING *;
+
+-- name: RecordAuditSinkDelivery :exec
+UPDATE audit_sinks
+SET last_sequence = GREATEST(last_sequence, sqlc.arg(last_sequence)::bigint),
+    last_delivered_at = NOW(),
+    consecutive_failures = 0,
+    last_error = NULL,
+    next_attempt_at = NULL,
+    leased_until = NULL
+WHERE id = sqlc.arg(id);
+
+-- name: RecordAuditSinkFailure :exec
+UPDATE audit_sinks
+SET last_sequence = GREATEST(last_sequence, sqlc.arg(last_sequence)::bigint),
+    consecutive_failures = consecutive_failures + 1,
+    last_error = sqlc.arg(last_error),
+    next_attempt_at = sqlc.arg(next_attempt_at),
+    leased_until = NULL
+WHERE id = sqlc.arg(id);
+
+-- name: ReleaseAuditSink :exec
+UPDATE audit_sinks
+SET leased_until = NULL
+WHERE id = $1;
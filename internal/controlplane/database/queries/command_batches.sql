@@ -0,0 +1,34 @@
+-- name: CreateCommandBatch :one
+INSERT INTO command_batches (
+  organization_id,
+  command,
+  args,
+  target_selector,
+  target_group_id,
+  timeout_seconds,
+  max_concurrency
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+)
+RETURNING *;
+
+-- name: GetCommandBatch :one
+SELECT * FROM command_batches
+WHERE id = $1;
+
+-- name: ListOpenCommandBatches :many
+SELECT * FROM command_batches
+WHERE completed_at IS NULL
+ORDER BY created_at ASC;
+
+-- name: CompleteCommandBatch :one
+-- Completes a batch none of whose commands are left to run
+UPDATE command_batches
+SET completed_at = NOW()
+WHERE id = $1
+  AND completed_at IS NULL
+  AND NOT EXISTS (
+    SELECT 1 FROM device_commands
+    WHERE batch_id = $1 AND state IN ('PENDING', 'RUNNING')
+  )
+RETURNING *;
@@ -0,0 +1,96 @@
+-- name: CreateDeviceCommand :one
+INSERT INTO device_commands (
+  organization_id,
+  device_id,
+  command,
+  args,
+  timeout_seconds,
+  state,
+  started_at
+) VALUES (
+  $1, $2, $3, $4, $5, 'RUNNING', NOW()
+)
+RETURNING *;
+
+-- name: CreateBatchCommands :many
+-- Queues a batch's command for each active device it targets
+INSERT INTO device_commands (
+  organization_id,
+  device_id,
+  batch_id,
+  command,
+  args,
+  timeout_seconds,
+  state
+)
+SELECT b.organization_id, d.id, b.id, b.command, b.args, b.timeout_seconds, 'PENDING'
+FROM command_batches b
+JOIN devices d ON d.organization_id = b.organization_id
+WHERE b.id = $1
+  AND d.status = 'ACTIVE'
+  AND labels_match(d.reported_labels || d.labels, b.target_selector)
+  AND (b.target_group_id IS NULL OR in_device_group(b.target_group_id, d.id, d.reported_labels || d.labels))
+RETURNING *;
+
+-- name: GetDeviceCommand :one
+SELECT * FROM device_commands
+WHERE id = $1;
+
+-- name: ListBatchCommands :many
+SELECT * FROM device_commands
+WHERE batch_id = $1
+ORDER BY created_at ASC, id ASC;
+
+-- name: CountRunningBatchCommands :one
+SELECT COUNT(*) FROM device_commands
+WHERE batch_id = $1 AND state = 'RUNNING';
+
+-- name: ClaimBatchCommands :many
+-- Marks up to max_commands of a batch's pending commands as running
+UPDATE device_commands
+SET state = 'RUNNING', started_at = NOW()
+WHERE id IN (
+  SELECT id FROM device_commands
+  WHERE batch_id = sqlc.arg(batch_id) AND state = 'PENDING'
+  ORDER BY created_at ASC, id ASC
+  LIMIT sqlc.arg(max_commands)::integer
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: AppendDeviceCommandOutput :one
+-- Appends output a device reported for one of its running commands, keeping
+-- at most max_output characters of each stream
+UPDATE device_commands
+SET stdout = left(stdout || sqlc.arg(stdout)::text, sqlc.arg(max_output)::int),
+    stderr = left(stderr || sqlc.arg(stderr)::text, sqlc.arg(max_output)::int),
+    output_truncated = output_truncated
+      OR length(stdout || sqlc.arg(stdout)::text) > sqlc.arg(max_output)::int
+      OR length(stderr || sqlc.arg(stderr)::text) > sqlc.arg(max_output)::int
+WHERE id = sqlc.arg(id) AND device_id = sqlc.arg(device_id) AND state = 'RUNNING'
+RETURNING batch_id;
+
+-- name: CompleteDeviceCommand :one
+UPDATE device_commands
+SET state = sqlc.arg(state),
+    exit_code = sqlc.narg(exit_code),
+    error = sqlc.narg(error),
+    output_truncated = output_truncated OR sqlc.arg(output_truncated)::boolean,
+    completed_at = NOW()
+WHERE id = sqlc.arg(id) AND device_id = sqlc.arg(device_id) AND state = 'RUNNING'
+RETURNING *;
+
+-- name: FailDeviceCommand :one
+UPDATE device_commands
+SET state = 'FAILED', error = sqlc.arg(error)::text, completed_at = NOW()
+WHERE id = sqlc.arg(id) AND state IN ('PENDING', 'RUNNING')
+RETURNING *;
+
+-- name: FailOverdueDeviceCommands :many
+-- Fails running commands whose device has not reported a result within
+-- their timeout plus grace_seconds
+UPDATE device_commands
+SET state = 'FAILED', error = sqlc.arg(error)::text, completed_at = NOW()
+WHERE state = 'RUNNING'
+  AND started_at + make_interval(secs => timeout_seconds + sqlc.arg(grace_seconds)::int) < NOW()
+RETURNING *;
@@ -0,0 +1,56 @@
+-- name: GetDeviceConfig :one
+SELECT * FROM device_configs
+WHERE device_id = $1;
+
+-- name: UpsertDeviceConfig :one
+INSERT INTO device_configs (device_id, document)
+VALUES ($1, $2)
+ON CONFLICT (device_id) DO UPDATE
+SET document = EXCLUDED.document, updated_at = NOW()
+RETURNING *;
+
+-- name: DeleteDeviceConfig :one
+DELETE FROM device_configs
+WHERE device_id = $1
+RETURNING *;
+
+-- name: GetDeviceGroupConfig :one
+SELECT * FROM device_group_configs
+WHERE group_id = $1;
+
+-- name: UpsertDeviceGroupConfig :one
+INSERT INTO device_group_configs (group_id, document)
+VALUES ($1, $2)
+ON CONFLICT (group_id) DO UPDATE
+SET document = EXCLUDED.document, updated_at = NOW()
+RETURNING *;
+
+-- name: DeleteDeviceGroupConfig :one
+DELETE FROM device_group_configs
+WHERE group_id = $1
+RETURNING *;
+
+-- name: ListDeviceGroupConfigsForDevice :many
+-- The configurations of the groups a device belongs to, in the order they
+-- are merged
+SELECT c.* FROM device_group_configs c
+JOIN device_groups g ON g.id = c.group_id
+JOIN devices d ON d.organization_id = g.organization_id
+WHERE d.id = $1
+  AND in_device_group(g.id, d.id, d.reported_labels || d.labels)
+ORDER BY g.name ASC;
+
+-- name: GetDeviceConfigReport :one
+SELECT * FROM device_config_reports
+WHERE device_id = $1;
+
+-- name: UpsertDeviceConfigReport :one
+INSERT INTO device_config_reports (device_id, desired_hash, reported, errors, drifted)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (device_id) DO UPDATE
+SET desired_hash = EXCLUDED.desired_hash,
+    reported = EXCLUDED.reported,
+    errors = EXCLUDED.errors,
+    drifted = EXCLUDED.drifted,
+    reported_at = NOW()
+RETURNING *;
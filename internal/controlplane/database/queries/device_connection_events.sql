@@ -0,0 +1,15 @@
+-- name: CreateDeviceConnectionEvent :one
+INSERT INTO device_connection_events (
+  device_id,
+  event_type,
+  reason
+) VALUES (
+  $1, $2, $3
+)
+RETURNING *;
+
+-- name: ListDeviceConnectionEvents :many
+SELECT * FROM device_connection_events
+WHERE device_id = $1
+ORDER BY occurred_at DESC
+LIMIT $2;
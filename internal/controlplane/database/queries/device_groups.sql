@@ -0,0 +1,48 @@
+-- name: CreateDeviceGroup :one
+INSERT INTO device_groups (
+  organization_id,
+  name,
+  description,
+  membership,
+  selector
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetDeviceGroup :one
+SELECT * FROM device_groups
+WHERE id = $1 AND organization_id = $2;
+
+-- name: ListDeviceGroups :many
+SELECT * FROM device_groups
+WHERE organization_id = $1
+ORDER BY name ASC;
+
+-- name: UpdateDeviceGroup :one
+UPDATE device_groups
+SET name = $3, description = $4, selector = $5
+WHERE id = $1 AND organization_id = $2
+RETURNING *;
+
+-- name: DeleteDeviceGroup :one
+DELETE FROM device_groups
+WHERE id = $1 AND organization_id = $2
+RETURNING *;
+
+-- name: AddDeviceGroupMember :exec
+INSERT INTO device_group_members (group_id, device_id)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveDeviceGroupMember :one
+DELETE FROM device_group_members
+WHERE group_id = $1 AND device_id = $2
+RETURNING device_id;
+
+-- name: ListDeviceGroupsForDevice :many
+SELECT g.* FROM device_groups g
+JOIN devices d ON d.organization_id = g.organization_id
+WHERE d.id = $1
+  AND in_device_group(g.id, d.id, d.reported_labels || d.labels)
+ORDER BY g.name ASC;
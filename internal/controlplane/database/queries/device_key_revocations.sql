@@ -0,0 +1,16 @@
+-- name: RevokeDeviceKey :exec
+INSERT INTO device_key_revocations (
+  public_key,
+  device_id,
+  key_type,
+  reason
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (public_key) DO NOTHING;
+
+-- name: IsDeviceKeyRevoked :one
+SELECT EXISTS (
+  SELECT 1 FROM device_key_revocations
+  WHERE public_key = $1
+);
@@ -0,0 +1,23 @@
+-- name: InsertDeviceLogs :exec
+INSERT INTO device_logs (device_id, source, logged_at, message)
+SELECT sqlc.arg(device_id)::uuid, u.source, u.logged_at, u.message
+FROM unnest(
+  sqlc.arg(sources)::text[],
+  sqlc.arg(logged_at)::timestamptz[],
+  sqlc.arg(messages)::text[]
+) AS u(source, logged_at, message);
+
+-- name: ListDeviceLogs :many
+-- Returns the most recent matching entries, newest first; an empty sources
+-- array matches every source
+SELECT * FROM device_logs
+WHERE device_id = sqlc.arg(device_id)
+  AND logged_at >= sqlc.arg(since)::timestamptz
+  AND logged_at <= sqlc.arg(until)::timestamptz
+  AND (cardinality(sqlc.arg(sources)::text[]) = 0 OR source = ANY(sqlc.arg(sources)::text[]))
+ORDER BY logged_at DESC, id DESC
+LIMIT sqlc.arg(max_entries);
+
+-- name: DeleteOldDeviceLogs :exec
+DELETE FROM device_logs
+WHERE logged_at < sqlc.arg(older_than)::timestamptz;
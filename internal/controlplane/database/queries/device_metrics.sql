@@ -0,0 +1,124 @@
+-- name: InsertDeviceMetrics :exec
+INSERT INTO device_metrics (
+  device_id,
+  recorded_at,
+  cpu_percent,
+  memory_percent,
+  memory_total_bytes,
+  disk_used_bytes,
+  disk_total_bytes,
+  uptime_seconds,
+  load1,
+  load5,
+  load15,
+  network_rx_bytes,
+  network_tx_bytes,
+  max_temperature_celsius
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
+)
+ON CONFLICT (device_id, recorded_at) DO NOTHING;
+
+-- name: GetDeviceMetricsSeries :many
+SELECT
+  date_bin(sqlc.arg(step)::interval, recorded_at, TIMESTAMPTZ '2000-01-01 00:00:00+00')::timestamptz AS bucket,
+  COUNT(*)::integer AS samples,
+  AVG(cpu_percent)::float8 AS cpu_percent_avg,
+  MAX(cpu_percent)::float8 AS cpu_percent_max,
+  AVG(memory_percent)::float8 AS memory_percent_avg,
+  MAX(memory_percent)::float8 AS memory_percent_max,
+  MAX(disk_used_bytes)::bigint AS disk_used_bytes_max,
+  MAX(disk_total_bytes)::bigint AS disk_total_bytes,
+  AVG(load1)::float8 AS load1_avg,
+  MAX(network_rx_bytes)::bigint AS network_rx_bytes_max,
+  MAX(network_tx_bytes)::bigint AS network_tx_bytes_max,
+  COUNT(max_temperature_celsius)::integer AS temperature_samples,
+  COALESCE(MAX(max_temperature_celsius), 0)::float8 AS temperature_max_celsius
+FROM device_metrics
+WHERE device_id = sqlc.arg(device_id)
+  AND recorded_at >= sqlc.arg(from_time)::timestamptz
+  AND recorded_at < sqlc.arg(to_time)::timestamptz
+GROUP BY 1
+ORDER BY 1;
+
+-- name: GetDeviceMetricsHourlySeries :many
+SELECT
+  date_bin(sqlc.arg(step)::interval, bucket, TIMESTAMPTZ '2000-01-01 00:00:00+00')::timestamptz AS bucket,
+  SUM(samples)::integer AS samples,
+  (SUM(cpu_percent_avg * samples) / SUM(samples))::float8 AS cpu_percent_avg,
+  MAX(cpu_percent_max)::float8 AS cpu_percent_max,
+  (SUM(memory_percent_avg * samples) / SUM(samples))::float8 AS memory_percent_avg,
+  MAX(memory_percent_max)::float8 AS memory_percent_max,
+  MAX(disk_used_bytes_max)::bigint AS disk_used_bytes_max,
+  MAX(disk_total_bytes)::bigint AS disk_total_bytes,
+  (SUM(load1_avg * samples) / SUM(samples))::float8 AS load1_avg,
+  MAX(network_rx_bytes_max)::bigint AS network_rx_bytes_max,
+  MAX(network_tx_bytes_max)::bigint AS network_tx_bytes_max,
+  SUM(temperature_samples)::integer AS temperature_samples,
+  MAX(temperature_max_celsius)::float8 AS temperature_max_celsius
+FROM device_metrics_hourly
+WHERE device_id = sqlc.arg(device_id)
+  AND bucket >= sqlc.arg(from_time)::timestamptz
+  AND bucket < sqlc.arg(to_time)::timestamptz
+GROUP BY 1
+ORDER BY 1;
+
+-- name: RollupDeviceMetricsHourly :exec
+INSERT INTO device_metrics_hourly (
+  device_id,
+  bucket,
+  samples,
+  cpu_percent_avg,
+  cpu_percent_max,
+  memory_percent_avg,
+  memory_percent_max,
+  disk_used_bytes_max,
+  disk_total_bytes,
+  load1_avg,
+  network_rx_bytes_max,
+  network_tx_bytes_max,
+  temperature_samples,
+  temperature_max_celsius
+)
+SELECT
+  device_id,
+  date_trunc('hour', recorded_at),
+  COUNT(*),
+  AVG(cpu_percent),
+  MAX(cpu_percent),
+  AVG(memory_percent),
+  MAX(memory_percent),
+  MAX(disk_used_bytes),
+  MAX(disk_total_bytes),
+  AVG(load1),
+  MAX(network_rx_bytes),
+  MAX(network_tx_bytes),
+  COUNT(max_temperature_celsius),
+  COALESCE(MAX(max_temperature_celsius), 0)
+FROM device_metrics
+WHERE recorded_at >= sqlc.arg(from_time)::timestamptz
+  AND recorded_at < sqlc.arg(to_time)::timestamptz
+GROUP BY device_id, date_trunc('hour', recorded_at)
+ON CONFLICT (device_id, bucket) DO UPDATE SET
+  samples = EXCLUDED.samples,
+  cpu_percent_avg = EXCLUDED.cpu_percent_avg,
+  cpu_percent_max = EXCLUDED.cpu_percent_max,
+  memory_percent_avg = EXCLUDED.memory_percent_avg,
+  memory_percent_max = EXCLUDED.memory_percent_max,
+  disk_used_bytes_max = EXCLUDED.disk_used_bytes_max,
+  disk_total_bytes = EXCLUDED.disk_total_bytes,
+  load1_avg = EXCLUDED.load1_avg,
+  network_rx_bytes_max = EXCLUDED.network_rx_bytes_max,
+  network_tx_bytes_max = EXCLUDED.network_tx_bytes_max,
+  temperature_samples = EXCLUDED.temperature_samples,
+  temperature_max_celsius = EXCLUDED.temperature_max_celsius;
+
+-- name: DeleteOldDeviceMetricsHourly :exec
+DELETE FROM device_metrics_hourly
+WHERE bucket < sqlc.arg(older_than)::timestamptz;
+
+-- name: CreateDeviceMetricsPartitions :exec
+SELECT create_device_metrics_partitions(sqlc.arg(start_at)::timestamptz, sqlc.arg(days)::integer);
+
+-- name: DropDeviceMetricsPartitions :one
+SELECT drop_device_metrics_partitions(sqlc.arg(older_than)::timestamptz)::integer AS dropped;
@@ -0,0 +1,34 @@
+-- name: CreateDeviceReenrollment :one
+INSERT INTO device_reenrollments (
+  organization_id,
+  device_id,
+  public_key,
+  wireguard_public_key,
+  platform,
+  agent_version,
+  status
+) VALUES (
+  $1, $2, $3, $4, $5, $6, 'PENDING'
+)
+RETURNING *;
+
+-- name: GetDeviceReenrollment :one
+SELECT * FROM device_reenrollments
+WHERE id = $1;
+
+-- name: ListDeviceReenrollments :many
+SELECT * FROM device_reenrollments
+WHERE organization_id = sqlc.arg(organization_id)
+  AND (sqlc.narg(status)::text IS NULL OR status = sqlc.narg(status)::text)
+ORDER BY requested_at DESC;
+
+-- name: DecideDeviceReenrollment :one
+UPDATE device_reenrollments
+SET status = $2, decided_at = NOW()
+WHERE id = $1 AND status = 'PENDING'
+RETURNING *;
+
+-- name: SupersedePendingReenrollments :exec
+UPDATE device_reenrollments
+SET status = 'REJECTED', decided_at = NOW()
+WHERE device_id = $1 AND status = 'PENDING';
@@ -53,3 +53,95 @@ SELECT * FROM devices
 WHERE status = 'ACTIVE'
   AND last_seen_at < NOW() - INTERVAL '5 minutes'
 ORDER BY last_seen_at ASC;
+
+-- name: ListDevicesPage :many
+WITH filtered AS (
+  SELECT
+    devices.*,
+    (CASE sqlc.arg(sort_by)::text
+      WHEN 'last_seen_at' THEN COALESCE(to_char(last_seen_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US'), '')
+      WHEN 'agent_version' THEN agent_version
+      WHEN 'platform' THEN platform
+      WHEN 'status' THEN status
+      ELSE to_char(created_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS.US')
+    END)::text AS sort_key
+  FROM devices
+  WHERE organization_id = sqlc.arg(organization_id)
+    AND (sqlc.narg(status)::text IS NULL OR status = sqlc.narg(status)::text)
+    AND (sqlc.narg(site_tag)::text IS NULL OR site_tag = sqlc.narg(site_tag)::text)
+    AND (sqlc.narg(platform)::text IS NULL OR platform = sqlc.narg(platform)::text)
+    AND (sqlc.narg(agent_version)::text IS NULL OR agent_version = sqlc.narg(agent_version)::text)
+    AND (sqlc.narg(online)::boolean IS NULL
+      OR (last_seen_at IS NOT NULL AND last_seen_at > NOW() - INTERVAL '5 minutes') = sqlc.narg(online)::boolean)
+    AND (sqlc.narg(last_seen_after)::timestamptz IS NULL OR last_seen_at >= sqlc.narg(last_seen_after)::timestamptz)
+    AND (sqlc.narg(last_seen_before)::timestamptz IS NULL OR last_seen_at < sqlc.narg(last_seen_before)::timestamptz)
+    AND (sqlc.narg(label_selector)::jsonb IS NULL OR labels_match(reported_labels || labels, sqlc.narg(label_selector)::jsonb))
+    AND (sqlc.narg(group_id)::uuid IS NULL OR in_device_group(sqlc.narg(group_id)::uuid, id, reported_labels || labels))
+)
+SELECT * FROM filtered
+WHERE sqlc.narg(cursor_id)::uuid IS NULL
+  OR (sqlc.arg(sort_desc)::boolean AND (sort_key, id) < (sqlc.arg(cursor_key)::text, sqlc.narg(cursor_id)::uuid))
+  OR (NOT sqlc.arg(sort_desc)::boolean AND (sort_key, id) > (sqlc.arg(cursor_key)::text, sqlc.narg(cursor_id)::uuid))
+ORDER BY
+  CASE WHEN sqlc.arg(sort_desc)::boolean THEN sort_key END DESC,
+  CASE WHEN sqlc.arg(sort_desc)::boolean THEN id END DESC,
+  sort_key ASC,
+  id ASC
+LIMIT sqlc.arg(page_size)::integer;
+
+-- name: CountDevicesPage :one
+SELECT COUNT(*) FROM devices
+WHERE organization_id = sqlc.arg(organization_id)
+  AND (sqlc.narg(status)::text IS NULL OR status = sqlc.narg(status)::text)
+  AND (sqlc.narg(site_tag)::text IS NULL OR site_tag = sqlc.narg(site_tag)::text)
+  AND (sqlc.narg(platform)::text IS NULL OR platform = sqlc.narg(platform)::text)
+  AND (sqlc.narg(agent_version)::text IS NULL OR agent_version = sqlc.narg(agent_version)::text)
+  AND (sqlc.narg(online)::boolean IS NULL
+    OR (last_seen_at IS NOT NULL AND last_seen_at > NOW() - INTERVAL '5 minutes') = sqlc.narg(online)::boolean)
+  AND (sqlc.narg(last_seen_after)::timestamptz IS NULL OR last_seen_at >= sqlc.narg(last_seen_after)::timestamptz)
+  AND (sqlc.narg(last_seen_before)::timestamptz IS NULL OR last_seen_at < sqlc.narg(last_seen_before)::timestamptz)
+  AND (sqlc.narg(label_selector)::jsonb IS NULL OR labels_match(reported_labels || labels, sqlc.narg(label_selector)::jsonb))
+  AND (sqlc.narg(group_id)::uuid IS NULL OR in_device_group(sqlc.narg(group_id)::uuid, id, reported_labels || labels));
+
+-- name: UpdateDeviceLabels :one
+UPDATE devices
+SET labels = $2
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateDeviceReportedLabels :exec
+UPDATE devices
+SET reported_labels = $2
+WHERE id = $1 AND reported_labels <> $2;
+
+-- name: CountRolloutTargets :one
+SELECT COUNT(*) FROM devices
+WHERE organization_id = sqlc.arg(organization_id)
+  AND status = 'ACTIVE'
+  AND labels_match(reported_labels || labels, sqlc.arg(selector)::jsonb)
+  AND (sqlc.narg(group_id)::uuid IS NULL OR in_device_group(sqlc.narg(group_id)::uuid, id, reported_labels || labels));
+
+-- name: ListLeasedWireguardIPs :many
+SELECT wireguard_ip FROM devices
+WHERE status <> 'DECOMMISSIONED'
+UNION
+SELECT client_wireguard_ip FROM access_sessions
+WHERE client_wireguard_ip IS NOT NULL AND terminated_at IS NULL
+ORDER BY wireguard_ip ASC;
+
+-- name: UpdateDeviceKeys :one
+UPDATE devices
+SET public_key = $2, wireguard_public_key = $3
+WHERE id = $1
+RETURNING *;
+
+-- name: ReenrollDevice :one
+UPDATE devices
+SET public_key = $2,
+    wireguard_public_key = $3,
+    wireguard_ip = $4,
+    platform = $5,
+    agent_version = $6,
+    status = 'ACTIVE'
+WHERE id = $1
+RETURNING *;
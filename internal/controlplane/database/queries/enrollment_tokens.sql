@@ -14,7 +14,8 @@ RETURNING *;
 SELECT * FROM enrollment_tokens
 WHERE token_hash = $1
   AND expires_at > NOW()
-  AND used_count < max_uses;
+  AND used_count < max_uses
+  AND revoked_at IS NULL;
 
 -- name: IncrementTokenUsage :one
 UPDATE enrollment_tokens
@@ -28,6 +29,12 @@ WHERE organization_id = $1
 ORDER BY created_at DESC
 LIMIT $2 OFFSET $3;
 
+-- name: RevokeEnrollmentToken :one
+UPDATE enrollment_tokens
+SET revoked_at = NOW()
+WHERE id = $1 AND organization_id = $2 AND revoked_at IS NULL
+RETURNING *;
+
 -- name: DeleteExpiredTokens :exec
 DELETE FROM enrollment_tokens
 WHERE expires_at < NOW() AND used_count < max_uses;
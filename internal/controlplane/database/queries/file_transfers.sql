@@ -0,0 +1,59 @@
+-- name: CreateFileTransfer :one
+INSERT INTO file_transfers (
+  id,
+  organization_id,
+  device_id,
+  direction,
+  path,
+  size,
+  blake3_hash,
+  mode,
+  state
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, 'IN_PROGRESS'
+)
+RETURNING *;
+
+-- name: GetFileTransfer :one
+SELECT * FROM file_transfers
+WHERE id = $1;
+
+-- name: UpdateFileTransferProgress :one
+-- Records progress on a transfer in progress. An upload's progress is what
+-- the device reports having received, which goes back to nothing if the
+-- device discards a corrupt partial file.
+UPDATE file_transfers
+SET transferred = sqlc.arg(transferred),
+    updated_at = NOW()
+WHERE id = sqlc.arg(id) AND state = 'IN_PROGRESS'
+RETURNING *;
+
+-- name: CompleteFileTransfer :one
+UPDATE file_transfers
+SET state = 'COMPLETED',
+    transferred = size,
+    updated_at = NOW(),
+    completed_at = NOW()
+WHERE id = $1 AND state = 'IN_PROGRESS'
+RETURNING *;
+
+-- name: EndFileTransfer :one
+-- Fails or aborts a transfer in progress
+UPDATE file_transfers
+SET state = sqlc.arg(state),
+    error = sqlc.arg(error),
+    updated_at = NOW(),
+    completed_at = NOW()
+WHERE id = sqlc.arg(id) AND state = 'IN_PROGRESS'
+RETURNING *;
+
+-- name: ExpireFileTransfers :many
+-- Fails transfers in progress that have been idle too long
+UPDATE file_transfers
+SET state = 'FAILED',
+    error = 'expired',
+    updated_at = NOW(),
+    completed_at = NOW()
+WHERE state = 'IN_PROGRESS'
+  AND updated_at < sqlc.arg(idle_since)::timestamptz
+RETURNING *;
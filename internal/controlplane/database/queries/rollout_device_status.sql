@@ -32,3 +32,91 @@ WHERE rollout_id = $1 AND status = $2;
 SELECT * FROM rollout_device_status
 WHERE rollout_id = $1 AND is_canary = true
 ORDER BY updated_at ASC;
+
+-- name: SkipDeviceRollouts :exec
+UPDATE rollout_device_status
+SET status = 'SKIPPED', updated_at = NOW()
+WHERE device_id = $1
+  AND status IN ('PENDING', 'IN_PROGRESS')
+  AND rollout_id IN (SELECT id FROM rollouts WHERE state IN ('DRAFT', 'CANARY', 'FULL'));
+
+-- name: ResumeDeviceRollouts :exec
+UPDATE rollout_device_status
+SET status = 'PENDING', updated_at = NOW()
+WHERE device_id = $1
+  AND status = 'SKIPPED'
+  AND rollout_id IN (SELECT id FROM rollouts WHERE state IN ('DRAFT', 'CANARY', 'FULL'));
+
+-- name: CreateRolloutDevices :many
+-- Targets a rollout at the active devices it matches, picking canary_percent
+-- of them, rounded up, at random as its canaries
+INSERT INTO rollout_device_status (rollout_id, device_id, is_canary, status)
+SELECT t.rollout_id, t.device_id, t.rank <= CEIL(t.total * t.canary_percent / 100.0), 'PENDING'
+FROM (
+  SELECT r.id AS rollout_id, d.id AS device_id, r.canary_percent,
+    ROW_NUMBER() OVER (ORDER BY random()) AS rank,
+    COUNT(*) OVER () AS total
+  FROM rollouts r
+  JOIN devices d ON d.organization_id = r.organization_id
+  WHERE r.id = $1
+    AND d.status = 'ACTIVE'
+    AND labels_match(d.reported_labels || d.labels, r.target_selector)
+    AND (r.target_group_id IS NULL OR in_device_group(r.target_group_id, d.id, d.reported_labels || d.labels))
+) t
+RETURNING *;
+
+-- name: ClaimRolloutDevices :many
+-- Marks a rollout's pending devices IN_PROGRESS, only its canaries if
+-- canaries_only
+UPDATE rollout_device_status
+SET status = 'IN_PROGRESS', updated_at = NOW()
+WHERE rollout_id = sqlc.arg(rollout_id)
+  AND status = 'PENDING'
+  AND (is_canary OR NOT sqlc.arg(canaries_only)::boolean)
+RETURNING *;
+
+-- name: ReleaseRolloutDevice :exec
+-- Returns a device that could not be sent its update to PENDING
+UPDATE rollout_device_status
+SET status = 'PENDING', updated_at = NOW()
+WHERE rollout_id = $1 AND device_id = $2 AND status = 'IN_PROGRESS';
+
+-- name: RecordRolloutDeviceResult :one
+-- Records the outcome a device reports for its update, once
+UPDATE rollout_device_status
+SET status = sqlc.arg(status),
+  health_check_result = COALESCE(sqlc.narg(health_check_result), health_check_result),
+  updated_at = NOW()
+WHERE rollout_id = sqlc.arg(rollout_id)
+  AND device_id = sqlc.arg(device_id)
+  AND status IN ('PENDING', 'IN_PROGRESS')
+RETURNING *;
+
+-- name: RecordRolloutDeviceHealth :exec
+UPDATE rollout_device_status
+SET health_check_result = $3
+WHERE rollout_id = $1 AND device_id = $2;
+
+-- name: FailStalledRolloutDevices :many
+-- Fails a rollout's devices that have not reported the outcome of their
+-- update within timeout_seconds of being sent it
+UPDATE rollout_device_status
+SET status = 'UNHEALTHY',
+  health_check_result = jsonb_build_object('error', sqlc.arg(error)::text),
+  updated_at = NOW()
+WHERE rollout_id = sqlc.arg(rollout_id)
+  AND status = 'IN_PROGRESS'
+  AND updated_at < NOW() - make_interval(secs => sqlc.arg(timeout_seconds)::int)
+RETURNING *;
+
+-- name: ListRollbackDevices :many
+-- Lists the active devices a rollout updated successfully, which must be
+-- rolled back when it fails
+SELECT s.* FROM rollout_device_status s
+JOIN devices d ON d.id = s.device_id
+WHERE s.rollout_id = $1 AND s.status = 'HEALTHY' AND d.status = 'ACTIVE';
+
+-- name: SkipPendingRolloutDevices :exec
+UPDATE rollout_device_status
+SET status = 'SKIPPED', updated_at = NOW()
+WHERE rollout_id = $1 AND status = 'PENDING';
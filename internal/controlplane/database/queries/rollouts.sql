@@ -3,12 +3,13 @@ INSERT INTO rollouts (
   organization_id,
   artifact_id,
   target_selector,
+  target_group_id,
   canary_percent,
   soak_time_seconds,
   health_check_url,
   state
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, 'DRAFT'
+  $1, $2, $3, $4, $5, $6, $7, 'DRAFT'
 )
 RETURNING *;
 
@@ -39,3 +40,18 @@ UPDATE rollouts
 SET state = 'FAILED', completed_at = NOW()
 WHERE id = $1
 RETURNING *;
+
+-- name: TransitionRollout :one
+-- Moves a rollout to state if it is in one of from_states, stamping
+-- started_at when it starts and completed_at when it reaches a final state
+UPDATE rollouts
+SET state = sqlc.arg(state)::text,
+  started_at = CASE WHEN sqlc.arg(state)::text = 'CANARY' THEN NOW() ELSE started_at END,
+  completed_at = CASE WHEN sqlc.arg(state)::text IN ('COMPLETE', 'FAILED') THEN NOW() ELSE completed_at END
+WHERE id = sqlc.arg(id) AND state = ANY(sqlc.arg(from_states)::text[])
+RETURNING *;
+
+-- name: ListRunningRollouts :many
+SELECT * FROM rollouts
+WHERE state IN ('CANARY', 'FULL', 'ROLLBACK')
+ORDER BY started_at ASC;
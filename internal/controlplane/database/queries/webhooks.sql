@@ -0,0 +1,89 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (
+  organization_id,
+  name,
+  url,
+  secret,
+  event_types
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks
+WHERE id = $1 AND organization_id = $2;
+
+-- name: GetWebhookByID :one
+SELECT * FROM webhooks
+WHERE id = $1;
+
+-- name: ListWebhooks :many
+SELECT * FROM webhooks
+WHERE organization_id = $1
+ORDER BY name;
+
+-- name: DeleteWebhook :one
+DELETE FROM webhooks
+WHERE id = $1 AND organization_id = $2
+RETURNING *;
+
+-- name: ListSubscribedWebhooks :many
+SELECT * FROM webhooks
+WHERE organization_id = sqlc.arg(organization_id)
+  AND enabled
+  AND sqlc.arg(event_type)::text = ANY(event_types);
+
+-- name: CreateWebhookDelivery :one
+-- An event is queued once per webhook; queueing it again returns no rows
+INSERT INTO webhook_deliveries (
+  webhook_id,
+  event_id,
+  event_type,
+  payload,
+  redelivery_of
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+ON CONFLICT (webhook_id, event_id) WHERE redelivery_of IS NULL DO NOTHING
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1 AND webhook_id = $2;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = sqlc.arg(webhook_id)
+  AND (sqlc.narg(status)::text IS NULL OR status = sqlc.narg(status)::text)
+  AND (sqlc.narg(cursor_id)::uuid IS NULL
+    OR (created_at, id) < (sqlc.narg(cursor_time)::timestamptz, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size)::integer;
+
+-- name: ClaimWebhookDeliveries :many
+-- Leases due deliveries so that only one instance attempts each
+UPDATE webhook_deliveries
+SET leased_until = sqlc.arg(leased_until)
+WHERE id IN (
+  SELECT d.id FROM webhook_deliveries d
+  WHERE d.status = 'PENDING'
+    AND d.next_attempt_at <= NOW()
+    AND (d.leased_until IS NULL OR d.leased_until < NOW())
+  ORDER BY d.next_attempt_at
+  LIMIT sqlc.arg(batch_size)::integer
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RecordWebhookAttempt :one
+UPDATE webhook_deliveries
+SET status = sqlc.arg(status),
+    attempts = attempts + 1,
+    next_attempt_at = sqlc.arg(next_attempt_at),
+    leased_until = NULL,
+    response_status = sqlc.narg(response_status),
+    last_error = sqlc.narg(last_error),
+    delivered_at = CASE WHEN sqlc.arg(status) = 'SUCCEEDED' THEN NOW() ELSE delivered_at END
+WHERE id = sqlc.arg(id)
+RETURNING *;
@@ -20,7 +20,8 @@ CREATE TABLE enrollment_tokens (
   expires_at TIMESTAMPTZ NOT NULL,
   max_uses INTEGER NOT NULL DEFAULT 1,
   used_count INTEGER NOT NULL DEFAULT 0,
-  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  revoked_at TIMESTAMPTZ
 );
 
 CREATE INDEX idx_enrollment_tokens_org ON enrollment_tokens(organization_id);
@@ -36,6 +37,8 @@ CREATE TABLE devices (
   agent_version TEXT NOT NULL,
   platform TEXT NOT NULL,
   site_tag TEXT,
+  labels JSONB NOT NULL DEFAULT '{}',
+  reported_labels JSONB NOT NULL DEFAULT '{}',
   status TEXT NOT NULL CHECK (status IN ('ACTIVE', 'SUSPENDED', 'DECOMMISSIONED')),
   last_seen_at TIMESTAMPTZ,
   created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
@@ -45,8 +48,124 @@ CREATE INDEX idx_devices_org ON devices(organization_id);
 CREATE INDEX idx_devices_status ON devices(status);
 CREATE INDEX idx_devices_last_seen ON devices(last_seen_at);
 CREATE INDEX idx_devices_site_tag ON devices(site_tag) WHERE site_tag IS NOT NULL;
+-- A WireGuard IP is leased to a device until it is decommissioned
+CREATE UNIQUE INDEX idx_devices_wireguard_ip_lease ON devices(wireguard_ip) WHERE status <> 'DECOMMISSIONED';
+
+-- Evaluates a label selector against a label set. The selector is the JSON
+-- form produced by pkg/labels: an array of {key, operator, values} terms.
+-- As in Kubernetes, != and notin also match sets that lack the key. Only
+-- an empty array matches every set; anything but an array is an error, so a
+-- malformed selector cannot select the whole fleet.
+CREATE OR REPLACE FUNCTION labels_match(labels JSONB, selector JSONB)
+RETURNS BOOLEAN AS $$
+DECLARE
+  req JSONB;
+  val TEXT;
+BEGIN
+  IF selector IS NULL OR jsonb_typeof(selector) <> 'array' THEN
+    RAISE EXCEPTION 'label selector must be a JSON array, not %', COALESCE(jsonb_typeof(selector), 'NULL');
+  END IF;
+
+  FOR req IN SELECT * FROM jsonb_array_elements(selector) LOOP
+    val := labels ->> (req ->> 'key');
+    CASE req ->> 'operator'
+      WHEN 'exists' THEN
+        IF val IS NULL THEN RETURN FALSE; END IF;
+      WHEN '!' THEN
+        IF val IS NOT NULL THEN RETURN FALSE; END IF;
+      WHEN '=', 'in' THEN
+        IF val IS NULL OR NOT (req -> 'values') ? val THEN RETURN FALSE; END IF;
+      WHEN '!=', 'notin' THEN
+        IF val IS NOT NULL AND (req -> 'values') ? val THEN RETURN FALSE; END IF;
+      ELSE
+        RAISE EXCEPTION 'unknown selector operator: %', req ->> 'operator';
+    END CASE;
+  END LOOP;
+
+  RETURN TRUE;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- Device connect/disconnect history for presence tracking
+CREATE TABLE device_connection_events (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  event_type TEXT NOT NULL CHECK (event_type IN ('CONNECTED', 'DISCONNECTED')),
+  reason TEXT NOT NULL,
+  occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_device_connection_events_device ON device_connection_events(device_id, occurred_at DESC);
+
+-- Device keys that may no longer be used, after rotation, re-enrollment or decommissioning
+CREATE TABLE device_key_revocations (
+  public_key TEXT PRIMARY KEY,
+  device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  key_type TEXT NOT NULL CHECK (key_type IN ('ED25519', 'WIREGUARD')),
+  reason TEXT NOT NULL CHECK (reason IN ('ROTATED', 'REENROLLED', 'DECOMMISSIONED')),
+  revoked_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_device_key_revocations_device ON device_key_revocations(device_id);
+
+-- Requests to bind new keys to an existing device record, e.g. after re-imaging.
+-- They take effect only once an operator approves them.
+CREATE TABLE device_reenrollments (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  public_key TEXT NOT NULL,
+  wireguard_public_key TEXT NOT NULL,
+  platform TEXT NOT NULL,
+  agent_version TEXT NOT NULL,
+  status TEXT NOT NULL CHECK (status IN ('PENDING', 'APPROVED', 'REJECTED')),
+  requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  decided_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_device_reenrollments_org_status ON device_reenrollments(organization_id, status);
+CREATE UNIQUE INDEX idx_device_reenrollments_pending ON device_reenrollments(device_id) WHERE status = 'PENDING';
+
+-- Named sets of devices. STATIC groups list their members explicitly;
+-- DYNAMIC groups contain every device matching their label selector.
+CREATE TABLE device_groups (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT '',
+  membership TEXT NOT NULL CHECK (membership IN ('STATIC', 'DYNAMIC')),
+  selector JSONB,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (organization_id, name),
+  CHECK ((membership = 'DYNAMIC') = (selector IS NOT NULL))
+);
+
+-- Members of STATIC device groups
+CREATE TABLE device_group_members (
+  group_id UUID NOT NULL REFERENCES device_groups(id) ON DELETE CASCADE,
+  device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (group_id, device_id)
+);
 
--- Remote access sessions
+CREATE INDEX idx_device_group_members_device ON device_group_members(device_id);
+
+-- Reports whether a device (with its effective labels) belongs to a group
+CREATE OR REPLACE FUNCTION in_device_group(group_id UUID, device_id UUID, device_labels JSONB)
+RETURNS BOOLEAN AS $$
+  SELECT EXISTS (
+    SELECT 1 FROM device_groups g
+    WHERE g.id = $1
+      AND CASE g.membership
+        WHEN 'DYNAMIC' THEN labels_match($3, g.selector)
+        ELSE EXISTS (SELECT 1 FROM device_group_members m WHERE m.group_id = g.id AND m.device_id = $2)
+      END
+  );
+$$ LANGUAGE sql STABLE;
+
+-- Remote access sessions. A session opened with a client WireGuard key
+-- leases an overlay address and is a hub peer until it is terminated. The
+-- device's agent forwards the client's connections to allowed_destinations.
 CREATE TABLE access_sessions (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
@@ -54,18 +173,39 @@ CREATE TABLE access_sessions (
   wireguard_peer_config TEXT NOT NULL,
   expires_at TIMESTAMPTZ NOT NULL,
   terminated_at TIMESTAMPTZ,
-  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  client_wireguard_public_key TEXT,
+  client_wireguard_ip INET,
+  allowed_destinations TEXT[] NOT NULL DEFAULT '{}'
 );
 
 CREATE INDEX idx_access_sessions_device ON access_sessions(device_id);
 CREATE INDEX idx_access_sessions_expires ON access_sessions(expires_at) WHERE terminated_at IS NULL;
+CREATE UNIQUE INDEX idx_access_sessions_client_ip_lease ON access_sessions(client_wireguard_ip) WHERE terminated_at IS NULL;
+
+-- Access policies grant users remote access to devices matching a label
+-- selector, optionally scoped to a device group
+CREATE TABLE access_policies (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  device_selector JSONB NOT NULL,
+  device_group_id UUID REFERENCES device_groups(id) ON DELETE CASCADE,
+  user_emails TEXT[] NOT NULL,
+  max_duration_seconds INTEGER NOT NULL DEFAULT 3600 CHECK (max_duration_seconds > 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (organization_id, name)
+);
 
--- Artifacts (software updates, container images, binaries)
+-- Artifacts (software updates, container images, binaries, and AGENT
+-- binaries the agent replaces itself with). Types beyond the built-in AGENT,
+-- BINARY, CONTAINER and DEB are installed by agent installer plugins, such
+-- as FIRMWARE or CONFIG_BUNDLE.
 CREATE TABLE artifacts (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
   name TEXT NOT NULL,
-  type TEXT NOT NULL CHECK (type IN ('CONTAINER', 'BINARY')),
+  type TEXT NOT NULL CHECK (type ~ '^[A-Z][A-Z0-9_]{0,31}$'),
   blake3_hash TEXT NOT NULL UNIQUE,
   signature BYTEA NOT NULL,
   signing_key_id TEXT NOT NULL,
@@ -82,7 +222,8 @@ CREATE TABLE rollouts (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
   artifact_id UUID NOT NULL REFERENCES artifacts(id) ON DELETE RESTRICT,
-  target_selector JSONB NOT NULL,
+  target_selector JSONB NOT NULL, -- label selector, see labels_match
+  target_group_id UUID REFERENCES device_groups(id) ON DELETE RESTRICT,
   canary_percent INTEGER NOT NULL DEFAULT 10 CHECK (canary_percent >= 0 AND canary_percent <= 100),
   soak_time_seconds INTEGER NOT NULL DEFAULT 300 CHECK (soak_time_seconds >= 0),
   health_check_url TEXT NOT NULL,
@@ -95,13 +236,15 @@ CREATE TABLE rollouts (
 CREATE INDEX idx_rollouts_org ON rollouts(organization_id);
 CREATE INDEX idx_rollouts_state ON rollouts(state);
 CREATE INDEX idx_rollouts_artifact ON rollouts(artifact_id);
+CREATE INDEX idx_rollouts_target_group ON rollouts(target_group_id) WHERE target_group_id IS NOT NULL;
 
 -- Rollout device status (tracking rollout progress per device)
 CREATE TABLE rollout_device_status (
   rollout_id UUID NOT NULL REFERENCES rollouts(id) ON DELETE CASCADE,
   device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
   is_canary BOOLEAN NOT NULL,
-  status TEXT NOT NULL CHECK (status IN ('PENDING', 'IN_PROGRESS', 'HEALTHY', 'UNHEALTHY', 'ROLLED_BACK')),
+  -- SKIPPED devices were suspended or decommissioned while the rollout ran
+  status TEXT NOT NULL CHECK (status IN ('PENDING', 'IN_PROGRESS', 'HEALTHY', 'UNHEALTHY', 'ROLLED_BACK', 'SKIPPED')),
   health_check_result JSONB,
   updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   PRIMARY KEY (rollout_id, device_id)
@@ -110,22 +253,287 @@ CREATE TABLE rollout_device_status (
 CREATE INDEX idx_rollout_device_status_rollout ON rollout_device_status(rollout_id);
 CREATE INDEX idx_rollout_device_status_device ON rollout_device_status(device_id);
 
+-- Commands run on many devices at once. The batch's commands are dispatched
+-- to its targets at most max_concurrency at a time.
+CREATE TABLE command_batches (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  command TEXT NOT NULL,
+  args TEXT[] NOT NULL DEFAULT '{}',
+  target_selector JSONB NOT NULL, -- label selector, see labels_match
+  target_group_id UUID REFERENCES device_groups(id) ON DELETE SET NULL,
+  timeout_seconds INTEGER NOT NULL CHECK (timeout_seconds > 0),
+  max_concurrency INTEGER NOT NULL CHECK (max_concurrency > 0),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_command_batches_open ON command_batches(created_at) WHERE completed_at IS NULL;
+
+-- Commands run on a device by its agent, with their collected output.
+-- PENDING commands belong to a batch and wait for a free slot; RUNNING
+-- commands have been sent to the agent.
+CREATE TABLE device_commands (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  batch_id UUID REFERENCES command_batches(id) ON DELETE CASCADE,
+  command TEXT NOT NULL,
+  args TEXT[] NOT NULL DEFAULT '{}',
+  timeout_seconds INTEGER NOT NULL CHECK (timeout_seconds > 0),
+  state TEXT NOT NULL CHECK (state IN ('PENDING', 'RUNNING', 'SUCCEEDED', 'FAILED', 'TIMED_OUT')),
+  exit_code INTEGER,
+  error TEXT,
+  stdout TEXT NOT NULL DEFAULT '',
+  stderr TEXT NOT NULL DEFAULT '',
+  output_truncated BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  started_at TIMESTAMPTZ,
+  completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_device_commands_device ON device_commands(device_id, created_at DESC);
+CREATE INDEX idx_device_commands_batch ON device_commands(batch_id, state) WHERE batch_id IS NOT NULL;
+CREATE INDEX idx_device_commands_running ON device_commands(started_at) WHERE state = 'RUNNING';
+
+-- Files copied between operators and devices through the control plane, in
+-- chunks relayed over the agent's stream
+CREATE TABLE file_transfers (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  direction TEXT NOT NULL CHECK (direction IN ('UPLOAD', 'DOWNLOAD')),
+  path TEXT NOT NULL,
+  size BIGINT NOT NULL CHECK (size >= 0),
+  blake3_hash TEXT NOT NULL,
+  mode INTEGER NOT NULL,
+  -- Bytes confirmed so far: written on the device for uploads, sent to the
+  -- operator for downloads
+  transferred BIGINT NOT NULL DEFAULT 0,
+  state TEXT NOT NULL CHECK (state IN ('IN_PROGRESS', 'COMPLETED', 'FAILED', 'ABORTED')),
+  error TEXT,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_file_transfers_device ON file_transfers(device_id, created_at DESC);
+CREATE INDEX idx_file_transfers_in_progress ON file_transfers(updated_at) WHERE state = 'IN_PROGRESS';
+
+-- Desired configuration documents: a group's apply to its members, merged
+-- in group name order, and a device's own is merged over them
+CREATE TABLE device_group_configs (
+  group_id UUID PRIMARY KEY REFERENCES device_groups(id) ON DELETE CASCADE,
+  document JSONB NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE device_configs (
+  device_id UUID PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+  document JSONB NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The effective configuration each device last reported
+CREATE TABLE device_config_reports (
+  device_id UUID PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+  -- Hash of the desired configuration the device last received
+  desired_hash TEXT NOT NULL,
+  reported JSONB NOT NULL,
+  -- Section name to why it could not be applied or observed
+  errors JSONB NOT NULL DEFAULT '{}',
+  drifted BOOLEAN NOT NULL DEFAULT FALSE,
+  reported_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
 -- Audit logs for compliance and debugging
 CREATE TABLE audit_logs (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(),
   organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
-  user_email TEXT,
+  -- Who acted: an operator's email, a device ID or a control plane component
+  actor_type TEXT NOT NULL CHECK (actor_type IN ('USER', 'DEVICE', 'SYSTEM')),
+  actor TEXT,
   event_type TEXT NOT NULL,
   resource_type TEXT NOT NULL,
   resource_id TEXT NOT NULL,
   action TEXT NOT NULL,
   result TEXT NOT NULL CHECK (result IN ('success', 'failure')),
   metadata JSONB,
-  ip_address INET
+  ip_address INET,
+  request_id TEXT,
+  -- Per-organization hash chain: hash is BLAKE3 over the entry and prev_hash
+  sequence BIGINT NOT NULL,
+  prev_hash TEXT NOT NULL,
+  hash TEXT NOT NULL,
+  UNIQUE (organization_id, sequence)
 );
 
-CREATE INDEX idx_audit_logs_org ON audit_logs(organization_id);
+CREATE INDEX idx_audit_logs_org_timestamp ON audit_logs(organization_id, timestamp DESC, id DESC);
 CREATE INDEX idx_audit_logs_timestamp ON audit_logs(timestamp);
+CREATE INDEX idx_audit_logs_actor ON audit_logs(actor);
 CREATE INDEX idx_audit_logs_event_type ON audit_logs(event_type);
 CREATE INDEX idx_audit_logs_resource ON audit_logs(resource_type, resource_id);
+
+-- Signed audit chain heads, made periodically by the control plane
+CREATE TABLE audit_checkpoints (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  sequence BIGINT NOT NULL,
+  hash TEXT NOT NULL,
+  public_key TEXT NOT NULL,
+  signature BYTEA NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (organization_id, sequence)
+);
+
+-- Destinations audit entries are forwarded to as they are written. Each sink
+-- delivers entries in chain order and only advances last_sequence once the
+-- destination has accepted them.
+CREATE TABLE audit_sinks (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  type TEXT NOT NULL CHECK (type IN ('SYSLOG', 'WEBHOOK')),
+  config JSONB NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  last_sequence BIGINT NOT NULL DEFAULT 0,
+  last_delivered_at TIMESTAMPTZ,
+  consecutive_failures INTEGER NOT NULL DEFAULT 0,
+  last_error TEXT,
+  next_attempt_at TIMESTAMPTZ,
+  leased_until TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (organization_id, name)
+);
+
+-- Organization webhooks receiving fleet events
+CREATE TABLE webhooks (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  url TEXT NOT NULL,
+  -- HMAC-SHA256 key for the X-SafeEdge-Signature header
+  secret TEXT NOT NULL,
+  event_types TEXT[] NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  UNIQUE (organization_id, name)
+);
+
+CREATE TABLE webhook_deliveries (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  event_id UUID NOT NULL,
+  event_type TEXT NOT NULL,
+  payload JSONB NOT NULL,
+  status TEXT NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'SUCCEEDED', 'FAILED')),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  leased_until TIMESTAMPTZ,
+  response_status INTEGER,
+  last_error TEXT,
+  redelivery_of UUID REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+  delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at DESC, id DESC);
+CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'PENDING';
+-- Lets queueing an event be retried without sending it twice
+CREATE UNIQUE INDEX idx_webhook_deliveries_event ON webhook_deliveries(webhook_id, event_id) WHERE redelivery_of IS NULL;
+
+-- Device metrics time series reported in heartbeats, partitioned by day (UTC)
+CREATE TABLE device_metrics (
+  device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  recorded_at TIMESTAMPTZ NOT NULL,
+  cpu_percent DOUBLE PRECISION NOT NULL,
+  memory_percent DOUBLE PRECISION NOT NULL,
+  memory_total_bytes BIGINT NOT NULL,
+  disk_used_bytes BIGINT NOT NULL,
+  disk_total_bytes BIGINT NOT NULL,
+  uptime_seconds DOUBLE PRECISION NOT NULL,
+  load1 DOUBLE PRECISION NOT NULL,
+  load5 DOUBLE PRECISION NOT NULL,
+  load15 DOUBLE PRECISION NOT NULL,
+  network_rx_bytes BIGINT NOT NULL,
+  network_tx_bytes BIGINT NOT NULL,
+  max_temperature_celsius DOUBLE PRECISION,
+  PRIMARY KEY (device_id, recorded_at)
+) PARTITION BY RANGE (recorded_at);
+
+-- Hourly downsampled device metrics, kept longer than the raw series
+CREATE TABLE device_metrics_hourly (
+  device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  bucket TIMESTAMPTZ NOT NULL,
+  samples INTEGER NOT NULL,
+  cpu_percent_avg DOUBLE PRECISION NOT NULL,
+  cpu_percent_max DOUBLE PRECISION NOT NULL,
+  memory_percent_avg DOUBLE PRECISION NOT NULL,
+  memory_percent_max DOUBLE PRECISION NOT NULL,
+  disk_used_bytes_max BIGINT NOT NULL,
+  disk_total_bytes BIGINT NOT NULL,
+  load1_avg DOUBLE PRECISION NOT NULL,
+  network_rx_bytes_max BIGINT NOT NULL,
+  network_tx_bytes_max BIGINT NOT NULL,
+  temperature_samples INTEGER NOT NULL,
+  temperature_max_celsius DOUBLE PRECISION NOT NULL,
+  PRIMARY KEY (device_id, bucket)
+);
+
+CREATE INDEX idx_device_metrics_hourly_bucket ON device_metrics_hourly(bucket);
+
+-- Creates daily device_metrics partitions covering [start_at, start_at + days), in UTC
+CREATE OR REPLACE FUNCTION create_device_metrics_partitions(start_at TIMESTAMPTZ, days INTEGER)
+RETURNS INTEGER AS $$
+DECLARE
+  day DATE;
+BEGIN
+  FOR i IN 0..days - 1 LOOP
+    day := (start_at AT TIME ZONE 'UTC')::date + i;
+    EXECUTE format(
+      'CREATE TABLE IF NOT EXISTS %I PARTITION OF device_metrics FOR VALUES FROM (%L) TO (%L)',
+      'device_metrics_p' || to_char(day, 'YYYYMMDD'),
+      day::timestamp AT TIME ZONE 'UTC',
+      (day + 1)::timestamp AT TIME ZONE 'UTC'
+    );
+  END LOOP;
+  RETURN days;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Drops device_metrics partitions whose whole range is before older_than
+CREATE OR REPLACE FUNCTION drop_device_metrics_partitions(older_than TIMESTAMPTZ)
+RETURNS INTEGER AS $$
+DECLARE
+  part RECORD;
+  dropped INTEGER := 0;
+BEGIN
+  FOR part IN
+    SELECT c.relname
+    FROM pg_inherits i
+    JOIN pg_class c ON c.oid = i.inhrelid
+    JOIN pg_class p ON p.oid = i.inhparent
+    WHERE p.relname = 'device_metrics'
+      AND c.relname ~ '^device_metrics_p[0-9]{8}$'
+      AND to_date(substring(c.relname FROM 17), 'YYYYMMDD') + 1 <= (older_than AT TIME ZONE 'UTC')::date
+  LOOP
+    EXECUTE format('DROP TABLE IF EXISTS %I', part.relname);
+    dropped := dropped + 1;
+  END LOOP;
+  RETURN dropped;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Log entries devices ship continuously, kept for the log retention period
+CREATE TABLE device_logs (
+  id BIGSERIAL PRIMARY KEY,
+  device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+  source TEXT NOT NULL,
+  logged_at TIMESTAMPTZ NOT NULL,
+  message TEXT NOT NULL,
+  received_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_device_logs_device ON device_logs(device_id, logged_at, id);
+CREATE INDEX idx_device_logs_logged_at ON device_logs(logged_at);
@@ -0,0 +1,136 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+	"github.com/netf/safeedge/pkg/command"
+)
+
+// SendCommand sends a command to a device's agent if it is connected to
+// this instance
+func (s *DeviceService) SendCommand(deviceID uuid.UUID, req *pb.CommandRequest) error {
+	s.mu.RLock()
+	ds, ok := s.streams[deviceID.String()]
+	s.mu.RUnlock()
+
+	if !ok {
+		return service.ErrDeviceNotConnected
+	}
+
+	if err := ds.Send(&pb.ControlMessage{
+		Payload: &pb.ControlMessage_Command{Command: req},
+	}); err != nil {
+		return fmt.Errorf("failed to send command: %w", err)
+	}
+	return nil
+}
+
+// handleCommandOutput stores a chunk of a running command's output and
+// publishes it to live subscribers
+func (s *DeviceService) handleCommandOutput(ctx context.Context, device generated.Device, output *pb.CommandOutput) error {
+	commandID, err := uuid.Parse(output.CommandId)
+	if err != nil {
+		return fmt.Errorf("invalid command ID: %w", err)
+	}
+
+	text := service.CommandOutputText(output.Data)
+	params := generated.AppendDeviceCommandOutputParams{
+		MaxOutput: command.MaxOutput,
+		ID:        commandID,
+		DeviceID:  device.ID,
+	}
+	stream := "stdout"
+	if output.Stream == pb.CommandStream_COMMAND_STREAM_STDERR {
+		stream = "stderr"
+		params.Stderr = text
+	} else {
+		params.Stdout = text
+	}
+
+	batchID, err := s.queries.AppendDeviceCommandOutput(ctx, params)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Not one of the device's running commands; it may have been failed
+		// for taking too long
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store command output: %w", err)
+	}
+
+	data := map[string]any{
+		"command_id": output.CommandId,
+		"device_id":  device.ID.String(),
+		"stream":     stream,
+		"data":       text,
+	}
+	if batchID.Valid {
+		data["batch_id"] = uuid.UUID(batchID.Bytes).String()
+	}
+	s.events.Publish(service.Event{
+		Type:           service.EventCommandOutput,
+		OrganizationID: device.OrganizationID,
+		ResourceType:   "command",
+		ResourceID:     output.CommandId,
+		Data:           data,
+	})
+
+	return nil
+}
+
+// handleCommandResult completes one of the device's running commands and
+// audits it with all of its output
+func (s *DeviceService) handleCommandResult(ctx context.Context, device generated.Device, result *pb.CommandResult) error {
+	commandID, err := uuid.Parse(result.CommandId)
+	if err != nil {
+		return fmt.Errorf("invalid command ID: %w", err)
+	}
+
+	state := service.CommandSucceeded
+	switch {
+	case result.TimedOut:
+		state = service.CommandTimedOut
+	case result.Error != "" || result.ExitCode != 0:
+		state = service.CommandFailed
+	}
+
+	completed, err := s.queries.CompleteDeviceCommand(ctx, generated.CompleteDeviceCommandParams{
+		State:           state,
+		ExitCode:        pgtype.Int4{Int32: result.ExitCode, Valid: result.ExitCode >= 0},
+		Error:           pgtype.Text{String: result.Error, Valid: result.Error != ""},
+		OutputTruncated: result.OutputTruncated,
+		ID:              commandID,
+		DeviceID:        device.ID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to complete command: %w", err)
+	}
+
+	s.logger.Info("command completed",
+		zap.String("device_id", device.ID.String()),
+		zap.String("command_id", result.CommandId),
+		zap.String("state", state),
+	)
+
+	entry := s.auditEntry(ctx, device, service.AuditCommandCompleted, "run_command")
+	entry.Metadata = service.CommandAuditMetadata(completed)
+	if state != service.CommandSucceeded {
+		entry.Result = service.AuditFailure
+	}
+	s.audit.Record(ctx, entry)
+
+	s.events.Publish(service.CommandCompletedEvent(completed))
+	return nil
+}
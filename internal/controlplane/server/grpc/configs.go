@@ -0,0 +1,80 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+)
+
+// sendConfig sends a device its desired configuration
+func (s *DeviceService) sendConfig(ctx context.Context, ds *deviceStream, deviceID uuid.UUID) {
+	update, err := s.configs.Update(ctx, deviceID)
+	if err != nil {
+		s.logger.Error("failed to get desired config",
+			zap.String("device_id", deviceID.String()),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if err := ds.Send(&pb.ControlMessage{
+		Payload: &pb.ControlMessage_ConfigUpdate{ConfigUpdate: update},
+	}); err != nil {
+		s.logger.Error("failed to send config update",
+			zap.String("device_id", deviceID.String()),
+			zap.Error(err),
+		)
+	}
+}
+
+// pushConfig sends a device its desired configuration, if it is connected
+// to this instance
+func (s *DeviceService) pushConfig(ctx context.Context, deviceID string) {
+	id, err := uuid.Parse(deviceID)
+	if err != nil {
+		return
+	}
+
+	s.mu.RLock()
+	ds, ok := s.streams[deviceID]
+	s.mu.RUnlock()
+
+	if ok {
+		s.sendConfig(ctx, ds, id)
+	}
+}
+
+// pushOrganizationConfigs sends each of an organization's devices connected
+// to this instance its desired configuration, after a change to a group's.
+// Agents ignore a configuration they already have.
+func (s *DeviceService) pushOrganizationConfigs(ctx context.Context, orgID uuid.UUID) {
+	s.mu.RLock()
+	var deviceIDs []string
+	for deviceID, ds := range s.streams {
+		if ds.organizationID == orgID {
+			deviceIDs = append(deviceIDs, deviceID)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, deviceID := range deviceIDs {
+		s.pushConfig(ctx, deviceID)
+	}
+}
+
+// handleConfigReport records a device's effective configuration, sending
+// its desired configuration again if the device's is out of date
+func (s *DeviceService) handleConfigReport(ctx context.Context, ds *deviceStream, device generated.Device, report *pb.ConfigReport) error {
+	stale, err := s.configs.Report(ctx, device, report)
+	if err != nil {
+		return err
+	}
+	if stale {
+		s.sendConfig(ctx, ds, device.ID)
+	}
+	return nil
+}
@@ -2,34 +2,97 @@ package grpc
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	pb "github.com/netf/safeedge/api/proto/gen"
 	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+	"github.com/netf/safeedge/pkg/crypto"
+	"github.com/netf/safeedge/pkg/labels"
 )
 
 type DeviceService struct {
 	pb.UnimplementedDeviceServiceServer
-	queries *generated.Queries
-	logger  *zap.Logger
+	queries   *generated.Queries
+	metrics   *service.MetricsService
+	presence  *service.PresenceService
+	lifecycle *service.DeviceLifecycle
+	events    *service.EventBus
+	audit     *service.AuditRecorder
+	logs      *service.LogService
+	configs   *service.ConfigService
+	rollouts  *service.RolloutService
+	logger    *zap.Logger
 
 	// Active device streams
 	mu      sync.RWMutex
-	streams map[string]pb.DeviceService_DeviceStreamServer
+	streams map[string]*deviceStream
+
+	// Tunnels requested of agents, by stream ID
+	tunnelsMu sync.Mutex
+	tunnels   map[string]*pendingTunnel
+
+	// Log requests agents are answering, by request ID
+	logsMu      sync.Mutex
+	logRequests map[string]*pendingLogs
+
+	// File requests agents are answering, by request ID
+	filesMu      sync.Mutex
+	fileRequests map[string]*pendingFile
 }
 
-func NewDeviceService(queries *generated.Queries, logger *zap.Logger) *DeviceService {
+// deviceStream is a device's live stream
+type deviceStream struct {
+	pb.DeviceService_DeviceStreamServer
+	organizationID uuid.UUID
+	// disconnect receives the reason the control plane is closing the stream
+	disconnect chan string
+
+	// sendMu serializes sends from the stream's handler and from pushes
+	sendMu sync.Mutex
+}
+
+// Send sends a control message; it is safe to call from any goroutine
+func (ds *deviceStream) Send(msg *pb.ControlMessage) error {
+	ds.sendMu.Lock()
+	defer ds.sendMu.Unlock()
+	return ds.DeviceService_DeviceStreamServer.Send(msg)
+}
+
+func NewDeviceService(queries *generated.Queries, metrics *service.MetricsService, presence *service.PresenceService, lifecycle *service.DeviceLifecycle, events *service.EventBus, audit *service.AuditRecorder, logs *service.LogService, configs *service.ConfigService, rollouts *service.RolloutService, logger *zap.Logger) *DeviceService {
 	return &DeviceService{
-		queries: queries,
-		logger:  logger,
-		streams: make(map[string]pb.DeviceService_DeviceStreamServer),
+		queries:      queries,
+		metrics:      metrics,
+		presence:     presence,
+		lifecycle:    lifecycle,
+		events:       events,
+		audit:        audit,
+		logs:         logs,
+		configs:      configs,
+		rollouts:     rollouts,
+		logger:       logger,
+		streams:      make(map[string]*deviceStream),
+		tunnels:      make(map[string]*pendingTunnel),
+		logRequests:  make(map[string]*pendingLogs),
+		fileRequests: make(map[string]*pendingFile),
 	}
 }
 
@@ -37,49 +100,101 @@ func (s *DeviceService) Register(server *grpc.Server) {
 	pb.RegisterDeviceServiceServer(server, s)
 }
 
+// DeviceStream serves a device's stream. The stream is authenticated by the
+// device's signature in its metadata; see crypto.StreamAuthMessage. It is
+// closed by the control plane when the device is suspended or decommissioned.
 func (s *DeviceService) DeviceStream(stream pb.DeviceService_DeviceStreamServer) error {
-	var deviceID string
 	ctx := stream.Context()
 
+	device, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	streamDeviceID := device.ID.String()
+
+	ds := &deviceStream{
+		DeviceService_DeviceStreamServer: stream,
+		organizationID:                   device.OrganizationID,
+		disconnect:                       make(chan string, 1),
+	}
+
+	// Receive in the background so the stream can be closed between messages
+	msgs := make(chan *pb.DeviceMessage)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// deviceID is set once the stream is registered, on the first heartbeat
+	var deviceID string
+
 	for {
+		var msg *pb.DeviceMessage
 		select {
 		case <-ctx.Done():
 			s.logger.Info("device stream context done", zap.String("device_id", deviceID))
-			s.removeStream(deviceID)
+			s.removeStream(ctx, deviceID, ds, service.ReasonStreamClosed)
 			return ctx.Err()
-		default:
-		}
 
-		msg, err := stream.Recv()
-		if err == io.EOF {
-			s.logger.Info("device stream closed", zap.String("device_id", deviceID))
-			s.removeStream(deviceID)
-			return nil
-		}
-		if err != nil {
+		case reason := <-ds.disconnect:
+			s.logger.Info("closing device stream",
+				zap.String("device_id", deviceID),
+				zap.String("reason", reason),
+			)
+			s.removeStream(ctx, deviceID, ds, reason)
+			return status.Error(codes.PermissionDenied, reason)
+
+		case err := <-recvErr:
+			if err == io.EOF {
+				s.logger.Info("device stream closed", zap.String("device_id", deviceID))
+				s.removeStream(ctx, deviceID, ds, service.ReasonStreamClosed)
+				return nil
+			}
 			s.logger.Error("error receiving from device stream",
 				zap.String("device_id", deviceID),
 				zap.Error(err),
 			)
-			s.removeStream(deviceID)
+			s.removeStream(ctx, deviceID, ds, service.ReasonStreamError)
 			return status.Errorf(codes.Internal, "receive error: %v", err)
+
+		case msg = <-msgs:
 		}
 
 		// Handle different message types
 		switch payload := msg.Payload.(type) {
 		case *pb.DeviceMessage_Heartbeat:
-			if err := s.handleHeartbeat(ctx, stream, payload.Heartbeat); err != nil {
+			if payload.Heartbeat.DeviceId != streamDeviceID {
+				s.removeStream(ctx, deviceID, ds, service.ReasonStreamError)
+				return status.Error(codes.PermissionDenied, "heartbeat device ID does not match stream")
+			}
+			if err := s.handleHeartbeat(ctx, ds, payload.Heartbeat); err != nil {
 				s.logger.Error("heartbeat error",
 					zap.String("device_id", payload.Heartbeat.DeviceId),
 					zap.Error(err),
 				)
+				s.removeStream(ctx, deviceID, ds, service.ReasonStreamError)
 				return err
 			}
-			deviceID = payload.Heartbeat.DeviceId
-			s.addStream(deviceID, stream)
+			if deviceID == "" {
+				deviceID = payload.Heartbeat.DeviceId
+				s.addStream(deviceID, ds)
+				s.sendAccessGrants(ctx, ds, device.ID)
+				s.sendConfig(ctx, ds, device.ID)
+			}
 
 		case *pb.DeviceMessage_Health:
-			if err := s.handleHealthReport(ctx, payload.Health); err != nil {
+			if err := s.handleHealthReport(ctx, device, payload.Health); err != nil {
 				s.logger.Error("health report error",
 					zap.String("device_id", payload.Health.DeviceId),
 					zap.Error(err),
@@ -87,19 +202,108 @@ func (s *DeviceService) DeviceStream(stream pb.DeviceService_DeviceStreamServer)
 			}
 
 		case *pb.DeviceMessage_UpdateAck:
-			if err := s.handleUpdateAck(ctx, payload.UpdateAck); err != nil {
+			if err := s.handleUpdateAck(ctx, device, payload.UpdateAck); err != nil {
 				s.logger.Error("update ack error",
 					zap.String("device_id", payload.UpdateAck.DeviceId),
 					zap.Error(err),
 				)
 			}
 
+		case *pb.DeviceMessage_KeyRotation:
+			if err := s.handleKeyRotation(ctx, ds, device.ID, payload.KeyRotation); err != nil {
+				s.logger.Error("key rotation error",
+					zap.String("device_id", streamDeviceID),
+					zap.Error(err),
+				)
+			}
+
+		case *pb.DeviceMessage_CommandOutput:
+			if err := s.handleCommandOutput(ctx, device, payload.CommandOutput); err != nil {
+				s.logger.Error("command output error",
+					zap.String("device_id", streamDeviceID),
+					zap.Error(err),
+				)
+			}
+
+		case *pb.DeviceMessage_CommandResult:
+			if err := s.handleCommandResult(ctx, device, payload.CommandResult); err != nil {
+				s.logger.Error("command result error",
+					zap.String("device_id", streamDeviceID),
+					zap.Error(err),
+				)
+			}
+
+		case *pb.DeviceMessage_PolicyDenial:
+			s.handlePolicyDenial(ctx, device, payload.PolicyDenial)
+
+		case *pb.DeviceMessage_LogBatch:
+			if err := s.handleLogBatch(ctx, device, payload.LogBatch); err != nil {
+				s.logger.Error("log batch error",
+					zap.String("device_id", streamDeviceID),
+					zap.Error(err),
+				)
+			}
+
+		case *pb.DeviceMessage_FileResponse:
+			s.handleFileResponse(device, payload.FileResponse)
+
+		case *pb.DeviceMessage_ConfigReport:
+			if err := s.handleConfigReport(ctx, ds, device, payload.ConfigReport); err != nil {
+				s.logger.Error("config report error",
+					zap.String("device_id", streamDeviceID),
+					zap.Error(err),
+				)
+			}
+
 		default:
 			s.logger.Warn("unknown message type")
 		}
 	}
 }
 
+// Run tells agents about access sessions starting and ending and about
+// changes to their desired configuration, until ctx is cancelled. Streams
+// of suspended and decommissioned devices are closed by the lifecycle
+// through Disconnect.
+func (s *DeviceService) Run(ctx context.Context) {
+	events, unsubscribe := s.events.Subscribe(64)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			switch event.Type {
+			case service.EventAccessStarted:
+				s.pushAccessGrant(ctx, event)
+			case service.EventAccessEnded:
+				s.pushAccessRevoke(event)
+			case service.EventDeviceConfigChanged:
+				s.pushConfig(ctx, event.ResourceID)
+			case service.EventDeviceGroupConfigChanged:
+				s.pushOrganizationConfigs(ctx, event.OrganizationID)
+			}
+		}
+	}
+}
+
+// Disconnect closes a device's stream if it is connected to this instance
+func (s *DeviceService) Disconnect(deviceID, reason string) {
+	s.mu.RLock()
+	ds, ok := s.streams[deviceID]
+	s.mu.RUnlock()
+
+	if !ok {
+		return
+	}
+
+	select {
+	case ds.disconnect <- reason:
+	default:
+	}
+}
+
 func (s *DeviceService) handleHeartbeat(ctx context.Context, stream pb.DeviceService_DeviceStreamServer, hb *pb.HeartbeatRequest) error {
 	deviceUUID, err := uuid.Parse(hb.DeviceId)
 	if err != nil {
@@ -107,12 +311,29 @@ func (s *DeviceService) handleHeartbeat(ctx context.Context, stream pb.DeviceSer
 	}
 
 	// Update last_seen_at in database
-	_, err = s.queries.UpdateDeviceHeartbeat(ctx, deviceUUID)
+	device, err := s.queries.UpdateDeviceHeartbeat(ctx, deviceUUID)
 	if err != nil {
 		s.logger.Warn("failed to update device heartbeat",
 			zap.String("device_id", hb.DeviceId),
 			zap.Error(err),
 		)
+	} else if device.Status != service.DeviceStatusActive {
+		// Devices suspended or decommissioned while streaming elsewhere
+		return status.Errorf(codes.PermissionDenied, "device is %s", strings.ToLower(device.Status))
+	} else {
+		s.presence.Heartbeat(ctx, device.ID, device.OrganizationID)
+	}
+
+	s.recordReportedLabels(ctx, deviceUUID, hb.Labels)
+
+	// Store metrics with the server receive time; device clocks are not trusted
+	if hb.Metrics != nil {
+		if err := s.metrics.Record(ctx, deviceUUID, time.Now(), hb.Metrics); err != nil {
+			s.logger.Warn("failed to record device metrics",
+				zap.String("device_id", hb.DeviceId),
+				zap.Error(err),
+			)
+		}
 	}
 
 	s.logger.Debug("heartbeat received",
@@ -132,44 +353,245 @@ func (s *DeviceService) handleHeartbeat(ctx context.Context, stream pb.DeviceSer
 	return stream.Send(ack)
 }
 
-func (s *DeviceService) handleHealthReport(ctx context.Context, health *pb.HealthReport) error {
+// recordReportedLabels stores the labels an agent reports about itself.
+// Invalid label sets are logged and ignored.
+func (s *DeviceService) recordReportedLabels(ctx context.Context, deviceID uuid.UUID, reported map[string]string) {
+	set := labels.Set(reported)
+	if set == nil {
+		set = labels.Set{}
+	}
+
+	if err := set.Validate(); err != nil {
+		s.logger.Warn("ignoring invalid reported labels",
+			zap.String("device_id", deviceID.String()),
+			zap.Error(err),
+		)
+		return
+	}
+
+	data, err := json.Marshal(set)
+	if err != nil {
+		return
+	}
+
+	if err := s.queries.UpdateDeviceReportedLabels(ctx, generated.UpdateDeviceReportedLabelsParams{
+		ID:             deviceID,
+		ReportedLabels: data,
+	}); err != nil {
+		s.logger.Warn("failed to update reported labels",
+			zap.String("device_id", deviceID.String()),
+			zap.Error(err),
+		)
+	}
+}
+
+// handleKeyRotation replaces the device's keys with the ones in req and
+// reports the outcome to the device. The stream stays open; the device
+// authenticates later streams with its new key.
+func (s *DeviceService) handleKeyRotation(ctx context.Context, stream pb.DeviceService_DeviceStreamServer, deviceID uuid.UUID, req *pb.KeyRotationRequest) error {
+	result := &pb.KeyRotationResult{Accepted: true}
+
+	device, err := s.queries.GetDevice(ctx, deviceID)
+	if err == nil {
+		_, err = s.lifecycle.RotateKeys(ctx, device, req.PublicKey, req.WireguardPublicKey, req.Signature)
+	}
+
+	switch {
+	case errors.Is(err, service.ErrInvalidKeyRotation), errors.Is(err, service.ErrKeyRevoked), errors.Is(err, service.ErrDeviceDecommissioned):
+		result = &pb.KeyRotationResult{ErrorMessage: err.Error()}
+	case err != nil:
+		s.logger.Error("failed to rotate device keys",
+			zap.String("device_id", deviceID.String()),
+			zap.Error(err),
+		)
+		result = &pb.KeyRotationResult{ErrorMessage: "internal error"}
+	}
+
+	if device.ID != uuid.Nil {
+		entry := s.auditEntry(ctx, device, service.AuditDeviceKeysRotated, "rotate_keys")
+		entry.Metadata = map[string]any{
+			"public_key":           req.PublicKey,
+			"wireguard_public_key": req.WireguardPublicKey,
+		}
+		if !result.Accepted {
+			entry.Result = service.AuditFailure
+			entry.Metadata["error"] = result.ErrorMessage
+		}
+		s.audit.Record(ctx, entry)
+	}
+
+	return stream.Send(&pb.ControlMessage{
+		Payload: &pb.ControlMessage_KeyRotationResult{
+			KeyRotationResult: result,
+		},
+	})
+}
+
+func (s *DeviceService) handleHealthReport(ctx context.Context, device generated.Device, health *pb.HealthReport) error {
 	s.logger.Info("health report received",
 		zap.String("device_id", health.DeviceId),
 		zap.String("rollout_id", health.RolloutId),
 		zap.Bool("healthy", health.Healthy),
 	)
 
-	// TODO: Update rollout_device_status table
-	// This will be implemented when we add the rollout service
+	entry := s.auditEntry(ctx, device, service.AuditDeviceHealthReported, "report_health")
+	entry.Metadata = map[string]any{
+		"rollout_id":       health.RolloutId,
+		"healthy":          health.Healthy,
+		"http_status_code": health.HttpStatusCode,
+	}
+	if !health.Healthy {
+		entry.Result = service.AuditFailure
+		entry.Metadata["error"] = health.ErrorMessage
+	}
+	s.audit.Record(ctx, entry)
+
+	if health.RolloutId != "" {
+		s.rollouts.ReportHealth(ctx, device, health)
+	}
 
 	return nil
 }
 
-func (s *DeviceService) handleUpdateAck(ctx context.Context, ack *pb.UpdateAck) error {
+func (s *DeviceService) handleUpdateAck(ctx context.Context, device generated.Device, ack *pb.UpdateAck) error {
 	s.logger.Info("update ack received",
 		zap.String("device_id", ack.DeviceId),
 		zap.String("rollout_id", ack.RolloutId),
 		zap.String("status", ack.Status.String()),
 	)
 
-	// TODO: Update rollout_device_status table
-	// This will be implemented when we add the rollout service
+	// Progress acks are not audited, only the outcome
+	if ack.Status == pb.UpdateStatus_UPDATE_STATUS_SUCCESS || ack.Status == pb.UpdateStatus_UPDATE_STATUS_FAILED {
+		entry := s.auditEntry(ctx, device, service.AuditDeviceUpdateReported, "update")
+		entry.Metadata = map[string]any{
+			"rollout_id": ack.RolloutId,
+			"status":     ack.Status.String(),
+		}
+		if ack.Status == pb.UpdateStatus_UPDATE_STATUS_FAILED {
+			entry.Result = service.AuditFailure
+			entry.Metadata["error"] = ack.ErrorMessage
+		}
+		s.audit.Record(ctx, entry)
+	}
+
+	if ack.RolloutId != "" {
+		data := map[string]any{
+			"device_id": device.ID.String(),
+			"status":    strings.TrimPrefix(ack.Status.String(), "UPDATE_STATUS_"),
+		}
+		if ack.ErrorMessage != "" {
+			data["error"] = ack.ErrorMessage
+		}
+		s.events.Publish(service.Event{
+			Type:           service.EventRolloutDeviceUpdated,
+			OrganizationID: device.OrganizationID,
+			ResourceType:   "rollout",
+			ResourceID:     ack.RolloutId,
+			Data:           data,
+		})
+	}
+
+	if ack.RolloutId != "" {
+		s.rollouts.ReportUpdate(ctx, device, ack)
+	}
 
 	return nil
 }
 
-func (s *DeviceService) addStream(deviceID string, stream pb.DeviceService_DeviceStreamServer) {
+// authenticate identifies the device opening a stream from its signed
+// metadata. Devices that are decommissioned or present a revoked key are
+// refused.
+func (s *DeviceService) authenticate(ctx context.Context) (generated.Device, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	deviceID, err := uuid.Parse(get(crypto.MetadataDeviceID))
+	if err != nil {
+		return generated.Device{}, status.Error(codes.Unauthenticated, "missing or invalid device ID")
+	}
+
+	timestamp, err := strconv.ParseInt(get(crypto.MetadataTimestamp), 10, 64)
+	if err != nil {
+		return generated.Device{}, status.Error(codes.Unauthenticated, "missing or invalid timestamp")
+	}
+	if skew := time.Since(time.Unix(timestamp, 0)); skew > crypto.MaxStreamAuthSkew || skew < -crypto.MaxStreamAuthSkew {
+		return generated.Device{}, status.Error(codes.Unauthenticated, "timestamp outside allowed skew")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(get(crypto.MetadataSignature))
+	if err != nil {
+		return generated.Device{}, status.Error(codes.Unauthenticated, "invalid signature encoding")
+	}
+
+	device, err := s.queries.GetDevice(ctx, deviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return generated.Device{}, status.Error(codes.Unauthenticated, "unknown device")
+	}
+	if err != nil {
+		s.logger.Error("failed to get device", zap.Error(err))
+		return generated.Device{}, status.Error(codes.Internal, "internal error")
+	}
+
+	if !crypto.VerifyEd25519(device.PublicKey, crypto.StreamAuthMessage(deviceID.String(), timestamp), signature) {
+		return generated.Device{}, status.Error(codes.Unauthenticated, "invalid signature")
+	}
+
+	if device.Status != service.DeviceStatusActive {
+		return generated.Device{}, status.Errorf(codes.PermissionDenied, "device is %s", strings.ToLower(device.Status))
+	}
+
+	revoked, err := s.lifecycle.IsKeyRevoked(ctx, device.PublicKey)
+	if err != nil {
+		s.logger.Error("failed to check key revocation", zap.Error(err))
+		return generated.Device{}, status.Error(codes.Internal, "internal error")
+	}
+	if revoked {
+		return generated.Device{}, status.Error(codes.PermissionDenied, "key has been revoked")
+	}
+
+	return device, nil
+}
+
+func (s *DeviceService) addStream(deviceID string, stream *deviceStream) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.streams[deviceID] = stream
 	s.logger.Info("device stream registered", zap.String("device_id", deviceID))
 }
 
-func (s *DeviceService) removeStream(deviceID string) {
+// removeStream unregisters a device stream. A device that has already
+// reconnected on a newer stream is left untouched.
+func (s *DeviceService) removeStream(ctx context.Context, deviceID string, stream *deviceStream, reason string) {
+	if deviceID == "" {
+		return
+	}
+
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	current, ok := s.streams[deviceID]
+	if !ok || current != stream {
+		s.mu.Unlock()
+		return
+	}
 	delete(s.streams, deviceID)
-	s.logger.Info("device stream removed", zap.String("device_id", deviceID))
+	s.mu.Unlock()
+
+	// Requests of the device can no longer be answered
+	s.finishDeviceLogs(deviceID)
+	s.finishDeviceFiles(deviceID)
+
+	s.logger.Info("device stream removed",
+		zap.String("device_id", deviceID),
+		zap.String("reason", reason),
+	)
+
+	if deviceUUID, err := uuid.Parse(deviceID); err == nil {
+		s.presence.Disconnected(ctx, deviceUUID, reason)
+	}
 }
 
 // SendUpdateNotification sends an update notification to a specific device
@@ -179,7 +601,7 @@ func (s *DeviceService) SendUpdateNotification(deviceID string, update *pb.Updat
 	s.mu.RUnlock()
 
 	if !ok {
-		return status.Errorf(codes.NotFound, "device %s not connected", deviceID)
+		return service.ErrDeviceNotConnected
 	}
 
 	msg := &pb.ControlMessage{
@@ -188,7 +610,10 @@ func (s *DeviceService) SendUpdateNotification(deviceID string, update *pb.Updat
 		},
 	}
 
-	return stream.Send(msg)
+	if err := stream.Send(msg); err != nil {
+		return fmt.Errorf("failed to send update notification: %w", err)
+	}
+	return nil
 }
 
 // SendRollbackRequest sends a rollback request to a specific device
@@ -198,7 +623,7 @@ func (s *DeviceService) SendRollbackRequest(deviceID string, rollback *pb.Rollba
 	s.mu.RUnlock()
 
 	if !ok {
-		return status.Errorf(codes.NotFound, "device %s not connected", deviceID)
+		return service.ErrDeviceNotConnected
 	}
 
 	msg := &pb.ControlMessage{
@@ -207,5 +632,132 @@ func (s *DeviceService) SendRollbackRequest(deviceID string, rollback *pb.Rollba
 		},
 	}
 
-	return stream.Send(msg)
+	if err := stream.Send(msg); err != nil {
+		return fmt.Errorf("failed to send rollback request: %w", err)
+	}
+
+	ctx := stream.Context()
+	if id, err := uuid.Parse(deviceID); err == nil {
+		if device, err := s.queries.GetDevice(ctx, id); err == nil {
+			s.audit.Record(ctx, service.AuditEntry{
+				OrganizationID: device.OrganizationID,
+				ActorType:      service.ActorSystem,
+				EventType:      service.AuditDeviceRollbackRequested,
+				ResourceType:   "device",
+				ResourceID:     deviceID,
+				Action:         "rollback",
+				Metadata: map[string]any{
+					"rollout_id": rollback.RolloutId,
+					"reason":     rollback.Reason,
+				},
+			})
+		}
+	}
+
+	return nil
+}
+
+// sendAccessGrants sends a newly connected device the grants of its active
+// access sessions
+func (s *DeviceService) sendAccessGrants(ctx context.Context, ds *deviceStream, deviceID uuid.UUID) {
+	sessions, err := s.queries.ListActiveAccessSessions(ctx, deviceID)
+	if err != nil {
+		s.logger.Error("failed to list active access sessions", zap.Error(err))
+		return
+	}
+
+	for _, session := range sessions {
+		grant := accessGrant(session)
+		if grant == nil {
+			continue
+		}
+		if err := ds.Send(&pb.ControlMessage{
+			Payload: &pb.ControlMessage_AccessGrant{AccessGrant: grant},
+		}); err != nil {
+			s.logger.Error("failed to send access grant", zap.Error(err))
+			return
+		}
+	}
+}
+
+// pushAccessGrant sends the grant of a session that just started to its
+// device, if the device is connected to this instance
+func (s *DeviceService) pushAccessGrant(ctx context.Context, event service.Event) {
+	sessionID, _ := event.Data["session_id"].(string)
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return
+	}
+
+	session, err := s.queries.GetAccessSession(ctx, id)
+	if err != nil {
+		s.logger.Error("failed to get access session", zap.String("session_id", sessionID), zap.Error(err))
+		return
+	}
+
+	grant := accessGrant(session)
+	if grant == nil {
+		return
+	}
+	s.push(event.ResourceID, &pb.ControlMessage{
+		Payload: &pb.ControlMessage_AccessGrant{AccessGrant: grant},
+	})
+}
+
+// pushAccessRevoke tells a device to stop forwarding for a session that ended
+func (s *DeviceService) pushAccessRevoke(event service.Event) {
+	sessionID, _ := event.Data["session_id"].(string)
+	s.push(event.ResourceID, &pb.ControlMessage{
+		Payload: &pb.ControlMessage_AccessRevoke{
+			AccessRevoke: &pb.AccessRevoke{SessionId: sessionID},
+		},
+	})
+}
+
+// push sends a message to a device if it is connected to this instance
+func (s *DeviceService) push(deviceID string, msg *pb.ControlMessage) {
+	s.mu.RLock()
+	ds, ok := s.streams[deviceID]
+	s.mu.RUnlock()
+
+	if !ok {
+		return
+	}
+	if err := ds.Send(msg); err != nil {
+		s.logger.Error("failed to send control message",
+			zap.String("device_id", deviceID),
+			zap.Error(err),
+		)
+	}
+}
+
+// accessGrant is the grant for a session's client tunnel, or nil if the
+// session has no client address to forward for
+func accessGrant(session generated.AccessSession) *pb.AccessGrant {
+	if session.ClientWireguardIp == nil {
+		return nil
+	}
+	return &pb.AccessGrant{
+		SessionId:           session.ID.String(),
+		ClientIp:            session.ClientWireguardIp.String(),
+		AllowedDestinations: session.AllowedDestinations,
+		ExpiresAt:           timestamppb.New(session.ExpiresAt),
+	}
+}
+
+// auditEntry starts an audit entry for an event reported by a device on its stream
+func (s *DeviceService) auditEntry(ctx context.Context, device generated.Device, eventType, action string) service.AuditEntry {
+	entry := service.AuditEntry{
+		OrganizationID: device.OrganizationID,
+		ActorType:      service.ActorDevice,
+		Actor:          device.ID.String(),
+		EventType:      eventType,
+		ResourceType:   "device",
+		ResourceID:     device.ID.String(),
+		Action:         action,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		entry.IPAddress = p.Addr.String()
+	}
+	return entry
 }
@@ -0,0 +1,103 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+)
+
+// fileRequestTimeout bounds how long an agent may take to answer a file
+// request; hashing a large file for a download is the slowest
+const fileRequestTimeout = 45 * time.Second
+
+// pendingFile is a file request a device's agent is answering
+type pendingFile struct {
+	deviceID string
+	response chan *pb.FileResponse
+}
+
+// SendFileRequest sends a file request to a device's agent, if it is
+// connected to this instance, and waits for its response
+func (s *DeviceService) SendFileRequest(ctx context.Context, deviceID uuid.UUID, req *pb.FileRequest) (*pb.FileResponse, error) {
+	s.mu.RLock()
+	ds, ok := s.streams[deviceID.String()]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, service.ErrDeviceNotConnected
+	}
+
+	req.RequestId = uuid.NewString()
+	pending := &pendingFile{
+		deviceID: deviceID.String(),
+		response: make(chan *pb.FileResponse, 1),
+	}
+
+	s.filesMu.Lock()
+	s.fileRequests[req.RequestId] = pending
+	s.filesMu.Unlock()
+
+	defer func() {
+		s.filesMu.Lock()
+		delete(s.fileRequests, req.RequestId)
+		s.filesMu.Unlock()
+	}()
+
+	if err := ds.Send(&pb.ControlMessage{
+		Payload: &pb.ControlMessage_FileRequest{FileRequest: req},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to send file request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fileRequestTimeout)
+	defer cancel()
+
+	select {
+	case resp, ok := <-pending.response:
+		if !ok {
+			return nil, service.ErrDeviceNotConnected
+		}
+		return resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// finishDeviceFiles closes the file requests made of a device whose stream
+// has gone
+func (s *DeviceService) finishDeviceFiles(deviceID string) {
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+
+	for requestID, pending := range s.fileRequests {
+		if pending.deviceID == deviceID {
+			delete(s.fileRequests, requestID)
+			close(pending.response)
+		}
+	}
+}
+
+// handleFileResponse hands a response to the request it answers
+func (s *DeviceService) handleFileResponse(device generated.Device, resp *pb.FileResponse) {
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+
+	pending, ok := s.fileRequests[resp.RequestId]
+	if !ok || pending.deviceID != device.ID.String() {
+		s.logger.Debug("file response for unknown request",
+			zap.String("device_id", device.ID.String()),
+			zap.String("request_id", resp.RequestId),
+		)
+		return
+	}
+
+	delete(s.fileRequests, resp.RequestId)
+	pending.response <- resp
+}
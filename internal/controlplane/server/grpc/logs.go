@@ -0,0 +1,132 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+)
+
+// logBatchBuffer is how many batches of a log request are buffered for a
+// slow reader; more than a request that is not followed can produce
+const logBatchBuffer = 64
+
+// pendingLogs is a log request a device's agent is answering
+type pendingLogs struct {
+	deviceID string
+	batches  chan *pb.LogBatch
+}
+
+// CollectLogs sends a log request to a device's agent, if it is connected to
+// this instance, and returns the batches it answers with. A followed request
+// is cancelled on the agent once ctx is done.
+func (s *DeviceService) CollectLogs(ctx context.Context, deviceID uuid.UUID, req *pb.LogRequest) (<-chan *pb.LogBatch, error) {
+	s.mu.RLock()
+	ds, ok := s.streams[deviceID.String()]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, service.ErrDeviceNotConnected
+	}
+
+	req.RequestId = uuid.NewString()
+	pending := &pendingLogs{
+		deviceID: deviceID.String(),
+		batches:  make(chan *pb.LogBatch, logBatchBuffer),
+	}
+
+	s.logsMu.Lock()
+	s.logRequests[req.RequestId] = pending
+	s.logsMu.Unlock()
+
+	if err := ds.Send(&pb.ControlMessage{
+		Payload: &pb.ControlMessage_LogRequest{LogRequest: req},
+	}); err != nil {
+		s.finishLogs(req.RequestId)
+		return nil, fmt.Errorf("failed to send log request: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		if s.finishLogs(req.RequestId) && req.Follow {
+			if err := ds.Send(&pb.ControlMessage{
+				Payload: &pb.ControlMessage_LogCancel{LogCancel: &pb.LogCancel{RequestId: req.RequestId}},
+			}); err != nil {
+				s.logger.Debug("failed to cancel log request",
+					zap.String("device_id", pending.deviceID),
+					zap.Error(err),
+				)
+			}
+		}
+	}()
+
+	return pending.batches, nil
+}
+
+// finishLogs closes a log request's batches, reporting whether it was still
+// open
+func (s *DeviceService) finishLogs(requestID string) bool {
+	s.logsMu.Lock()
+	defer s.logsMu.Unlock()
+
+	pending, ok := s.logRequests[requestID]
+	if !ok {
+		return false
+	}
+	delete(s.logRequests, requestID)
+	close(pending.batches)
+	return true
+}
+
+// finishDeviceLogs closes the log requests made of a device whose stream has
+// gone
+func (s *DeviceService) finishDeviceLogs(deviceID string) {
+	s.logsMu.Lock()
+	defer s.logsMu.Unlock()
+
+	for requestID, pending := range s.logRequests {
+		if pending.deviceID == deviceID {
+			delete(s.logRequests, requestID)
+			close(pending.batches)
+		}
+	}
+}
+
+// handleLogBatch hands a batch to the request it answers, or stores it if
+// the agent is shipping its logs continuously
+func (s *DeviceService) handleLogBatch(ctx context.Context, device generated.Device, batch *pb.LogBatch) error {
+	if batch.RequestId == "" {
+		return s.logs.Store(ctx, device.ID, time.Now(), batch.Entries)
+	}
+
+	s.logsMu.Lock()
+	defer s.logsMu.Unlock()
+
+	pending, ok := s.logRequests[batch.RequestId]
+	if !ok || pending.deviceID != device.ID.String() {
+		// Answers a request whose reader has gone
+		return nil
+	}
+
+	select {
+	case pending.batches <- batch:
+	default:
+		s.logger.Warn("dropping log batch for slow reader",
+			zap.String("device_id", pending.deviceID),
+			zap.String("request_id", batch.RequestId),
+			zap.Int("entries", len(batch.Entries)),
+		)
+	}
+
+	if batch.Done {
+		delete(s.logRequests, batch.RequestId)
+		close(pending.batches)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package grpc
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+)
+
+// policyRules names the rules of a device policy in audit entries, with the
+// action each denial refused
+var policyRules = map[pb.PolicyRule]struct{ rule, action string }{
+	pb.PolicyRule_POLICY_RULE_COMMAND:             {"command", "run_command"},
+	pb.PolicyRule_POLICY_RULE_FILE_PATH:           {"file_path", "access_file"},
+	pb.PolicyRule_POLICY_RULE_FORWARD_DESTINATION: {"forward_destination", "forward"},
+}
+
+// handlePolicyDenial audits a request the device's local policy refused
+func (s *DeviceService) handlePolicyDenial(ctx context.Context, device generated.Device, denial *pb.PolicyDenial) {
+	names, ok := policyRules[denial.Rule]
+	if !ok {
+		names.rule, names.action = "unknown", "unknown"
+	}
+
+	s.logger.Warn("device policy denied a request",
+		zap.String("device_id", device.ID.String()),
+		zap.String("rule", names.rule),
+		zap.String("target", denial.Target),
+		zap.String("reference_id", denial.ReferenceId),
+	)
+
+	entry := s.auditEntry(ctx, device, service.AuditDevicePolicyDenied, names.action)
+	entry.Result = service.AuditFailure
+	entry.Metadata = map[string]any{
+		"rule":         names.rule,
+		"target":       denial.Target,
+		"reason":       denial.Reason,
+		"reference_id": denial.ReferenceId,
+		"policy_hash":  denial.PolicyHash,
+	}
+	s.audit.Record(ctx, entry)
+}
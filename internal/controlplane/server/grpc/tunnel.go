@@ -0,0 +1,192 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/service"
+)
+
+const (
+	// tunnelOpenTimeout bounds how long a client waits for an agent to
+	// connect a tunnel
+	tunnelOpenTimeout = 15 * time.Second
+	// tunnelFrameSize is the most data sent in one frame
+	tunnelFrameSize = 32 * 1024
+)
+
+// pendingTunnel is a tunnel a device's agent has been asked to open
+type pendingTunnel struct {
+	deviceID string
+	opened   chan openedTunnel
+}
+
+// openedTunnel is the stream an agent opened for a tunnel and its first
+// frame. The stream stays open until done is closed.
+type openedTunnel struct {
+	stream pb.DeviceService_TunnelServer
+	first  *pb.TunnelFrame
+	done   chan struct{}
+}
+
+// OpenTunnel asks a device's agent, if it is connected to this instance, to
+// connect to destination for an access session, and returns the connection
+// it relays over its Tunnel stream
+func (s *DeviceService) OpenTunnel(ctx context.Context, deviceID, sessionID uuid.UUID, destination string) (io.ReadWriteCloser, error) {
+	s.mu.RLock()
+	ds, ok := s.streams[deviceID.String()]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, service.ErrDeviceNotConnected
+	}
+
+	streamID := uuid.NewString()
+	pending := &pendingTunnel{
+		deviceID: deviceID.String(),
+		opened:   make(chan openedTunnel, 1),
+	}
+
+	s.tunnelsMu.Lock()
+	s.tunnels[streamID] = pending
+	s.tunnelsMu.Unlock()
+
+	err := ds.Send(&pb.ControlMessage{
+		Payload: &pb.ControlMessage_TunnelOpen{
+			TunnelOpen: &pb.TunnelOpen{
+				StreamId:    streamID,
+				SessionId:   sessionID.String(),
+				Destination: destination,
+			},
+		},
+	})
+	if err != nil {
+		s.cancelTunnel(streamID, pending)
+		return nil, fmt.Errorf("failed to send tunnel request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tunnelOpenTimeout)
+	defer cancel()
+
+	var opened openedTunnel
+	select {
+	case opened = <-pending.opened:
+	case <-ctx.Done():
+		s.cancelTunnel(streamID, pending)
+		return nil, ctx.Err()
+	}
+
+	if opened.first.Error != "" {
+		close(opened.done)
+		return nil, fmt.Errorf("%w: %s", service.ErrTunnelRefused, opened.first.Error)
+	}
+
+	return &tunnelConn{stream: opened.stream, done: opened.done}, nil
+}
+
+// cancelTunnel withdraws a tunnel request, ending the agent's stream if it
+// arrived in the meantime
+func (s *DeviceService) cancelTunnel(streamID string, pending *pendingTunnel) {
+	s.tunnelsMu.Lock()
+	_, waiting := s.tunnels[streamID]
+	delete(s.tunnels, streamID)
+	s.tunnelsMu.Unlock()
+
+	if !waiting {
+		opened := <-pending.opened
+		close(opened.done)
+	}
+}
+
+// Tunnel serves a stream an agent opens in answer to a TunnelOpen until the
+// relayed connection ends. The first frame names the request it answers,
+// which must have been made of the same device.
+func (s *DeviceService) Tunnel(stream pb.DeviceService_TunnelServer) error {
+	ctx := stream.Context()
+
+	device, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	s.tunnelsMu.Lock()
+	pending, ok := s.tunnels[first.StreamId]
+	if ok && pending.deviceID == device.ID.String() {
+		delete(s.tunnels, first.StreamId)
+	} else {
+		ok = false
+	}
+	s.tunnelsMu.Unlock()
+
+	if !ok {
+		return status.Error(codes.NotFound, "unknown tunnel stream")
+	}
+
+	done := make(chan struct{})
+	pending.opened <- openedTunnel{stream: stream, first: first, done: done}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tunnelConn is the control plane's end of a relayed connection. Reads
+// return io.EOF once the agent has sent everything; closing it ends the
+// agent's stream.
+type tunnelConn struct {
+	stream pb.DeviceService_TunnelServer
+	done   chan struct{}
+	buf    []byte
+
+	closeOnce sync.Once
+}
+
+func (c *tunnelConn) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		frame, err := c.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		c.buf = frame.Data
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *tunnelConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), tunnelFrameSize)]
+		if err := c.stream.Send(&pb.TunnelFrame{Data: chunk}); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+func (c *tunnelConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
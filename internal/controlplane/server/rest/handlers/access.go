@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+	"github.com/netf/safeedge/pkg/forward"
+	"github.com/netf/safeedge/pkg/labels"
+)
+
+// pgUniqueViolation is the PostgreSQL error code for unique constraint violations
+const pgUniqueViolation = "23505"
+
+type CreateAccessPolicyRequest struct {
+	Name               string   `json:"name"`
+	DeviceSelector     string   `json:"device_selector"`
+	DeviceGroupID      string   `json:"device_group_id,omitempty"`
+	UserEmails         []string `json:"user_emails"`
+	MaxDurationSeconds int32    `json:"max_duration_seconds,omitempty"`
+}
+
+// AccessPolicyResponse is an access policy with its device selector in text form
+type AccessPolicyResponse struct {
+	generated.AccessPolicy
+	DeviceSelector string `json:"device_selector"`
+}
+
+func newAccessPolicyResponse(policy generated.AccessPolicy) AccessPolicyResponse {
+	sel, _ := labels.SelectorFromJSON(policy.DeviceSelector)
+	return AccessPolicyResponse{
+		AccessPolicy:   policy,
+		DeviceSelector: sel.String(),
+	}
+}
+
+// CreateAccessPolicy grants user_emails ("*" for everyone) access to the
+// devices matching device_selector, and in device_group_id if given, for
+// sessions of up to max_duration_seconds
+func CreateAccessPolicy(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		var req CreateAccessPolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if req.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if len(req.UserEmails) == 0 {
+			http.Error(w, "user_emails is required", http.StatusBadRequest)
+			return
+		}
+		if req.MaxDurationSeconds == 0 {
+			req.MaxDurationSeconds = 3600
+		}
+		if req.MaxDurationSeconds < 0 {
+			http.Error(w, "max_duration_seconds must be positive", http.StatusBadRequest)
+			return
+		}
+
+		selector, sel, err := encodeSelector(req.DeviceSelector)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		groupID, err := resolveDeviceGroup(r.Context(), queries, orgID, req.DeviceGroupID)
+		if errors.Is(err, errInvalidDeviceGroup) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device group", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		policy, err := queries.CreateAccessPolicy(r.Context(), generated.CreateAccessPolicyParams{
+			OrganizationID:     orgID,
+			Name:               req.Name,
+			DeviceSelector:     selector,
+			DeviceGroupID:      groupID,
+			UserEmails:         req.UserEmails,
+			MaxDurationSeconds: req.MaxDurationSeconds,
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			http.Error(w, "access policy already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to create access policy", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("access policy created",
+			zap.String("policy_id", policy.ID.String()),
+			zap.String("device_selector", sel.String()),
+		)
+
+		entry := auditEntry(r, orgID, service.AuditAccessPolicyCreated, "access_policy", policy.ID.String(), "create")
+		entry.Metadata = map[string]any{
+			"name":                 policy.Name,
+			"device_selector":      sel.String(),
+			"user_emails":          policy.UserEmails,
+			"max_duration_seconds": policy.MaxDurationSeconds,
+		}
+		audit.Record(r.Context(), entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newAccessPolicyResponse(policy))
+	}
+}
+
+func ListAccessPolicies(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		policies, err := queries.ListAccessPolicies(r.Context(), orgID)
+		if err != nil {
+			logger.Error("failed to list access policies", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := make([]AccessPolicyResponse, len(policies))
+		for i, policy := range policies {
+			resp[i] = newAccessPolicyResponse(policy)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func DeleteAccessPolicy(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		policyID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid access policy ID", http.StatusBadRequest)
+			return
+		}
+
+		policy, err := queries.DeleteAccessPolicy(r.Context(), generated.DeleteAccessPolicyParams{
+			ID:             policyID,
+			OrganizationID: orgID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to delete access policy", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, orgID, service.AuditAccessPolicyDeleted, "access_policy", policy.ID.String(), "delete")
+		entry.Metadata = map[string]any{"name": policy.Name}
+		audit.Record(r.Context(), entry)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type CreateAccessSessionRequest struct {
+	DeviceID            string   `json:"device_id"`
+	UserEmail           string   `json:"user_email"`
+	DurationSeconds     int      `json:"duration_seconds,omitempty"`
+	WireguardPublicKey  string   `json:"wireguard_public_key,omitempty"`
+	AllowedDestinations []string `json:"allowed_destinations,omitempty"`
+}
+
+// CreateAccessSession opens a remote access session to a device if an access
+// policy allows it. The session lasts duration_seconds, defaulting to the
+// longest duration the matching policies allow. With wireguard_public_key the
+// caller's ephemeral interface joins the hub for the session and
+// wireguard_peer_config is its configuration, minus the private key. The
+// device's agent forwards the session's connections to allowed_destinations.
+func CreateAccessSession(queries *generated.Queries, policies *service.AccessPolicyService, sessions *service.AccessSessionService, events *service.EventBus, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateAccessSessionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		deviceID, err := uuid.Parse(req.DeviceID)
+		if err != nil {
+			http.Error(w, "invalid device ID", http.StatusBadRequest)
+			return
+		}
+
+		// TODO: Take the user from JWT auth
+		if req.UserEmail == "" {
+			http.Error(w, "user_email is required", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.AllowedDestinations) > forward.MaxDestinations {
+			http.Error(w, fmt.Sprintf("at most %d allowed_destinations", forward.MaxDestinations), http.StatusBadRequest)
+			return
+		}
+		destinations := make([]string, 0, len(req.AllowedDestinations))
+		for _, dest := range req.AllowedDestinations {
+			if err := forward.ValidateDestination(dest); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			destinations = append(destinations, forward.NormalizeDestination(dest))
+		}
+
+		device, err := queries.GetDevice(r.Context(), deviceID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "device not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if device.Status != service.DeviceStatusActive {
+			http.Error(w, "device is not active", http.StatusConflict)
+			return
+		}
+
+		allowed, err := policies.Authorize(r.Context(), device, req.UserEmail)
+		if errors.Is(err, service.ErrAccessDenied) {
+			entry := auditEntry(r, device.OrganizationID, service.AuditAccessStarted, "device", device.ID.String(), "access")
+			entry.Actor = req.UserEmail
+			entry.Result = service.AuditFailure
+			entry.Metadata = map[string]any{"error": err.Error()}
+			audit.Record(r.Context(), entry)
+
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to evaluate access policies", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		duration := allowed
+		if req.DurationSeconds != 0 {
+			duration = time.Duration(req.DurationSeconds) * time.Second
+		}
+		if duration <= 0 || duration > allowed {
+			http.Error(w, fmt.Sprintf("duration_seconds must be between 1 and %d", int(allowed.Seconds())), http.StatusBadRequest)
+			return
+		}
+
+		session, err := sessions.Open(r.Context(), service.OpenAccessSessionParams{
+			Device:              device,
+			UserEmail:           req.UserEmail,
+			ExpiresAt:           time.Now().UTC().Add(duration),
+			ClientPublicKey:     req.WireguardPublicKey,
+			AllowedDestinations: destinations,
+		})
+		if errors.Is(err, service.ErrInvalidClientKey) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, service.ErrHubNotConfigured) || errors.Is(err, service.ErrSubnetExhausted) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to create access session", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("access session created",
+			zap.String("session_id", session.ID.String()),
+			zap.String("device_id", device.ID.String()),
+			zap.String("user_email", req.UserEmail),
+		)
+
+		entry := auditEntry(r, device.OrganizationID, service.AuditAccessStarted, "device", device.ID.String(), "access")
+		entry.Actor = req.UserEmail
+		entry.Metadata = map[string]any{
+			"session_id":           session.ID.String(),
+			"expires_at":           session.ExpiresAt,
+			"allowed_destinations": session.AllowedDestinations,
+		}
+		audit.Record(r.Context(), entry)
+
+		events.Publish(service.Event{
+			Type:           service.EventAccessStarted,
+			OrganizationID: device.OrganizationID,
+			ResourceType:   "device",
+			ResourceID:     device.ID.String(),
+			Data: map[string]any{
+				"session_id": session.ID.String(),
+				"user_email": session.UserEmail,
+				"expires_at": session.ExpiresAt,
+			},
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(session)
+	}
+}
+
+func TerminateAccessSession(queries *generated.Queries, sessions *service.AccessSessionService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid access session ID", http.StatusBadRequest)
+			return
+		}
+
+		session, err := sessions.Terminate(r.Context(), sessionID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to terminate access session", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if device, err := queries.GetDevice(r.Context(), session.DeviceID); err == nil {
+			entry := auditEntry(r, device.OrganizationID, service.AuditAccessTerminated, "device", device.ID.String(), "terminate_access")
+			entry.Metadata = map[string]any{
+				"session_id": session.ID.String(),
+				"user_email": session.UserEmail,
+			}
+			audit.Record(r.Context(), entry)
+		} else {
+			logger.Error("failed to get device for audit", zap.Error(err))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(session)
+	}
+}
+
+// OpenAccessTunnel relays a connection to destination, which the session
+// must allow, through the session's device over its agent's connection to the
+// control plane. It serves clients whose WireGuard traffic cannot reach the
+// device: the request upgrades to the safeedge-tunnel protocol, after which
+// the connection carries the relayed stream.
+func OpenAccessTunnel(queries *generated.Queries, tunnels service.Tunneler, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid access session ID", http.StatusBadRequest)
+			return
+		}
+
+		if !strings.EqualFold(r.Header.Get("Upgrade"), forward.TunnelProtocol) {
+			w.Header().Set("Upgrade", forward.TunnelProtocol)
+			http.Error(w, "expected Upgrade: "+forward.TunnelProtocol, http.StatusUpgradeRequired)
+			return
+		}
+
+		destination := r.URL.Query().Get("destination")
+		if err := forward.ValidateDestination(destination); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		destination = forward.NormalizeDestination(destination)
+
+		session, err := queries.GetAccessSession(r.Context(), sessionID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get access session", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if time.Now().After(session.ExpiresAt) {
+			http.Error(w, "access session has expired", http.StatusConflict)
+			return
+		}
+		if !slices.Contains(session.AllowedDestinations, destination) {
+			http.Error(w, "destination not allowed by the access session", http.StatusForbidden)
+			return
+		}
+
+		tunnel, err := tunnels.OpenTunnel(r.Context(), session.DeviceID, session.ID, destination)
+		if errors.Is(err, service.ErrDeviceNotConnected) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if errors.Is(err, service.ErrTunnelRefused) {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			http.Error(w, "timed out waiting for the device", http.StatusGatewayTimeout)
+			return
+		}
+		if err != nil {
+			if r.Context().Err() == nil {
+				logger.Error("failed to open tunnel", zap.Error(err))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+			}
+			return
+		}
+		defer tunnel.Close()
+
+		conn, buffered, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			logger.Error("failed to take over connection", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+
+		// The server's read and write timeouts do not apply to the stream
+		conn.SetDeadline(time.Time{})
+
+		fmt.Fprintf(buffered, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", forward.TunnelProtocol)
+		if err := buffered.Flush(); err != nil {
+			return
+		}
+
+		logger.Info("relaying access session connection",
+			zap.String("session_id", session.ID.String()),
+			zap.String("device_id", session.DeviceID.String()),
+			zap.String("destination", destination),
+		)
+
+		done := make(chan struct{}, 2)
+		go func() {
+			// The client may have sent data behind its request
+			io.Copy(tunnel, buffered.Reader)
+			done <- struct{}{}
+		}()
+		go func() {
+			io.Copy(conn, tunnel)
+			done <- struct{}{}
+		}()
+		<-done
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+)
+
+// maxArtifactFieldSize bounds the form fields sent ahead of an artifact's file
+const maxArtifactFieldSize = 4 << 10
+
+// CreateArtifact stores an uploaded artifact. The multipart form gives
+// name, type, blake3_hash, signature (base64 Ed25519 over the hash) and
+// signing_key_id (the base64 public key), followed by the file, which is
+// streamed to disk and must match the hash.
+func CreateArtifact(artifacts *service.ArtifactStore, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		// Uploads outlive the server's read and write timeouts
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+
+		form, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, "expected a multipart form", http.StatusBadRequest)
+			return
+		}
+
+		fields := map[string]string{}
+		for {
+			part, err := form.NextPart()
+			if err == io.EOF {
+				http.Error(w, "file is required", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "invalid multipart form", http.StatusBadRequest)
+				return
+			}
+
+			if part.FormName() != "file" {
+				value, err := io.ReadAll(io.LimitReader(part, maxArtifactFieldSize+1))
+				if err != nil || len(value) > maxArtifactFieldSize {
+					http.Error(w, "invalid form field "+part.FormName(), http.StatusBadRequest)
+					return
+				}
+				fields[part.FormName()] = string(value)
+				continue
+			}
+
+			signature, err := base64.StdEncoding.DecodeString(fields["signature"])
+			if err != nil {
+				http.Error(w, "signature must be base64", http.StatusBadRequest)
+				return
+			}
+
+			artifact, err := artifacts.Create(r.Context(), service.CreateArtifactParams{
+				OrganizationID: orgID,
+				Name:           fields["name"],
+				Type:           fields["type"],
+				Blake3Hash:     fields["blake3_hash"],
+				Signature:      signature,
+				SigningKeyID:   fields["signing_key_id"],
+			}, part)
+			switch {
+			case errors.Is(err, service.ErrInvalidArtifact):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case errors.Is(err, service.ErrArtifactExists):
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			case err != nil:
+				logger.Error("failed to create artifact", zap.Error(err))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+
+			logger.Info("artifact created",
+				zap.String("artifact_id", artifact.ID.String()),
+				zap.String("name", artifact.Name),
+				zap.String("type", artifact.Type),
+				zap.Int64("size_bytes", artifact.SizeBytes),
+			)
+
+			entry := auditEntry(r, orgID, service.AuditArtifactCreated, "artifact", artifact.ID.String(), "create")
+			entry.Metadata = map[string]any{
+				"name":           artifact.Name,
+				"type":           artifact.Type,
+				"blake3_hash":    artifact.Blake3Hash,
+				"signing_key_id": artifact.SigningKeyID,
+				"size_bytes":     artifact.SizeBytes,
+			}
+			audit.Record(r.Context(), entry)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(artifact)
+			return
+		}
+	}
+}
+
+func GetArtifact(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		artifact, ok := loadArtifact(w, r, queries, logger)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(artifact)
+	}
+}
+
+// GetArtifactContent serves an artifact's file. Agents download updates
+// from here and check the file against the hash and signature they are
+// sent, so the file itself needs no protection.
+func GetArtifactContent(queries *generated.Queries, artifacts *service.ArtifactStore, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		artifact, ok := loadArtifact(w, r, queries, logger)
+		if !ok {
+			return
+		}
+
+		file, err := artifacts.Open(artifact)
+		if err != nil {
+			logger.Error("failed to open artifact", zap.String("artifact_id", artifact.ID.String()), zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+
+		// Downloads outlive the server's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "", artifact.CreatedAt, file)
+	}
+}
+
+// loadArtifact gets the artifact named by the request's id, writing the
+// error response if there is none
+func loadArtifact(w http.ResponseWriter, r *http.Request, queries *generated.Queries, logger *zap.Logger) (generated.Artifact, bool) {
+	artifactID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid artifact ID", http.StatusBadRequest)
+		return generated.Artifact{}, false
+	}
+
+	artifact, err := queries.GetArtifact(r.Context(), artifactID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return generated.Artifact{}, false
+	}
+	if err != nil {
+		logger.Error("failed to get artifact", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return generated.Artifact{}, false
+	}
+	return artifact, true
+}
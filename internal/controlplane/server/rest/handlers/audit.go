@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+)
+
+// auditEntry starts an audit entry for an operator request. The client IP
+// comes from middleware.RealIP and the request ID from middleware.RequestID.
+func auditEntry(r *http.Request, orgID uuid.UUID, eventType, resourceType, resourceID, action string) service.AuditEntry {
+	return service.AuditEntry{
+		OrganizationID: orgID,
+		ActorType:      service.ActorUser,
+		// TODO: Take the actor from JWT auth
+		Actor:        "",
+		EventType:    eventType,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Action:       action,
+		IPAddress:    r.RemoteAddr,
+		RequestID:    middleware.GetReqID(r.Context()),
+	}
+}
+
+// deviceAuditEntry starts an audit entry for a request made by a device
+func deviceAuditEntry(r *http.Request, device generated.Device, eventType, action string) service.AuditEntry {
+	entry := auditEntry(r, device.OrganizationID, eventType, "device", device.ID.String(), action)
+	entry.ActorType = service.ActorDevice
+	entry.Actor = device.ID.String()
+	return entry
+}
+
+// auditActorTypes are the values accepted by ?actor_type on audit log listing
+var auditActorTypes = map[string]bool{
+	service.ActorUser:   true,
+	service.ActorDevice: true,
+	service.ActorSystem: true,
+}
+
+// AuditLogResponse is an audit log entry with its metadata decoded
+type AuditLogResponse struct {
+	generated.AuditLog
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+type ListAuditLogsResponse struct {
+	AuditLogs  []AuditLogResponse `json:"audit_logs"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// ListAuditLogs lists audit log entries, newest first. Entries can be
+// filtered by start_time and end_time (RFC3339, inclusive), event_type,
+// resource_type, resource_id, actor_type and actor, and are paged with
+// page_size and the opaque cursor returned as next_cursor.
+func ListAuditLogs(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		query := r.URL.Query()
+
+		pageSize, err := parsePageSize(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		params := generated.ListAuditLogsParams{
+			OrganizationID: orgID,
+			EventType:      stringToText(query.Get("event_type")),
+			ResourceType:   stringToText(query.Get("resource_type")),
+			ResourceID:     stringToText(query.Get("resource_id")),
+			Actor:          stringToText(query.Get("actor")),
+			PageSize:       int32(pageSize + 1),
+		}
+
+		if params.StartTime, err = parseTimeParam(query.Get("start_time")); err != nil {
+			http.Error(w, "invalid start_time", http.StatusBadRequest)
+			return
+		}
+		if params.EndTime, err = parseTimeParam(query.Get("end_time")); err != nil {
+			http.Error(w, "invalid end_time", http.StatusBadRequest)
+			return
+		}
+
+		if v := query.Get("actor_type"); v != "" {
+			if !auditActorTypes[v] {
+				http.Error(w, "invalid actor_type", http.StatusBadRequest)
+				return
+			}
+			params.ActorType = stringToText(v)
+		}
+
+		if v := query.Get("cursor"); v != "" {
+			cursor, err := decodeCursor(v)
+			if err != nil || cursor.SortBy != "timestamp" {
+				http.Error(w, "invalid cursor", http.StatusBadRequest)
+				return
+			}
+			t, err := time.Parse(time.RFC3339Nano, cursor.Key)
+			if err != nil {
+				http.Error(w, "invalid cursor", http.StatusBadRequest)
+				return
+			}
+			params.CursorTime = pgtype.Timestamptz{Time: t, Valid: true}
+			params.CursorID = pgtype.UUID{Bytes: cursor.ID, Valid: true}
+		}
+
+		logs, err := queries.ListAuditLogs(r.Context(), params)
+		if err != nil {
+			logger.Error("failed to list audit logs", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := ListAuditLogsResponse{AuditLogs: []AuditLogResponse{}}
+
+		if len(logs) > pageSize {
+			logs = logs[:pageSize]
+			last := logs[len(logs)-1]
+			resp.NextCursor = encodeCursor(pageCursor{
+				SortBy: "timestamp",
+				Desc:   true,
+				Key:    last.Timestamp.UTC().Format(time.RFC3339Nano),
+				ID:     last.ID,
+			})
+		}
+
+		for _, log := range logs {
+			resp.AuditLogs = append(resp.AuditLogs, AuditLogResponse{
+				AuditLog: log,
+				Metadata: log.Metadata,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+type AuditChainResponse struct {
+	AuditLogs []AuditLogResponse `json:"audit_logs"`
+	// NextSequence is the from_sequence of the next page, if any
+	NextSequence int64 `json:"next_sequence,omitempty"`
+}
+
+// GetAuditChain lists audit log entries in chain order for verification,
+// from from_sequence (default 1) through to_sequence, paged with page_size
+// and next_sequence
+func GetAuditChain(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		pageSize, err := parsePageSize(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		from, to, err := parseSequenceRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !from.Valid {
+			from = pgtype.Int8{Int64: 1, Valid: true}
+		}
+
+		logs, err := queries.ListAuditChain(r.Context(), generated.ListAuditChainParams{
+			OrganizationID: orgID,
+			FromSequence:   from.Int64,
+			ToSequence:     to,
+			PageSize:       int32(pageSize + 1),
+		})
+		if err != nil {
+			logger.Error("failed to list audit chain", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := AuditChainResponse{AuditLogs: []AuditLogResponse{}}
+
+		if len(logs) > pageSize {
+			resp.NextSequence = logs[pageSize].Sequence
+			logs = logs[:pageSize]
+		}
+
+		for _, log := range logs {
+			resp.AuditLogs = append(resp.AuditLogs, AuditLogResponse{
+				AuditLog: log,
+				Metadata: log.Metadata,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// ListAuditCheckpoints lists signed audit chain checkpoints, optionally
+// limited to from_sequence through to_sequence
+func ListAuditCheckpoints(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		from, to, err := parseSequenceRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		checkpoints, err := queries.ListAuditCheckpoints(r.Context(), generated.ListAuditCheckpointsParams{
+			OrganizationID: orgID,
+			FromSequence:   from,
+			ToSequence:     to,
+		})
+		if err != nil {
+			logger.Error("failed to list audit checkpoints", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(checkpoints)
+	}
+}
+
+// CreateAuditCheckpoint signs the current head of the audit chain without
+// waiting for the next periodic checkpoint
+func CreateAuditCheckpoint(queries *generated.Queries, checkpointer *service.AuditCheckpointer, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		checkpoint, err := checkpointer.Checkpoint(r.Context(), orgID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "audit log is empty", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to checkpoint audit chain", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, orgID, service.AuditAuditCheckpointCreated, "audit_checkpoint", checkpoint.ID.String(), "create")
+		entry.Metadata = map[string]any{"sequence": checkpoint.Sequence, "hash": checkpoint.Hash}
+		audit.Record(r.Context(), entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(checkpoint)
+	}
+}
+
+// parseSequenceRange reads ?from_sequence and ?to_sequence
+func parseSequenceRange(r *http.Request) (from, to pgtype.Int8, err error) {
+	for _, p := range []struct {
+		name string
+		dst  *pgtype.Int8
+	}{{"from_sequence", &from}, {"to_sequence", &to}} {
+		v := r.URL.Query().Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 {
+			return from, to, fmt.Errorf("invalid %s", p.name)
+		}
+		*p.dst = pgtype.Int8{Int64: n, Valid: true}
+	}
+
+	if from.Valid && to.Valid && to.Int64 < from.Int64 {
+		return from, to, fmt.Errorf("to_sequence must not be before from_sequence")
+	}
+
+	return from, to, nil
+}
+
+// ExportAuditLogs downloads every matching audit log entry in chain order as
+// NDJSON (format=ndjson, the default) or CEF (format=cef). It accepts the
+// same filters as ListAuditLogs.
+func ExportAuditLogs(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		query := r.URL.Query()
+
+		format := query.Get("format")
+		if format == "" {
+			format = service.AuditFormatNDJSON
+		}
+
+		contentType := "application/x-ndjson"
+		switch format {
+		case service.AuditFormatNDJSON:
+		case service.AuditFormatCEF:
+			contentType = "text/plain; charset=utf-8"
+		default:
+			http.Error(w, "format must be ndjson or cef", http.StatusBadRequest)
+			return
+		}
+
+		params := generated.ExportAuditLogsParams{
+			OrganizationID: orgID,
+			EventType:      stringToText(query.Get("event_type")),
+			ResourceType:   stringToText(query.Get("resource_type")),
+			ResourceID:     stringToText(query.Get("resource_id")),
+			Actor:          stringToText(query.Get("actor")),
+			PageSize:       maxPageSize,
+		}
+
+		var err error
+		if params.StartTime, err = parseTimeParam(query.Get("start_time")); err != nil {
+			http.Error(w, "invalid start_time", http.StatusBadRequest)
+			return
+		}
+		if params.EndTime, err = parseTimeParam(query.Get("end_time")); err != nil {
+			http.Error(w, "invalid end_time", http.StatusBadRequest)
+			return
+		}
+
+		if v := query.Get("actor_type"); v != "" {
+			if !auditActorTypes[v] {
+				http.Error(w, "invalid actor_type", http.StatusBadRequest)
+				return
+			}
+			params.ActorType = stringToText(v)
+		}
+
+		// Exports of the whole log outlive the server's write timeout
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-logs.%s"`, format))
+
+		flusher, _ := w.(http.Flusher)
+		for {
+			logs, err := queries.ExportAuditLogs(r.Context(), params)
+			if err != nil {
+				// Headers may already be sent; the truncated download is all we can signal
+				logger.Error("failed to export audit logs", zap.Error(err))
+				if params.AfterSequence == 0 {
+					http.Error(w, "internal error", http.StatusInternalServerError)
+				}
+				return
+			}
+
+			for _, log := range logs {
+				line, err := service.FormatAuditLog(log, format)
+				if err != nil {
+					logger.Error("failed to format audit log", zap.Error(err))
+					return
+				}
+				if _, err := w.Write(append(line, '\n')); err != nil {
+					return
+				}
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+
+			if len(logs) < int(params.PageSize) {
+				return
+			}
+			params.AfterSequence = logs[len(logs)-1].Sequence
+		}
+	}
+}
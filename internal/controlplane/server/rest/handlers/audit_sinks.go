@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+)
+
+type CreateAuditSinkRequest struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Config json.RawMessage `json:"config"`
+	// FromBeginning replays the whole audit log instead of only new entries
+	FromBeginning bool `json:"from_beginning,omitempty"`
+}
+
+// AuditSinkResponse is an audit sink with its configuration decoded and
+// webhook header values redacted
+type AuditSinkResponse struct {
+	generated.AuditSink
+	Config json.RawMessage `json:"config"`
+}
+
+func newAuditSinkResponse(sink generated.AuditSink) AuditSinkResponse {
+	config := json.RawMessage(sink.Config)
+
+	var c map[string]any
+	if err := json.Unmarshal(sink.Config, &c); err == nil {
+		if headers, ok := c["headers"].(map[string]any); ok {
+			for k := range headers {
+				headers[k] = "REDACTED"
+			}
+			config, _ = json.Marshal(c)
+		}
+	}
+
+	return AuditSinkResponse{AuditSink: sink, Config: config}
+}
+
+// CreateAuditSink adds a destination that new audit entries are forwarded to
+func CreateAuditSink(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		var req CreateAuditSinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if req.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+
+		config, err := service.NormalizeAuditSinkConfig(req.Type, req.Config)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Start after the current head unless replaying history
+		var lastSequence int64
+		if !req.FromBeginning {
+			head, err := queries.GetAuditChainHead(r.Context(), orgID)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				logger.Error("failed to get audit chain head", zap.Error(err))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			lastSequence = head.Sequence
+		}
+
+		sink, err := queries.CreateAuditSink(r.Context(), generated.CreateAuditSinkParams{
+			OrganizationID: orgID,
+			Name:           req.Name,
+			Type:           req.Type,
+			Config:         config,
+			LastSequence:   lastSequence,
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			http.Error(w, "audit sink already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to create audit sink", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("audit sink created",
+			zap.String("sink_id", sink.ID.String()),
+			zap.String("type", sink.Type),
+		)
+
+		entry := auditEntry(r, orgID, service.AuditAuditSinkCreated, "audit_sink", sink.ID.String(), "create")
+		entry.Metadata = map[string]any{
+			"name":           sink.Name,
+			"type":           sink.Type,
+			"from_beginning": req.FromBeginning,
+		}
+		audit.Record(r.Context(), entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newAuditSinkResponse(sink))
+	}
+}
+
+func ListAuditSinks(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		sinks, err := queries.ListAuditSinks(r.Context(), orgID)
+		if err != nil {
+			logger.Error("failed to list audit sinks", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := make([]AuditSinkResponse, len(sinks))
+		for i, sink := range sinks {
+			resp[i] = newAuditSinkResponse(sink)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// GetAuditSink returns a sink and its delivery state
+func GetAuditSink(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		sinkID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid audit sink ID", http.StatusBadRequest)
+			return
+		}
+
+		sink, err := queries.GetAuditSink(r.Context(), generated.GetAuditSinkParams{
+			ID:             sinkID,
+			OrganizationID: orgID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get audit sink", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newAuditSinkResponse(sink))
+	}
+}
+
+func DeleteAuditSink(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		sinkID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid audit sink ID", http.StatusBadRequest)
+			return
+		}
+
+		sink, err := queries.DeleteAuditSink(r.Context(), generated.DeleteAuditSinkParams{
+			ID:             sinkID,
+			OrganizationID: orgID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to delete audit sink", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, orgID, service.AuditAuditSinkDeleted, "audit_sink", sink.ID.String(), "delete")
+		entry.Metadata = map[string]any{"name": sink.Name, "type": sink.Type}
+		audit.Record(r.Context(), entry)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+	"github.com/netf/safeedge/pkg/command"
+	"github.com/netf/safeedge/pkg/labels"
+)
+
+// defaultMaxConcurrency is how many of a batch's commands run at once
+// unless the request says otherwise
+const defaultMaxConcurrency = 10
+
+type RunCommandRequest struct {
+	Command        string   `json:"command"`
+	Args           []string `json:"args"`
+	TimeoutSeconds int32    `json:"timeout_seconds,omitempty"`
+}
+
+// timeout validates the request's command and returns how long it may run
+func (req RunCommandRequest) timeout() (time.Duration, error) {
+	if err := command.Validate(req.Command, req.Args); err != nil {
+		return 0, err
+	}
+
+	timeout := command.DefaultTimeout
+	if req.TimeoutSeconds != 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+	if timeout <= 0 || timeout > command.MaxTimeout {
+		return 0, fmt.Errorf("timeout_seconds must be between 1 and %d", int(command.MaxTimeout.Seconds()))
+	}
+
+	return timeout, nil
+}
+
+type CreateCommandBatchRequest struct {
+	RunCommandRequest
+	TargetSelector string `json:"target_selector"`
+	TargetGroupID  string `json:"target_group_id,omitempty"`
+	MaxConcurrency int32  `json:"max_concurrency,omitempty"`
+}
+
+// CommandBatchResponse is a command batch with its target selector in text
+// form and its commands
+type CommandBatchResponse struct {
+	generated.CommandBatch
+	TargetSelector string                    `json:"target_selector"`
+	Commands       []generated.DeviceCommand `json:"commands"`
+}
+
+func newCommandBatchResponse(ctx context.Context, queries *generated.Queries, batch generated.CommandBatch) (CommandBatchResponse, error) {
+	sel, err := labels.SelectorFromJSON(batch.TargetSelector)
+	if err != nil {
+		return CommandBatchResponse{}, err
+	}
+
+	commands, err := queries.ListBatchCommands(ctx, batch.ID)
+	if err != nil {
+		return CommandBatchResponse{}, err
+	}
+
+	return CommandBatchResponse{
+		CommandBatch:   batch,
+		TargetSelector: sel.String(),
+		Commands:       commands,
+	}, nil
+}
+
+// RunDeviceCommand runs a command on a device through its agent. The agent
+// only runs commands on its allowlist and scripts in its script directory,
+// without a shell, and kills them after timeout_seconds. The command's
+// output streams live as command.output events and is kept with it; a
+// command.completed event reports how it ended.
+func RunDeviceCommand(queries *generated.Queries, commands *service.CommandService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid device ID", http.StatusBadRequest)
+			return
+		}
+
+		var req RunCommandRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		timeout, err := req.timeout()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		device, err := queries.GetDevice(r.Context(), deviceID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if device.Status != service.DeviceStatusActive {
+			http.Error(w, "device is not active", http.StatusConflict)
+			return
+		}
+
+		cmd, err := commands.Start(r.Context(), device, service.RunCommandParams{
+			Command: req.Command,
+			Args:    req.Args,
+			Timeout: timeout,
+		})
+		if cmd.ID == uuid.Nil {
+			logger.Error("failed to start command", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := deviceCommandAuditEntry(r, device, cmd)
+		if err != nil {
+			entry.Result = service.AuditFailure
+			entry.Metadata["error"] = err.Error()
+		}
+		audit.Record(r.Context(), entry)
+
+		if errors.Is(err, service.ErrDeviceNotConnected) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("command started",
+			zap.String("command_id", cmd.ID.String()),
+			zap.String("device_id", device.ID.String()),
+			zap.String("command", cmd.Command),
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(cmd)
+	}
+}
+
+// deviceCommandAuditEntry audits an operator's request to run a command
+func deviceCommandAuditEntry(r *http.Request, device generated.Device, cmd generated.DeviceCommand) service.AuditEntry {
+	entry := auditEntry(r, device.OrganizationID, service.AuditCommandRequested, "device", device.ID.String(), "run_command")
+	entry.Metadata = map[string]any{
+		"command_id":      cmd.ID.String(),
+		"command":         cmd.Command,
+		"args":            cmd.Args,
+		"timeout_seconds": cmd.TimeoutSeconds,
+	}
+	return entry
+}
+
+// GetCommand returns a command with the output collected so far
+func GetCommand(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		commandID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid command ID", http.StatusBadRequest)
+			return
+		}
+
+		cmd, err := queries.GetDeviceCommand(r.Context(), commandID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && cmd.OrganizationID != orgID) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get command", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cmd)
+	}
+}
+
+// CreateCommandBatch runs a command on every active device matching
+// target_selector, and belonging to target_group_id if given, with at most
+// max_concurrency of them running at once. Devices that are not connected
+// fail right away without taking up a slot.
+func CreateCommandBatch(queries *generated.Queries, commands *service.CommandService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		var req CreateCommandBatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		timeout, err := req.timeout()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.MaxConcurrency == 0 {
+			req.MaxConcurrency = defaultMaxConcurrency
+		}
+		if req.MaxConcurrency < 0 {
+			http.Error(w, "max_concurrency must be positive", http.StatusBadRequest)
+			return
+		}
+
+		selector, sel, err := encodeSelector(req.TargetSelector)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		targetGroupID, err := resolveDeviceGroup(r.Context(), queries, orgID, req.TargetGroupID)
+		if errors.Is(err, errInvalidDeviceGroup) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device group", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		batch, err := commands.StartBatch(r.Context(), service.StartCommandBatchParams{
+			RunCommandParams: service.RunCommandParams{
+				Command: req.Command,
+				Args:    req.Args,
+				Timeout: timeout,
+			},
+			OrganizationID: orgID,
+			TargetSelector: selector,
+			TargetGroupID:  targetGroupID,
+			MaxConcurrency: req.MaxConcurrency,
+		})
+		if err != nil {
+			logger.Error("failed to start command batch", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := newCommandBatchResponse(r.Context(), queries, batch)
+		if err != nil {
+			logger.Error("failed to list batch commands", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("command batch started",
+			zap.String("batch_id", batch.ID.String()),
+			zap.String("command", batch.Command),
+			zap.String("target_selector", sel.String()),
+			zap.Int("targets", len(resp.Commands)),
+		)
+
+		entry := auditEntry(r, orgID, service.AuditCommandBatchCreated, "command_batch", batch.ID.String(), "create")
+		entry.Metadata = map[string]any{
+			"command":         batch.Command,
+			"args":            batch.Args,
+			"timeout_seconds": batch.TimeoutSeconds,
+			"target_selector": sel.String(),
+			"max_concurrency": batch.MaxConcurrency,
+			"target_count":    len(resp.Commands),
+		}
+		if targetGroupID.Valid {
+			entry.Metadata["target_group_id"] = req.TargetGroupID
+		}
+		audit.Record(r.Context(), entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// GetCommandBatch returns a command batch with the state and output of each
+// of its commands
+func GetCommandBatch(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		batchID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid command batch ID", http.StatusBadRequest)
+			return
+		}
+
+		batch, err := queries.GetCommandBatch(r.Context(), batchID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && batch.OrganizationID != orgID) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get command batch", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := newCommandBatchResponse(r.Context(), queries, batch)
+		if err != nil {
+			logger.Error("failed to list batch commands", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
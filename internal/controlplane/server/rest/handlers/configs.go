@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+	"github.com/netf/safeedge/pkg/devconfig"
+)
+
+// GetDeviceConfig returns a device's desired configuration, what it last
+// reported and the settings that differ
+func GetDeviceConfig(queries *generated.Queries, configs *service.ConfigService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device, ok := loadConfigDevice(w, r, queries, logger)
+		if !ok {
+			return
+		}
+
+		state, err := configs.State(r.Context(), device.ID)
+		if err != nil {
+			logger.Error("failed to get device config state", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+	}
+}
+
+// SetDeviceConfig replaces a device's own configuration document, merged
+// over its groups'. The body is the document: a JSON object of sections,
+// each applied by the agent plugin its key names, in which null removes a
+// setting a group makes.
+func SetDeviceConfig(queries *generated.Queries, configs *service.ConfigService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device, ok := loadConfigDevice(w, r, queries, logger)
+		if !ok {
+			return
+		}
+		doc, ok := readConfigDocument(w, r)
+		if !ok {
+			return
+		}
+
+		if _, err := configs.SetDeviceConfig(r.Context(), device, doc); err != nil {
+			logger.Error("failed to set device config", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, device.OrganizationID, service.AuditDeviceConfigUpdated, "device", device.ID.String(), "update_config")
+		entry.Metadata = configAuditMetadata(doc)
+		audit.Record(r.Context(), entry)
+
+		state, err := configs.State(r.Context(), device.ID)
+		if err != nil {
+			logger.Error("failed to get device config state", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+	}
+}
+
+// DeleteDeviceConfig removes a device's own configuration document, leaving
+// its groups'. Settings already applied stay as they are.
+func DeleteDeviceConfig(queries *generated.Queries, configs *service.ConfigService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device, ok := loadConfigDevice(w, r, queries, logger)
+		if !ok {
+			return
+		}
+
+		err := configs.DeleteDeviceConfig(r.Context(), device)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to delete device config", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		audit.Record(r.Context(), auditEntry(r, device.OrganizationID, service.AuditDeviceConfigDeleted, "device", device.ID.String(), "delete_config"))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetDeviceGroupConfig returns a group's configuration document
+func GetDeviceGroupConfig(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		group, ok := loadDeviceGroup(w, r, queries, orgID, logger)
+		if !ok {
+			return
+		}
+
+		config, err := queries.GetDeviceGroupConfig(r.Context(), group.ID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device group config", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(config.Document)
+	}
+}
+
+// SetDeviceGroupConfig replaces a group's configuration document, which
+// applies to its members. Groups' documents are merged in group name order.
+func SetDeviceGroupConfig(queries *generated.Queries, configs *service.ConfigService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		group, ok := loadDeviceGroup(w, r, queries, orgID, logger)
+		if !ok {
+			return
+		}
+		doc, ok := readConfigDocument(w, r)
+		if !ok {
+			return
+		}
+
+		config, err := configs.SetGroupConfig(r.Context(), group, doc)
+		if err != nil {
+			logger.Error("failed to set device group config", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, orgID, service.AuditDeviceGroupConfigUpdated, "device_group", group.ID.String(), "update_config")
+		entry.Metadata = configAuditMetadata(doc)
+		audit.Record(r.Context(), entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(config.Document)
+	}
+}
+
+// DeleteDeviceGroupConfig removes a group's configuration document.
+// Settings its members already applied stay as they are.
+func DeleteDeviceGroupConfig(queries *generated.Queries, configs *service.ConfigService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		group, ok := loadDeviceGroup(w, r, queries, orgID, logger)
+		if !ok {
+			return
+		}
+
+		err := configs.DeleteGroupConfig(r.Context(), group)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to delete device group config", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		audit.Record(r.Context(), auditEntry(r, orgID, service.AuditDeviceGroupConfigDeleted, "device_group", group.ID.String(), "delete_config"))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// loadConfigDevice loads the device a request names, writing the error
+// response if it cannot
+func loadConfigDevice(w http.ResponseWriter, r *http.Request, queries *generated.Queries, logger *zap.Logger) (generated.Device, bool) {
+	deviceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid device ID", http.StatusBadRequest)
+		return generated.Device{}, false
+	}
+
+	device, err := queries.GetDevice(r.Context(), deviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return generated.Device{}, false
+	}
+	if err != nil {
+		logger.Error("failed to get device", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return generated.Device{}, false
+	}
+	return device, true
+}
+
+// readConfigDocument reads and validates the configuration document in a
+// request's body, writing the error response if it cannot
+func readConfigDocument(w http.ResponseWriter, r *http.Request) (devconfig.Document, bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, devconfig.MaxDocumentSize))
+	if err != nil {
+		http.Error(w, "document is too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+
+	doc, err := devconfig.Parse(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return doc, true
+}
+
+// configAuditMetadata describes a configuration document in an audit
+// entry by its sections and hash, leaving out settings that may be secret
+func configAuditMetadata(doc devconfig.Document) map[string]any {
+	sections := make([]string, 0, len(doc))
+	for name := range doc {
+		sections = append(sections, name)
+	}
+	slices.Sort(sections)
+
+	return map[string]any{
+		"sections": sections,
+		"hash":     devconfig.Hash(doc),
+	}
+}
@@ -0,0 +1,504 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+	"github.com/netf/safeedge/pkg/labels"
+)
+
+// Device group membership types
+const (
+	MembershipStatic  = "STATIC"
+	MembershipDynamic = "DYNAMIC"
+)
+
+// pgForeignKeyViolation is the PostgreSQL error code for foreign key violations
+const pgForeignKeyViolation = "23503"
+
+// errInvalidDeviceGroup is returned for malformed or unknown device group IDs
+var errInvalidDeviceGroup = errors.New("device group not found")
+
+type CreateDeviceGroupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Membership  string `json:"membership,omitempty"`
+	Selector    string `json:"selector,omitempty"`
+}
+
+type UpdateDeviceGroupRequest struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Selector    *string `json:"selector,omitempty"`
+}
+
+// DeviceGroupResponse is a device group with its selector in text form and
+// its current number of member devices
+type DeviceGroupResponse struct {
+	generated.DeviceGroup
+	Selector    string `json:"selector,omitempty"`
+	DeviceCount int64  `json:"device_count"`
+}
+
+// DeviceGroupRef identifies a group a device belongs to
+type DeviceGroupRef struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+func newDeviceGroupResponse(ctx context.Context, queries *generated.Queries, group generated.DeviceGroup) (DeviceGroupResponse, error) {
+	resp := DeviceGroupResponse{DeviceGroup: group}
+
+	if group.Membership == MembershipDynamic {
+		sel, err := labels.SelectorFromJSON(group.Selector)
+		if err != nil {
+			return resp, err
+		}
+		resp.Selector = sel.String()
+	}
+
+	count, err := queries.CountDevicesPage(ctx, generated.CountDevicesPageParams{
+		OrganizationID: group.OrganizationID,
+		GroupID:        pgtype.UUID{Bytes: group.ID, Valid: true},
+	})
+	if err != nil {
+		return resp, err
+	}
+	resp.DeviceCount = count
+
+	return resp, nil
+}
+
+// resolveDeviceGroup parses an optional device group ID and checks that the
+// group belongs to the organization. An empty string yields a NULL ID.
+func resolveDeviceGroup(ctx context.Context, queries *generated.Queries, orgID uuid.UUID, v string) (pgtype.UUID, error) {
+	if v == "" {
+		return pgtype.UUID{}, nil
+	}
+
+	groupID, err := uuid.Parse(v)
+	if err != nil {
+		return pgtype.UUID{}, errInvalidDeviceGroup
+	}
+
+	group, err := queries.GetDeviceGroup(ctx, generated.GetDeviceGroupParams{
+		ID:             groupID,
+		OrganizationID: orgID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return pgtype.UUID{}, errInvalidDeviceGroup
+	}
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+
+	return pgtype.UUID{Bytes: group.ID, Valid: true}, nil
+}
+
+// encodeSelector parses a selector and returns its JSON form for storage
+func encodeSelector(s string) ([]byte, labels.Selector, error) {
+	sel, err := labels.ParseSelector(s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := json.Marshal(sel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, sel, nil
+}
+
+// CreateDeviceGroup creates a STATIC group, whose members are added
+// explicitly, or a DYNAMIC group of the devices matching a label selector.
+// Membership defaults to DYNAMIC when a selector is given.
+func CreateDeviceGroup(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		var req CreateDeviceGroupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if req.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+
+		membership := strings.ToUpper(req.Membership)
+		if membership == "" {
+			membership = MembershipStatic
+			if req.Selector != "" {
+				membership = MembershipDynamic
+			}
+		}
+
+		var selector []byte
+		switch membership {
+		case MembershipStatic:
+			if req.Selector != "" {
+				http.Error(w, "static groups do not take a selector", http.StatusBadRequest)
+				return
+			}
+		case MembershipDynamic:
+			var err error
+			if selector, _, err = encodeSelector(req.Selector); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "membership must be STATIC or DYNAMIC", http.StatusBadRequest)
+			return
+		}
+
+		group, err := queries.CreateDeviceGroup(r.Context(), generated.CreateDeviceGroupParams{
+			OrganizationID: orgID,
+			Name:           req.Name,
+			Description:    req.Description,
+			Membership:     membership,
+			Selector:       selector,
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			http.Error(w, "device group already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to create device group", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("device group created",
+			zap.String("group_id", group.ID.String()),
+			zap.String("membership", group.Membership),
+		)
+
+		entry := auditEntry(r, orgID, service.AuditDeviceGroupCreated, "device_group", group.ID.String(), "create")
+		entry.Metadata = deviceGroupAuditFields(group)
+		audit.Record(r.Context(), entry)
+
+		resp, err := newDeviceGroupResponse(r.Context(), queries, group)
+		if err != nil {
+			logger.Error("failed to count device group members", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func ListDeviceGroups(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		groups, err := queries.ListDeviceGroups(r.Context(), orgID)
+		if err != nil {
+			logger.Error("failed to list device groups", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := make([]DeviceGroupResponse, 0, len(groups))
+		for _, group := range groups {
+			g, err := newDeviceGroupResponse(r.Context(), queries, group)
+			if err != nil {
+				logger.Error("failed to count device group members", zap.Error(err))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			resp = append(resp, g)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func GetDeviceGroup(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		group, ok := loadDeviceGroup(w, r, queries, orgID, logger)
+		if !ok {
+			return
+		}
+
+		resp, err := newDeviceGroupResponse(r.Context(), queries, group)
+		if err != nil {
+			logger.Error("failed to count device group members", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// UpdateDeviceGroup changes a group's name, description or, for DYNAMIC
+// groups, selector. Membership type cannot be changed.
+func UpdateDeviceGroup(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		group, ok := loadDeviceGroup(w, r, queries, orgID, logger)
+		if !ok {
+			return
+		}
+
+		var req UpdateDeviceGroupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		params := generated.UpdateDeviceGroupParams{
+			ID:             group.ID,
+			OrganizationID: orgID,
+			Name:           group.Name,
+			Description:    group.Description,
+			Selector:       group.Selector,
+		}
+
+		if req.Name != nil {
+			if *req.Name == "" {
+				http.Error(w, "name must not be empty", http.StatusBadRequest)
+				return
+			}
+			params.Name = *req.Name
+		}
+		if req.Description != nil {
+			params.Description = *req.Description
+		}
+		if req.Selector != nil {
+			if group.Membership != MembershipDynamic {
+				http.Error(w, "static groups do not take a selector", http.StatusBadRequest)
+				return
+			}
+			selector, _, err := encodeSelector(*req.Selector)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			params.Selector = selector
+		}
+
+		updated, err := queries.UpdateDeviceGroup(r.Context(), params)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			http.Error(w, "device group already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to update device group", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, orgID, service.AuditDeviceGroupUpdated, "device_group", group.ID.String(), "update")
+		entry.Metadata = map[string]any{"changes": service.AuditDiff(deviceGroupAuditFields(group), deviceGroupAuditFields(updated))}
+		audit.Record(r.Context(), entry)
+
+		resp, err := newDeviceGroupResponse(r.Context(), queries, updated)
+		if err != nil {
+			logger.Error("failed to count device group members", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// DeleteDeviceGroup deletes a group. Groups targeted by a rollout cannot be
+// deleted; access policies scoped to the group are deleted with it.
+func DeleteDeviceGroup(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		groupID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid device group ID", http.StatusBadRequest)
+			return
+		}
+
+		group, err := queries.DeleteDeviceGroup(r.Context(), generated.DeleteDeviceGroupParams{
+			ID:             groupID,
+			OrganizationID: orgID,
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+			http.Error(w, "device group is targeted by a rollout", http.StatusConflict)
+			return
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to delete device group", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, orgID, service.AuditDeviceGroupDeleted, "device_group", group.ID.String(), "delete")
+		entry.Metadata = deviceGroupAuditFields(group)
+		audit.Record(r.Context(), entry)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AddDeviceGroupMember adds a device to a STATIC group
+func AddDeviceGroupMember(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		group, ok := loadDeviceGroup(w, r, queries, orgID, logger)
+		if !ok {
+			return
+		}
+
+		if group.Membership != MembershipStatic {
+			http.Error(w, "members of dynamic groups are defined by their selector", http.StatusConflict)
+			return
+		}
+
+		deviceID, err := uuid.Parse(chi.URLParam(r, "device_id"))
+		if err != nil {
+			http.Error(w, "invalid device ID", http.StatusBadRequest)
+			return
+		}
+
+		device, err := queries.GetDevice(r.Context(), deviceID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && device.OrganizationID != orgID) {
+			http.Error(w, "device not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := queries.AddDeviceGroupMember(r.Context(), generated.AddDeviceGroupMemberParams{
+			GroupID:  group.ID,
+			DeviceID: device.ID,
+		}); err != nil {
+			logger.Error("failed to add device group member", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, orgID, service.AuditDeviceGroupMemberAdded, "device_group", group.ID.String(), "add_member")
+		entry.Metadata = map[string]any{"device_id": device.ID.String()}
+		audit.Record(r.Context(), entry)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RemoveDeviceGroupMember removes a device from a STATIC group
+func RemoveDeviceGroupMember(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		group, ok := loadDeviceGroup(w, r, queries, orgID, logger)
+		if !ok {
+			return
+		}
+
+		deviceID, err := uuid.Parse(chi.URLParam(r, "device_id"))
+		if err != nil {
+			http.Error(w, "invalid device ID", http.StatusBadRequest)
+			return
+		}
+
+		_, err = queries.RemoveDeviceGroupMember(r.Context(), generated.RemoveDeviceGroupMemberParams{
+			GroupID:  group.ID,
+			DeviceID: deviceID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to remove device group member", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, orgID, service.AuditDeviceGroupMemberRemoved, "device_group", group.ID.String(), "remove_member")
+		entry.Metadata = map[string]any{"device_id": deviceID.String()}
+		audit.Record(r.Context(), entry)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deviceGroupAuditFields is the audited state of a device group
+func deviceGroupAuditFields(group generated.DeviceGroup) map[string]any {
+	fields := map[string]any{
+		"name":        group.Name,
+		"description": group.Description,
+		"membership":  group.Membership,
+	}
+	if group.Selector != nil {
+		sel, _ := labels.SelectorFromJSON(group.Selector)
+		fields["selector"] = sel.String()
+	}
+	return fields
+}
+
+// loadDeviceGroup fetches the group named by the {id} URL parameter, writing
+// an error response and returning false if it cannot
+func loadDeviceGroup(w http.ResponseWriter, r *http.Request, queries *generated.Queries, orgID uuid.UUID, logger *zap.Logger) (generated.DeviceGroup, bool) {
+	groupID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid device group ID", http.StatusBadRequest)
+		return generated.DeviceGroup{}, false
+	}
+
+	group, err := queries.GetDeviceGroup(r.Context(), generated.GetDeviceGroupParams{
+		ID:             groupID,
+		OrganizationID: orgID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return generated.DeviceGroup{}, false
+	}
+	if err != nil {
+		logger.Error("failed to get device group", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return generated.DeviceGroup{}, false
+	}
+
+	return group, true
+}
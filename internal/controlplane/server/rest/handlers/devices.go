@@ -1,38 +1,261 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"go.uber.org/zap"
 
 	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+	"github.com/netf/safeedge/pkg/labels"
 )
 
-func ListDevices(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+// DeviceResponse is a device together with its live connectivity. Labels
+// are set by operators and reported labels by the agent; selectors match
+// both, with operator labels winning on conflicting keys.
+type DeviceResponse struct {
+	generated.Device
+	Labels         labels.Set           `json:"labels"`
+	ReportedLabels labels.Set           `json:"reported_labels"`
+	Connectivity   service.Connectivity `json:"connectivity"`
+	Groups         []DeviceGroupRef     `json:"groups,omitempty"`
+	// Config is the device's desired configuration beside what it reported
+	Config *service.DeviceConfigState `json:"config,omitempty"`
+}
+
+func newDeviceResponse(device generated.Device, presence *service.PresenceService) DeviceResponse {
+	return DeviceResponse{
+		Device:         device,
+		Labels:         decodeLabels(device.Labels),
+		ReportedLabels: decodeLabels(device.ReportedLabels),
+		Connectivity:   presence.Connectivity(device),
+	}
+}
+
+// decodeLabels decodes a JSONB label column, treating bad data as empty
+func decodeLabels(data []byte) labels.Set {
+	set := labels.Set{}
+	json.Unmarshal(data, &set)
+	return set
+}
+
+// SetDeviceLabelsRequest replaces the operator labels of a device
+type SetDeviceLabelsRequest struct {
+	Labels labels.Set `json:"labels"`
+}
+
+// ListDevicesResponse is a page of devices
+type ListDevicesResponse struct {
+	Devices    []DeviceResponse `json:"devices"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	TotalCount int64            `json:"total_count"`
+}
+
+// deviceStatuses are the values accepted by ?status on device listing
+var deviceStatuses = map[string]bool{
+	service.DeviceStatusActive:         true,
+	service.DeviceStatusSuspended:      true,
+	service.DeviceStatusDecommissioned: true,
+}
+
+// deviceSortFields are the fields accepted by ?sort on device listing
+var deviceSortFields = map[string]bool{
+	"created_at":    true,
+	"last_seen_at":  true,
+	"agent_version": true,
+	"platform":      true,
+	"status":        true,
+}
+
+// ListDevices returns a page of devices.
+// Filters: status, site_tag, platform, agent_version, online (true/false),
+// last_seen_after, last_seen_before (RFC3339), group (device group ID) and
+// selector, a label selector such as "region=eu,tier in (gw,edge),!canary". Sorting: sort=<field> or
+// sort=-<field> for descending (default -created_at). Pagination: page_size
+// and the opaque cursor returned as next_cursor.
+func ListDevices(queries *generated.Queries, presence *service.PresenceService, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// TODO: Get organization ID from JWT auth
 		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
 
-		devices, err := queries.ListDevices(r.Context(), generated.ListDevicesParams{
+		query := r.URL.Query()
+
+		filters := generated.CountDevicesPageParams{
 			OrganizationID: orgID,
-			Limit:          100,
-			Offset:         0,
-		})
+			Status:         stringToText(strings.ToUpper(query.Get("status"))),
+			SiteTag:        stringToText(query.Get("site_tag")),
+			Platform:       stringToText(query.Get("platform")),
+			AgentVersion:   stringToText(query.Get("agent_version")),
+		}
+
+		if v := query.Get("online"); v != "" {
+			online, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "invalid online", http.StatusBadRequest)
+				return
+			}
+			filters.Online = pgtype.Bool{Bool: online, Valid: true}
+		}
+
+		if filters.Status.Valid && !deviceStatuses[filters.Status.String] {
+			http.Error(w, "invalid status", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if filters.LastSeenAfter, err = parseTimeParam(query.Get("last_seen_after")); err != nil {
+			http.Error(w, "invalid last_seen_after", http.StatusBadRequest)
+			return
+		}
+		if filters.LastSeenBefore, err = parseTimeParam(query.Get("last_seen_before")); err != nil {
+			http.Error(w, "invalid last_seen_before", http.StatusBadRequest)
+			return
+		}
+
+		if v := query.Get("selector"); v != "" {
+			if filters.LabelSelector, _, err = encodeSelector(v); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		filters.GroupID, err = resolveDeviceGroup(r.Context(), queries, orgID, query.Get("group"))
+		if errors.Is(err, errInvalidDeviceGroup) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device group", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		sortBy, sortDesc := "created_at", true
+		if v := query.Get("sort"); v != "" {
+			sortDesc = strings.HasPrefix(v, "-")
+			sortBy = strings.TrimPrefix(v, "-")
+			if !deviceSortFields[sortBy] {
+				http.Error(w, "invalid sort", http.StatusBadRequest)
+				return
+			}
+		}
+
+		pageSize, err := parsePageSize(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		params := generated.ListDevicesPageParams{
+			SortBy:         sortBy,
+			OrganizationID: filters.OrganizationID,
+			Status:         filters.Status,
+			SiteTag:        filters.SiteTag,
+			Platform:       filters.Platform,
+			AgentVersion:   filters.AgentVersion,
+			Online:         filters.Online,
+			LastSeenAfter:  filters.LastSeenAfter,
+			LastSeenBefore: filters.LastSeenBefore,
+			LabelSelector:  filters.LabelSelector,
+			GroupID:        filters.GroupID,
+			SortDesc:       sortDesc,
+			// Fetch one extra row to know whether there is a next page
+			PageSize: int32(pageSize + 1),
+		}
+
+		if v := query.Get("cursor"); v != "" {
+			cursor, err := decodeCursor(v)
+			if err != nil || cursor.SortBy != sortBy || cursor.Desc != sortDesc {
+				http.Error(w, "invalid cursor", http.StatusBadRequest)
+				return
+			}
+			params.CursorKey = cursor.Key
+			params.CursorID = pgtype.UUID{Bytes: cursor.ID, Valid: true}
+		}
+
+		rows, err := queries.ListDevicesPage(r.Context(), params)
 		if err != nil {
 			logger.Error("failed to list devices", zap.Error(err))
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
 
+		total, err := queries.CountDevicesPage(r.Context(), filters)
+		if err != nil {
+			logger.Error("failed to count devices", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := ListDevicesResponse{
+			Devices:    make([]DeviceResponse, 0, len(rows)),
+			TotalCount: total,
+		}
+
+		if len(rows) > pageSize {
+			last := rows[pageSize-1]
+			resp.NextCursor = encodeCursor(pageCursor{
+				SortBy: sortBy,
+				Desc:   sortDesc,
+				Key:    last.SortKey,
+				ID:     last.ID,
+			})
+			rows = rows[:pageSize]
+		}
+
+		for _, row := range rows {
+			resp.Devices = append(resp.Devices, newDeviceResponse(deviceFromPageRow(row), presence))
+		}
+
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(devices)
+		json.NewEncoder(w).Encode(resp)
 	}
 }
 
-func GetDevice(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+// deviceFromPageRow drops the sort key from a listing row
+func deviceFromPageRow(row generated.ListDevicesPageRow) generated.Device {
+	return generated.Device{
+		ID:                 row.ID,
+		OrganizationID:     row.OrganizationID,
+		PublicKey:          row.PublicKey,
+		WireguardPublicKey: row.WireguardPublicKey,
+		WireguardIp:        row.WireguardIp,
+		AgentVersion:       row.AgentVersion,
+		Platform:           row.Platform,
+		SiteTag:            row.SiteTag,
+		Labels:             row.Labels,
+		ReportedLabels:     row.ReportedLabels,
+		Status:             row.Status,
+		LastSeenAt:         row.LastSeenAt,
+		CreatedAt:          row.CreatedAt,
+	}
+}
+
+// parseTimeParam parses an optional RFC3339 query parameter
+func parseTimeParam(v string) (pgtype.Timestamptz, error) {
+	if v == "" {
+		return pgtype.Timestamptz{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return pgtype.Timestamptz{}, err
+	}
+
+	return pgtype.Timestamptz{Time: t, Valid: true}, nil
+}
+
+func GetDevice(queries *generated.Queries, presence *service.PresenceService, configs *service.ConfigService, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		deviceID, err := uuid.Parse(chi.URLParam(r, "id"))
 		if err != nil {
@@ -47,12 +270,34 @@ func GetDevice(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc
 			return
 		}
 
+		groups, err := queries.ListDeviceGroupsForDevice(r.Context(), device.ID)
+		if err != nil {
+			logger.Error("failed to list device groups", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := newDeviceResponse(device, presence)
+		resp.Groups = make([]DeviceGroupRef, len(groups))
+		for i, g := range groups {
+			resp.Groups[i] = DeviceGroupRef{ID: g.ID, Name: g.Name}
+		}
+
+		config, err := configs.State(r.Context(), device.ID)
+		if err != nil {
+			logger.Error("failed to get device config state", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		resp.Config = &config
+
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(device)
+		json.NewEncoder(w).Encode(resp)
 	}
 }
 
-func SuspendDevice(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+// ListDeviceConnectionEvents returns a device's recent connect/disconnect history (?limit, default 100)
+func ListDeviceConnectionEvents(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		deviceID, err := uuid.Parse(chi.URLParam(r, "id"))
 		if err != nil {
@@ -60,22 +305,32 @@ func SuspendDevice(queries *generated.Queries, logger *zap.Logger) http.HandlerF
 			return
 		}
 
-		device, err := queries.UpdateDeviceStatus(r.Context(), generated.UpdateDeviceStatusParams{
-			ID:     deviceID,
-			Status: "SUSPENDED",
+		limit := 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			limit, err = strconv.Atoi(v)
+			if err != nil || limit < 1 || limit > 1000 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		events, err := queries.ListDeviceConnectionEvents(r.Context(), generated.ListDeviceConnectionEventsParams{
+			DeviceID: deviceID,
+			Limit:    int32(limit),
 		})
 		if err != nil {
-			logger.Error("failed to suspend device", zap.Error(err))
+			logger.Error("failed to list connection events", zap.Error(err))
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(device)
+		json.NewEncoder(w).Encode(events)
 	}
 }
 
-func ReactivateDevice(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+// SetDeviceLabels replaces the operator labels of a device
+func SetDeviceLabels(queries *generated.Queries, presence *service.PresenceService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		deviceID, err := uuid.Parse(chi.URLParam(r, "id"))
 		if err != nil {
@@ -83,17 +338,119 @@ func ReactivateDevice(queries *generated.Queries, logger *zap.Logger) http.Handl
 			return
 		}
 
-		device, err := queries.UpdateDeviceStatus(r.Context(), generated.UpdateDeviceStatusParams{
+		var req SetDeviceLabelsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		if req.Labels == nil {
+			req.Labels = labels.Set{}
+		}
+		if err := req.Labels.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		before, err := queries.GetDevice(r.Context(), deviceID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(req.Labels)
+		if err != nil {
+			logger.Error("failed to encode labels", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		device, err := queries.UpdateDeviceLabels(r.Context(), generated.UpdateDeviceLabelsParams{
 			ID:     deviceID,
-			Status: "ACTIVE",
+			Labels: data,
 		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
 		if err != nil {
-			logger.Error("failed to reactivate device", zap.Error(err))
+			logger.Error("failed to update device labels", zap.Error(err))
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
 
+		entry := auditEntry(r, device.OrganizationID, service.AuditDeviceLabelsUpdated, "device", device.ID.String(), "update")
+		entry.Metadata = map[string]any{"changes": service.AuditDiff(decodeLabels(before.Labels), req.Labels)}
+		audit.Record(r.Context(), entry)
+
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(device)
+		json.NewEncoder(w).Encode(newDeviceResponse(device, presence))
 	}
 }
+
+// SuspendDevice cuts a device off: its stream is closed, its tunnel peer
+// removed, its access sessions terminated and it is skipped by rollouts until
+// it is reactivated
+func SuspendDevice(queries *generated.Queries, lifecycle *service.DeviceLifecycle, presence *service.PresenceService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return deviceStatusChange(queries, lifecycle.Suspend, presence, audit, service.AuditDeviceSuspended, "suspend", logger)
+}
+
+// ReactivateDevice lets a suspended device reconnect and restores its tunnel
+// peer and rollout participation
+func ReactivateDevice(queries *generated.Queries, lifecycle *service.DeviceLifecycle, presence *service.PresenceService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return deviceStatusChange(queries, lifecycle.Reactivate, presence, audit, service.AuditDeviceReactivated, "reactivate", logger)
+}
+
+// deviceStatusChange serves an endpoint applying a lifecycle transition to the {id} device
+func deviceStatusChange(queries *generated.Queries, apply func(context.Context, generated.Device) (generated.Device, error), presence *service.PresenceService, audit *service.AuditRecorder, eventType, action string, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid device ID", http.StatusBadRequest)
+			return
+		}
+
+		device, err := queries.GetDevice(r.Context(), deviceID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		updated, err := apply(r.Context(), device)
+		if errors.Is(err, service.ErrDeviceDecommissioned) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to "+action+" device", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, device.OrganizationID, eventType, "device", device.ID.String(), action)
+		entry.Metadata = map[string]any{"changes": service.AuditDiff(
+			map[string]string{"status": device.Status},
+			map[string]string{"status": updated.Status},
+		)}
+		audit.Record(r.Context(), entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newDeviceResponse(updated, presence))
+	}
+}
+
+// DecommissionDevice permanently retires a device, revoking its keys, tunnel
+// peer and WireGuard IP lease. It can only return through an approved
+// re-enrollment.
+func DecommissionDevice(queries *generated.Queries, lifecycle *service.DeviceLifecycle, presence *service.PresenceService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return deviceStatusChange(queries, lifecycle.Decommission, presence, audit, service.AuditDeviceDecommissioned, "decommission", logger)
+}
@@ -5,15 +5,21 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"net"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 	"go.uber.org/zap"
 
 	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+	"github.com/netf/safeedge/pkg/crypto"
 )
 
 type CreateEnrollmentTokenRequest struct {
@@ -30,7 +36,7 @@ type CreateEnrollmentTokenResponse struct {
 	MaxUses   int       `json:"max_uses"`
 }
 
-func CreateEnrollmentToken(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+func CreateEnrollmentToken(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreateEnrollmentTokenRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -78,6 +84,14 @@ func CreateEnrollmentToken(queries *generated.Queries, logger *zap.Logger) http.
 			zap.String("organization_id", orgID.String()),
 		)
 
+		entry := auditEntry(r, orgID, service.AuditEnrollmentTokenCreated, "enrollment_token", enrollmentToken.ID.String(), "create")
+		entry.Metadata = map[string]any{
+			"site_tag":   req.SiteTag,
+			"expires_at": enrollmentToken.ExpiresAt,
+			"max_uses":   enrollmentToken.MaxUses,
+		}
+		audit.Record(r.Context(), entry)
+
 		resp := CreateEnrollmentTokenResponse{
 			ID:        enrollmentToken.ID.String(),
 			Token:     token, // Return unhashed token only once
@@ -91,6 +105,93 @@ func CreateEnrollmentToken(queries *generated.Queries, logger *zap.Logger) http.
 	}
 }
 
+// EnrollmentTokenResponse is an enrollment token without its hash
+type EnrollmentTokenResponse struct {
+	generated.EnrollmentToken
+	TokenHash string `json:"token_hash,omitempty"`
+}
+
+// ListEnrollmentTokens lists enrollment tokens, newest first, including
+// expired, used up and revoked ones. Pagination: page_size and offset.
+func ListEnrollmentTokens(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		pageSize, err := parsePageSize(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var offset int
+		if v := r.URL.Query().Get("offset"); v != "" {
+			offset, err = strconv.Atoi(v)
+			if err != nil || offset < 0 {
+				http.Error(w, "invalid offset", http.StatusBadRequest)
+				return
+			}
+		}
+
+		tokens, err := queries.ListEnrollmentTokens(r.Context(), generated.ListEnrollmentTokensParams{
+			OrganizationID: orgID,
+			Limit:          int32(pageSize),
+			Offset:         int32(offset),
+		})
+		if err != nil {
+			logger.Error("failed to list enrollment tokens", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := make([]EnrollmentTokenResponse, len(tokens))
+		for i, token := range tokens {
+			resp[i] = EnrollmentTokenResponse{EnrollmentToken: token}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// RevokeEnrollmentToken stops a token from enrolling further devices.
+// Devices already enrolled with it are unaffected.
+func RevokeEnrollmentToken(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		tokenID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid enrollment token ID", http.StatusBadRequest)
+			return
+		}
+
+		token, err := queries.RevokeEnrollmentToken(r.Context(), generated.RevokeEnrollmentTokenParams{
+			ID:             tokenID,
+			OrganizationID: orgID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to revoke enrollment token", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("enrollment token revoked", zap.String("token_id", token.ID.String()))
+
+		entry := auditEntry(r, orgID, service.AuditEnrollmentTokenRevoked, "enrollment_token", token.ID.String(), "revoke")
+		entry.Metadata = map[string]any{"used_count": token.UsedCount}
+		audit.Record(r.Context(), entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EnrollmentTokenResponse{EnrollmentToken: token})
+	}
+}
+
 type EnrollDeviceRequest struct {
 	Token              string `json:"token"`
 	PublicKey          string `json:"public_key"`
@@ -98,15 +199,22 @@ type EnrollDeviceRequest struct {
 	Platform           string `json:"platform"`
 	AgentVersion       string `json:"agent_version"`
 	SiteTag            string `json:"site_tag,omitempty"`
+	// DeviceID re-enrolls an existing device with new keys instead of
+	// creating one. The request waits for operator approval.
+	DeviceID string `json:"device_id,omitempty"`
 }
 
 type EnrollDeviceResponse struct {
-	DeviceID    string `json:"device_id"`
-	WireguardIP string `json:"wireguard_ip"`
-	Status      string `json:"status"`
+	DeviceID       string `json:"device_id"`
+	WireguardIP    string `json:"wireguard_ip,omitempty"`
+	Status         string `json:"status"`
+	ReenrollmentID string `json:"reenrollment_id,omitempty"`
 }
 
-func EnrollDevice(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+// EnrollDevice enrolls a device with an enrollment token. With device_id set
+// it instead requests re-enrollment of that device, answering 202 with a
+// re-enrollment the agent polls until an operator decides it.
+func EnrollDevice(queries *generated.Queries, lifecycle *service.DeviceLifecycle, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req EnrollDeviceRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -115,6 +223,15 @@ func EnrollDevice(queries *generated.Queries, logger *zap.Logger) http.HandlerFu
 			return
 		}
 
+		if _, err := crypto.ParseEd25519PublicKey(req.PublicKey); err != nil {
+			http.Error(w, "invalid public_key", http.StatusBadRequest)
+			return
+		}
+		if _, err := crypto.ParseWireGuardPublicKey(req.WireguardPublicKey); err != nil {
+			http.Error(w, "invalid wireguard_public_key", http.StatusBadRequest)
+			return
+		}
+
 		// Hash the provided token
 		hash := sha256.Sum256([]byte(req.Token))
 		tokenHash := hex.EncodeToString(hash[:])
@@ -127,6 +244,26 @@ func EnrollDevice(queries *generated.Queries, logger *zap.Logger) http.HandlerFu
 			return
 		}
 
+		var existing generated.Device
+		if req.DeviceID != "" {
+			deviceID, err := uuid.Parse(req.DeviceID)
+			if err != nil {
+				http.Error(w, "invalid device ID", http.StatusBadRequest)
+				return
+			}
+
+			existing, err = queries.GetDevice(r.Context(), deviceID)
+			if errors.Is(err, pgx.ErrNoRows) || (err == nil && existing.OrganizationID != enrollmentToken.OrganizationID) {
+				http.Error(w, "device not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				logger.Error("failed to get device", zap.Error(err))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+
 		// Increment token usage
 		if _, err := queries.IncrementTokenUsage(r.Context(), enrollmentToken.ID); err != nil {
 			logger.Error("failed to increment token usage", zap.Error(err))
@@ -134,33 +271,60 @@ func EnrollDevice(queries *generated.Queries, logger *zap.Logger) http.HandlerFu
 			return
 		}
 
-		// Allocate WireGuard IP from pool
-		// For M0, use simple sequential allocation
-		// In production, implement proper IPAM with IP pool management
-		deviceCount, err := queries.CountDevicesByStatus(r.Context(), generated.CountDevicesByStatusParams{
-			OrganizationID: enrollmentToken.OrganizationID,
-			Status:         "ACTIVE",
-		})
-		if err != nil {
-			logger.Error("failed to count devices", zap.Error(err))
-			deviceCount = 0
-		}
-
-		// Allocate IP: 10.100.0.x where x = deviceCount + 2 (skip .0 and .1)
-		wireguardIP := net.IPv4(10, 100, 0, byte(deviceCount+2))
-
-		// Create device
-		device, err := queries.CreateDevice(r.Context(), generated.CreateDeviceParams{
+		params := service.EnrollParams{
 			OrganizationID:     enrollmentToken.OrganizationID,
 			PublicKey:          req.PublicKey,
 			WireguardPublicKey: req.WireguardPublicKey,
-			WireguardIp:        wireguardIP,
-			AgentVersion:       req.AgentVersion,
 			Platform:           req.Platform,
-			SiteTag:            stringToText(req.SiteTag),
-		})
-		if err != nil {
-			logger.Error("failed to create device", zap.Error(err))
+			AgentVersion:       req.AgentVersion,
+			SiteTag:            req.SiteTag,
+		}
+
+		if req.DeviceID != "" {
+			reenrollment, err := lifecycle.RequestReenrollment(r.Context(), existing, params)
+			if errors.Is(err, service.ErrKeyRevoked) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				logger.Error("failed to request re-enrollment", zap.Error(err))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+
+			entry := deviceAuditEntry(r, existing, service.AuditDeviceReenrollmentRequested, "reenroll")
+			entry.Metadata = map[string]any{
+				"reenrollment_id": reenrollment.ID.String(),
+				"platform":        req.Platform,
+				"agent_version":   req.AgentVersion,
+			}
+			audit.Record(r.Context(), entry)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(EnrollDeviceResponse{
+				DeviceID:       existing.ID.String(),
+				Status:         reenrollment.Status,
+				ReenrollmentID: reenrollment.ID.String(),
+			})
+			return
+		}
+
+		device, err := lifecycle.Enroll(r.Context(), params)
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, service.ErrKeyRevoked):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case errors.Is(err, service.ErrSubnetExhausted):
+			logger.Error("WireGuard subnet exhausted")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation:
+			http.Error(w, "device keys already enrolled", http.StatusConflict)
+			return
+		case err != nil:
+			logger.Error("failed to enroll device", zap.Error(err))
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
 		}
@@ -170,9 +334,18 @@ func EnrollDevice(queries *generated.Queries, logger *zap.Logger) http.HandlerFu
 			zap.String("platform", device.Platform),
 		)
 
+		entry := deviceAuditEntry(r, device, service.AuditDeviceEnrolled, "enroll")
+		entry.Metadata = map[string]any{
+			"enrollment_token_id": enrollmentToken.ID.String(),
+			"platform":            device.Platform,
+			"agent_version":       device.AgentVersion,
+			"wireguard_ip":        device.WireguardIp.String(),
+		}
+		audit.Record(r.Context(), entry)
+
 		resp := EnrollDeviceResponse{
 			DeviceID:    device.ID.String(),
-			WireguardIP: wireguardIP.String(),
+			WireguardIP: device.WireguardIp.String(),
 			Status:      device.Status,
 		}
 
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/service"
+)
+
+const (
+	eventStreamBuffer    = 256
+	eventStreamKeepalive = 15 * time.Second
+)
+
+// eventFilter selects the events sent to a stream subscriber
+type eventFilter struct {
+	organizationID uuid.UUID
+	types          []string
+	resourceType   string
+	resourceID     string
+}
+
+// parseEventFilter reads ?types (comma-separated, "device.*" matches a
+// prefix), ?resource_type and ?resource_id
+func parseEventFilter(r *http.Request, orgID uuid.UUID) eventFilter {
+	query := r.URL.Query()
+
+	filter := eventFilter{
+		organizationID: orgID,
+		resourceType:   query.Get("resource_type"),
+		resourceID:     query.Get("resource_id"),
+	}
+	for _, t := range strings.Split(query.Get("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter.types = append(filter.types, t)
+		}
+	}
+
+	return filter
+}
+
+func (f eventFilter) matches(event service.Event) bool {
+	if event.OrganizationID != f.organizationID {
+		return false
+	}
+	if f.resourceType != "" && event.ResourceType != f.resourceType {
+		return false
+	}
+	if f.resourceID != "" && event.ResourceID != f.resourceID {
+		return false
+	}
+	if len(f.types) == 0 {
+		return true
+	}
+	for _, t := range f.types {
+		if prefix, ok := strings.CutSuffix(t, "*"); ok && strings.HasPrefix(event.Type, prefix) {
+			return true
+		}
+		if event.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamEvents streams live fleet events as server-sent events: device
+// presence changes, rollout state changes and per-device update status.
+// Events can be filtered by types, resource_type and resource_id. Only
+// events published after the client connects are sent; a comment is sent
+// every 15s to keep idle connections open.
+func StreamEvents(events *service.EventBus, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		filter := parseEventFilter(r, orgID)
+
+		// The stream outlives the server's read and write timeouts
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+
+		sub, unsubscribe := events.Subscribe(eventStreamBuffer)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(w, ": connected\n\n")
+		if err := rc.Flush(); err != nil {
+			logger.Error("event stream does not support flushing", zap.Error(err))
+			return
+		}
+
+		keepalive := time.NewTicker(eventStreamKeepalive)
+		defer keepalive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+
+			case <-keepalive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+
+			case event, ok := <-sub:
+				if !ok {
+					return
+				}
+				if !filter.matches(event) {
+					continue
+				}
+
+				data, err := json.Marshal(event)
+				if err != nil {
+					logger.Error("failed to encode event", zap.Error(err))
+					continue
+				}
+				fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			}
+
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+)
+
+const (
+	defaultLogLimit = 1000
+	maxLogLimit     = 10000
+
+	// logCollectTimeout bounds how long a request waits for a device to
+	// answer before returning what has arrived
+	logCollectTimeout = 20 * time.Second
+)
+
+// Where a logs response came from
+const (
+	logsFromDevice = "device"
+	logsFromStored = "stored"
+)
+
+// DeviceLogsResponse is a device's log entries, oldest first
+type DeviceLogsResponse struct {
+	DeviceID string             `json:"device_id"`
+	From     string             `json:"from"` // device, stored
+	Entries  []service.LogEntry `json:"entries"`
+	// Truncated is set when older entries in range were left out
+	Truncated bool     `json:"truncated"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// DeviceLogLine is a line of a followed log stream: an entry, or an error
+// reading one of the device's sources
+type DeviceLogLine struct {
+	*service.LogEntry
+	Error string `json:"error,omitempty"`
+}
+
+// GetDeviceLogs returns a device's log entries between since and until,
+// each RFC 3339 or a duration ago such as 1h, from the sources listed in
+// source (comma-separated, all by default), at most limit of the most
+// recent. Connected devices are asked directly unless stored=true;
+// otherwise the entries the device shipped are returned. With follow=true
+// the entries are streamed as newline-delimited JSON and new ones follow as
+// the device writes them, until the client disconnects.
+func GetDeviceLogs(queries *generated.Queries, logs *service.LogService, collector service.LogCollector, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid device ID", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		now := time.Now().UTC()
+
+		since, err := parseLogTime(query.Get("since"), now)
+		if err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+		until, err := parseLogTime(query.Get("until"), now)
+		if err != nil {
+			http.Error(w, "invalid until", http.StatusBadRequest)
+			return
+		}
+		if !since.IsZero() && !until.IsZero() && !since.Before(until) {
+			http.Error(w, "since must be before until", http.StatusBadRequest)
+			return
+		}
+
+		limit := defaultLogLimit
+		if v := query.Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxLogLimit {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxLogLimit), http.StatusBadRequest)
+				return
+			}
+		}
+
+		var sources []string
+		if v := query.Get("source"); v != "" {
+			sources = strings.Split(v, ",")
+		}
+
+		follow := query.Get("follow") == "true"
+		stored := query.Get("stored") == "true"
+		if follow && (stored || !until.IsZero()) {
+			http.Error(w, "follow cannot be combined with stored or until", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := queries.GetDevice(r.Context(), deviceID); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			logger.Error("failed to get device", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		req := &pb.LogRequest{
+			Sources:    sources,
+			MaxEntries: int32(limit),
+			Follow:     follow,
+		}
+		if !since.IsZero() {
+			req.Since = timestamppb.New(since)
+		}
+		if !until.IsZero() {
+			req.Until = timestamppb.New(until)
+		}
+
+		if follow {
+			followDeviceLogs(w, r, deviceID, collector, req, logger)
+			return
+		}
+
+		if !stored {
+			resp, err := collectDeviceLogs(r.Context(), deviceID, collector, req)
+			if err == nil {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(resp)
+				return
+			}
+			if !errors.Is(err, service.ErrDeviceNotConnected) {
+				logger.Error("failed to collect device logs", zap.Error(err))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if until.IsZero() {
+			until = now
+		}
+		entries, err := logs.List(r.Context(), deviceID, service.LogQuery{
+			Since:   since,
+			Until:   until,
+			Sources: sources,
+			Limit:   int32(limit),
+		})
+		if err != nil {
+			logger.Error("failed to list device logs", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DeviceLogsResponse{
+			DeviceID:  deviceID.String(),
+			From:      logsFromStored,
+			Entries:   entries,
+			Truncated: len(entries) == limit,
+		})
+	}
+}
+
+// collectDeviceLogs asks a connected device for its logs, returning what
+// has arrived if it does not finish answering in time
+func collectDeviceLogs(ctx context.Context, deviceID uuid.UUID, collector service.LogCollector, req *pb.LogRequest) (*DeviceLogsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, logCollectTimeout)
+	defer cancel()
+
+	batches, err := collector.CollectLogs(ctx, deviceID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &DeviceLogsResponse{
+		DeviceID: deviceID.String(),
+		From:     logsFromDevice,
+		Entries:  []service.LogEntry{},
+	}
+	done := false
+	for batch := range batches {
+		for _, entry := range batch.Entries {
+			resp.Entries = append(resp.Entries, service.LogEntryFromProto(entry))
+		}
+		if batch.Error != "" {
+			resp.Errors = append(resp.Errors, batch.Error)
+		}
+		resp.Truncated = resp.Truncated || batch.Truncated
+		done = done || batch.Done
+	}
+
+	if !done {
+		resp.Errors = append(resp.Errors, "device did not finish sending its logs")
+		resp.Truncated = true
+	}
+	return resp, nil
+}
+
+// followDeviceLogs streams a connected device's log entries as they arrive
+func followDeviceLogs(w http.ResponseWriter, r *http.Request, deviceID uuid.UUID, collector service.LogCollector, req *pb.LogRequest, logger *zap.Logger) {
+	batches, err := collector.CollectLogs(r.Context(), deviceID, req)
+	if errors.Is(err, service.ErrDeviceNotConnected) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.Error("failed to follow device logs", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	// The stream outlives the server's read and write timeouts
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	for batch := range batches {
+		for _, entry := range batch.Entries {
+			e := service.LogEntryFromProto(entry)
+			if err := encoder.Encode(DeviceLogLine{LogEntry: &e}); err != nil {
+				return
+			}
+		}
+		if batch.Error != "" {
+			if err := encoder.Encode(DeviceLogLine{Error: batch.Error}); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// parseLogTime parses an RFC 3339 time or a duration before now, returning
+// the zero time for an empty value
+func parseLogTime(v string, now time.Time) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
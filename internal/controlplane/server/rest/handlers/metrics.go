@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/service"
+)
+
+// defaultMetricsPoints is the number of points returned when no step is given
+const defaultMetricsPoints = 300
+
+// GetDeviceMetrics returns a device's metrics series.
+// Query parameters: from, to (RFC3339, default last hour) and step (Go duration, e.g. 5m).
+func GetDeviceMetrics(metrics *service.MetricsService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid device ID", http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+
+		to := time.Now().UTC()
+		if v := query.Get("to"); v != "" {
+			if to, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "invalid to", http.StatusBadRequest)
+				return
+			}
+		}
+
+		from := to.Add(-time.Hour)
+		if v := query.Get("from"); v != "" {
+			if from, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "invalid from", http.StatusBadRequest)
+				return
+			}
+		}
+
+		step := (to.Sub(from) / defaultMetricsPoints).Truncate(time.Minute)
+		if step < time.Minute {
+			step = time.Minute
+		}
+		if v := query.Get("step"); v != "" {
+			if step, err = time.ParseDuration(v); err != nil {
+				http.Error(w, "invalid step", http.StatusBadRequest)
+				return
+			}
+		}
+
+		series, err := metrics.Series(r.Context(), deviceID, from, to, step)
+		if errors.Is(err, service.ErrInvalidMetricsQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device metrics", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(series)
+	}
+}
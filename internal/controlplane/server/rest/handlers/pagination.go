@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// pageCursor is the decoded form of an opaque pagination cursor. It records
+// the sort it was issued for so it cannot be replayed against another sort.
+type pageCursor struct {
+	SortBy string    `json:"s"`
+	Desc   bool      `json:"d"`
+	Key    string    `json:"k"`
+	ID     uuid.UUID `json:"i"`
+}
+
+// encodeCursor returns the opaque string form of a cursor
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor produced by encodeCursor
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("malformed cursor")
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("malformed cursor")
+	}
+
+	return c, nil
+}
+
+// parsePageSize reads ?page_size, defaulting to defaultPageSize
+func parsePageSize(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("page_size")
+	if v == "" {
+		return defaultPageSize, nil
+	}
+
+	size, err := strconv.Atoi(v)
+	if err != nil || size < 1 || size > maxPageSize {
+		return 0, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+	}
+
+	return size, nil
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+)
+
+// ReenrollmentResponse is a re-enrollment request. Once approved it carries
+// the WireGuard IP the device should use.
+type ReenrollmentResponse struct {
+	generated.DeviceReenrollment
+	WireguardIP string `json:"wireguard_ip,omitempty"`
+}
+
+// reenrollmentStatuses are the values accepted by ?status on re-enrollment listing
+var reenrollmentStatuses = map[string]bool{
+	service.ReenrollmentPending:  true,
+	service.ReenrollmentApproved: true,
+	service.ReenrollmentRejected: true,
+}
+
+func ListReenrollments(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		var status pgtype.Text
+		if v := r.URL.Query().Get("status"); v != "" {
+			if !reenrollmentStatuses[v] {
+				http.Error(w, "invalid status", http.StatusBadRequest)
+				return
+			}
+			status = pgtype.Text{String: v, Valid: true}
+		}
+
+		reenrollments, err := queries.ListDeviceReenrollments(r.Context(), generated.ListDeviceReenrollmentsParams{
+			OrganizationID: orgID,
+			Status:         status,
+		})
+		if err != nil {
+			logger.Error("failed to list re-enrollments", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := make([]ReenrollmentResponse, len(reenrollments))
+		for i, reenrollment := range reenrollments {
+			resp[i] = ReenrollmentResponse{DeviceReenrollment: reenrollment}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// GetReenrollment returns a re-enrollment request. Agents poll it after
+// requesting re-enrollment to learn the operator's decision.
+func GetReenrollment(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reenrollmentID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid re-enrollment ID", http.StatusBadRequest)
+			return
+		}
+
+		reenrollment, err := queries.GetDeviceReenrollment(r.Context(), reenrollmentID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get re-enrollment", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := ReenrollmentResponse{DeviceReenrollment: reenrollment}
+
+		// The device only holds the new keys once this request was applied
+		if reenrollment.Status == service.ReenrollmentApproved {
+			device, err := queries.GetDevice(r.Context(), reenrollment.DeviceID)
+			if err != nil {
+				logger.Error("failed to get device", zap.Error(err))
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			if device.PublicKey == reenrollment.PublicKey {
+				resp.WireguardIP = device.WireguardIp.String()
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// ApproveReenrollment binds a re-enrollment's keys to its device, revoking
+// the old keys and reactivating the device
+func ApproveReenrollment(queries *generated.Queries, lifecycle *service.DeviceLifecycle, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		reenrollmentID, ok := loadReenrollmentID(w, r, queries, orgID, logger)
+		if !ok {
+			return
+		}
+
+		reenrollment, device, err := lifecycle.ApproveReenrollment(r.Context(), reenrollmentID)
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, service.ErrReenrollmentNotPending):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, service.ErrSubnetExhausted):
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		case errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation:
+			http.Error(w, "keys are already enrolled on another device", http.StatusConflict)
+			return
+		case err != nil:
+			logger.Error("failed to approve re-enrollment", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, orgID, service.AuditDeviceReenrollmentApproved, "device", device.ID.String(), "approve_reenrollment")
+		entry.Metadata = map[string]any{
+			"reenrollment_id": reenrollment.ID.String(),
+			"wireguard_ip":    device.WireguardIp.String(),
+		}
+		audit.Record(r.Context(), entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ReenrollmentResponse{
+			DeviceReenrollment: reenrollment,
+			WireguardIP:        device.WireguardIp.String(),
+		})
+	}
+}
+
+func RejectReenrollment(queries *generated.Queries, lifecycle *service.DeviceLifecycle, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		reenrollmentID, ok := loadReenrollmentID(w, r, queries, orgID, logger)
+		if !ok {
+			return
+		}
+
+		reenrollment, err := lifecycle.RejectReenrollment(r.Context(), reenrollmentID)
+		if errors.Is(err, service.ErrReenrollmentNotPending) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to reject re-enrollment", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, orgID, service.AuditDeviceReenrollmentRejected, "device", reenrollment.DeviceID.String(), "reject_reenrollment")
+		entry.Metadata = map[string]any{"reenrollment_id": reenrollment.ID.String()}
+		audit.Record(r.Context(), entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ReenrollmentResponse{DeviceReenrollment: reenrollment})
+	}
+}
+
+// loadReenrollmentID parses the {id} URL parameter and checks the
+// re-enrollment belongs to orgID, writing an error response if not
+func loadReenrollmentID(w http.ResponseWriter, r *http.Request, queries *generated.Queries, orgID uuid.UUID, logger *zap.Logger) (uuid.UUID, bool) {
+	reenrollmentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid re-enrollment ID", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+
+	reenrollment, err := queries.GetDeviceReenrollment(r.Context(), reenrollmentID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && reenrollment.OrganizationID != orgID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return uuid.Nil, false
+	}
+	if err != nil {
+		logger.Error("failed to get re-enrollment", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return uuid.Nil, false
+	}
+
+	return reenrollment.ID, true
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+	"github.com/netf/safeedge/pkg/labels"
+)
+
+const (
+	defaultCanaryPercent   = 10
+	defaultSoakTimeSeconds = 300
+)
+
+type CreateRolloutRequest struct {
+	ArtifactID      string `json:"artifact_id"`
+	TargetSelector  string `json:"target_selector"`
+	TargetGroupID   string `json:"target_group_id,omitempty"`
+	CanaryPercent   *int32 `json:"canary_percent,omitempty"`
+	SoakTimeSeconds *int32 `json:"soak_time_seconds,omitempty"`
+	HealthCheckURL  string `json:"health_check_url"`
+}
+
+// RolloutResponse is a rollout with its target selector in text form and
+// the number of active devices it currently targets
+type RolloutResponse struct {
+	generated.Rollout
+	TargetSelector    string `json:"target_selector"`
+	TargetDeviceCount int64  `json:"target_device_count"`
+}
+
+func newRolloutResponse(ctx context.Context, queries *generated.Queries, rollout generated.Rollout) (RolloutResponse, error) {
+	sel, err := labels.SelectorFromJSON(rollout.TargetSelector)
+	if err != nil {
+		return RolloutResponse{}, err
+	}
+
+	count, err := queries.CountRolloutTargets(ctx, generated.CountRolloutTargetsParams{
+		OrganizationID: rollout.OrganizationID,
+		Selector:       rollout.TargetSelector,
+		GroupID:        rollout.TargetGroupID,
+	})
+	if err != nil {
+		return RolloutResponse{}, err
+	}
+
+	return RolloutResponse{
+		Rollout:           rollout,
+		TargetSelector:    sel.String(),
+		TargetDeviceCount: count,
+	}, nil
+}
+
+// CreateRollout creates a DRAFT rollout of an artifact to the active devices
+// matching target_selector, a label selector such as "region=eu,!canary",
+// and belonging to target_group_id if given. An empty selector matches every
+// active device.
+func CreateRollout(queries *generated.Queries, events *service.EventBus, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		var req CreateRolloutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		artifactID, err := uuid.Parse(req.ArtifactID)
+		if err != nil {
+			http.Error(w, "invalid artifact ID", http.StatusBadRequest)
+			return
+		}
+
+		if req.HealthCheckURL == "" {
+			http.Error(w, "health_check_url is required", http.StatusBadRequest)
+			return
+		}
+
+		canaryPercent := int32(defaultCanaryPercent)
+		if req.CanaryPercent != nil {
+			canaryPercent = *req.CanaryPercent
+		}
+		if canaryPercent < 0 || canaryPercent > 100 {
+			http.Error(w, "canary_percent must be between 0 and 100", http.StatusBadRequest)
+			return
+		}
+
+		soakTime := int32(defaultSoakTimeSeconds)
+		if req.SoakTimeSeconds != nil {
+			soakTime = *req.SoakTimeSeconds
+		}
+		if soakTime < 0 {
+			http.Error(w, "soak_time_seconds must not be negative", http.StatusBadRequest)
+			return
+		}
+
+		selector, sel, err := encodeSelector(req.TargetSelector)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		targetGroupID, err := resolveDeviceGroup(r.Context(), queries, orgID, req.TargetGroupID)
+		if errors.Is(err, errInvalidDeviceGroup) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device group", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		artifact, err := queries.GetArtifact(r.Context(), artifactID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && artifact.OrganizationID != orgID) {
+			http.Error(w, "artifact not found", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get artifact", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		rollout, err := queries.CreateRollout(r.Context(), generated.CreateRolloutParams{
+			OrganizationID:  orgID,
+			ArtifactID:      artifact.ID,
+			TargetSelector:  selector,
+			TargetGroupID:   targetGroupID,
+			CanaryPercent:   canaryPercent,
+			SoakTimeSeconds: soakTime,
+			HealthCheckUrl:  req.HealthCheckURL,
+		})
+		if err != nil {
+			logger.Error("failed to create rollout", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("rollout created",
+			zap.String("rollout_id", rollout.ID.String()),
+			zap.String("artifact_id", artifact.ID.String()),
+			zap.String("target_selector", sel.String()),
+		)
+
+		entry := auditEntry(r, orgID, service.AuditRolloutCreated, "rollout", rollout.ID.String(), "create")
+		entry.Metadata = map[string]any{
+			"artifact_id":     artifact.ID.String(),
+			"target_selector": sel.String(),
+			"canary_percent":  rollout.CanaryPercent,
+		}
+		audit.Record(r.Context(), entry)
+
+		events.Publish(service.Event{
+			Type:           service.EventRolloutStateChanged,
+			OrganizationID: orgID,
+			ResourceType:   "rollout",
+			ResourceID:     rollout.ID.String(),
+			Data:           map[string]any{"state": rollout.State},
+		})
+
+		resp, err := newRolloutResponse(r.Context(), queries, rollout)
+		if err != nil {
+			logger.Error("failed to resolve rollout targets", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func GetRollout(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rolloutID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid rollout ID", http.StatusBadRequest)
+			return
+		}
+
+		rollout, err := queries.GetRollout(r.Context(), rolloutID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get rollout", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := newRolloutResponse(r.Context(), queries, rollout)
+		if err != nil {
+			logger.Error("failed to resolve rollout targets", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// StartRollout starts a DRAFT rollout: the active devices it matches now
+// become its targets and its canaries are sent the update
+func StartRollout(queries *generated.Queries, rollouts *service.RolloutService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return rolloutAction(queries, logger, func(r *http.Request, rollout generated.Rollout) (generated.Rollout, error) {
+		started, err := rollouts.Start(r.Context(), rollout)
+		if err != nil {
+			return started, err
+		}
+
+		entry := auditEntry(r, rollout.OrganizationID, service.AuditRolloutStarted, "rollout", rollout.ID.String(), "start")
+		entry.Metadata = map[string]any{"artifact_id": rollout.ArtifactID.String()}
+		audit.Record(r.Context(), entry)
+		return started, nil
+	})
+}
+
+// AbortRollout rolls back a running rollout, asking the devices it updated
+// to reinstate what it replaced, or fails a DRAFT one
+func AbortRollout(queries *generated.Queries, rollouts *service.RolloutService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return rolloutAction(queries, logger, func(r *http.Request, rollout generated.Rollout) (generated.Rollout, error) {
+		aborted, err := rollouts.Abort(r.Context(), rollout)
+		if err != nil {
+			return aborted, err
+		}
+
+		entry := auditEntry(r, rollout.OrganizationID, service.AuditRolloutAborted, "rollout", rollout.ID.String(), "abort")
+		entry.Metadata = map[string]any{"state": rollout.State}
+		audit.Record(r.Context(), entry)
+		return aborted, nil
+	})
+}
+
+// rolloutAction runs a state change on the rollout named by the request's
+// id and responds with the rollout as it leaves it
+func rolloutAction(queries *generated.Queries, logger *zap.Logger, action func(r *http.Request, rollout generated.Rollout) (generated.Rollout, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		rolloutID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid rollout ID", http.StatusBadRequest)
+			return
+		}
+
+		rollout, err := queries.GetRollout(r.Context(), rolloutID)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && rollout.OrganizationID != orgID) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get rollout", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		updated, err := action(r, rollout)
+		if errors.Is(err, service.ErrRolloutState) {
+			http.Error(w, "rollout is "+rollout.State, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to change rollout state", zap.String("rollout_id", rolloutID.String()), zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp, err := newRolloutResponse(r.Context(), queries, updated)
+		if err != nil {
+			logger.Error("failed to resolve rollout targets", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -1,65 +0,0 @@
-package handlers
-
-import (
-	"net/http"
-
-	"go.uber.org/zap"
-
-	"github.com/netf/safeedge/internal/controlplane/database/generated"
-)
-
-// Stub handlers - to be implemented later
-
-func CreateAccessSession(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "not implemented", http.StatusNotImplemented)
-	}
-}
-
-func TerminateAccessSession(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "not implemented", http.StatusNotImplemented)
-	}
-}
-
-func CreateArtifact(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "not implemented", http.StatusNotImplemented)
-	}
-}
-
-func GetArtifact(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "not implemented", http.StatusNotImplemented)
-	}
-}
-
-func CreateRollout(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "not implemented", http.StatusNotImplemented)
-	}
-}
-
-func GetRollout(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "not implemented", http.StatusNotImplemented)
-	}
-}
-
-func StartRollout(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "not implemented", http.StatusNotImplemented)
-	}
-}
-
-func AbortRollout(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "not implemented", http.StatusNotImplemented)
-	}
-}
-
-func ListAuditLogs(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "not implemented", http.StatusNotImplemented)
-	}
-}
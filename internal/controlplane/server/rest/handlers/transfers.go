@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+	"github.com/netf/safeedge/pkg/transfer"
+)
+
+type StartTransferRequest struct {
+	Direction  string `json:"direction"`
+	Path       string `json:"path"`
+	Size       int64  `json:"size,omitempty"`
+	Blake3Hash string `json:"blake3_hash,omitempty"`
+	Mode       int32  `json:"mode,omitempty"`
+}
+
+// StartTransfer starts copying a file to (UPLOAD) or from (DOWNLOAD) a
+// device. An upload gives the file's size, BLAKE3 hash and mode; a download
+// takes them from the device, which must allow the path to be read. Chunks
+// then move through the transfer's chunk endpoints over the agent's stream,
+// so no access session is needed.
+func StartTransfer(queries *generated.Queries, transfers *service.TransferService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid device ID", http.StatusBadRequest)
+			return
+		}
+
+		var req StartTransferRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		device, err := queries.GetDevice(r.Context(), deviceID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get device", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		if device.Status != service.DeviceStatusActive {
+			http.Error(w, "device is not active", http.StatusConflict)
+			return
+		}
+
+		t, err := transfers.Start(r.Context(), device, service.StartTransferParams{
+			Direction: req.Direction,
+			Path:      req.Path,
+			Size:      req.Size,
+			Hash:      req.Blake3Hash,
+			Mode:      req.Mode,
+		})
+		if err != nil {
+			writeTransferError(w, err, "failed to start file transfer", logger)
+			return
+		}
+
+		audit.Record(r.Context(), transferAuditEntry(r, t, service.AuditFileTransferStarted, "start_file_transfer"))
+
+		logger.Info("file transfer started",
+			zap.String("transfer_id", t.ID.String()),
+			zap.String("device_id", device.ID.String()),
+			zap.String("direction", t.Direction),
+			zap.String("path", t.Path),
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// GetTransfer returns a file transfer, whose transferred count is where an
+// upload resumes
+func GetTransfer(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := loadTransfer(w, r, queries, logger)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// PutTransferChunk sends a chunk of an upload to the device. The body is the
+// chunk's data and the X-Blake3-Hash header its hash. Every chunk but the
+// last is transfer.ChunkSize bytes, and chunks must be sent in order; one
+// sent again is accepted without being written twice.
+func PutTransferChunk(queries *generated.Queries, transfers *service.TransferService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := loadTransfer(w, r, queries, logger)
+		if !ok {
+			return
+		}
+		index, ok := chunkIndex(w, r)
+		if !ok {
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, transfer.ChunkSize))
+		if err != nil {
+			http.Error(w, "chunk is larger than the chunk size", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		t, err = transfers.WriteChunk(r.Context(), t, index, data, r.Header.Get(transfer.ChunkHashHeader))
+		if err != nil {
+			writeTransferError(w, err, "failed to write chunk", logger)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t)
+	}
+}
+
+// GetTransferChunk reads a chunk of a download from the device, with its
+// hash in the X-Blake3-Hash header
+func GetTransferChunk(queries *generated.Queries, transfers *service.TransferService, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := loadTransfer(w, r, queries, logger)
+		if !ok {
+			return
+		}
+		index, ok := chunkIndex(w, r)
+		if !ok {
+			return
+		}
+
+		data, hash, err := transfers.ReadChunk(r.Context(), t, index)
+		if err != nil {
+			writeTransferError(w, err, "failed to read chunk", logger)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set(transfer.ChunkHashHeader, hash)
+		w.Write(data)
+	}
+}
+
+// CompleteTransfer finishes a file transfer. The device checks an upload's
+// size and hash before moving it into place; the operator checks a
+// download's before completing it.
+func CompleteTransfer(queries *generated.Queries, transfers *service.TransferService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := loadTransfer(w, r, queries, logger)
+		if !ok {
+			return
+		}
+
+		completed, err := transfers.Complete(r.Context(), t)
+		if err != nil {
+			if !errors.Is(err, service.ErrInvalidTransfer) {
+				entry := transferAuditEntry(r, t, service.AuditFileTransferCompleted, "complete_file_transfer")
+				entry.Result = service.AuditFailure
+				entry.Metadata["error"] = err.Error()
+				audit.Record(r.Context(), entry)
+			}
+			writeTransferError(w, err, "failed to complete file transfer", logger)
+			return
+		}
+
+		audit.Record(r.Context(), transferAuditEntry(r, completed, service.AuditFileTransferCompleted, "complete_file_transfer"))
+
+		logger.Info("file transfer completed",
+			zap.String("transfer_id", completed.ID.String()),
+			zap.String("device_id", completed.DeviceID.String()),
+		)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(completed)
+	}
+}
+
+// AbortTransfer ends a file transfer, removing an upload's partial file
+// from the device
+func AbortTransfer(queries *generated.Queries, transfers *service.TransferService, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := loadTransfer(w, r, queries, logger)
+		if !ok {
+			return
+		}
+
+		aborted, err := transfers.Abort(r.Context(), t)
+		if err != nil {
+			writeTransferError(w, err, "failed to abort file transfer", logger)
+			return
+		}
+
+		audit.Record(r.Context(), transferAuditEntry(r, aborted, service.AuditFileTransferAborted, "abort_file_transfer"))
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// loadTransfer loads the transfer a request names, writing the error
+// response if it cannot
+func loadTransfer(w http.ResponseWriter, r *http.Request, queries *generated.Queries, logger *zap.Logger) (generated.FileTransfer, bool) {
+	// TODO: Get organization ID from JWT auth
+	orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+	transferID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid transfer ID", http.StatusBadRequest)
+		return generated.FileTransfer{}, false
+	}
+
+	t, err := queries.GetFileTransfer(r.Context(), transferID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && t.OrganizationID != orgID) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return generated.FileTransfer{}, false
+	}
+	if err != nil {
+		logger.Error("failed to get file transfer", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return generated.FileTransfer{}, false
+	}
+	return t, true
+}
+
+func chunkIndex(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	index, err := strconv.ParseInt(chi.URLParam(r, "index"), 10, 64)
+	if err != nil || index < 0 {
+		http.Error(w, "invalid chunk index", http.StatusBadRequest)
+		return 0, false
+	}
+	return index, true
+}
+
+// writeTransferError writes the response for a transfer service error
+func writeTransferError(w http.ResponseWriter, err error, msg string, logger *zap.Logger) {
+	switch {
+	case errors.Is(err, service.ErrInvalidTransfer):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrDeviceNotConnected):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, service.ErrFileRequestRefused):
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "timed out waiting for the device", http.StatusGatewayTimeout)
+	default:
+		logger.Error(msg, zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// transferAuditEntry audits an operator's action on a file transfer
+func transferAuditEntry(r *http.Request, t generated.FileTransfer, eventType, action string) service.AuditEntry {
+	entry := auditEntry(r, t.OrganizationID, eventType, "device", t.DeviceID.String(), action)
+	entry.Metadata = map[string]any{
+		"transfer_id": t.ID.String(),
+		"direction":   t.Direction,
+		"path":        t.Path,
+		"size":        t.Size,
+		"blake3_hash": t.Blake3Hash,
+	}
+	return entry
+}
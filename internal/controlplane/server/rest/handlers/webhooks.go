@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/internal/controlplane/service"
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+type CreateWebhookRequest struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+// WebhookResponse is a webhook without its signing secret
+type WebhookResponse struct {
+	generated.Webhook
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDeliveryResponse is a delivery with its payload decoded
+type WebhookDeliveryResponse struct {
+	generated.WebhookDelivery
+	Payload json.RawMessage `json:"payload"`
+}
+
+type ListWebhookDeliveriesResponse struct {
+	Deliveries []WebhookDeliveryResponse `json:"deliveries"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
+}
+
+// webhookDeliveryStatuses are the values accepted by ?status on delivery listing
+var webhookDeliveryStatuses = map[string]bool{
+	service.WebhookDeliveryPending:   true,
+	service.WebhookDeliverySucceeded: true,
+	service.WebhookDeliveryFailed:    true,
+}
+
+// CreateWebhook subscribes a URL to fleet events. Payloads are signed with
+// HMAC-SHA256 using the secret in the response.
+func CreateWebhook(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		var req CreateWebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if req.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "url must be an http or https URL", http.StatusBadRequest)
+			return
+		}
+
+		if len(req.EventTypes) == 0 {
+			http.Error(w, "event_types is required", http.StatusBadRequest)
+			return
+		}
+		for _, eventType := range req.EventTypes {
+			if !service.WebhookEventTypes[eventType] {
+				http.Error(w, "unknown event type: "+eventType, http.StatusBadRequest)
+				return
+			}
+		}
+
+		secret, err := crypto.GenerateWebhookSecret()
+		if err != nil {
+			logger.Error("failed to generate webhook secret", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		webhook, err := queries.CreateWebhook(r.Context(), generated.CreateWebhookParams{
+			OrganizationID: orgID,
+			Name:           req.Name,
+			Url:            req.URL,
+			Secret:         secret,
+			EventTypes:     req.EventTypes,
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+			http.Error(w, "webhook already exists", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to create webhook", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.Info("webhook created", zap.String("webhook_id", webhook.ID.String()))
+
+		entry := auditEntry(r, orgID, service.AuditWebhookCreated, "webhook", webhook.ID.String(), "create")
+		entry.Metadata = map[string]any{
+			"name":        webhook.Name,
+			"url":         webhook.Url,
+			"event_types": webhook.EventTypes,
+		}
+		audit.Record(r.Context(), entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		// The secret is only ever returned here
+		json.NewEncoder(w).Encode(webhook)
+	}
+}
+
+func ListWebhooks(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		webhooks, err := queries.ListWebhooks(r.Context(), orgID)
+		if err != nil {
+			logger.Error("failed to list webhooks", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := make([]WebhookResponse, len(webhooks))
+		for i, webhook := range webhooks {
+			resp[i] = WebhookResponse{Webhook: webhook}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func GetWebhook(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhook, ok := loadWebhook(w, r, queries, logger)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(WebhookResponse{Webhook: webhook})
+	}
+}
+
+func DeleteWebhook(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// TODO: Get organization ID from JWT auth
+		orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+		webhookID, err := uuid.Parse(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "invalid webhook ID", http.StatusBadRequest)
+			return
+		}
+
+		webhook, err := queries.DeleteWebhook(r.Context(), generated.DeleteWebhookParams{
+			ID:             webhookID,
+			OrganizationID: orgID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to delete webhook", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, orgID, service.AuditWebhookDeleted, "webhook", webhook.ID.String(), "delete")
+		entry.Metadata = map[string]any{"name": webhook.Name, "url": webhook.Url}
+		audit.Record(r.Context(), entry)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListWebhookDeliveries lists a webhook's deliveries, newest first, optionally
+// filtered by status. Pagination: page_size and the opaque cursor returned
+// as next_cursor.
+func ListWebhookDeliveries(queries *generated.Queries, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhook, ok := loadWebhook(w, r, queries, logger)
+		if !ok {
+			return
+		}
+
+		query := r.URL.Query()
+
+		pageSize, err := parsePageSize(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		params := generated.ListWebhookDeliveriesParams{
+			WebhookID: webhook.ID,
+			PageSize:  int32(pageSize + 1),
+		}
+
+		if v := query.Get("status"); v != "" {
+			if !webhookDeliveryStatuses[v] {
+				http.Error(w, "invalid status", http.StatusBadRequest)
+				return
+			}
+			params.Status = stringToText(v)
+		}
+
+		if v := query.Get("cursor"); v != "" {
+			cursor, err := decodeCursor(v)
+			if err != nil || cursor.SortBy != "created_at" {
+				http.Error(w, "invalid cursor", http.StatusBadRequest)
+				return
+			}
+			t, err := time.Parse(time.RFC3339Nano, cursor.Key)
+			if err != nil {
+				http.Error(w, "invalid cursor", http.StatusBadRequest)
+				return
+			}
+			params.CursorTime = pgtype.Timestamptz{Time: t, Valid: true}
+			params.CursorID = pgtype.UUID{Bytes: cursor.ID, Valid: true}
+		}
+
+		deliveries, err := queries.ListWebhookDeliveries(r.Context(), params)
+		if err != nil {
+			logger.Error("failed to list webhook deliveries", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := ListWebhookDeliveriesResponse{Deliveries: []WebhookDeliveryResponse{}}
+
+		if len(deliveries) > pageSize {
+			deliveries = deliveries[:pageSize]
+			last := deliveries[len(deliveries)-1]
+			resp.NextCursor = encodeCursor(pageCursor{
+				SortBy: "created_at",
+				Desc:   true,
+				Key:    last.CreatedAt.UTC().Format(time.RFC3339Nano),
+				ID:     last.ID,
+			})
+		}
+
+		for _, delivery := range deliveries {
+			resp.Deliveries = append(resp.Deliveries, WebhookDeliveryResponse{
+				WebhookDelivery: delivery,
+				Payload:         delivery.Payload,
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// RedeliverWebhookDelivery queues a new delivery of a previous delivery's
+// payload. The original delivery is left untouched.
+func RedeliverWebhookDelivery(queries *generated.Queries, audit *service.AuditRecorder, logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhook, ok := loadWebhook(w, r, queries, logger)
+		if !ok {
+			return
+		}
+
+		deliveryID, err := uuid.Parse(chi.URLParam(r, "delivery_id"))
+		if err != nil {
+			http.Error(w, "invalid delivery ID", http.StatusBadRequest)
+			return
+		}
+
+		original, err := queries.GetWebhookDelivery(r.Context(), generated.GetWebhookDeliveryParams{
+			ID:        deliveryID,
+			WebhookID: webhook.ID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			logger.Error("failed to get webhook delivery", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		delivery, err := queries.CreateWebhookDelivery(r.Context(), generated.CreateWebhookDeliveryParams{
+			WebhookID:    webhook.ID,
+			EventID:      original.EventID,
+			EventType:    original.EventType,
+			Payload:      original.Payload,
+			RedeliveryOf: pgtype.UUID{Bytes: original.ID, Valid: true},
+		})
+		if err != nil {
+			logger.Error("failed to queue webhook redelivery", zap.Error(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		entry := auditEntry(r, webhook.OrganizationID, service.AuditWebhookRedelivered, "webhook", webhook.ID.String(), "redeliver")
+		entry.Metadata = map[string]any{
+			"delivery_id":   delivery.ID.String(),
+			"redelivery_of": original.ID.String(),
+			"event_type":    original.EventType,
+		}
+		audit.Record(r.Context(), entry)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(WebhookDeliveryResponse{
+			WebhookDelivery: delivery,
+			Payload:         delivery.Payload,
+		})
+	}
+}
+
+// loadWebhook fetches the webhook named by the {id} URL parameter, writing
+// the error response if it cannot
+func loadWebhook(w http.ResponseWriter, r *http.Request, queries *generated.Queries, logger *zap.Logger) (generated.Webhook, bool) {
+	// TODO: Get organization ID from JWT auth
+	orgID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+	webhookID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid webhook ID", http.StatusBadRequest)
+		return generated.Webhook{}, false
+	}
+
+	webhook, err := queries.GetWebhook(r.Context(), generated.GetWebhookParams{
+		ID:             webhookID,
+		OrganizationID: orgID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return generated.Webhook{}, false
+	}
+	if err != nil {
+		logger.Error("failed to get webhook", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return generated.Webhook{}, false
+	}
+
+	return webhook, true
+}
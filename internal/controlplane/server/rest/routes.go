@@ -1,41 +1,170 @@
 package rest
 
 import (
+	"net/http"
+	"path"
+	"time"
+
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
 
 	"github.com/netf/safeedge/internal/controlplane/database/generated"
 	"github.com/netf/safeedge/internal/controlplane/server/rest/handlers"
+	"github.com/netf/safeedge/internal/controlplane/service"
 )
 
-func RegisterRoutes(router chi.Router, queries *generated.Queries, logger *zap.Logger) {
+// Services bundles the business logic services used by REST handlers
+type Services struct {
+	Events       *service.EventBus
+	Metrics      *service.MetricsService
+	Presence     *service.PresenceService
+	Access       *service.AccessPolicyService
+	Sessions     *service.AccessSessionService
+	Lifecycle    *service.DeviceLifecycle
+	Audit        *service.AuditRecorder
+	Checkpoints  *service.AuditCheckpointer
+	Tunnels      service.Tunneler
+	Commands     *service.CommandService
+	Logs         *service.LogService
+	LogCollector service.LogCollector
+	Transfers    *service.TransferService
+	Configs      *service.ConfigService
+	Artifacts    *service.ArtifactStore
+	Rollouts     *service.RolloutService
+}
+
+// streamingPaths match long-lived requests, as path.Match patterns:
+// responses that run until the client disconnects, audit log exports, and
+// artifact uploads and downloads
+var streamingPaths = []string{
+	"/v1/events",
+	"/v1/access-sessions/*/tunnel",
+	"/v1/devices/*/logs",
+	"/v1/audit-logs/export",
+	"/v1/artifacts",
+	"/v1/artifacts/*/content",
+}
+
+func isStreaming(urlPath string) bool {
+	for _, pattern := range streamingPaths {
+		if ok, _ := path.Match(pattern, urlPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Timeout applies middleware.Timeout to every request except streams
+func Timeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		timed := middleware.Timeout(timeout)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isStreaming(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timed.ServeHTTP(w, r)
+		})
+	}
+}
+
+func RegisterRoutes(router chi.Router, queries *generated.Queries, services *Services, logger *zap.Logger) {
 	// API version prefix
 	router.Route("/v1", func(r chi.Router) {
+		// Live events
+		r.Get("/events", handlers.StreamEvents(services.Events, logger))
+
 		// Enrollment
-		r.Post("/enrollment-tokens", handlers.CreateEnrollmentToken(queries, logger))
-		r.Post("/enrollments", handlers.EnrollDevice(queries, logger))
+		r.Post("/enrollment-tokens", handlers.CreateEnrollmentToken(queries, services.Audit, logger))
+		r.Get("/enrollment-tokens", handlers.ListEnrollmentTokens(queries, logger))
+		r.Delete("/enrollment-tokens/{id}", handlers.RevokeEnrollmentToken(queries, services.Audit, logger))
+		r.Post("/enrollments", handlers.EnrollDevice(queries, services.Lifecycle, services.Audit, logger))
+		r.Get("/reenrollments", handlers.ListReenrollments(queries, logger))
+		r.Get("/reenrollments/{id}", handlers.GetReenrollment(queries, logger))
+		r.Post("/reenrollments/{id}/approve", handlers.ApproveReenrollment(queries, services.Lifecycle, services.Audit, logger))
+		r.Post("/reenrollments/{id}/reject", handlers.RejectReenrollment(queries, services.Lifecycle, services.Audit, logger))
 
 		// Devices
-		r.Get("/devices", handlers.ListDevices(queries, logger))
-		r.Get("/devices/{id}", handlers.GetDevice(queries, logger))
-		r.Post("/devices/{id}/suspend", handlers.SuspendDevice(queries, logger))
-		r.Post("/devices/{id}/reactivate", handlers.ReactivateDevice(queries, logger))
+		r.Get("/devices", handlers.ListDevices(queries, services.Presence, logger))
+		r.Get("/devices/{id}", handlers.GetDevice(queries, services.Presence, services.Configs, logger))
+		r.Put("/devices/{id}/labels", handlers.SetDeviceLabels(queries, services.Presence, services.Audit, logger))
+		r.Post("/devices/{id}/suspend", handlers.SuspendDevice(queries, services.Lifecycle, services.Presence, services.Audit, logger))
+		r.Post("/devices/{id}/reactivate", handlers.ReactivateDevice(queries, services.Lifecycle, services.Presence, services.Audit, logger))
+		r.Post("/devices/{id}/decommission", handlers.DecommissionDevice(queries, services.Lifecycle, services.Presence, services.Audit, logger))
+		r.Get("/devices/{id}/metrics", handlers.GetDeviceMetrics(services.Metrics, logger))
+		r.Get("/devices/{id}/connection-events", handlers.ListDeviceConnectionEvents(queries, logger))
+		r.Get("/devices/{id}/config", handlers.GetDeviceConfig(queries, services.Configs, logger))
+		r.Put("/devices/{id}/config", handlers.SetDeviceConfig(queries, services.Configs, services.Audit, logger))
+		r.Delete("/devices/{id}/config", handlers.DeleteDeviceConfig(queries, services.Configs, services.Audit, logger))
+		r.Get("/devices/{id}/logs", handlers.GetDeviceLogs(queries, services.Logs, services.LogCollector, logger))
+		r.Post("/devices/{id}/commands", handlers.RunDeviceCommand(queries, services.Commands, services.Audit, logger))
+		r.Post("/devices/{id}/transfers", handlers.StartTransfer(queries, services.Transfers, services.Audit, logger))
+
+		// Commands
+		r.Get("/commands/{id}", handlers.GetCommand(queries, logger))
+		r.Post("/command-batches", handlers.CreateCommandBatch(queries, services.Commands, services.Audit, logger))
+		r.Get("/command-batches/{id}", handlers.GetCommandBatch(queries, logger))
+
+		// File Transfers
+		r.Get("/transfers/{id}", handlers.GetTransfer(queries, logger))
+		r.Put("/transfers/{id}/chunks/{index}", handlers.PutTransferChunk(queries, services.Transfers, logger))
+		r.Get("/transfers/{id}/chunks/{index}", handlers.GetTransferChunk(queries, services.Transfers, logger))
+		r.Post("/transfers/{id}/complete", handlers.CompleteTransfer(queries, services.Transfers, services.Audit, logger))
+		r.Delete("/transfers/{id}", handlers.AbortTransfer(queries, services.Transfers, services.Audit, logger))
+
+		// Device Groups
+		r.Post("/device-groups", handlers.CreateDeviceGroup(queries, services.Audit, logger))
+		r.Get("/device-groups", handlers.ListDeviceGroups(queries, logger))
+		r.Get("/device-groups/{id}", handlers.GetDeviceGroup(queries, logger))
+		r.Patch("/device-groups/{id}", handlers.UpdateDeviceGroup(queries, services.Audit, logger))
+		r.Delete("/device-groups/{id}", handlers.DeleteDeviceGroup(queries, services.Audit, logger))
+		r.Put("/device-groups/{id}/devices/{device_id}", handlers.AddDeviceGroupMember(queries, services.Audit, logger))
+		r.Delete("/device-groups/{id}/devices/{device_id}", handlers.RemoveDeviceGroupMember(queries, services.Audit, logger))
+		r.Get("/device-groups/{id}/config", handlers.GetDeviceGroupConfig(queries, logger))
+		r.Put("/device-groups/{id}/config", handlers.SetDeviceGroupConfig(queries, services.Configs, services.Audit, logger))
+		r.Delete("/device-groups/{id}/config", handlers.DeleteDeviceGroupConfig(queries, services.Configs, services.Audit, logger))
 
 		// Access Sessions
-		r.Post("/access-sessions", handlers.CreateAccessSession(queries, logger))
-		r.Delete("/access-sessions/{id}", handlers.TerminateAccessSession(queries, logger))
+		r.Post("/access-sessions", handlers.CreateAccessSession(queries, services.Access, services.Sessions, services.Events, services.Audit, logger))
+		r.Delete("/access-sessions/{id}", handlers.TerminateAccessSession(queries, services.Sessions, services.Audit, logger))
+		r.Get("/access-sessions/{id}/tunnel", handlers.OpenAccessTunnel(queries, services.Tunnels, logger))
+
+		// Access Policies
+		r.Post("/access-policies", handlers.CreateAccessPolicy(queries, services.Audit, logger))
+		r.Get("/access-policies", handlers.ListAccessPolicies(queries, logger))
+		r.Delete("/access-policies/{id}", handlers.DeleteAccessPolicy(queries, services.Audit, logger))
 
 		// Artifacts
-		r.Post("/artifacts", handlers.CreateArtifact(queries, logger))
+		r.Post("/artifacts", handlers.CreateArtifact(services.Artifacts, services.Audit, logger))
 		r.Get("/artifacts/{id}", handlers.GetArtifact(queries, logger))
+		r.Get("/artifacts/{id}/content", handlers.GetArtifactContent(queries, services.Artifacts, logger))
 
 		// Rollouts
-		r.Post("/rollouts", handlers.CreateRollout(queries, logger))
+		r.Post("/rollouts", handlers.CreateRollout(queries, services.Events, services.Audit, logger))
 		r.Get("/rollouts/{id}", handlers.GetRollout(queries, logger))
-		r.Post("/rollouts/{id}/start", handlers.StartRollout(queries, logger))
-		r.Post("/rollouts/{id}/abort", handlers.AbortRollout(queries, logger))
+		r.Post("/rollouts/{id}/start", handlers.StartRollout(queries, services.Rollouts, services.Audit, logger))
+		r.Post("/rollouts/{id}/abort", handlers.AbortRollout(queries, services.Rollouts, services.Audit, logger))
 
 		// Audit Logs
 		r.Get("/audit-logs", handlers.ListAuditLogs(queries, logger))
+		r.Get("/audit-logs/chain", handlers.GetAuditChain(queries, logger))
+		r.Get("/audit-logs/checkpoints", handlers.ListAuditCheckpoints(queries, logger))
+		r.Post("/audit-logs/checkpoints", handlers.CreateAuditCheckpoint(queries, services.Checkpoints, services.Audit, logger))
+		r.Get("/audit-logs/export", handlers.ExportAuditLogs(queries, logger))
+
+		// Audit Sinks
+		r.Post("/audit-sinks", handlers.CreateAuditSink(queries, services.Audit, logger))
+		r.Get("/audit-sinks", handlers.ListAuditSinks(queries, logger))
+		r.Get("/audit-sinks/{id}", handlers.GetAuditSink(queries, logger))
+		r.Delete("/audit-sinks/{id}", handlers.DeleteAuditSink(queries, services.Audit, logger))
+
+		// Webhooks
+		r.Post("/webhooks", handlers.CreateWebhook(queries, services.Audit, logger))
+		r.Get("/webhooks", handlers.ListWebhooks(queries, logger))
+		r.Get("/webhooks/{id}", handlers.GetWebhook(queries, logger))
+		r.Delete("/webhooks/{id}", handlers.DeleteWebhook(queries, services.Audit, logger))
+		r.Get("/webhooks/{id}/deliveries", handlers.ListWebhookDeliveries(queries, logger))
+		r.Post("/webhooks/{id}/deliveries/{delivery_id}/redeliver", handlers.RedeliverWebhookDelivery(queries, services.Audit, logger))
 	})
 }
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/pkg/labels"
+)
+
+// ErrAccessDenied is returned when no access policy grants a user access to a device
+var ErrAccessDenied = errors.New("access denied by policy")
+
+// AccessPolicyService evaluates access policies. Access is denied unless a
+// policy lists the user (or "*"), its device selector matches the device and
+// the device is in the policy's device group, if it has one.
+type AccessPolicyService struct {
+	queries *generated.Queries
+	logger  *zap.Logger
+}
+
+// NewAccessPolicyService creates an access policy evaluator
+func NewAccessPolicyService(queries *generated.Queries, logger *zap.Logger) *AccessPolicyService {
+	return &AccessPolicyService{
+		queries: queries,
+		logger:  logger,
+	}
+}
+
+// Authorize returns the longest session duration the organization's policies
+// grant userEmail on device, or ErrAccessDenied
+func (s *AccessPolicyService) Authorize(ctx context.Context, device generated.Device, userEmail string) (time.Duration, error) {
+	policies, err := s.queries.ListAccessPoliciesForUser(ctx, generated.ListAccessPoliciesForUserParams{
+		OrganizationID: device.OrganizationID,
+		UserEmail:      userEmail,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list access policies: %w", err)
+	}
+
+	groups, err := s.queries.ListDeviceGroupsForDevice(ctx, device.ID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list device groups: %w", err)
+	}
+
+	inGroup := make(map[uuid.UUID]bool, len(groups))
+	for _, g := range groups {
+		inGroup[g.ID] = true
+	}
+
+	set := DeviceLabels(device)
+
+	var allowed time.Duration
+	for _, policy := range policies {
+		sel, err := labels.SelectorFromJSON(policy.DeviceSelector)
+		if err != nil {
+			s.logger.Warn("skipping access policy with invalid selector",
+				zap.String("policy_id", policy.ID.String()),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		if !sel.Matches(set) {
+			continue
+		}
+		if policy.DeviceGroupID.Valid && !inGroup[policy.DeviceGroupID.Bytes] {
+			continue
+		}
+
+		if d := time.Duration(policy.MaxDurationSeconds) * time.Second; d > allowed {
+			allowed = d
+		}
+	}
+
+	if allowed == 0 {
+		return 0, ErrAccessDenied
+	}
+
+	return allowed, nil
+}
+
+// DeviceLabels returns the labels selectors are evaluated against: the
+// agent-reported labels overlaid with the operator labels
+func DeviceLabels(device generated.Device) labels.Set {
+	reported, operator := labels.Set{}, labels.Set{}
+	json.Unmarshal(device.ReportedLabels, &reported)
+	json.Unmarshal(device.Labels, &operator)
+	return reported.Merge(operator)
+}
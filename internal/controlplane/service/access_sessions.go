@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+const accessSessionSweepInterval = 30 * time.Second
+
+// Reasons an access session ends
+const (
+	AccessEndedTerminated = "terminated"
+	AccessEndedExpired    = "expired"
+	AccessEndedCutOff     = "device cut off"
+)
+
+var (
+	// ErrHubNotConfigured is returned when a client asks for a tunnel but the
+	// control plane does not know the hub's public key and endpoint
+	ErrHubNotConfigured = errors.New("WireGuard hub is not configured")
+	// ErrInvalidClientKey is returned for a malformed client WireGuard public key
+	ErrInvalidClientKey = errors.New("invalid client WireGuard public key")
+)
+
+// WireGuardHub is how clients outside the overlay reach the hub
+type WireGuardHub struct {
+	PublicKey string
+	Endpoint  string
+}
+
+// OpenAccessSessionParams describes an authorized access session to open
+type OpenAccessSessionParams struct {
+	Device    generated.Device
+	UserEmail string
+	ExpiresAt time.Time
+	// ClientPublicKey, if set, is the WireGuard key of an ephemeral client
+	// interface to add to the hub for the session
+	ClientPublicKey string
+	// AllowedDestinations are the host:port destinations the device's agent
+	// forwards the client's connections to
+	AllowedDestinations []string
+}
+
+// AccessSessionService opens and terminates access sessions. A client that
+// brings its own WireGuard key gets an overlay address and a hub peer, both
+// released when the session is terminated or expires.
+type AccessSessionService struct {
+	queries *generated.Queries
+	ipam    *IPAM
+	peers   PeerManager
+	hub     WireGuardHub
+	events  *EventBus
+	logger  *zap.Logger
+}
+
+// NewAccessSessionService creates an access session manager
+func NewAccessSessionService(queries *generated.Queries, ipam *IPAM, peers PeerManager, hub WireGuardHub, events *EventBus, logger *zap.Logger) *AccessSessionService {
+	return &AccessSessionService{
+		queries: queries,
+		ipam:    ipam,
+		peers:   peers,
+		hub:     hub,
+		events:  events,
+		logger:  logger,
+	}
+}
+
+// Open records an access session and, for clients with their own key,
+// leases it an address and adds it to the hub
+func (s *AccessSessionService) Open(ctx context.Context, params OpenAccessSessionParams) (generated.AccessSession, error) {
+	destinations := params.AllowedDestinations
+	if destinations == nil {
+		destinations = []string{}
+	}
+
+	if params.ClientPublicKey == "" {
+		return s.queries.CreateAccessSession(ctx, generated.CreateAccessSessionParams{
+			DeviceID:            params.Device.ID,
+			UserEmail:           params.UserEmail,
+			WireguardPeerConfig: devicePeerConfig(params.Device),
+			ExpiresAt:           params.ExpiresAt,
+			AllowedDestinations: destinations,
+		})
+	}
+
+	if s.hub.PublicKey == "" || s.hub.Endpoint == "" {
+		return generated.AccessSession{}, ErrHubNotConfigured
+	}
+	if _, err := crypto.ParseWireGuardPublicKey(params.ClientPublicKey); err != nil {
+		return generated.AccessSession{}, ErrInvalidClientKey
+	}
+
+	var session generated.AccessSession
+	err := s.ipam.Lease(ctx, func(ip net.IP) error {
+		var err error
+		session, err = s.queries.CreateAccessSession(ctx, generated.CreateAccessSessionParams{
+			DeviceID:                 params.Device.ID,
+			UserEmail:                params.UserEmail,
+			WireguardPeerConfig:      s.clientConfig(params.Device, ip),
+			ExpiresAt:                params.ExpiresAt,
+			ClientWireguardPublicKey: pgtype.Text{String: params.ClientPublicKey, Valid: true},
+			ClientWireguardIp:        ip,
+			AllowedDestinations:      destinations,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create access session: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return generated.AccessSession{}, err
+	}
+
+	if err := s.peers.AddPeer(ctx, params.ClientPublicKey, session.ClientWireguardIp); err != nil {
+		if _, termErr := s.queries.TerminateAccessSession(ctx, session.ID); termErr != nil {
+			s.logger.Error("failed to terminate access session", zap.Error(termErr))
+		}
+		return generated.AccessSession{}, fmt.Errorf("failed to add client peer: %w", err)
+	}
+
+	return session, nil
+}
+
+// Terminate ends an access session and removes its client from the hub
+func (s *AccessSessionService) Terminate(ctx context.Context, id uuid.UUID) (generated.AccessSession, error) {
+	session, err := s.queries.TerminateAccessSession(ctx, id)
+	if err != nil {
+		return generated.AccessSession{}, err
+	}
+
+	s.removeClients(ctx, []generated.AccessSession{session})
+	s.publishEnded(ctx, session, AccessEndedTerminated)
+
+	return session, nil
+}
+
+// removeClients removes the client peers of terminated sessions from the hub
+func (s *AccessSessionService) removeClients(ctx context.Context, sessions []generated.AccessSession) {
+	for _, session := range sessions {
+		if !session.ClientWireguardPublicKey.Valid {
+			continue
+		}
+		if err := s.peers.RemovePeer(ctx, session.ClientWireguardPublicKey.String); err != nil {
+			s.logger.Error("failed to remove client WireGuard peer",
+				zap.String("session_id", session.ID.String()),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// Run terminates expired sessions, releasing their addresses and hub peers,
+// until ctx is cancelled
+func (s *AccessSessionService) Run(ctx context.Context) {
+	ticker := time.NewTicker(accessSessionSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+// sweep terminates sessions past their expiry
+func (s *AccessSessionService) sweep(ctx context.Context) {
+	expired, err := s.queries.ExpireOldSessions(ctx)
+	if err != nil {
+		s.logger.Error("failed to expire access sessions", zap.Error(err))
+		return
+	}
+	if len(expired) == 0 {
+		return
+	}
+
+	s.removeClients(ctx, expired)
+	for _, session := range expired {
+		s.publishEnded(ctx, session, AccessEndedExpired)
+	}
+	s.logger.Info("access sessions expired", zap.Int("count", len(expired)))
+}
+
+// publishEnded publishes the end of a session, so the device's agent stops
+// forwarding for it
+func (s *AccessSessionService) publishEnded(ctx context.Context, session generated.AccessSession, reason string) {
+	device, err := s.queries.GetDevice(ctx, session.DeviceID)
+	if err != nil {
+		s.logger.Error("failed to get device for access session", zap.Error(err))
+		return
+	}
+
+	s.events.Publish(accessEndedEvent(device, session, reason))
+}
+
+func accessEndedEvent(device generated.Device, session generated.AccessSession, reason string) Event {
+	return Event{
+		Type:           EventAccessEnded,
+		OrganizationID: device.OrganizationID,
+		ResourceType:   "device",
+		ResourceID:     device.ID.String(),
+		Data: map[string]any{
+			"session_id": session.ID.String(),
+			"user_email": session.UserEmail,
+			"reason":     reason,
+		},
+	}
+}
+
+// clientConfig is the WireGuard configuration, without the private key, of a
+// client interface at ip that reaches device through the hub
+func (s *AccessSessionService) clientConfig(device generated.Device, ip net.IP) string {
+	return fmt.Sprintf("[Interface]\nAddress = %s/32\n\n[Peer]\nPublicKey = %s\nEndpoint = %s\nAllowedIPs = %s/32\nPersistentKeepalive = 25\n",
+		ip, s.hub.PublicKey, s.hub.Endpoint, device.WireguardIp)
+}
+
+// devicePeerConfig is the WireGuard [Peer] section a client already on the
+// overlay uses to reach a device
+func devicePeerConfig(device generated.Device) string {
+	return fmt.Sprintf("[Peer]\nPublicKey = %s\nAllowedIPs = %s/32\nPersistentKeepalive = 25\n",
+		device.WireguardPublicKey, device.WireguardIp)
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/pkg/crypto"
+	"github.com/netf/safeedge/pkg/installer"
+)
+
+const (
+	// DefaultArtifactDir is where the control plane keeps artifact files
+	// unless configured otherwise
+	DefaultArtifactDir = "/var/lib/safeedge/artifacts"
+	// DefaultArtifactMaxSize is the largest artifact accepted unless
+	// configured otherwise
+	DefaultArtifactMaxSize = 2 << 30
+)
+
+var (
+	// ErrInvalidArtifact is returned for uploads that are malformed, too
+	// large, or whose hash or signature does not verify
+	ErrInvalidArtifact = errors.New("invalid artifact")
+	// ErrArtifactExists is returned for an upload of a file already stored
+	ErrArtifactExists = errors.New("artifact already uploaded")
+)
+
+var artifactHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// CreateArtifactParams describes an artifact being uploaded. The signature
+// is made with the Ed25519 key SigningKeyID, the base64 public key, over
+// the BLAKE3 hash.
+type CreateArtifactParams struct {
+	OrganizationID uuid.UUID
+	Name           string
+	Type           string
+	Blake3Hash     string
+	Signature      []byte
+	SigningKeyID   string
+}
+
+// ArtifactStore keeps artifact files on the control plane's disk, named by
+// their BLAKE3 hash, and tells agents where to download them. Uploads are
+// checked against the hash and signature the uploader gives; agents check
+// them again against the key they trust.
+type ArtifactStore struct {
+	queries *generated.Queries
+	dir     string
+	baseURL string
+	maxSize int64
+}
+
+// NewArtifactStore creates a store keeping files in dir, which agents
+// download through the REST API at baseURL
+func NewArtifactStore(queries *generated.Queries, dir, baseURL string, maxSize int64) *ArtifactStore {
+	return &ArtifactStore{
+		queries: queries,
+		dir:     dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		maxSize: maxSize,
+	}
+}
+
+// Create stores an artifact's file, read from r, and records the artifact
+func (s *ArtifactStore) Create(ctx context.Context, params CreateArtifactParams, r io.Reader) (generated.Artifact, error) {
+	if params.Name == "" {
+		return generated.Artifact{}, fmt.Errorf("%w: name is required", ErrInvalidArtifact)
+	}
+	if err := installer.ValidateType(params.Type); err != nil {
+		return generated.Artifact{}, fmt.Errorf("%w: %v", ErrInvalidArtifact, err)
+	}
+	if !artifactHashPattern.MatchString(params.Blake3Hash) {
+		return generated.Artifact{}, fmt.Errorf("%w: blake3_hash must be 64 lower-case hex digits", ErrInvalidArtifact)
+	}
+	if !crypto.VerifyEd25519(params.SigningKeyID, []byte(params.Blake3Hash), params.Signature) {
+		return generated.Artifact{}, fmt.Errorf("%w: signature does not verify with signing_key_id", ErrInvalidArtifact)
+	}
+
+	_, err := s.queries.GetArtifactByHash(ctx, params.Blake3Hash)
+	if err == nil {
+		return generated.Artifact{}, ErrArtifactExists
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return generated.Artifact{}, fmt.Errorf("failed to look up artifact: %w", err)
+	}
+
+	path, size, err := s.write(params.Blake3Hash, r)
+	if err != nil {
+		return generated.Artifact{}, err
+	}
+
+	artifact, err := s.queries.CreateArtifact(ctx, generated.CreateArtifactParams{
+		OrganizationID: params.OrganizationID,
+		Name:           params.Name,
+		Type:           params.Type,
+		Blake3Hash:     params.Blake3Hash,
+		Signature:      params.Signature,
+		SigningKeyID:   params.SigningKeyID,
+		S3Url:          (&url.URL{Scheme: "file", Path: path}).String(),
+		SizeBytes:      size,
+	})
+	if err != nil {
+		return generated.Artifact{}, fmt.Errorf("failed to create artifact: %w", err)
+	}
+	return artifact, nil
+}
+
+// write stores a file that must have the given hash, returning its path and
+// size
+func (s *ArtifactStore) write(hash string, r io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return "", 0, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	got, err := crypto.BLAKE3HashReader(io.TeeReader(io.LimitReader(r, s.maxSize+1), tmp))
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to store artifact: %w", err)
+	}
+
+	info, err := os.Stat(tmp.Name())
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to store artifact: %w", err)
+	}
+	if info.Size() > s.maxSize {
+		return "", 0, fmt.Errorf("%w: larger than %d bytes", ErrInvalidArtifact, s.maxSize)
+	}
+	if got != hash {
+		return "", 0, fmt.Errorf("%w: file hash %s does not match blake3_hash", ErrInvalidArtifact, got)
+	}
+
+	path := filepath.Join(s.dir, hash)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, fmt.Errorf("failed to move artifact into place: %w", err)
+	}
+	return path, info.Size(), nil
+}
+
+// Open opens an artifact's file
+func (s *ArtifactStore) Open(artifact generated.Artifact) (*os.File, error) {
+	location, err := url.Parse(artifact.S3Url)
+	if err != nil || location.Scheme != "file" {
+		return nil, fmt.Errorf("artifact %s is not stored on this control plane", artifact.ID)
+	}
+	return os.Open(location.Path)
+}
+
+// URL is where agents download an artifact from
+func (s *ArtifactStore) URL(artifact generated.Artifact) string {
+	return s.baseURL + "/v1/artifacts/" + artifact.ID.String() + "/content"
+}
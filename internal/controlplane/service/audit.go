@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/pkg/audit"
+)
+
+// Audit actor types
+const (
+	ActorUser   = "USER"
+	ActorDevice = "DEVICE"
+	ActorSystem = "SYSTEM"
+)
+
+// Audit results
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// Audit event types
+const (
+	AuditEnrollmentTokenCreated = "enrollment_token.created"
+	AuditEnrollmentTokenRevoked = "enrollment_token.revoked"
+
+	AuditDeviceEnrolled              = "device.enrolled"
+	AuditDeviceReenrollmentRequested = "device.reenrollment_requested"
+	AuditDeviceReenrollmentApproved  = "device.reenrollment_approved"
+	AuditDeviceReenrollmentRejected  = "device.reenrollment_rejected"
+	AuditDeviceLabelsUpdated         = "device.labels_updated"
+	AuditDeviceSuspended             = "device.suspended"
+	AuditDeviceReactivated           = "device.reactivated"
+	AuditDeviceDecommissioned        = "device.decommissioned"
+	AuditDeviceConnected             = "device.connected"
+	AuditDeviceDisconnected          = "device.disconnected"
+	AuditDeviceKeysRotated           = "device.keys_rotated"
+	AuditDeviceUpdateReported        = "device.update_reported"
+	AuditDeviceHealthReported        = "device.health_reported"
+	AuditDeviceRollbackRequested     = "device.rollback_requested"
+	AuditDevicePolicyDenied          = "device.policy_denied"
+	AuditDeviceConfigUpdated         = "device.config_updated"
+	AuditDeviceConfigDeleted         = "device.config_deleted"
+
+	AuditDeviceGroupCreated       = "device_group.created"
+	AuditDeviceGroupUpdated       = "device_group.updated"
+	AuditDeviceGroupDeleted       = "device_group.deleted"
+	AuditDeviceGroupMemberAdded   = "device_group.member_added"
+	AuditDeviceGroupMemberRemoved = "device_group.member_removed"
+	AuditDeviceGroupConfigUpdated = "device_group.config_updated"
+	AuditDeviceGroupConfigDeleted = "device_group.config_deleted"
+
+	AuditAccessStarted       = "access.started"
+	AuditAccessTerminated    = "access.terminated"
+	AuditAccessPolicyCreated = "access_policy.created"
+	AuditAccessPolicyDeleted = "access_policy.deleted"
+
+	AuditArtifactCreated = "artifact.created"
+
+	AuditRolloutCreated   = "rollout.created"
+	AuditRolloutStarted   = "rollout.started"
+	AuditRolloutAborted   = "rollout.aborted"
+	AuditRolloutCompleted = "rollout.completed"
+	AuditRolloutFailed    = "rollout.failed"
+
+	AuditCommandRequested    = "command.requested"
+	AuditCommandCompleted    = "command.completed"
+	AuditCommandBatchCreated = "command_batch.created"
+
+	AuditFileTransferStarted   = "file_transfer.started"
+	AuditFileTransferCompleted = "file_transfer.completed"
+	AuditFileTransferAborted   = "file_transfer.aborted"
+
+	AuditAuditSinkCreated = "audit_sink.created"
+	AuditAuditSinkDeleted = "audit_sink.deleted"
+
+	AuditAuditCheckpointCreated = "audit_checkpoint.created"
+
+	AuditWebhookCreated     = "webhook.created"
+	AuditWebhookDeleted     = "webhook.deleted"
+	AuditWebhookRedelivered = "webhook.redelivered"
+)
+
+// AuditEntry is an audited action. Result defaults to AuditSuccess.
+type AuditEntry struct {
+	OrganizationID uuid.UUID
+	ActorType      string
+	Actor          string
+	EventType      string
+	ResourceType   string
+	ResourceID     string
+	Action         string
+	Result         string
+	Metadata       map[string]any
+	IPAddress      string
+	RequestID      string
+}
+
+// AuditRecorder writes the audit log. Every operator request that changes
+// state and every device-originated event goes through it. Entries are
+// appended to a per-organization BLAKE3 hash chain (see pkg/audit).
+type AuditRecorder struct {
+	db      *pgxpool.Pool
+	queries *generated.Queries
+	logger  *zap.Logger
+}
+
+// NewAuditRecorder creates an audit recorder
+func NewAuditRecorder(db *pgxpool.Pool, queries *generated.Queries, logger *zap.Logger) *AuditRecorder {
+	return &AuditRecorder{
+		db:      db,
+		queries: queries,
+		logger:  logger,
+	}
+}
+
+// Record writes an audit log entry. Failures are logged rather than
+// returned; the audited operation has already happened.
+func (a *AuditRecorder) Record(ctx context.Context, entry AuditEntry) {
+	// Requests and streams are often finished by the time they are audited
+	ctx = context.WithoutCancel(ctx)
+
+	if entry.Result == "" {
+		entry.Result = AuditSuccess
+	}
+
+	var metadata []byte
+	if len(entry.Metadata) > 0 {
+		var err error
+		if metadata, err = json.Marshal(entry.Metadata); err != nil {
+			a.logger.Error("failed to encode audit metadata",
+				zap.String("event_type", entry.EventType),
+				zap.Error(err),
+			)
+		}
+	}
+
+	if err := a.append(ctx, entry, metadata); err != nil {
+		a.logger.Error("failed to write audit log",
+			zap.String("event_type", entry.EventType),
+			zap.String("resource_id", entry.ResourceID),
+			zap.Error(err),
+		)
+	}
+}
+
+// append adds an entry to the head of its organization's chain
+func (a *AuditRecorder) append(ctx context.Context, entry AuditEntry, metadata []byte) error {
+	ip := parseAuditIP(entry.IPAddress)
+
+	chained := audit.Entry{
+		ID:             uuid.New(),
+		Timestamp:      audit.Timestamp(time.Now()),
+		OrganizationID: entry.OrganizationID,
+		ActorType:      entry.ActorType,
+		Actor:          entry.Actor,
+		EventType:      entry.EventType,
+		ResourceType:   entry.ResourceType,
+		ResourceID:     entry.ResourceID,
+		Action:         entry.Action,
+		Result:         entry.Result,
+		Metadata:       metadata,
+		RequestID:      entry.RequestID,
+		Sequence:       1,
+		PrevHash:       audit.GenesisHash,
+	}
+	if ip != nil {
+		chained.IPAddress = ip.String()
+	}
+
+	tx, err := a.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	q := a.queries.WithTx(tx)
+
+	if err := q.LockAuditChain(ctx, entry.OrganizationID); err != nil {
+		return fmt.Errorf("failed to lock audit chain: %w", err)
+	}
+
+	head, err := q.GetAuditChainHead(ctx, entry.OrganizationID)
+	switch {
+	case err == nil:
+		chained.Sequence = head.Sequence + 1
+		chained.PrevHash = head.Hash
+	case !errors.Is(err, pgx.ErrNoRows):
+		return fmt.Errorf("failed to get audit chain head: %w", err)
+	}
+
+	if chained.Hash, err = chained.ComputeHash(); err != nil {
+		return fmt.Errorf("failed to hash audit entry: %w", err)
+	}
+
+	if _, err := q.CreateAuditLog(ctx, generated.CreateAuditLogParams{
+		ID:             chained.ID,
+		Timestamp:      chained.Timestamp,
+		OrganizationID: entry.OrganizationID,
+		ActorType:      entry.ActorType,
+		Actor:          textOrNull(entry.Actor),
+		EventType:      entry.EventType,
+		ResourceType:   entry.ResourceType,
+		ResourceID:     entry.ResourceID,
+		Action:         entry.Action,
+		Result:         entry.Result,
+		Metadata:       metadata,
+		IpAddress:      ip,
+		RequestID:      textOrNull(entry.RequestID),
+		Sequence:       chained.Sequence,
+		PrevHash:       chained.PrevHash,
+		Hash:           chained.Hash,
+	}); err != nil {
+		return fmt.Errorf("failed to create audit log: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// AuditDiff returns the top-level JSON fields that differ between before and
+// after, as {"field": {"from": old, "to": new}}
+func AuditDiff(before, after any) map[string]any {
+	from, to := jsonFields(before), jsonFields(after)
+
+	diff := map[string]any{}
+	for k, v := range to {
+		if old, ok := from[k]; !ok || !reflect.DeepEqual(old, v) {
+			diff[k] = map[string]any{"from": from[k], "to": v}
+		}
+	}
+	for k, old := range from {
+		if _, ok := to[k]; !ok {
+			diff[k] = map[string]any{"from": old, "to": nil}
+		}
+	}
+
+	return diff
+}
+
+func jsonFields(v any) map[string]any {
+	fields := map[string]any{}
+	if data, err := json.Marshal(v); err == nil {
+		json.Unmarshal(data, &fields)
+	}
+	return fields
+}
+
+// parseAuditIP accepts a bare address or host:port
+func parseAuditIP(s string) *netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+	return &addr
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/pkg/audit"
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+// DefaultAuditCheckpointInterval is how often chain heads are signed
+const DefaultAuditCheckpointInterval = time.Hour
+
+// AuditCheckpointer periodically signs the head of every organization's audit
+// chain with the control plane's Ed25519 key. A signed checkpoint pins every
+// entry before it: rewriting history means forging the signature.
+type AuditCheckpointer struct {
+	queries  *generated.Queries
+	keys     *crypto.Ed25519KeyPair
+	interval time.Duration
+	logger   *zap.Logger
+}
+
+// NewAuditCheckpointer creates an audit checkpointer
+func NewAuditCheckpointer(queries *generated.Queries, keys *crypto.Ed25519KeyPair, interval time.Duration, logger *zap.Logger) *AuditCheckpointer {
+	return &AuditCheckpointer{
+		queries:  queries,
+		keys:     keys,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// PublicKey returns the base64-encoded key checkpoints are signed with
+func (c *AuditCheckpointer) PublicKey() string {
+	return c.keys.PublicKeyString()
+}
+
+// Run checkpoints chains that have grown until ctx is cancelled
+func (c *AuditCheckpointer) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkpointAll(ctx)
+		}
+	}
+}
+
+// checkpointAll signs the head of every chain with entries past its latest checkpoint
+func (c *AuditCheckpointer) checkpointAll(ctx context.Context) {
+	chains, err := c.queries.ListUncheckpointedAuditChains(ctx)
+	if err != nil {
+		c.logger.Error("failed to list audit chains", zap.Error(err))
+		return
+	}
+
+	for _, chain := range chains {
+		if _, err := c.Checkpoint(ctx, chain.OrganizationID); err != nil {
+			c.logger.Error("failed to checkpoint audit chain",
+				zap.String("organization_id", chain.OrganizationID.String()),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// Checkpoint signs the current head of an organization's chain
+func (c *AuditCheckpointer) Checkpoint(ctx context.Context, organizationID uuid.UUID) (generated.AuditCheckpoint, error) {
+	head, err := c.queries.GetAuditChainHead(ctx, organizationID)
+	if err != nil {
+		return generated.AuditCheckpoint{}, fmt.Errorf("failed to get audit chain head: %w", err)
+	}
+
+	checkpoint, err := c.queries.CreateAuditCheckpoint(ctx, generated.CreateAuditCheckpointParams{
+		OrganizationID: organizationID,
+		Sequence:       head.Sequence,
+		Hash:           head.Hash,
+		PublicKey:      c.keys.PublicKeyString(),
+		Signature:      c.keys.Sign(audit.CheckpointMessage(organizationID, head.Sequence, head.Hash)),
+	})
+	// Another instance checkpointed the same head
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.queries.GetLatestAuditCheckpoint(ctx, organizationID)
+	}
+	if err != nil {
+		return generated.AuditCheckpoint{}, fmt.Errorf("failed to create audit checkpoint: %w", err)
+	}
+
+	c.logger.Info("audit chain checkpointed",
+		zap.String("organization_id", organizationID.String()),
+		zap.Int64("sequence", checkpoint.Sequence),
+	)
+
+	return checkpoint, nil
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+)
+
+// Audit export formats
+const (
+	AuditFormatNDJSON = "ndjson"
+	AuditFormatCEF    = "cef"
+)
+
+const (
+	cefVendor  = "SafeEdge"
+	cefProduct = "SafeEdge Control Plane"
+	cefVersion = "0.1.0"
+
+	// syslogFacilityAudit is the RFC 5424 "log audit" facility
+	syslogFacilityAudit = 13
+	// syslogEnterpriseID is the private enterprise number used for structured data
+	syslogEnterpriseID = "32473"
+	// syslogTimeFormat is RFC 3339 with the microsecond precision RFC 5424 allows
+	syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// auditRecord is the JSON form of an audit log entry, matching the API
+type auditRecord struct {
+	generated.AuditLog
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+}
+
+// MarshalAuditLog encodes an audit log entry as a single line of JSON
+func MarshalAuditLog(log generated.AuditLog) ([]byte, error) {
+	return json.Marshal(auditRecord{AuditLog: log, Metadata: log.Metadata})
+}
+
+// FormatAuditLog encodes an audit log entry in format, without a trailing newline
+func FormatAuditLog(log generated.AuditLog, format string) ([]byte, error) {
+	switch format {
+	case AuditFormatNDJSON:
+		return MarshalAuditLog(log)
+	case AuditFormatCEF:
+		return []byte(FormatAuditCEF(log)), nil
+	default:
+		return nil, fmt.Errorf("unknown audit format %q", format)
+	}
+}
+
+// FormatAuditCEF encodes an audit log entry as an ArcSight Common Event
+// Format line
+func FormatAuditCEF(log generated.AuditLog) string {
+	severity := 3
+	if log.Result == AuditFailure {
+		severity = 7
+	}
+
+	ext := []string{
+		"rt=" + strconv.FormatInt(log.Timestamp.UnixMilli(), 10),
+		"externalId=" + cefValue(log.ID.String()),
+		"act=" + cefValue(log.Action),
+		"outcome=" + cefValue(log.Result),
+		"cs1Label=organizationId",
+		"cs1=" + cefValue(log.OrganizationID.String()),
+		"cs2Label=actorType",
+		"cs2=" + cefValue(log.ActorType),
+		"cs3Label=resourceType",
+		"cs3=" + cefValue(log.ResourceType),
+		"cs4Label=resourceId",
+		"cs4=" + cefValue(log.ResourceID),
+		"cn1Label=sequence",
+		"cn1=" + strconv.FormatInt(log.Sequence, 10),
+	}
+	if log.Actor.Valid {
+		ext = append(ext, "suser="+cefValue(log.Actor.String))
+	}
+	if log.IpAddress != nil {
+		ext = append(ext, "src="+log.IpAddress.String())
+	}
+	if log.RequestID.Valid {
+		ext = append(ext, "cs5Label=requestId", "cs5="+cefValue(log.RequestID.String))
+	}
+	if len(log.Metadata) > 0 {
+		ext = append(ext, "msg="+cefValue(string(log.Metadata)))
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeader(cefVendor),
+		cefHeader(cefProduct),
+		cefHeader(cefVersion),
+		cefHeader(log.EventType),
+		cefHeader(log.EventType),
+		severity,
+		strings.Join(ext, " "),
+	)
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+func cefHeader(s string) string {
+	return cefHeaderEscaper.Replace(s)
+}
+
+func cefValue(s string) string {
+	return cefValueEscaper.Replace(s)
+}
+
+// FormatAuditSyslog wraps an encoded audit log entry in an RFC 5424 syslog
+// message. Failed actions are logged at warning severity, others at notice.
+func FormatAuditSyslog(log generated.AuditLog, hostname string, msg []byte) []byte {
+	severity := 5
+	if log.Result == AuditFailure {
+		severity = 4
+	}
+
+	sd := fmt.Sprintf(`[safeedge@%s id="%s" org="%s" seq="%d"]`,
+		syslogEnterpriseID,
+		sdValue(log.ID.String()),
+		sdValue(log.OrganizationID.String()),
+		log.Sequence,
+	)
+
+	header := fmt.Sprintf("<%d>1 %s %s safeedge - %s %s ",
+		syslogFacilityAudit*8+severity,
+		log.Timestamp.UTC().Format(syslogTimeFormat),
+		syslogName(hostname, 255),
+		syslogName(log.EventType, 32),
+		sd,
+	)
+
+	return append([]byte(header), msg...)
+}
+
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func sdValue(s string) string {
+	return sdValueEscaper.Replace(s)
+}
+
+// syslogName makes s a valid RFC 5424 header field: printable ASCII without
+// spaces, at most limit characters, or "-" if empty
+func syslogName(s string, limit int) string {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(b) < limit; i++ {
+		if c := s[i]; c > ' ' && c < 127 {
+			b = append(b, c)
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
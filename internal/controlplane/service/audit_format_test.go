@@ -0,0 +1,149 @@
+package service
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+)
+
+func testAuditLog(sequence int64) generated.AuditLog {
+	ip := netip.MustParseAddr("192.0.2.10")
+	return generated.AuditLog{
+		ID:             uuid.MustParse("6f1c1d1e-8a59-4a55-9a57-0d3c0f0a1b2c"),
+		Timestamp:      time.Date(2026, 3, 1, 12, 30, 45, 123456789, time.UTC),
+		OrganizationID: uuid.MustParse("00000000-0000-0000-0000-000000000001"),
+		ActorType:      "USER",
+		Actor:          pgtype.Text{String: "ops@example.com", Valid: true},
+		EventType:      "device.suspended",
+		ResourceType:   "device",
+		ResourceID:     "d-1",
+		Action:         "suspend",
+		Result:         AuditSuccess,
+		IpAddress:      &ip,
+		Sequence:       sequence,
+	}
+}
+
+func TestCEFHeaderEscaping(t *testing.T) {
+	tests := map[string]string{
+		`plain`:        `plain`,
+		`a|b`:          `a\|b`,
+		`back\slash`:   `back\\slash`,
+		`\|`:           `\\\|`,
+		"two\r\nlines": "two  lines",
+		`a=b`:          `a=b`,
+	}
+	for in, want := range tests {
+		if got := cefHeader(in); got != want {
+			t.Errorf("cefHeader(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCEFValueEscaping(t *testing.T) {
+	tests := map[string]string{
+		`plain`:        `plain`,
+		`a=b`:          `a\=b`,
+		`back\slash`:   `back\\slash`,
+		`\=`:           `\\\=`,
+		"two\r\nlines": `two\r\nlines`,
+		`a|b`:          `a|b`,
+	}
+	for in, want := range tests {
+		if got := cefValue(in); got != want {
+			t.Errorf("cefValue(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFormatAuditCEF(t *testing.T) {
+	log := testAuditLog(42)
+	log.EventType = "odd|event"
+	log.ResourceID = "id=with\nnewline"
+	log.Metadata = []byte(`{"reason":"a=b"}`)
+
+	got := FormatAuditCEF(log)
+
+	wantPrefix := `CEF:0|SafeEdge|SafeEdge Control Plane|0.1.0|odd\|event|odd\|event|3|`
+	if !strings.HasPrefix(got, wantPrefix) {
+		t.Fatalf("header = %q, want prefix %q", got, wantPrefix)
+	}
+	for _, want := range []string{
+		"rt=1772368245123",
+		`cs4=id\=with\nnewline`,
+		"cn1=42",
+		"suser=ops@example.com",
+		"src=192.0.2.10",
+		`msg={"reason":"a\=b"}`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("extension missing %q in %q", want, got)
+		}
+	}
+	if strings.ContainsAny(got, "\r\n") {
+		t.Errorf("CEF line contains a line break: %q", got)
+	}
+
+	log.Result = AuditFailure
+	if got := FormatAuditCEF(log); !strings.Contains(got, "|7|") {
+		t.Errorf("failure severity missing in %q", got)
+	}
+}
+
+// syslogPattern matches an RFC 5424 message: PRI, VERSION, TIMESTAMP,
+// HOSTNAME, APP-NAME, PROCID, MSGID, STRUCTURED-DATA and MSG
+var syslogPattern = regexp.MustCompile(`^<(\d{1,3})>1 (\S+) (\S+) (\S+) (\S+) (\S+) (\[.*?[^\\]\]) (.*)$`)
+
+func TestFormatAuditSyslog(t *testing.T) {
+	log := testAuditLog(7)
+
+	msg := string(FormatAuditSyslog(log, "cp 1", []byte("body")))
+	m := syslogPattern.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("not an RFC 5424 message: %q", msg)
+	}
+
+	// Facility 13 (log audit), severity 5 (notice)
+	if m[1] != "109" {
+		t.Errorf("PRI = %s, want 109", m[1])
+	}
+	if m[2] != "2026-03-01T12:30:45.123456Z" {
+		t.Errorf("TIMESTAMP = %s", m[2])
+	}
+	if m[3] != "cp1" {
+		t.Errorf("HOSTNAME = %s, want spaces removed", m[3])
+	}
+	if m[4] != "safeedge" || m[5] != "-" || m[6] != "device.suspended" {
+		t.Errorf("APP-NAME PROCID MSGID = %s %s %s", m[4], m[5], m[6])
+	}
+	wantSD := `[safeedge@32473 id="6f1c1d1e-8a59-4a55-9a57-0d3c0f0a1b2c" org="00000000-0000-0000-0000-000000000001" seq="7"]`
+	if m[7] != wantSD {
+		t.Errorf("STRUCTURED-DATA = %s, want %s", m[7], wantSD)
+	}
+	if m[8] != "body" {
+		t.Errorf("MSG = %q", m[8])
+	}
+
+	log.Result = AuditFailure
+	if msg := string(FormatAuditSyslog(log, "cp", nil)); !strings.HasPrefix(msg, "<108>1 ") {
+		t.Errorf("failure should be logged at warning severity: %q", msg)
+	}
+
+	log.EventType = ""
+	if msg := string(FormatAuditSyslog(log, "", nil)); !strings.Contains(msg, " - safeedge - - [") {
+		t.Errorf("empty HOSTNAME and MSGID should be nil values: %q", msg)
+	}
+}
+
+func TestSDValueEscaping(t *testing.T) {
+	if got, want := sdValue(`a"b]c\d`), `a\"b\]c\\d`; got != want {
+		t.Errorf("sdValue = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,390 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+)
+
+// Audit sink types
+const (
+	AuditSinkSyslog  = "SYSLOG"
+	AuditSinkWebhook = "WEBHOOK"
+)
+
+const (
+	// DefaultAuditForwardInterval is how often sinks are checked for new entries
+	DefaultAuditForwardInterval = 2 * time.Second
+
+	auditForwardBatchSize  = 500
+	auditForwardMaxBatches = 10
+	auditSinkLease         = 2 * time.Minute
+	auditSinkTimeout       = 10 * time.Second
+	auditSinkMaxBackoff    = 5 * time.Minute
+)
+
+// ErrInvalidAuditSink is returned for an invalid sink configuration
+var ErrInvalidAuditSink = errors.New("invalid audit sink")
+
+// SyslogSinkConfig sends entries as RFC 5424 messages. TCP messages are
+// framed by octet counting (RFC 6587); UDP sends one datagram per entry and
+// cannot detect loss.
+type SyslogSinkConfig struct {
+	Address  string `json:"address"`
+	Protocol string `json:"protocol"`
+	Format   string `json:"format"`
+}
+
+// WebhookSinkConfig POSTs batches of entries, one per line
+type WebhookSinkConfig struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Format  string            `json:"format"`
+}
+
+// NormalizeAuditSinkConfig validates a sink's configuration and fills in
+// defaults, returning the configuration to store
+func NormalizeAuditSinkConfig(sinkType string, config json.RawMessage) ([]byte, error) {
+	var normalized any
+
+	switch sinkType {
+	case AuditSinkSyslog:
+		var c SyslogSinkConfig
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAuditSink, err)
+		}
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return nil, fmt.Errorf("%w: address must be host:port", ErrInvalidAuditSink)
+		}
+		if c.Protocol == "" {
+			c.Protocol = "tcp"
+		}
+		if c.Protocol != "tcp" && c.Protocol != "udp" {
+			return nil, fmt.Errorf("%w: protocol must be tcp or udp", ErrInvalidAuditSink)
+		}
+		if c.Format == "" {
+			c.Format = AuditFormatCEF
+		}
+		if !validAuditFormat(c.Format) {
+			return nil, fmt.Errorf("%w: format must be %s or %s", ErrInvalidAuditSink, AuditFormatNDJSON, AuditFormatCEF)
+		}
+		normalized = c
+
+	case AuditSinkWebhook:
+		var c WebhookSinkConfig
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAuditSink, err)
+		}
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: url must be an http or https URL", ErrInvalidAuditSink)
+		}
+		if c.Format == "" {
+			c.Format = AuditFormatNDJSON
+		}
+		if !validAuditFormat(c.Format) {
+			return nil, fmt.Errorf("%w: format must be %s or %s", ErrInvalidAuditSink, AuditFormatNDJSON, AuditFormatCEF)
+		}
+		normalized = c
+
+	default:
+		return nil, fmt.Errorf("%w: type must be %s or %s", ErrInvalidAuditSink, AuditSinkSyslog, AuditSinkWebhook)
+	}
+
+	return json.Marshal(normalized)
+}
+
+func validAuditFormat(format string) bool {
+	return format == AuditFormatNDJSON || format == AuditFormatCEF
+}
+
+// auditSender delivers a batch of entries to a destination. A batch is
+// delivered only if Send returns nil.
+type auditSender interface {
+	Send(ctx context.Context, logs []generated.AuditLog) error
+}
+
+// auditSinkStore is what the forwarder reads and records in the database
+type auditSinkStore interface {
+	ListDueAuditSinks(ctx context.Context) ([]generated.AuditSink, error)
+	ClaimAuditSink(ctx context.Context, arg generated.ClaimAuditSinkParams) (generated.AuditSink, error)
+	ListAuditChain(ctx context.Context, arg generated.ListAuditChainParams) ([]generated.AuditLog, error)
+	ReleaseAuditSink(ctx context.Context, id uuid.UUID) error
+	RecordAuditSinkDelivery(ctx context.Context, arg generated.RecordAuditSinkDeliveryParams) error
+	RecordAuditSinkFailure(ctx context.Context, arg generated.RecordAuditSinkFailureParams) error
+}
+
+// AuditForwarder streams new audit entries to the configured sinks. Each
+// sink's last_sequence only advances after the destination accepts a
+// batch, so entries are delivered at least once: a failed or interrupted
+// batch is sent again, with exponential backoff between failures.
+type AuditForwarder struct {
+	queries  auditSinkStore
+	interval time.Duration
+	hostname string
+	client   *http.Client
+	logger   *zap.Logger
+}
+
+// NewAuditForwarder creates an audit forwarder
+func NewAuditForwarder(queries *generated.Queries, interval time.Duration, logger *zap.Logger) *AuditForwarder {
+	hostname, _ := os.Hostname()
+
+	return &AuditForwarder{
+		queries:  queries,
+		interval: interval,
+		hostname: hostname,
+		client:   &http.Client{Timeout: auditSinkTimeout},
+		logger:   logger,
+	}
+}
+
+// Run forwards entries until ctx is cancelled
+func (f *AuditForwarder) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.forwardAll(ctx)
+		}
+	}
+}
+
+// forwardAll delivers pending entries to every sink that is due
+func (f *AuditForwarder) forwardAll(ctx context.Context) {
+	sinks, err := f.queries.ListDueAuditSinks(ctx)
+	if err != nil {
+		f.logger.Error("failed to list audit sinks", zap.Error(err))
+		return
+	}
+
+	for _, sink := range sinks {
+		// Another instance may have claimed the sink since it was listed
+		sink, err := f.queries.ClaimAuditSink(ctx, generated.ClaimAuditSinkParams{
+			LeasedUntil: pgtype.Timestamptz{Time: time.Now().Add(auditSinkLease), Valid: true},
+			ID:          sink.ID,
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			f.logger.Error("failed to claim audit sink", zap.Error(err))
+			continue
+		}
+
+		f.forward(ctx, sink)
+	}
+}
+
+// forward delivers the entries after a claimed sink's last_sequence and
+// releases the sink
+func (f *AuditForwarder) forward(ctx context.Context, sink generated.AuditSink) {
+	// The lease must be released even if the forwarder is shutting down
+	ctx = context.WithoutCancel(ctx)
+
+	sender, err := f.sender(sink)
+	if err != nil {
+		f.fail(ctx, sink, err)
+		return
+	}
+
+	last := sink.LastSequence
+	for range auditForwardMaxBatches {
+		logs, err := f.queries.ListAuditChain(ctx, generated.ListAuditChainParams{
+			OrganizationID: sink.OrganizationID,
+			FromSequence:   last + 1,
+			PageSize:       auditForwardBatchSize,
+		})
+		if err != nil {
+			f.logger.Error("failed to list audit entries to forward", zap.Error(err))
+			break
+		}
+		if len(logs) == 0 {
+			break
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, auditSinkTimeout)
+		err = sender.Send(sendCtx, logs)
+		cancel()
+		if err != nil {
+			sink.LastSequence = last
+			f.fail(ctx, sink, err)
+			return
+		}
+
+		last = logs[len(logs)-1].Sequence
+		if len(logs) < auditForwardBatchSize {
+			break
+		}
+	}
+
+	if last == sink.LastSequence {
+		if err := f.queries.ReleaseAuditSink(ctx, sink.ID); err != nil {
+			f.logger.Error("failed to release audit sink", zap.Error(err))
+		}
+		return
+	}
+
+	if err := f.queries.RecordAuditSinkDelivery(ctx, generated.RecordAuditSinkDeliveryParams{
+		LastSequence: last,
+		ID:           sink.ID,
+	}); err != nil {
+		f.logger.Error("failed to record audit sink delivery", zap.Error(err))
+	}
+}
+
+// fail records a delivery failure, keeping the progress in sink.LastSequence,
+// and schedules a retry with exponential backoff
+func (f *AuditForwarder) fail(ctx context.Context, sink generated.AuditSink, cause error) {
+	backoff := auditSinkMaxBackoff
+	if sink.ConsecutiveFailures < 9 {
+		backoff = min(time.Second<<sink.ConsecutiveFailures, auditSinkMaxBackoff)
+	}
+
+	f.logger.Warn("audit sink delivery failed",
+		zap.String("sink_id", sink.ID.String()),
+		zap.String("sink", sink.Name),
+		zap.Duration("retry_in", backoff),
+		zap.Error(cause),
+	)
+
+	if err := f.queries.RecordAuditSinkFailure(ctx, generated.RecordAuditSinkFailureParams{
+		LastSequence:  sink.LastSequence,
+		LastError:     pgtype.Text{String: cause.Error(), Valid: true},
+		NextAttemptAt: pgtype.Timestamptz{Time: time.Now().Add(backoff), Valid: true},
+		ID:            sink.ID,
+	}); err != nil {
+		f.logger.Error("failed to record audit sink failure", zap.Error(err))
+	}
+}
+
+// sender builds the sender for a sink's configuration
+func (f *AuditForwarder) sender(sink generated.AuditSink) (auditSender, error) {
+	switch sink.Type {
+	case AuditSinkSyslog:
+		var c SyslogSinkConfig
+		if err := json.Unmarshal(sink.Config, &c); err != nil {
+			return nil, fmt.Errorf("invalid syslog sink config: %w", err)
+		}
+		return &syslogSender{config: c, hostname: f.hostname}, nil
+
+	case AuditSinkWebhook:
+		var c WebhookSinkConfig
+		if err := json.Unmarshal(sink.Config, &c); err != nil {
+			return nil, fmt.Errorf("invalid webhook sink config: %w", err)
+		}
+		return &webhookSender{config: c, client: f.client}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown audit sink type %q", sink.Type)
+	}
+}
+
+// syslogSender sends each entry as an RFC 5424 message over a connection
+// opened for the batch
+type syslogSender struct {
+	config   SyslogSinkConfig
+	hostname string
+}
+
+func (s *syslogSender) Send(ctx context.Context, logs []generated.AuditLog) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.config.Protocol, s.config.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+	}
+
+	var buf bytes.Buffer
+	for _, log := range logs {
+		body, err := FormatAuditLog(log, s.config.Format)
+		if err != nil {
+			return err
+		}
+		msg := FormatAuditSyslog(log, s.hostname, body)
+
+		if s.config.Protocol == "udp" {
+			if _, err := conn.Write(msg); err != nil {
+				return fmt.Errorf("failed to send to syslog: %w", err)
+			}
+			continue
+		}
+		fmt.Fprintf(&buf, "%d ", len(msg))
+		buf.Write(msg)
+	}
+
+	if buf.Len() > 0 {
+		if _, err := conn.Write(buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to send to syslog: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// webhookSender POSTs a batch as newline-delimited entries
+type webhookSender struct {
+	config WebhookSinkConfig
+	client *http.Client
+}
+
+func (s *webhookSender) Send(ctx context.Context, logs []generated.AuditLog) error {
+	var body bytes.Buffer
+	for _, log := range logs {
+		line, err := FormatAuditLog(log, s.config.Format)
+		if err != nil {
+			return err
+		}
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain")
+	if s.config.Format == AuditFormatNDJSON {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	for k, v := range s.config.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+)
+
+// readOctetCounted splits an RFC 6587 octet-counted stream into messages
+func readOctetCounted(r io.Reader) ([]string, error) {
+	br := bufio.NewReader(r)
+	var msgs []string
+	for {
+		length, err := br.ReadString(' ')
+		if err == io.EOF && length == "" {
+			return msgs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame length: %w", err)
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid frame length %q", length)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(br, msg); err != nil {
+			return nil, fmt.Errorf("frame shorter than its length %d: %w", n, err)
+		}
+		msgs = append(msgs, string(msg))
+	}
+}
+
+func TestSyslogSenderTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	readErr := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			readErr <- err
+			return
+		}
+		defer conn.Close()
+		msgs, err := readOctetCounted(conn)
+		if err != nil {
+			readErr <- err
+			return
+		}
+		received <- msgs
+	}()
+
+	// A newline inside a message must not split it
+	first := testAuditLog(1)
+	first.Metadata = []byte("{\"note\":\"line\\nbreak\"}")
+	logs := []generated.AuditLog{first, testAuditLog(2), testAuditLog(3)}
+
+	sender := &syslogSender{
+		config:   SyslogSinkConfig{Address: listener.Addr().String(), Protocol: "tcp", Format: AuditFormatCEF},
+		hostname: "cp",
+	}
+	if err := sender.Send(context.Background(), logs); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var msgs []string
+	select {
+	case msgs = <-received:
+	case err := <-readErr:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no messages received")
+	}
+
+	if len(msgs) != len(logs) {
+		t.Fatalf("received %d messages, want %d", len(msgs), len(logs))
+	}
+	for i, msg := range msgs {
+		m := syslogPattern.FindStringSubmatch(msg)
+		if m == nil {
+			t.Fatalf("message %d is not RFC 5424: %q", i, msg)
+		}
+		if !strings.HasPrefix(m[8], "CEF:0|SafeEdge|") {
+			t.Errorf("message %d body is not CEF: %q", i, m[8])
+		}
+		if want := `seq="` + strconv.Itoa(i+1) + `"`; !strings.Contains(m[7], want) {
+			t.Errorf("message %d structured data %s lacks %s", i, m[7], want)
+		}
+	}
+}
+
+func TestSyslogSenderUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logs := []generated.AuditLog{testAuditLog(1), testAuditLog(2)}
+	sender := &syslogSender{
+		config:   SyslogSinkConfig{Address: conn.LocalAddr().String(), Protocol: "udp", Format: AuditFormatNDJSON},
+		hostname: "cp",
+	}
+	if err := sender.Send(context.Background(), logs); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64*1024)
+	for i := range logs {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("datagram %d: %v", i, err)
+		}
+		// One message per datagram, without octet counting
+		m := syslogPattern.FindStringSubmatch(string(buf[:n]))
+		if m == nil {
+			t.Fatalf("datagram %d is not RFC 5424: %q", i, buf[:n])
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(m[8]), &record); err != nil {
+			t.Fatalf("datagram %d body is not JSON: %v", i, err)
+		}
+		if record["sequence"] != float64(i+1) {
+			t.Errorf("datagram %d sequence = %v", i, record["sequence"])
+		}
+	}
+}
+
+// fakeAuditStore holds one sink and an organization's audit chain
+type fakeAuditStore struct {
+	mu         sync.Mutex
+	sink       generated.AuditSink
+	logs       []generated.AuditLog
+	deliveries []int64
+	failures   []generated.RecordAuditSinkFailureParams
+}
+
+func (s *fakeAuditStore) ListDueAuditSinks(ctx context.Context) ([]generated.AuditSink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return []generated.AuditSink{s.sink}, nil
+}
+
+func (s *fakeAuditStore) ClaimAuditSink(ctx context.Context, arg generated.ClaimAuditSinkParams) (generated.AuditSink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sink, nil
+}
+
+func (s *fakeAuditStore) ListAuditChain(ctx context.Context, arg generated.ListAuditChainParams) ([]generated.AuditLog, error) {
+	var page []generated.AuditLog
+	for _, log := range s.logs {
+		if log.Sequence >= arg.FromSequence && len(page) < int(arg.PageSize) {
+			page = append(page, log)
+		}
+	}
+	return page, nil
+}
+
+func (s *fakeAuditStore) ReleaseAuditSink(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (s *fakeAuditStore) RecordAuditSinkDelivery(ctx context.Context, arg generated.RecordAuditSinkDeliveryParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries = append(s.deliveries, arg.LastSequence)
+	s.sink.LastSequence = arg.LastSequence
+	s.sink.ConsecutiveFailures = 0
+	return nil
+}
+
+func (s *fakeAuditStore) RecordAuditSinkFailure(ctx context.Context, arg generated.RecordAuditSinkFailureParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, arg)
+	s.sink.LastSequence = arg.LastSequence
+	s.sink.ConsecutiveFailures++
+	return nil
+}
+
+func TestAuditForwarderRetryKeepsLastSequence(t *testing.T) {
+	// The destination accepts the first batch, then refuses until told not to
+	var mu sync.Mutex
+	accept := 1
+	var received []int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if accept == 0 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		accept--
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var record struct {
+				Sequence int64 `json:"sequence"`
+			}
+			json.Unmarshal(scanner.Bytes(), &record)
+			received = append(received, record.Sequence)
+		}
+	}))
+	defer server.Close()
+
+	config, _ := json.Marshal(WebhookSinkConfig{URL: server.URL, Format: AuditFormatNDJSON})
+	store := &fakeAuditStore{
+		sink: generated.AuditSink{
+			ID:     uuid.New(),
+			Name:   "siem",
+			Type:   AuditSinkWebhook,
+			Config: config,
+		},
+	}
+	// Two full batches and a partial one
+	for seq := int64(1); seq <= 2*auditForwardBatchSize+10; seq++ {
+		store.logs = append(store.logs, testAuditLog(seq))
+	}
+
+	forwarder := &AuditForwarder{
+		queries: store,
+		client:  server.Client(),
+		logger:  zap.NewNop(),
+	}
+
+	// The second batch fails: progress stops after the first
+	forwarder.forwardAll(context.Background())
+	if len(store.deliveries) != 0 {
+		t.Fatalf("delivery recorded despite a failed batch: %v", store.deliveries)
+	}
+	if len(store.failures) != 1 {
+		t.Fatalf("recorded %d failures, want 1", len(store.failures))
+	}
+	if got := store.failures[0].LastSequence; got != auditForwardBatchSize {
+		t.Fatalf("failure kept last_sequence %d, want %d", got, auditForwardBatchSize)
+	}
+	if !store.failures[0].NextAttemptAt.Valid || !store.failures[0].NextAttemptAt.Time.After(time.Now()) {
+		t.Errorf("retry not scheduled in the future: %v", store.failures[0].NextAttemptAt)
+	}
+
+	// Still failing: last_sequence does not move
+	forwarder.forwardAll(context.Background())
+	if got := store.failures[1].LastSequence; got != auditForwardBatchSize {
+		t.Fatalf("retry moved last_sequence to %d, want %d", got, auditForwardBatchSize)
+	}
+
+	// Once the destination recovers, delivery resumes after the first batch
+	mu.Lock()
+	accept = 10
+	mu.Unlock()
+	forwarder.forwardAll(context.Background())
+
+	want := int64(2*auditForwardBatchSize + 10)
+	if len(store.deliveries) != 1 || store.deliveries[0] != want {
+		t.Fatalf("deliveries = %v, want [%d]", store.deliveries, want)
+	}
+	if int64(len(received)) != want {
+		t.Fatalf("destination received %d entries, want %d", len(received), want)
+	}
+	for i, seq := range received {
+		if seq != int64(i+1) {
+			t.Fatalf("entry %d has sequence %d: entries lost or repeated", i, seq)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+)
+
+const (
+	commandSweepInterval = 5 * time.Second
+	// commandResultGrace is how long past its timeout a command's result may
+	// take to arrive before the command is failed
+	commandResultGrace = 30 * time.Second
+)
+
+// Command states
+const (
+	CommandPending   = "PENDING"
+	CommandRunning   = "RUNNING"
+	CommandSucceeded = "SUCCEEDED"
+	CommandFailed    = "FAILED"
+	CommandTimedOut  = "TIMED_OUT"
+)
+
+// CommandSender delivers commands to device agents
+type CommandSender interface {
+	// SendCommand sends a command to a device's agent, or returns
+	// ErrDeviceNotConnected if the device has no stream to this instance
+	SendCommand(deviceID uuid.UUID, req *pb.CommandRequest) error
+}
+
+// RunCommandParams describes a command to run on one or more devices
+type RunCommandParams struct {
+	Command string
+	Args    []string
+	Timeout time.Duration
+}
+
+// StartCommandBatchParams describes a command to run on the active devices
+// matching a selector, and belonging to a group if given
+type StartCommandBatchParams struct {
+	RunCommandParams
+	OrganizationID uuid.UUID
+	TargetSelector []byte
+	TargetGroupID  pgtype.UUID
+	MaxConcurrency int32
+}
+
+// CommandService runs commands on devices through their agents. A single
+// device's command is sent right away; a batch's commands are sent as
+// earlier ones complete, keeping at most max_concurrency running. Commands
+// whose result has not arrived well past their timeout are failed.
+type CommandService struct {
+	queries *generated.Queries
+	sender  CommandSender
+	events  *EventBus
+	audit   *AuditRecorder
+	logger  *zap.Logger
+
+	// dispatchMu keeps batches from being dispatched concurrently
+	dispatchMu sync.Mutex
+}
+
+// NewCommandService creates a command service
+func NewCommandService(queries *generated.Queries, sender CommandSender, events *EventBus, audit *AuditRecorder, logger *zap.Logger) *CommandService {
+	return &CommandService{
+		queries: queries,
+		sender:  sender,
+		events:  events,
+		audit:   audit,
+		logger:  logger,
+	}
+}
+
+// Start records a command for a device and sends it to the device's agent.
+// A command that cannot be sent is recorded as FAILED and returned along
+// with the error, ErrDeviceNotConnected if the device is not connected.
+func (s *CommandService) Start(ctx context.Context, device generated.Device, params RunCommandParams) (generated.DeviceCommand, error) {
+	args := params.Args
+	if args == nil {
+		args = []string{}
+	}
+
+	command, err := s.queries.CreateDeviceCommand(ctx, generated.CreateDeviceCommandParams{
+		OrganizationID: device.OrganizationID,
+		DeviceID:       device.ID,
+		Command:        params.Command,
+		Args:           args,
+		TimeoutSeconds: int32(params.Timeout.Seconds()),
+	})
+	if err != nil {
+		return generated.DeviceCommand{}, fmt.Errorf("failed to create command: %w", err)
+	}
+
+	return s.send(ctx, command)
+}
+
+// StartBatch records a batch with a command for every device it targets and
+// sends the first max_concurrency of them
+func (s *CommandService) StartBatch(ctx context.Context, params StartCommandBatchParams) (generated.CommandBatch, error) {
+	args := params.Args
+	if args == nil {
+		args = []string{}
+	}
+
+	batch, err := s.queries.CreateCommandBatch(ctx, generated.CreateCommandBatchParams{
+		OrganizationID: params.OrganizationID,
+		Command:        params.Command,
+		Args:           args,
+		TargetSelector: params.TargetSelector,
+		TargetGroupID:  params.TargetGroupID,
+		TimeoutSeconds: int32(params.Timeout.Seconds()),
+		MaxConcurrency: params.MaxConcurrency,
+	})
+	if err != nil {
+		return generated.CommandBatch{}, fmt.Errorf("failed to create command batch: %w", err)
+	}
+
+	if _, err := s.queries.CreateBatchCommands(ctx, batch.ID); err != nil {
+		return generated.CommandBatch{}, fmt.Errorf("failed to create batch commands: %w", err)
+	}
+
+	s.dispatch(ctx, batch)
+	return batch, nil
+}
+
+// Run dispatches batches as their commands complete and fails commands
+// whose result is overdue, until ctx is cancelled
+func (s *CommandService) Run(ctx context.Context) {
+	events, unsubscribe := s.events.Subscribe(64)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(commandSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			if event.Type != EventCommandCompleted {
+				continue
+			}
+			if batchID, ok := event.Data["batch_id"].(string); ok {
+				s.dispatchBatch(ctx, batchID)
+			}
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+// sweep fails overdue commands and dispatches every open batch, catching up
+// with completions whose events were missed
+func (s *CommandService) sweep(ctx context.Context) {
+	overdue, err := s.queries.FailOverdueDeviceCommands(ctx, generated.FailOverdueDeviceCommandsParams{
+		Error:        "no result from the device",
+		GraceSeconds: int32(commandResultGrace.Seconds()),
+	})
+	if err != nil {
+		s.logger.Error("failed to fail overdue commands", zap.Error(err))
+	}
+	for _, command := range overdue {
+		s.recordFailure(ctx, command)
+	}
+
+	batches, err := s.queries.ListOpenCommandBatches(ctx)
+	if err != nil {
+		s.logger.Error("failed to list open command batches", zap.Error(err))
+		return
+	}
+	for _, batch := range batches {
+		s.dispatch(ctx, batch)
+	}
+}
+
+func (s *CommandService) dispatchBatch(ctx context.Context, batchID string) {
+	id, err := uuid.Parse(batchID)
+	if err != nil {
+		return
+	}
+
+	batch, err := s.queries.GetCommandBatch(ctx, id)
+	if err != nil {
+		s.logger.Error("failed to get command batch", zap.String("batch_id", batchID), zap.Error(err))
+		return
+	}
+	if !batch.CompletedAt.Valid {
+		s.dispatch(ctx, batch)
+	}
+}
+
+// dispatch sends a batch's pending commands while it has free slots, then
+// completes the batch if nothing is left to run
+func (s *CommandService) dispatch(ctx context.Context, batch generated.CommandBatch) {
+	s.dispatchMu.Lock()
+	defer s.dispatchMu.Unlock()
+
+	for {
+		running, err := s.queries.CountRunningBatchCommands(ctx, batch.ID)
+		if err != nil {
+			s.logger.Error("failed to count running commands", zap.String("batch_id", batch.ID.String()), zap.Error(err))
+			return
+		}
+		free := int64(batch.MaxConcurrency) - running
+		if free <= 0 {
+			break
+		}
+
+		claimed, err := s.queries.ClaimBatchCommands(ctx, generated.ClaimBatchCommandsParams{
+			BatchID:     batch.ID,
+			MaxCommands: int32(free),
+		})
+		if err != nil {
+			s.logger.Error("failed to claim batch commands", zap.String("batch_id", batch.ID.String()), zap.Error(err))
+			return
+		}
+
+		// Commands that could not be sent free their slot again
+		sent := 0
+		for _, command := range claimed {
+			if _, err := s.send(ctx, command); err == nil {
+				sent++
+			}
+		}
+		if sent == len(claimed) {
+			break
+		}
+	}
+
+	s.completeBatch(ctx, batch.ID)
+}
+
+// completeBatch completes a batch with no pending or running commands
+func (s *CommandService) completeBatch(ctx context.Context, batchID uuid.UUID) {
+	batch, err := s.queries.CompleteCommandBatch(ctx, batchID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to complete command batch", zap.String("batch_id", batchID.String()), zap.Error(err))
+		return
+	}
+
+	s.logger.Info("command batch completed", zap.String("batch_id", batch.ID.String()))
+
+	s.events.Publish(Event{
+		Type:           EventCommandBatchCompleted,
+		OrganizationID: batch.OrganizationID,
+		ResourceType:   "command_batch",
+		ResourceID:     batch.ID.String(),
+		Data:           map[string]any{"command": batch.Command},
+	})
+}
+
+// send sends a running command to its device, failing it if it cannot be sent
+func (s *CommandService) send(ctx context.Context, command generated.DeviceCommand) (generated.DeviceCommand, error) {
+	err := s.sender.SendCommand(command.DeviceID, &pb.CommandRequest{
+		CommandId:      command.ID.String(),
+		Command:        command.Command,
+		Args:           command.Args,
+		TimeoutSeconds: command.TimeoutSeconds,
+	})
+	if err == nil {
+		return command, nil
+	}
+
+	reason := err.Error()
+	if !errors.Is(err, ErrDeviceNotConnected) {
+		s.logger.Error("failed to send command",
+			zap.String("command_id", command.ID.String()),
+			zap.String("device_id", command.DeviceID.String()),
+			zap.Error(err),
+		)
+		reason = "failed to send the command to the device"
+	}
+
+	failed, failErr := s.queries.FailDeviceCommand(ctx, generated.FailDeviceCommandParams{
+		Error: reason,
+		ID:    command.ID,
+	})
+	if failErr != nil {
+		// The device reported a result in the meantime
+		if !errors.Is(failErr, pgx.ErrNoRows) {
+			s.logger.Error("failed to fail command", zap.String("command_id", command.ID.String()), zap.Error(failErr))
+		}
+		return command, err
+	}
+
+	s.recordFailure(ctx, failed)
+	return failed, err
+}
+
+// recordFailure audits and publishes a command the control plane failed
+func (s *CommandService) recordFailure(ctx context.Context, command generated.DeviceCommand) {
+	s.audit.Record(ctx, AuditEntry{
+		OrganizationID: command.OrganizationID,
+		ActorType:      ActorSystem,
+		EventType:      AuditCommandCompleted,
+		ResourceType:   "device",
+		ResourceID:     command.DeviceID.String(),
+		Action:         "run_command",
+		Result:         AuditFailure,
+		Metadata:       CommandAuditMetadata(command),
+	})
+	s.events.Publish(CommandCompletedEvent(command))
+}
+
+// CommandAuditMetadata records a completed command in full: what was run,
+// how it ended and everything it output
+func CommandAuditMetadata(command generated.DeviceCommand) map[string]any {
+	metadata := map[string]any{
+		"command_id":       command.ID.String(),
+		"command":          command.Command,
+		"args":             command.Args,
+		"state":            command.State,
+		"stdout":           command.Stdout,
+		"stderr":           command.Stderr,
+		"output_truncated": command.OutputTruncated,
+	}
+	if command.BatchID.Valid {
+		metadata["batch_id"] = uuid.UUID(command.BatchID.Bytes).String()
+	}
+	if command.ExitCode.Valid {
+		metadata["exit_code"] = command.ExitCode.Int32
+	}
+	if command.Error.Valid {
+		metadata["error"] = command.Error.String
+	}
+	return metadata
+}
+
+// CommandCompletedEvent is the event published when a command completes
+func CommandCompletedEvent(command generated.DeviceCommand) Event {
+	data := map[string]any{
+		"command_id": command.ID.String(),
+		"device_id":  command.DeviceID.String(),
+		"state":      command.State,
+	}
+	if command.BatchID.Valid {
+		data["batch_id"] = uuid.UUID(command.BatchID.Bytes).String()
+	}
+	if command.ExitCode.Valid {
+		data["exit_code"] = command.ExitCode.Int32
+	}
+	if command.Error.Valid {
+		data["error"] = command.Error.String
+	}
+
+	return Event{
+		Type:           EventCommandCompleted,
+		OrganizationID: command.OrganizationID,
+		ResourceType:   "command",
+		ResourceID:     command.ID.String(),
+		Data:           data,
+	}
+}
+
+// CommandOutputText converts command output to text PostgreSQL and JSON
+// accept, replacing invalid UTF-8 and dropping NUL bytes
+func CommandOutputText(data []byte) string {
+	return strings.ReplaceAll(strings.ToValidUTF8(string(data), "\uFFFD"), "\x00", "")
+}
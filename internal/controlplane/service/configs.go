@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/pkg/devconfig"
+)
+
+// DeviceConfigState is a device's desired configuration beside what it last
+// reported, with the settings that differ
+type DeviceConfigState struct {
+	Desired     devconfig.Document `json:"desired"`
+	DesiredHash string             `json:"desired_hash"`
+	// Reported is the effective state of each desired section, and
+	// AppliedHash the hash of the desired configuration the device last
+	// received, as of ReportedAt
+	Reported    devconfig.Document     `json:"reported"`
+	AppliedHash string                 `json:"applied_hash"`
+	Errors      map[string]string      `json:"errors"`
+	Diff        []devconfig.Difference `json:"diff"`
+	InSync      bool                   `json:"in_sync"`
+	ReportedAt  *time.Time             `json:"reported_at"`
+}
+
+// ConfigService keeps the desired configuration operators set for devices
+// and groups and the effective configuration devices report. A device's
+// desired configuration is its groups' documents merged in group name
+// order, with its own merged over them; agents apply each section with the
+// plugin it names.
+type ConfigService struct {
+	queries *generated.Queries
+	events  *EventBus
+	logger  *zap.Logger
+}
+
+// NewConfigService creates a config service
+func NewConfigService(queries *generated.Queries, events *EventBus, logger *zap.Logger) *ConfigService {
+	return &ConfigService{
+		queries: queries,
+		events:  events,
+		logger:  logger,
+	}
+}
+
+// SetDeviceConfig replaces a device's own configuration document
+func (s *ConfigService) SetDeviceConfig(ctx context.Context, device generated.Device, doc devconfig.Document) (generated.DeviceConfig, error) {
+	config, err := s.queries.UpsertDeviceConfig(ctx, generated.UpsertDeviceConfigParams{
+		DeviceID: device.ID,
+		Document: devconfig.Encode(doc),
+	})
+	if err != nil {
+		return generated.DeviceConfig{}, fmt.Errorf("failed to save device config: %w", err)
+	}
+
+	s.publishDeviceChanged(device)
+	return config, nil
+}
+
+// DeleteDeviceConfig removes a device's own configuration document,
+// returning pgx.ErrNoRows if it has none
+func (s *ConfigService) DeleteDeviceConfig(ctx context.Context, device generated.Device) error {
+	if _, err := s.queries.DeleteDeviceConfig(ctx, device.ID); err != nil {
+		return err
+	}
+
+	s.publishDeviceChanged(device)
+	return nil
+}
+
+// SetGroupConfig replaces a group's configuration document
+func (s *ConfigService) SetGroupConfig(ctx context.Context, group generated.DeviceGroup, doc devconfig.Document) (generated.DeviceGroupConfig, error) {
+	config, err := s.queries.UpsertDeviceGroupConfig(ctx, generated.UpsertDeviceGroupConfigParams{
+		GroupID:  group.ID,
+		Document: devconfig.Encode(doc),
+	})
+	if err != nil {
+		return generated.DeviceGroupConfig{}, fmt.Errorf("failed to save group config: %w", err)
+	}
+
+	s.publishGroupChanged(group)
+	return config, nil
+}
+
+// DeleteGroupConfig removes a group's configuration document, returning
+// pgx.ErrNoRows if it has none
+func (s *ConfigService) DeleteGroupConfig(ctx context.Context, group generated.DeviceGroup) error {
+	if _, err := s.queries.DeleteDeviceGroupConfig(ctx, group.ID); err != nil {
+		return err
+	}
+
+	s.publishGroupChanged(group)
+	return nil
+}
+
+// Desired returns a device's desired configuration
+func (s *ConfigService) Desired(ctx context.Context, deviceID uuid.UUID) (devconfig.Document, error) {
+	groupConfigs, err := s.queries.ListDeviceGroupConfigsForDevice(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group configs: %w", err)
+	}
+
+	desired := devconfig.Document{}
+	for _, config := range groupConfigs {
+		doc, err := devconfig.Parse(config.Document)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config of group %s: %w", config.GroupID, err)
+		}
+		desired = devconfig.Merge(desired, doc)
+	}
+
+	config, err := s.queries.GetDeviceConfig(ctx, deviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return desired, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device config: %w", err)
+	}
+	doc, err := devconfig.Parse(config.Document)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config of device %s: %w", deviceID, err)
+	}
+	return devconfig.Merge(desired, doc), nil
+}
+
+// Update returns the message that sends a device its desired configuration
+func (s *ConfigService) Update(ctx context.Context, deviceID uuid.UUID) (*pb.ConfigUpdate, error) {
+	desired, err := s.Desired(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ConfigUpdate{
+		Hash:     devconfig.Hash(desired),
+		Document: devconfig.Encode(desired),
+	}, nil
+}
+
+// Report records a device's effective configuration, publishing
+// EventDeviceConfigDrifted if it has just drifted. It reports whether the
+// device's desired configuration has changed since it was last sent, such
+// as through a change in its groups, and needs sending again.
+func (s *ConfigService) Report(ctx context.Context, device generated.Device, report *pb.ConfigReport) (bool, error) {
+	reported, err := devconfig.Parse(report.Reported)
+	if err != nil {
+		return false, fmt.Errorf("invalid reported config: %w", err)
+	}
+	errs := make(map[string]string, len(report.Errors))
+	for _, e := range report.Errors {
+		errs[e.Section] = e.Message
+	}
+	errsJSON, err := json.Marshal(errs)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode config errors: %w", err)
+	}
+
+	previous, err := s.queries.GetDeviceConfigReport(ctx, device.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return false, fmt.Errorf("failed to get config report: %w", err)
+	}
+
+	if _, err := s.queries.UpsertDeviceConfigReport(ctx, generated.UpsertDeviceConfigReportParams{
+		DeviceID:    device.ID,
+		DesiredHash: report.DesiredHash,
+		Reported:    devconfig.Encode(reported),
+		Errors:      errsJSON,
+		Drifted:     report.Drifted,
+	}); err != nil {
+		return false, fmt.Errorf("failed to save config report: %w", err)
+	}
+
+	if report.Drifted && !previous.Drifted {
+		s.logger.Warn("device config drifted", zap.String("device_id", device.ID.String()))
+		s.events.Publish(Event{
+			Type:           EventDeviceConfigDrifted,
+			OrganizationID: device.OrganizationID,
+			ResourceType:   "device",
+			ResourceID:     device.ID.String(),
+			Data:           map[string]any{"desired_hash": report.DesiredHash},
+		})
+	}
+
+	desired, err := s.Desired(ctx, device.ID)
+	if err != nil {
+		return false, err
+	}
+	return devconfig.Hash(desired) != report.DesiredHash, nil
+}
+
+// State returns a device's desired configuration beside what it last
+// reported
+func (s *ConfigService) State(ctx context.Context, deviceID uuid.UUID) (DeviceConfigState, error) {
+	desired, err := s.Desired(ctx, deviceID)
+	if err != nil {
+		return DeviceConfigState{}, err
+	}
+	state := DeviceConfigState{
+		Desired:     desired,
+		DesiredHash: devconfig.Hash(desired),
+		Reported:    devconfig.Document{},
+		Errors:      map[string]string{},
+	}
+
+	report, err := s.queries.GetDeviceConfigReport(ctx, deviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		state.Diff = devconfig.Diff(desired, state.Reported)
+		state.InSync = len(desired) == 0
+		return state, nil
+	}
+	if err != nil {
+		return DeviceConfigState{}, fmt.Errorf("failed to get config report: %w", err)
+	}
+
+	if state.Reported, err = devconfig.Parse(report.Reported); err != nil {
+		return DeviceConfigState{}, fmt.Errorf("invalid reported config: %w", err)
+	}
+	if err := json.Unmarshal(report.Errors, &state.Errors); err != nil {
+		return DeviceConfigState{}, fmt.Errorf("invalid config errors: %w", err)
+	}
+	state.AppliedHash = report.DesiredHash
+	state.ReportedAt = &report.ReportedAt
+	state.Diff = devconfig.Diff(desired, state.Reported)
+	state.InSync = state.AppliedHash == state.DesiredHash && len(state.Diff) == 0 && len(state.Errors) == 0
+	return state, nil
+}
+
+func (s *ConfigService) publishDeviceChanged(device generated.Device) {
+	s.events.Publish(Event{
+		Type:           EventDeviceConfigChanged,
+		OrganizationID: device.OrganizationID,
+		ResourceType:   "device",
+		ResourceID:     device.ID.String(),
+	})
+}
+
+func (s *ConfigService) publishGroupChanged(group generated.DeviceGroup) {
+	s.events.Publish(Event{
+		Type:           EventDeviceGroupConfigChanged,
+		OrganizationID: group.OrganizationID,
+		ResourceType:   "device_group",
+		ResourceID:     group.ID.String(),
+	})
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Fleet event types
+const (
+	EventDeviceEnrolled       = "device.enrolled"
+	EventDeviceOnline         = "device.online"
+	EventDeviceOffline        = "device.offline"
+	EventDeviceSuspended      = "device.suspended"
+	EventDeviceReactivated    = "device.reactivated"
+	EventDeviceDecommissioned = "device.decommissioned"
+
+	// EventDeviceConfigChanged and EventDeviceGroupConfigChanged report a
+	// change to the desired configuration set for a device or group
+	EventDeviceConfigChanged      = "device.config_changed"
+	EventDeviceGroupConfigChanged = "device_group.config_changed"
+	// EventDeviceConfigDrifted reports a device whose effective configuration
+	// has come to differ from its desired one
+	EventDeviceConfigDrifted = "device.config_drifted"
+
+	EventRolloutStateChanged = "rollout.state_changed"
+	EventRolloutDeviceFailed = "rollout.device_failed"
+	// EventRolloutDeviceUpdated reports each update status a device acks
+	EventRolloutDeviceUpdated = "rollout.device_updated"
+
+	EventAccessStarted = "access.started"
+	// EventAccessEnded reports an access session terminated by its user or
+	// the control plane, or expired
+	EventAccessEnded = "access.ended"
+
+	// EventCommandOutput carries a chunk of a running command's output
+	EventCommandOutput    = "command.output"
+	EventCommandCompleted = "command.completed"
+	// EventCommandBatchCompleted reports a batch all of whose commands have
+	// completed
+	EventCommandBatchCompleted = "command_batch.completed"
+)
+
+// Event is a fleet event delivered to in-process subscribers
+type Event struct {
+	ID             uuid.UUID      `json:"id"`
+	Type           string         `json:"type"`
+	OrganizationID uuid.UUID      `json:"organization_id"`
+	ResourceType   string         `json:"resource_type"`
+	ResourceID     string         `json:"resource_id"`
+	Timestamp      time.Time      `json:"timestamp"`
+	Data           map[string]any `json:"data,omitempty"`
+}
+
+// EventBus fans out fleet events to subscribers. Publishing never blocks;
+// events are dropped for subscribers that fall behind, except for queued
+// subscribers, for whom they wait.
+type EventBus struct {
+	logger *zap.Logger
+
+	mu          sync.RWMutex
+	nextID      int
+	subscribers map[int]chan Event
+	queues      map[int]*eventQueue
+}
+
+// eventQueue holds the events published for a queued subscriber that it
+// has not received yet
+type eventQueue struct {
+	mu     sync.Mutex
+	events []Event
+	// ready is signalled when events are queued
+	ready chan struct{}
+}
+
+func (q *eventQueue) push(event Event) {
+	q.mu.Lock()
+	q.events = append(q.events, event)
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *eventQueue) take() []Event {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	events := q.events
+	q.events = nil
+	return events
+}
+
+// NewEventBus creates an empty event bus
+func NewEventBus(logger *zap.Logger) *EventBus {
+	return &EventBus{
+		logger:      logger,
+		subscribers: make(map[int]chan Event),
+		queues:      make(map[int]*eventQueue),
+	}
+}
+
+// Publish delivers an event to all current subscribers
+func (b *EventBus) Publish(event Event) {
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for id, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			b.logger.Warn("event subscriber is full, dropping event",
+				zap.Int("subscriber", id),
+				zap.String("event_type", event.Type),
+			)
+		}
+	}
+	for _, q := range b.queues {
+		q.push(event)
+	}
+}
+
+// Subscribe registers a subscriber with the given buffer size. The returned
+// function unsubscribes and closes the channel.
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan Event, buffer)
+	b.subscribers[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, id)
+			close(ch)
+		})
+	}
+}
+
+// SubscribeQueued registers a subscriber that receives every event, for
+// those that must not miss any, such as the webhook dispatcher. Events it
+// has not received yet are queued without bound, so it must keep up on
+// average. The returned function unsubscribes and closes the channel.
+func (b *EventBus) SubscribeQueued() (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	q := &eventQueue{ready: make(chan struct{}, 1)}
+	b.queues[id] = q
+
+	ch := make(chan Event)
+	done := make(chan struct{})
+	go func() {
+		defer close(ch)
+		for {
+			for _, event := range q.take() {
+				select {
+				case ch <- event:
+				case <-done:
+					return
+				}
+			}
+			select {
+			case <-q.ready:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.queues, id)
+			close(done)
+		})
+	}
+}
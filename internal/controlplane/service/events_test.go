@@ -0,0 +1,62 @@
+package service
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestSubscribeQueuedReceivesEveryEvent(t *testing.T) {
+	bus := NewEventBus(zap.NewNop())
+	events, unsubscribe := bus.SubscribeQueued()
+	defer unsubscribe()
+	dropped, unsubscribeDropped := bus.Subscribe(1)
+	defer unsubscribeDropped()
+
+	// Far more than any buffered subscriber holds, published before any is
+	// received
+	const n = 5000
+	for i := range n {
+		bus.Publish(Event{Type: EventDeviceOnline, ResourceID: strconv.Itoa(i)})
+	}
+
+	for i := range n {
+		select {
+		case event := <-events:
+			if event.ResourceID != strconv.Itoa(i) {
+				t.Fatalf("event %d: got resource %s", i, event.ResourceID)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event %d", i)
+		}
+	}
+
+	if got := len(dropped); got != 1 {
+		t.Errorf("buffered subscriber holds %d events, want 1", got)
+	}
+}
+
+func TestSubscribeQueuedUnsubscribe(t *testing.T) {
+	bus := NewEventBus(zap.NewNop())
+	events, unsubscribe := bus.SubscribeQueued()
+
+	bus.Publish(Event{Type: EventDeviceOnline})
+	unsubscribe()
+	unsubscribe()
+
+	// Events not yet received are discarded and the channel closed
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				bus.Publish(Event{Type: EventDeviceOffline})
+				return
+			}
+		case <-deadline:
+			t.Fatal("channel not closed after unsubscribing")
+		}
+	}
+}
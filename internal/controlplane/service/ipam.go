@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -29,28 +30,50 @@ func NewIPAM(queries *generated.Queries, cidr string) (*IPAM, error) {
 	}, nil
 }
 
-// AllocateIP allocates the next available IP address in the subnet
-func (i *IPAM) AllocateIP(ctx context.Context, orgID string) (net.IP, error) {
+// ErrSubnetExhausted is returned when every address in the subnet is leased
+var ErrSubnetExhausted = errors.New("no free WireGuard IP addresses")
+
+// Lease allocates the lowest address in the subnet not leased to a device
+// or access session client and passes it to record, which stores the lease.
+// The allocation lock is held until record returns, so concurrent leases
+// cannot pick the same address. The network address, the hub address (the
+// first host) and the broadcast address are never allocated.
+// Decommissioned devices release their lease.
+func (i *IPAM) Lease(ctx context.Context, record func(ip net.IP) error) error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	// Get all allocated IPs from database
-	// For simplicity, we'll use a sequential allocation strategy
-	// In production, you'd want a more sophisticated approach with IP pools
+	ip, err := i.allocate(ctx)
+	if err != nil {
+		return err
+	}
+	return record(ip)
+}
 
-	// Start from the first usable IP in the subnet
-	ip := incrementIP(i.subnet.IP)
+// allocate returns the lowest free address. i.mu must be held.
+func (i *IPAM) allocate(ctx context.Context) (net.IP, error) {
+	leased, err := i.queries.ListLeasedWireguardIPs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list leased IPs: %w", err)
+	}
 
-	// Check if IP is already in use by querying devices
-	// This is a simple implementation - in production you'd want:
-	// 1. IP pool management in database
-	// 2. Lease tracking
-	// 3. IP recycling
+	inUse := make(map[string]bool, len(leased))
+	for _, ip := range leased {
+		inUse[ip.String()] = true
+	}
 
-	// For now, we'll just use a simple counter-based approach
-	// TODO: Implement proper IP pool management
+	// Skip the network and hub addresses
+	ip := incrementIP(incrementIP(i.subnet.IP))
+	for ; i.subnet.Contains(ip); ip = incrementIP(ip) {
+		if isBroadcast(ip, i.subnet) {
+			break
+		}
+		if !inUse[ip.String()] {
+			return ip, nil
+		}
+	}
 
-	return ip, nil
+	return nil, ErrSubnetExhausted
 }
 
 // incrementIP increments an IP address by one
@@ -70,6 +93,16 @@ func incrementIP(ip net.IP) net.IP {
 	return result
 }
 
+// isBroadcast reports whether ip is the last address of subnet
+func isBroadcast(ip net.IP, subnet *net.IPNet) bool {
+	for i := range subnet.Mask {
+		if ip[len(ip)-len(subnet.Mask)+i]|subnet.Mask[i] != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
 // IsIPInSubnet checks if an IP is within the managed subnet
 func (i *IPAM) IsIPInSubnet(ip net.IP) bool {
 	return i.subnet.Contains(ip)
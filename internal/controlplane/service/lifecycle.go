@@ -0,0 +1,538 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+// Device statuses
+const (
+	DeviceStatusActive         = "ACTIVE"
+	DeviceStatusSuspended      = "SUSPENDED"
+	DeviceStatusDecommissioned = "DECOMMISSIONED"
+)
+
+// Re-enrollment statuses
+const (
+	ReenrollmentPending  = "PENDING"
+	ReenrollmentApproved = "APPROVED"
+	ReenrollmentRejected = "REJECTED"
+)
+
+// Key types and revocation reasons recorded in device_key_revocations
+const (
+	KeyTypeEd25519   = "ED25519"
+	KeyTypeWireGuard = "WIREGUARD"
+
+	RevocationRotated        = "ROTATED"
+	RevocationReenrolled     = "REENROLLED"
+	RevocationDecommissioned = "DECOMMISSIONED"
+)
+
+var (
+	// ErrKeyRevoked is returned when a device presents a key that has been revoked
+	ErrKeyRevoked = errors.New("key has been revoked")
+	// ErrDeviceDecommissioned is returned for operations on a decommissioned device
+	ErrDeviceDecommissioned = errors.New("device is decommissioned")
+	// ErrReenrollmentNotPending is returned when deciding an already decided re-enrollment
+	ErrReenrollmentNotPending = errors.New("re-enrollment is not pending")
+	// ErrInvalidKeyRotation is returned when a key rotation request fails validation
+	ErrInvalidKeyRotation = errors.New("invalid key rotation")
+)
+
+// EnrollParams describes a device enrolling with new keys
+type EnrollParams struct {
+	OrganizationID     uuid.UUID
+	PublicKey          string
+	WireguardPublicKey string
+	Platform           string
+	AgentVersion       string
+	SiteTag            string
+}
+
+// Disconnector closes device streams
+type Disconnector interface {
+	// Disconnect closes a device's stream if it is connected to this
+	// instance
+	Disconnect(deviceID, reason string)
+}
+
+// DeviceLifecycle enrolls, suspends, re-enrolls and decommissions devices
+// and rotates their keys, keeping WireGuard IP leases, hub peers, access
+// sessions, rollouts and the key revocation list in step with the devices
+// table. Suspending or decommissioning a device closes its stream. The
+// database writes of each operation are made in one transaction; hub peers,
+// streams and events follow once it commits.
+type DeviceLifecycle struct {
+	db           *pgxpool.Pool
+	queries      *generated.Queries
+	ipam         *IPAM
+	peers        PeerManager
+	events       *EventBus
+	disconnector Disconnector
+	logger       *zap.Logger
+}
+
+// NewDeviceLifecycle creates a device lifecycle manager
+func NewDeviceLifecycle(db *pgxpool.Pool, queries *generated.Queries, ipam *IPAM, peers PeerManager, events *EventBus, logger *zap.Logger) *DeviceLifecycle {
+	return &DeviceLifecycle{
+		db:      db,
+		queries: queries,
+		ipam:    ipam,
+		peers:   peers,
+		events:  events,
+		logger:  logger,
+	}
+}
+
+// SetDisconnector sets what closes the streams of suspended and
+// decommissioned devices. Streams on other instances are closed when their
+// next heartbeat is refused.
+func (l *DeviceLifecycle) SetDisconnector(d Disconnector) {
+	l.disconnector = d
+}
+
+// Enroll creates a device, leases it a WireGuard IP and adds it to the hub
+func (l *DeviceLifecycle) Enroll(ctx context.Context, params EnrollParams) (generated.Device, error) {
+	if err := l.checkNotRevoked(ctx, params.PublicKey, params.WireguardPublicKey); err != nil {
+		return generated.Device{}, err
+	}
+
+	var device generated.Device
+	err := l.ipam.Lease(ctx, func(ip net.IP) error {
+		var err error
+		device, err = l.queries.CreateDevice(ctx, generated.CreateDeviceParams{
+			OrganizationID:     params.OrganizationID,
+			PublicKey:          params.PublicKey,
+			WireguardPublicKey: params.WireguardPublicKey,
+			WireguardIp:        ip,
+			AgentVersion:       params.AgentVersion,
+			Platform:           params.Platform,
+			SiteTag:            textOrNull(params.SiteTag),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create device: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return generated.Device{}, err
+	}
+
+	l.addPeer(ctx, device.WireguardPublicKey, device.WireguardIp)
+	l.publish(EventDeviceEnrolled, device)
+
+	return device, nil
+}
+
+// Suspend cuts a device off until it is reactivated: its hub peer is
+// removed, its access sessions are terminated, it is skipped by running
+// rollouts and its stream is closed. Reconnection is refused while it is
+// suspended.
+func (l *DeviceLifecycle) Suspend(ctx context.Context, device generated.Device) (generated.Device, error) {
+	switch device.Status {
+	case DeviceStatusDecommissioned:
+		return generated.Device{}, ErrDeviceDecommissioned
+	case DeviceStatusSuspended:
+		return device, nil
+	}
+
+	var updated generated.Device
+	var sessions []generated.AccessSession
+	err := l.inTx(ctx, func(q *generated.Queries) error {
+		var err error
+		updated, err = q.UpdateDeviceStatus(ctx, generated.UpdateDeviceStatusParams{
+			ID:     device.ID,
+			Status: DeviceStatusSuspended,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update device status: %w", err)
+		}
+		sessions, err = l.cutOff(ctx, q, device)
+		return err
+	})
+	if err != nil {
+		return generated.Device{}, err
+	}
+	l.disconnect(device, ReasonSuspended)
+	l.removePeers(ctx, device, sessions)
+
+	l.publish(EventDeviceSuspended, updated)
+	l.logger.Info("device suspended", zap.String("device_id", device.ID.String()))
+
+	return updated, nil
+}
+
+// Reactivate undoes Suspend: the hub peer is restored, the device may
+// reconnect and it rejoins the rollouts it was skipped by. Terminated access
+// sessions stay terminated.
+func (l *DeviceLifecycle) Reactivate(ctx context.Context, device generated.Device) (generated.Device, error) {
+	switch device.Status {
+	case DeviceStatusDecommissioned:
+		return generated.Device{}, ErrDeviceDecommissioned
+	case DeviceStatusActive:
+		return device, nil
+	}
+
+	updated, err := l.queries.UpdateDeviceStatus(ctx, generated.UpdateDeviceStatusParams{
+		ID:     device.ID,
+		Status: DeviceStatusActive,
+	})
+	if err != nil {
+		return generated.Device{}, fmt.Errorf("failed to update device status: %w", err)
+	}
+
+	if err := l.queries.ResumeDeviceRollouts(ctx, device.ID); err != nil {
+		return generated.Device{}, fmt.Errorf("failed to resume device rollouts: %w", err)
+	}
+
+	l.addPeer(ctx, updated.WireguardPublicKey, updated.WireguardIp)
+
+	l.publish(EventDeviceReactivated, updated)
+	l.logger.Info("device reactivated", zap.String("device_id", device.ID.String()))
+
+	return updated, nil
+}
+
+// Decommission permanently retires a device: its keys are revoked, its hub
+// peer removed and its WireGuard IP released, and it is cut off as by
+// Suspend. Only an approved re-enrollment brings it back.
+func (l *DeviceLifecycle) Decommission(ctx context.Context, device generated.Device) (generated.Device, error) {
+	if device.Status == DeviceStatusDecommissioned {
+		return device, nil
+	}
+
+	var updated generated.Device
+	var sessions []generated.AccessSession
+	err := l.inTx(ctx, func(q *generated.Queries) error {
+		var err error
+		updated, err = q.UpdateDeviceStatus(ctx, generated.UpdateDeviceStatusParams{
+			ID:     device.ID,
+			Status: DeviceStatusDecommissioned,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update device status: %w", err)
+		}
+		if err := l.revokeKeys(ctx, q, device, RevocationDecommissioned); err != nil {
+			return err
+		}
+		sessions, err = l.cutOff(ctx, q, device)
+		return err
+	})
+	if err != nil {
+		return generated.Device{}, err
+	}
+	l.disconnect(device, ReasonDecommissioned)
+	l.removePeers(ctx, device, sessions)
+
+	l.publish(EventDeviceDecommissioned, updated)
+	l.logger.Info("device decommissioned", zap.String("device_id", device.ID.String()))
+
+	return updated, nil
+}
+
+// RequestReenrollment records a request to bind new keys to device. It
+// replaces any request still pending for the device.
+func (l *DeviceLifecycle) RequestReenrollment(ctx context.Context, device generated.Device, params EnrollParams) (generated.DeviceReenrollment, error) {
+	if err := l.checkNotRevoked(ctx, params.PublicKey, params.WireguardPublicKey); err != nil {
+		return generated.DeviceReenrollment{}, err
+	}
+
+	if err := l.queries.SupersedePendingReenrollments(ctx, device.ID); err != nil {
+		return generated.DeviceReenrollment{}, fmt.Errorf("failed to supersede pending re-enrollments: %w", err)
+	}
+
+	reenrollment, err := l.queries.CreateDeviceReenrollment(ctx, generated.CreateDeviceReenrollmentParams{
+		OrganizationID:     device.OrganizationID,
+		DeviceID:           device.ID,
+		PublicKey:          params.PublicKey,
+		WireguardPublicKey: params.WireguardPublicKey,
+		Platform:           params.Platform,
+		AgentVersion:       params.AgentVersion,
+	})
+	if err != nil {
+		return generated.DeviceReenrollment{}, fmt.Errorf("failed to create re-enrollment: %w", err)
+	}
+
+	l.logger.Info("device re-enrollment requested",
+		zap.String("device_id", device.ID.String()),
+		zap.String("reenrollment_id", reenrollment.ID.String()),
+	)
+
+	return reenrollment, nil
+}
+
+// ApproveReenrollment binds the requested keys to the device and reactivates
+// it. The old keys are revoked. A decommissioned device is leased a new IP.
+// The approval, revocation and new keys are stored together or not at all.
+func (l *DeviceLifecycle) ApproveReenrollment(ctx context.Context, id uuid.UUID) (generated.DeviceReenrollment, generated.Device, error) {
+	reenrollment, err := l.queries.GetDeviceReenrollment(ctx, id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return generated.DeviceReenrollment{}, generated.Device{}, ErrReenrollmentNotPending
+	}
+	if err != nil {
+		return generated.DeviceReenrollment{}, generated.Device{}, fmt.Errorf("failed to get re-enrollment: %w", err)
+	}
+
+	device, err := l.queries.GetDevice(ctx, reenrollment.DeviceID)
+	if err != nil {
+		return generated.DeviceReenrollment{}, generated.Device{}, fmt.Errorf("failed to get device: %w", err)
+	}
+
+	var updated generated.Device
+	reenroll := func(ip net.IP) error {
+		return l.inTx(ctx, func(q *generated.Queries) error {
+			var err error
+			reenrollment, err = l.decide(ctx, q, id, ReenrollmentApproved)
+			if err != nil {
+				return err
+			}
+			if err := l.revokeKeys(ctx, q, device, RevocationReenrolled); err != nil {
+				return err
+			}
+			updated, err = q.ReenrollDevice(ctx, generated.ReenrollDeviceParams{
+				ID:                 device.ID,
+				PublicKey:          reenrollment.PublicKey,
+				WireguardPublicKey: reenrollment.WireguardPublicKey,
+				WireguardIp:        ip,
+				Platform:           reenrollment.Platform,
+				AgentVersion:       reenrollment.AgentVersion,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to re-enroll device: %w", err)
+			}
+			return nil
+		})
+	}
+	if device.Status == DeviceStatusDecommissioned {
+		err = l.ipam.Lease(ctx, reenroll)
+	} else {
+		err = reenroll(device.WireguardIp)
+	}
+	if err != nil {
+		return generated.DeviceReenrollment{}, generated.Device{}, err
+	}
+
+	if device.Status != DeviceStatusDecommissioned {
+		l.removePeer(ctx, device.WireguardPublicKey)
+	}
+	l.addPeer(ctx, updated.WireguardPublicKey, updated.WireguardIp)
+	l.publish(EventDeviceEnrolled, updated)
+
+	l.logger.Info("device re-enrolled",
+		zap.String("device_id", device.ID.String()),
+		zap.String("reenrollment_id", reenrollment.ID.String()),
+		zap.String("wireguard_ip", updated.WireguardIp.String()),
+	)
+
+	return reenrollment, updated, nil
+}
+
+// RejectReenrollment discards a pending re-enrollment request
+func (l *DeviceLifecycle) RejectReenrollment(ctx context.Context, id uuid.UUID) (generated.DeviceReenrollment, error) {
+	return l.decide(ctx, l.queries, id, ReenrollmentRejected)
+}
+
+// RotateKeys replaces a device's keys with ones it has proven it holds by
+// signing crypto.KeyRotationMessage with the new Ed25519 key. The old keys
+// are revoked and the hub peer is swapped.
+func (l *DeviceLifecycle) RotateKeys(ctx context.Context, device generated.Device, publicKey, wireguardPublicKey string, signature []byte) (generated.Device, error) {
+	if device.Status == DeviceStatusDecommissioned {
+		return generated.Device{}, ErrDeviceDecommissioned
+	}
+	if publicKey == device.PublicKey || wireguardPublicKey == device.WireguardPublicKey {
+		return generated.Device{}, fmt.Errorf("%w: both keys must change", ErrInvalidKeyRotation)
+	}
+	if _, err := crypto.ParseWireGuardPublicKey(wireguardPublicKey); err != nil {
+		return generated.Device{}, fmt.Errorf("%w: %v", ErrInvalidKeyRotation, err)
+	}
+
+	msg := crypto.KeyRotationMessage(device.ID.String(), device.PublicKey, publicKey, wireguardPublicKey)
+	if !crypto.VerifyEd25519(publicKey, msg, signature) {
+		return generated.Device{}, fmt.Errorf("%w: bad signature", ErrInvalidKeyRotation)
+	}
+
+	if err := l.checkNotRevoked(ctx, publicKey, wireguardPublicKey); err != nil {
+		return generated.Device{}, err
+	}
+
+	var updated generated.Device
+	err := l.inTx(ctx, func(q *generated.Queries) error {
+		var err error
+		updated, err = q.UpdateDeviceKeys(ctx, generated.UpdateDeviceKeysParams{
+			ID:                 device.ID,
+			PublicKey:          publicKey,
+			WireguardPublicKey: wireguardPublicKey,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update device keys: %w", err)
+		}
+		return l.revokeKeys(ctx, q, device, RevocationRotated)
+	})
+	if err != nil {
+		return generated.Device{}, err
+	}
+
+	l.removePeer(ctx, device.WireguardPublicKey)
+	l.addPeer(ctx, updated.WireguardPublicKey, updated.WireguardIp)
+
+	l.logger.Info("device keys rotated", zap.String("device_id", device.ID.String()))
+
+	return updated, nil
+}
+
+// IsKeyRevoked reports whether publicKey appears on the revocation list
+func (l *DeviceLifecycle) IsKeyRevoked(ctx context.Context, publicKey string) (bool, error) {
+	revoked, err := l.queries.IsDeviceKeyRevoked(ctx, publicKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to check key revocation: %w", err)
+	}
+	return revoked, nil
+}
+
+// cutOff terminates a device's access sessions and skips it in running
+// rollouts, returning the sessions it terminated
+func (l *DeviceLifecycle) cutOff(ctx context.Context, q *generated.Queries, device generated.Device) ([]generated.AccessSession, error) {
+	sessions, err := q.TerminateDeviceAccessSessions(ctx, device.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to terminate access sessions: %w", err)
+	}
+
+	if err := q.SkipDeviceRollouts(ctx, device.ID); err != nil {
+		return nil, fmt.Errorf("failed to skip device rollouts: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// removePeers removes the hub peers of a device cut off and of the clients
+// of its terminated access sessions
+func (l *DeviceLifecycle) removePeers(ctx context.Context, device generated.Device, sessions []generated.AccessSession) {
+	l.removePeer(ctx, device.WireguardPublicKey)
+
+	for _, session := range sessions {
+		if session.ClientWireguardPublicKey.Valid {
+			l.removePeer(ctx, session.ClientWireguardPublicKey.String)
+		}
+		l.events.Publish(accessEndedEvent(device, session, AccessEndedCutOff))
+	}
+	if len(sessions) > 0 {
+		l.logger.Info("access sessions terminated",
+			zap.String("device_id", device.ID.String()),
+			zap.Int("count", len(sessions)),
+		)
+	}
+}
+
+// disconnect closes a device's stream directly rather than through the
+// event bus, which drops events for subscribers that fall behind
+func (l *DeviceLifecycle) disconnect(device generated.Device, reason string) {
+	if l.disconnector != nil {
+		l.disconnector.Disconnect(device.ID.String(), reason)
+	}
+}
+
+func (l *DeviceLifecycle) publish(eventType string, device generated.Device) {
+	l.events.Publish(Event{
+		Type:           eventType,
+		OrganizationID: device.OrganizationID,
+		ResourceType:   "device",
+		ResourceID:     device.ID.String(),
+		Data:           map[string]any{"status": device.Status},
+	})
+}
+
+// inTx runs fn with queries bound to a transaction, committing it if fn
+// succeeds
+func (l *DeviceLifecycle) inTx(ctx context.Context, fn func(q *generated.Queries) error) error {
+	tx, err := l.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(l.queries.WithTx(tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (l *DeviceLifecycle) decide(ctx context.Context, q *generated.Queries, id uuid.UUID, status string) (generated.DeviceReenrollment, error) {
+	reenrollment, err := q.DecideDeviceReenrollment(ctx, generated.DecideDeviceReenrollmentParams{
+		ID:     id,
+		Status: status,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return generated.DeviceReenrollment{}, ErrReenrollmentNotPending
+	}
+	if err != nil {
+		return generated.DeviceReenrollment{}, fmt.Errorf("failed to update re-enrollment: %w", err)
+	}
+	return reenrollment, nil
+}
+
+func (l *DeviceLifecycle) checkNotRevoked(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		revoked, err := l.IsKeyRevoked(ctx, key)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrKeyRevoked
+		}
+	}
+	return nil
+}
+
+func (l *DeviceLifecycle) revokeKeys(ctx context.Context, q *generated.Queries, device generated.Device, reason string) error {
+	for keyType, key := range map[string]string{
+		KeyTypeEd25519:   device.PublicKey,
+		KeyTypeWireGuard: device.WireguardPublicKey,
+	} {
+		if err := q.RevokeDeviceKey(ctx, generated.RevokeDeviceKeyParams{
+			PublicKey: key,
+			DeviceID:  device.ID,
+			KeyType:   keyType,
+			Reason:    reason,
+		}); err != nil {
+			return fmt.Errorf("failed to revoke %s key: %w", keyType, err)
+		}
+	}
+	return nil
+}
+
+// Hub peer changes are best effort; the device table is the source of truth
+// and peers can be reconciled from it
+
+func (l *DeviceLifecycle) addPeer(ctx context.Context, publicKey string, ip net.IP) {
+	if err := l.peers.AddPeer(ctx, publicKey, ip); err != nil {
+		l.logger.Error("failed to add WireGuard peer", zap.String("wireguard_ip", ip.String()), zap.Error(err))
+	}
+}
+
+func (l *DeviceLifecycle) removePeer(ctx context.Context, publicKey string) {
+	if err := l.peers.RemovePeer(ctx, publicKey); err != nil {
+		l.logger.Error("failed to remove WireGuard peer", zap.Error(err))
+	}
+}
+
+func textOrNull(s string) pgtype.Text {
+	if s == "" {
+		return pgtype.Text{}
+	}
+	return pgtype.Text{String: s, Valid: true}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+)
+
+const (
+	// DefaultLogRetention is how long shipped device logs are kept
+	DefaultLogRetention = 7 * 24 * time.Hour
+
+	logMaintenanceInterval = time.Hour
+)
+
+// LogEntry is a log entry from one of a device's log sources. Timestamp is
+// nil if the agent could not determine it.
+type LogEntry struct {
+	Source    string     `json:"source"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Message   string     `json:"message"`
+}
+
+// LogQuery selects stored log entries: the most recent Limit entries logged
+// between Since and Until from Sources, or from every source if empty
+type LogQuery struct {
+	Since   time.Time
+	Until   time.Time
+	Sources []string
+	Limit   int32
+}
+
+// LogCollector asks connected devices for their logs
+type LogCollector interface {
+	// CollectLogs sends a log request to a device's agent and returns the
+	// batches it answers with. The channel is closed after the last batch of
+	// a request that is not followed, or once ctx is done or the device
+	// disconnects.
+	CollectLogs(ctx context.Context, deviceID uuid.UUID, req *pb.LogRequest) (<-chan *pb.LogBatch, error)
+}
+
+// LogService stores the logs devices ship continuously and serves them back
+type LogService struct {
+	queries   *generated.Queries
+	logger    *zap.Logger
+	retention time.Duration
+}
+
+// NewLogService creates a log service that keeps entries for retention
+func NewLogService(queries *generated.Queries, retention time.Duration, logger *zap.Logger) *LogService {
+	return &LogService{
+		queries:   queries,
+		logger:    logger,
+		retention: retention,
+	}
+}
+
+// Store stores entries a device shipped. Entries without a timestamp are
+// stored as logged when they were received.
+func (s *LogService) Store(ctx context.Context, deviceID uuid.UUID, receivedAt time.Time, entries []*pb.LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	params := generated.InsertDeviceLogsParams{
+		DeviceID: deviceID,
+		Sources:  make([]string, 0, len(entries)),
+		LoggedAt: make([]time.Time, 0, len(entries)),
+		Messages: make([]string, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		loggedAt := receivedAt
+		if entry.Timestamp != nil {
+			loggedAt = entry.Timestamp.AsTime()
+		}
+		params.Sources = append(params.Sources, entry.Source)
+		params.LoggedAt = append(params.LoggedAt, loggedAt)
+		params.Messages = append(params.Messages, entry.Message)
+	}
+
+	if err := s.queries.InsertDeviceLogs(ctx, params); err != nil {
+		return fmt.Errorf("failed to insert device logs: %w", err)
+	}
+	return nil
+}
+
+// List returns stored entries matching a query, oldest first
+func (s *LogService) List(ctx context.Context, deviceID uuid.UUID, query LogQuery) ([]LogEntry, error) {
+	rows, err := s.queries.ListDeviceLogs(ctx, generated.ListDeviceLogsParams{
+		DeviceID:   deviceID,
+		Since:      query.Since,
+		Until:      query.Until,
+		Sources:    query.Sources,
+		MaxEntries: query.Limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device logs: %w", err)
+	}
+
+	entries := make([]LogEntry, 0, len(rows))
+	for _, row := range slices.Backward(rows) {
+		loggedAt := row.LoggedAt
+		entries = append(entries, LogEntry{
+			Source:    row.Source,
+			Timestamp: &loggedAt,
+			Message:   row.Message,
+		})
+	}
+	return entries, nil
+}
+
+// Run deletes entries older than the retention period until ctx is cancelled
+func (s *LogService) Run(ctx context.Context) {
+	s.prune(ctx)
+
+	ticker := time.NewTicker(logMaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.prune(ctx)
+		}
+	}
+}
+
+func (s *LogService) prune(ctx context.Context) {
+	if err := s.queries.DeleteOldDeviceLogs(ctx, time.Now().Add(-s.retention)); err != nil {
+		s.logger.Error("failed to delete old device logs", zap.Error(err))
+	}
+}
+
+// LogEntryFromProto converts an entry received from an agent
+func LogEntryFromProto(entry *pb.LogEntry) LogEntry {
+	e := LogEntry{Source: entry.Source, Message: entry.Message}
+	if entry.Timestamp != nil {
+		ts := entry.Timestamp.AsTime()
+		e.Timestamp = &ts
+	}
+	return e
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+)
+
+const (
+	// DefaultMetricsRawRetention is how long raw heartbeat metrics are kept
+	DefaultMetricsRawRetention = 7 * 24 * time.Hour
+	// DefaultMetricsRollupRetention is how long hourly rollups are kept
+	DefaultMetricsRollupRetention = 90 * 24 * time.Hour
+
+	metricsMaintenanceInterval = time.Hour
+	metricsMinStep             = time.Minute
+	metricsMaxPoints           = 2000
+)
+
+// ErrInvalidMetricsQuery is returned when a series query has an invalid range or step
+var ErrInvalidMetricsQuery = errors.New("invalid metrics query")
+
+// MetricsPoint is a single aggregated point of a device metrics series
+type MetricsPoint struct {
+	Timestamp             time.Time `json:"timestamp"`
+	Samples               int32     `json:"samples"`
+	CPUPercentAvg         float64   `json:"cpu_percent_avg"`
+	CPUPercentMax         float64   `json:"cpu_percent_max"`
+	MemoryPercentAvg      float64   `json:"memory_percent_avg"`
+	MemoryPercentMax      float64   `json:"memory_percent_max"`
+	DiskUsedBytesMax      int64     `json:"disk_used_bytes_max"`
+	DiskTotalBytes        int64     `json:"disk_total_bytes"`
+	Load1Avg              float64   `json:"load1_avg"`
+	NetworkRxBytesMax     int64     `json:"network_rx_bytes_max"`
+	NetworkTxBytesMax     int64     `json:"network_tx_bytes_max"`
+	TemperatureMaxCelsius *float64  `json:"temperature_max_celsius,omitempty"`
+}
+
+// MetricsSeries is a device metrics series over a time range
+type MetricsSeries struct {
+	DeviceID   string         `json:"device_id"`
+	From       time.Time      `json:"from"`
+	To         time.Time      `json:"to"`
+	Step       string         `json:"step"`
+	Resolution string         `json:"resolution"` // raw, hourly
+	Points     []MetricsPoint `json:"points"`
+}
+
+// MetricsService stores heartbeat metrics and serves downsampled series
+type MetricsService struct {
+	queries         *generated.Queries
+	logger          *zap.Logger
+	rawRetention    time.Duration
+	rollupRetention time.Duration
+}
+
+// NewMetricsService creates a metrics service. Raw samples are kept for
+// rawRetention and hourly rollups for rollupRetention.
+func NewMetricsService(queries *generated.Queries, rawRetention, rollupRetention time.Duration, logger *zap.Logger) *MetricsService {
+	return &MetricsService{
+		queries:         queries,
+		logger:          logger,
+		rawRetention:    rawRetention,
+		rollupRetention: rollupRetention,
+	}
+}
+
+// Record stores a heartbeat metrics sample for a device
+func (s *MetricsService) Record(ctx context.Context, deviceID uuid.UUID, recordedAt time.Time, m *pb.DeviceMetrics) error {
+	var rxBytes, txBytes uint64
+	for _, iface := range m.NetworkInterfaces {
+		rxBytes += iface.RxBytes
+		txBytes += iface.TxBytes
+	}
+
+	var maxTemp pgtype.Float8
+	for _, t := range m.Temperatures {
+		if !maxTemp.Valid || t.Celsius > maxTemp.Float64 {
+			maxTemp = pgtype.Float8{Float64: t.Celsius, Valid: true}
+		}
+	}
+
+	err := s.queries.InsertDeviceMetrics(ctx, generated.InsertDeviceMetricsParams{
+		DeviceID:              deviceID,
+		RecordedAt:            recordedAt,
+		CpuPercent:            m.CpuPercent,
+		MemoryPercent:         m.MemoryPercent,
+		MemoryTotalBytes:      clampInt64(m.MemoryTotalBytes),
+		DiskUsedBytes:         clampInt64(m.DiskUsedBytes),
+		DiskTotalBytes:        clampInt64(m.DiskTotalBytes),
+		UptimeSeconds:         m.UptimeSeconds,
+		Load1:                 m.Load1,
+		Load5:                 m.Load5,
+		Load15:                m.Load15,
+		NetworkRxBytes:        clampInt64(rxBytes),
+		NetworkTxBytes:        clampInt64(txBytes),
+		MaxTemperatureCelsius: maxTemp,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert device metrics: %w", err)
+	}
+
+	return nil
+}
+
+// Series returns metrics for a device between from and to aggregated into
+// buckets of step. Ranges reaching past raw retention are served from the
+// hourly rollups, with the step rounded up to whole hours.
+func (s *MetricsService) Series(ctx context.Context, deviceID uuid.UUID, from, to time.Time, step time.Duration) (*MetricsSeries, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidMetricsQuery)
+	}
+	if step < metricsMinStep {
+		return nil, fmt.Errorf("%w: step must be at least %s", ErrInvalidMetricsQuery, metricsMinStep)
+	}
+
+	resolution := "raw"
+	if from.Before(time.Now().Add(-s.rawRetention)) {
+		resolution = "hourly"
+		if step < time.Hour {
+			step = time.Hour
+		}
+		step = step.Truncate(time.Hour)
+	}
+
+	if to.Sub(from)/step > metricsMaxPoints {
+		return nil, fmt.Errorf("%w: range yields more than %d points", ErrInvalidMetricsQuery, metricsMaxPoints)
+	}
+
+	interval := pgtype.Interval{Microseconds: step.Microseconds(), Valid: true}
+
+	series := &MetricsSeries{
+		DeviceID:   deviceID.String(),
+		From:       from,
+		To:         to,
+		Step:       step.String(),
+		Resolution: resolution,
+		Points:     []MetricsPoint{},
+	}
+
+	if resolution == "raw" {
+		rows, err := s.queries.GetDeviceMetricsSeries(ctx, generated.GetDeviceMetricsSeriesParams{
+			Step:     interval,
+			DeviceID: deviceID,
+			FromTime: from,
+			ToTime:   to,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query device metrics: %w", err)
+		}
+		for _, r := range rows {
+			series.Points = append(series.Points, MetricsPoint{
+				Timestamp:             r.Bucket,
+				Samples:               r.Samples,
+				CPUPercentAvg:         r.CpuPercentAvg,
+				CPUPercentMax:         r.CpuPercentMax,
+				MemoryPercentAvg:      r.MemoryPercentAvg,
+				MemoryPercentMax:      r.MemoryPercentMax,
+				DiskUsedBytesMax:      r.DiskUsedBytesMax,
+				DiskTotalBytes:        r.DiskTotalBytes,
+				Load1Avg:              r.Load1Avg,
+				NetworkRxBytesMax:     r.NetworkRxBytesMax,
+				NetworkTxBytesMax:     r.NetworkTxBytesMax,
+				TemperatureMaxCelsius: temperature(r.TemperatureSamples, r.TemperatureMaxCelsius),
+			})
+		}
+		return series, nil
+	}
+
+	rows, err := s.queries.GetDeviceMetricsHourlySeries(ctx, generated.GetDeviceMetricsHourlySeriesParams{
+		Step:     interval,
+		DeviceID: deviceID,
+		FromTime: from,
+		ToTime:   to,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hourly device metrics: %w", err)
+	}
+	for _, r := range rows {
+		series.Points = append(series.Points, MetricsPoint{
+			Timestamp:             r.Bucket,
+			Samples:               r.Samples,
+			CPUPercentAvg:         r.CpuPercentAvg,
+			CPUPercentMax:         r.CpuPercentMax,
+			MemoryPercentAvg:      r.MemoryPercentAvg,
+			MemoryPercentMax:      r.MemoryPercentMax,
+			DiskUsedBytesMax:      r.DiskUsedBytesMax,
+			DiskTotalBytes:        r.DiskTotalBytes,
+			Load1Avg:              r.Load1Avg,
+			NetworkRxBytesMax:     r.NetworkRxBytesMax,
+			NetworkTxBytesMax:     r.NetworkTxBytesMax,
+			TemperatureMaxCelsius: temperature(r.TemperatureSamples, r.TemperatureMaxCelsius),
+		})
+	}
+
+	return series, nil
+}
+
+// Run performs partition management, downsampling and retention until ctx is cancelled
+func (s *MetricsService) Run(ctx context.Context) {
+	s.maintain(ctx)
+
+	ticker := time.NewTicker(metricsMaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.maintain(ctx)
+		}
+	}
+}
+
+// maintain runs one maintenance pass. Every step is idempotent, so a failed
+// pass is simply retried on the next tick.
+func (s *MetricsService) maintain(ctx context.Context) {
+	now := time.Now().UTC()
+
+	// Keep partitions for yesterday through the next few days so inserts never miss
+	if err := s.queries.CreateDeviceMetricsPartitions(ctx, generated.CreateDeviceMetricsPartitionsParams{
+		StartAt: now.Add(-24 * time.Hour),
+		Days:    5,
+	}); err != nil {
+		s.logger.Error("failed to create device metrics partitions", zap.Error(err))
+	}
+
+	// Re-roll the last few complete hours to pick up late samples
+	currentHour := now.Truncate(time.Hour)
+	if err := s.queries.RollupDeviceMetricsHourly(ctx, generated.RollupDeviceMetricsHourlyParams{
+		FromTime: currentHour.Add(-3 * time.Hour),
+		ToTime:   currentHour,
+	}); err != nil {
+		s.logger.Error("failed to roll up device metrics", zap.Error(err))
+	}
+
+	dropped, err := s.queries.DropDeviceMetricsPartitions(ctx, now.Add(-s.rawRetention))
+	if err != nil {
+		s.logger.Error("failed to drop old device metrics partitions", zap.Error(err))
+	} else if dropped > 0 {
+		s.logger.Info("dropped old device metrics partitions", zap.Int32("count", dropped))
+	}
+
+	if err := s.queries.DeleteOldDeviceMetricsHourly(ctx, now.Add(-s.rollupRetention)); err != nil {
+		s.logger.Error("failed to delete old hourly device metrics", zap.Error(err))
+	}
+}
+
+// temperature returns nil when no sample in the bucket carried a temperature
+func temperature(samples int32, celsius float64) *float64 {
+	if samples == 0 {
+		return nil
+	}
+	return &celsius
+}
+
+// clampInt64 converts an unsigned counter to BIGINT, saturating on overflow
+func clampInt64(v uint64) int64 {
+	if v > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(v)
+}
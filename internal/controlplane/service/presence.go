@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+)
+
+// DefaultOfflineAfter is how long a device may go without a heartbeat before it is offline
+const DefaultOfflineAfter = 5 * time.Minute
+
+// Connectivity states
+const (
+	ConnectivityOnline  = "ONLINE"
+	ConnectivityOffline = "OFFLINE"
+)
+
+// Connection event types recorded in device_connection_events
+const (
+	ConnectionEventConnected    = "CONNECTED"
+	ConnectionEventDisconnected = "DISCONNECTED"
+)
+
+// Disconnect reasons
+const (
+	ReasonStreamOpened     = "stream opened"
+	ReasonStreamClosed     = "stream closed"
+	ReasonStreamError      = "stream error"
+	ReasonHeartbeatTimeout = "heartbeat timeout"
+	ReasonHeartbeatResumed = "heartbeat resumed"
+	ReasonSuspended        = "device suspended"
+	ReasonDecommissioned   = "device decommissioned"
+)
+
+const presenceSweepInterval = 30 * time.Second
+
+// Connectivity describes whether a device is currently reachable
+type Connectivity struct {
+	State          string     `json:"state"`
+	Streaming      bool       `json:"streaming"`
+	LastSeenAt     *time.Time `json:"last_seen_at,omitempty"`
+	ConnectedSince *time.Time `json:"connected_since,omitempty"`
+}
+
+// devicePresence is the in-memory state of a device with a live stream
+type devicePresence struct {
+	organizationID uuid.UUID
+	connectedAt    time.Time
+	lastHeartbeat  time.Time
+	online         bool
+}
+
+// transition is a presence change to be recorded and published
+type transition struct {
+	deviceID       uuid.UUID
+	organizationID uuid.UUID
+	eventType      string
+	reason         string
+}
+
+// PresenceService tracks device online/offline state. A device is online
+// while it has a live stream and has sent a heartbeat within offlineAfter.
+// Devices streaming to another control plane instance are judged by
+// last_seen_at alone.
+type PresenceService struct {
+	queries      *generated.Queries
+	events       *EventBus
+	audit        *AuditRecorder
+	logger       *zap.Logger
+	offlineAfter time.Duration
+
+	mu      sync.Mutex
+	devices map[uuid.UUID]*devicePresence
+}
+
+// NewPresenceService creates a presence tracker
+func NewPresenceService(queries *generated.Queries, events *EventBus, audit *AuditRecorder, offlineAfter time.Duration, logger *zap.Logger) *PresenceService {
+	return &PresenceService{
+		queries:      queries,
+		events:       events,
+		audit:        audit,
+		logger:       logger,
+		offlineAfter: offlineAfter,
+		devices:      make(map[uuid.UUID]*devicePresence),
+	}
+}
+
+// Heartbeat records a heartbeat received on a device's live stream. The first
+// heartbeat on a stream, or one after a timeout, brings the device online.
+func (s *PresenceService) Heartbeat(ctx context.Context, deviceID, organizationID uuid.UUID) {
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	p, ok := s.devices[deviceID]
+	var t *transition
+	switch {
+	case !ok:
+		p = &devicePresence{organizationID: organizationID, connectedAt: now}
+		s.devices[deviceID] = p
+		t = &transition{deviceID, organizationID, ConnectionEventConnected, ReasonStreamOpened}
+	case !p.online:
+		t = &transition{deviceID, organizationID, ConnectionEventConnected, ReasonHeartbeatResumed}
+	}
+	p.online = true
+	p.lastHeartbeat = now
+	s.mu.Unlock()
+
+	if t != nil {
+		s.apply(ctx, *t)
+	}
+}
+
+// Disconnected records that a device's stream has ended
+func (s *PresenceService) Disconnected(ctx context.Context, deviceID uuid.UUID, reason string) {
+	s.mu.Lock()
+	p, ok := s.devices[deviceID]
+	delete(s.devices, deviceID)
+	s.mu.Unlock()
+
+	// Devices already timed out were recorded as offline by the sweep
+	if !ok || !p.online {
+		return
+	}
+
+	s.apply(ctx, transition{deviceID, p.organizationID, ConnectionEventDisconnected, reason})
+}
+
+// Connectivity returns the connectivity of a device
+func (s *PresenceService) Connectivity(device generated.Device) Connectivity {
+	c := Connectivity{State: ConnectivityOffline}
+
+	if device.LastSeenAt.Valid {
+		lastSeen := device.LastSeenAt.Time
+		c.LastSeenAt = &lastSeen
+		if time.Since(lastSeen) < s.offlineAfter {
+			c.State = ConnectivityOnline
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.devices[device.ID]; ok {
+		c.Streaming = true
+		connectedAt := p.connectedAt
+		c.ConnectedSince = &connectedAt
+		if p.online {
+			c.State = ConnectivityOnline
+		} else {
+			c.State = ConnectivityOffline
+		}
+	}
+
+	return c
+}
+
+// IsOnline reports whether the device has a live, heartbeating stream on this instance
+func (s *PresenceService) IsOnline(deviceID uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.devices[deviceID]
+	return ok && p.online
+}
+
+// Run marks devices offline when their heartbeats stop, until ctx is cancelled
+func (s *PresenceService) Run(ctx context.Context) {
+	ticker := time.NewTicker(presenceSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+// sweep marks streaming devices without a recent heartbeat as offline
+func (s *PresenceService) sweep(ctx context.Context) {
+	cutoff := time.Now().Add(-s.offlineAfter)
+
+	var timedOut []transition
+	s.mu.Lock()
+	for id, p := range s.devices {
+		if p.online && p.lastHeartbeat.Before(cutoff) {
+			p.online = false
+			timedOut = append(timedOut, transition{id, p.organizationID, ConnectionEventDisconnected, ReasonHeartbeatTimeout})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, t := range timedOut {
+		s.apply(ctx, t)
+	}
+}
+
+// apply records a presence transition and publishes the matching fleet event
+func (s *PresenceService) apply(ctx context.Context, t transition) {
+	// Streams are often torn down because their context was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	if _, err := s.queries.CreateDeviceConnectionEvent(ctx, generated.CreateDeviceConnectionEventParams{
+		DeviceID:  t.deviceID,
+		EventType: t.eventType,
+		Reason:    t.reason,
+	}); err != nil {
+		s.logger.Error("failed to record connection event",
+			zap.String("device_id", t.deviceID.String()),
+			zap.Error(err),
+		)
+	}
+
+	eventType, auditType, action := EventDeviceOnline, AuditDeviceConnected, "connect"
+	if t.eventType == ConnectionEventDisconnected {
+		eventType, auditType, action = EventDeviceOffline, AuditDeviceDisconnected, "disconnect"
+	}
+
+	s.audit.Record(ctx, AuditEntry{
+		OrganizationID: t.organizationID,
+		ActorType:      ActorDevice,
+		Actor:          t.deviceID.String(),
+		EventType:      auditType,
+		ResourceType:   "device",
+		ResourceID:     t.deviceID.String(),
+		Action:         action,
+		Metadata:       map[string]any{"reason": t.reason},
+	})
+
+	s.logger.Info("device presence changed",
+		zap.String("device_id", t.deviceID.String()),
+		zap.String("event", eventType),
+		zap.String("reason", t.reason),
+	)
+
+	s.events.Publish(Event{
+		Type:           eventType,
+		OrganizationID: t.organizationID,
+		ResourceType:   "device",
+		ResourceID:     t.deviceID.String(),
+		Data:           map[string]any{"reason": t.reason},
+	})
+}
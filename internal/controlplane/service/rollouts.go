@@ -0,0 +1,600 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+)
+
+const (
+	rolloutSweepInterval = 5 * time.Second
+	// rolloutUpdateTimeout is how long a device may take to report the
+	// outcome of an update before it is failed
+	rolloutUpdateTimeout = time.Hour
+)
+
+// Rollout states
+const (
+	RolloutDraft    = "DRAFT"
+	RolloutCanary   = "CANARY"
+	RolloutFull     = "FULL"
+	RolloutComplete = "COMPLETE"
+	RolloutRollback = "ROLLBACK"
+	RolloutFailed   = "FAILED"
+)
+
+// States of a device within a rollout
+const (
+	RolloutDevicePending    = "PENDING"
+	RolloutDeviceInProgress = "IN_PROGRESS"
+	RolloutDeviceHealthy    = "HEALTHY"
+	RolloutDeviceUnhealthy  = "UNHEALTHY"
+	RolloutDeviceRolledBack = "ROLLED_BACK"
+	RolloutDeviceSkipped    = "SKIPPED"
+)
+
+// ErrRolloutState is returned for an action the rollout's state does not
+// allow, such as starting a rollout that is not a draft
+var ErrRolloutState = errors.New("rollout state does not allow this")
+
+// UpdateSender delivers updates and rollbacks to device agents
+type UpdateSender interface {
+	// SendUpdateNotification sends an update to a device's agent, or returns
+	// ErrDeviceNotConnected if the device has no stream to this instance
+	SendUpdateNotification(deviceID string, update *pb.UpdateNotification) error
+	// SendRollbackRequest asks a device's agent to reinstate what a rollout
+	// replaced, or returns ErrDeviceNotConnected
+	SendRollbackRequest(deviceID string, rollback *pb.RollbackRequest) error
+}
+
+// RolloutService moves rollouts through their states. Starting a rollout
+// targets the active devices it matches and sends the update to its
+// canaries; once every canary reports a healthy update and they stay so for
+// the soak time, the rest are sent it, and the rollout completes when all
+// have reported. A device reporting a failed update or health check rolls
+// the rollout back: devices it updated are asked to reinstate what it
+// replaced and it ends FAILED. Devices that are not connected are sent
+// their update when they are.
+type RolloutService struct {
+	db        *pgxpool.Pool
+	queries   *generated.Queries
+	artifacts *ArtifactStore
+	sender    UpdateSender
+	events    *EventBus
+	audit     *AuditRecorder
+	logger    *zap.Logger
+
+	// advanceMu keeps rollouts from being advanced concurrently
+	advanceMu sync.Mutex
+}
+
+// NewRolloutService creates a rollout service
+func NewRolloutService(db *pgxpool.Pool, queries *generated.Queries, artifacts *ArtifactStore, events *EventBus, audit *AuditRecorder, logger *zap.Logger) *RolloutService {
+	return &RolloutService{
+		db:        db,
+		queries:   queries,
+		artifacts: artifacts,
+		events:    events,
+		audit:     audit,
+		logger:    logger,
+	}
+}
+
+// SetSender sets what delivers updates and rollbacks to agents. Rollouts
+// are not advanced until it is set.
+func (s *RolloutService) SetSender(sender UpdateSender) {
+	s.advanceMu.Lock()
+	defer s.advanceMu.Unlock()
+	s.sender = sender
+}
+
+// Start moves a DRAFT rollout to CANARY, targeting the active devices it
+// matches now, and sends the update to its canaries
+func (s *RolloutService) Start(ctx context.Context, rollout generated.Rollout) (generated.Rollout, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return generated.Rollout{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	q := s.queries.WithTx(tx)
+	started, err := q.TransitionRollout(ctx, generated.TransitionRolloutParams{
+		State:      RolloutCanary,
+		ID:         rollout.ID,
+		FromStates: []string{RolloutDraft},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return generated.Rollout{}, ErrRolloutState
+	}
+	if err != nil {
+		return generated.Rollout{}, fmt.Errorf("failed to start rollout: %w", err)
+	}
+
+	devices, err := q.CreateRolloutDevices(ctx, rollout.ID)
+	if err != nil {
+		return generated.Rollout{}, fmt.Errorf("failed to target rollout devices: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return generated.Rollout{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	canaries := 0
+	for _, device := range devices {
+		if device.IsCanary {
+			canaries++
+		}
+	}
+	s.logger.Info("rollout started",
+		zap.String("rollout_id", rollout.ID.String()),
+		zap.Int("devices", len(devices)),
+		zap.Int("canaries", canaries),
+	)
+	s.publishState(ctx, started, rollout.State, "")
+
+	return s.advance(ctx, started), nil
+}
+
+// Abort rolls back a running rollout, or fails a draft
+func (s *RolloutService) Abort(ctx context.Context, rollout generated.Rollout) (generated.Rollout, error) {
+	to, from := RolloutRollback, []string{RolloutCanary, RolloutFull}
+	if rollout.State == RolloutDraft {
+		to, from = RolloutFailed, []string{RolloutDraft}
+	}
+
+	aborted, err := s.queries.TransitionRollout(ctx, generated.TransitionRolloutParams{
+		State:      to,
+		ID:         rollout.ID,
+		FromStates: from,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return generated.Rollout{}, ErrRolloutState
+	}
+	if err != nil {
+		return generated.Rollout{}, fmt.Errorf("failed to abort rollout: %w", err)
+	}
+
+	s.logger.Info("rollout aborted", zap.String("rollout_id", rollout.ID.String()))
+	s.publishState(ctx, aborted, rollout.State, "aborted")
+
+	return s.advance(ctx, aborted), nil
+}
+
+// ReportUpdate records the outcome of an update a device reports
+func (s *RolloutService) ReportUpdate(ctx context.Context, device generated.Device, ack *pb.UpdateAck) {
+	var status, reason string
+	var result []byte
+	switch ack.Status {
+	case pb.UpdateStatus_UPDATE_STATUS_SUCCESS:
+		status = RolloutDeviceHealthy
+	case pb.UpdateStatus_UPDATE_STATUS_FAILED:
+		status, reason = RolloutDeviceUnhealthy, "update failed"
+		result, _ = json.Marshal(map[string]any{"error": ack.ErrorMessage})
+	default:
+		// Progress is only published
+		return
+	}
+
+	s.recordResult(ctx, device, ack.RolloutId, status, result, reason, ack.ErrorMessage)
+}
+
+// ReportHealth records the result of the health check a device ran after
+// updating. A failed check fails the device's update.
+func (s *RolloutService) ReportHealth(ctx context.Context, device generated.Device, health *pb.HealthReport) {
+	result, _ := json.Marshal(map[string]any{
+		"healthy":          health.Healthy,
+		"health_check_url": health.HealthCheckUrl,
+		"http_status_code": health.HttpStatusCode,
+		"error":            health.ErrorMessage,
+		"checked_at":       health.Timestamp.AsTime(),
+	})
+
+	if !health.Healthy {
+		s.recordResult(ctx, device, health.RolloutId, RolloutDeviceUnhealthy, result, "health check failed", health.ErrorMessage)
+		return
+	}
+
+	rolloutID, err := uuid.Parse(health.RolloutId)
+	if err != nil {
+		return
+	}
+	if err := s.queries.RecordRolloutDeviceHealth(ctx, generated.RecordRolloutDeviceHealthParams{
+		RolloutID:         rolloutID,
+		DeviceID:          device.ID,
+		HealthCheckResult: result,
+	}); err != nil {
+		s.logger.Error("failed to record health check", zap.String("rollout_id", health.RolloutId), zap.Error(err))
+	}
+}
+
+// recordResult records a device's update as HEALTHY or UNHEALTHY, unless an
+// outcome was already recorded, and advances its rollout
+func (s *RolloutService) recordResult(ctx context.Context, device generated.Device, rolloutIDText, status string, result []byte, reason, errorMessage string) {
+	rolloutID, err := uuid.Parse(rolloutIDText)
+	if err != nil {
+		return
+	}
+
+	recorded, err := s.queries.RecordRolloutDeviceResult(ctx, generated.RecordRolloutDeviceResultParams{
+		Status:            status,
+		HealthCheckResult: result,
+		RolloutID:         rolloutID,
+		DeviceID:          device.ID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		s.logger.Error("failed to record rollout device result",
+			zap.String("rollout_id", rolloutIDText),
+			zap.String("device_id", device.ID.String()),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if status == RolloutDeviceUnhealthy {
+		s.publishDeviceFailed(device.OrganizationID, recorded, reason, errorMessage)
+	}
+
+	rollout, err := s.queries.GetRollout(ctx, rolloutID)
+	if err != nil {
+		s.logger.Error("failed to get rollout", zap.String("rollout_id", rolloutIDText), zap.Error(err))
+		return
+	}
+
+	// An update that finished after its rollout failed is undone right away
+	if rollout.State == RolloutFailed && status == RolloutDeviceHealthy {
+		s.advanceMu.Lock()
+		s.rollBack(ctx, rollout, recorded)
+		s.advanceMu.Unlock()
+		return
+	}
+	s.advance(ctx, rollout)
+}
+
+// Run advances running rollouts, sending updates to devices that have
+// connected since and completing soaks, until ctx is cancelled
+func (s *RolloutService) Run(ctx context.Context) {
+	ticker := time.NewTicker(rolloutSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *RolloutService) sweep(ctx context.Context) {
+	rollouts, err := s.queries.ListRunningRollouts(ctx)
+	if err != nil {
+		s.logger.Error("failed to list running rollouts", zap.Error(err))
+		return
+	}
+	for _, rollout := range rollouts {
+		s.advance(ctx, rollout)
+	}
+}
+
+// advance moves a rollout through as many states as its devices allow,
+// returning it as it is left
+func (s *RolloutService) advance(ctx context.Context, rollout generated.Rollout) generated.Rollout {
+	s.advanceMu.Lock()
+	defer s.advanceMu.Unlock()
+
+	if s.sender == nil {
+		return rollout
+	}
+
+	for {
+		var next, reason string
+		switch rollout.State {
+		case RolloutCanary, RolloutFull:
+			next, reason = s.progress(ctx, rollout)
+		case RolloutRollback:
+			if s.rollBackAll(ctx, rollout) {
+				next = RolloutFailed
+			}
+		}
+		if next == "" {
+			return rollout
+		}
+
+		moved, err := s.queries.TransitionRollout(ctx, generated.TransitionRolloutParams{
+			State:      next,
+			ID:         rollout.ID,
+			FromStates: []string{rollout.State},
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Aborted in the meantime
+			moved, err = s.queries.GetRollout(ctx, rollout.ID)
+		}
+		if err != nil {
+			s.logger.Error("failed to move rollout",
+				zap.String("rollout_id", rollout.ID.String()),
+				zap.String("state", next),
+				zap.Error(err),
+			)
+			return rollout
+		}
+		if moved.State == next {
+			s.logger.Info("rollout state changed",
+				zap.String("rollout_id", rollout.ID.String()),
+				zap.String("state", next),
+				zap.String("reason", reason),
+			)
+			s.publishState(ctx, moved, rollout.State, reason)
+		}
+		rollout = moved
+	}
+}
+
+// progress fails devices that stopped reporting, sends the update to the
+// devices of the rollout's phase and returns the state the rollout moves
+// to, if any, and why
+func (s *RolloutService) progress(ctx context.Context, rollout generated.Rollout) (string, string) {
+	canary := rollout.State == RolloutCanary
+
+	stalled, err := s.queries.FailStalledRolloutDevices(ctx, generated.FailStalledRolloutDevicesParams{
+		Error:          "no result from the device",
+		RolloutID:      rollout.ID,
+		TimeoutSeconds: int32(rolloutUpdateTimeout.Seconds()),
+	})
+	if err != nil {
+		s.logger.Error("failed to fail stalled rollout devices", zap.String("rollout_id", rollout.ID.String()), zap.Error(err))
+	}
+	for _, device := range stalled {
+		s.publishDeviceFailed(rollout.OrganizationID, device, "no result from the device", "")
+	}
+
+	devices, err := s.queries.ListRolloutDeviceStatuses(ctx, rollout.ID)
+	if err != nil {
+		s.logger.Error("failed to list rollout devices", zap.String("rollout_id", rollout.ID.String()), zap.Error(err))
+		return "", ""
+	}
+
+	open := 0
+	var lastHealthy time.Time
+	for _, device := range devices {
+		if device.Status == RolloutDeviceUnhealthy {
+			return RolloutRollback, fmt.Sprintf("device %s failed", device.DeviceID)
+		}
+		if canary && !device.IsCanary {
+			continue
+		}
+		switch device.Status {
+		case RolloutDevicePending, RolloutDeviceInProgress:
+			open++
+		case RolloutDeviceHealthy:
+			if device.UpdatedAt.After(lastHealthy) {
+				lastHealthy = device.UpdatedAt
+			}
+		}
+	}
+
+	if open > 0 {
+		s.dispatch(ctx, rollout, canary)
+		return "", ""
+	}
+	if !canary {
+		return RolloutComplete, ""
+	}
+
+	soak := time.Duration(rollout.SoakTimeSeconds) * time.Second
+	if time.Since(lastHealthy) < soak {
+		return "", ""
+	}
+	return RolloutFull, ""
+}
+
+// dispatch sends the update to the rollout's pending devices, only its
+// canaries if canariesOnly. Devices that cannot be sent it stay pending.
+func (s *RolloutService) dispatch(ctx context.Context, rollout generated.Rollout, canariesOnly bool) {
+	claimed, err := s.queries.ClaimRolloutDevices(ctx, generated.ClaimRolloutDevicesParams{
+		RolloutID:    rollout.ID,
+		CanariesOnly: canariesOnly,
+	})
+	if err != nil {
+		s.logger.Error("failed to claim rollout devices", zap.String("rollout_id", rollout.ID.String()), zap.Error(err))
+		return
+	}
+	if len(claimed) == 0 {
+		return
+	}
+
+	artifact, err := s.queries.GetArtifact(ctx, rollout.ArtifactID)
+	if err != nil {
+		s.logger.Error("failed to get artifact", zap.String("rollout_id", rollout.ID.String()), zap.Error(err))
+		s.release(ctx, claimed)
+		return
+	}
+
+	update := &pb.UpdateNotification{
+		RolloutId:       rollout.ID.String(),
+		ArtifactId:      artifact.ID.String(),
+		ArtifactUrl:     s.artifacts.URL(artifact),
+		Blake3Hash:      artifact.Blake3Hash,
+		Signature:       artifact.Signature,
+		SigningKeyId:    artifact.SigningKeyID,
+		SizeBytes:       artifact.SizeBytes,
+		HealthCheckUrl:  rollout.HealthCheckUrl,
+		SoakTimeSeconds: rollout.SoakTimeSeconds,
+		ArtifactType:    artifact.Type,
+		ArtifactName:    artifact.Name,
+	}
+
+	var unsent []generated.RolloutDeviceStatus
+	for _, device := range claimed {
+		err := s.sender.SendUpdateNotification(device.DeviceID.String(), update)
+		if err == nil {
+			s.logger.Info("update sent",
+				zap.String("rollout_id", rollout.ID.String()),
+				zap.String("device_id", device.DeviceID.String()),
+			)
+			continue
+		}
+		if !errors.Is(err, ErrDeviceNotConnected) {
+			s.logger.Error("failed to send update",
+				zap.String("rollout_id", rollout.ID.String()),
+				zap.String("device_id", device.DeviceID.String()),
+				zap.Error(err),
+			)
+		}
+		unsent = append(unsent, device)
+	}
+	s.release(ctx, unsent)
+}
+
+// release returns devices whose update was not sent to PENDING
+func (s *RolloutService) release(ctx context.Context, devices []generated.RolloutDeviceStatus) {
+	for _, device := range devices {
+		if err := s.queries.ReleaseRolloutDevice(ctx, generated.ReleaseRolloutDeviceParams{
+			RolloutID: device.RolloutID,
+			DeviceID:  device.DeviceID,
+		}); err != nil {
+			s.logger.Error("failed to release rollout device",
+				zap.String("rollout_id", device.RolloutID.String()),
+				zap.String("device_id", device.DeviceID.String()),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// rollBackAll skips the devices a rolling back rollout has not sent its
+// update to and asks those it updated to roll back, reporting whether all
+// of them were asked
+func (s *RolloutService) rollBackAll(ctx context.Context, rollout generated.Rollout) bool {
+	if err := s.queries.SkipPendingRolloutDevices(ctx, rollout.ID); err != nil {
+		s.logger.Error("failed to skip pending rollout devices", zap.String("rollout_id", rollout.ID.String()), zap.Error(err))
+		return false
+	}
+
+	devices, err := s.queries.ListRollbackDevices(ctx, rollout.ID)
+	if err != nil {
+		s.logger.Error("failed to list devices to roll back", zap.String("rollout_id", rollout.ID.String()), zap.Error(err))
+		return false
+	}
+
+	done := true
+	for _, device := range devices {
+		if !s.rollBack(ctx, rollout, device) {
+			done = false
+		}
+	}
+	return done
+}
+
+// rollBack asks a device to undo a rollout's update, reporting whether it
+// was asked
+func (s *RolloutService) rollBack(ctx context.Context, rollout generated.Rollout, device generated.RolloutDeviceStatus) bool {
+	if s.sender == nil {
+		return false
+	}
+
+	err := s.sender.SendRollbackRequest(device.DeviceID.String(), &pb.RollbackRequest{
+		RolloutId: rollout.ID.String(),
+		Reason:    "rollout rolled back",
+	})
+	if err != nil {
+		if !errors.Is(err, ErrDeviceNotConnected) {
+			s.logger.Error("failed to send rollback request",
+				zap.String("rollout_id", rollout.ID.String()),
+				zap.String("device_id", device.DeviceID.String()),
+				zap.Error(err),
+			)
+		}
+		return false
+	}
+
+	if _, err := s.queries.UpdateRolloutDeviceStatus(ctx, generated.UpdateRolloutDeviceStatusParams{
+		RolloutID:         device.RolloutID,
+		DeviceID:          device.DeviceID,
+		Status:            RolloutDeviceRolledBack,
+		HealthCheckResult: device.HealthCheckResult,
+	}); err != nil {
+		s.logger.Error("failed to record rollback",
+			zap.String("rollout_id", rollout.ID.String()),
+			zap.String("device_id", device.DeviceID.String()),
+			zap.Error(err),
+		)
+	}
+
+	s.events.Publish(Event{
+		Type:           EventRolloutDeviceUpdated,
+		OrganizationID: rollout.OrganizationID,
+		ResourceType:   "rollout",
+		ResourceID:     rollout.ID.String(),
+		Data: map[string]any{
+			"device_id": device.DeviceID.String(),
+			"status":    RolloutDeviceRolledBack,
+		},
+	})
+	return true
+}
+
+// publishState publishes a rollout's move from one state to another, and
+// audits its completion or failure
+func (s *RolloutService) publishState(ctx context.Context, rollout generated.Rollout, from, reason string) {
+	data := map[string]any{
+		"state":          rollout.State,
+		"previous_state": from,
+	}
+	if reason != "" {
+		data["reason"] = reason
+	}
+	s.events.Publish(Event{
+		Type:           EventRolloutStateChanged,
+		OrganizationID: rollout.OrganizationID,
+		ResourceType:   "rollout",
+		ResourceID:     rollout.ID.String(),
+		Data:           data,
+	})
+
+	entry := AuditEntry{
+		OrganizationID: rollout.OrganizationID,
+		ActorType:      ActorSystem,
+		ResourceType:   "rollout",
+		ResourceID:     rollout.ID.String(),
+		Metadata:       data,
+	}
+	switch rollout.State {
+	case RolloutComplete:
+		entry.EventType, entry.Action = AuditRolloutCompleted, "complete"
+	case RolloutFailed:
+		entry.EventType, entry.Action, entry.Result = AuditRolloutFailed, "fail", AuditFailure
+	default:
+		return
+	}
+	s.audit.Record(ctx, entry)
+}
+
+// publishDeviceFailed publishes a device's failure within a rollout
+func (s *RolloutService) publishDeviceFailed(orgID uuid.UUID, device generated.RolloutDeviceStatus, reason, errorMessage string) {
+	s.events.Publish(Event{
+		Type:           EventRolloutDeviceFailed,
+		OrganizationID: orgID,
+		ResourceType:   "rollout",
+		ResourceID:     device.RolloutID.String(),
+		Data: map[string]any{
+			"device_id": device.DeviceID.String(),
+			"canary":    device.IsCanary,
+			"reason":    reason,
+			"error":     errorMessage,
+		},
+	})
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+)
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+func TestRolloutPublishesStateChanges(t *testing.T) {
+	bus := NewEventBus(zap.NewNop())
+	events, unsubscribe := bus.SubscribeQueued()
+	defer unsubscribe()
+	s := NewRolloutService(nil, nil, nil, bus, nil, zap.NewNop())
+
+	rollout := generated.Rollout{ID: uuid.New(), OrganizationID: uuid.New()}
+	for _, tc := range []struct{ from, to, reason string }{
+		{RolloutDraft, RolloutCanary, ""},
+		{RolloutCanary, RolloutFull, ""},
+		{RolloutFull, RolloutRollback, "device failed its health check"},
+	} {
+		rollout.State = tc.to
+		s.publishState(context.Background(), rollout, tc.from, tc.reason)
+
+		event := nextEvent(t, events)
+		if event.Type != EventRolloutStateChanged || event.ResourceID != rollout.ID.String() || event.OrganizationID != rollout.OrganizationID {
+			t.Fatalf("got %s event for %s %s", event.Type, event.ResourceType, event.ResourceID)
+		}
+		if event.Data["state"] != tc.to || event.Data["previous_state"] != tc.from {
+			t.Errorf("got %v -> %v, want %s -> %s", event.Data["previous_state"], event.Data["state"], tc.from, tc.to)
+		}
+		if reason, ok := event.Data["reason"]; tc.reason != "" && reason != tc.reason || tc.reason == "" && ok {
+			t.Errorf("got reason %v, want %q", reason, tc.reason)
+		}
+	}
+}
+
+func TestRolloutPublishesDeviceFailures(t *testing.T) {
+	bus := NewEventBus(zap.NewNop())
+	events, unsubscribe := bus.SubscribeQueued()
+	defer unsubscribe()
+	s := NewRolloutService(nil, nil, nil, bus, nil, zap.NewNop())
+
+	orgID := uuid.New()
+	device := generated.RolloutDeviceStatus{RolloutID: uuid.New(), DeviceID: uuid.New(), IsCanary: true}
+	s.publishDeviceFailed(orgID, device, "update failed", "hash mismatch")
+
+	event := nextEvent(t, events)
+	if event.Type != EventRolloutDeviceFailed || event.ResourceID != device.RolloutID.String() || event.OrganizationID != orgID {
+		t.Fatalf("got %s event for %s %s", event.Type, event.ResourceType, event.ResourceID)
+	}
+	want := map[string]any{
+		"device_id": device.DeviceID.String(),
+		"canary":    true,
+		"reason":    "update failed",
+		"error":     "hash mismatch",
+	}
+	for key, value := range want {
+		if event.Data[key] != value {
+			t.Errorf("%s: got %v, want %v", key, event.Data[key], value)
+		}
+	}
+}
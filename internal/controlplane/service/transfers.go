@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	pb "github.com/netf/safeedge/api/proto/gen"
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/pkg/crypto"
+	"github.com/netf/safeedge/pkg/transfer"
+)
+
+const (
+	// TransferIdleTimeout is how long a transfer may go without progress
+	// before it is failed and its partial file removed
+	TransferIdleTimeout = 24 * time.Hour
+
+	transferSweepInterval = time.Minute
+)
+
+// Transfer directions, relative to the device
+const (
+	TransferUpload   = "UPLOAD"
+	TransferDownload = "DOWNLOAD"
+)
+
+// Transfer states
+const (
+	TransferInProgress = "IN_PROGRESS"
+	TransferCompleted  = "COMPLETED"
+	TransferFailed     = "FAILED"
+	TransferAborted    = "ABORTED"
+)
+
+var (
+	// ErrInvalidTransfer is returned for transfer requests that are malformed
+	// or do not fit the transfer's direction, state or size
+	ErrInvalidTransfer = errors.New("invalid file transfer")
+	// ErrFileRequestRefused is returned when a device's agent refuses or fails
+	// a file request
+	ErrFileRequestRefused = errors.New("device refused the file request")
+)
+
+// FileRequester sends file requests to device agents
+type FileRequester interface {
+	// SendFileRequest sends a file request to a device's agent and waits for
+	// its response, or returns ErrDeviceNotConnected if the device has no
+	// stream to this instance
+	SendFileRequest(ctx context.Context, deviceID uuid.UUID, req *pb.FileRequest) (*pb.FileResponse, error)
+}
+
+// StartTransferParams describes a file to copy to or from a device. Size,
+// Hash and Mode describe the file being uploaded; a download takes them
+// from the device.
+type StartTransferParams struct {
+	Direction string
+	Path      string
+	Size      int64
+	Hash      string
+	Mode      int32
+}
+
+// TransferService copies files between operators and devices in chunks the
+// control plane relays over the agents' streams, so no access session is
+// needed. Every chunk is checked against its BLAKE3 hash on the way, and
+// the whole file against its own once complete: by the agent for uploads,
+// by the operator for downloads. Transfers resume from the last chunk
+// confirmed.
+type TransferService struct {
+	queries *generated.Queries
+	files   FileRequester
+	maxSize int64
+	logger  *zap.Logger
+}
+
+// NewTransferService creates a transfer service for files of at most
+// maxSize bytes
+func NewTransferService(queries *generated.Queries, files FileRequester, maxSize int64, logger *zap.Logger) *TransferService {
+	return &TransferService{
+		queries: queries,
+		files:   files,
+		maxSize: maxSize,
+		logger:  logger,
+	}
+}
+
+// Start records a transfer. A download first has the agent check the file
+// may be read and report its size and hash.
+func (s *TransferService) Start(ctx context.Context, device generated.Device, params StartTransferParams) (generated.FileTransfer, error) {
+	if err := transfer.ValidatePath(params.Path); err != nil {
+		return generated.FileTransfer{}, fmt.Errorf("%w: %v", ErrInvalidTransfer, err)
+	}
+
+	id := uuid.New()
+	switch params.Direction {
+	case TransferUpload:
+		if params.Size < 0 || params.Size > s.maxSize {
+			return generated.FileTransfer{}, fmt.Errorf("%w: size must be at most %d bytes", ErrInvalidTransfer, s.maxSize)
+		}
+		if b, err := hex.DecodeString(params.Hash); err != nil || len(b) != 32 {
+			return generated.FileTransfer{}, fmt.Errorf("%w: blake3_hash must be 64 hex characters", ErrInvalidTransfer)
+		}
+		if params.Mode&^0o777 != 0 {
+			return generated.FileTransfer{}, fmt.Errorf("%w: mode must be permission bits", ErrInvalidTransfer)
+		}
+
+	case TransferDownload:
+		resp, err := s.request(ctx, device.ID, &pb.FileRequest{
+			TransferId: id.String(),
+			Operation:  pb.FileOperation_FILE_OPERATION_STAT,
+			Path:       params.Path,
+		})
+		if err != nil {
+			return generated.FileTransfer{}, err
+		}
+		if resp.Size > s.maxSize {
+			return generated.FileTransfer{}, fmt.Errorf("%w: file is larger than %d bytes", ErrInvalidTransfer, s.maxSize)
+		}
+		params.Size, params.Hash, params.Mode = resp.Size, resp.FileHash, int32(resp.Mode&0o777)
+
+	default:
+		return generated.FileTransfer{}, fmt.Errorf("%w: direction must be %s or %s", ErrInvalidTransfer, TransferUpload, TransferDownload)
+	}
+
+	t, err := s.queries.CreateFileTransfer(ctx, generated.CreateFileTransferParams{
+		ID:             id,
+		OrganizationID: device.OrganizationID,
+		DeviceID:       device.ID,
+		Direction:      params.Direction,
+		Path:           params.Path,
+		Size:           params.Size,
+		Blake3Hash:     params.Hash,
+		Mode:           params.Mode,
+	})
+	if err != nil {
+		return generated.FileTransfer{}, fmt.Errorf("failed to create file transfer: %w", err)
+	}
+	return t, nil
+}
+
+// WriteChunk sends a chunk of an upload to the device. The device's
+// progress is recorded even if it refuses the chunk, so the uploader can
+// carry on from there.
+func (s *TransferService) WriteChunk(ctx context.Context, t generated.FileTransfer, index int64, data []byte, hash string) (generated.FileTransfer, error) {
+	offset, length, err := s.chunk(t, TransferUpload, index)
+	if err != nil {
+		return t, err
+	}
+	if int64(len(data)) != length {
+		return t, fmt.Errorf("%w: chunk %d must be %d bytes", ErrInvalidTransfer, index, length)
+	}
+	if !crypto.VerifyBLAKE3(data, hash) {
+		return t, fmt.Errorf("%w: chunk does not match its hash", ErrInvalidTransfer)
+	}
+
+	resp, err := s.files.SendFileRequest(ctx, t.DeviceID, &pb.FileRequest{
+		TransferId: t.ID.String(),
+		Operation:  pb.FileOperation_FILE_OPERATION_WRITE,
+		Path:       t.Path,
+		Offset:     offset,
+		Data:       data,
+		ChunkHash:  hash,
+	})
+	if err != nil {
+		return t, err
+	}
+
+	if updated, err := s.queries.UpdateFileTransferProgress(ctx, generated.UpdateFileTransferProgressParams{
+		Transferred: resp.Received,
+		ID:          t.ID,
+	}); err == nil {
+		t = updated
+	} else {
+		s.logger.Error("failed to record file transfer progress", zap.String("transfer_id", t.ID.String()), zap.Error(err))
+	}
+
+	if resp.Error != "" {
+		return t, fmt.Errorf("%w: %s", ErrFileRequestRefused, resp.Error)
+	}
+	return t, nil
+}
+
+// ReadChunk reads a chunk of a download from the device, returning its data
+// and BLAKE3 hash
+func (s *TransferService) ReadChunk(ctx context.Context, t generated.FileTransfer, index int64) ([]byte, string, error) {
+	offset, length, err := s.chunk(t, TransferDownload, index)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := s.request(ctx, t.DeviceID, &pb.FileRequest{
+		TransferId: t.ID.String(),
+		Operation:  pb.FileOperation_FILE_OPERATION_READ,
+		Path:       t.Path,
+		Offset:     offset,
+		Length:     int32(length),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(resp.Data)) != length || !crypto.VerifyBLAKE3(resp.Data, resp.ChunkHash) {
+		return nil, "", fmt.Errorf("%w: chunk from the device is corrupt or the file changed", ErrFileRequestRefused)
+	}
+
+	if _, err := s.queries.UpdateFileTransferProgress(ctx, generated.UpdateFileTransferProgressParams{
+		Transferred: offset + length,
+		ID:          t.ID,
+	}); err != nil {
+		s.logger.Error("failed to record file transfer progress", zap.String("transfer_id", t.ID.String()), zap.Error(err))
+	}
+	return resp.Data, resp.ChunkHash, nil
+}
+
+// Complete finishes a transfer. An upload is moved into place once the
+// device has checked its size and hash; a download is complete once the
+// operator has checked them.
+func (s *TransferService) Complete(ctx context.Context, t generated.FileTransfer) (generated.FileTransfer, error) {
+	if t.State != TransferInProgress {
+		return t, fmt.Errorf("%w: transfer is %s", ErrInvalidTransfer, t.State)
+	}
+
+	if t.Direction == TransferUpload {
+		if _, err := s.request(ctx, t.DeviceID, &pb.FileRequest{
+			TransferId: t.ID.String(),
+			Operation:  pb.FileOperation_FILE_OPERATION_COMMIT,
+			Path:       t.Path,
+			Size:       t.Size,
+			FileHash:   t.Blake3Hash,
+			Mode:       uint32(t.Mode),
+		}); err != nil {
+			return t, err
+		}
+	}
+
+	t, err := s.queries.CompleteFileTransfer(ctx, t.ID)
+	if err != nil {
+		return t, fmt.Errorf("failed to complete file transfer: %w", err)
+	}
+	return t, nil
+}
+
+// Abort ends a transfer, removing an upload's partial file from the device
+// if it is connected
+func (s *TransferService) Abort(ctx context.Context, t generated.FileTransfer) (generated.FileTransfer, error) {
+	if t.State != TransferInProgress {
+		return t, fmt.Errorf("%w: transfer is %s", ErrInvalidTransfer, t.State)
+	}
+
+	ended, err := s.queries.EndFileTransfer(ctx, generated.EndFileTransferParams{
+		State: TransferAborted,
+		Error: pgtype.Text{String: "aborted by operator", Valid: true},
+		ID:    t.ID,
+	})
+	if err != nil {
+		return t, fmt.Errorf("failed to abort file transfer: %w", err)
+	}
+
+	s.discard(ctx, ended)
+	return ended, nil
+}
+
+// Run fails transfers that have gone idle until ctx is cancelled
+func (s *TransferService) Run(ctx context.Context) {
+	ticker := time.NewTicker(transferSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := s.queries.ExpireFileTransfers(ctx, time.Now().Add(-TransferIdleTimeout))
+			if err != nil {
+				s.logger.Error("failed to expire file transfers", zap.Error(err))
+				continue
+			}
+			for _, t := range expired {
+				s.logger.Info("file transfer expired", zap.String("transfer_id", t.ID.String()))
+				s.discard(ctx, t)
+			}
+		}
+	}
+}
+
+// discard removes an ended upload's partial file from the device, on a best
+// effort basis
+func (s *TransferService) discard(ctx context.Context, t generated.FileTransfer) {
+	if t.Direction != TransferUpload {
+		return
+	}
+	if _, err := s.request(ctx, t.DeviceID, &pb.FileRequest{
+		TransferId: t.ID.String(),
+		Operation:  pb.FileOperation_FILE_OPERATION_ABORT,
+		Path:       t.Path,
+	}); err != nil {
+		s.logger.Warn("failed to remove partial upload from device",
+			zap.String("transfer_id", t.ID.String()),
+			zap.String("device_id", t.DeviceID.String()),
+			zap.Error(err),
+		)
+	}
+}
+
+// chunk checks a transfer accepts chunks in a direction and returns a
+// chunk's offset and length
+func (s *TransferService) chunk(t generated.FileTransfer, direction string, index int64) (int64, int64, error) {
+	if t.Direction != direction {
+		return 0, 0, fmt.Errorf("%w: not an %s", ErrInvalidTransfer, direction)
+	}
+	if t.State != TransferInProgress {
+		return 0, 0, fmt.Errorf("%w: transfer is %s", ErrInvalidTransfer, t.State)
+	}
+	offset, length, err := transfer.ChunkRange(t.Size, index)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %v", ErrInvalidTransfer, err)
+	}
+	return offset, length, nil
+}
+
+// request sends a file request, turning a refusal into an error
+func (s *TransferService) request(ctx context.Context, deviceID uuid.UUID, req *pb.FileRequest) (*pb.FileResponse, error) {
+	resp, err := s.files.SendFileRequest(ctx, deviceID, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%w: %s", ErrFileRequestRefused, resp.Error)
+	}
+	return resp, nil
+}
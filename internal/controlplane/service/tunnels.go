@@ -0,0 +1,27 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrDeviceNotConnected is returned when a device has no stream to this
+	// control plane instance
+	ErrDeviceNotConnected = errors.New("device is not connected")
+	// ErrTunnelRefused is returned when a device's agent could not connect a
+	// tunnel to its destination
+	ErrTunnelRefused = errors.New("device refused the tunnel")
+)
+
+// Tunneler relays connections to destinations near a device over the
+// agent's own connection to the control plane, for access session clients
+// whose WireGuard traffic cannot reach the device
+type Tunneler interface {
+	// OpenTunnel has the device's agent connect to destination for an access
+	// session and returns the relayed connection
+	OpenTunnel(ctx context.Context, deviceID, sessionID uuid.UUID, destination string) (io.ReadWriteCloser, error)
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"go.uber.org/zap"
+
+	"github.com/netf/safeedge/internal/controlplane/database/generated"
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+// Webhook delivery states
+const (
+	WebhookDeliveryPending   = "PENDING"
+	WebhookDeliverySucceeded = "SUCCEEDED"
+	WebhookDeliveryFailed    = "FAILED"
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookHeaderEvent     = "X-SafeEdge-Event"
+	WebhookHeaderDelivery  = "X-SafeEdge-Delivery"
+	WebhookHeaderTimestamp = "X-SafeEdge-Timestamp"
+	WebhookHeaderSignature = "X-SafeEdge-Signature"
+)
+
+const (
+	// WebhookMaxAttempts is how many times a delivery is tried before it fails
+	WebhookMaxAttempts = 8
+
+	webhookPollInterval = 2 * time.Second
+	webhookBatchSize    = 50
+	webhookLease        = 10 * time.Minute
+	webhookTimeout      = 10 * time.Second
+	webhookBaseBackoff  = 10 * time.Second
+	webhookMaxBackoff   = time.Hour
+
+	webhookEnqueueBaseBackoff = time.Second
+	webhookEnqueueMaxBackoff  = time.Minute
+)
+
+// WebhookEventTypes are the event types webhooks can subscribe to
+var WebhookEventTypes = map[string]bool{
+	EventDeviceEnrolled:        true,
+	EventDeviceOnline:          true,
+	EventDeviceOffline:         true,
+	EventDeviceSuspended:       true,
+	EventDeviceReactivated:     true,
+	EventDeviceDecommissioned:  true,
+	EventDeviceConfigDrifted:   true,
+	EventRolloutStateChanged:   true,
+	EventRolloutDeviceFailed:   true,
+	EventAccessStarted:         true,
+	EventAccessEnded:           true,
+	EventCommandCompleted:      true,
+	EventCommandBatchCompleted: true,
+}
+
+// WebhookDispatcher delivers fleet events to the webhooks subscribed to
+// them. Each event is stored as a delivery for every subscribed webhook and
+// sent from there, so deliveries survive restarts and are retried with
+// exponential backoff until they succeed or run out of attempts.
+type WebhookDispatcher struct {
+	queries *generated.Queries
+	events  *EventBus
+	client  *http.Client
+	logger  *zap.Logger
+}
+
+// NewWebhookDispatcher creates a webhook dispatcher
+func NewWebhookDispatcher(queries *generated.Queries, events *EventBus, logger *zap.Logger) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		queries: queries,
+		events:  events,
+		client:  &http.Client{Timeout: webhookTimeout},
+		logger:  logger,
+	}
+}
+
+// Run queues deliveries for published events and sends due deliveries until
+// ctx is cancelled. Sending runs separately so slow endpoints do not hold up
+// queueing. Events wait in memory while the database is slow or failing and
+// queueing is retried with backoff, so none is dropped while the control
+// plane runs; events published before a restart that were not yet queued
+// are lost, as events are not persisted until then.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	go d.deliver(ctx)
+
+	events, unsubscribe := d.events.SubscribeQueued()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			d.enqueueRetrying(ctx, event)
+		}
+	}
+}
+
+// deliver sends due deliveries until ctx is cancelled
+func (d *WebhookDispatcher) deliver(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.sendDue(ctx)
+		}
+	}
+}
+
+// enqueueRetrying enqueues event, retrying with backoff until it succeeds
+// or ctx is cancelled. Later events wait behind it.
+func (d *WebhookDispatcher) enqueueRetrying(ctx context.Context, event Event) {
+	for attempt := 0; ; attempt++ {
+		err := d.enqueue(ctx, event)
+		if err == nil {
+			return
+		}
+
+		delay := webhookEnqueueBackoff(attempt)
+		d.logger.Error("failed to queue webhook deliveries, retrying",
+			zap.String("event_id", event.ID.String()),
+			zap.String("event_type", event.Type),
+			zap.Duration("retry_in", delay),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// enqueue stores a delivery of event for every webhook subscribed to it.
+// Webhooks the event was already queued for are skipped, so a failed
+// enqueue can be retried.
+func (d *WebhookDispatcher) enqueue(ctx context.Context, event Event) error {
+	if !WebhookEventTypes[event.Type] {
+		return nil
+	}
+
+	webhooks, err := d.queries.ListSubscribedWebhooks(ctx, generated.ListSubscribedWebhooksParams{
+		OrganizationID: event.OrganizationID,
+		EventType:      event.Type,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list subscribed webhooks: %w", err)
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		// Retrying cannot help
+		d.logger.Error("failed to encode webhook payload", zap.Error(err))
+		return nil
+	}
+
+	for _, webhook := range webhooks {
+		_, err := d.queries.CreateWebhookDelivery(ctx, generated.CreateWebhookDeliveryParams{
+			WebhookID: webhook.ID,
+			EventID:   event.ID,
+			EventType: event.Type,
+			Payload:   payload,
+		})
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to queue delivery to webhook %s: %w", webhook.ID, err)
+		}
+	}
+	return nil
+}
+
+// sendDue attempts every delivery that is due
+func (d *WebhookDispatcher) sendDue(ctx context.Context) {
+	deliveries, err := d.queries.ClaimWebhookDeliveries(ctx, generated.ClaimWebhookDeliveriesParams{
+		LeasedUntil: pgtype.Timestamptz{Time: time.Now().Add(webhookLease), Valid: true},
+		BatchSize:   webhookBatchSize,
+	})
+	if err != nil {
+		d.logger.Error("failed to claim webhook deliveries", zap.Error(err))
+		return
+	}
+
+	for _, delivery := range deliveries {
+		d.attempt(ctx, delivery)
+	}
+}
+
+// attempt sends a delivery once and records the outcome
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery generated.WebhookDelivery) {
+	// The outcome must be recorded even if the dispatcher is shutting down
+	ctx = context.WithoutCancel(ctx)
+
+	params := generated.RecordWebhookAttemptParams{
+		Status:        WebhookDeliverySucceeded,
+		NextAttemptAt: delivery.NextAttemptAt,
+		ID:            delivery.ID,
+	}
+
+	webhook, err := d.queries.GetWebhookByID(ctx, delivery.WebhookID)
+	if err == nil {
+		var status int
+		status, err = d.send(ctx, webhook, delivery)
+		if status != 0 {
+			params.ResponseStatus = pgtype.Int4{Int32: int32(status), Valid: true}
+		}
+	}
+
+	if err != nil {
+		params.LastError = pgtype.Text{String: err.Error(), Valid: true}
+		params.Status = WebhookDeliveryPending
+		params.NextAttemptAt = time.Now().Add(webhookBackoff(delivery.Attempts))
+		if delivery.Attempts+1 >= WebhookMaxAttempts {
+			params.Status = WebhookDeliveryFailed
+		}
+
+		d.logger.Warn("webhook delivery failed",
+			zap.String("delivery_id", delivery.ID.String()),
+			zap.String("webhook_id", delivery.WebhookID.String()),
+			zap.Int32("attempt", delivery.Attempts+1),
+			zap.Error(err),
+		)
+	}
+
+	if _, err := d.queries.RecordWebhookAttempt(ctx, params); err != nil {
+		d.logger.Error("failed to record webhook attempt", zap.Error(err))
+	}
+}
+
+// send POSTs a delivery's payload, signed with the webhook's secret. Any 2xx
+// response is a success.
+func (d *WebhookDispatcher) send(ctx context.Context, webhook generated.Webhook, delivery generated.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SafeEdge-Webhooks/1.0")
+	req.Header.Set(WebhookHeaderEvent, delivery.EventType)
+	req.Header.Set(WebhookHeaderDelivery, delivery.ID.String())
+	req.Header.Set(WebhookHeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookHeaderSignature, crypto.WebhookSignature(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// webhookBackoff is the delay before the next attempt after attempts
+// previous failures
+// webhookEnqueueBackoff is how long to wait before queueing an event again
+// after attempt failed
+func webhookEnqueueBackoff(attempt int) time.Duration {
+	if attempt >= 10 {
+		return webhookEnqueueMaxBackoff
+	}
+	return min(webhookEnqueueBaseBackoff<<attempt, webhookEnqueueMaxBackoff)
+}
+
+func webhookBackoff(attempts int32) time.Duration {
+	if attempts >= 10 {
+		return webhookMaxBackoff
+	}
+	return min(webhookBaseBackoff<<attempts, webhookMaxBackoff)
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// PeerManager adds and removes device peers on the control plane's WireGuard hub
+type PeerManager interface {
+	AddPeer(ctx context.Context, publicKey string, ip net.IP) error
+	RemovePeer(ctx context.Context, publicKey string) error
+}
+
+// WGPeerManager manages hub peers with the wg command. With no interface
+// configured it only logs the changes it would make.
+type WGPeerManager struct {
+	iface  string
+	logger *zap.Logger
+}
+
+// NewWGPeerManager creates a peer manager for a WireGuard interface
+func NewWGPeerManager(iface string, logger *zap.Logger) *WGPeerManager {
+	return &WGPeerManager{
+		iface:  iface,
+		logger: logger,
+	}
+}
+
+// AddPeer allows publicKey to use ip on the hub
+func (m *WGPeerManager) AddPeer(ctx context.Context, publicKey string, ip net.IP) error {
+	return m.wg(ctx, "peer", publicKey, "allowed-ips", ip.String()+"/32")
+}
+
+// RemovePeer removes publicKey from the hub
+func (m *WGPeerManager) RemovePeer(ctx context.Context, publicKey string) error {
+	return m.wg(ctx, "peer", publicKey, "remove")
+}
+
+func (m *WGPeerManager) wg(ctx context.Context, args ...string) error {
+	if m.iface == "" {
+		m.logger.Debug("no WireGuard interface configured, skipping peer change",
+			zap.Strings("args", args),
+		)
+		return nil
+	}
+
+	out, err := exec.CommandContext(ctx, "wg", append([]string{"set", m.iface}, args...)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("wg set failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+// Package audit implements the tamper-evident audit log chain shared by the
+// control plane, which appends to it, and the CLI, which verifies it.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+// GenesisHash is the prev_hash of the first entry in an organization's chain
+const GenesisHash = ""
+
+// Entry is an audit log entry as covered by the hash chain. The JSON field
+// names match the audit log API.
+type Entry struct {
+	ID             uuid.UUID       `json:"id"`
+	Timestamp      time.Time       `json:"timestamp"`
+	OrganizationID uuid.UUID       `json:"organization_id"`
+	ActorType      string          `json:"actor_type"`
+	Actor          string          `json:"actor"`
+	EventType      string          `json:"event_type"`
+	ResourceType   string          `json:"resource_type"`
+	ResourceID     string          `json:"resource_id"`
+	Action         string          `json:"action"`
+	Result         string          `json:"result"`
+	Metadata       json.RawMessage `json:"metadata"`
+	IPAddress      string          `json:"ip_address"`
+	RequestID      string          `json:"request_id"`
+	Sequence       int64           `json:"sequence"`
+	PrevHash       string          `json:"prev_hash"`
+	Hash           string          `json:"hash"`
+}
+
+// canonicalEntry fixes the field order and encoding hashed for an entry
+type canonicalEntry struct {
+	Sequence       int64           `json:"sequence"`
+	PrevHash       string          `json:"prev_hash"`
+	ID             string          `json:"id"`
+	Timestamp      string          `json:"timestamp"`
+	OrganizationID string          `json:"organization_id"`
+	ActorType      string          `json:"actor_type"`
+	Actor          string          `json:"actor"`
+	EventType      string          `json:"event_type"`
+	ResourceType   string          `json:"resource_type"`
+	ResourceID     string          `json:"resource_id"`
+	Action         string          `json:"action"`
+	Result         string          `json:"result"`
+	Metadata       json.RawMessage `json:"metadata"`
+	IPAddress      string          `json:"ip_address"`
+	RequestID      string          `json:"request_id"`
+}
+
+// ComputeHash returns the BLAKE3 hash chaining e to the entry before it.
+// The stored Hash field is not covered.
+func (e Entry) ComputeHash() (string, error) {
+	metadata, err := CanonicalJSON(e.Metadata)
+	if err != nil {
+		return "", fmt.Errorf("invalid metadata: %w", err)
+	}
+
+	data, err := json.Marshal(canonicalEntry{
+		Sequence:       e.Sequence,
+		PrevHash:       e.PrevHash,
+		ID:             e.ID.String(),
+		Timestamp:      Timestamp(e.Timestamp).Format(time.RFC3339Nano),
+		OrganizationID: e.OrganizationID.String(),
+		ActorType:      e.ActorType,
+		Actor:          e.Actor,
+		EventType:      e.EventType,
+		ResourceType:   e.ResourceType,
+		ResourceID:     e.ResourceID,
+		Action:         e.Action,
+		Result:         e.Result,
+		Metadata:       metadata,
+		IPAddress:      e.IPAddress,
+		RequestID:      e.RequestID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode entry: %w", err)
+	}
+
+	return crypto.BLAKE3Hash(data), nil
+}
+
+// Timestamp normalizes t to the UTC microsecond precision it is stored at
+func Timestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// CanonicalJSON re-encodes a JSON document with sorted object keys and no
+// insignificant whitespace, so that metadata hashes the same before and
+// after a round trip through a JSONB column. Empty input and null both
+// encode as null.
+func CanonicalJSON(data []byte) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return json.RawMessage("null"), nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// CheckpointMessage returns the message the control plane signs with its
+// Ed25519 key to attest the head of an organization's chain
+func CheckpointMessage(organizationID uuid.UUID, sequence int64, hash string) []byte {
+	return []byte(fmt.Sprintf("safeedge-audit-checkpoint:%s:%d:%s", organizationID, sequence, hash))
+}
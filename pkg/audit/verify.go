@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+// Checkpoint is a signed attestation of the head of an organization's chain
+type Checkpoint struct {
+	OrganizationID uuid.UUID `json:"organization_id"`
+	Sequence       int64     `json:"sequence"`
+	Hash           string    `json:"hash"`
+	PublicKey      string    `json:"public_key"`
+	Signature      []byte    `json:"signature"`
+}
+
+// Verify checks the checkpoint's signature against its public key
+func (c Checkpoint) Verify() bool {
+	return crypto.VerifyEd25519(c.PublicKey, CheckpointMessage(c.OrganizationID, c.Sequence, c.Hash), c.Signature)
+}
+
+// Break is the first point at which a chain fails verification
+type Break struct {
+	Sequence int64
+	EntryID  uuid.UUID
+	Reason   string
+}
+
+func (b *Break) Error() string {
+	if b.EntryID == uuid.Nil {
+		return fmt.Sprintf("chain broken at sequence %d: %s", b.Sequence, b.Reason)
+	}
+	return fmt.Sprintf("chain broken at sequence %d (entry %s): %s", b.Sequence, b.EntryID, b.Reason)
+}
+
+// Verifier checks a run of entries fed to it in sequence order. Each entry
+// must hash to its stored hash and link to the entry before it, and entries
+// covered by a checkpoint must match it.
+type Verifier struct {
+	checkpoints map[int64]Checkpoint
+	last        *Entry
+	checked     int
+}
+
+// NewVerifier creates a verifier for one organization's chain. Checkpoints
+// must be signed by publicKey; an empty publicKey accepts any signer.
+func NewVerifier(checkpoints []Checkpoint, publicKey string) (*Verifier, error) {
+	v := &Verifier{checkpoints: make(map[int64]Checkpoint, len(checkpoints))}
+
+	for _, c := range checkpoints {
+		if publicKey != "" && c.PublicKey != publicKey {
+			return nil, &Break{Sequence: c.Sequence, Reason: "checkpoint is signed by an untrusted key"}
+		}
+		if !c.Verify() {
+			return nil, &Break{Sequence: c.Sequence, Reason: "checkpoint signature is invalid"}
+		}
+		v.checkpoints[c.Sequence] = c
+	}
+
+	return v, nil
+}
+
+// Add verifies the next entry, returning a *Break if the chain is broken
+func (v *Verifier) Add(e Entry) error {
+	brk := func(reason string, args ...any) error {
+		return &Break{Sequence: e.Sequence, EntryID: e.ID, Reason: fmt.Sprintf(reason, args...)}
+	}
+
+	switch {
+	case v.last != nil && e.Sequence != v.last.Sequence+1:
+		return &Break{Sequence: v.last.Sequence + 1, Reason: fmt.Sprintf("entries %d to %d are missing", v.last.Sequence+1, e.Sequence-1)}
+	case v.last != nil && e.PrevHash != v.last.Hash:
+		return brk("prev_hash does not match the hash of entry %d", v.last.Sequence)
+	case e.Sequence == 1 && e.PrevHash != GenesisHash:
+		return brk("first entry does not start the chain")
+	}
+
+	hash, err := e.ComputeHash()
+	if err != nil {
+		return brk("%v", err)
+	}
+	if hash != e.Hash {
+		return brk("entry contents do not match its hash")
+	}
+
+	if c, ok := v.checkpoints[e.Sequence]; ok && c.Hash != e.Hash {
+		return brk("hash does not match the signed checkpoint")
+	}
+
+	v.last = &e
+	v.checked++
+	return nil
+}
+
+// Finish reports entries missing after the last one added: a checkpoint
+// beyond it proves the chain was truncated
+func (v *Verifier) Finish() error {
+	last := int64(0)
+	if v.last != nil {
+		last = v.last.Sequence
+	}
+
+	latest := last
+	for seq := range v.checkpoints {
+		latest = max(latest, seq)
+	}
+	if latest > last {
+		return &Break{Sequence: last + 1, Reason: fmt.Sprintf("entries up to checkpoint %d are missing", latest)}
+	}
+
+	return nil
+}
+
+// Checked returns the number of entries verified so far
+func (v *Verifier) Checked() int {
+	return v.checked
+}
+
+// Checkpoints returns the number of checkpoints the verifier holds
+func (v *Verifier) Checkpoints() int {
+	return len(v.checkpoints)
+}
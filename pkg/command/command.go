@@ -0,0 +1,66 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout is how long a command may run unless the request says
+	// otherwise
+	DefaultTimeout = time.Minute
+	// MaxTimeout is the longest a command may run
+	MaxTimeout = time.Hour
+
+	// MaxArgs is the most arguments a command may be given
+	MaxArgs = 64
+	// MaxArgLength bounds each argument, in bytes
+	MaxArgLength = 4096
+
+	// MaxOutput is how much of a command's output, in bytes over both
+	// streams, the agent sends and the control plane keeps
+	MaxOutput = 64 * 1024
+
+	maxNameLength = 128
+)
+
+// ValidateName checks that a command name is a plain file name: agents
+// resolve it against their allowlist or in their script directory, never
+// as a path
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("command is required")
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("command name is longer than %d bytes", maxNameLength)
+	}
+	if name == "." || name == ".." || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid command name %q", name)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return fmt.Errorf("invalid command name %q", name)
+		}
+	}
+	return nil
+}
+
+// Validate checks a command name and its arguments
+func Validate(name string, args []string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if len(args) > MaxArgs {
+		return fmt.Errorf("at most %d arguments", MaxArgs)
+	}
+	for _, arg := range args {
+		if len(arg) > MaxArgLength {
+			return fmt.Errorf("arguments must be at most %d bytes", MaxArgLength)
+		}
+		if strings.ContainsRune(arg, 0) {
+			return fmt.Errorf("arguments must not contain NUL bytes")
+		}
+	}
+	return nil
+}
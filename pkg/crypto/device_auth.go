@@ -0,0 +1,44 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"time"
+)
+
+// gRPC metadata keys a device uses to authenticate its stream
+const (
+	MetadataDeviceID  = "x-safeedge-device-id"
+	MetadataTimestamp = "x-safeedge-timestamp"
+	MetadataSignature = "x-safeedge-signature"
+)
+
+// MaxStreamAuthSkew is how far a stream authentication timestamp may be from the server clock
+const MaxStreamAuthSkew = 5 * time.Minute
+
+// StreamAuthMessage returns the message a device signs with its Ed25519 key
+// to open a stream. The timestamp is in Unix seconds.
+func StreamAuthMessage(deviceID string, timestamp int64) []byte {
+	return []byte(fmt.Sprintf("safeedge-stream:%s:%d", deviceID, timestamp))
+}
+
+// KeyRotationMessage returns the message a device signs with its new Ed25519
+// key to prove possession of it when rotating keys
+func KeyRotationMessage(deviceID, oldPublicKey, newPublicKey, newWireguardPublicKey string) []byte {
+	return []byte(fmt.Sprintf("safeedge-rotate:%s:%s:%s:%s", deviceID, oldPublicKey, newPublicKey, newWireguardPublicKey))
+}
+
+// VerifyEd25519 verifies a signature against a base64-encoded public key
+func VerifyEd25519(encodedPublicKey string, message, signature []byte) bool {
+	publicKey, err := ParseEd25519PublicKey(encodedPublicKey)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(publicKey, message, signature)
+}
+
+// PolicyMessage returns the message an organization signs with its Ed25519
+// key to authorize a device policy file
+func PolicyMessage(policy []byte) []byte {
+	return append([]byte("safeedge-policy:"), policy...)
+}
@@ -0,0 +1,40 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// webhookSignaturePrefix identifies the signature scheme in X-SafeEdge-Signature
+const webhookSignaturePrefix = "sha256="
+
+// GenerateWebhookSecret returns a random secret for signing webhook payloads
+func GenerateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// WebhookSignature returns the X-SafeEdge-Signature value for a payload:
+// HMAC-SHA256 with the webhook secret over "<timestamp>.<body>", where
+// timestamp is the X-SafeEdge-Timestamp value in Unix seconds
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks an X-SafeEdge-Signature value in constant time
+func VerifyWebhookSignature(secret string, timestamp int64, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, webhookSignaturePrefix) {
+		return false
+	}
+	return hmac.Equal([]byte(WebhookSignature(secret, timestamp, body)), []byte(signature))
+}
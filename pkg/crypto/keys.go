@@ -4,7 +4,10 @@ import (
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 )
 
 // Ed25519KeyPair represents an Ed25519 public/private key pair
@@ -73,3 +76,39 @@ func ParseEd25519PrivateKey(encoded string) (ed25519.PrivateKey, error) {
 
 	return ed25519.PrivateKey(data), nil
 }
+
+// LoadOrGenerateEd25519KeyPair reads a base64-encoded private key from path,
+// generating and saving a new one if the file does not exist
+func LoadOrGenerateEd25519KeyPair(path string) (*Ed25519KeyPair, error) {
+	keys, err := LoadEd25519KeyPair(path)
+	if errors.Is(err, os.ErrNotExist) {
+		keys, err := GenerateEd25519KeyPair()
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(keys.PrivateKeyString()+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save private key: %w", err)
+		}
+		return keys, nil
+	}
+
+	return keys, err
+}
+
+// LoadEd25519KeyPair reads a base64-encoded private key from path
+func LoadEd25519KeyPair(path string) (*Ed25519KeyPair, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	privateKey, err := ParseEd25519PrivateKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Ed25519KeyPair{
+		PublicKey:  privateKey.Public().(ed25519.PublicKey),
+		PrivateKey: privateKey,
+	}, nil
+}
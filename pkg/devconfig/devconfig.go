@@ -0,0 +1,142 @@
+// Package devconfig holds the desired configuration documents operators set
+// for devices and device groups, shared by the control plane and the agent.
+// A document is a JSON object of sections, each applied on the device by
+// the agent plugin named by its key.
+package devconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+// MaxDocumentSize is the largest document accepted, in bytes
+const MaxDocumentSize = 256 * 1024
+
+// Document is a configuration document, keyed by section
+type Document map[string]any
+
+// Parse decodes a document and checks each of its sections is an object
+func Parse(data []byte) (Document, error) {
+	if len(data) > MaxDocumentSize {
+		return nil, fmt.Errorf("document is larger than %d bytes", MaxDocumentSize)
+	}
+
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("document must be a JSON object: %w", err)
+	}
+	if doc == nil {
+		doc = Document{}
+	}
+	for name, section := range doc {
+		if name == "" {
+			return nil, fmt.Errorf("section names must not be empty")
+		}
+		if _, ok := section.(map[string]any); !ok && section != nil {
+			return nil, fmt.Errorf("section %q must be an object", name)
+		}
+	}
+	return doc, nil
+}
+
+// Merge returns base overlaid with override. Objects are merged key by key
+// and other values replaced; a null in override removes the key.
+func Merge(base, override Document) Document {
+	return Document(merge(base, override))
+}
+
+func merge(base, override map[string]any) map[string]any {
+	out := make(map[string]any, len(base)+len(override))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range override {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		baseObj, baseOK := out[k].(map[string]any)
+		overrideObj, overrideOK := v.(map[string]any)
+		if baseOK && overrideOK {
+			out[k] = merge(baseObj, overrideObj)
+			continue
+		}
+		if overrideOK {
+			// Drop any nulls left in an object replacing a non-object
+			out[k] = merge(nil, overrideObj)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// Encode returns a document's canonical encoding, with keys sorted
+func Encode(doc Document) []byte {
+	if doc == nil {
+		doc = Document{}
+	}
+	// Documents hold only decoded JSON, which always encodes
+	data, _ := json.Marshal(doc)
+	return data
+}
+
+// Hash returns the BLAKE3 hash of a document's canonical encoding
+func Hash(doc Document) string {
+	return crypto.BLAKE3Hash(Encode(doc))
+}
+
+// Difference is a desired setting whose reported value differs
+type Difference struct {
+	// Path holds the keys leading to the setting, starting with its section
+	Path     []string `json:"path"`
+	Desired  any      `json:"desired"`
+	Reported any      `json:"reported"`
+}
+
+// Diff compares each setting in desired with reported. Objects are compared
+// key by key and other values whole; reported settings that are not desired
+// are ignored.
+func Diff(desired, reported Document) []Difference {
+	diffs := []Difference{}
+	diff(nil, desired, reported, &diffs)
+	return diffs
+}
+
+func diff(path []string, desired, reported map[string]any, diffs *[]Difference) {
+	keys := make([]string, 0, len(desired))
+	for k := range desired {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		keyPath := append(slices.Clip(path), k)
+		want, got := desired[k], reported[k]
+
+		wantObj, wantOK := want.(map[string]any)
+		gotObj, gotOK := got.(map[string]any)
+		if wantOK && gotOK {
+			diff(keyPath, wantObj, gotObj, diffs)
+			continue
+		}
+		if !equal(want, got) {
+			*diffs = append(*diffs, Difference{Path: keyPath, Desired: want, Reported: got})
+		}
+	}
+}
+
+// equal compares decoded JSON values, treating numbers by their value
+func equal(a, b any) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	aj, errA := json.Marshal(a)
+	bj, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(aj, bj)
+}
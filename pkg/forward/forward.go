@@ -0,0 +1,124 @@
+package forward
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPort is the port agents accept forwarded connections on, on
+	// their overlay address
+	DefaultPort = 7100
+
+	// MaxDestinations is the most destinations an access session may allow
+	MaxDestinations = 32
+
+	// TunnelProtocol is the HTTP upgrade a client asks for to have the
+	// control plane relay a connection through the device's agent
+	TunnelProtocol = "safeedge-tunnel"
+
+	requestPrefix = "SAFEEDGE-FORWARD/1"
+	// maxLineLength bounds the handshake lines read before a connection is
+	// authorized
+	maxLineLength = 512
+)
+
+// ErrLineTooLong is returned for a handshake line over maxLineLength bytes
+var ErrLineTooLong = errors.New("forward handshake line too long")
+
+// ValidateDestination checks that dest is host:port with a port from 1 to 65535
+func ValidateDestination(dest string) error {
+	host, port, err := net.SplitHostPort(dest)
+	if err != nil {
+		return fmt.Errorf("invalid destination %q: %w", dest, err)
+	}
+	if host == "" || strings.ContainsAny(host, " \t\r\n") {
+		return fmt.Errorf("invalid destination %q: missing host", dest)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid destination %q: invalid port", dest)
+	}
+	return nil
+}
+
+// NormalizeDestination lowercases the host of a valid destination so
+// allowlist entries compare equal regardless of case
+func NormalizeDestination(dest string) string {
+	host, port, err := net.SplitHostPort(dest)
+	if err != nil {
+		return dest
+	}
+	return net.JoinHostPort(strings.ToLower(host), port)
+}
+
+// WriteRequest starts a forwarded connection to dest for an access session.
+// The client sends it first, then waits for the agent's response.
+func WriteRequest(w io.Writer, sessionID, dest string) error {
+	_, err := fmt.Fprintf(w, "%s %s %s\n", requestPrefix, sessionID, dest)
+	return err
+}
+
+// ReadRequest reads the session ID and destination a client sent
+func ReadRequest(r *bufio.Reader) (sessionID, dest string, err error) {
+	line, err := readLine(r)
+	if err != nil {
+		return "", "", err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) != 3 || fields[0] != requestPrefix {
+		return "", "", fmt.Errorf("invalid forward request")
+	}
+
+	return fields[1], fields[2], nil
+}
+
+// WriteResponse accepts a forwarded connection, or refuses it with err
+func WriteResponse(w io.Writer, err error) error {
+	if err != nil {
+		_, werr := fmt.Fprintf(w, "ERR %s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+		return werr
+	}
+	_, werr := io.WriteString(w, "OK\n")
+	return werr
+}
+
+// ReadResponse returns nil once the agent accepts a forwarded connection,
+// or the reason it refused it
+func ReadResponse(r *bufio.Reader) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+
+	if line == "OK" {
+		return nil
+	}
+	if reason, ok := strings.CutPrefix(line, "ERR "); ok {
+		return fmt.Errorf("forward refused: %s", reason)
+	}
+	return fmt.Errorf("invalid forward response")
+}
+
+// readLine reads a newline-terminated line of at most maxLineLength bytes
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		if len(line) >= maxLineLength {
+			return "", ErrLineTooLong
+		}
+		line = append(line, b)
+	}
+}
@@ -0,0 +1,88 @@
+// Package installer holds the protocol between the agent and installer
+// plugins: executables that install artifacts of a type the agent has no
+// built-in installer for. For each operation the agent runs the plugin with
+// no arguments, writes one JSON Request to its standard input and reads one
+// JSON Response from its standard output; anything it writes to standard
+// error is logged. A plugin answers "describe" with the operations it
+// implements beyond "install", which every plugin must.
+package installer
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ProtocolVersion is the version of the plugin protocol, sent in every
+// request. Plugins refuse versions they do not know.
+const ProtocolVersion = 1
+
+// Operations the agent asks plugins to perform
+const (
+	// OpDescribe asks which operations the plugin implements
+	OpDescribe = "describe"
+	// OpPreInstall runs before anything changes, such as to check that the
+	// artifact suits the device
+	OpPreInstall = "pre_install"
+	// OpInstall installs the artifact
+	OpInstall = "install"
+	// OpPostInstall runs once the artifact is installed, such as to restart
+	// what uses it
+	OpPostInstall = "post_install"
+	// OpHealth probes whether the installed artifact works
+	OpHealth = "health"
+	// OpRollback reinstates the previous artifact, or removes the artifact
+	// if there was none
+	OpRollback = "rollback"
+)
+
+// Built-in artifact types. Others are handled by installer plugins.
+const (
+	TypeAgent     = "AGENT"
+	TypeBinary    = "BINARY"
+	TypeContainer = "CONTAINER"
+	TypeDeb       = "DEB"
+)
+
+var typePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,31}$`)
+
+// ValidateType checks that an artifact type is an upper-case identifier of
+// at most 32 characters, such as FIRMWARE or CONFIG_BUNDLE
+func ValidateType(artifactType string) error {
+	if !typePattern.MatchString(artifactType) {
+		return fmt.Errorf("artifact type %q must be an upper-case identifier of at most 32 characters", artifactType)
+	}
+	return nil
+}
+
+// Artifact is an artifact as plugins see it
+type Artifact struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	RolloutID  string `json:"rollout_id,omitempty"`
+	BLAKE3Hash string `json:"blake3_hash"`
+	SizeBytes  int64  `json:"size_bytes"`
+	// Path is the verified artifact file, which plugins must not modify
+	Path string `json:"path"`
+	// HealthCheckURL is the rollout's health check, if it has one
+	HealthCheckURL string `json:"health_check_url,omitempty"`
+}
+
+// Request asks a plugin to perform an operation
+type Request struct {
+	Protocol  int    `json:"protocol"`
+	Operation string `json:"operation"`
+	// Artifact is what the operation is for; not set for describe
+	Artifact *Artifact `json:"artifact,omitempty"`
+	// Previous is the artifact installed in the same slot before Artifact,
+	// if any
+	Previous *Artifact `json:"previous,omitempty"`
+}
+
+// Response is a plugin's answer to a request
+type Response struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// Operations are those the plugin implements, in answer to describe
+	Operations []string `json:"operations,omitempty"`
+}
@@ -0,0 +1,126 @@
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxLabels is the maximum number of labels in a set
+	MaxLabels = 64
+
+	maxNameLength   = 63
+	maxPrefixLength = 253
+)
+
+var (
+	namePattern   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	prefixPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+)
+
+// Set is a collection of key/value labels
+type Set map[string]string
+
+// ValidateKey checks that a label key is an optional DNS prefix followed by
+// a name, e.g. "region" or "example.com/tier"
+func ValidateKey(key string) error {
+	name := key
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		prefix := key[:i]
+		name = key[i+1:]
+		if len(prefix) > maxPrefixLength || !prefixPattern.MatchString(prefix) {
+			return fmt.Errorf("invalid label key %q: bad prefix", key)
+		}
+	}
+
+	if len(name) > maxNameLength || !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid label key %q", key)
+	}
+
+	return nil
+}
+
+// ValidateValue checks that a label value is empty or a valid name
+func ValidateValue(value string) error {
+	if value == "" {
+		return nil
+	}
+
+	if len(value) > maxNameLength || !namePattern.MatchString(value) {
+		return fmt.Errorf("invalid label value %q", value)
+	}
+
+	return nil
+}
+
+// Validate checks every key and value in the set
+func (s Set) Validate() error {
+	if len(s) > MaxLabels {
+		return fmt.Errorf("too many labels: %d (max %d)", len(s), MaxLabels)
+	}
+
+	for k, v := range s {
+		if err := ValidateKey(k); err != nil {
+			return err
+		}
+		if err := ValidateValue(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Merge returns a new set with the labels of other layered over s
+func (s Set) Merge(other Set) Set {
+	out := make(Set, len(s)+len(other))
+	for k, v := range s {
+		out[k] = v
+	}
+	for k, v := range other {
+		out[k] = v
+	}
+	return out
+}
+
+// String returns the set as sorted "k=v" pairs separated by commas
+func (s Set) String() string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + s[k]
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// ParseSet parses "k=v,k2=v2" into a validated set
+func ParseSet(s string) (Set, error) {
+	set := Set{}
+
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", pair)
+		}
+		set[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+
+	if err := set.Validate(); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
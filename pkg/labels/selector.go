@@ -0,0 +1,293 @@
+package labels
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Operator is a selector requirement operator
+type Operator string
+
+// Selector operators
+const (
+	Equals       Operator = "="
+	NotEquals    Operator = "!="
+	In           Operator = "in"
+	NotIn        Operator = "notin"
+	Exists       Operator = "exists"
+	DoesNotExist Operator = "!"
+)
+
+// Requirement is a single selector term such as "tier in (gw,edge)". Its JSON
+// form is what the labels_match database function evaluates.
+type Requirement struct {
+	Key      string   `json:"key"`
+	Operator Operator `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// Selector is a conjunction of requirements. An empty selector matches
+// every label set.
+type Selector []Requirement
+
+// Matches reports whether the requirement holds for a label set. As in
+// Kubernetes, != and notin also match sets that lack the key.
+func (r Requirement) Matches(set Set) bool {
+	v, ok := set[r.Key]
+
+	switch r.Operator {
+	case Exists:
+		return ok
+	case DoesNotExist:
+		return !ok
+	case Equals, In:
+		return ok && slices.Contains(r.Values, v)
+	case NotEquals, NotIn:
+		return !ok || !slices.Contains(r.Values, v)
+	default:
+		return false
+	}
+}
+
+// String returns the requirement in selector syntax
+func (r Requirement) String() string {
+	switch r.Operator {
+	case Exists:
+		return r.Key
+	case DoesNotExist:
+		return "!" + r.Key
+	case Equals, NotEquals:
+		return r.Key + string(r.Operator) + r.Values[0]
+	default:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	}
+}
+
+// validate checks the key, values and value count for the operator
+func (r Requirement) validate() error {
+	if err := ValidateKey(r.Key); err != nil {
+		return err
+	}
+
+	switch r.Operator {
+	case Exists, DoesNotExist:
+		if len(r.Values) != 0 {
+			return fmt.Errorf("operator %q takes no values", r.Operator)
+		}
+	case Equals, NotEquals:
+		if len(r.Values) != 1 {
+			return fmt.Errorf("operator %q takes exactly one value", r.Operator)
+		}
+	case In, NotIn:
+		if len(r.Values) == 0 {
+			return fmt.Errorf("operator %q needs at least one value", r.Operator)
+		}
+	default:
+		return fmt.Errorf("unknown operator %q", r.Operator)
+	}
+
+	for _, v := range r.Values {
+		if err := ValidateValue(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Matches reports whether every requirement holds for a label set
+func (s Selector) Matches(set Set) bool {
+	for _, r := range s {
+		if !r.Matches(set) {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty reports whether the selector has no requirements
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
+
+// String returns the selector in its canonical text form
+func (s Selector) String() string {
+	parts := make([]string, len(s))
+	for i, r := range s {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+// MarshalJSON encodes the selector as an array of requirements, never null
+func (s Selector) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]Requirement(s))
+}
+
+// SelectorFromJSON decodes and validates the JSON form of a selector
+func SelectorFromJSON(data []byte) (Selector, error) {
+	var s Selector
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode selector: %w", err)
+	}
+
+	for _, r := range s {
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s == nil {
+		s = Selector{}
+	}
+	return s, nil
+}
+
+// ParseSelector parses a selector such as "region=eu,tier in (gw,edge),!canary".
+// Supported terms are key, !key, key=value, key==value, key!=value,
+// key in (v1,v2) and key notin (v1,v2).
+func ParseSelector(s string) (Selector, error) {
+	p := &parser{input: s}
+	sel := Selector{}
+
+	p.skipSpace()
+	if p.done() {
+		return sel, nil
+	}
+
+	for {
+		r, err := p.requirement()
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", s, err)
+		}
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", s, err)
+		}
+		sel = append(sel, r)
+
+		p.skipSpace()
+		if p.done() {
+			return sel, nil
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf("invalid selector %q: expected ',' at offset %d", s, p.pos)
+		}
+	}
+}
+
+// parser is a cursor over selector text
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) skipSpace() {
+	for !p.done() && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// consume advances past tok if the input continues with it
+func (p *parser) consume(tok string) bool {
+	if strings.HasPrefix(p.input[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+// word reads a run of characters valid in label keys and values
+func (p *parser) word() string {
+	start := p.pos
+	for !p.done() {
+		c := p.input[p.pos]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '/' {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *parser) requirement() (Requirement, error) {
+	p.skipSpace()
+
+	if p.consume("!") {
+		p.skipSpace()
+		key := p.word()
+		if key == "" {
+			return Requirement{}, fmt.Errorf("expected key at offset %d", p.pos)
+		}
+		return Requirement{Key: key, Operator: DoesNotExist}, nil
+	}
+
+	key := p.word()
+	if key == "" {
+		return Requirement{}, fmt.Errorf("expected key at offset %d", p.pos)
+	}
+
+	p.skipSpace()
+	switch {
+	case p.done() || strings.HasPrefix(p.input[p.pos:], ","):
+		return Requirement{Key: key, Operator: Exists}, nil
+	case p.consume("!="):
+		p.skipSpace()
+		return Requirement{Key: key, Operator: NotEquals, Values: []string{p.word()}}, nil
+	case p.consume("=="), p.consume("="):
+		p.skipSpace()
+		return Requirement{Key: key, Operator: Equals, Values: []string{p.word()}}, nil
+	}
+
+	op := Operator(p.word())
+	if op != In && op != NotIn {
+		return Requirement{}, fmt.Errorf("expected operator after %q at offset %d", key, p.pos)
+	}
+
+	values, err := p.valueList()
+	if err != nil {
+		return Requirement{}, err
+	}
+
+	return Requirement{Key: key, Operator: op, Values: values}, nil
+}
+
+// valueList reads "(v1, v2, ...)", returning the values sorted and deduplicated
+func (p *parser) valueList() ([]string, error) {
+	p.skipSpace()
+	if !p.consume("(") {
+		return nil, fmt.Errorf("expected '(' at offset %d", p.pos)
+	}
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.pos:], ")") {
+		return nil, fmt.Errorf("empty value list at offset %d", p.pos)
+	}
+
+	var values []string
+	for {
+		p.skipSpace()
+		values = append(values, p.word())
+		p.skipSpace()
+
+		if p.consume(")") {
+			break
+		}
+		if !p.consume(",") {
+			return nil, fmt.Errorf("expected ',' or ')' at offset %d", p.pos)
+		}
+	}
+
+	sort.Strings(values)
+	return slices.Compact(values), nil
+}
@@ -0,0 +1,149 @@
+package labels
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseSelectorRoundTrip(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"region=eu", "region=eu"},
+		{"region==eu", "region=eu"},
+		{"region = eu", "region=eu"},
+		{"region!=eu", "region!=eu"},
+		{"canary", "canary"},
+		{"!canary", "!canary"},
+		{"! canary", "!canary"},
+		{"tier in (gw,edge)", "tier in (edge,gw)"},
+		{"tier in ( gw , edge, gw )", "tier in (edge,gw)"},
+		{"tier notin (gw)", "tier notin (gw)"},
+		{"example.com/tier=gw", "example.com/tier=gw"},
+		{"region=", "region="},
+		{"region=eu,tier in (gw,edge),!canary", "region=eu,tier in (edge,gw),!canary"},
+		{" region=eu , canary ", "region=eu,canary"},
+	}
+	for _, tc := range tests {
+		sel, err := ParseSelector(tc.in)
+		if err != nil {
+			t.Errorf("ParseSelector(%q): %v", tc.in, err)
+			continue
+		}
+		if got := sel.String(); got != tc.want {
+			t.Errorf("ParseSelector(%q).String() = %q, want %q", tc.in, got, tc.want)
+			continue
+		}
+
+		again, err := ParseSelector(sel.String())
+		if err != nil {
+			t.Errorf("ParseSelector(%q): %v", sel.String(), err)
+			continue
+		}
+		if again.String() != tc.want {
+			t.Errorf("%q did not survive a second parse: got %q", tc.want, again.String())
+		}
+	}
+}
+
+func TestParseSelectorRejects(t *testing.T) {
+	tests := []string{
+		"=eu",
+		",",
+		"region=eu,",
+		"region=eu,,canary",
+		"!",
+		"!=eu",
+		"region=e u",
+		"region=-eu",
+		"region eu",
+		"tier in ()",
+		"tier in (gw",
+		"tier in gw",
+		"tier in (gw edge)",
+		"tier among (gw)",
+		"-region=eu",
+		"region=eu;tier=gw",
+		"UPPER.example.com/tier=gw",
+	}
+	for _, in := range tests {
+		if sel, err := ParseSelector(in); err == nil {
+			t.Errorf("ParseSelector(%q) = %q, want an error", in, sel.String())
+		}
+	}
+}
+
+func TestSelectorJSONRoundTrip(t *testing.T) {
+	for _, in := range []string{"", "region=eu,tier in (edge,gw),!canary,zone!=b,gpu"} {
+		sel, err := ParseSelector(in)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", in, err)
+		}
+
+		data, err := json.Marshal(sel)
+		if err != nil {
+			t.Fatalf("Marshal(%q): %v", in, err)
+		}
+		decoded, err := SelectorFromJSON(data)
+		if err != nil {
+			t.Fatalf("SelectorFromJSON(%s): %v", data, err)
+		}
+		if decoded.String() != in {
+			t.Errorf("%q came back from %s as %q", in, data, decoded.String())
+		}
+	}
+
+	if data, _ := json.Marshal(Selector(nil)); string(data) != "[]" {
+		t.Errorf("nil selector encodes as %s, want []", data)
+	}
+}
+
+func TestSelectorFromJSONRejects(t *testing.T) {
+	tests := []string{
+		`{"key":"region"}`,
+		`[{"key":"region","operator":"~"}]`,
+		`[{"key":"region","operator":"=","values":["eu","us"]}]`,
+		`[{"key":"region","operator":"exists","values":["eu"]}]`,
+		`[{"key":"tier","operator":"in"}]`,
+		`[{"key":"-region","operator":"exists"}]`,
+	}
+	for _, in := range tests {
+		if _, err := SelectorFromJSON([]byte(in)); err == nil {
+			t.Errorf("SelectorFromJSON(%s) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	set := Set{"region": "eu", "tier": "gw"}
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"region=eu", true},
+		{"region=us", false},
+		{"region!=us", true},
+		{"zone!=a", true},
+		{"tier in (gw,edge)", true},
+		{"tier notin (gw)", false},
+		{"zone notin (a)", true},
+		{"zone in (a)", false},
+		{"tier", true},
+		{"zone", false},
+		{"!zone", true},
+		{"!tier", false},
+		{"region=eu,!canary", true},
+		{"region=eu,canary", false},
+	}
+	for _, tc := range tests {
+		sel, err := ParseSelector(tc.selector)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", tc.selector, err)
+		}
+		if got := sel.Matches(set); got != tc.want {
+			t.Errorf("%q matches %v = %v, want %v", tc.selector, set, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Package policy defines the device policy file: the commands, file paths
+// and forward destinations a device's owner permits, signed with their
+// organization key. The agent enforces it whatever the control plane asks;
+// the CLI validates and signs it.
+package policy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/netf/safeedge/pkg/command"
+	"github.com/netf/safeedge/pkg/crypto"
+)
+
+const (
+	// Version is the policy file format version
+	Version = 1
+
+	// Wildcard in commands allows any command, and as a forward destination's
+	// host or port allows any host or port
+	Wildcard = "*"
+
+	// subtreeSuffix ends a file path pattern that matches a directory and
+	// everything below it
+	subtreeSuffix = "/**"
+)
+
+// Policy lists what a device permits. Anything not listed is denied.
+type Policy struct {
+	Version int `json:"version"`
+	// Commands are the command and script names that may run, or "*"
+	Commands []string `json:"commands"`
+	// FilePaths are absolute path patterns, as for path.Match, that may be
+	// read or written; a pattern ending in "/**" matches a whole subtree
+	FilePaths []string `json:"file_paths"`
+	// ForwardDestinations are host:port destinations access sessions may
+	// reach, either of which may be "*"
+	ForwardDestinations []string `json:"forward_destinations"`
+}
+
+// Parse decodes and validates a policy file. Unknown fields are rejected so
+// a misspelt rule is not silently ignored.
+func Parse(data []byte) (*Policy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var p Policy
+	if err := decoder.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if p.Version != Version {
+		return nil, fmt.Errorf("unsupported policy version %d", p.Version)
+	}
+
+	for _, name := range p.Commands {
+		if name == Wildcard {
+			continue
+		}
+		if err := command.ValidateName(name); err != nil {
+			return nil, fmt.Errorf("invalid policy command: %w", err)
+		}
+	}
+	for _, pattern := range p.FilePaths {
+		if err := validatePathPattern(pattern); err != nil {
+			return nil, err
+		}
+	}
+	for i, dest := range p.ForwardDestinations {
+		normalized, err := normalizeDestinationPattern(dest)
+		if err != nil {
+			return nil, err
+		}
+		p.ForwardDestinations[i] = normalized
+	}
+
+	return &p, nil
+}
+
+func validatePathPattern(pattern string) error {
+	if !strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("invalid policy file path %q: must be absolute", pattern)
+	}
+	dir := strings.TrimSuffix(pattern, subtreeSuffix)
+	if dir == "" {
+		dir = "/"
+	}
+	if path.Clean(dir) != dir {
+		return fmt.Errorf("invalid policy file path %q: must be clean", pattern)
+	}
+	if _, err := path.Match(dir, ""); err != nil {
+		return fmt.Errorf("invalid policy file path %q: %w", pattern, err)
+	}
+	return nil
+}
+
+func normalizeDestinationPattern(dest string) (string, error) {
+	host, port, err := net.SplitHostPort(dest)
+	if err != nil || host == "" {
+		return "", fmt.Errorf("invalid policy forward destination %q", dest)
+	}
+	if port != Wildcard {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("invalid policy forward destination %q: invalid port", dest)
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(host), port), nil
+}
+
+// AllowsCommand reports whether a command or script may run
+func (p *Policy) AllowsCommand(name string) bool {
+	for _, allowed := range p.Commands {
+		if allowed == Wildcard || allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsPath reports whether a file may be read or written. The caller
+// resolves symlinks first so a link cannot lead outside the allowed paths.
+func (p *Policy) AllowsPath(name string) bool {
+	if !strings.HasPrefix(name, "/") {
+		return false
+	}
+	name = path.Clean(name)
+
+	for _, pattern := range p.FilePaths {
+		if dir, ok := strings.CutSuffix(pattern, subtreeSuffix); ok {
+			if dir == "" || name == dir || strings.HasPrefix(name, dir+"/") {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsDestination reports whether an access session may reach a host:port
+// destination
+func (p *Policy) AllowsDestination(dest string) bool {
+	host, port, err := net.SplitHostPort(dest)
+	if err != nil {
+		return false
+	}
+	host = strings.ToLower(host)
+
+	for _, allowed := range p.ForwardDestinations {
+		allowedHost, allowedPort, _ := net.SplitHostPort(allowed)
+		if (allowedHost == Wildcard || allowedHost == host) && (allowedPort == Wildcard || allowedPort == port) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignaturePath is where the signature of the policy file at path is kept
+func SignaturePath(path string) string {
+	return path + ".sig"
+}
+
+// Sign signs a policy file, returning the contents of its signature file
+func Sign(data []byte, keys *crypto.Ed25519KeyPair) []byte {
+	signature := keys.Sign(crypto.PolicyMessage(data))
+	return []byte(base64.StdEncoding.EncodeToString(signature) + "\n")
+}
+
+// Verify checks a policy file against its signature file and the base64
+// Ed25519 public key of the organization that signed it
+func Verify(data, signatureFile []byte, publicKey string) error {
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signatureFile)))
+	if err != nil {
+		return fmt.Errorf("failed to decode policy signature: %w", err)
+	}
+	if !crypto.VerifyEd25519(publicKey, crypto.PolicyMessage(data), signature) {
+		return fmt.Errorf("policy signature does not verify")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Package transfer holds the limits and conventions of file transfers
+// between operators and devices, shared by the agent, the control plane and
+// the CLI. Files move in fixed-size chunks, each checked against its BLAKE3
+// hash, and the whole file is checked against its own once complete.
+package transfer
+
+import (
+	"fmt"
+	"path"
+)
+
+const (
+	// ChunkSize is the size of every chunk but a file's last
+	ChunkSize = 1024 * 1024
+
+	// DefaultMaxSize is the largest file transferred unless configured
+	// otherwise
+	DefaultMaxSize = 1024 * 1024 * 1024
+
+	// ChunkHashHeader carries a chunk's BLAKE3 hash alongside its data
+	ChunkHashHeader = "X-Blake3-Hash"
+
+	maxPathLength = 4096
+)
+
+// ValidatePath checks that a device path is absolute and clean. Agents
+// resolve symlinks and check the result against their own restrictions.
+func ValidatePath(name string) error {
+	if name == "" {
+		return fmt.Errorf("path is required")
+	}
+	if len(name) > maxPathLength {
+		return fmt.Errorf("path is longer than %d bytes", maxPathLength)
+	}
+	if !path.IsAbs(name) || path.Clean(name) != name || name == "/" {
+		return fmt.Errorf("path %q must be absolute and clean", name)
+	}
+	return nil
+}
+
+// Chunks returns how many chunks a file of size bytes is sent in
+func Chunks(size int64) int64 {
+	return (size + ChunkSize - 1) / ChunkSize
+}
+
+// ChunkRange returns the offset and length of a file's chunk
+func ChunkRange(size, index int64) (int64, int64, error) {
+	if index < 0 || index >= Chunks(size) {
+		return 0, 0, fmt.Errorf("chunk %d out of range", index)
+	}
+	offset := index * ChunkSize
+	return offset, min(ChunkSize, size-offset), nil
+}